@@ -0,0 +1,132 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "github.com/fxamacker/cbor/v2"
+
+// AccountStorageSize returns total encoded byte size of slabs owned by
+// address that are reachable from roots, including nested collections
+// and external element slabs.  Slabs at other addresses aren't counted
+// or traversed.
+//
+// Slabs are encoded to get their size if storage is
+// PersistentSlabStorage, otherwise ByteSize of slabs is used.
+//
+// Sizes of shared subtrees are computed once: each slab is counted once
+// even if it is reachable from several roots, or roots are nested in
+// each other.
+func AccountStorageSize(storage SlabStorage, address Address, roots []StorageID) (uint64, error) {
+	sizer := newAccountSizer(storage, address)
+
+	var total uint64
+	for _, id := range roots {
+		size, err := sizer.subtreeSize(id)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+type accountSizer struct {
+	storage SlabStorage
+	encMode cbor.EncMode
+	address Address
+	counted map[StorageID]struct{}
+}
+
+// encModeStorage is implemented by storage encoding slabs with cbor.EncMode.
+type encModeStorage interface {
+	storageEncMode() cbor.EncMode
+}
+
+func (s *PersistentSlabStorage) storageEncMode() cbor.EncMode {
+	return s.cborEncMode
+}
+
+func newAccountSizer(storage SlabStorage, address Address) *accountSizer {
+	return &accountSizer{
+		storage: storage,
+		encMode: storageEncModeOf(storage),
+		address: address,
+		counted: make(map[StorageID]struct{}),
+	}
+}
+
+// encodedSlabSize returns encoded size of slab, or ByteSize of slab if
+// encMode is nil.
+func encodedSlabSize(encMode cbor.EncMode, slab Slab) (uint64, error) {
+	if encMode == nil {
+		return uint64(slab.ByteSize()), nil
+	}
+
+	data, err := Encode(slab, encMode)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(data)), nil
+}
+
+// storageEncModeOf returns encoding mode of storage, or nil if storage
+// doesn't provide one.
+func storageEncModeOf(storage SlabStorage) cbor.EncMode {
+	if s, ok := unwrapSlabStorage(storage).(encModeStorage); ok {
+		return s.storageEncMode()
+	}
+	return nil
+}
+
+// subtreeSize returns size of slabs reachable from id that aren't
+// counted yet.
+func (s *accountSizer) subtreeSize(id StorageID) (uint64, error) {
+	var size uint64
+
+	pending := []StorageID{id}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if id.Address != s.address {
+			continue
+		}
+		if _, ok := s.counted[id]; ok {
+			continue
+		}
+		s.counted[id] = struct{}{}
+
+		slab, found, err := s.storage.Retrieve(id)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, NewSlabNotFoundErrorf(id, "slab not found during storage size computation")
+		}
+
+		slabSize, err := encodedSlabSize(s.encMode, slab)
+		if err != nil {
+			return 0, err
+		}
+
+		size += slabSize
+		pending = appendChildSlabIDs(pending, slab.ChildStorables())
+	}
+
+	return size, nil
+}
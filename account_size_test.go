@@ -0,0 +1,86 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountStorageSize(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	otherAddress := Address{8, 7, 6, 5, 4, 3, 2, 1}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	shared, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	for i := uint64(0); i < 200; i++ {
+		require.NoError(t, shared.Append(Uint64Value(i)))
+	}
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(0), shared)
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), NewStringValue(strings.Repeat("a", 512)))
+	require.NoError(t, err)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, array.Append(shared))
+	require.NoError(t, shared.AddReference())
+
+	// Collection at other address isn't attributed to address.
+	other, err := NewArray(storage, otherAddress, typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, other.Append(Uint64Value(0)))
+	require.NoError(t, array.Append(other))
+
+	require.NoError(t, storage.Commit())
+
+	// Encoded size of all slabs at address.
+	var expected uint64
+	for id, data := range storage.baseStorage.(*InMemBaseStorage).segments {
+		if id.Address == address {
+			expected += uint64(len(data))
+		}
+	}
+
+	size, err := AccountStorageSize(storage, address, []StorageID{m.StorageID(), array.StorageID()})
+	require.NoError(t, err)
+	require.Equal(t, expected, size)
+
+	// Nested root is counted once.
+	size, err = AccountStorageSize(storage, address, []StorageID{m.StorageID(), array.StorageID(), shared.StorageID()})
+	require.NoError(t, err)
+	require.Equal(t, expected, size)
+
+	size, err = AccountStorageSize(storage, otherAddress, []StorageID{other.StorageID()})
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(storage.baseStorage.(*InMemBaseStorage).segments[other.StorageID()])), size)
+}
@@ -0,0 +1,319 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// StorableRewriter returns storable with referenced storage IDs replaced by
+// newID.  It is used by MigrateAddress to rewrite embedder storables that
+// contain StorageIDStorable, such as composite storables.
+type StorableRewriter func(storable Storable, newID func(StorageID) StorageID) (Storable, error)
+
+// MigrateAddress moves collection (or StorableSlab) rooted at rootID,
+// including its nested collections and external slabs, to address.
+//
+// New storage IDs are allocated at address for every reachable slab,
+// internal references are updated, slabs are stored with new IDs, and
+// old slabs are removed.  It returns new root ID and mapping from old
+// storage IDs to new storage IDs.
+//
+// StorageIDStorable and SomeStorable references are rewritten by atree.
+// Other storables containing StorageIDStorable are rewritten with rewrite,
+// and MigrationError is returned if rewrite is nil.
+//
+// Collections opened with old root ID must not be used after migration.
+func MigrateAddress(
+	storage SlabStorage,
+	rootID StorageID,
+	address Address,
+	rewrite StorableRewriter,
+) (
+	StorageID,
+	map[StorageID]StorageID,
+	error,
+) {
+
+	// Collect reachable slabs in breadth-first order.
+	var ids []StorageID
+	slabs := make(map[StorageID]Slab)
+
+	queue := []StorageID{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if _, ok := slabs[id]; ok {
+			continue
+		}
+
+		slab, found, err := storage.Retrieve(id)
+		if err != nil {
+			return StorageIDUndefined, nil, err
+		}
+		if !found {
+			return StorageIDUndefined, nil, NewSlabNotFoundErrorf(id, "address migration failed to retrieve slab")
+		}
+
+		slabs[id] = slab
+		ids = append(ids, id)
+
+		queue = appendReferencedIDs(queue, slab.ChildStorables())
+	}
+
+	mapping := make(map[StorageID]StorageID, len(ids))
+	for _, id := range ids {
+		newID, err := storage.GenerateStorageID(address)
+		if err != nil {
+			return StorageIDUndefined, nil, err
+		}
+		mapping[id] = newID
+	}
+
+	r := &addressRewriter{mapping: mapping, rewrite: rewrite}
+
+	// Check all slabs before rewriting them in place,
+	// so slabs aren't modified if any of them can't be rewritten.
+	for _, id := range ids {
+		err := r.check(slabs[id])
+		if err != nil {
+			return StorageIDUndefined, nil, err
+		}
+	}
+
+	newSlabs := make([]Slab, len(ids))
+	for i, id := range ids {
+		newSlab, err := r.rewriteSlab(slabs[id])
+		if err != nil {
+			return StorageIDUndefined, nil, err
+		}
+		newSlabs[i] = newSlab
+	}
+
+	for _, slab := range newSlabs {
+		err := storage.Store(slab.ID(), slab)
+		if err != nil {
+			return StorageIDUndefined, nil, err
+		}
+	}
+
+	for _, id := range ids {
+		err := storage.Remove(id)
+		if err != nil {
+			return StorageIDUndefined, nil, err
+		}
+	}
+
+	return mapping[rootID], mapping, nil
+}
+
+// appendReferencedIDs appends storage IDs referenced by storables
+// and their child storables.
+func appendReferencedIDs(ids []StorageID, storables []Storable) []StorageID {
+	for len(storables) > 0 {
+		var next []Storable
+		for _, s := range storables {
+			if id, ok := s.(StorageIDStorable); ok {
+				ids = append(ids, StorageID(id))
+			}
+			next = append(next, s.ChildStorables()...)
+		}
+		storables = next
+	}
+	return ids
+}
+
+type addressRewriter struct {
+	mapping map[StorageID]StorageID
+	rewrite StorableRewriter
+}
+
+func (r *addressRewriter) newID(id StorageID) StorageID {
+	if newID, ok := r.mapping[id]; ok {
+		return newID
+	}
+	return id
+}
+
+// check returns error if slab can't be rewritten.
+func (r *addressRewriter) check(slab Slab) error {
+	switch slab.(type) {
+	case *ArrayDataSlab, *ArrayMetaDataSlab, *MapDataSlab, *MapMetaDataSlab, *BasicArrayDataSlab, StorableSlab, *StorableSlab:
+	default:
+		return NewUserError(NewMigrationErrorf("slab %s of type %T can't be moved to another address", slab.ID(), slab))
+	}
+
+	if r.rewrite != nil {
+		return nil
+	}
+
+	for _, storable := range slab.ChildStorables() {
+		if !r.isRewritable(storable) {
+			return NewUserError(NewMigrationErrorf("storable %T references slabs and can't be rewritten without StorableRewriter", storable))
+		}
+	}
+	return nil
+}
+
+// isRewritable returns true if storable can be rewritten without StorableRewriter.
+func (r *addressRewriter) isRewritable(storable Storable) bool {
+	switch s := storable.(type) {
+	case StorageIDStorable:
+		return true
+	case SomeStorable:
+		return r.isRewritable(s.Storable)
+	}
+	return len(appendReferencedIDs(nil, storable.ChildStorables())) == 0
+}
+
+// rewriteSlab updates slab in place (except storable slab, which is copied),
+// and returns slab with new storage ID and references.
+func (r *addressRewriter) rewriteSlab(slab Slab) (Slab, error) {
+	var err error
+
+	switch s := slab.(type) {
+
+	case *ArrayDataSlab:
+		s.header.id = r.newID(s.header.id)
+		if s.next != StorageIDUndefined {
+			s.next = r.newID(s.next)
+		}
+		for i, e := range s.elements {
+			s.elements[i], err = r.rewriteStorable(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+
+	case *ArrayMetaDataSlab:
+		s.header.id = r.newID(s.header.id)
+		for i := range s.childrenHeaders {
+			s.childrenHeaders[i].id = r.newID(s.childrenHeaders[i].id)
+		}
+		return s, nil
+
+	case *MapDataSlab:
+		s.header.id = r.newID(s.header.id)
+		if s.next != StorageIDUndefined {
+			s.next = r.newID(s.next)
+		}
+		err = r.rewriteElements(s.elements)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+
+	case *MapMetaDataSlab:
+		s.header.id = r.newID(s.header.id)
+		for i := range s.childrenHeaders {
+			s.childrenHeaders[i].id = r.newID(s.childrenHeaders[i].id)
+		}
+		return s, nil
+
+	case *BasicArrayDataSlab:
+		s.header.id = r.newID(s.header.id)
+		for i, e := range s.elements {
+			s.elements[i], err = r.rewriteStorable(e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+
+	case StorableSlab:
+		storable, err := r.rewriteStorable(s.Storable)
+		if err != nil {
+			return nil, err
+		}
+		return StorableSlab{StorageID: r.newID(s.StorageID), Storable: storable}, nil
+
+	case *StorableSlab:
+		storable, err := r.rewriteStorable(s.Storable)
+		if err != nil {
+			return nil, err
+		}
+		return &StorableSlab{StorageID: r.newID(s.StorageID), Storable: storable}, nil
+
+	default:
+		return nil, NewUnreachableError()
+	}
+}
+
+func (r *addressRewriter) rewriteElements(elems elements) error {
+	switch v := elems.(type) {
+	case *hkeyElements:
+		for _, e := range v.elems {
+			err := r.rewriteElement(e)
+			if err != nil {
+				return err
+			}
+		}
+	case *singleElements:
+		for _, e := range v.elems {
+			err := r.rewriteElement(e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *addressRewriter) rewriteElement(e element) error {
+	var err error
+
+	switch v := e.(type) {
+	case *externalCollisionGroup:
+		v.id = r.newID(v.id)
+
+	case *inlineCollisionGroup:
+		return r.rewriteElements(v.elements)
+
+	case *singleElement:
+		v.key, err = r.rewriteStorable(v.key)
+		if err != nil {
+			return err
+		}
+		v.value, err = r.rewriteStorable(v.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *addressRewriter) rewriteStorable(storable Storable) (Storable, error) {
+	switch s := storable.(type) {
+
+	case StorageIDStorable:
+		return StorageIDStorable(r.newID(StorageID(s))), nil
+
+	case SomeStorable:
+		inner, err := r.rewriteStorable(s.Storable)
+		if err != nil {
+			return nil, err
+		}
+		return SomeStorable{Storable: inner}, nil
+	}
+
+	if len(appendReferencedIDs(nil, storable.ChildStorables())) == 0 {
+		return storable, nil
+	}
+
+	return r.rewrite(storable, r.newID)
+}
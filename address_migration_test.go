@@ -0,0 +1,137 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateAddress(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 256
+	const nestedArraySize = 50
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	newAddress := Address{8, 7, 6, 5, 4, 3, 2, 1}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	largeString := NewStringValue(strings.Repeat("a", int(MaxInlineMapKeyOrValueSize)))
+
+	for i := uint64(0); i < mapSize; i++ {
+		var v Value
+		switch i % 3 {
+		case 0:
+			nested, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			for j := uint64(0); j < nestedArraySize; j++ {
+				err := nested.Append(Uint64Value(j))
+				require.NoError(t, err)
+			}
+			v = nested
+		case 1:
+			// Large string is stored in external slab.
+			v = largeString
+		default:
+			v = SomeValue{Uint64Value(i)}
+		}
+
+		existingStorable, err := m.Set(compare, hashInputProvider, Uint64Value(i), v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	oldIDs := make(map[StorageID]struct{})
+	for id := range storage.baseStorage.(*InMemBaseStorage).segments {
+		oldIDs[id] = struct{}{}
+	}
+
+	rootID := m.StorageID()
+
+	newRootID, mapping, err := MigrateAddress(storage, rootID, newAddress, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, len(oldIDs), len(mapping))
+	require.Equal(t, mapping[rootID], newRootID)
+	for oldID, newID := range mapping {
+		require.Contains(t, oldIDs, oldID)
+		require.Equal(t, newAddress, newID.Address)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// All slabs are moved to new address.
+	segments := storage.baseStorage.(*InMemBaseStorage).segments
+	require.Equal(t, len(oldIDs), len(segments))
+	for id := range segments {
+		require.Equal(t, newAddress, id.Address)
+	}
+
+	// Reload map from new root.
+	storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	m2, err := NewMapWithRootID(storage2, newRootID, NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, newAddress, m2.Address())
+	require.Equal(t, uint64(mapSize), m2.Count())
+
+	for i := uint64(0); i < mapSize; i++ {
+		storable, err := m2.Get(compare, hashInputProvider, Uint64Value(i))
+		require.NoError(t, err)
+
+		v, err := storable.StoredValue(storage2)
+		require.NoError(t, err)
+
+		switch i % 3 {
+		case 0:
+			nested, ok := v.(*Array)
+			require.True(t, ok)
+			require.Equal(t, newAddress, nested.Address())
+			require.Equal(t, uint64(nestedArraySize), nested.Count())
+			e, err := nested.Get(nestedArraySize - 1)
+			require.NoError(t, err)
+			require.Equal(t, Uint64Value(nestedArraySize-1), e)
+		case 1:
+			require.Equal(t, largeString, v)
+		default:
+			require.Equal(t, SomeValue{Uint64Value(i)}, v)
+		}
+	}
+
+	err = ValidMap(m2, typeInfo, typeInfoComparator, hashInputProvider)
+	require.NoError(t, err)
+
+	// All slabs are loaded, so health check covers moved slabs.
+	rootIDs, err := CheckStorageHealth(storage2, 1)
+	require.NoError(t, err)
+	require.Contains(t, rootIDs, newRootID)
+}
@@ -0,0 +1,288 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"math/big"
+	"sync"
+)
+
+// StorablePredicate reports whether element storable matches.
+type StorablePredicate func(element Storable) (bool, error)
+
+// StorableLessFunc reports whether element storable a is less than b.
+type StorableLessFunc func(a, b Storable) (bool, error)
+
+// IntegerStorableFunc sets v to integer value of element storable.
+// It returns false if element isn't an integer.
+type IntegerStorableFunc func(element Storable, v *big.Int) (bool, error)
+
+// Aggregator computes an aggregate of array elements slab by slab.
+//
+// AggregateSlab is called with storables of each data slab and returns
+// partial result for them.  Merge combines partial results of adjacent
+// element ranges, with a preceding b.  If Aggregate runs with parallelism
+// greater than 1, AggregateSlab is called concurrently and must not
+// access storage.
+type Aggregator interface {
+	AggregateSlab(elements []Storable) (interface{}, error)
+	Merge(a, b interface{}) (interface{}, error)
+}
+
+// AggregateOption configures Array.Aggregate.
+type AggregateOption func(opts *aggregateOptions) *aggregateOptions
+
+type aggregateOptions struct {
+	parallelism int
+}
+
+// WithAggregateParallelism aggregates up to n data slabs concurrently.
+// Slabs are still retrieved from storage sequentially.
+func WithAggregateParallelism(n int) AggregateOption {
+	return func(opts *aggregateOptions) *aggregateOptions {
+		opts.parallelism = n
+		return opts
+	}
+}
+
+// Aggregate returns result of agg over array elements.  Elements aren't
+// decoded, and are passed to agg one data slab at a time.
+func (a *Array) Aggregate(agg Aggregator, options ...AggregateOption) (interface{}, error) {
+
+	opts := &aggregateOptions{parallelism: 1}
+	for _, option := range options {
+		opts = option(opts)
+	}
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationIterate)
+
+	slab, err := firstArrayDataSlab(storage, a.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var slabs [][]Storable
+	for {
+		slabs = append(slabs, slab.elements)
+
+		if slab.next == StorageIDUndefined {
+			break
+		}
+
+		slab, err = getArrayDataSlab(storage, slab.next)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := aggregateSlabs(agg, slabs, opts.parallelism)
+	if err != nil {
+		return nil, err
+	}
+
+	result := results[0]
+	for _, r := range results[1:] {
+		result, err = agg.Merge(result, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// aggregateSlabs returns partial results of slabs in order.
+func aggregateSlabs(agg Aggregator, slabs [][]Storable, parallelism int) ([]interface{}, error) {
+	results := make([]interface{}, len(slabs))
+
+	if parallelism <= 1 || len(slabs) == 1 {
+		for i, elements := range slabs {
+			result, err := agg.AggregateSlab(elements)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = result
+		}
+		return results, nil
+	}
+
+	errs := make([]error, len(slabs))
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = agg.AggregateSlab(slabs[i])
+			}
+		}()
+	}
+
+	for i := range slabs {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	// Return error of first failed slab.
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func getArrayDataSlab(storage SlabStorage, id StorageID) (*ArrayDataSlab, error) {
+	slab, err := getArraySlab(storage, id)
+	if err != nil {
+		return nil, err
+	}
+	dataSlab, ok := slab.(*ArrayDataSlab)
+	if !ok {
+		return nil, NewSlabDataErrorf("slab %s isn't ArrayDataSlab", id)
+	}
+	return dataSlab, nil
+}
+
+type countAggregator struct {
+	predicate StorablePredicate
+}
+
+// NewCountAggregator returns Aggregator counting elements matching
+// predicate as uint64.  All elements are counted if predicate is nil.
+func NewCountAggregator(predicate StorablePredicate) Aggregator {
+	return countAggregator{predicate: predicate}
+}
+
+func (c countAggregator) AggregateSlab(elements []Storable) (interface{}, error) {
+	if c.predicate == nil {
+		return uint64(len(elements)), nil
+	}
+
+	count := uint64(0)
+	for _, e := range elements {
+		match, err := c.predicate(e)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (countAggregator) Merge(a, b interface{}) (interface{}, error) {
+	return a.(uint64) + b.(uint64), nil
+}
+
+type sumAggregator struct {
+	value IntegerStorableFunc
+}
+
+// NewSumAggregator returns Aggregator summing integer elements
+// as *big.Int.  Elements for which value returns false are skipped.
+func NewSumAggregator(value IntegerStorableFunc) Aggregator {
+	return sumAggregator{value: value}
+}
+
+func (s sumAggregator) AggregateSlab(elements []Storable) (interface{}, error) {
+	sum := new(big.Int)
+	v := new(big.Int)
+	for _, e := range elements {
+		ok, err := s.value(e, v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			sum.Add(sum, v)
+		}
+	}
+	return sum, nil
+}
+
+func (sumAggregator) Merge(a, b interface{}) (interface{}, error) {
+	return a.(*big.Int).Add(a.(*big.Int), b.(*big.Int)), nil
+}
+
+type extremeAggregator struct {
+	less StorableLessFunc
+	max  bool
+}
+
+// NewMinAggregator returns Aggregator finding the first smallest element
+// storable, or nil if array is empty.
+func NewMinAggregator(less StorableLessFunc) Aggregator {
+	return extremeAggregator{less: less}
+}
+
+// NewMaxAggregator returns Aggregator finding the first largest element
+// storable, or nil if array is empty.
+func NewMaxAggregator(less StorableLessFunc) Aggregator {
+	return extremeAggregator{less: less, max: true}
+}
+
+func (x extremeAggregator) AggregateSlab(elements []Storable) (interface{}, error) {
+	var result Storable
+	for _, e := range elements {
+		if result == nil {
+			result = e
+			continue
+		}
+		replace, err := x.replaces(result, e)
+		if err != nil {
+			return nil, err
+		}
+		if replace {
+			result = e
+		}
+	}
+	return result, nil
+}
+
+func (x extremeAggregator) Merge(a, b interface{}) (interface{}, error) {
+	if a == nil || a.(Storable) == nil {
+		return b, nil
+	}
+	if b == nil || b.(Storable) == nil {
+		return a, nil
+	}
+	replace, err := x.replaces(a.(Storable), b.(Storable))
+	if err != nil {
+		return nil, err
+	}
+	if replace {
+		return b, nil
+	}
+	return a, nil
+}
+
+// replaces reports whether e replaces current result.
+// Ties keep current result, which precedes e.
+func (x extremeAggregator) replaces(current, e Storable) (bool, error) {
+	if x.max {
+		return x.less(current, e)
+	}
+	return x.less(e, current)
+}
@@ -0,0 +1,159 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayAggregate(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	isEven := func(s Storable) (bool, error) {
+		return uint64(s.(Uint64Value))%2 == 0, nil
+	}
+
+	uint64Value := func(s Storable, v *big.Int) (bool, error) {
+		u, ok := s.(Uint64Value)
+		if !ok {
+			return false, nil
+		}
+		v.SetUint64(uint64(u))
+		return true, nil
+	}
+
+	less := func(a, b Storable) (bool, error) {
+		return a.(Uint64Value) < b.(Uint64Value), nil
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		count, err := array.Aggregate(NewCountAggregator(nil))
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), count)
+
+		sum, err := array.Aggregate(NewSumAggregator(uint64Value))
+		require.NoError(t, err)
+		require.Equal(t, 0, sum.(*big.Int).Sign())
+
+		min, err := array.Aggregate(NewMinAggregator(less))
+		require.NoError(t, err)
+		require.Nil(t, min)
+	})
+
+	t.Run("aggregators", func(t *testing.T) {
+		const arraySize = 4096
+
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		r := newRand(t)
+
+		expectedSum := new(big.Int)
+		expectedEvenCount := uint64(0)
+		expectedMin := Uint64Value(^uint64(0))
+		expectedMax := Uint64Value(0)
+
+		for i := 0; i < arraySize; i++ {
+			v := Uint64Value(r.Uint64())
+			err := array.Append(v)
+			require.NoError(t, err)
+
+			expectedSum.Add(expectedSum, new(big.Int).SetUint64(uint64(v)))
+			if v%2 == 0 {
+				expectedEvenCount++
+			}
+			if v < expectedMin {
+				expectedMin = v
+			}
+			if v > expectedMax {
+				expectedMax = v
+			}
+		}
+
+		stats, err := GetArrayStats(array)
+		require.NoError(t, err)
+		require.True(t, stats.DataSlabCount > 1)
+
+		for _, parallelism := range []int{1, 4} {
+			option := WithAggregateParallelism(parallelism)
+
+			count, err := array.Aggregate(NewCountAggregator(nil), option)
+			require.NoError(t, err)
+			require.Equal(t, uint64(arraySize), count)
+
+			count, err = array.Aggregate(NewCountAggregator(isEven), option)
+			require.NoError(t, err)
+			require.Equal(t, expectedEvenCount, count)
+
+			sum, err := array.Aggregate(NewSumAggregator(uint64Value), option)
+			require.NoError(t, err)
+			require.Equal(t, 0, expectedSum.Cmp(sum.(*big.Int)))
+
+			min, err := array.Aggregate(NewMinAggregator(less), option)
+			require.NoError(t, err)
+			require.Equal(t, expectedMin, min)
+
+			max, err := array.Aggregate(NewMaxAggregator(less), option)
+			require.NoError(t, err)
+			require.Equal(t, expectedMax, max)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 1000; i++ {
+			err := array.Append(Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		testErr := errors.New("test")
+
+		predicate := func(s Storable) (bool, error) {
+			if s.(Uint64Value) == 500 {
+				return false, testErr
+			}
+			return true, nil
+		}
+
+		for _, parallelism := range []int{1, 4} {
+			_, err := array.Aggregate(NewCountAggregator(predicate), WithAggregateParallelism(parallelism))
+			require.Equal(t, testErr, err)
+		}
+	})
+}
@@ -20,16 +20,16 @@ package atree
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"math"
 	"strings"
+	"sync/atomic"
 
 	"github.com/fxamacker/cbor/v2"
 )
 
 const (
-	storageIDSize = 16
+	storageIDSize = AddressSize + StorageIndexSize
 
 	// version and flag size: version (1 byte) + flag (1 byte)
 	versionAndFlagSize = 2
@@ -60,6 +60,23 @@ type ArraySlabHeader struct {
 
 type ArrayExtraData struct {
 	TypeInfo TypeInfo // array type
+	// Migration is progress of in-place migration, or nil if array isn't being migrated.
+	Migration *MigrationProgress
+	// ExtraRefs is number of parent references to array beyond the first.
+	ExtraRefs uint64
+	// UserMetadata is application metadata, or nil if it isn't set.
+	UserMetadata *UserMetadata
+	// MutationSequence is number of array mutations plus one, or 0 if
+	// mutation sequence isn't enabled.
+	MutationSequence uint64
+	// Provenance is creation metadata, or nil if array was created
+	// without provenance.
+	Provenance *Provenance
+	// Nesting is nesting information, or nil if array isn't mutated
+	// with nesting depth limit.
+	Nesting *Nesting
+	// Limits is limits set by SetLimits, or nil if array has no limits.
+	Limits *LimitsRecord
 }
 
 // ArrayDataSlab is leaf node, implementing ArraySlab.
@@ -75,7 +92,7 @@ type ArrayDataSlab struct {
 
 func (a *ArrayDataSlab) StoredValue(storage SlabStorage) (Value, error) {
 	if a.extraData == nil {
-		return nil, NewNotValueError(a.ID())
+		return nil, NewUserError(NewNotValueError(a.ID()))
 	}
 	return &Array{
 		Storage: storage,
@@ -103,7 +120,7 @@ var _ ArraySlab = &ArrayMetaDataSlab{}
 
 func (a *ArrayMetaDataSlab) StoredValue(storage SlabStorage) (Value, error) {
 	if a.extraData == nil {
-		return nil, NewNotValueError(a.ID())
+		return nil, NewUserError(NewNotValueError(a.ID()))
 	}
 	return &Array{
 		Storage: storage,
@@ -140,8 +157,14 @@ type ArraySlab interface {
 
 // Array is tree
 type Array struct {
-	Storage SlabStorage
-	root    ArraySlab
+	Storage          SlabStorage
+	root             ArraySlab
+	elementValidator ElementValidator
+	logger           Logger
+	changeSink       ChangeSink
+	journal          *operationJournal
+	stats            OperationStats
+	statsStorage     atomic.Value
 }
 
 var _ Value = &Array{}
@@ -156,6 +179,17 @@ func (a *Array) Storable(_ SlabStorage, _ Address, _ uint64) (Storable, error) {
 
 const arrayExtraDataLength = 1
 
+// Keys of optional array extra data fields.
+const (
+	arrayExtraDataFieldMigration        = 1
+	arrayExtraDataFieldExtraRefs        = 2
+	arrayExtraDataFieldUserMetadata     = 3
+	arrayExtraDataFieldMutationSequence = 4
+	arrayExtraDataFieldProvenance       = 5
+	arrayExtraDataFieldNesting          = 6
+	arrayExtraDataFieldLimits           = 7
+)
+
 func newArrayExtraDataFromData(
 	data []byte,
 	decMode cbor.DecMode,
@@ -167,13 +201,13 @@ func newArrayExtraDataFromData(
 ) {
 	// Check data length
 	if len(data) < versionAndFlagSize {
-		return nil, data, errors.New("data is too short for array extra data")
+		return nil, data, NewDecodingErrorf("data is too short for array extra data")
 	}
 
 	// Check flag
 	flag := data[1]
 	if !isRoot(flag) {
-		return nil, data, fmt.Errorf("data has invalid flag 0x%x, want root flag", flag)
+		return nil, data, NewDecodingErrorf("data has invalid flag 0x%x, want root flag", flag)
 	}
 
 	// Decode extra data
@@ -185,11 +219,12 @@ func newArrayExtraDataFromData(
 		return nil, data, err
 	}
 
-	if length != arrayExtraDataLength {
-		return nil, data, fmt.Errorf(
-			"data has invalid length %d, want %d",
+	if length != arrayExtraDataLength && length != arrayExtraDataLength+1 {
+		return nil, data, NewDecodingErrorf(
+			"data has invalid length %d, want %d or %d",
 			length,
 			arrayExtraDataLength,
+			arrayExtraDataLength+1,
 		)
 	}
 
@@ -198,13 +233,205 @@ func newArrayExtraDataFromData(
 		return nil, data, err
 	}
 
+	extraData := &ArrayExtraData{
+		TypeInfo: typeInfo,
+	}
+
+	if length > arrayExtraDataLength {
+		err = extraData.decodeOptionalFields(dec)
+		if err != nil {
+			return nil, data, err
+		}
+	}
+
 	// Reslice for remaining data
 	n := dec.NumBytesDecoded()
 	data = data[versionAndFlagSize+n:]
 
-	return &ArrayExtraData{
-		TypeInfo: typeInfo,
-	}, data, nil
+	return extraData, data, nil
+}
+
+// decodeOptionalFields decodes optional fields encoded by encodeOptionalFields.
+func (a *ArrayExtraData) decodeOptionalFields(dec *cbor.StreamDecoder) error {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return err
+	}
+
+	if length%2 != 0 {
+		return NewDecodingErrorf("optional fields have invalid length %d, want even length", length)
+	}
+
+	for i := uint64(0); i < length/2; i++ {
+		key, err := dec.DecodeUint64()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case arrayExtraDataFieldMigration:
+			a.Migration, err = decodeMigrationProgress(dec)
+			if err != nil {
+				return err
+			}
+
+		case arrayExtraDataFieldExtraRefs:
+			a.ExtraRefs, err = dec.DecodeUint64()
+			if err != nil {
+				return err
+			}
+
+		case arrayExtraDataFieldUserMetadata:
+			a.UserMetadata, err = decodeUserMetadata(dec)
+			if err != nil {
+				return err
+			}
+
+		case arrayExtraDataFieldMutationSequence:
+			a.MutationSequence, err = dec.DecodeUint64()
+			if err != nil {
+				return err
+			}
+
+		case arrayExtraDataFieldProvenance:
+			a.Provenance, err = decodeProvenance(dec)
+			if err != nil {
+				return err
+			}
+
+		case arrayExtraDataFieldNesting:
+			a.Nesting, err = decodeNesting(dec)
+			if err != nil {
+				return err
+			}
+
+		case arrayExtraDataFieldLimits:
+			a.Limits, err = decodeLimitsRecord(dec)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return NewDecodingErrorf("optional field has unknown key %d", key)
+		}
+	}
+
+	return nil
+}
+
+// optionalFieldCount returns number of optional fields with non-default values.
+func (a *ArrayExtraData) optionalFieldCount() uint64 {
+	var count uint64
+	if a.Migration != nil {
+		count++
+	}
+	if a.ExtraRefs != 0 {
+		count++
+	}
+	if a.UserMetadata != nil {
+		count++
+	}
+	if a.MutationSequence != 0 {
+		count++
+	}
+	if a.Provenance != nil {
+		count++
+	}
+	if a.Nesting != nil {
+		count++
+	}
+	if a.Limits != nil {
+		count++
+	}
+	return count
+}
+
+// encodeOptionalFields encodes optional fields with non-default values
+// as CBOR array of alternating field keys and values, ordered by field keys.
+func (a *ArrayExtraData) encodeOptionalFields(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(a.optionalFieldCount() * 2)
+	if err != nil {
+		return err
+	}
+
+	if a.Migration != nil {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldMigration)
+		if err != nil {
+			return err
+		}
+		err = a.Migration.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.ExtraRefs != 0 {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldExtraRefs)
+		if err != nil {
+			return err
+		}
+		err = enc.CBOR.EncodeUint64(a.ExtraRefs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.UserMetadata != nil {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldUserMetadata)
+		if err != nil {
+			return err
+		}
+		err = a.UserMetadata.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.MutationSequence != 0 {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldMutationSequence)
+		if err != nil {
+			return err
+		}
+		err = enc.CBOR.EncodeUint64(a.MutationSequence)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Provenance != nil {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldProvenance)
+		if err != nil {
+			return err
+		}
+		err = a.Provenance.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Nesting != nil {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldNesting)
+		if err != nil {
+			return err
+		}
+		err = a.Nesting.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Limits != nil {
+		err = enc.CBOR.EncodeUint64(arrayExtraDataFieldLimits)
+		if err != nil {
+			return err
+		}
+		err = a.Limits.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Encode encodes extra data to the given encoder.
@@ -217,7 +444,11 @@ func newArrayExtraDataFromData(
 //
 // Content (for now):
 //
-//   CBOR encoded array of extra data: cborArray{type info}
+//   CBOR encoded array of extra data:
+//   cborArray{type info} or cborArray{type info, optional fields}
+//
+// Optional fields are only encoded if any of them has non-default value.
+// They are encoded as CBOR array of alternating field keys and values.
 //
 // Extra data flag is the same as the slab flag it prepends.
 //
@@ -234,8 +465,15 @@ func (a *ArrayExtraData) Encode(enc *Encoder, flag byte) error {
 		return err
 	}
 
+	hasOptionalFields := a.optionalFieldCount() > 0
+
+	length := uint64(arrayExtraDataLength)
+	if hasOptionalFields {
+		length++
+	}
+
 	// Encode extra data
-	err = enc.CBOR.EncodeArrayHead(arrayExtraDataLength)
+	err = enc.CBOR.EncodeArrayHead(length)
 	if err != nil {
 		return err
 	}
@@ -245,6 +483,13 @@ func (a *ArrayExtraData) Encode(enc *Encoder, flag byte) error {
 		return err
 	}
 
+	if hasOptionalFields {
+		err = a.encodeOptionalFields(enc)
+		if err != nil {
+			return err
+		}
+	}
+
 	return enc.CBOR.Flush()
 }
 
@@ -455,14 +700,14 @@ func (a *ArrayDataSlab) ChildStorables() []Storable {
 
 func (a *ArrayDataSlab) Get(_ SlabStorage, index uint64) (Storable, error) {
 	if index >= uint64(len(a.elements)) {
-		return nil, NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 	return a.elements[index], nil
 }
 
 func (a *ArrayDataSlab) Set(storage SlabStorage, address Address, index uint64, value Value) (Storable, error) {
 	if index >= uint64(len(a.elements)) {
-		return nil, NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 
 	oldElem := a.elements[index]
@@ -473,6 +718,8 @@ func (a *ArrayDataSlab) Set(storage SlabStorage, address Address, index uint64,
 		return nil, err
 	}
 
+	logOversizedElement(storage, address, storable, MaxInlineArrayElementSize)
+
 	a.elements[index] = storable
 	a.header.size = a.header.size - oldSize + storable.ByteSize()
 
@@ -486,7 +733,7 @@ func (a *ArrayDataSlab) Set(storage SlabStorage, address Address, index uint64,
 
 func (a *ArrayDataSlab) Insert(storage SlabStorage, address Address, index uint64, value Value) error {
 	if index > uint64(len(a.elements)) {
-		return NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 
 	storable, err := value.Storable(storage, address, MaxInlineArrayElementSize)
@@ -494,6 +741,8 @@ func (a *ArrayDataSlab) Insert(storage SlabStorage, address Address, index uint6
 		return err
 	}
 
+	logOversizedElement(storage, address, storable, MaxInlineArrayElementSize)
+
 	if index == uint64(len(a.elements)) {
 		a.elements = append(a.elements, storable)
 	} else {
@@ -510,7 +759,7 @@ func (a *ArrayDataSlab) Insert(storage SlabStorage, address Address, index uint6
 
 func (a *ArrayDataSlab) Remove(storage SlabStorage, index uint64) (Storable, error) {
 	if index >= uint64(len(a.elements)) {
-		return nil, NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 
 	v := a.elements[index]
@@ -1013,7 +1262,7 @@ func (a *ArrayMetaDataSlab) childSlabIndexInfo(
 	err error,
 ) {
 	if index >= uint64(a.header.count) {
-		return 0, 0, StorageID{}, NewIndexOutOfBoundsError(index, 0, uint64(a.header.count))
+		return 0, 0, StorageID{}, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(a.header.count)))
 	}
 
 	// Either perform a linear scan (for small number of children),
@@ -1057,17 +1306,22 @@ func (a *ArrayMetaDataSlab) childSlabIndexInfo(
 
 func (a *ArrayMetaDataSlab) Get(storage SlabStorage, index uint64) (Storable, error) {
 
-	_, adjustedIndex, childID, err := a.childSlabIndexInfo(index)
+	childHeaderIndex, adjustedIndex, childID, err := a.childSlabIndexInfo(index)
 	if err != nil {
 		return nil, err
 	}
 
 	child, err := getArraySlab(storage, childID)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
+	}
+
+	storable, err := child.Get(storage, adjustedIndex)
+	if err != nil {
+		return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
-	return child.Get(storage, adjustedIndex)
+	return storable, nil
 }
 
 func (a *ArrayMetaDataSlab) Set(storage SlabStorage, address Address, index uint64, value Value) (Storable, error) {
@@ -1079,12 +1333,12 @@ func (a *ArrayMetaDataSlab) Set(storage SlabStorage, address Address, index uint
 
 	child, err := getArraySlab(storage, childID)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
 	existingElem, err := child.Set(storage, address, adjustedIndex, value)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
 	a.childrenHeaders[childHeaderIndex] = child.Header()
@@ -1095,7 +1349,7 @@ func (a *ArrayMetaDataSlab) Set(storage SlabStorage, address Address, index uint
 	if child.IsFull() {
 		err = a.SplitChildSlab(storage, child, childHeaderIndex)
 		if err != nil {
-			return nil, err
+			return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 		}
 		return existingElem, nil
 	}
@@ -1103,7 +1357,7 @@ func (a *ArrayMetaDataSlab) Set(storage SlabStorage, address Address, index uint
 	if underflowSize, underflow := child.IsUnderflow(); underflow {
 		err = a.MergeOrRebalanceChildSlab(storage, child, childHeaderIndex, underflowSize)
 		if err != nil {
-			return nil, err
+			return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 		}
 		return existingElem, nil
 	}
@@ -1120,7 +1374,7 @@ func (a *ArrayMetaDataSlab) Set(storage SlabStorage, address Address, index uint
 // If index == a.header.count, Insert appends v to the end of underlying slab.
 func (a *ArrayMetaDataSlab) Insert(storage SlabStorage, address Address, index uint64, value Value) error {
 	if index > uint64(a.header.count) {
-		return NewIndexOutOfBoundsError(index, 0, uint64(a.header.count))
+		return NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(a.header.count)))
 	}
 
 	var childID StorageID
@@ -1141,12 +1395,12 @@ func (a *ArrayMetaDataSlab) Insert(storage SlabStorage, address Address, index u
 
 	child, err := getArraySlab(storage, childID)
 	if err != nil {
-		return err
+		return wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
 	err = child.Insert(storage, address, adjustedIndex, value)
 	if err != nil {
-		return err
+		return wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
 	a.header.count++
@@ -1162,7 +1416,11 @@ func (a *ArrayMetaDataSlab) Insert(storage SlabStorage, address Address, index u
 	// check if full
 
 	if child.IsFull() {
-		return a.SplitChildSlab(storage, child, childHeaderIndex)
+		err = a.SplitChildSlab(storage, child, childHeaderIndex)
+		if err != nil {
+			return wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
+		}
+		return nil
 	}
 
 	// Insertion always increases the size,
@@ -1174,7 +1432,7 @@ func (a *ArrayMetaDataSlab) Insert(storage SlabStorage, address Address, index u
 func (a *ArrayMetaDataSlab) Remove(storage SlabStorage, index uint64) (Storable, error) {
 
 	if index >= uint64(a.header.count) {
-		return nil, NewIndexOutOfBoundsError(index, 0, uint64(a.header.count))
+		return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(a.header.count)))
 	}
 
 	childHeaderIndex, adjustedIndex, childID, err := a.childSlabIndexInfo(index)
@@ -1184,12 +1442,12 @@ func (a *ArrayMetaDataSlab) Remove(storage SlabStorage, index uint64) (Storable,
 
 	child, err := getArraySlab(storage, childID)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
 	v, err := child.Remove(storage, adjustedIndex)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 	}
 
 	a.header.count--
@@ -1207,7 +1465,7 @@ func (a *ArrayMetaDataSlab) Remove(storage SlabStorage, index uint64) (Storable,
 	if underflowSize, isUnderflow := child.IsUnderflow(); isUnderflow {
 		err = a.MergeOrRebalanceChildSlab(storage, child, childHeaderIndex, underflowSize)
 		if err != nil {
-			return nil, err
+			return nil, wrapSlabPathError(err, a.header.id, childHeaderIndex, childID)
 		}
 	}
 
@@ -1223,11 +1481,23 @@ func (a *ArrayMetaDataSlab) Remove(storage SlabStorage, index uint64) (Storable,
 }
 
 func (a *ArrayMetaDataSlab) SplitChildSlab(storage SlabStorage, child ArraySlab, childHeaderIndex int) error {
+	originalID := child.ID()
+
+	splitSize := uint64(child.ByteSize())
+	err := meterBefore(storage, MeterStepSplit, splitSize)
+	if err != nil {
+		return err
+	}
+
 	leftSlab, rightSlab, err := child.Split(storage)
 	if err != nil {
 		return err
 	}
 
+	meterAfter(storage, MeterStepSplit, splitSize)
+
+	notifySlabSplit(storage, originalID, leftSlab.ID(), rightSlab.ID())
+
 	left := leftSlab.(ArraySlab)
 	right := rightSlab.(ArraySlab)
 
@@ -1423,11 +1693,21 @@ func (a *ArrayMetaDataSlab) MergeOrRebalanceChildSlab(
 	if leftSib == nil {
 
 		// Merge with right
-		err := child.Merge(rightSib)
+		mergeSize := uint64(child.ByteSize()) + uint64(rightSib.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
 		if err != nil {
 			return err
 		}
 
+		err = child.Merge(rightSib)
+		if err != nil {
+			return err
+		}
+
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, child.ID(), rightSib.ID())
+
 		a.childrenHeaders[childHeaderIndex] = child.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -1457,11 +1737,21 @@ func (a *ArrayMetaDataSlab) MergeOrRebalanceChildSlab(
 	if rightSib == nil {
 
 		// Merge with left
-		err := leftSib.Merge(child)
+		mergeSize := uint64(leftSib.ByteSize()) + uint64(child.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
 		if err != nil {
 			return err
 		}
 
+		err = leftSib.Merge(child)
+		if err != nil {
+			return err
+		}
+
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, leftSib.ID(), child.ID())
+
 		a.childrenHeaders[childHeaderIndex-1] = leftSib.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -1490,11 +1780,21 @@ func (a *ArrayMetaDataSlab) MergeOrRebalanceChildSlab(
 
 	// Merge with smaller sib
 	if leftSib.ByteSize() < rightSib.ByteSize() {
-		err := leftSib.Merge(child)
+		mergeSize := uint64(leftSib.ByteSize()) + uint64(child.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
 		if err != nil {
 			return err
 		}
 
+		err = leftSib.Merge(child)
+		if err != nil {
+			return err
+		}
+
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, leftSib.ID(), child.ID())
+
 		a.childrenHeaders[childHeaderIndex-1] = leftSib.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -1523,11 +1823,21 @@ func (a *ArrayMetaDataSlab) MergeOrRebalanceChildSlab(
 	} else {
 		// leftSib.ByteSize > rightSib.ByteSize
 
-		err := child.Merge(rightSib)
+		mergeSize := uint64(child.ByteSize()) + uint64(rightSib.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
+		if err != nil {
+			return err
+		}
+
+		err = child.Merge(rightSib)
 		if err != nil {
 			return err
 		}
 
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, child.ID(), rightSib.ID())
+
 		a.childrenHeaders[childHeaderIndex] = child.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -1807,7 +2117,12 @@ func (a *ArrayMetaDataSlab) String() string {
 
 func NewArray(storage SlabStorage, address Address, typeInfo TypeInfo) (*Array, error) {
 
-	extraData := &ArrayExtraData{TypeInfo: typeInfo}
+	provenance, err := newProvenance(storage, address)
+	if err != nil {
+		return nil, err
+	}
+
+	extraData := &ArrayExtraData{TypeInfo: typeInfo, Provenance: provenance}
 
 	sID, err := storage.GenerateStorageID(address)
 	if err != nil {
@@ -1845,7 +2160,7 @@ func NewArrayWithRootID(storage SlabStorage, rootID StorageID) (*Array, error) {
 
 	extraData := root.ExtraData()
 	if extraData == nil {
-		return nil, NewNotValueError(rootID)
+		return nil, NewUserError(NewNotValueError(rootID))
 	}
 
 	return &Array{
@@ -1855,31 +2170,94 @@ func NewArrayWithRootID(storage SlabStorage, rootID StorageID) (*Array, error) {
 }
 
 func (a *Array) Get(i uint64) (Storable, error) {
-	return a.root.Get(a.Storage, i)
+	atomic.AddUint64(&a.stats.Gets, 1)
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationGet)
+
+	storable, err := a.root.Get(storage, i)
+	if err != nil {
+		err = withIndexOutOfBoundsContext(err, a.StorageID(), i, a.Count())
+		return nil, wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	return storable, nil
+}
+
+// SetElementValidator sets validator of elements passed to Set, Insert, and Append.
+// Validator isn't persisted, it only applies to this Array instance.
+// If validator is nil, elements aren't validated.
+func (a *Array) SetElementValidator(validator ElementValidator) {
+	a.elementValidator = validator
+}
+
+func (a *Array) validateElement(value Value) error {
+	if _, ok := value.(storableValue); ok {
+		// Element is validated before its storable is created.
+		return nil
+	}
+	err := checkNestingDepth(a.Storage, a.StorageID(), value)
+	if err != nil {
+		return err
+	}
+	if a.elementValidator == nil {
+		return nil
+	}
+	err = a.elementValidator(a.Type(), value)
+	if err != nil {
+		logInvalidElement(a.getLogger(), a.StorageID(), err)
+		return NewInvalidElementError(err)
+	}
+	return nil
 }
 
 func (a *Array) Set(index uint64, value Value) (Storable, error) {
-	existingStorable, err := a.root.Set(a.Storage, a.Address(), index, value)
+	err := a.validateElement(value)
 	if err != nil {
 		return nil, err
 	}
 
-	if a.root.IsFull() {
-		err = a.splitRoot()
-		if err != nil {
-			return nil, err
-		}
-		return existingStorable, nil
+	value, change, err := a.checkLimits(index, false, value)
+	if err != nil {
+		return nil, err
 	}
 
-	if !a.root.IsData() {
-		root := a.root.(*ArrayMetaDataSlab)
-		if len(root.childrenHeaders) == 1 {
-			err = a.promoteChildAsNewRoot(root.childrenHeaders[0].id)
-			if err != nil {
-				return nil, err
-			}
-		}
+	atomic.AddUint64(&a.stats.Sets, 1)
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationSet)
+
+	existingStorable, err := a.root.Set(storage, a.Address(), index, value)
+	if err != nil {
+		err = withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
+		return nil, wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	storeRoot := a.incrementMutationSequence()
+	storeRoot = a.trackByteSize(change) || storeRoot
+
+	err = a.rebalanceRoot(storage, storeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nesting is linked after root is rebalanced, since it stores roots
+	// of nested collection and ancestors.
+	err = unlinkNestedStorable(storage, a.StorageID(), existingStorable)
+	if err != nil {
+		return nil, err
+	}
+
+	err = linkNestedValue(storage, a.StorageID(), value)
+	if err != nil {
+		return nil, err
+	}
+
+	notifyElementSet(a.Storage, a.StorageID())
+
+	err = a.emitChange(ChangeSet, index, existingStorable)
+	if err != nil {
+		return nil, err
 	}
 
 	return existingStorable, nil
@@ -1890,40 +2268,119 @@ func (a *Array) Append(value Value) error {
 }
 
 func (a *Array) Insert(index uint64, value Value) error {
-	err := a.root.Insert(a.Storage, a.Address(), index, value)
+	err := a.validateElement(value)
 	if err != nil {
 		return err
 	}
 
-	if a.root.IsFull() {
-		return a.splitRoot()
+	value, change, err := a.checkLimits(index, true, value)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	atomic.AddUint64(&a.stats.Inserts, 1)
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationInsert)
+
+	err = a.root.Insert(storage, a.Address(), index, value)
+	if err != nil {
+		err = withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
+		return wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	storeRoot := a.incrementMutationSequence()
+	storeRoot = a.trackByteSize(change) || storeRoot
+
+	err = a.rebalanceRoot(storage, storeRoot)
+	if err != nil {
+		return err
+	}
+
+	// Nesting is linked after root is rebalanced, since it stores roots
+	// of nested collection and ancestors.
+	err = linkNestedValue(storage, a.StorageID(), value)
+	if err != nil {
+		return err
+	}
+
+	notifyElementInserted(a.Storage, a.StorageID())
+
+	return a.emitChange(ChangeInsert, index, nil)
 }
 
 func (a *Array) Remove(index uint64) (Storable, error) {
-	storable, err := a.root.Remove(a.Storage, index)
+	atomic.AddUint64(&a.stats.Removes, 1)
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationRemove)
+
+	change, err := a.removedByteSize(index, index+1)
+	if err != nil {
+		return nil, err
+	}
+
+	storable, err := a.root.Remove(storage, index)
+	if err != nil {
+		err = withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
+		return nil, wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	storeRoot := a.incrementMutationSequence()
+	storeRoot = a.trackByteSize(change) || storeRoot
+
+	err = a.rebalanceRoot(storage, storeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nesting is unlinked after root is rebalanced, since it stores root
+	// of nested collection.
+	err = unlinkNestedStorable(storage, a.StorageID(), storable)
 	if err != nil {
 		return nil, err
 	}
 
+	notifyElementRemoved(a.Storage, a.StorageID())
+
+	err = a.emitChange(ChangeRemove, index, storable)
+	if err != nil {
+		return nil, err
+	}
+
+	return storable, nil
+}
+
+// rebalanceRoot splits root if it is full, or sets root to its child
+// slab if root has one child slab.  Otherwise root is stored if
+// storeRoot is true, so root extra data updated by mutation is stored
+// in the same step as root is rebalanced.
+func (a *Array) rebalanceRoot(storage SlabStorage, storeRoot bool) error {
+	if a.root.IsFull() {
+		return a.splitRoot()
+	}
+
 	if !a.root.IsData() {
-		// Set root to its child slab if root has one child slab.
 		root := a.root.(*ArrayMetaDataSlab)
 		if len(root.childrenHeaders) == 1 {
-			err = a.promoteChildAsNewRoot(root.childrenHeaders[0].id)
-			if err != nil {
-				return nil, err
-			}
+			return a.promoteChildAsNewRoot(root.childrenHeaders[0].id)
 		}
 	}
 
-	return storable, nil
+	if storeRoot {
+		return storage.Store(a.root.ID(), a.root)
+	}
+	return nil
 }
 
 func (a *Array) splitRoot() error {
 
+	splitSize := uint64(a.root.ByteSize())
+	err := meterBefore(a.Storage, MeterStepSplit, splitSize)
+	if err != nil {
+		return err
+	}
+
 	if a.root.IsData() {
 		// Adjust root data slab size before splitting
 		dataSlab := a.root.(*ArrayDataSlab)
@@ -1937,7 +2394,7 @@ func (a *Array) splitRoot() error {
 	rootID := a.root.ID()
 
 	// Assign a new storage id to old root before splitting it.
-	sID, err := a.Storage.GenerateStorageID(a.Address())
+	sID, err := a.trackedStorage().GenerateStorageID(a.Address())
 	if err != nil {
 		return err
 	}
@@ -1946,11 +2403,15 @@ func (a *Array) splitRoot() error {
 	oldRoot.SetID(sID)
 
 	// Split old root
-	leftSlab, rightSlab, err := oldRoot.Split(a.Storage)
+	leftSlab, rightSlab, err := oldRoot.Split(a.trackedStorage())
 	if err != nil {
 		return err
 	}
 
+	meterAfter(a.Storage, MeterStepSplit, splitSize)
+
+	notifySlabSplit(a.Storage, rootID, leftSlab.ID(), rightSlab.ID())
+
 	left := leftSlab.(ArraySlab)
 	right := rightSlab.(ArraySlab)
 
@@ -1968,15 +2429,15 @@ func (a *Array) splitRoot() error {
 
 	a.root = newRoot
 
-	err = a.Storage.Store(left.ID(), left)
+	err = a.trackedStorage().Store(left.ID(), left)
 	if err != nil {
 		return err
 	}
-	err = a.Storage.Store(right.ID(), right)
+	err = a.trackedStorage().Store(right.ID(), right)
 	if err != nil {
 		return err
 	}
-	err = a.Storage.Store(a.root.ID(), a.root)
+	err = a.trackedStorage().Store(a.root.ID(), a.root)
 	if err != nil {
 		return err
 	}
@@ -1986,7 +2447,7 @@ func (a *Array) splitRoot() error {
 
 func (a *Array) promoteChildAsNewRoot(childID StorageID) error {
 
-	child, err := getArraySlab(a.Storage, childID)
+	child, err := getArraySlab(a.trackedStorage(), childID)
 	if err != nil {
 		return err
 	}
@@ -2007,11 +2468,11 @@ func (a *Array) promoteChildAsNewRoot(childID StorageID) error {
 
 	a.root.SetExtraData(extraData)
 
-	err = a.Storage.Store(rootID, a.root)
+	err = a.trackedStorage().Store(rootID, a.root)
 	if err != nil {
 		return err
 	}
-	err = a.Storage.Remove(childID)
+	err = a.trackedStorage().Remove(childID)
 	if err != nil {
 		return err
 	}
@@ -2019,17 +2480,36 @@ func (a *Array) promoteChildAsNewRoot(childID StorageID) error {
 	return nil
 }
 
-var emptyArrayIterator = &ArrayIterator{}
-
 type ArrayIterator struct {
 	storage        SlabStorage
 	id             StorageID
 	dataSlab       *ArrayDataSlab
 	index          int
 	remainingCount int
+	// tracked records slabs retrieved by iterator, if not nil.
+	tracked *statsSlabStorage
+	// array, startIndex and endIndex are used by Seek and Index.
+	array      *Array
+	startIndex uint64
+	endIndex   uint64
 }
 
 func (i *ArrayIterator) Next() (Value, error) {
+	storable, err := i.NextStorable()
+	if err != nil {
+		return nil, err
+	}
+	if storable == nil {
+		return nil, nil
+	}
+	return storable.StoredValue(i.storage)
+}
+
+// NextStorable returns storable of next element without decoding it to
+// Value, or nil if there are no more elements.  Elements stored in
+// separate slabs, such as nested collections, are returned as
+// StorageIDStorable.
+func (i *ArrayIterator) NextStorable() (Storable, error) {
 	if i.remainingCount == 0 {
 		return nil, nil
 	}
@@ -2047,18 +2527,17 @@ func (i *ArrayIterator) Next() (Value, error) {
 			return nil, NewSlabNotFoundErrorf(i.id, "slab not found during array iteration")
 		}
 
+		if i.tracked != nil {
+			i.tracked.recordRetrieve(i.id)
+		}
+
 		i.dataSlab = slab.(*ArrayDataSlab)
 		i.index = 0
 	}
 
-	var element Value
-	var err error
+	var element Storable
 	if i.index < len(i.dataSlab.elements) {
-		element, err = i.dataSlab.elements[i.index].StoredValue(i.storage)
-		if err != nil {
-			return nil, err
-		}
-
+		element = i.dataSlab.elements[i.index]
 		i.index++
 	}
 
@@ -2072,37 +2551,93 @@ func (i *ArrayIterator) Next() (Value, error) {
 	return element, nil
 }
 
+// Index returns array index of element returned by next call to Next.
+// It equals end of iterated range when there are no more elements.
+func (i *ArrayIterator) Index() uint64 {
+	return i.endIndex - uint64(i.remainingCount)
+}
+
+// Seek moves iterator to element at array index, so that paused
+// iteration can be resumed at any position.  Data slab containing index
+// is found using element counts in metadata slabs, without iterating
+// preceding elements.  Index must be within iterated range, and
+// seeking to end of range ends iteration.
+func (i *ArrayIterator) Seek(index uint64) error {
+	if index < i.startIndex || index > i.endIndex {
+		return NewUserError(NewIndexOutOfBoundsError(index, i.startIndex, i.endIndex))
+	}
+
+	if index == i.endIndex {
+		i.id = StorageIDUndefined
+		i.dataSlab = nil
+		i.index = 0
+		i.remainingCount = 0
+		return nil
+	}
+
+	dataSlab, adjustedIndex, err := getArrayDataSlabWithIndex(i.array.trackedStorage(), i.array.root, index)
+	if err != nil {
+		return withIndexOutOfBoundsContext(err, i.array.StorageID(), index, i.array.Count())
+	}
+
+	i.id = dataSlab.ID()
+	i.dataSlab = dataSlab
+	i.index = int(adjustedIndex)
+	i.remainingCount = int(i.endIndex - index)
+	return nil
+}
+
 func (a *Array) Iterator() (*ArrayIterator, error) {
-	slab, err := firstArrayDataSlab(a.Storage, a.root)
+	iterator := &ArrayIterator{}
+	err := iterator.Reset(a)
 	if err != nil {
 		return nil, err
 	}
+	return iterator, nil
+}
 
-	return &ArrayIterator{
+// Reset sets iterator to iterate array a from the first element, so
+// that iterator can be reused instead of creating a new one.
+func (i *ArrayIterator) Reset(a *Array) error {
+	atomic.AddUint64(&a.stats.Iterations, 1)
+
+	slab, err := firstArrayDataSlab(a.trackedStorage(), a.root)
+	if err != nil {
+		return err
+	}
+
+	*i = ArrayIterator{
 		storage:        a.Storage,
 		id:             slab.ID(),
 		dataSlab:       slab,
 		remainingCount: int(a.Count()),
-	}, nil
+		tracked:        a.trackedStorage(),
+		array:          a,
+		endIndex:       a.Count(),
+	}
+	return nil
 }
 
 func (a *Array) RangeIterator(startIndex uint64, endIndex uint64) (*ArrayIterator, error) {
 	count := a.Count()
 
 	if startIndex > count || endIndex > count {
-		return nil, NewSliceOutOfBoundsError(startIndex, endIndex, 0, count)
+		return nil, NewUserError(NewSliceOutOfBoundsError(startIndex, endIndex, 0, count))
 	}
 
 	if startIndex > endIndex {
-		return nil, NewInvalidSliceIndexError(startIndex, endIndex)
+		return nil, NewUserError(NewInvalidSliceIndexError(startIndex, endIndex))
 	}
 
 	numberOfElements := endIndex - startIndex
 
 	if numberOfElements == 0 {
-		return emptyArrayIterator, nil
+		// Empty iterator isn't shared, since Seek modifies iterator.
+		return &ArrayIterator{array: a, startIndex: startIndex, endIndex: endIndex}, nil
 	}
 
+	atomic.AddUint64(&a.stats.Iterations, 1)
+
 	var dataSlab *ArrayDataSlab
 	index := startIndex
 
@@ -2110,7 +2645,7 @@ func (a *Array) RangeIterator(startIndex uint64, endIndex uint64) (*ArrayIterato
 		dataSlab = a.root.(*ArrayDataSlab)
 	} else if startIndex == 0 {
 		var err error
-		dataSlab, err = firstArrayDataSlab(a.Storage, a.root)
+		dataSlab, err = firstArrayDataSlab(a.trackedStorage(), a.root)
 		if err != nil {
 			return nil, err
 		}
@@ -2119,7 +2654,7 @@ func (a *Array) RangeIterator(startIndex uint64, endIndex uint64) (*ArrayIterato
 		// getArrayDataSlabWithIndex returns data slab containing element at startIndex,
 		// getArrayDataSlabWithIndex also returns adjusted index for this element at returned data slab.
 		// Adjusted index must be used as index when creating ArrayIterator.
-		dataSlab, index, err = getArrayDataSlabWithIndex(a.Storage, a.root, startIndex)
+		dataSlab, index, err = getArrayDataSlabWithIndex(a.trackedStorage(), a.root, startIndex)
 		if err != nil {
 			return nil, err
 		}
@@ -2131,6 +2666,10 @@ func (a *Array) RangeIterator(startIndex uint64, endIndex uint64) (*ArrayIterato
 		dataSlab:       dataSlab,
 		index:          int(index),
 		remainingCount: int(numberOfElements),
+		tracked:        a.trackedStorage(),
+		array:          a,
+		startIndex:     startIndex,
+		endIndex:       endIndex,
 	}, nil
 }
 
@@ -2138,10 +2677,14 @@ type ArrayIterationFunc func(element Value) (resume bool, err error)
 
 func (a *Array) Iterate(fn ArrayIterationFunc) error {
 
-	iterator, err := a.Iterator()
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationIterate)
+
+	iterator, err := pooledArrayIterator(a)
 	if err != nil {
 		return err
 	}
+	defer releaseArrayIterator(iterator)
 
 	for {
 		value, err := iterator.Next()
@@ -2161,8 +2704,59 @@ func (a *Array) Iterate(fn ArrayIterationFunc) error {
 	}
 }
 
+// ArrayStorableIterationFunc is called with storable of array element.
+type ArrayStorableIterationFunc func(element Storable) (resume bool, err error)
+
+// IterateStorables iterates array elements in order without decoding
+// them, passing storable of each element to fn.
+func (a *Array) IterateStorables(fn ArrayStorableIterationFunc) error {
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationIterate)
+
+	iterator, err := pooledArrayIterator(a)
+	if err != nil {
+		return err
+	}
+	defer releaseArrayIterator(iterator)
+
+	for {
+		storable, err := iterator.NextStorable()
+		if err != nil {
+			return err
+		}
+		if storable == nil {
+			return nil
+		}
+		resume, err := fn(storable)
+		if err != nil {
+			return err
+		}
+		if !resume {
+			return nil
+		}
+	}
+}
+
+// ArrayIndexedIterationFunc is called with index and value of array element.
+type ArrayIndexedIterationFunc func(index uint64, element Value) (resume bool, err error)
+
+// IterateWithIndex iterates array elements in order, passing index of
+// each element to fn.
+func (a *Array) IterateWithIndex(fn ArrayIndexedIterationFunc) error {
+	var index uint64
+	return a.Iterate(func(element Value) (bool, error) {
+		resume, err := fn(index, element)
+		index++
+		return resume, err
+	})
+}
+
 func (a *Array) IterateRange(startIndex uint64, endIndex uint64, fn ArrayIterationFunc) error {
 
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationIterate)
+
 	iterator, err := a.RangeIterator(startIndex, endIndex)
 	if err != nil {
 		return err
@@ -2200,14 +2794,42 @@ func (a *Array) Type() TypeInfo {
 	return nil
 }
 
+// SetType changes array type info to typeInfo by rewriting root slab extra data.
+// Array elements aren't modified.  IncompatibleTypeInfoError is returned
+// if isCompatible returns false for current and new type info.  Nil
+// isCompatible treats every type info as compatible.
+func (a *Array) SetType(typeInfo TypeInfo, isCompatible TypeInfoCompatibilityChecker) error {
+	extraData := a.root.ExtraData()
+	if extraData == nil {
+		return NewUserError(NewNotValueError(a.StorageID()))
+	}
+
+	if isCompatible != nil && !isCompatible(extraData.TypeInfo, typeInfo) {
+		return NewIncompatibleTypeInfoError(extraData.TypeInfo, typeInfo)
+	}
+
+	extraData.TypeInfo = typeInfo
+
+	return a.Storage.Store(a.root.ID(), a.root)
+}
+
+// String returns elements of array, truncated to DefaultStringMaxElements
+// elements and DefaultStringMaxBytes bytes.
 func (a *Array) String() string {
+	return a.StringWithOptions(DefaultStringMaxElements, DefaultStringMaxBytes)
+}
+
+// StringWithOptions returns elements of array, truncated to maxElements
+// elements and maxBytes bytes of elements.  0 maximum means no limit.
+// Omitted elements are noted at the end.
+func (a *Array) StringWithOptions(maxElements int, maxBytes int) string {
 	iterator, err := a.Iterator()
 	if err != nil {
 		return err.Error()
 	}
 
-	var elemsStr []string
-	for {
+	b := newElementsStringBuilder(maxElements, maxBytes)
+	for !b.full() {
 		v, err := iterator.Next()
 		if err != nil {
 			return err.Error()
@@ -2215,10 +2837,12 @@ func (a *Array) String() string {
 		if v == nil {
 			break
 		}
-		elemsStr = append(elemsStr, fmt.Sprintf("%s", v))
+		if !b.add(fmt.Sprintf("%s", v)) {
+			break
+		}
 	}
 
-	return fmt.Sprintf("[%s]", strings.Join(elemsStr, " "))
+	return b.String(a.Count())
 }
 
 func getArraySlab(storage SlabStorage, id StorageID) (ArraySlab, error) {
@@ -2254,7 +2878,7 @@ func getArrayDataSlabWithIndex(storage SlabStorage, slab ArraySlab, index uint64
 	if slab.IsData() {
 		dataSlab := slab.(*ArrayDataSlab)
 		if index >= uint64(len(dataSlab.elements)) {
-			return nil, 0, NewIndexOutOfBoundsError(index, 0, uint64(len(dataSlab.elements)))
+			return nil, 0, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(dataSlab.elements))))
 		}
 		return dataSlab, index, nil
 	}
@@ -2284,9 +2908,23 @@ func (a *Array) PopIterate(fn ArrayPopIterationFunc) error {
 		return err
 	}
 
+	// Removed elements can't be restored, so recorded operations are discarded.
+	if a.journal != nil {
+		err = a.journal.reset(a.Storage)
+		if err != nil {
+			return err
+		}
+	}
+
 	rootID := a.root.ID()
 
 	extraData := a.root.ExtraData()
+	if extraData.MutationSequence != 0 {
+		extraData.MutationSequence++
+	}
+	if extraData.Limits != nil {
+		extraData.Limits.ByteSize = 0
+	}
 
 	// Set root to empty data slab
 	a.root = &ArrayDataSlab{
@@ -2303,10 +2941,25 @@ func (a *Array) PopIterate(fn ArrayPopIterationFunc) error {
 
 type ArrayElementProvider func() (Value, error)
 
-func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeInfo, fn ArrayElementProvider) (*Array, error) {
+// NewArrayFromBatchData returns a new array with elements provided by fn
+// callback, in order, until fn returns nil value.  Options can report
+// progress, cancel construction, and commit built slabs periodically.
+func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeInfo, fn ArrayElementProvider, options ...BatchOption) (*Array, error) {
+
+	opts := newBatchOptions(options)
+
+	userMetadata, err := newUserMetadata(opts.userMetadata)
+	if err != nil {
+		return nil, err
+	}
 
 	var slabs []ArraySlab
 
+	// Number of leading data slabs stored and committed
+	committed := 0
+
+	count := uint64(0)
+
 	id, err := storage.GenerateStorageID(address)
 	if err != nil {
 		return nil, err
@@ -2352,6 +3005,16 @@ func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeIn
 				},
 			}
 
+			commit, err := opts.dataSlabBuilt(count, uint64(len(slabs)))
+			if err != nil {
+				return nil, err
+			}
+			if commit {
+				committed, err = opts.commitArrayDataSlabs(storage, slabs, committed)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		storable, err := value.Storable(storage, address, MaxInlineArrayElementSize)
@@ -2363,11 +3026,15 @@ func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeIn
 		dataSlab.elements = append(dataSlab.elements, storable)
 		dataSlab.header.count++
 		dataSlab.header.size += storable.ByteSize()
+
+		count++
 	}
 
 	// Append last data slab to slabs
 	slabs = append(slabs, dataSlab)
 
+	opts.done(count, uint64(len(slabs)))
+
 	for len(slabs) > 1 {
 
 		lastSlab := slabs[len(slabs)-1]
@@ -2407,8 +3074,8 @@ func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeIn
 			break
 		}
 
-		// Store all slabs
-		for _, slab := range slabs {
+		// Store all slabs, except committed data slabs
+		for _, slab := range slabs[committed:] {
 			err = storage.Store(slab.ID(), slab)
 			if err != nil {
 				return nil, err
@@ -2421,6 +3088,8 @@ func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeIn
 			return nil, err
 		}
 
+		committed = 0
+
 	}
 
 	// found root slab
@@ -2431,7 +3100,16 @@ func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeIn
 		dataSlab.header.size = dataSlab.header.size - arrayDataSlabPrefixSize + arrayRootDataSlabPrefixSize
 	}
 
-	extraData := &ArrayExtraData{TypeInfo: typeInfo}
+	provenance, err := newProvenance(storage, address)
+	if err != nil {
+		return nil, err
+	}
+
+	extraData := &ArrayExtraData{
+		TypeInfo:     typeInfo,
+		Provenance:   provenance,
+		UserMetadata: userMetadata,
+	}
 
 	// Set extra data in root
 	root.SetExtraData(extraData)
@@ -2442,6 +3120,11 @@ func NewArrayFromBatchData(storage SlabStorage, address Address, typeInfo TypeIn
 		return nil, err
 	}
 
+	err = initNesting(storage, root.ID())
+	if err != nil {
+		return nil, err
+	}
+
 	return &Array{
 		Storage: storage,
 		root:    root,
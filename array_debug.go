@@ -22,6 +22,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"strings"
 
@@ -99,15 +101,28 @@ func GetArrayStats(a *Array) (ArrayStats, error) {
 
 // PrintArray prints array slab data to stdout.
 func PrintArray(a *Array) {
-	dumps, err := DumpArraySlabs(a)
+	err := FprintArray(os.Stdout, a, DefaultPrintOptions)
 	if err != nil {
 		fmt.Println(err)
-		return
 	}
-	fmt.Println(strings.Join(dumps, "\n"))
+}
+
+// FprintArray writes array slab data to w, one slab per line,
+// formatted with opts.
+func FprintArray(w io.Writer, a *Array, opts PrintOptions) error {
+	dumps, err := dumpArraySlabs(a, opts)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, strings.Join(dumps, "\n"))
+	return err
 }
 
 func DumpArraySlabs(a *Array) ([]string, error) {
+	return dumpArraySlabs(a, DefaultPrintOptions)
+}
+
+func dumpArraySlabs(a *Array, opts PrintOptions) ([]string, error) {
 	var dumps []string
 
 	nextLevelIDs := []StorageID{a.StorageID()}
@@ -130,7 +145,7 @@ func DumpArraySlabs(a *Array) ([]string, error) {
 
 			if slab.IsData() {
 				dataSlab := slab.(*ArrayDataSlab)
-				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, dataSlab))
+				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, opts.formatArraySlab(dataSlab)))
 
 				childStorables := dataSlab.ChildStorables()
 				for _, e := range childStorables {
@@ -141,7 +156,7 @@ func DumpArraySlabs(a *Array) ([]string, error) {
 
 			} else {
 				meta := slab.(*ArrayMetaDataSlab)
-				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, meta))
+				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, opts.formatArraySlab(meta)))
 
 				for _, storable := range slab.ChildStorables() {
 					id, ok := storable.(StorageIDStorable)
@@ -545,7 +560,7 @@ func arrayDataSlabEqual(
 	for i := 0; i < len(expected.elements); i++ {
 		ee := expected.elements[i]
 		ae := actual.elements[i]
-		if !compare(ee, ae) {
+		if !storableEqual(ee, ae, compare) {
 			return fmt.Errorf("element %d %+v is wrong, want %+v", i, ae, ee)
 		}
 
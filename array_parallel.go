@@ -0,0 +1,502 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// minParallelChunkSize is the smallest number of values converted and
+// packed by a worker of AppendParallel.
+const minParallelChunkSize = 1024
+
+// NewArrayFromValuesParallel returns a new array with values, building
+// data slabs with numWorkers goroutines, for initial ingestion of large
+// arrays.  See Array.AppendParallel.
+func NewArrayFromValuesParallel(storage SlabStorage, address Address, typeInfo TypeInfo, values []Value, numWorkers int) (*Array, error) {
+	array, err := NewArray(storage, address, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = array.AppendParallel(values, numWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	return array, nil
+}
+
+// AppendParallel appends values to array, building data slabs with
+// numWorkers goroutines, for bulk ingestion of large arrays.
+//
+// Values are split into contiguous chunks.  Each worker converts values
+// of its chunk to storables and packs them into data slabs as
+// NewArrayFromBatchData does.  New data slabs are appended after
+// existing data slabs, rebalanced at chunk boundaries, get storage IDs
+// in array order, and are stitched with existing data slabs under new
+// metadata slabs.  Metadata slabs are rebuilt, so cost of AppendParallel
+// grows with number of existing data slabs, and it is meant for large
+// batches rather than repeated small appends.
+//
+// Workers share storage through a mutex, so storage is only accessed by
+// values stored in separate slabs, and storage hooks and meter can be
+// called concurrently.  Storage IDs of such slabs are generated in
+// worker scheduling order, so numWorkers must be 1 when storage layout
+// must be deterministic and values can be large.
+//
+// Array with journal, change sink, or byte size limits records each
+// element, so values are appended one by one with Append instead.
+func (a *Array) AppendParallel(values []Value, numWorkers int) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	if a.journal != nil || a.changeSink != nil || a.hasByteSizeLimit() {
+		for _, value := range values {
+			err := a.Append(value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if limits := a.root.ExtraData().Limits; limits != nil && limits.MaxCount != 0 &&
+		a.Count()+uint64(len(values)) > limits.MaxCount {
+		return NewCollectionLimitError(a.StorageID(), "element count", limits.MaxCount)
+	}
+
+	for _, value := range values {
+		err := a.validateElement(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	atomic.AddUint64(&a.stats.Inserts, uint64(len(values)))
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationInsert)
+
+	newSlabs, err := packArrayDataSlabsParallel(storage, a.Address(), values, numWorkers)
+	if err != nil {
+		return err
+	}
+
+	err = a.appendDataSlabs(storage, newSlabs)
+	if err != nil {
+		return wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	extraData := a.root.ExtraData()
+	if extraData.MutationSequence != 0 {
+		extraData.MutationSequence += uint64(len(values))
+		err = storage.Store(a.root.ID(), a.root)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, value := range values {
+		err = linkNestedValue(storage, a.StorageID(), value)
+		if err != nil {
+			return err
+		}
+
+		notifyElementInserted(a.Storage, a.StorageID())
+	}
+
+	return nil
+}
+
+// hasByteSizeLimit returns true if byte size of array is tracked.
+func (a *Array) hasByteSizeLimit() bool {
+	limits := a.root.ExtraData().Limits
+	return limits != nil && limits.MaxByteSize != 0
+}
+
+// packArrayDataSlabsParallel converts values to storables and packs them
+// into data slabs without storage IDs, splitting values into chunks
+// packed by numWorkers goroutines.
+func packArrayDataSlabsParallel(storage SlabStorage, address Address, values []Value, numWorkers int) ([]*ArrayDataSlab, error) {
+
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	chunkSize := (len(values) + numWorkers - 1) / numWorkers
+	if chunkSize < minParallelChunkSize {
+		chunkSize = minParallelChunkSize
+	}
+
+	var chunks [][]Value
+	for start := 0; start < len(values); start += chunkSize {
+		end := start + chunkSize
+		if end > len(values) {
+			end = len(values)
+		}
+		chunks = append(chunks, values[start:end])
+	}
+
+	lockedStorage := &lockedSlabStorage{SlabStorage: storage}
+
+	chunkSlabs := make([][]*ArrayDataSlab, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	wg.Add(len(chunks))
+
+	for i, chunk := range chunks {
+		go func(i int, chunk []Value) {
+			defer wg.Done()
+			chunkSlabs[i], errs[i] = packArrayDataSlabs(lockedStorage, address, chunk)
+		}(i, chunk)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var dataSlabs []*ArrayDataSlab
+	for _, slabs := range chunkSlabs {
+		dataSlabs = append(dataSlabs, slabs...)
+	}
+	return dataSlabs, nil
+}
+
+// appendDataSlabs appends data slabs without storage IDs after existing
+// data slabs of array, and rebuilds metadata slabs over them.  Root slab
+// keeps its storage ID and extra data.
+func (a *Array) appendDataSlabs(storage SlabStorage, newSlabs []*ArrayDataSlab) error {
+
+	address := a.Address()
+	rootID := a.root.ID()
+
+	dataSlabs, metaIDs, err := collectArraySlabs(storage, a.root)
+	if err != nil {
+		return err
+	}
+
+	existingIDs := make(map[StorageID]struct{}, len(dataSlabs))
+	for _, slab := range dataSlabs {
+		existingIDs[slab.header.id] = struct{}{}
+	}
+
+	extraData := a.root.RemoveExtraData()
+
+	if a.root.IsData() {
+		// Root data slab becomes first data slab, and gets new storage
+		// ID unless it is root again.
+		root := a.root.(*ArrayDataSlab)
+		root.header.size = root.header.size - arrayRootDataSlabPrefixSize + arrayDataSlabPrefixSize
+		root.header.id = StorageIDUndefined
+		delete(existingIDs, rootID)
+
+		if len(root.elements) == 0 {
+			dataSlabs = dataSlabs[:0]
+		}
+	}
+
+	dataSlabs = append(dataSlabs, newSlabs...)
+
+	// Rebalance underflow slabs with their right sibling, so that only
+	// last slab can be underflow.
+	for i := 0; i < len(dataSlabs)-1; {
+		slab := dataSlabs[i]
+
+		underflowSize, underflow := slab.IsUnderflow()
+		if !underflow {
+			i++
+			continue
+		}
+
+		rightSlab := dataSlabs[i+1]
+
+		if rightSlab.CanLendToLeft(underflowSize) {
+			err := slab.BorrowFromRight(rightSlab)
+			if err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+
+		err := slab.Merge(rightSlab)
+		if err != nil {
+			return err
+		}
+		dataSlabs = append(dataSlabs[:i+1], dataSlabs[i+2:]...)
+	}
+
+	// Rebalance last slab with its left sibling.
+	if len(dataSlabs) > 1 {
+		lastSlab := dataSlabs[len(dataSlabs)-1]
+		leftSib := dataSlabs[len(dataSlabs)-2]
+
+		if underflowSize, underflow := lastSlab.IsUnderflow(); underflow {
+			if leftSib.CanLendToRight(underflowSize) {
+				err := leftSib.LendToRight(lastSlab)
+				if err != nil {
+					return err
+				}
+			} else {
+				err := leftSib.Merge(lastSlab)
+				if err != nil {
+					return err
+				}
+				dataSlabs = dataSlabs[:len(dataSlabs)-1]
+			}
+		}
+	}
+
+	// Assign storage IDs in array order and link data slabs.
+	if len(dataSlabs) == 1 {
+		dataSlabs[0].header.id = rootID
+	} else {
+		for _, slab := range dataSlabs {
+			if slab.header.id != StorageIDUndefined {
+				continue
+			}
+			id, err := storage.GenerateStorageID(address)
+			if err != nil {
+				return err
+			}
+			slab.header.id = id
+		}
+	}
+
+	slabs := make([]ArraySlab, len(dataSlabs))
+	for i, slab := range dataSlabs {
+		slab.next = StorageIDUndefined
+		if i < len(dataSlabs)-1 {
+			slab.next = dataSlabs[i+1].header.id
+		}
+		delete(existingIDs, slab.header.id)
+		slabs[i] = slab
+	}
+
+	// Data slabs merged into their siblings and old metadata slabs are
+	// removed.  Root metadata slab ID is reused by new root.
+	for id := range existingIDs {
+		err := storage.Remove(id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range metaIDs {
+		if id == rootID {
+			continue
+		}
+		err := storage.Remove(id)
+		if err != nil {
+			return err
+		}
+	}
+
+	for len(slabs) > 1 {
+
+		// Rebalance last slab with its left sibling if needed
+		lastSlab := slabs[len(slabs)-1]
+
+		if underflowSize, underflow := lastSlab.IsUnderflow(); underflow {
+
+			leftSib := slabs[len(slabs)-2]
+
+			if leftSib.CanLendToRight(underflowSize) {
+				err := leftSib.LendToRight(lastSlab)
+				if err != nil {
+					return err
+				}
+			} else {
+				err := leftSib.Merge(lastSlab)
+				if err != nil {
+					return err
+				}
+				slabs[len(slabs)-1] = nil
+				slabs = slabs[:len(slabs)-1]
+			}
+		}
+
+		if len(slabs) == 1 {
+			break
+		}
+
+		for _, slab := range slabs {
+			err := storage.Store(slab.ID(), slab)
+			if err != nil {
+				return err
+			}
+		}
+
+		slabs, err = nextLevelArraySlabs(storage, address, slabs)
+		if err != nil {
+			return err
+		}
+	}
+
+	root := slabs[0]
+
+	switch root := root.(type) {
+	case *ArrayDataSlab:
+		// root is data slab, adjust its size
+		root.header.size = root.header.size - arrayDataSlabPrefixSize + arrayRootDataSlabPrefixSize
+	case *ArrayMetaDataSlab:
+		// Generated storage ID of top metadata slab is discarded.
+		root.header.id = rootID
+	}
+
+	root.SetExtraData(extraData)
+
+	err = storage.Store(root.ID(), root)
+	if err != nil {
+		return err
+	}
+
+	a.root = root
+	return nil
+}
+
+// collectArraySlabs returns data slabs of array slab in array order,
+// and storage IDs of its metadata slabs.
+func collectArraySlabs(storage SlabStorage, slab ArraySlab) ([]*ArrayDataSlab, []StorageID, error) {
+	var dataSlabs []*ArrayDataSlab
+	var metaIDs []StorageID
+
+	var collect func(slab ArraySlab) error
+	collect = func(slab ArraySlab) error {
+		switch slab := slab.(type) {
+		case *ArrayDataSlab:
+			dataSlabs = append(dataSlabs, slab)
+			return nil
+
+		case *ArrayMetaDataSlab:
+			metaIDs = append(metaIDs, slab.header.id)
+			for _, h := range slab.childrenHeaders {
+				child, err := getArraySlab(storage, h.id)
+				if err != nil {
+					return err
+				}
+				err = collect(child)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+
+		default:
+			return NewUnreachableError()
+		}
+	}
+
+	err := collect(slab)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataSlabs, metaIDs, nil
+}
+
+// packArrayDataSlabs converts values to storables and packs them into
+// data slabs without storage IDs.
+func packArrayDataSlabs(storage SlabStorage, address Address, values []Value) ([]*ArrayDataSlab, error) {
+	var slabs []*ArrayDataSlab
+
+	dataSlab := &ArrayDataSlab{
+		header: ArraySlabHeader{size: arrayDataSlabPrefixSize},
+	}
+
+	for _, value := range values {
+		if dataSlab.header.size >= uint32(targetThreshold) {
+			slabs = append(slabs, dataSlab)
+			dataSlab = &ArrayDataSlab{
+				header: ArraySlabHeader{size: arrayDataSlabPrefixSize},
+			}
+		}
+
+		storable, err := value.Storable(storage, address, MaxInlineArrayElementSize)
+		if err != nil {
+			return nil, err
+		}
+
+		dataSlab.elements = append(dataSlab.elements, storable)
+		dataSlab.header.count++
+		dataSlab.header.size += storable.ByteSize()
+	}
+
+	if len(dataSlab.elements) > 0 {
+		slabs = append(slabs, dataSlab)
+	}
+
+	return slabs, nil
+}
+
+// lockedSlabStorage serializes access to SlabStorage shared by workers.
+type lockedSlabStorage struct {
+	SlabStorage
+	mu sync.Mutex
+}
+
+var _ SlabStorage = &lockedSlabStorage{}
+
+// unwrap returns wrapped storage, so optional storage interfaces are
+// looked up on it.
+func (s *lockedSlabStorage) unwrap() SlabStorage {
+	return s.SlabStorage
+}
+
+func (s *lockedSlabStorage) Store(id StorageID, slab Slab) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SlabStorage.Store(id, slab)
+}
+
+func (s *lockedSlabStorage) Retrieve(id StorageID) (Slab, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SlabStorage.Retrieve(id)
+}
+
+func (s *lockedSlabStorage) Remove(id StorageID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SlabStorage.Remove(id)
+}
+
+func (s *lockedSlabStorage) GenerateStorageID(address Address) (StorageID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SlabStorage.GenerateStorageID(address)
+}
+
+func (s *lockedSlabStorage) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SlabStorage.Count()
+}
+
+func (s *lockedSlabStorage) SlabIterator() (SlabIterator, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SlabStorage.SlabIterator()
+}
@@ -0,0 +1,222 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewArrayFromValuesParallel(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	r := newRand(t)
+
+	newValues := func(count int, large bool) []Value {
+		values := make([]Value, count)
+		for i := range values {
+			if large && r.Intn(10) == 0 {
+				values[i] = NewStringValue(randStr(r, int(MaxInlineArrayElementSize)+1))
+			} else {
+				values[i] = Uint64Value(r.Uint64())
+			}
+		}
+		return values
+	}
+
+	for _, count := range []int{0, 1, 100, 5000, 20000} {
+		for _, numWorkers := range []int{1, 3, 8} {
+			values := newValues(count, false)
+
+			storage := newTestPersistentStorage(t)
+
+			array, err := NewArrayFromValuesParallel(storage, address, typeInfo, values, numWorkers)
+			require.NoError(t, err)
+
+			verifyArray(t, storage, typeInfo, address, array, values, false)
+
+			// Slabs are as well-packed as sequential bulk load, except
+			// slabs rebalanced at chunk boundaries.
+			i := 0
+			expected, err := NewArrayFromBatchData(newTestPersistentStorage(t), address, typeInfo, func() (Value, error) {
+				if i == len(values) {
+					return nil, nil
+				}
+				i++
+				return values[i-1], nil
+			})
+			require.NoError(t, err)
+
+			stats, err := GetArrayStats(array)
+			require.NoError(t, err)
+
+			expectedStats, err := GetArrayStats(expected)
+			require.NoError(t, err)
+			require.True(t, stats.DataSlabCount >= expectedStats.DataSlabCount)
+			require.True(t, stats.DataSlabCount <= expectedStats.DataSlabCount+uint64(numWorkers))
+		}
+	}
+
+	t.Run("large values", func(t *testing.T) {
+		values := newValues(20000, true)
+
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArrayFromValuesParallel(storage, address, typeInfo, values, 4)
+		require.NoError(t, err)
+
+		verifyArray(t, storage, typeInfo, address, array, values, false)
+	})
+}
+
+func TestArrayAppendParallel(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	r := newRand(t)
+
+	newValues := func(count int) []Value {
+		values := make([]Value, count)
+		for i := range values {
+			if r.Intn(10) == 0 {
+				values[i] = NewStringValue(randStr(r, int(MaxInlineArrayElementSize)+1))
+			} else {
+				values[i] = Uint64Value(r.Uint64())
+			}
+		}
+		return values
+	}
+
+	for _, existingCount := range []int{0, 1, 10, 100, 5000} {
+		for _, count := range []int{0, 1, 100, 5000} {
+			values := newValues(existingCount)
+
+			storage := newTestPersistentStorage(t)
+
+			array, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+
+			for _, v := range values {
+				require.NoError(t, array.Append(v))
+			}
+
+			rootID := array.StorageID()
+
+			appended := newValues(count)
+			err = array.AppendParallel(appended, 3)
+			require.NoError(t, err)
+			require.Equal(t, rootID, array.StorageID())
+
+			values = append(values, appended...)
+			verifyArray(t, storage, typeInfo, address, array, values, false)
+		}
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		values := make([]Value, 2048)
+		for i := range values {
+			nested, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, nested.Append(Uint64Value(i)))
+			values[i] = nested
+		}
+
+		err = array.AppendParallel(values, 4)
+		require.NoError(t, err)
+
+		verifyArray(t, storage, typeInfo, address, array, values, true)
+	})
+
+	t.Run("journal", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		array.EnableJournal()
+
+		values := newValues(100)
+		err = array.AppendParallel(values, 4)
+		require.NoError(t, err)
+
+		// Values are appended one by one and recorded by journal.
+		count, err := array.Undo(len(values))
+		require.NoError(t, err)
+		require.Equal(t, len(values), count)
+		require.Equal(t, uint64(0), array.Count())
+	})
+
+	t.Run("storage interfaces", func(t *testing.T) {
+		var created int
+		storage := newTestPersistentStorage(t, WithHooks(Hooks{
+			OnSlabCreated: func(StorageID) { created++ },
+		}))
+
+		// Workers look up optional storage interfaces through lock.
+		locked := &lockedSlabStorage{SlabStorage: &statsSlabStorage{SlabStorage: storage}}
+		require.Equal(t, SlabStorage(storage), unwrapSlabStorage(locked))
+		require.NotNil(t, hooksOf(locked))
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = array.AppendParallel(newValues(5000), 4)
+		require.NoError(t, err)
+		require.True(t, created > 1)
+	})
+}
+
+func BenchmarkNewArrayFromValuesParallel(b *testing.B) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	r := rand.New(rand.NewSource(42))
+
+	values := make([]Value, 1_000_000)
+	for i := range values {
+		values[i] = Uint64Value(r.Uint64())
+	}
+
+	for _, numWorkers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("%d workers", numWorkers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				storage := newTestPersistentStorage(b)
+				_, err := NewArrayFromValuesParallel(storage, address, typeInfo, values, numWorkers)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "sync/atomic"
+
+// RemoveRange removes elements in [startIndex, endIndex) and returns
+// removed storables in order, so caller can remove slabs they reference.
+// Affected slabs are visited once: slabs entirely inside the range are
+// removed without shifting elements, and only slabs at range boundaries
+// are rebalanced.
+func (a *Array) RemoveRange(startIndex uint64, endIndex uint64) ([]Storable, error) {
+	count := a.Count()
+
+	if startIndex > count || endIndex > count {
+		return nil, NewUserError(NewSliceOutOfBoundsError(startIndex, endIndex, 0, count))
+	}
+
+	if startIndex > endIndex {
+		return nil, NewUserError(NewInvalidSliceIndexError(startIndex, endIndex))
+	}
+
+	if startIndex == endIndex {
+		return nil, nil
+	}
+
+	atomic.AddUint64(&a.stats.Removes, endIndex-startIndex)
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationRemove)
+
+	change, err := a.removedByteSize(startIndex, endIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	// Link data slab before range to data slab after range, because
+	// data slabs inside range are removed without merging.
+	if startIndex > 0 {
+		prev, _, err := getArrayDataSlabWithIndex(storage, a.root, startIndex-1)
+		if err != nil {
+			return nil, wrapRootSlabPathError(err, a.StorageID())
+		}
+
+		next := StorageIDUndefined
+		if endIndex < count {
+			nextSlab, _, err := getArrayDataSlabWithIndex(storage, a.root, endIndex)
+			if err != nil {
+				return nil, wrapRootSlabPathError(err, a.StorageID())
+			}
+			next = nextSlab.ID()
+		}
+
+		if prev.ID() != next && prev.next != next {
+			prev.next = next
+			err = storage.Store(prev.ID(), prev)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	removed := make([]Storable, 0, endIndex-startIndex)
+
+	err = removeArraySlabRange(storage, a.root, startIndex, endIndex, func(storable Storable) {
+		removed = append(removed, storable)
+	})
+	if err != nil {
+		return nil, wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	err = rebalanceArraySeam(storage, a.root, startIndex)
+	if err != nil {
+		return nil, wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	storeRoot := a.incrementMutationSequence()
+	storeRoot = a.trackByteSize(change) || storeRoot
+
+	if !a.root.IsData() {
+		root := a.root.(*ArrayMetaDataSlab)
+
+		if len(root.childrenHeaders) == 0 {
+			// All child slabs are removed, set root to empty data slab.
+			a.root = &ArrayDataSlab{
+				header: ArraySlabHeader{
+					id:   root.header.id,
+					size: arrayRootDataSlabPrefixSize,
+				},
+				extraData: root.RemoveExtraData(),
+			}
+
+			err = storage.Store(a.root.ID(), a.root)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for !a.root.IsData() {
+		// Set root to its child slab while root has one child slab.
+		root := a.root.(*ArrayMetaDataSlab)
+		if len(root.childrenHeaders) != 1 {
+			break
+		}
+		err = a.promoteChildAsNewRoot(root.childrenHeaders[0].id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if storeRoot {
+		err = storage.Store(a.root.ID(), a.root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, storable := range removed {
+		notifyElementRemoved(a.Storage, a.StorageID())
+
+		err = a.emitChange(ChangeRemove, startIndex, storable)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, nil
+}
+
+// removeArraySlabRange removes elements in [start, end) of slab, passing
+// them to fn in order.  Slabs are stored without rebalancing, so slabs at
+// range boundaries can underflow until rebalanceArraySeam is called.
+func removeArraySlabRange(storage SlabStorage, slab ArraySlab, start uint64, end uint64, fn ArrayPopIterationFunc) error {
+	switch slab := slab.(type) {
+	case *ArrayDataSlab:
+		return slab.removeRange(storage, start, end, fn)
+	case *ArrayMetaDataSlab:
+		return slab.removeRange(storage, start, end, fn)
+	default:
+		return NewSlabDataErrorf("slab %s isn't ArraySlab", slab.ID())
+	}
+}
+
+func (a *ArrayDataSlab) removeRange(storage SlabStorage, start uint64, end uint64, fn ArrayPopIterationFunc) error {
+	size := uint32(0)
+	for _, storable := range a.elements[start:end] {
+		size += storable.ByteSize()
+		fn(storable)
+	}
+
+	n := copy(a.elements[start:], a.elements[end:])
+
+	// NOTE: prevent memory leak
+	for i := int(start) + n; i < len(a.elements); i++ {
+		a.elements[i] = nil
+	}
+
+	a.elements = a.elements[:int(start)+n]
+
+	a.header.count -= uint32(end - start)
+	a.header.size -= size
+
+	return storage.Store(a.header.id, a)
+}
+
+func (a *ArrayMetaDataSlab) removeRange(storage SlabStorage, start uint64, end uint64, fn ArrayPopIterationFunc) error {
+	headers := make([]ArraySlabHeader, 0, len(a.childrenHeaders))
+
+	childStart := uint64(0)
+	for i, h := range a.childrenHeaders {
+		childEnd := childStart + uint64(h.count)
+
+		if childEnd <= start || childStart >= end {
+			headers = append(headers, h)
+			childStart = childEnd
+			continue
+		}
+
+		child, err := getArraySlab(storage, h.id)
+		if err != nil {
+			return wrapSlabPathError(err, a.header.id, i, h.id)
+		}
+
+		if start <= childStart && childEnd <= end {
+			err = removeArraySlabTree(storage, child, fn)
+			if err != nil {
+				return wrapSlabPathError(err, a.header.id, i, h.id)
+			}
+		} else {
+			from, to := uint64(0), uint64(h.count)
+			if start > childStart {
+				from = start - childStart
+			}
+			if end < childEnd {
+				to = end - childStart
+			}
+
+			err = removeArraySlabRange(storage, child, from, to, fn)
+			if err != nil {
+				return wrapSlabPathError(err, a.header.id, i, h.id)
+			}
+
+			headers = append(headers, child.Header())
+		}
+
+		childStart = childEnd
+	}
+
+	a.header.size -= uint32(len(a.childrenHeaders)-len(headers)) * arraySlabHeaderSize
+	a.header.count -= uint32(end - start)
+
+	a.childrenHeaders = headers
+
+	a.childrenCountSum = a.childrenCountSum[:len(headers)]
+	countSum := uint32(0)
+	for i, h := range headers {
+		countSum += h.count
+		a.childrenCountSum[i] = countSum
+	}
+
+	return storage.Store(a.header.id, a)
+}
+
+// rebalanceArraySeam merges or rebalances slabs containing elements at
+// index-1 and index, which can be left underflowing by range removal.
+// Both slabs can underflow at every level of the tree, so child slabs
+// are rebalanced before their parent, and again after their parent
+// merges or rebalances them.
+func rebalanceArraySeam(storage SlabStorage, slab ArraySlab, index uint64) error {
+	meta, ok := slab.(*ArrayMetaDataSlab)
+	if !ok || len(meta.childrenHeaders) == 0 {
+		return nil
+	}
+
+	for {
+		low, high, err := meta.seamChildIndexes(index)
+		if err != nil {
+			return err
+		}
+
+		for i := low; i <= high; i++ {
+			h := meta.childrenHeaders[i]
+
+			child, err := getArraySlab(storage, h.id)
+			if err != nil {
+				return wrapSlabPathError(err, meta.header.id, i, h.id)
+			}
+
+			childStart := uint64(meta.childrenCountSum[i] - h.count)
+
+			err = rebalanceArraySeam(storage, child, index-childStart)
+			if err != nil {
+				return wrapSlabPathError(err, meta.header.id, i, h.id)
+			}
+
+			meta.childrenHeaders[i] = child.Header()
+		}
+
+		rebalanced, err := meta.rebalanceChildSlabs(storage, low, high)
+		if err != nil {
+			return err
+		}
+		if !rebalanced {
+			break
+		}
+	}
+
+	return storage.Store(meta.header.id, meta)
+}
+
+// seamChildIndexes returns indexes of child slabs containing elements
+// at index-1 and index.
+func (a *ArrayMetaDataSlab) seamChildIndexes(index uint64) (int, int, error) {
+	count := uint64(a.header.count)
+
+	low := 0
+	if index > 0 {
+		var err error
+		low, _, _, err = a.childSlabIndexInfo(index - 1)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	high := len(a.childrenHeaders) - 1
+	if index < count {
+		var err error
+		high, _, _, err = a.childSlabIndexInfo(index)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if index == 0 {
+		low = high
+	}
+	if index == count {
+		high = low
+	}
+
+	return low, high, nil
+}
+
+// rebalanceChildSlabs merges or rebalances first underflowing child slab
+// with index in [low, high], and returns true if a child slab is merged
+// or rebalanced.
+func (a *ArrayMetaDataSlab) rebalanceChildSlabs(storage SlabStorage, low int, high int) (bool, error) {
+	if len(a.childrenHeaders) < 2 {
+		return false, nil
+	}
+
+	for i := low; i <= high; i++ {
+		id := a.childrenHeaders[i].id
+
+		child, err := getArraySlab(storage, id)
+		if err != nil {
+			return false, wrapSlabPathError(err, a.header.id, i, id)
+		}
+
+		underflowSize, isUnderflow := child.IsUnderflow()
+		if !isUnderflow {
+			continue
+		}
+
+		if i < high {
+			rightSib, err := getArraySlab(storage, a.childrenHeaders[i+1].id)
+			if err != nil {
+				return false, wrapSlabPathError(err, a.header.id, i+1, a.childrenHeaders[i+1].id)
+			}
+
+			// MergeOrRebalanceChildSlab expects siblings not to
+			// underflow, so underflowing siblings are merged here.
+			if _, ok := rightSib.IsUnderflow(); ok {
+				err = a.mergeChildSlabs(storage, child, rightSib, i)
+				if err != nil {
+					return false, wrapSlabPathError(err, a.header.id, i, id)
+				}
+				return true, nil
+			}
+		}
+
+		err = a.MergeOrRebalanceChildSlab(storage, child, i, underflowSize)
+		if err != nil {
+			return false, wrapSlabPathError(err, a.header.id, i, id)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// mergeChildSlabs merges child slab at childHeaderIndex with its right
+// sibling.  Both slabs underflow, so merged slab isn't full.
+func (a *ArrayMetaDataSlab) mergeChildSlabs(storage SlabStorage, child ArraySlab, rightSib ArraySlab, childHeaderIndex int) error {
+	mergeSize := uint64(child.ByteSize()) + uint64(rightSib.ByteSize())
+	err := meterBefore(storage, MeterStepMerge, mergeSize)
+	if err != nil {
+		return err
+	}
+
+	err = child.Merge(rightSib)
+	if err != nil {
+		return err
+	}
+
+	meterAfter(storage, MeterStepMerge, mergeSize)
+
+	notifySlabMerge(storage, child.ID(), rightSib.ID())
+
+	a.childrenHeaders[childHeaderIndex] = child.Header()
+
+	copy(a.childrenHeaders[childHeaderIndex+1:], a.childrenHeaders[childHeaderIndex+2:])
+	a.childrenHeaders = a.childrenHeaders[:len(a.childrenHeaders)-1]
+
+	copy(a.childrenCountSum[childHeaderIndex:], a.childrenCountSum[childHeaderIndex+1:])
+	a.childrenCountSum = a.childrenCountSum[:len(a.childrenCountSum)-1]
+
+	a.header.size -= arraySlabHeaderSize
+
+	err = storage.Store(child.ID(), child)
+	if err != nil {
+		return err
+	}
+	err = storage.Store(a.header.id, a)
+	if err != nil {
+		return err
+	}
+
+	return storage.Remove(rightSib.ID())
+}
+
+// removeArraySlabTree passes all elements of slab to fn in order and
+// removes slab with its child slabs.
+func removeArraySlabTree(storage SlabStorage, slab ArraySlab, fn ArrayPopIterationFunc) error {
+	switch slab := slab.(type) {
+	case *ArrayDataSlab:
+		for _, storable := range slab.elements {
+			fn(storable)
+		}
+
+	case *ArrayMetaDataSlab:
+		for i, h := range slab.childrenHeaders {
+			child, err := getArraySlab(storage, h.id)
+			if err != nil {
+				return wrapSlabPathError(err, slab.header.id, i, h.id)
+			}
+
+			err = removeArraySlabTree(storage, child, fn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return storage.Remove(slab.ID())
+}
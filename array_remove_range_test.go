@@ -0,0 +1,147 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayRemoveRange(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	newArray := func(t *testing.T, storage *PersistentSlabStorage, size uint64) (*Array, []Value) {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		values := make([]Value, size)
+		for i := uint64(0); i < size; i++ {
+			values[i] = Uint64Value(i)
+			err = array.Append(values[i])
+			require.NoError(t, err)
+		}
+		return array, values
+	}
+
+	const arraySize = 4096
+
+	testCases := []struct {
+		name       string
+		start, end uint64
+	}{
+		{"empty range", 10, 10},
+		{"one element", 100, 101},
+		{"inside data slab", 5, 9},
+		{"prefix", 0, 1000},
+		{"suffix", 3000, arraySize},
+		{"middle", 1000, 3000},
+		{"all but first and last", 1, arraySize - 1},
+		{"all", 0, arraySize},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := newTestPersistentStorage(t)
+
+			array, values := newArray(t, storage, arraySize)
+
+			removed, err := array.RemoveRange(tc.start, tc.end)
+			require.NoError(t, err)
+			require.Equal(t, int(tc.end-tc.start), len(removed))
+
+			for i, storable := range removed {
+				require.Equal(t, values[tc.start+uint64(i)], storable)
+			}
+
+			values = append(values[:tc.start], values[tc.end:]...)
+			verifyArray(t, storage, typeInfo, address, array, values, false)
+
+			// Array is still usable after removal.
+			for i := uint64(0); i < 100; i++ {
+				err = array.Append(Uint64Value(i))
+				require.NoError(t, err)
+				values = append(values, Uint64Value(i))
+			}
+			verifyArray(t, storage, typeInfo, address, array, values, false)
+		})
+	}
+
+	t.Run("random", func(t *testing.T) {
+		r := newRand(t)
+
+		storage := newTestPersistentStorage(t)
+
+		array, values := newArray(t, storage, arraySize)
+
+		for len(values) > 0 {
+			start := uint64(r.Intn(len(values)))
+			end := start + uint64(r.Intn(len(values)-int(start)+1))
+
+			removed, err := array.RemoveRange(start, end)
+			require.NoError(t, err)
+			require.Equal(t, values[start:end], storablesToValues(removed))
+
+			values = append(values[:start], values[end:]...)
+			verifyArray(t, storage, typeInfo, address, array, values, false)
+
+			if end == start {
+				removed, err = array.RemoveRange(0, uint64(len(values)))
+				require.NoError(t, err)
+				require.Equal(t, len(values), len(removed))
+				values = values[:0]
+			}
+		}
+
+		verifyArray(t, storage, typeInfo, address, array, nil, false)
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, values := newArray(t, storage, 10)
+
+		_, err := array.RemoveRange(5, 11)
+		require.Error(t, err)
+
+		var sliceOutOfBoundsError *SliceOutOfBoundsError
+		require.ErrorAs(t, err, &sliceOutOfBoundsError)
+
+		_, err = array.RemoveRange(6, 5)
+		require.Error(t, err)
+
+		var invalidSliceIndexError *InvalidSliceIndexError
+		require.ErrorAs(t, err, &invalidSliceIndexError)
+
+		verifyArray(t, storage, typeInfo, address, array, values, false)
+	})
+}
+
+func storablesToValues(storables []Storable) []Value {
+	values := make([]Value, len(storables))
+	for i, storable := range storables {
+		values[i] = storable.(Value)
+	}
+	return values
+}
@@ -0,0 +1,101 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// snapshotStorage is implemented by storage that can take snapshots.
+type snapshotStorage interface {
+	Snapshot() (*StorageSnapshot, error)
+}
+
+// ArraySnapshotIterator iterates array as of the time the iterator was
+// created.  It reads array from a StorageSnapshot, so Append, Set, Remove,
+// and Commit of the array after the iterator is created don't affect
+// iteration.  Values returned by Next are read from the snapshot, so
+// nested collections are read-only.
+//
+// Release must be called when the iterator is no longer needed.
+type ArraySnapshotIterator struct {
+	snapshot *StorageSnapshot
+	iterator *ArrayIterator
+	count    uint64
+}
+
+// SnapshotIterator returns iterator over array as of now.  Array storage
+// must support snapshots, such as PersistentSlabStorage.
+func (a *Array) SnapshotIterator() (*ArraySnapshotIterator, error) {
+	storage, ok := unwrapSlabStorage(a.Storage).(snapshotStorage)
+	if !ok {
+		return nil, NewSnapshotNotSupportedError(a.Storage)
+	}
+
+	snapshot, err := storage.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	array, err := NewArrayWithRootID(snapshot, a.StorageID())
+	if err != nil {
+		snapshot.Release()
+		return nil, err
+	}
+
+	iterator, err := array.Iterator()
+	if err != nil {
+		snapshot.Release()
+		return nil, err
+	}
+
+	return &ArraySnapshotIterator{
+		snapshot: snapshot,
+		iterator: iterator,
+		count:    array.Count(),
+	}, nil
+}
+
+// Next returns next element, or nil if there are no more elements.
+func (i *ArraySnapshotIterator) Next() (Value, error) {
+	if i.snapshot.isReleased() {
+		return nil, NewSnapshotReleasedError(i.snapshot.version)
+	}
+	return i.iterator.Next()
+}
+
+// NextStorable returns storable of next element, or nil if there are
+// no more elements.
+func (i *ArraySnapshotIterator) NextStorable() (Storable, error) {
+	if i.snapshot.isReleased() {
+		return nil, NewSnapshotReleasedError(i.snapshot.version)
+	}
+	return i.iterator.NextStorable()
+}
+
+// Count returns number of array elements as of snapshot.
+func (i *ArraySnapshotIterator) Count() uint64 {
+	return i.count
+}
+
+// Version returns version of snapshot pinned by the iterator.
+func (i *ArraySnapshotIterator) Version() uint64 {
+	return i.snapshot.Version()
+}
+
+// Release releases snapshot pinned by the iterator.
+func (i *ArraySnapshotIterator) Release() {
+	i.snapshot.Release()
+}
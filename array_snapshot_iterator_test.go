@@ -0,0 +1,103 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArraySnapshotIterator(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("append while iterating", func(t *testing.T) {
+		const arraySize = 1024
+
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < arraySize; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+		}
+
+		// Commit some of the elements so snapshot has both clean and dirty slabs.
+		require.NoError(t, storage.Commit())
+
+		for i := uint64(0); i < arraySize; i += 2 {
+			_, err := array.Set(i, Uint64Value(i*10))
+			require.NoError(t, err)
+		}
+
+		iterator, err := array.SnapshotIterator()
+		require.NoError(t, err)
+		defer iterator.Release()
+
+		require.Equal(t, uint64(arraySize), iterator.Count())
+
+		i := uint64(0)
+		for {
+			// Array keeps receiving appends and commits during iteration.
+			require.NoError(t, array.Append(Uint64Value(arraySize+i)))
+			if i%100 == 0 {
+				require.NoError(t, storage.Commit())
+			}
+
+			v, err := iterator.Next()
+			require.NoError(t, err)
+			if v == nil {
+				break
+			}
+
+			want := Uint64Value(i)
+			if i%2 == 0 {
+				want = Uint64Value(i * 10)
+			}
+			require.Equal(t, want, v)
+			i++
+		}
+		require.Equal(t, uint64(arraySize), i)
+		require.Equal(t, uint64(arraySize*2+1), array.Count())
+
+		iterator.Release()
+
+		_, err = iterator.Next()
+		var releasedError *SnapshotReleasedError
+		require.ErrorAs(t, err, &releasedError)
+	})
+
+	t.Run("unsupported storage", func(t *testing.T) {
+		storage := newTestBasicStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		_, err = array.SnapshotIterator()
+		var notSupportedError *SnapshotNotSupportedError
+		require.ErrorAs(t, err, &notSupportedError)
+		require.True(t, IsUserError(err))
+	})
+}
@@ -663,6 +663,61 @@ func TestArrayIterate(t *testing.T) {
 		require.Equal(t, uint64(arraySize), i)
 	})
 
+	t.Run("storables", func(t *testing.T) {
+		typeInfo := testTypeInfo{42}
+		storage := newTestPersistentStorage(t)
+		address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		nested, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = array.Append(Uint64Value(1))
+		require.NoError(t, err)
+
+		err = array.Append(nested)
+		require.NoError(t, err)
+
+		var storables []Storable
+		err = array.IterateStorables(func(s Storable) (bool, error) {
+			storables = append(storables, s)
+			return true, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Storable{Uint64Value(1), StorageIDStorable(nested.StorageID())}, storables)
+	})
+
+	t.Run("with index", func(t *testing.T) {
+		SetThreshold(256)
+		defer SetThreshold(1024)
+
+		const arraySize = 4096
+
+		typeInfo := testTypeInfo{42}
+		storage := newTestPersistentStorage(t)
+		address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < arraySize; i++ {
+			err := array.Append(Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		count := uint64(0)
+		err = array.IterateWithIndex(func(i uint64, v Value) (bool, error) {
+			require.Equal(t, count, i)
+			require.Equal(t, Uint64Value(i), v)
+			count++
+			return i < arraySize/2, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(arraySize/2+1), count)
+	})
+
 	t.Run("set", func(t *testing.T) {
 		SetThreshold(256)
 		defer SetThreshold(1024)
@@ -989,6 +1044,127 @@ func TestArrayIterateRange(t *testing.T) {
 		require.Equal(t, count/2, i)
 	})
 }
+func TestArrayIteratorSeek(t *testing.T) {
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	const arraySize = 1024
+
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	t.Run("iterator", func(t *testing.T) {
+		iterator, err := array.Iterator()
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), iterator.Index())
+
+		// Read first page and resume from index of next element.
+		for i := uint64(0); i < 100; i++ {
+			v, err := iterator.Next()
+			require.NoError(t, err)
+			require.Equal(t, Uint64Value(i), v)
+		}
+		require.Equal(t, uint64(100), iterator.Index())
+
+		for _, index := range []uint64{500, 3, arraySize - 1, 0} {
+			err = iterator.Seek(index)
+			require.NoError(t, err)
+			require.Equal(t, index, iterator.Index())
+
+			i := index
+			for {
+				v, err := iterator.Next()
+				require.NoError(t, err)
+				if v == nil {
+					break
+				}
+				require.Equal(t, Uint64Value(i), v)
+				i++
+			}
+			require.Equal(t, uint64(arraySize), i)
+			require.Equal(t, uint64(arraySize), iterator.Index())
+		}
+
+		err = iterator.Seek(arraySize)
+		require.NoError(t, err)
+
+		v, err := iterator.Next()
+		require.NoError(t, err)
+		require.Nil(t, v)
+
+		err = iterator.Seek(arraySize + 1)
+		require.Error(t, err)
+
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+	})
+
+	t.Run("range iterator", func(t *testing.T) {
+		iterator, err := array.RangeIterator(100, 200)
+		require.NoError(t, err)
+		require.Equal(t, uint64(100), iterator.Index())
+
+		err = iterator.Seek(150)
+		require.NoError(t, err)
+
+		i := uint64(150)
+		for {
+			v, err := iterator.Next()
+			require.NoError(t, err)
+			if v == nil {
+				break
+			}
+			require.Equal(t, Uint64Value(i), v)
+			i++
+		}
+		require.Equal(t, uint64(200), i)
+
+		err = iterator.Seek(201)
+		require.Error(t, err)
+
+		// Index before start of range is rejected.
+		err = iterator.Seek(99)
+		require.Error(t, err)
+
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+		require.True(t, IsUserError(err))
+
+		err = iterator.Seek(100)
+		require.NoError(t, err)
+
+		v, err := iterator.Next()
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(100), v)
+	})
+
+	t.Run("empty range iterator", func(t *testing.T) {
+		iterator, err := array.RangeIterator(10, 10)
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), iterator.Index())
+
+		err = iterator.Seek(10)
+		require.NoError(t, err)
+
+		v, err := iterator.Next()
+		require.NoError(t, err)
+		require.Nil(t, v)
+
+		err = iterator.Seek(9)
+		require.Error(t, err)
+	})
+}
+
 func TestArrayRootStorageID(t *testing.T) {
 	SetThreshold(256)
 	defer SetThreshold(1024)
@@ -2433,6 +2609,30 @@ func TestArrayString(t *testing.T) {
 		want := `[0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25 26 27 28 29 30 31 32 33 34 35 36 37 38 39 40 41 42 43 44 45 46 47 48 49 50 51 52 53 54 55 56 57 58 59 60 61 62 63 64 65 66 67 68 69 70 71 72 73 74 75 76 77 78 79 80 81 82 83 84 85 86 87 88 89 90 91 92 93 94 95 96 97 98 99 100 101 102 103 104 105 106 107 108 109 110 111 112 113 114 115 116 117 118 119]`
 		require.Equal(t, want, array.String())
 	})
+
+	t.Run("truncated", func(t *testing.T) {
+		const arraySize = 120
+
+		typeInfo := testTypeInfo{42}
+		storage := newTestPersistentStorage(t)
+		address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < arraySize; i++ {
+			err := array.Append(Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, `[0 1 2 ...(117 more)]`, array.StringWithOptions(3, 0))
+		require.Equal(t, `[0 1 2 3 4 ...(115 more)]`, array.StringWithOptions(0, 10))
+		require.Equal(t, `[0 ...(119 more)]`, array.StringWithOptions(0, 2))
+
+		s := array.StringWithOptions(0, 0)
+		require.Equal(t, s, array.String())
+		require.True(t, strings.HasSuffix(s, " 119]"))
+	})
 }
 
 func TestArraySlabDump(t *testing.T) {
@@ -2510,3 +2710,108 @@ func TestArraySlabDump(t *testing.T) {
 		require.Equal(t, want, dumps)
 	})
 }
+
+func TestArraySetType(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	newTypeInfo := testTypeInfo{43}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		v := Uint64Value(i)
+		values[i] = v
+		err := array.Append(v)
+		require.NoError(t, err)
+	}
+
+	require.False(t, array.root.IsData())
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	incompatible := func(_ TypeInfo, _ TypeInfo) bool { return false }
+	compatible := func(_ TypeInfo, _ TypeInfo) bool { return true }
+
+	err = array.SetType(newTypeInfo, incompatible)
+	var incompatibleError *IncompatibleTypeInfoError
+	require.ErrorAs(t, err, &incompatibleError)
+	require.Equal(t, typeInfo, array.Type())
+
+	// Nil checker treats type infos as compatible.
+	err = array.SetType(typeInfo, nil)
+	require.NoError(t, err)
+	require.Equal(t, typeInfo, array.Type())
+
+	err = array.SetType(newTypeInfo, compatible)
+	require.NoError(t, err)
+	require.Equal(t, newTypeInfo, array.Type())
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	array2, err := NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+
+	verifyArray(t, storage2, newTypeInfo, address, array2, values, false)
+}
+
+func TestArrayElementValidator(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	errNotUint64 := errors.New("element isn't Uint64Value")
+
+	array.SetElementValidator(func(ti TypeInfo, v Value) error {
+		require.Equal(t, typeInfo, ti)
+		if _, ok := v.(Uint64Value); !ok {
+			return errNotUint64
+		}
+		return nil
+	})
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	err = array.Insert(0, Uint64Value(1))
+	require.NoError(t, err)
+
+	_, err = array.Set(0, Uint64Value(2))
+	require.NoError(t, err)
+
+	var invalidElementError *InvalidElementError
+
+	err = array.Append(NewStringValue("a"))
+	require.ErrorAs(t, err, &invalidElementError)
+	require.ErrorIs(t, err, errNotUint64)
+
+	err = array.Insert(0, NewStringValue("a"))
+	require.ErrorAs(t, err, &invalidElementError)
+
+	_, err = array.Set(0, NewStringValue("a"))
+	require.ErrorAs(t, err, &invalidElementError)
+
+	verifyArray(t, storage, typeInfo, address, array, []Value{Uint64Value(2), Uint64Value(0)}, false)
+
+	// Remove validator
+	array.SetElementValidator(nil)
+
+	err = array.Append(NewStringValue("a"))
+	require.NoError(t, err)
+}
@@ -0,0 +1,387 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+)
+
+// Backup stream starts with magic, backup epoch, and versions covered by
+// backup, followed by slab records and end record.  Each record is record type
+// (1 byte), storage ID (16 bytes), data length (uvarint), data, and
+// CRC-32C of all previous fields of record (4 bytes).  Remove records
+// have no data.  End record has storage ID of zeros and its length
+// field is number of slab records, so truncated streams are detected.
+var backupMagic = [8]byte{'a', 't', 'r', 'e', 'e', 'b', 'k', '1'}
+
+const (
+	backupRecordEnd    byte = 0
+	backupRecordStore  byte = 1
+	backupRecordRemove byte = 2
+)
+
+var backupCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WithBackupTracking records commit version of each slab stored or
+// removed by commits, so that BackupIncremental can write slabs changed
+// since a version.  Commit versions count commits of storage since it
+// was created, and slabs committed before that aren't tracked, so full
+// backups need a copy of base storage as their starting point.
+//
+// Commit versions aren't persisted.  Each storage gets a random backup
+// epoch, and BackupIncremental rejects versions of other epochs, such as
+// versions returned before storage was recreated after a restart.
+// Tracked versions grow with slabs changed by commits until they are
+// pruned with PruneBackupVersions.
+func WithBackupTracking() StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.slabCommitVersions = make(map[StorageID]uint64)
+		st.backupEpoch = newBackupEpoch()
+		return st
+	}
+}
+
+// BackupVersion is commit version of storage in backup epoch of storage.
+// Zero BackupVersion is the state of base storage when storage was created.
+type BackupVersion struct {
+	Epoch   uint64
+	Version uint64
+}
+
+func newBackupEpoch() uint64 {
+	var b [8]byte
+	for {
+		_, err := rand.Read(b[:])
+		if err != nil {
+			// Epochs only need to differ between storage instances.
+			binary.BigEndian.PutUint64(b[:], uint64(time.Now().UnixNano()))
+		}
+		epoch := binary.BigEndian.Uint64(b[:])
+		if epoch != 0 {
+			return epoch
+		}
+	}
+}
+
+// CommitVersion returns number of commits since storage was created.
+func (s *PersistentSlabStorage) CommitVersion() uint64 {
+	return s.commitVersion
+}
+
+// BackupVersion returns current commit version in backup epoch of storage.
+func (s *PersistentSlabStorage) BackupVersion() BackupVersion {
+	return BackupVersion{Epoch: s.backupEpoch, Version: s.commitVersion}
+}
+
+// trackSlabCommitVersion records version of commit in progress for slab
+// written to base storage.  Commit version is incremented once commit
+// succeeds, so slabs written by failed commit are included in backups
+// of the next commit.
+func (s *PersistentSlabStorage) trackSlabCommitVersion(id StorageID) {
+	if s.slabCommitVersions == nil {
+		return
+	}
+	s.slabCommitVersions[id] = s.commitVersion + 1
+}
+
+// BackupIncremental writes slabs stored or removed by commits after
+// since to w, and returns version covered by backup, to be passed as
+// since of next backup.  Zero since covers all commits of storage.
+// Slab data is read from base storage, so uncommitted changes aren't
+// included.  Storage must be created with WithBackupTracking.
+//
+// Since of another backup epoch is rejected with BackupError, because
+// changes committed by other storage instances aren't tracked.
+func (s *PersistentSlabStorage) BackupIncremental(w io.Writer, since BackupVersion) (BackupVersion, error) {
+	if s.slabCommitVersions == nil {
+		return BackupVersion{}, NewUserError(NewBackupErrorf("storage isn't created with WithBackupTracking"))
+	}
+	if since != (BackupVersion{}) && since.Epoch != s.backupEpoch {
+		return BackupVersion{}, NewUserError(NewBackupErrorf(
+			"since version is in backup epoch %x, storage is in backup epoch %x",
+			since.Epoch,
+			s.backupEpoch,
+		))
+	}
+	if since.Version > s.commitVersion {
+		return BackupVersion{}, NewUserError(NewBackupErrorf("since version %d is after commit version %d", since.Version, s.commitVersion))
+	}
+	if since.Version < s.backupPrunedVersion {
+		return BackupVersion{}, NewUserError(NewBackupErrorf("since version %d is before pruned version %d", since.Version, s.backupPrunedVersion))
+	}
+
+	var ids []StorageID
+	for id, version := range s.slabCommitVersions {
+		if version > since.Version {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Compare(ids[j]) < 0
+	})
+
+	bw := bufio.NewWriter(w)
+
+	var header [backupHeaderSize]byte
+	copy(header[:], backupMagic[:])
+	binary.BigEndian.PutUint64(header[len(backupMagic):], s.backupEpoch)
+	binary.BigEndian.PutUint64(header[len(backupMagic)+8:], since.Version)
+	binary.BigEndian.PutUint64(header[len(backupMagic)+16:], s.commitVersion)
+
+	_, err := bw.Write(header[:])
+	if err != nil {
+		return BackupVersion{}, err
+	}
+
+	for _, id := range ids {
+		data, found, err := s.baseStorage.Retrieve(id)
+		if err != nil {
+			return BackupVersion{}, NewStorageError(err)
+		}
+
+		recordType := backupRecordStore
+		if !found {
+			recordType = backupRecordRemove
+			data = nil
+		}
+
+		err = writeBackupRecord(bw, recordType, id, uint64(len(data)), data)
+		if err != nil {
+			return BackupVersion{}, err
+		}
+	}
+
+	err = writeBackupRecord(bw, backupRecordEnd, StorageIDUndefined, uint64(len(ids)), nil)
+	if err != nil {
+		return BackupVersion{}, err
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return BackupVersion{}, err
+	}
+
+	return s.BackupVersion(), nil
+}
+
+// PruneBackupVersions drops tracked commit versions of slabs changed by
+// commits up to and including through, so tracking only grows with slabs
+// changed after it.  BackupIncremental rejects since versions before
+// through afterwards, so through should be version of the oldest backup
+// that later backups are taken from.
+func (s *PersistentSlabStorage) PruneBackupVersions(through BackupVersion) error {
+	if s.slabCommitVersions == nil {
+		return NewUserError(NewBackupErrorf("storage isn't created with WithBackupTracking"))
+	}
+	if through.Epoch != s.backupEpoch {
+		return NewUserError(NewBackupErrorf(
+			"through version is in backup epoch %x, storage is in backup epoch %x",
+			through.Epoch,
+			s.backupEpoch,
+		))
+	}
+	if through.Version > s.commitVersion {
+		return NewUserError(NewBackupErrorf("through version %d is after commit version %d", through.Version, s.commitVersion))
+	}
+	if through.Version <= s.backupPrunedVersion {
+		return nil
+	}
+
+	for id, version := range s.slabCommitVersions {
+		if version <= through.Version {
+			delete(s.slabCommitVersions, id)
+		}
+	}
+	s.backupPrunedVersion = through.Version
+	return nil
+}
+
+func writeBackupRecord(w io.Writer, recordType byte, id StorageID, length uint64, data []byte) error {
+	var head [1 + storageIDSize + binary.MaxVarintLen64]byte
+	head[0] = recordType
+	_, err := id.ToRawBytes(head[1:])
+	if err != nil {
+		return err
+	}
+	n := 1 + storageIDSize + binary.PutUvarint(head[1+storageIDSize:], length)
+
+	crc := crc32.Update(0, backupCRCTable, head[:n])
+	crc = crc32.Update(crc, backupCRCTable, data)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc)
+
+	for _, b := range [][]byte{head[:n], data, sum[:]} {
+		_, err = w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const backupHeaderSize = len(backupMagic) + 24
+
+// RestoreResult is result of Restore.
+type RestoreResult struct {
+	// Epoch is backup epoch of backed up storage.
+	Epoch uint64
+	// SinceVersion and Version are commit versions covered by backup.
+	SinceVersion uint64
+	Version      uint64
+	Stored       int
+	Removed      int
+}
+
+// Restore applies backup written by BackupIncremental to base storage.
+// Incremental backups must be restored in order, on top of the state
+// they were taken from.  Records are staged in memory until end record
+// is read, so corrupted or truncated backups aren't applied at all.
+// If base storage fails while records are applied, records before the
+// failed one are left applied.  Cached slabs with restored IDs are
+// dropped, while uncommitted deltas are kept.
+//
+// Restore doesn't advance storage index counters of base storage, such
+// as ledger storage index registers, which must be restored separately
+// before new slabs are created.
+func (s *PersistentSlabStorage) Restore(r io.Reader) (RestoreResult, error) {
+	br := bufio.NewReader(r)
+
+	var result RestoreResult
+
+	var header [backupHeaderSize]byte
+	_, err := io.ReadFull(br, header[:])
+	if err != nil {
+		return result, NewUserError(NewBackupErrorf("failed to read backup header: %s", err))
+	}
+	if string(header[:len(backupMagic)]) != string(backupMagic[:]) {
+		return result, NewUserError(NewBackupErrorf("stream isn't atree backup"))
+	}
+	result.Epoch = binary.BigEndian.Uint64(header[len(backupMagic):])
+	result.SinceVersion = binary.BigEndian.Uint64(header[len(backupMagic)+8:])
+	result.Version = binary.BigEndian.Uint64(header[len(backupMagic)+16:])
+
+	var records []backupRecord
+	for {
+		recordType, id, length, data, err := readBackupRecord(br)
+		if err != nil {
+			return result, err
+		}
+
+		switch recordType {
+		case backupRecordEnd:
+			if length != uint64(len(records)) {
+				return result, NewUserError(NewBackupErrorf("backup has %d records, want %d", len(records), length))
+			}
+			return result, s.applyBackupRecords(records, &result)
+
+		case backupRecordStore, backupRecordRemove:
+			records = append(records, backupRecord{recordType: recordType, id: id, data: data})
+
+		default:
+			return result, NewUserError(NewBackupErrorf("record %d has invalid type %d", len(records), recordType))
+		}
+	}
+}
+
+// backupRecord is slab record of backup staged by Restore.
+type backupRecord struct {
+	recordType byte
+	id         StorageID
+	data       []byte
+}
+
+func (s *PersistentSlabStorage) applyBackupRecords(records []backupRecord, result *RestoreResult) error {
+	for _, record := range records {
+		if record.recordType == backupRecordStore {
+			err := s.baseStorage.Store(record.id, record.data)
+			if err != nil {
+				return NewStorageError(err)
+			}
+			result.Stored++
+		} else {
+			err := s.baseStorage.Remove(record.id)
+			if err != nil {
+				return NewStorageError(err)
+			}
+			result.Removed++
+		}
+
+		delete(s.cache, record.id)
+	}
+	return nil
+}
+
+func readBackupRecord(r *bufio.Reader) (byte, StorageID, uint64, []byte, error) {
+	var head [1 + storageIDSize + binary.MaxVarintLen64]byte
+
+	_, err := io.ReadFull(r, head[:1+storageIDSize])
+	if err != nil {
+		return 0, StorageID{}, 0, nil, NewUserError(NewBackupErrorf("failed to read record: %s", err))
+	}
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, StorageID{}, 0, nil, NewUserError(NewBackupErrorf("failed to read record: %s", err))
+	}
+	n := 1 + storageIDSize + binary.PutUvarint(head[1+storageIDSize:], length)
+
+	var data []byte
+	if head[0] != backupRecordEnd {
+		if length > uint64(maxBackupRecordSize) {
+			return 0, StorageID{}, 0, nil, NewUserError(NewBackupErrorf("record size %d exceeds %d", length, maxBackupRecordSize))
+		}
+		data = make([]byte, length)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return 0, StorageID{}, 0, nil, NewUserError(NewBackupErrorf("failed to read record: %s", err))
+		}
+	}
+
+	var sum [4]byte
+	_, err = io.ReadFull(r, sum[:])
+	if err != nil {
+		return 0, StorageID{}, 0, nil, NewUserError(NewBackupErrorf("failed to read record: %s", err))
+	}
+
+	crc := crc32.Update(0, backupCRCTable, head[:n])
+	crc = crc32.Update(crc, backupCRCTable, data)
+	if crc != binary.BigEndian.Uint32(sum[:]) {
+		return 0, StorageID{}, 0, nil, NewUserError(NewBackupErrorf("record checksum mismatch"))
+	}
+
+	id, err := NewStorageIDFromRawBytes(head[1 : 1+storageIDSize])
+	if err != nil {
+		return 0, StorageID{}, 0, nil, err
+	}
+
+	return head[0], id, length, data, nil
+}
+
+// maxBackupRecordSize limits slab data size of backup records, so
+// corrupted length doesn't allocate unbounded memory before checksum
+// is verified.
+const maxBackupRecordSize = 64 << 20
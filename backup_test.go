@@ -0,0 +1,223 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupIncremental(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	newStorage := func(baseStorage BaseStorage) *PersistentSlabStorage {
+		return newTestPersistentStorageWithBaseStorage(t, baseStorage, WithBackupTracking())
+	}
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newStorage(baseStorage)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 400; i++ {
+		require.NoError(t, array.Append(Uint64Value(i)))
+	}
+
+	require.NoError(t, storage.Commit())
+	require.Equal(t, uint64(1), storage.CommitVersion())
+
+	var full bytes.Buffer
+	version, err := storage.BackupIncremental(&full, BackupVersion{})
+	require.NoError(t, err)
+	require.Equal(t, storage.BackupVersion(), version)
+	require.Equal(t, uint64(1), version.Version)
+
+	// Remove elements to remove slabs, and create another collection.
+	for array.Count() > 50 {
+		_, err = array.Remove(array.Count() - 1)
+		require.NoError(t, err)
+	}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(2))
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Commit())
+
+	var incremental bytes.Buffer
+	version, err = storage.BackupIncremental(&incremental, version)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), version.Version)
+
+	t.Run("restore", func(t *testing.T) {
+		restoredBase := NewInMemBaseStorage()
+		restored := newStorage(restoredBase)
+
+		result, err := restored.Restore(bytes.NewReader(full.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, RestoreResult{Epoch: version.Epoch, SinceVersion: 0, Version: 1, Stored: result.Stored}, result)
+		require.True(t, result.Stored > 1)
+
+		result, err = restored.Restore(bytes.NewReader(incremental.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), result.SinceVersion)
+		require.Equal(t, uint64(2), result.Version)
+		require.True(t, result.Removed > 0)
+
+		require.Equal(t, baseStorage.segments, restoredBase.segments)
+
+		restoredArray, err := NewArrayWithRootID(restored, array.StorageID())
+		require.NoError(t, err)
+
+		equal, err := EqualValues(array, restoredArray, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		data := append([]byte(nil), full.Bytes()...)
+		data[len(data)/2] ^= 0xff
+
+		_, err := newStorage(NewInMemBaseStorage()).Restore(bytes.NewReader(data))
+		var backupError *BackupError
+		require.ErrorAs(t, err, &backupError)
+
+		// Truncated stream isn't applied.
+		data = full.Bytes()[:full.Len()-10]
+		restoredBase := NewInMemBaseStorage()
+		_, err = newStorage(restoredBase).Restore(bytes.NewReader(data))
+		require.ErrorAs(t, err, &backupError)
+		require.Equal(t, 0, len(restoredBase.segments))
+
+		_, err = newStorage(NewInMemBaseStorage()).Restore(bytes.NewReader([]byte("not a backup stream")))
+		require.ErrorAs(t, err, &backupError)
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		_, err := storage.BackupIncremental(&bytes.Buffer{}, BackupVersion{Epoch: version.Epoch, Version: 3})
+		var backupError *BackupError
+		require.ErrorAs(t, err, &backupError)
+	})
+
+	t.Run("other epoch", func(t *testing.T) {
+		// Storage recreated over the same base storage starts new epoch,
+		// even after reaching the same commit version.
+		recreated := newStorage(baseStorage)
+		require.NoError(t, recreated.Commit())
+		require.NoError(t, recreated.Commit())
+		require.Equal(t, version.Version, recreated.CommitVersion())
+
+		_, err := recreated.BackupIncremental(&bytes.Buffer{}, version)
+		var backupError *BackupError
+		require.ErrorAs(t, err, &backupError)
+	})
+
+	t.Run("not tracked", func(t *testing.T) {
+		_, err := newTestPersistentStorage(t).BackupIncremental(&bytes.Buffer{}, BackupVersion{})
+		var backupError *BackupError
+		require.ErrorAs(t, err, &backupError)
+
+		err = newTestPersistentStorage(t).PruneBackupVersions(BackupVersion{})
+		require.ErrorAs(t, err, &backupError)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		baseStorage := NewInMemBaseStorage()
+		storage := newStorage(baseStorage)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		for i := uint64(0); i < 400; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+		}
+		require.NoError(t, storage.Commit())
+
+		pruned := storage.BackupVersion()
+
+		_, err = array.Set(0, Uint64Value(1))
+		require.NoError(t, err)
+		require.NoError(t, storage.Commit())
+
+		err = storage.PruneBackupVersions(pruned)
+		require.NoError(t, err)
+
+		// Only slabs changed after pruned version are tracked.
+		require.True(t, len(storage.slabCommitVersions) > 0)
+		for _, version := range storage.slabCommitVersions {
+			require.True(t, version > pruned.Version)
+		}
+
+		var backupError *BackupError
+		_, err = storage.BackupIncremental(&bytes.Buffer{}, BackupVersion{})
+		require.ErrorAs(t, err, &backupError)
+
+		_, err = storage.BackupIncremental(&bytes.Buffer{}, pruned)
+		require.NoError(t, err)
+
+		err = storage.PruneBackupVersions(BackupVersion{Epoch: pruned.Epoch, Version: 3})
+		require.ErrorAs(t, err, &backupError)
+
+		err = storage.PruneBackupVersions(version)
+		require.ErrorAs(t, err, &backupError)
+	})
+}
+
+func TestBackupFailedCommit(t *testing.T) {
+
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	baseStorage := &failingBaseStorage{InMemBaseStorage: NewInMemBaseStorage()}
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage, WithBackupTracking())
+
+	ids := make([]StorageID, 2)
+	for i := range ids {
+		id, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+		require.NoError(t, storage.Store(id, &ArrayDataSlab{header: ArraySlabHeader{id: id}}))
+		ids[i] = id
+	}
+
+	// Failed commit doesn't advance commit version.
+	baseStorage.failID = ids[1]
+	require.Error(t, storage.Commit())
+	require.Equal(t, uint64(0), storage.CommitVersion())
+
+	baseStorage.failID = StorageIDUndefined
+	require.NoError(t, storage.Commit())
+	require.Equal(t, uint64(1), storage.CommitVersion())
+
+	// Slabs written by failed commit are included in backup of next commit.
+	var backup bytes.Buffer
+	_, err := storage.BackupIncremental(&backup, BackupVersion{})
+	require.NoError(t, err)
+
+	result, err := newTestPersistentStorage(t).Restore(&backup)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Stored)
+}
@@ -0,0 +1,376 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ComplianceAddress is the address under which TestBaseStorageCompliance
+// generates storage IDs.  Backends shouldn't hold other data under it.
+var ComplianceAddress = Address{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}
+
+type baseStorageCommitter interface {
+	Commit() error
+}
+
+// TestBaseStorageCompliance checks that storage follows BaseStorage
+// semantics expected by PersistentSlabStorage:
+//   - GenerateStorageID returns unique valid IDs under the given address
+//   - Retrieve of a missing ID returns not found without error
+//   - Store, overwrite and Remove are visible to Retrieve, before and
+//     after Commit if storage implements Commit() error
+//   - Remove of a missing ID succeeds
+//   - SegmentCounts and Size account for stored segments
+//   - usage reporter counts bytes and segments since ResetReporter
+//
+// Data is stored under ComplianceAddress and removed before returning.
+// It returns nil if storage passes, otherwise an error listing every
+// failed check.
+func TestBaseStorageCompliance(storage BaseStorage) error {
+	t := &baseStorageComplianceTest{storage: storage}
+
+	t.run("generate storage id", t.checkGenerateStorageID)
+	t.run("retrieve missing", t.checkRetrieveMissing)
+	t.run("store and retrieve", t.checkStoreRetrieve)
+	t.run("overwrite", t.checkOverwrite)
+	t.run("remove", t.checkRemove)
+	t.run("remove missing", t.checkRemoveMissing)
+	t.run("commit", t.checkCommit)
+	t.run("segment counts and size", t.checkCountsAndSize)
+	t.run("usage reporter", t.checkUsageReporter)
+
+	t.run("cleanup", t.cleanup)
+
+	if len(t.failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf(
+		"base storage compliance: %d check(s) failed:\n%s",
+		len(t.failures),
+		strings.Join(t.failures, "\n"))
+}
+
+type baseStorageComplianceTest struct {
+	storage  BaseStorage
+	stored   []StorageID
+	failures []string
+}
+
+func (t *baseStorageComplianceTest) run(name string, check func() error) {
+	err := check()
+	if err != nil {
+		t.failures = append(t.failures, fmt.Sprintf("  %s: %s", name, err))
+	}
+}
+
+func (t *baseStorageComplianceTest) generate() (StorageID, error) {
+	id, err := t.storage.GenerateStorageID(ComplianceAddress)
+	if err != nil {
+		return StorageIDUndefined, fmt.Errorf("failed to generate storage id: %w", err)
+	}
+	return id, nil
+}
+
+func (t *baseStorageComplianceTest) store(id StorageID, data []byte) error {
+	err := t.storage.Store(id, data)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", id, err)
+	}
+	t.stored = append(t.stored, id)
+	return nil
+}
+
+func (t *baseStorageComplianceTest) commit() error {
+	committer, ok := t.storage.(baseStorageCommitter)
+	if !ok {
+		return nil
+	}
+	err := committer.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+func (t *baseStorageComplianceTest) expectData(id StorageID, expected []byte) error {
+	data, found, err := t.storage.Retrieve(id)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s: %w", id, err)
+	}
+	if !found {
+		return fmt.Errorf("%s isn't found after store", id)
+	}
+	if !bytes.Equal(data, expected) {
+		return fmt.Errorf("%s has data %x, want %x", id, data, expected)
+	}
+	return nil
+}
+
+func (t *baseStorageComplianceTest) expectMissing(id StorageID) error {
+	data, found, err := t.storage.Retrieve(id)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve %s: %w", id, err)
+	}
+	if found {
+		return fmt.Errorf("%s is found with data %x, want not found", id, data)
+	}
+	return nil
+}
+
+func (t *baseStorageComplianceTest) checkGenerateStorageID() error {
+	const count = 16
+
+	seen := make(map[StorageID]struct{}, count)
+	for i := 0; i < count; i++ {
+		id, err := t.generate()
+		if err != nil {
+			return err
+		}
+		if err := id.Valid(); err != nil {
+			return fmt.Errorf("generated invalid storage id %s: %w", id, err)
+		}
+		if id.Address != ComplianceAddress {
+			return fmt.Errorf("generated storage id %s has address 0x%x, want 0x%x", id, id.Address[:], ComplianceAddress[:])
+		}
+		if _, ok := seen[id]; ok {
+			return fmt.Errorf("generated duplicate storage id %s", id)
+		}
+		seen[id] = struct{}{}
+	}
+	return nil
+}
+
+func (t *baseStorageComplianceTest) checkRetrieveMissing() error {
+	id, err := t.generate()
+	if err != nil {
+		return err
+	}
+	return t.expectMissing(id)
+}
+
+func (t *baseStorageComplianceTest) checkStoreRetrieve() error {
+	id1, err := t.generate()
+	if err != nil {
+		return err
+	}
+	id2, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	data1 := []byte{1, 2, 3}
+	data2 := []byte{4, 5, 6, 7}
+
+	if err := t.store(id1, data1); err != nil {
+		return err
+	}
+	if err := t.store(id2, data2); err != nil {
+		return err
+	}
+
+	if err := t.expectData(id1, data1); err != nil {
+		return err
+	}
+	return t.expectData(id2, data2)
+}
+
+func (t *baseStorageComplianceTest) checkOverwrite() error {
+	id, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	if err := t.store(id, []byte{1, 2, 3}); err != nil {
+		return err
+	}
+
+	data := []byte{9, 8}
+	if err := t.store(id, data); err != nil {
+		return err
+	}
+	return t.expectData(id, data)
+}
+
+func (t *baseStorageComplianceTest) checkRemove() error {
+	id, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	if err := t.store(id, []byte{1, 2, 3}); err != nil {
+		return err
+	}
+
+	err = t.storage.Remove(id)
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", id, err)
+	}
+	return t.expectMissing(id)
+}
+
+func (t *baseStorageComplianceTest) checkRemoveMissing() error {
+	id, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	err = t.storage.Remove(id)
+	if err != nil {
+		return fmt.Errorf("failed to remove missing %s: %w", id, err)
+	}
+	return t.expectMissing(id)
+}
+
+func (t *baseStorageComplianceTest) checkCommit() error {
+	stored, err := t.generate()
+	if err != nil {
+		return err
+	}
+	removed, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	data := []byte{1, 2, 3}
+	if err := t.store(stored, data); err != nil {
+		return err
+	}
+	if err := t.store(removed, data); err != nil {
+		return err
+	}
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	err = t.storage.Remove(removed)
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", removed, err)
+	}
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	if err := t.expectData(stored, data); err != nil {
+		return err
+	}
+	return t.expectMissing(removed)
+}
+
+func (t *baseStorageComplianceTest) checkCountsAndSize() error {
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	count := t.storage.SegmentCounts()
+	size := t.storage.Size()
+
+	id, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	data := []byte{1, 2, 3, 4, 5}
+	if err := t.store(id, data); err != nil {
+		return err
+	}
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	if got := t.storage.SegmentCounts(); got != count+1 {
+		return fmt.Errorf("SegmentCounts() is %d after storing a segment, want %d", got, count+1)
+	}
+	if got := t.storage.Size(); got != size+len(data) {
+		return fmt.Errorf("Size() is %d after storing %d bytes, want %d", got, len(data), size+len(data))
+	}
+
+	err = t.storage.Remove(id)
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", id, err)
+	}
+	if err := t.commit(); err != nil {
+		return err
+	}
+
+	if got := t.storage.SegmentCounts(); got != count {
+		return fmt.Errorf("SegmentCounts() is %d after removing a segment, want %d", got, count)
+	}
+	if got := t.storage.Size(); got != size {
+		return fmt.Errorf("Size() is %d after removing a segment, want %d", got, size)
+	}
+	return nil
+}
+
+func (t *baseStorageComplianceTest) checkUsageReporter() error {
+	id, err := t.generate()
+	if err != nil {
+		return err
+	}
+
+	t.storage.ResetReporter()
+
+	data := []byte{1, 2, 3, 4}
+	if err := t.store(id, data); err != nil {
+		return err
+	}
+	if err := t.expectData(id, data); err != nil {
+		return err
+	}
+
+	if got := t.storage.BytesStored(); got != len(data) {
+		return fmt.Errorf("BytesStored() is %d, want %d", got, len(data))
+	}
+	if got := t.storage.BytesRetrieved(); got != len(data) {
+		return fmt.Errorf("BytesRetrieved() is %d, want %d", got, len(data))
+	}
+	if got := t.storage.SegmentsUpdated(); got != 1 {
+		return fmt.Errorf("SegmentsUpdated() is %d, want 1", got)
+	}
+	if got := t.storage.SegmentsReturned(); got != 1 {
+		return fmt.Errorf("SegmentsReturned() is %d, want 1", got)
+	}
+	if got := t.storage.SegmentsTouched(); got != 1 {
+		return fmt.Errorf("SegmentsTouched() is %d, want 1", got)
+	}
+
+	t.storage.ResetReporter()
+
+	if t.storage.BytesStored() != 0 ||
+		t.storage.BytesRetrieved() != 0 ||
+		t.storage.SegmentsUpdated() != 0 ||
+		t.storage.SegmentsReturned() != 0 ||
+		t.storage.SegmentsTouched() != 0 {
+		return fmt.Errorf("usage reporter isn't reset by ResetReporter()")
+	}
+	return nil
+}
+
+func (t *baseStorageComplianceTest) cleanup() error {
+	for _, id := range t.stored {
+		err := t.storage.Remove(id)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", id, err)
+		}
+	}
+	t.stored = nil
+	return t.commit()
+}
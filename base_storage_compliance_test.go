@@ -0,0 +1,71 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// leakyBaseStorage ignores Remove.
+type leakyBaseStorage struct {
+	*InMemBaseStorage
+}
+
+func (s *leakyBaseStorage) Remove(StorageID) error {
+	return nil
+}
+
+func TestBaseStorageComplianceSuite(t *testing.T) {
+
+	t.Run("compliant", func(t *testing.T) {
+		storage := NewInMemBaseStorage()
+
+		err := TestBaseStorageCompliance(storage)
+		require.NoError(t, err)
+
+		// Data is cleaned up.
+		require.Equal(t, 0, storage.SegmentCounts())
+	})
+
+	t.Run("existing data", func(t *testing.T) {
+		storage := NewInMemBaseStorage()
+
+		id := NewStorageID(Address{1}, StorageIndex{1})
+		err := storage.Store(id, []byte{1, 2, 3})
+		require.NoError(t, err)
+
+		err = TestBaseStorageCompliance(storage)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, storage.SegmentCounts())
+	})
+
+	t.Run("non-compliant", func(t *testing.T) {
+		storage := &leakyBaseStorage{NewInMemBaseStorage()}
+
+		err := TestBaseStorageCompliance(storage)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "  remove: ")
+		require.Contains(t, err.Error(), "  commit: ")
+		require.Contains(t, err.Error(), "  segment counts and size: ")
+		require.NotContains(t, err.Error(), "  store and retrieve: ")
+	})
+}
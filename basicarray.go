@@ -134,7 +134,7 @@ func (a *BasicArrayDataSlab) ChildStorables() []Storable {
 
 func (a *BasicArrayDataSlab) Get(_ SlabStorage, index uint64) (Storable, error) {
 	if index >= uint64(len(a.elements)) {
-		return nil, NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 	v := a.elements[index]
 	return v, nil
@@ -142,7 +142,7 @@ func (a *BasicArrayDataSlab) Get(_ SlabStorage, index uint64) (Storable, error)
 
 func (a *BasicArrayDataSlab) Set(storage SlabStorage, index uint64, v Storable) error {
 	if index >= uint64(len(a.elements)) {
-		return NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 
 	oldElem := a.elements[index]
@@ -163,7 +163,7 @@ func (a *BasicArrayDataSlab) Set(storage SlabStorage, index uint64, v Storable)
 
 func (a *BasicArrayDataSlab) Insert(storage SlabStorage, index uint64, v Storable) error {
 	if index > uint64(len(a.elements)) {
-		return NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 
 	if index == uint64(len(a.elements)) {
@@ -187,7 +187,7 @@ func (a *BasicArrayDataSlab) Insert(storage SlabStorage, index uint64, v Storabl
 
 func (a *BasicArrayDataSlab) Remove(storage SlabStorage, index uint64) (Storable, error) {
 	if index >= uint64(len(a.elements)) {
-		return nil, NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, uint64(len(a.elements))))
 	}
 
 	v := a.elements[index]
@@ -297,7 +297,7 @@ func NewBasicArrayWithRootID(storage SlabStorage, id StorageID) (*BasicArray, er
 func (a *BasicArray) Get(index uint64) (Value, error) {
 	storable, err := a.root.Get(a.storage, index)
 	if err != nil {
-		return nil, err
+		return nil, withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
 	}
 	return storable.StoredValue(a.storage)
 }
@@ -307,7 +307,11 @@ func (a *BasicArray) Set(index uint64, v Value) error {
 	if err != nil {
 		return err
 	}
-	return a.root.Set(a.storage, index, storable)
+	err = a.root.Set(a.storage, index, storable)
+	if err != nil {
+		return withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
+	}
+	return nil
 }
 
 func (a *BasicArray) Append(v Value) error {
@@ -320,13 +324,17 @@ func (a *BasicArray) Insert(index uint64, v Value) error {
 	if err != nil {
 		return err
 	}
-	return a.root.Insert(a.storage, index, storable)
+	err = a.root.Insert(a.storage, index, storable)
+	if err != nil {
+		return withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
+	}
+	return nil
 }
 
 func (a *BasicArray) Remove(index uint64) (Value, error) {
 	storable, err := a.root.Remove(a.storage, index)
 	if err != nil {
-		return nil, err
+		return nil, withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
 	}
 	return storable.StoredValue(a.storage)
 }
@@ -338,3 +346,63 @@ func (a *BasicArray) Count() uint64 {
 func (a *BasicArray) String() string {
 	return a.root.String()
 }
+
+// NeedsPromotion returns true if basic array root slab exceeds
+// max slab size.  BasicArrayDataSlab can't be split, so such basic
+// array should be promoted to Array with PromoteToArray.
+func (a *BasicArray) NeedsPromotion() bool {
+	return uint64(a.root.ByteSize()) > maxThreshold
+}
+
+// PromoteToArray converts basic array to Array of typeInfo with the same
+// elements and the same root storage ID, so that references to the basic
+// array remain valid.  Elements are moved without being re-encoded, and
+// external slabs referenced by elements are kept.
+//
+// Basic array must not be used after it is promoted.
+func (a *BasicArray) PromoteToArray(typeInfo TypeInfo) (*Array, error) {
+
+	elements := a.root.elements
+
+	root := &ArrayDataSlab{
+		header: ArraySlabHeader{
+			id:   a.root.header.id,
+			size: arrayRootDataSlabPrefixSize,
+		},
+		extraData: &ArrayExtraData{TypeInfo: typeInfo},
+	}
+
+	// Storing new root replaces basic array root slab.
+	err := a.storage.Store(root.header.id, root)
+	if err != nil {
+		return nil, err
+	}
+
+	array := &Array{
+		Storage: a.storage,
+		root:    root,
+	}
+
+	for i, storable := range elements {
+		err := array.Insert(uint64(i), storableValue{storable})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a.root = &BasicArrayDataSlab{header: ArraySlabHeader{id: root.header.id}}
+
+	return array, nil
+}
+
+// storableValue is Value of existing storable.  It is used to move
+// storables between collections without creating new storables.
+type storableValue struct {
+	storable Storable
+}
+
+var _ Value = storableValue{}
+
+func (v storableValue) Storable(_ SlabStorage, _ Address, _ uint64) (Storable, error) {
+	return v.storable, nil
+}
@@ -20,6 +20,7 @@ package atree
 
 import (
 	"math"
+	"strings"
 	"testing"
 
 	"github.com/fxamacker/cbor/v2"
@@ -448,3 +449,60 @@ func TestBasicArrayDecodeEncodeRandomData(t *testing.T) {
 		require.Equal(t, values[i], e)
 	}
 }
+
+func TestBasicArrayPromoteToArray(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	basicArray, err := NewBasicArray(storage, address)
+	require.NoError(t, err)
+
+	require.False(t, basicArray.NeedsPromotion())
+
+	values := make([]Value, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		var v Value = Uint64Value(i)
+		if i%100 == 0 {
+			// Large string is stored in external slab.
+			v = NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))
+		}
+		values[i] = v
+		err := basicArray.Append(v)
+		require.NoError(t, err)
+	}
+
+	require.True(t, basicArray.NeedsPromotion())
+
+	id := basicArray.StorageID()
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	array, err := basicArray.PromoteToArray(typeInfo)
+	require.NoError(t, err)
+	require.Equal(t, id, array.StorageID())
+
+	verifyArray(t, storage, typeInfo, address, array, values, false)
+
+	stats, err := GetArrayStats(array)
+	require.NoError(t, err)
+	require.True(t, stats.DataSlabCount > 1)
+
+	// Promoted array is loaded with the same root storage id.
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	array2, err := NewArrayWithRootID(storage2, id)
+	require.NoError(t, err)
+
+	verifyArray(t, storage2, typeInfo, address, array2, values, false)
+}
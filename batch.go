@@ -0,0 +1,288 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"context"
+	"errors"
+)
+
+// BatchProgress is progress of NewArrayFromBatchData or NewMapFromBatchData.
+type BatchProgress struct {
+	// Elements is number of elements added so far.
+	Elements uint64
+	// Slabs is number of data slabs built so far.
+	Slabs uint64
+}
+
+// BatchProgressFunc is called with progress of batch construction.
+type BatchProgressFunc func(BatchProgress)
+
+// BatchOption configures NewArrayFromBatchData and NewMapFromBatchData.
+type BatchOption func(opts *batchOptions) *batchOptions
+
+// DuplicateKeyPolicy is how NewMapFromBatchData handles a key provided
+// more than once.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeyPolicyError fails with DuplicateKeyError.  It is the default.
+	DuplicateKeyPolicyError DuplicateKeyPolicy = iota
+	// DuplicateKeyPolicyKeepFirst keeps value provided first.
+	DuplicateKeyPolicyKeepFirst
+	// DuplicateKeyPolicyKeepLast keeps value provided last.
+	DuplicateKeyPolicyKeepLast
+	// DuplicateKeyPolicyMerge keeps value returned by DuplicateKeyMergeFunc.
+	DuplicateKeyPolicyMerge
+)
+
+func (p DuplicateKeyPolicy) String() string {
+	switch p {
+	case DuplicateKeyPolicyError:
+		return "error"
+	case DuplicateKeyPolicyKeepFirst:
+		return "keep-first"
+	case DuplicateKeyPolicyKeepLast:
+		return "keep-last"
+	case DuplicateKeyPolicyMerge:
+		return "merge"
+	default:
+		return "unknown"
+	}
+}
+
+// DuplicateKeyMergeFunc returns value of key provided more than once,
+// given value kept so far and newly provided value.  Returning nil keeps
+// existing value.
+type DuplicateKeyMergeFunc func(key Value, existing Value, value Value) (Value, error)
+
+type batchOptions struct {
+	ctx                context.Context
+	progress           BatchProgressFunc
+	commitInterval     uint64
+	commit             func() error
+	duplicateKeyPolicy DuplicateKeyPolicy
+	mergeDuplicateKey  DuplicateKeyMergeFunc
+	userMetadata       *UserMetadata
+}
+
+// WithBatchContext returns BatchOption that stops batch construction
+// with ctx.Err() once ctx is done.  Context is checked each time a data
+// slab is built.
+func WithBatchContext(ctx context.Context) BatchOption {
+	return func(opts *batchOptions) *batchOptions {
+		opts.ctx = ctx
+		return opts
+	}
+}
+
+// WithBatchProgress returns BatchOption that calls fn each time a data
+// slab is built, and once after all elements are added.
+func WithBatchProgress(fn BatchProgressFunc) BatchOption {
+	return func(opts *batchOptions) *batchOptions {
+		opts.progress = fn
+		return opts
+	}
+}
+
+// WithBatchCommit returns BatchOption that stores built data slabs and
+// calls commit every interval data slabs, so that elements don't need to
+// be held in memory until batch construction completes.  Commit is
+// typically PersistentSlabStorage.Commit followed by DropCache.
+//
+// Data slabs committed before batch construction fails aren't removed.
+func WithBatchCommit(interval uint64, commit func() error) BatchOption {
+	return func(opts *batchOptions) *batchOptions {
+		opts.commitInterval = interval
+		opts.commit = commit
+		return opts
+	}
+}
+
+// WithDuplicateKeyPolicy returns BatchOption that sets how
+// NewMapFromBatchData handles a key provided more than once.
+// DuplicateKeyPolicyMerge requires WithDuplicateKeyMerge instead.
+func WithDuplicateKeyPolicy(policy DuplicateKeyPolicy) BatchOption {
+	return func(opts *batchOptions) *batchOptions {
+		opts.duplicateKeyPolicy = policy
+		return opts
+	}
+}
+
+// WithDuplicateKeyMerge returns BatchOption that sets
+// DuplicateKeyPolicyMerge with merge function.
+func WithDuplicateKeyMerge(merge DuplicateKeyMergeFunc) BatchOption {
+	return func(opts *batchOptions) *batchOptions {
+		opts.duplicateKeyPolicy = DuplicateKeyPolicyMerge
+		opts.mergeDuplicateKey = merge
+		return opts
+	}
+}
+
+// WithUserMetadata returns BatchOption that attaches metadata to root of
+// constructed collection.  Metadata is validated and copied like
+// SetUserMetadata.
+func WithUserMetadata(metadata *UserMetadata) BatchOption {
+	return func(opts *batchOptions) *batchOptions {
+		opts.userMetadata = metadata
+		return opts
+	}
+}
+
+func newBatchOptions(options []BatchOption) *batchOptions {
+	opts := &batchOptions{}
+	for _, option := range options {
+		opts = option(opts)
+	}
+	return opts
+}
+
+// dataSlabBuilt reports progress after a data slab is built, and returns
+// true if built data slabs should be committed.
+func (opts *batchOptions) dataSlabBuilt(elements uint64, slabs uint64) (bool, error) {
+	if opts.ctx != nil {
+		err := opts.ctx.Err()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if opts.progress != nil {
+		opts.progress(BatchProgress{Elements: elements, Slabs: slabs})
+	}
+
+	return opts.commit != nil && opts.commitInterval > 0 && slabs%opts.commitInterval == 0, nil
+}
+
+// done reports progress after all elements are added.
+func (opts *batchOptions) done(elements uint64, slabs uint64) {
+	if opts.progress != nil {
+		opts.progress(BatchProgress{Elements: elements, Slabs: slabs})
+	}
+}
+
+// commitArrayDataSlabs stores data slabs built since last commit, except
+// the last one which can still be rebalanced, and commits them.
+// Committed slabs are replaced by slabs with header only.  It returns
+// number of committed slabs.
+func (opts *batchOptions) commitArrayDataSlabs(storage SlabStorage, slabs []ArraySlab, committed int) (int, error) {
+	last := len(slabs) - 1
+	for i := committed; i < last; i++ {
+		slab := slabs[i].(*ArrayDataSlab)
+		err := storage.Store(slab.ID(), slab)
+		if err != nil {
+			return 0, err
+		}
+		slabs[i] = &ArrayDataSlab{header: slab.header, next: slab.next}
+	}
+
+	err := opts.commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return last, nil
+}
+
+// commitMapDataSlabs is commitArrayDataSlabs for map data slabs.
+func (opts *batchOptions) commitMapDataSlabs(storage SlabStorage, slabs []MapSlab, committed int) (int, error) {
+	last := len(slabs) - 1
+	for i := committed; i < last; i++ {
+		slab := slabs[i].(*MapDataSlab)
+		err := storage.Store(slab.ID(), slab)
+		if err != nil {
+			return 0, err
+		}
+		slabs[i] = &MapDataSlab{header: slab.header, next: slab.next}
+	}
+
+	err := opts.commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return last, nil
+}
+
+// resolveDuplicateKey returns value to set for key in elem according to
+// duplicate key policy, or nil if existing value of key is kept.
+// It returns value unchanged if key isn't in elem.
+func (opts *batchOptions) resolveDuplicateKey(
+	storage SlabStorage,
+	elem element,
+	digester Digester,
+	hkey Digest,
+	comparator ValueComparator,
+	key Value,
+	value Value,
+) (Value, error) {
+	existing, err := elem.Get(storage, digester, 0, hkey, comparator, key)
+	if err != nil {
+		var keyNotFoundError *KeyNotFoundError
+		if errors.As(err, &keyNotFoundError) {
+			return value, nil
+		}
+		return nil, err
+	}
+
+	switch opts.duplicateKeyPolicy {
+	case DuplicateKeyPolicyKeepFirst:
+		return nil, nil
+
+	case DuplicateKeyPolicyKeepLast:
+		return value, nil
+
+	case DuplicateKeyPolicyMerge:
+		if opts.mergeDuplicateKey == nil {
+			return nil, NewFatalError(NewDuplicateKeyError(key))
+		}
+		existingValue, err := existing.StoredValue(storage)
+		if err != nil {
+			return nil, err
+		}
+		return opts.mergeDuplicateKey(key, existingValue, value)
+
+	default:
+		return nil, NewFatalError(NewDuplicateKeyError(key))
+	}
+}
+
+// removeReplacedStorable removes slab of value replaced during batch
+// construction if the slab was created to store a large value.
+// Nested collections are owned by caller and aren't removed.
+func removeReplacedStorable(storage SlabStorage, storable Storable) error {
+	id, ok := storable.(StorageIDStorable)
+	if !ok {
+		return nil
+	}
+
+	slab, found, err := storage.Retrieve(StorageID(id))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+
+	if _, ok := slab.(*StorableSlab); !ok {
+		return nil
+	}
+
+	return storage.Remove(StorageID(id))
+}
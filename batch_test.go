@@ -0,0 +1,439 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayFromBatchDataOptions(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 4096
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	newElementProvider := func() ArrayElementProvider {
+		i := uint64(0)
+		return func() (Value, error) {
+			if i == arraySize {
+				return nil, nil
+			}
+			v := Uint64Value(i)
+			i++
+			return v, nil
+		}
+	}
+
+	t.Run("progress", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		var progress []BatchProgress
+		array, err := NewArrayFromBatchData(
+			storage,
+			address,
+			typeInfo,
+			newElementProvider(),
+			WithBatchProgress(func(p BatchProgress) {
+				progress = append(progress, p)
+			}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, uint64(arraySize), array.Count())
+
+		require.True(t, len(progress) > 1)
+		for i := 1; i < len(progress); i++ {
+			require.True(t, progress[i].Elements > progress[i-1].Elements)
+			require.Equal(t, progress[i-1].Slabs+1, progress[i].Slabs)
+		}
+		require.Equal(t, uint64(arraySize), progress[len(progress)-1].Elements)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		slabs := uint64(0)
+		_, err := NewArrayFromBatchData(
+			storage,
+			address,
+			typeInfo,
+			newElementProvider(),
+			WithBatchContext(ctx),
+			WithBatchProgress(func(p BatchProgress) {
+				slabs = p.Slabs
+				if p.Slabs == 2 {
+					cancel()
+				}
+			}),
+		)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, uint64(2), slabs)
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		commits := 0
+		array, err := NewArrayFromBatchData(
+			storage,
+			address,
+			typeInfo,
+			newElementProvider(),
+			WithBatchCommit(8, func() error {
+				commits++
+				err := storage.Commit()
+				if err != nil {
+					return err
+				}
+				storage.DropCache()
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		require.True(t, commits > 1)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		array2, err := NewArrayWithRootID(storage2, array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, uint64(arraySize), array2.Count())
+
+		err = ValidArray(array2, typeInfo, typeInfoComparator, hashInputProvider)
+		require.NoError(t, err)
+
+		err = array2.IterateWithIndex(func(i uint64, v Value) (bool, error) {
+			require.Equal(t, Uint64Value(i), v)
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		_, err = CheckStorageHealth(storage2, -1)
+		require.NoError(t, err)
+	})
+
+	t.Run("user metadata", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		metadata := &UserMetadata{Version: 1, Data: []byte("batch")}
+
+		array, err := NewArrayFromBatchData(
+			storage,
+			address,
+			typeInfo,
+			newElementProvider(),
+			WithUserMetadata(metadata),
+		)
+		require.NoError(t, err)
+		require.Equal(t, metadata, array.UserMetadata())
+
+		// Metadata is copied.
+		metadata.Data[0] = 'x'
+		require.Equal(t, []byte("batch"), array.UserMetadata().Data)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		array2, err := NewArrayWithRootID(storage2, array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, &UserMetadata{Version: 1, Data: []byte("batch")}, array2.UserMetadata())
+
+		// Oversized metadata is rejected.
+		_, err = NewArrayFromBatchData(
+			storage,
+			address,
+			typeInfo,
+			newElementProvider(),
+			WithUserMetadata(&UserMetadata{Data: make([]byte, MaxUserMetadataSize+1)}),
+		)
+		var sizeError *MaxUserMetadataSizeError
+		require.ErrorAs(t, err, &sizeError)
+		require.True(t, IsUserError(err))
+	})
+}
+
+func TestMapFromBatchDataOptions(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 4096
+
+	typeInfo := testTypeInfo{42}
+
+	m, err := NewMap(
+		newTestPersistentStorage(t),
+		Address{1, 2, 3, 4, 5, 6, 7, 8},
+		NewDefaultDigesterBuilder(),
+		typeInfo,
+	)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		storable, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+		require.NoError(t, err)
+		require.Nil(t, storable)
+	}
+
+	address := Address{2, 3, 4, 5, 6, 7, 8, 9}
+
+	newElementProvider := func() MapElementProvider {
+		iter, err := m.Iterator()
+		require.NoError(t, err)
+		return iter.Next
+	}
+
+	t.Run("progress and commit", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		var progress []BatchProgress
+		commits := 0
+		copied, err := NewMapFromBatchData(
+			storage,
+			address,
+			NewDefaultDigesterBuilder(),
+			m.Type(),
+			compare,
+			hashInputProvider,
+			m.Seed(),
+			newElementProvider(),
+			WithBatchProgress(func(p BatchProgress) {
+				progress = append(progress, p)
+			}),
+			WithBatchCommit(8, func() error {
+				commits++
+				err := storage.Commit()
+				if err != nil {
+					return err
+				}
+				storage.DropCache()
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		require.True(t, commits > 1)
+		require.Equal(t, uint64(mapSize), progress[len(progress)-1].Elements)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		copied2, err := NewMapWithRootID(storage2, copied.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+		require.Equal(t, uint64(mapSize), copied2.Count())
+
+		err = ValidMap(copied2, typeInfo, typeInfoComparator, hashInputProvider)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < mapSize; i++ {
+			v, err := copied2.Get(compare, hashInputProvider, Uint64Value(i))
+			require.NoError(t, err)
+			require.Equal(t, Uint64Value(i*10), v)
+		}
+
+		_, err = CheckStorageHealth(storage2, -1)
+		require.NoError(t, err)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := NewMapFromBatchData(
+			storage,
+			address,
+			NewDefaultDigesterBuilder(),
+			m.Type(),
+			compare,
+			hashInputProvider,
+			m.Seed(),
+			newElementProvider(),
+			WithBatchContext(ctx),
+		)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("user metadata", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		metadata := &UserMetadata{Version: 1, Data: []byte("batch")}
+
+		copied, err := NewMapFromBatchData(
+			storage,
+			address,
+			NewDefaultDigesterBuilder(),
+			m.Type(),
+			compare,
+			hashInputProvider,
+			m.Seed(),
+			newElementProvider(),
+			WithUserMetadata(metadata),
+		)
+		require.NoError(t, err)
+		require.Equal(t, metadata, copied.UserMetadata())
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		copied2, err := NewMapWithRootID(storage2, copied.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+		require.Equal(t, metadata, copied2.UserMetadata())
+
+		// Metadata is copied by DeepCopyValue through batch construction.
+		copied3, err := DeepCopyValue(copied2, storage2, address, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.Equal(t, metadata, copied3.(*OrderedMap).UserMetadata())
+	})
+}
+
+func TestMapFromBatchDataDuplicateKeyPolicy(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	large := NewStringValue(strings.Repeat("a", int(MaxInlineMapKeyOrValueSize)+1))
+
+	// Key 1 is provided 3 times, and key 3 collides with key 2.
+	keys := []Value{Uint64Value(0), Uint64Value(1), Uint64Value(1), Uint64Value(1), Uint64Value(2), Uint64Value(3), Uint64Value(3)}
+	values := []Value{Uint64Value(0), large, Uint64Value(10), Uint64Value(100), Uint64Value(2), Uint64Value(3), Uint64Value(30)}
+
+	digesterBuilder := &mockDigesterBuilder{}
+	digesterBuilder.On("Digest", Uint64Value(0)).Return(mockDigester{[]Digest{0, 0}})
+	digesterBuilder.On("Digest", Uint64Value(1)).Return(mockDigester{[]Digest{1, 0}})
+	digesterBuilder.On("Digest", Uint64Value(2)).Return(mockDigester{[]Digest{2, 0}})
+	digesterBuilder.On("Digest", Uint64Value(3)).Return(mockDigester{[]Digest{2, 1}})
+
+	newMap := func(t *testing.T, storage SlabStorage, options ...BatchOption) (*OrderedMap, error) {
+		i := 0
+		return NewMapFromBatchData(
+			storage,
+			address,
+			digesterBuilder,
+			typeInfo,
+			compare,
+			hashInputProvider,
+			1,
+			func() (Value, Value, error) {
+				if i == len(keys) {
+					return nil, nil, nil
+				}
+				k, v := keys[i], values[i]
+				i++
+				return k, v, nil
+			},
+			options...,
+		)
+	}
+
+	requireElements := func(t *testing.T, m *OrderedMap, expected map[Value]Value) {
+		require.Equal(t, uint64(len(expected)), m.Count())
+		for k, v := range expected {
+			storable, err := m.Get(compare, hashInputProvider, k)
+			require.NoError(t, err)
+			existing, err := storable.StoredValue(m.Storage)
+			require.NoError(t, err)
+			require.Equal(t, v, existing)
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		_, err := newMap(t, storage)
+		require.True(t, IsFatalError(err))
+
+		var duplicateKeyError *DuplicateKeyError
+		require.ErrorAs(t, err, &duplicateKeyError)
+	})
+
+	t.Run("keep first", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := newMap(t, storage, WithDuplicateKeyPolicy(DuplicateKeyPolicyKeepFirst))
+		require.NoError(t, err)
+
+		requireElements(t, m, map[Value]Value{
+			Uint64Value(0): Uint64Value(0),
+			Uint64Value(1): large,
+			Uint64Value(2): Uint64Value(2),
+			Uint64Value(3): Uint64Value(3),
+		})
+
+		// Root slab and slab of large value
+		err = storage.Commit()
+		require.NoError(t, err)
+		require.Equal(t, 2, storage.Count())
+	})
+
+	t.Run("keep last", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := newMap(t, storage, WithDuplicateKeyPolicy(DuplicateKeyPolicyKeepLast))
+		require.NoError(t, err)
+
+		requireElements(t, m, map[Value]Value{
+			Uint64Value(0): Uint64Value(0),
+			Uint64Value(1): Uint64Value(100),
+			Uint64Value(2): Uint64Value(2),
+			Uint64Value(3): Uint64Value(30),
+		})
+
+		// Slab of replaced large value is removed.
+		err = storage.Commit()
+		require.NoError(t, err)
+		require.Equal(t, 1, storage.Count())
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := newMap(t, storage, WithDuplicateKeyMerge(func(key Value, existing Value, value Value) (Value, error) {
+			if existing == large {
+				return value, nil
+			}
+			return existing.(Uint64Value) + value.(Uint64Value), nil
+		}))
+		require.NoError(t, err)
+
+		requireElements(t, m, map[Value]Value{
+			Uint64Value(0): Uint64Value(0),
+			Uint64Value(1): Uint64Value(110),
+			Uint64Value(2): Uint64Value(2),
+			Uint64Value(3): Uint64Value(33),
+		})
+	})
+}
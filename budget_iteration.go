@@ -0,0 +1,344 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// IterationBudget limits elements visited by budgeted iteration.
+// Zero limits are unlimited.  At least one element is visited
+// per call so that iteration always makes progress.
+type IterationBudget struct {
+	// MaxElements is the maximum number of elements visited.
+	MaxElements uint64
+	// MaxBytes is the maximum total encoded size of visited elements.
+	MaxBytes uint64
+}
+
+type budgetTracker struct {
+	budget   IterationBudget
+	elements uint64
+	bytes    uint64
+}
+
+// tryConsume consumes budget for element of given size and
+// returns false if budget is exhausted.
+func (b *budgetTracker) tryConsume(size uint32) bool {
+	if b.elements > 0 {
+		if b.budget.MaxElements > 0 && b.elements >= b.budget.MaxElements {
+			return false
+		}
+		if b.budget.MaxBytes > 0 && b.bytes+uint64(size) > b.budget.MaxBytes {
+			return false
+		}
+	}
+	b.elements++
+	b.bytes += uint64(size)
+	return true
+}
+
+// StaleCursorPolicy is how budgeted iteration handles cursor returned
+// before collection with enabled mutation sequence was mutated.
+type StaleCursorPolicy int
+
+const (
+	// StaleCursorFail returns StaleCursorError.  It is the default.
+	StaleCursorFail StaleCursorPolicy = iota
+	// StaleCursorResume resumes iteration at nearest surviving position.
+	StaleCursorResume
+)
+
+// ArrayCursor is position of next element of budgeted array iteration.
+// MutationSequence is array mutation sequence when cursor was returned,
+// and OnStale is copied to returned cursors.
+type ArrayCursor struct {
+	Index            uint64
+	MutationSequence uint64
+	OnStale          StaleCursorPolicy
+}
+
+// IterateWithBudget iterates array elements starting at cursor (nil
+// cursor starts at first element) until budget is exhausted or fn
+// returns false.  It returns cursor to continue iteration, or nil if
+// all elements were visited.
+//
+// Elements inserted or removed before cursor position between calls
+// shift elements visited by next call.  If mutation sequence is enabled,
+// cursor returned before array was mutated is handled by its OnStale
+// policy, and resumes at the same index, or after last element if
+// index is out of bounds.
+func (a *Array) IterateWithBudget(cursor *ArrayCursor, budget IterationBudget, fn ArrayIterationFunc) (*ArrayCursor, error) {
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationIterate)
+
+	atomic.AddUint64(&a.stats.Iterations, 1)
+
+	var start ArrayCursor
+	if cursor != nil {
+		start = *cursor
+	}
+
+	index := start.Index
+
+	stale, err := isStaleCursor(a.StorageID(), start.MutationSequence, a.MutationSequence(), start.OnStale)
+	if err != nil {
+		return nil, err
+	}
+
+	count := a.Count()
+	if index >= count {
+		if index > count && !stale {
+			return nil, NewUserError(NewIndexOutOfBoundsError(index, 0, count))
+		}
+		return nil, nil
+	}
+
+	newCursor := func(index uint64) *ArrayCursor {
+		return &ArrayCursor{
+			Index:            index,
+			MutationSequence: a.MutationSequence(),
+			OnStale:          start.OnStale,
+		}
+	}
+
+	dataSlab, slabIndex, err := getArrayDataSlabWithIndex(storage, a.root, index)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := budgetTracker{budget: budget}
+
+	for {
+		for i := int(slabIndex); i < len(dataSlab.elements); i++ {
+			storable := dataSlab.elements[i]
+
+			if !tracker.tryConsume(storable.ByteSize()) {
+				return newCursor(index), nil
+			}
+
+			value, err := storable.StoredValue(a.Storage)
+			if err != nil {
+				return nil, err
+			}
+
+			index++
+
+			resume, err := fn(value)
+			if err != nil {
+				return nil, err
+			}
+			if !resume {
+				if index >= a.Count() {
+					return nil, nil
+				}
+				return newCursor(index), nil
+			}
+		}
+
+		if dataSlab.next == StorageIDUndefined {
+			return nil, nil
+		}
+
+		next, err := getArraySlab(storage, dataSlab.next)
+		if err != nil {
+			return nil, err
+		}
+
+		dataSlab = next.(*ArrayDataSlab)
+		slabIndex = 0
+	}
+}
+
+// MapCursor is position of next element of budgeted map iteration.
+// Elements are ordered by first level digest (HKey), and elements
+// with the same HKey are ordered by collision order.  Skip is the
+// number of elements with HKey that were already visited.
+// MutationSequence is map mutation sequence when cursor was returned,
+// and OnStale is copied to returned cursors.
+type MapCursor struct {
+	HKey             Digest
+	Skip             uint64
+	MutationSequence uint64
+	OnStale          StaleCursorPolicy
+}
+
+// IterateWithBudget iterates map elements starting at cursor (nil
+// cursor starts at first element) until budget is exhausted or fn
+// returns false.  It returns cursor to continue iteration, or nil if
+// all elements were visited.
+//
+// Elements inserted or removed between calls are visited by later
+// calls if their position is after cursor.  If mutation sequence is
+// enabled, cursor returned before map was mutated is handled by its
+// OnStale policy, and resumes at the first element at or after cursor
+// position.
+func (m *OrderedMap) IterateWithBudget(cursor *MapCursor, budget IterationBudget, fn MapEntryIterationFunc) (*MapCursor, error) {
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	atomic.AddUint64(&m.stats.Iterations, 1)
+
+	var start MapCursor
+	if cursor != nil {
+		start = *cursor
+	}
+
+	_, err := isStaleCursor(m.StorageID(), start.MutationSequence, m.MutationSequence(), start.OnStale)
+	if err != nil {
+		return nil, err
+	}
+
+	newCursor := func(hkey Digest, skip uint64) *MapCursor {
+		return &MapCursor{
+			HKey:             hkey,
+			Skip:             skip,
+			MutationSequence: m.MutationSequence(),
+			OnStale:          start.OnStale,
+		}
+	}
+
+	dataSlab, err := mapDataSlabWithHKey(storage, m.root, start.HKey)
+	if err != nil {
+		return nil, err
+	}
+
+	elems, ok := dataSlab.elements.(*hkeyElements)
+	if !ok {
+		return nil, NewSlabDataErrorf("slab %s elements aren't hkeyElements", dataSlab.header.id)
+	}
+
+	index := sort.Search(len(elems.hkeys), func(i int) bool {
+		return elems.hkeys[i] >= start.HKey
+	})
+
+	tracker := budgetTracker{budget: budget}
+
+	for {
+		for ; index < len(elems.elems); index++ {
+			hkey := elems.hkeys[index]
+
+			var skip uint64
+			if cursor != nil && hkey == start.HKey {
+				skip = start.Skip
+			}
+
+			it := &MapElementIterator{
+				storage:  storage,
+				elements: &hkeyElements{hkeys: elems.hkeys[index : index+1], elems: elems.elems[index : index+1]},
+			}
+
+			for n := uint64(0); ; n++ {
+				ks, vs, err := it.Next()
+				if err != nil {
+					return nil, err
+				}
+				if ks == nil {
+					break
+				}
+				if n < skip {
+					continue
+				}
+
+				if !tracker.tryConsume(ks.ByteSize() + vs.ByteSize()) {
+					return newCursor(hkey, n), nil
+				}
+
+				key, err := ks.StoredValue(m.Storage)
+				if err != nil {
+					return nil, err
+				}
+
+				value, err := vs.StoredValue(m.Storage)
+				if err != nil {
+					return nil, err
+				}
+
+				resume, err := fn(key, value)
+				if err != nil {
+					return nil, err
+				}
+				if !resume {
+					return newCursor(hkey, n+1), nil
+				}
+			}
+		}
+
+		if dataSlab.next == StorageIDUndefined {
+			return nil, nil
+		}
+
+		next, err := getMapSlab(storage, dataSlab.next)
+		if err != nil {
+			return nil, err
+		}
+
+		dataSlab = next.(*MapDataSlab)
+		elems, ok = dataSlab.elements.(*hkeyElements)
+		if !ok {
+			return nil, NewSlabDataErrorf("slab %s elements aren't hkeyElements", dataSlab.header.id)
+		}
+		index = 0
+	}
+}
+
+// mapDataSlabWithHKey returns data slab that contains hkey if hkey exists,
+// or data slab where hkey would be inserted.
+func mapDataSlabWithHKey(storage SlabStorage, slab MapSlab, hkey Digest) (*MapDataSlab, error) {
+	if slab.IsData() {
+		return slab.(*MapDataSlab), nil
+	}
+
+	meta := slab.(*MapMetaDataSlab)
+
+	childHeaderIndex := sort.Search(len(meta.childrenHeaders), func(i int) bool {
+		return meta.childrenHeaders[i].firstKey > hkey
+	}) - 1
+	if childHeaderIndex < 0 {
+		childHeaderIndex = 0
+	}
+
+	child, err := getMapSlab(storage, meta.childrenHeaders[childHeaderIndex].id)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapDataSlabWithHKey(storage, child, hkey)
+}
+
+// isStaleCursor returns true if cursor was returned before collection was
+// mutated.  It returns StaleCursorError for stale cursor with StaleCursorFail
+// policy.  Cursors without mutation sequence are never stale.
+func isStaleCursor(
+	id StorageID,
+	cursorSequence uint64,
+	sequence uint64,
+	onStale StaleCursorPolicy,
+) (bool, error) {
+	if cursorSequence == 0 || cursorSequence == sequence {
+		return false, nil
+	}
+	if onStale == StaleCursorResume {
+		return true, nil
+	}
+	return true, NewStaleCursorError(id, cursorSequence, sequence)
+}
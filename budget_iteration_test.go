@@ -0,0 +1,296 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayIterateWithBudget(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		v := Uint64Value(i)
+		values[i] = v
+		err := array.Append(v)
+		require.NoError(t, err)
+	}
+
+	t.Run("element budget", func(t *testing.T) {
+		var visited []Value
+		var cursor *ArrayCursor
+		calls := 0
+		for {
+			cursor, err = array.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, func(v Value) (bool, error) {
+				visited = append(visited, v)
+				return true, nil
+			})
+			require.NoError(t, err)
+			calls++
+			if cursor == nil {
+				break
+			}
+			require.Equal(t, uint64(len(visited)), cursor.Index)
+		}
+		require.Equal(t, values, visited)
+		require.Equal(t, (arraySize+99)/100, calls)
+	})
+
+	t.Run("byte budget", func(t *testing.T) {
+		var visited []Value
+		var cursor *ArrayCursor
+		for {
+			n := 0
+			cursor, err = array.IterateWithBudget(cursor, IterationBudget{MaxBytes: 64}, func(v Value) (bool, error) {
+				visited = append(visited, v)
+				n++
+				return true, nil
+			})
+			require.NoError(t, err)
+			require.True(t, n > 0)
+			if cursor == nil {
+				break
+			}
+			require.True(t, n <= 64)
+		}
+		require.Equal(t, values, visited)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		cursor, err := array.IterateWithBudget(&ArrayCursor{Index: 10}, IterationBudget{}, func(v Value) (bool, error) {
+			return false, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, &ArrayCursor{Index: 11}, cursor)
+
+		cursor, err = array.IterateWithBudget(&ArrayCursor{Index: arraySize}, IterationBudget{}, func(v Value) (bool, error) {
+			return true, nil
+		})
+		require.NoError(t, err)
+		require.Nil(t, cursor)
+
+		_, err = array.IterateWithBudget(&ArrayCursor{Index: arraySize + 1}, IterationBudget{}, func(v Value) (bool, error) {
+			return true, nil
+		})
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+	})
+}
+
+func TestMapIterateWithBudget(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Keys collide on first level digest.
+	digesterBuilder := &mockDigesterBuilder{}
+	for i := uint64(0); i < mapSize; i++ {
+		digesterBuilder.On("Digest", Uint64Value(i)).Return(mockDigester{[]Digest{Digest(i % 64), Digest(i)}})
+	}
+
+	m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*2))
+		require.NoError(t, err)
+	}
+
+	var keys []Value
+	err = m.IterateKeys(func(k Value) (bool, error) {
+		keys = append(keys, k)
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	for _, budget := range []IterationBudget{{MaxElements: 7}, {MaxBytes: 100}, {}} {
+		var visited []Value
+		var cursor *MapCursor
+		for {
+			cursor, err = m.IterateWithBudget(cursor, budget, func(k Value, v Value) (bool, error) {
+				require.Equal(t, k.(Uint64Value)*2, v)
+				visited = append(visited, k)
+				return true, nil
+			})
+			require.NoError(t, err)
+			if cursor == nil {
+				break
+			}
+		}
+		require.Equal(t, keys, visited)
+	}
+
+	// Elements removed before cursor don't affect continuation.
+	var visited []Value
+	cursor, err := m.IterateWithBudget(nil, IterationBudget{MaxElements: mapSize / 2}, func(k Value, _ Value) (bool, error) {
+		visited = append(visited, k)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.NotNil(t, cursor)
+
+	for _, k := range visited[:10] {
+		_, _, err := m.Remove(compare, hashInputProvider, k)
+		require.NoError(t, err)
+	}
+
+	for cursor != nil {
+		cursor, err = m.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, func(k Value, _ Value) (bool, error) {
+			visited = append(visited, k)
+			return true, nil
+		})
+		require.NoError(t, err)
+	}
+	require.Equal(t, keys, visited)
+}
+
+func TestIterateWithBudgetMutationSequence(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("array", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), array.MutationSequence())
+
+		err = array.EnableMutationSequence()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), array.MutationSequence())
+
+		for i := uint64(0); i < 500; i++ {
+			err := array.Append(Uint64Value(i))
+			require.NoError(t, err)
+		}
+		require.Equal(t, uint64(501), array.MutationSequence())
+
+		noop := func(Value) (bool, error) { return true, nil }
+
+		cursor, err := array.IterateWithBudget(nil, IterationBudget{MaxElements: 100}, noop)
+		require.NoError(t, err)
+		require.Equal(t, &ArrayCursor{Index: 100, MutationSequence: 501}, cursor)
+
+		// Cursor is valid without mutation.
+		cursor, err = array.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, noop)
+		require.NoError(t, err)
+		require.Equal(t, uint64(200), cursor.Index)
+
+		// Remove elements, so cursor index is out of bounds.
+		for array.Count() > 150 {
+			_, err := array.Remove(array.Count() - 1)
+			require.NoError(t, err)
+		}
+
+		_, err = array.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, noop)
+		var staleCursorError *StaleCursorError
+		require.ErrorAs(t, err, &staleCursorError)
+
+		cursor.OnStale = StaleCursorResume
+		cursor, err = array.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, noop)
+		require.NoError(t, err)
+		require.Nil(t, cursor)
+
+		// Mutation sequence is persisted.
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+		array2, err := NewArrayWithRootID(storage2, array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, array.MutationSequence(), array2.MutationSequence())
+
+		err = array2.PopIterate(func(Storable) {})
+		require.NoError(t, err)
+		require.Equal(t, array.MutationSequence()+1, array2.MutationSequence())
+	})
+
+	t.Run("map", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		err = m.EnableMutationSequence()
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 500; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+			require.NoError(t, err)
+		}
+		require.Equal(t, uint64(501), m.MutationSequence())
+
+		visited := make(map[Value]bool)
+		visit := func(k Value, _ Value) (bool, error) {
+			visited[k] = true
+			return true, nil
+		}
+
+		cursor, err := m.IterateWithBudget(nil, IterationBudget{MaxElements: 100}, visit)
+		require.NoError(t, err)
+		require.Equal(t, uint64(501), cursor.MutationSequence)
+
+		// Overwrite existing value.
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(1))
+		require.NoError(t, err)
+		require.Equal(t, uint64(502), m.MutationSequence())
+
+		_, err = m.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, visit)
+		var staleCursorError *StaleCursorError
+		require.ErrorAs(t, err, &staleCursorError)
+
+		cursor.OnStale = StaleCursorResume
+		for cursor != nil {
+			cursor, err = m.IterateWithBudget(cursor, IterationBudget{MaxElements: 100}, visit)
+			require.NoError(t, err)
+			if cursor != nil {
+				require.Equal(t, StaleCursorResume, cursor.OnStale)
+			}
+		}
+		require.Equal(t, 500, len(visited))
+
+		_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+		require.Equal(t, uint64(503), m.MutationSequence())
+	})
+}
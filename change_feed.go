@@ -0,0 +1,159 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// ChangeOperation is kind of mutation reported in ChangeEvent.
+type ChangeOperation int
+
+const (
+	// ChangeSet is reported when existing element is replaced.
+	ChangeSet ChangeOperation = iota
+	// ChangeInsert is reported when element is inserted, including
+	// Array.Append and OrderedMap.Set of new key.
+	ChangeInsert
+	// ChangeRemove is reported when element is removed.
+	ChangeRemove
+)
+
+func (op ChangeOperation) String() string {
+	switch op {
+	case ChangeSet:
+		return "set"
+	case ChangeInsert:
+		return "insert"
+	case ChangeRemove:
+		return "remove"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeEvent describes element mutation of collection.
+type ChangeEvent struct {
+	Op     ChangeOperation
+	RootID StorageID
+	// Index is element index of Array mutation.
+	Index uint64
+	// Key is element key of OrderedMap mutation.
+	Key Value
+	// Old is replaced or removed element, nil for ChangeInsert.
+	Old Storable
+	// New is stored element, nil for ChangeRemove.
+	New Storable
+}
+
+// ChangeSink receives element mutations of collection after they are
+// applied.  ChangeSink is called synchronously and must not modify the
+// collection.
+type ChangeSink func(event ChangeEvent)
+
+// SetChangeSink sets sink receiving element mutations of this Array
+// instance.  Sink isn't persisted, it only applies to this Array instance.
+// Nil sink disables change feed.
+func (a *Array) SetChangeSink(sink ChangeSink) {
+	a.changeSink = sink
+}
+
+// emitChange reports mutation of element at index to change sink and journal.  New element is read
+// back from storage since root slab operations don't return stored element.  It is called after
+// root is rebalanced, so error returned by journal doesn't leave root full or with one child slab.
+func (a *Array) emitChange(op ChangeOperation, index uint64, old Storable) error {
+	if a.changeSink == nil && a.journal == nil {
+		return nil
+	}
+
+	var newStorable Storable
+	if op != ChangeRemove {
+		var err error
+		newStorable, err = a.root.Get(a.Storage, index)
+		if err != nil {
+			return wrapRootSlabPathError(err, a.StorageID())
+		}
+	}
+
+	event := ChangeEvent{
+		Op:     op,
+		RootID: a.StorageID(),
+		Index:  index,
+		Old:    old,
+		New:    newStorable,
+	}
+
+	if a.journal != nil {
+		err := a.journal.record(a.Storage, event)
+		if err != nil {
+			return err
+		}
+	}
+	if a.changeSink != nil {
+		a.changeSink(event)
+	}
+	return nil
+}
+
+// SetChangeSink sets sink receiving element mutations of this OrderedMap
+// instance.  Sink isn't persisted, it only applies to this OrderedMap instance.
+// Nil sink disables change feed.
+func (m *OrderedMap) SetChangeSink(sink ChangeSink) {
+	m.changeSink = sink
+}
+
+// emitChange reports mutation of element with key to change sink and journal.  New element is read
+// back from storage since root slab operations don't return stored element.  It is called after
+// root is rebalanced, so error returned by journal doesn't leave root full or with one child slab.
+func (m *OrderedMap) emitChange(
+	op ChangeOperation,
+	digester Digester,
+	hkey Digest,
+	comparator ValueComparator,
+	key Value,
+	old Storable,
+) error {
+	if m.changeSink == nil && m.journal == nil {
+		return nil
+	}
+
+	var newStorable Storable
+	if op != ChangeRemove {
+		var err error
+		newStorable, err = m.root.Get(m.Storage, digester, 0, hkey, comparator, key)
+		if err != nil {
+			return wrapRootSlabPathError(err, m.StorageID())
+		}
+	}
+
+	event := ChangeEvent{
+		Op:     op,
+		RootID: m.StorageID(),
+		Key:    key,
+		Old:    old,
+		New:    newStorable,
+	}
+
+	if m.journal != nil {
+		err := m.journal.record(m.Storage, event)
+		if err != nil {
+			return err
+		}
+	}
+	if m.changeSink != nil {
+		m.changeSink(event)
+	}
+	return nil
+}
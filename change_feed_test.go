@@ -0,0 +1,132 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayChangeFeed(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	var events []ChangeEvent
+	array.SetChangeSink(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+
+	const arraySize = 256
+	for i := uint64(0); i < arraySize; i++ {
+		err = array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+	require.False(t, array.root.IsData())
+	require.Equal(t, arraySize, len(events))
+	for i, event := range events {
+		require.Equal(t, ChangeInsert, event.Op)
+		require.Equal(t, array.StorageID(), event.RootID)
+		require.Equal(t, uint64(i), event.Index)
+		require.Nil(t, event.Old)
+		require.Equal(t, Uint64Value(i), event.New)
+	}
+
+	events = nil
+
+	_, err = array.Set(10, Uint64Value(100))
+	require.NoError(t, err)
+
+	err = array.Insert(0, Uint64Value(200))
+	require.NoError(t, err)
+
+	_, err = array.Remove(1)
+	require.NoError(t, err)
+
+	require.Equal(t,
+		[]ChangeEvent{
+			{Op: ChangeSet, RootID: array.StorageID(), Index: 10, Old: Uint64Value(10), New: Uint64Value(100)},
+			{Op: ChangeInsert, RootID: array.StorageID(), Index: 0, New: Uint64Value(200)},
+			{Op: ChangeRemove, RootID: array.StorageID(), Index: 1, Old: Uint64Value(0)},
+		},
+		events,
+	)
+
+	// Failed mutations aren't reported.
+	events = nil
+
+	_, err = array.Set(arraySize, Uint64Value(0))
+	require.Error(t, err)
+
+	_, err = array.Remove(arraySize)
+	require.Error(t, err)
+
+	require.Equal(t, 0, len(events))
+
+	// Nil sink disables change feed.
+	array.SetChangeSink(nil)
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(events))
+}
+
+func TestMapChangeFeed(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	var events []ChangeEvent
+	m.SetChangeSink(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(10))
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(20))
+	require.NoError(t, err)
+
+	_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+
+	_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(1))
+	require.Error(t, err)
+
+	require.Equal(t,
+		[]ChangeEvent{
+			{Op: ChangeInsert, RootID: m.StorageID(), Key: Uint64Value(1), New: Uint64Value(10)},
+			{Op: ChangeSet, RootID: m.StorageID(), Key: Uint64Value(1), Old: Uint64Value(10), New: Uint64Value(20)},
+			{Op: ChangeRemove, RootID: m.StorageID(), Key: Uint64Value(1), Old: Uint64Value(20)},
+		},
+		events,
+	)
+}
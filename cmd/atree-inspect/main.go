@@ -0,0 +1,221 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// atree-inspect inspects slab stores for debugging.
+//
+// Usage:
+//
+//	atree-inspect [-storage name] -dsn dsn [-dry-run] command [storage id|n|file]
+//
+// Commands:
+//
+//	roots         list root slabs
+//	tree id       print slab tree of collection
+//	dump id       print elements of collection
+//	check         check storage health
+//	stats [id]    print stats of storage or collection
+//	report [n]    print n largest slabs, deepest collections and widest collision groups
+//	vacuum file   remove slabs not reachable from root slabs listed in file, one per line
+//	replay file   re-issue slab retrieves of trace file written by atree.Trace.WriteTo
+//
+// Elements are decoded as storables of the values package.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/values"
+)
+
+func main() {
+	var storageName string
+	var dsn string
+	var dryRun bool
+
+	flag.StringVar(&storageName, "storage", "dir", "base storage ("+strings.Join(inspect.BaseStorageNames(), ", ")+")")
+	flag.StringVar(&dsn, "dsn", "", "base storage data source, such as directory")
+	flag.BoolVar(&dryRun, "dry-run", false, "vacuum lists unreachable slabs without removing them")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] roots|tree|dump|check|stats|report|vacuum|replay [storage id|n|file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() < 1 || dsn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(storageName, dsn, dryRun, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(storageName string, dsn string, dryRun bool, args []string) error {
+	base, err := inspect.OpenBaseStorage(storageName, dsn)
+	if err != nil {
+		return err
+	}
+
+	inspector, err := inspect.NewInspector(base, values.DecodeStorable, nil)
+	if err != nil {
+		return err
+	}
+
+	command := args[0]
+
+	switch command {
+	case "roots":
+		roots, err := inspector.Roots()
+		if err != nil {
+			return err
+		}
+		for _, id := range roots {
+			fmt.Println(id)
+		}
+		return nil
+
+	case "check":
+		count, err := inspector.CheckHealth()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("ok: %d root slabs\n", count)
+		return nil
+
+	case "stats":
+		if len(args) < 2 {
+			return inspector.PrintStorageStats(os.Stdout)
+		}
+
+	case "report":
+		topN := 10
+		if len(args) > 1 {
+			topN, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid report size %q: %w", args[1], err)
+			}
+		}
+		return inspector.PrintReport(os.Stdout, topN)
+
+	case "vacuum":
+		if len(args) != 2 {
+			return fmt.Errorf("vacuum requires root list file")
+		}
+		roots, err := readStorageIDs(args[1])
+		if err != nil {
+			return err
+		}
+		result, err := inspector.Vacuum(roots, dryRun, func(id atree.StorageID) error {
+			fmt.Println(id)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		verb := "removed"
+		if dryRun {
+			verb = "would remove"
+		}
+		fmt.Printf("%s %d unreachable slabs, kept %d reachable slabs\n", verb, result.Unreachable, result.Reachable)
+		return nil
+
+	case "replay":
+		if len(args) != 2 {
+			return fmt.Errorf("replay requires trace file")
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		trace, err := atree.ReadTrace(f)
+		if err != nil {
+			return err
+		}
+		result, err := atree.ReplayTrace(base, trace, false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("retrieved %d slabs (%d bytes, %d missing) in %s\n",
+			result.Retrieves, result.BytesRetrieved, result.Missing, result.Duration)
+		return nil
+
+	case "tree", "dump":
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("%s requires storage id", command)
+	}
+
+	id, err := inspect.ParseStorageID(args[1])
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "tree":
+		return inspector.PrintTree(os.Stdout, id)
+	case "dump":
+		return inspector.DumpElements(os.Stdout, id)
+	default:
+		return inspector.PrintStats(os.Stdout, id)
+	}
+}
+
+// readStorageIDs reads storage IDs from file, one per line.
+// Empty lines are skipped.
+func readStorageIDs(name string) ([]atree.StorageID, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []atree.StorageID
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		id, err := inspect.ParseStorageID(line)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, scanner.Err()
+}
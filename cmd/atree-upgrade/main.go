@@ -0,0 +1,110 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// atree-upgrade re-encodes slabs reachable from all roots of a slab
+// store at the target encoding version.  Progress is recorded in the
+// checkpoint file, so an interrupted upgrade is resumed by running
+// the command again with the same checkpoint.
+//
+// Usage:
+//
+//	atree-upgrade [-storage name] -dsn dsn -checkpoint file [-workers n] [-version v]
+//
+// Elements are decoded as storables of the values package.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/upgrade"
+	"github.com/onflow/atree/values"
+)
+
+func main() {
+	var storageName string
+	var dsn string
+	var checkpointPath string
+	var workers int
+	var version uint
+
+	flag.StringVar(&storageName, "storage", "dir", "base storage ("+strings.Join(inspect.BaseStorageNames(), ", ")+")")
+	flag.StringVar(&dsn, "dsn", "", "base storage data source, such as directory")
+	flag.StringVar(&checkpointPath, "checkpoint", "", "checkpoint file recording upgraded roots")
+	flag.IntVar(&workers, "workers", 1, "number of roots upgraded concurrently")
+	flag.UintVar(&version, "version", upgrade.LatestEncodingVersion, "target encoding version")
+
+	flag.Parse()
+
+	if dsn == "" || checkpointPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(storageName, dsn, checkpointPath, workers, byte(version))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(storageName string, dsn string, checkpointPath string, workers int, version byte) error {
+	base, err := inspect.OpenBaseStorage(storageName, dsn)
+	if err != nil {
+		return err
+	}
+
+	inspector, err := inspect.NewInspector(base, values.DecodeStorable, nil)
+	if err != nil {
+		return err
+	}
+
+	roots, err := inspector.Roots()
+	if err != nil {
+		return err
+	}
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		return err
+	}
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		return err
+	}
+
+	upgrader, err := upgrade.NewUpgrader(base, encMode, decMode, values.DecodeStorable, inspect.DecodeRawTypeInfo, version)
+	if err != nil {
+		return err
+	}
+
+	checkpoint, err := upgrade.OpenFileCheckpoint(checkpointPath)
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Close()
+
+	stats, err := upgrader.Upgrade(roots, workers, checkpoint)
+	fmt.Printf("%+v\n", stats)
+	return err
+}
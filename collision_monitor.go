@@ -0,0 +1,88 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// CollisionGroupEvent describes a map collision group that was created or grew.
+type CollisionGroupEvent struct {
+	// Address is address of the map.
+	Address Address
+	// Level is number of leading digests shared by all elements in the
+	// collision group.  Level 1 means elements collided on the first digest.
+	Level int
+	// Count is number of elements in the collision group at this level.
+	// Nested collision groups are counted as one element.
+	Count uint32
+	// External is true if the collision group is stored in a separate slab.
+	External bool
+}
+
+// CollisionMonitor is notified when a map collision group is created or grows.
+// A large number of collisions, or collisions at deep digest levels, can
+// indicate a hash-flooding attempt.
+type CollisionMonitor interface {
+	OnCollisionGroup(CollisionGroupEvent)
+}
+
+// CollisionMonitorThresholds filters collision group events.
+// Only events meeting all thresholds are sent to CollisionMonitor.
+type CollisionMonitorThresholds struct {
+	// MinLevel is minimum collision group level to report.
+	MinLevel int
+	// MinCount is minimum collision group element count to report.
+	// A newly created collision group has 2 elements.
+	MinCount uint32
+}
+
+// WithCollisionMonitor returns StorageOption that sets monitor of
+// map collision groups created or grown by inserting new keys.
+func WithCollisionMonitor(monitor CollisionMonitor, thresholds CollisionMonitorThresholds) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.collisionMonitor = monitor
+		st.collisionMonitorThresholds = thresholds
+		return st
+	}
+}
+
+// collisionMonitorStorage is implemented by storage with collision monitor.
+type collisionMonitorStorage interface {
+	mapCollisionMonitor() (CollisionMonitor, CollisionMonitorThresholds)
+}
+
+func (s *PersistentSlabStorage) mapCollisionMonitor() (CollisionMonitor, CollisionMonitorThresholds) {
+	return s.collisionMonitor, s.collisionMonitorThresholds
+}
+
+// reportCollisionGroup notifies collision monitor of storage, if any, about collision group.
+func reportCollisionGroup(storage SlabStorage, event CollisionGroupEvent) {
+	s, ok := unwrapSlabStorage(storage).(collisionMonitorStorage)
+	if !ok {
+		return
+	}
+
+	monitor, thresholds := s.mapCollisionMonitor()
+	if monitor == nil {
+		return
+	}
+
+	if event.Level < thresholds.MinLevel || event.Count < thresholds.MinCount {
+		return
+	}
+
+	monitor.OnCollisionGroup(event)
+}
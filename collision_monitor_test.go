@@ -0,0 +1,134 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCollisionMonitor struct {
+	events []CollisionGroupEvent
+}
+
+func (m *testCollisionMonitor) OnCollisionGroup(event CollisionGroupEvent) {
+	m.events = append(m.events, event)
+}
+
+func TestMapCollisionMonitor(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("created and nested", func(t *testing.T) {
+		monitor := &testCollisionMonitor{}
+		storage := newTestPersistentStorage(t, WithCollisionMonitor(monitor, CollisionMonitorThresholds{}))
+
+		digesterBuilder := &mockDigesterBuilder{}
+
+		m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+		require.NoError(t, err)
+
+		digests := [][]Digest{
+			{1, 10},
+			{1, 20},
+			{1, 20},
+			{2, 0},
+		}
+
+		for i, d := range digests {
+			k := Uint64Value(i)
+			digesterBuilder.On("Digest", k).Return(mockDigester{d})
+
+			existingStorable, err := m.Set(compare, hashInputProvider, k, k)
+			require.NoError(t, err)
+			require.Nil(t, existingStorable)
+		}
+
+		// Overwriting existing key doesn't grow collision group.
+		existingStorable, err := m.Set(compare, hashInputProvider, Uint64Value(2), Uint64Value(0))
+		require.NoError(t, err)
+		require.NotNil(t, existingStorable)
+
+		require.Equal(t,
+			[]CollisionGroupEvent{
+				{Address: address, Level: 1, Count: 2},
+				{Address: address, Level: 2, Count: 2},
+			},
+			monitor.events,
+		)
+	})
+
+	t.Run("thresholds", func(t *testing.T) {
+		monitor := &testCollisionMonitor{}
+		storage := newTestPersistentStorage(t, WithCollisionMonitor(monitor, CollisionMonitorThresholds{MinLevel: 1, MinCount: 4}))
+
+		digesterBuilder := &mockDigesterBuilder{}
+
+		m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+		require.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			k := Uint64Value(i)
+			digesterBuilder.On("Digest", k).Return(mockDigester{[]Digest{1, Digest(i)}})
+
+			existingStorable, err := m.Set(compare, hashInputProvider, k, k)
+			require.NoError(t, err)
+			require.Nil(t, existingStorable)
+		}
+
+		require.Equal(t,
+			[]CollisionGroupEvent{
+				{Address: address, Level: 1, Count: 4},
+				{Address: address, Level: 1, Count: 5},
+			},
+			monitor.events,
+		)
+	})
+
+	t.Run("external", func(t *testing.T) {
+		const groupSize = 32
+
+		monitor := &testCollisionMonitor{}
+		storage := newTestPersistentStorage(t, WithCollisionMonitor(monitor, CollisionMonitorThresholds{}))
+
+		digesterBuilder := &mockDigesterBuilder{}
+
+		m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+		require.NoError(t, err)
+
+		for i := 0; i < groupSize; i++ {
+			k := Uint64Value(i)
+			digesterBuilder.On("Digest", k).Return(mockDigester{[]Digest{1, Digest(i)}})
+
+			existingStorable, err := m.Set(compare, hashInputProvider, k, NewStringValue(strings.Repeat("a", 64)))
+			require.NoError(t, err)
+			require.Nil(t, existingStorable)
+		}
+
+		require.Equal(t, groupSize-1, len(monitor.events))
+		require.False(t, monitor.events[0].External)
+
+		lastEvent := monitor.events[len(monitor.events)-1]
+		require.True(t, lastEvent.External)
+		require.Equal(t, uint32(groupSize), lastEvent.Count)
+	})
+}
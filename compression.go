@@ -0,0 +1,206 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBORTagCompressedStorable tags DEFLATE compressed encoding of storable
+// of StorableSlab.  Tag content is CBOR array of decompressed size and
+// byte string of compressed storable.  It is in range of CBOR tags
+// reserved by atree (see CBORTagReservedMin).
+const CBORTagCompressedStorable = 249
+
+// MaxDecompressedStorableSize is maximum byte size of compressed
+// storable after decompression.  Larger storables aren't compressed,
+// and compressed storables declaring larger size aren't decoded.
+const MaxDecompressedStorableSize = 64 << 20
+
+// compressedStorableHead is CBOR head of CBORTagCompressedStorable.
+var compressedStorableHead = []byte{0xd8, CBORTagCompressedStorable}
+
+const compressedStorableLength = 2
+
+// WithValueCompression compresses storables stored in separate slabs,
+// such as large map values, when their byte size is at least threshold.
+// Storables are compressed when they are committed to base storage and
+// decompressed when they are retrieved, so compression is transparent
+// to collections and values.  Storables that don't compress smaller are
+// stored uncompressed.  Decompression is metered as MeterStepDecompress.
+//
+// Compressed storables are decoded regardless of this option, so it can
+// be disabled without rewriting stored slabs.
+func WithValueCompression(threshold uint32) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.compressionThreshold = threshold
+		return st
+	}
+}
+
+// encodeSlab encodes slab to be committed to base storage.
+func (s *PersistentSlabStorage) encodeSlab(slab Slab) ([]byte, error) {
+	data, err := Encode(slab, s.cborEncMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.compressionThreshold == 0 {
+		return data, nil
+	}
+
+	var storable Storable
+	switch slab := slab.(type) {
+	case StorableSlab:
+		storable = slab.Storable
+	case *StorableSlab:
+		storable = slab.Storable
+	default:
+		return data, nil
+	}
+
+	if storable.ByteSize() < s.compressionThreshold ||
+		len(data)-versionAndFlagSize > MaxDecompressedStorableSize {
+		return data, nil
+	}
+
+	compressed, err := compressStorableSlab(data, s.cborEncMode)
+	if err != nil {
+		return nil, NewEncodingError(err)
+	}
+	if len(compressed) >= len(data) {
+		return data, nil
+	}
+	return compressed, nil
+}
+
+// compressStorableSlab returns encoded StorableSlab data with storable
+// replaced by tagged byte string of compressed storable.
+func compressStorableSlab(data []byte, encMode cbor.EncMode) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(data[versionAndFlagSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := encMode.Marshal([]interface{}{
+		uint64(len(data) - versionAndFlagSize),
+		buf.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := make([]byte, 0, versionAndFlagSize+len(compressedStorableHead)+len(content))
+	compressed = append(compressed, data[:versionAndFlagSize]...)
+	compressed = append(compressed, compressedStorableHead...)
+	compressed = append(compressed, content...)
+
+	return compressed, nil
+}
+
+// decompressedStorableSize returns decompressed size of storable if
+// slab data has compressed storable.
+func decompressedStorableSize(data []byte, decMode cbor.DecMode) (uint64, bool) {
+	if len(data) < versionAndFlagSize || getSlabType(data[1]) != slabStorable {
+		return 0, false
+	}
+	size, _, err := decodeCompressedStorable(data[versionAndFlagSize:], decMode)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// decodeCompressedStorable returns decompressed size and compressed bytes
+// of compressed storable.  It returns error if data isn't compressed
+// storable or decompressed size exceeds MaxDecompressedStorableSize.
+func decodeCompressedStorable(data []byte, decMode cbor.DecMode) (uint64, []byte, error) {
+	if !bytes.HasPrefix(data, compressedStorableHead) {
+		return 0, nil, fmt.Errorf("data isn't compressed storable")
+	}
+
+	dec := decMode.NewByteStreamDecoder(data[len(compressedStorableHead):])
+
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return 0, nil, err
+	}
+	if length != compressedStorableLength {
+		return 0, nil, fmt.Errorf("compressed storable has invalid length %d, want %d", length, compressedStorableLength)
+	}
+
+	size, err := dec.DecodeUint64()
+	if err != nil {
+		return 0, nil, err
+	}
+	if size > MaxDecompressedStorableSize {
+		return 0, nil, fmt.Errorf("compressed storable size %d exceeds maximum %d", size, MaxDecompressedStorableSize)
+	}
+
+	compressed, err := dec.DecodeBytes()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return size, compressed, nil
+}
+
+// decompressStorable returns encoded storable if data is compressed
+// storable, and data otherwise.  Decompressed storable is read up to its
+// recorded size, so corrupted data can't decompress to more bytes.
+func decompressStorable(data []byte, decMode cbor.DecMode) ([]byte, error) {
+	if !bytes.HasPrefix(data, compressedStorableHead) {
+		return data, nil
+	}
+
+	size, compressed, err := decodeCompressedStorable(data, decMode)
+	if err != nil {
+		return nil, err
+	}
+
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(decompressed)) != size {
+		return nil, fmt.Errorf("compressed storable has size %d, want %d", len(decompressed), size)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"compress/flate"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueCompression(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	r := newRand(t)
+
+	compressible := NewStringValue(strings.Repeat(`{"key":"value"},`, 500))
+	incompressible := NewStringValue(randStr(r, 8000))
+	small := NewStringValue(strings.Repeat("a", int(MaxInlineMapKeyOrValueSize)))
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage, WithValueCompression(1024))
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	values := []Value{compressible, incompressible, small}
+	for i, v := range values {
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(i), v)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, storage.FastCommit(2))
+
+	// Find stored slabs of values by their encoded storable.
+	stored := make(map[string][]byte)
+	for _, data := range baseStorage.segments {
+		slab, err := DecodeSlab(StorageIDUndefined, data, storage.cborDecMode, decodeStorable, decodeTypeInfo)
+		require.NoError(t, err)
+		if storableSlab, ok := slab.(StorableSlab); ok {
+			stored[storableSlab.Storable.(StringValue).str] = data
+		}
+	}
+	require.Equal(t, 3, len(stored))
+
+	isCompressed := func(data []byte) bool {
+		return bytes.HasPrefix(data[versionAndFlagSize:], compressedStorableHead)
+	}
+
+	require.True(t, isCompressed(stored[compressible.str]))
+	require.True(t, len(stored[compressible.str]) < len(compressible.str)/10)
+	require.False(t, isCompressed(stored[incompressible.str]))
+	require.False(t, isCompressed(stored[small.str]))
+
+	// Compressed values are read without compression option, and their
+	// decompression is metered.
+	meter := newTestMeter(0)
+	storage = newTestPersistentStorageWithBaseStorage(t, baseStorage, WithMeter(meter))
+
+	m, err = NewMapWithRootID(storage, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+
+	for i, v := range values {
+		storable, err := m.Get(compare, hashInputProvider, Uint64Value(i))
+		require.NoError(t, err)
+
+		value, err := storable.StoredValue(storage)
+		require.NoError(t, err)
+		require.Equal(t, v, value)
+	}
+
+	require.Equal(t, 1, meter.before[MeterStepDecompress])
+	require.Equal(t, 1, meter.after[MeterStepDecompress])
+}
+
+func TestDecompressStorable(t *testing.T) {
+
+	storage := newTestPersistentStorage(t)
+
+	storable := NewStringValue(strings.Repeat("a", 4096))
+	data, err := Encode(&StorableSlab{Storable: storable}, storage.cborEncMode)
+	require.NoError(t, err)
+
+	// compress returns compressed storable of encoded storable with
+	// recorded decompressed size.
+	compress := func(encoded []byte, size uint64) []byte {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		_, err = w.Write(encoded)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		content, err := storage.cborEncMode.Marshal([]interface{}{size, buf.Bytes()})
+		require.NoError(t, err)
+		return append(append([]byte(nil), compressedStorableHead...), content...)
+	}
+
+	encoded := data[versionAndFlagSize:]
+
+	t.Run("valid", func(t *testing.T) {
+		decompressed, err := decompressStorable(compress(encoded, uint64(len(encoded))), storage.cborDecMode)
+		require.NoError(t, err)
+		require.Equal(t, encoded, decompressed)
+	})
+
+	t.Run("larger than recorded size", func(t *testing.T) {
+		_, err := decompressStorable(compress(encoded, uint64(len(encoded))-1), storage.cborDecMode)
+		require.Error(t, err)
+	})
+
+	t.Run("smaller than recorded size", func(t *testing.T) {
+		_, err := decompressStorable(compress(encoded, uint64(len(encoded))+1), storage.cborDecMode)
+		require.Error(t, err)
+	})
+
+	t.Run("recorded size exceeds maximum", func(t *testing.T) {
+		_, err := decompressStorable(compress(encoded, MaxDecompressedStorableSize+1), storage.cborDecMode)
+		require.Error(t, err)
+	})
+
+	t.Run("uncompressed", func(t *testing.T) {
+		decompressed, err := decompressStorable(encoded, storage.cborDecMode)
+		require.NoError(t, err)
+		require.Equal(t, encoded, decompressed)
+	})
+}
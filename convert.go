@@ -0,0 +1,96 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// MapKeyExtractor returns map key of array element at index.
+type MapKeyExtractor func(index uint64, element Value) (key Value, err error)
+
+// NewMapFromArray returns a new map containing elements of array as values,
+// with keys returned by keyOf.  Use a keyOf returning index as value to
+// convert array to an index to value map.  It returns DuplicateKeyError
+// if keyOf returns the same key for more than one element.
+//
+// Array elements are streamed with array iterator.  New map is built
+// with Set because map batch builder requires elements in digest order.
+//
+// Nested collections aren't copied: new map references the same child
+// slabs as array, so array should be discarded without removing them.
+func NewMapFromArray(
+	array *Array,
+	address Address,
+	digesterBuilder DigesterBuilder,
+	typeInfo TypeInfo,
+	comparator ValueComparator,
+	hip HashInputProvider,
+	keyOf MapKeyExtractor,
+) (*OrderedMap, error) {
+
+	m, err := NewMap(array.Storage, address, digesterBuilder, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := array.Iterator()
+	if err != nil {
+		return nil, err
+	}
+
+	for index := uint64(0); ; index++ {
+		element, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if element == nil {
+			break
+		}
+
+		key, err := keyOf(index, element)
+		if err != nil {
+			return nil, err
+		}
+
+		existingStorable, err := m.Set(comparator, hip, key, element)
+		if err != nil {
+			return nil, err
+		}
+		if existingStorable != nil {
+			return nil, NewDuplicateKeyError(key)
+		}
+	}
+
+	return m, nil
+}
+
+// NewArrayFromMapValues returns a new array containing values of map
+// in map iteration order.  Map values are streamed with map iterator
+// into array batch builder.
+//
+// Nested collections aren't copied: new array references the same child
+// slabs as map, so map should be discarded without removing them.
+func NewArrayFromMapValues(m *OrderedMap, address Address, typeInfo TypeInfo) (*Array, error) {
+
+	iterator, err := m.Iterator()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewArrayFromBatchData(m.Storage, address, typeInfo, func() (Value, error) {
+		return iterator.NextValue()
+	})
+}
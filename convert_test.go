@@ -0,0 +1,142 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMapFromArray(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i * 10))
+		require.NoError(t, err)
+	}
+
+	t.Run("index keys", func(t *testing.T) {
+		mapTypeInfo := testTypeInfo{43}
+
+		m, err := NewMapFromArray(array, address, NewDefaultDigesterBuilder(), mapTypeInfo, compare, hashInputProvider,
+			func(index uint64, _ Value) (Value, error) {
+				return Uint64Value(index), nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, uint64(arraySize), m.Count())
+
+		for i := uint64(0); i < arraySize; i++ {
+			s, err := m.Get(compare, hashInputProvider, Uint64Value(i))
+			require.NoError(t, err)
+			require.Equal(t, Uint64Value(i*10), s)
+		}
+
+		err = ValidMap(m, mapTypeInfo, typeInfoComparator, hashInputProvider)
+		require.NoError(t, err)
+	})
+
+	t.Run("extracted keys", func(t *testing.T) {
+		m, err := NewMapFromArray(array, address, NewDefaultDigesterBuilder(), typeInfo, compare, hashInputProvider,
+			func(_ uint64, element Value) (Value, error) {
+				return NewStringValue(element.(Uint64Value).String()), nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, uint64(arraySize), m.Count())
+
+		s, err := m.Get(compare, hashInputProvider, NewStringValue("120"))
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(120), s)
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		_, err := NewMapFromArray(array, address, NewDefaultDigesterBuilder(), typeInfo, compare, hashInputProvider,
+			func(index uint64, _ Value) (Value, error) {
+				return Uint64Value(index % 10), nil
+			})
+		var duplicateKeyError *DuplicateKeyError
+		require.ErrorAs(t, err, &duplicateKeyError)
+	})
+}
+
+func TestNewArrayFromMapValues(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		existingStorable, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	// Expected values are in map iteration order.
+	var values []Value
+	err = m.IterateValues(func(v Value) (bool, error) {
+		values = append(values, v)
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	arrayTypeInfo := testTypeInfo{43}
+
+	array, err := NewArrayFromMapValues(m, address, arrayTypeInfo)
+	require.NoError(t, err)
+	require.Equal(t, uint64(mapSize), array.Count())
+
+	i := 0
+	err = array.Iterate(func(v Value) (bool, error) {
+		require.Equal(t, values[i], v)
+		i++
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, mapSize, i)
+
+	err = ValidArray(array, arrayTypeInfo, typeInfoComparator, hashInputProvider)
+	require.NoError(t, err)
+
+	// Empty map is converted to empty array.
+	emptyMap, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	emptyArray, err := NewArrayFromMapValues(emptyMap, address, arrayTypeInfo)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), emptyArray.Count())
+}
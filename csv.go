@@ -0,0 +1,150 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// CSVRecordEncoder converts array element to CSV record.
+type CSVRecordEncoder func(element Value) ([]string, error)
+
+// CSVRecordDecoder converts CSV record to array element.
+type CSVRecordDecoder func(record []string) (Value, error)
+
+// CSVMapRecordEncoder converts map element to CSV record.
+type CSVMapRecordEncoder func(key Value, value Value) ([]string, error)
+
+// CSVMapRecordDecoder converts CSV record to map element.
+type CSVMapRecordDecoder func(record []string) (key Value, value Value, err error)
+
+// ExportCSV writes array elements to w as CSV records converted by encode,
+// one record per element in array order.
+func (a *Array) ExportCSV(w io.Writer, encode CSVRecordEncoder) error {
+	cw := csv.NewWriter(w)
+
+	err := a.Iterate(func(element Value) (bool, error) {
+		record, err := encode(element)
+		if err != nil {
+			return false, err
+		}
+		return true, cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCSV writes map elements to w as CSV records converted by encode,
+// one record per element in map iteration order.
+func (m *OrderedMap) ExportCSV(w io.Writer, encode CSVMapRecordEncoder) error {
+	cw := csv.NewWriter(w)
+
+	err := m.Iterate(func(key Value, value Value) (bool, error) {
+		record, err := encode(key, value)
+		if err != nil {
+			return false, err
+		}
+		return true, cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// NewArrayFromCSV returns a new array with elements converted by decode
+// from CSV records in r.  Elements are bulk-loaded with NewArrayFromBatchData.
+// decode must not return nil Value.
+func NewArrayFromCSV(
+	storage SlabStorage,
+	address Address,
+	typeInfo TypeInfo,
+	r io.Reader,
+	decode CSVRecordDecoder,
+) (
+	*Array,
+	error,
+) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	return NewArrayFromBatchData(storage, address, typeInfo, func() (Value, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return decode(record)
+	})
+}
+
+// NewMapFromCSV returns a new map with elements converted by decode from
+// CSV records in r.  Elements are inserted with Set because CSV doesn't
+// preserve map seed required by NewMapFromBatchData.  Records with
+// duplicate keys overwrite values of earlier records.
+func NewMapFromCSV(
+	storage SlabStorage,
+	address Address,
+	digesterBuilder DigesterBuilder,
+	typeInfo TypeInfo,
+	comparator ValueComparator,
+	hip HashInputProvider,
+	r io.Reader,
+	decode CSVMapRecordDecoder,
+) (
+	*OrderedMap,
+	error,
+) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key, value, err := decode(record)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = m.Set(comparator, hip, key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
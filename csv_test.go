@@ -0,0 +1,127 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayCSV(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		v := Uint64Value(i)
+		values[i] = v
+		err := array.Append(v)
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	err = array.ExportCSV(&buf, func(element Value) ([]string, error) {
+		v := uint64(element.(Uint64Value))
+		return []string{strconv.FormatUint(v, 10), fmt.Sprintf("row %d", v)}, nil
+	})
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(buf.Bytes(), []byte("0,row 0\n1,row 1\n")))
+
+	storage2 := newTestPersistentStorage(t)
+
+	array2, err := NewArrayFromCSV(storage2, address, typeInfo, &buf, func(record []string) (Value, error) {
+		require.Equal(t, 2, len(record))
+		v, err := strconv.ParseUint(record[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return Uint64Value(v), nil
+	})
+	require.NoError(t, err)
+
+	verifyArray(t, storage2, typeInfo, address, array2, values, false)
+}
+
+func TestMapCSV(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := NewStringValue(fmt.Sprintf("k,%d", i))
+		v := Uint64Value(i)
+		keyValues[k] = v
+
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	var buf bytes.Buffer
+	err = m.ExportCSV(&buf, func(key Value, value Value) ([]string, error) {
+		return []string{key.(StringValue).str, strconv.FormatUint(uint64(value.(Uint64Value)), 10)}, nil
+	})
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorage(t)
+
+	m2, err := NewMapFromCSV(
+		storage2,
+		address,
+		NewDefaultDigesterBuilder(),
+		typeInfo,
+		compare,
+		hashInputProvider,
+		&buf,
+		func(record []string) (Value, Value, error) {
+			v, err := strconv.ParseUint(record[1], 10, 64)
+			if err != nil {
+				return nil, nil, err
+			}
+			return NewStringValue(record[0]), Uint64Value(v), nil
+		},
+	)
+	require.NoError(t, err)
+
+	verifyMap(t, storage2, typeInfo, address, m2, keyValues, nil, false)
+}
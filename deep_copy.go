@@ -0,0 +1,115 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// DeepCopyValue returns copy of v stored in dstStorage at dstAddress.
+// Arrays and maps are copied with all nested collections, streaming
+// elements from iterators into NewArrayFromBatchData and
+// NewMapFromBatchData.  Copied maps keep seed and digester builder of
+// the original map, so comparator and hip must be the ones used with it.
+// User metadata of copied collections is copied as well.
+//
+// SomeValue and TimestampedValue are copied with their wrapped values.
+// Other values are returned as is; they are stored in dstStorage by
+// Value.Storable when inserted into copied collections.
+func DeepCopyValue(
+	v Value,
+	dstStorage SlabStorage,
+	dstAddress Address,
+	comparator ValueComparator,
+	hip HashInputProvider,
+) (Value, error) {
+
+	switch v := v.(type) {
+	case *Array:
+		iterator, err := v.Iterator()
+		if err != nil {
+			return nil, err
+		}
+
+		array, err := NewArrayFromBatchData(dstStorage, dstAddress, v.Type(), func() (Value, error) {
+			element, err := iterator.Next()
+			if err != nil || element == nil {
+				return nil, err
+			}
+			return DeepCopyValue(element, dstStorage, dstAddress, comparator, hip)
+		}, WithUserMetadata(v.UserMetadata()))
+		if err != nil {
+			return nil, err
+		}
+
+		return array, nil
+
+	case *OrderedMap:
+		iterator, err := v.Iterator()
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := NewMapFromBatchData(
+			dstStorage,
+			dstAddress,
+			v.digesterBuilder,
+			v.Type(),
+			comparator,
+			hip,
+			v.Seed(),
+			func() (Value, Value, error) {
+				key, value, err := iterator.Next()
+				if err != nil || key == nil {
+					return nil, nil, err
+				}
+
+				key, err = DeepCopyValue(key, dstStorage, dstAddress, comparator, hip)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				value, err = DeepCopyValue(value, dstStorage, dstAddress, comparator, hip)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				return key, value, nil
+			},
+			WithUserMetadata(v.UserMetadata()),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return m, nil
+
+	case SomeValue:
+		wv, err := DeepCopyValue(v.Value, dstStorage, dstAddress, comparator, hip)
+		if err != nil {
+			return nil, err
+		}
+		return SomeValue{Value: wv}, nil
+
+	case TimestampedValue:
+		wv, err := DeepCopyValue(v.Value, dstStorage, dstAddress, comparator, hip)
+		if err != nil {
+			return nil, err
+		}
+		return TimestampedValue{Timestamp: v.Timestamp, Replica: v.Replica, Value: wv}, nil
+	}
+
+	return v, nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepCopyValue(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	srcStorage := newTestPersistentStorage(t)
+	srcAddress := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(srcStorage, srcAddress, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 20; i++ {
+		child, err := NewArray(srcStorage, srcAddress, typeInfo)
+		require.NoError(t, err)
+
+		for j := uint64(0); j < 200; j++ {
+			require.NoError(t, child.Append(Uint64Value(i*1000+j)))
+		}
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(i), child)
+		require.NoError(t, err)
+	}
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(100), SomeValue{Value: NewStringValue(strings.Repeat("a", 1024))})
+	require.NoError(t, err)
+
+	// collect returns elements of value with nested collections converted
+	// to Go slices and maps.
+	var collect func(v Value) interface{}
+	collect = func(v Value) interface{} {
+		switch v := v.(type) {
+		case *Array:
+			var elements []interface{}
+			err := v.Iterate(func(element Value) (bool, error) {
+				elements = append(elements, collect(element))
+				return true, nil
+			})
+			require.NoError(t, err)
+			return elements
+
+		case *OrderedMap:
+			elements := make(map[interface{}]interface{})
+			err := v.Iterate(func(key Value, value Value) (bool, error) {
+				elements[collect(key)] = collect(value)
+				return true, nil
+			})
+			require.NoError(t, err)
+			return elements
+		}
+		return v
+	}
+
+	expected := collect(m)
+
+	dstStorage := newTestPersistentStorage(t)
+	dstAddress := Address{8, 7, 6, 5, 4, 3, 2, 1}
+
+	copied, err := DeepCopyValue(m, dstStorage, dstAddress, compare, hashInputProvider)
+	require.NoError(t, err)
+
+	copiedMap, ok := copied.(*OrderedMap)
+	require.True(t, ok)
+	require.Equal(t, dstAddress, copiedMap.Address())
+	require.Equal(t, m.Seed(), copiedMap.Seed())
+	require.Equal(t, expected, collect(copiedMap))
+
+	// Mutating original doesn't affect copy.
+	v, err := m.Get(compare, hashInputProvider, Uint64Value(0))
+	require.NoError(t, err)
+
+	child, err := v.StoredValue(srcStorage)
+	require.NoError(t, err)
+
+	_, err = child.(*Array).Remove(0)
+	require.NoError(t, err)
+
+	require.Equal(t, expected, collect(copiedMap))
+
+	// All slabs of copy are committed to destination at destination address.
+	require.NoError(t, dstStorage.Commit())
+
+	for id := range dstStorage.baseStorage.(*InMemBaseStorage).segments {
+		require.Equal(t, dstAddress, id.Address)
+	}
+
+	reopenedStorage := newTestPersistentStorageWithBaseStorage(t, dstStorage.baseStorage)
+
+	reopened, err := NewMapWithRootID(reopenedStorage, copiedMap.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, expected, collect(reopened))
+}
@@ -0,0 +1,195 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// DeepRemover removes slabs of a collection and of everything reachable
+// from it (nested collections and external element slabs) in batches.
+// Slabs are walked iteratively with an explicit list of pending slabs,
+// so removal of deeply nested collections doesn't grow the call stack.
+//
+// A slab is removed only after its children are added to pending slabs,
+// so removal interrupted between batches can be resumed with
+// NewDeepRemover using Pending slabs of the previous remover.
+//
+// Collections shared with AddReference aren't removed, one reference
+// to them is dropped instead.
+type DeepRemover struct {
+	storage  SlabStorage
+	pending  []StorageID
+	removed  uint64
+	released uint64
+}
+
+// NewDeepRemover returns DeepRemover removing given slabs and slabs
+// reachable from them.
+func NewDeepRemover(storage SlabStorage, pending []StorageID) *DeepRemover {
+	return &DeepRemover{
+		storage: storage,
+		pending: append([]StorageID(nil), pending...),
+	}
+}
+
+// DeepRemover returns DeepRemover removing array and its nested elements.
+// Array can't be used after removal is started.
+func (a *Array) DeepRemover() *DeepRemover {
+	return NewDeepRemover(a.Storage, []StorageID{a.StorageID()})
+}
+
+// DeepRemover returns DeepRemover removing map and its nested elements.
+// Map can't be used after removal is started.
+func (m *OrderedMap) DeepRemover() *DeepRemover {
+	return NewDeepRemover(m.Storage, []StorageID{m.StorageID()})
+}
+
+// Step removes up to maxSlabs slabs, or all slabs if maxSlabs is 0.
+// It returns true when there are no pending slabs left.
+func (r *DeepRemover) Step(maxSlabs int) (done bool, err error) {
+	for n := 0; len(r.pending) > 0 && (maxSlabs == 0 || n < maxSlabs); n++ {
+		id := r.pending[len(r.pending)-1]
+
+		slab, found, err := r.storage.Retrieve(id)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			return false, NewSlabNotFoundErrorf(id, "slab not found during deep removal")
+		}
+
+		r.pending = r.pending[:len(r.pending)-1]
+
+		shared, err := releaseSharedSlab(r.storage, slab)
+		if err != nil {
+			return false, err
+		}
+		if shared {
+			r.released++
+			continue
+		}
+
+		r.pending = appendChildSlabIDs(r.pending, slab.ChildStorables())
+
+		if id, ok := insertionOrderSlabID(slab); ok {
+			r.pending = append(r.pending, id)
+		}
+
+		err = r.storage.Remove(id)
+		if err != nil {
+			return false, err
+		}
+		r.removed++
+	}
+
+	return len(r.pending) == 0, nil
+}
+
+// Removed returns number of slabs removed by this remover.
+func (r *DeepRemover) Removed() uint64 {
+	return r.removed
+}
+
+// Released returns number of references dropped to shared collections,
+// which aren't removed because they are still referenced elsewhere.
+func (r *DeepRemover) Released() uint64 {
+	return r.released
+}
+
+// Pending returns slabs left to be removed, including slabs
+// reachable from them.
+func (r *DeepRemover) Pending() []StorageID {
+	return append([]StorageID(nil), r.pending...)
+}
+
+func appendChildSlabIDs(ids []StorageID, storables []Storable) []StorageID {
+	for _, storable := range storables {
+		if id, ok := storable.(StorageIDStorable); ok {
+			ids = append(ids, StorageID(id))
+			continue
+		}
+		ids = appendChildSlabIDs(ids, storable.ChildStorables())
+	}
+	return ids
+}
+
+// DeepRemoveProgressFunc is called by DeepRemove after each batch with
+// number of removed slabs and number of slabs known to be pending.
+// Returning false stops removal.
+type DeepRemoveProgressFunc func(removed uint64, pending int) (resume bool)
+
+// DeepRemove removes array with all nested collections and external
+// element slabs, removing at most batchSize slabs between progress calls.
+// If progress stops removal, returned DeepRemover resumes it.  Returned
+// DeepRemover is nil when removal is complete.
+func (a *Array) DeepRemove(batchSize int, progress DeepRemoveProgressFunc) (*DeepRemover, error) {
+	return deepRemove(a.DeepRemover(), batchSize, progress)
+}
+
+// DeepRemove removes map with all nested collections and external
+// element slabs, removing at most batchSize slabs between progress calls.
+// If progress stops removal, returned DeepRemover resumes it.  Returned
+// DeepRemover is nil when removal is complete.
+func (m *OrderedMap) DeepRemove(batchSize int, progress DeepRemoveProgressFunc) (*DeepRemover, error) {
+	return deepRemove(m.DeepRemover(), batchSize, progress)
+}
+
+// RemoveAll removes collections with given root slabs owned by address,
+// such as all collections of a deleted account, with their nested
+// collections and external element slabs.  Collections are removed in
+// the given order, removing at most batchSize slabs between progress
+// calls, so removal can be spread over several transactions.  If progress
+// stops removal, returned DeepRemover resumes it.  Returned DeepRemover
+// is nil when removal is complete.
+func RemoveAll(
+	storage SlabStorage,
+	address Address,
+	roots []StorageID,
+	batchSize int,
+	progress DeepRemoveProgressFunc,
+) (*DeepRemover, error) {
+	for _, id := range roots {
+		if id.Address != address {
+			return nil, NewStorageIDErrorf("root slab %s isn't owned by address 0x%x", id, address[:])
+		}
+	}
+
+	// Pending slabs are removed from the end, so roots are reversed.
+	pending := make([]StorageID, len(roots))
+	for i, id := range roots {
+		pending[len(roots)-1-i] = id
+	}
+
+	return deepRemove(NewDeepRemover(storage, pending), batchSize, progress)
+}
+
+func deepRemove(r *DeepRemover, batchSize int, progress DeepRemoveProgressFunc) (*DeepRemover, error) {
+	for {
+		done, err := r.Step(batchSize)
+		if err != nil {
+			return r, err
+		}
+
+		resume := progress == nil || progress(r.removed, len(r.pending))
+
+		if done {
+			return nil, nil
+		}
+		if !resume {
+			return r, nil
+		}
+	}
+}
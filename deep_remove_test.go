@@ -0,0 +1,185 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepRemove(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// newNestedMap returns map of arrays, with a large string stored in
+	// external slab, committed to storage.
+	newNestedMap := func(t *testing.T, storage *PersistentSlabStorage) *OrderedMap {
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 20; i++ {
+			child, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+
+			for j := uint64(0); j < 200; j++ {
+				require.NoError(t, child.Append(Uint64Value(j)))
+			}
+
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), child)
+			require.NoError(t, err)
+		}
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(100), NewStringValue(strings.Repeat("a", 1024)))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Commit())
+		return m
+	}
+
+	t.Run("all", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+		m := newNestedMap(t, storage)
+
+		slabCount := storage.Count()
+		require.True(t, slabCount > 40)
+
+		var batches int
+		var lastRemoved uint64
+		remover, err := m.DeepRemove(10, func(removed uint64, pending int) bool {
+			require.True(t, removed-lastRemoved <= 10)
+			lastRemoved = removed
+			batches++
+			return true
+		})
+		require.NoError(t, err)
+		require.Nil(t, remover)
+		require.Equal(t, uint64(slabCount), lastRemoved)
+		require.Equal(t, (slabCount+9)/10, batches)
+
+		require.NoError(t, storage.Commit())
+		require.Equal(t, 0, len(storage.baseStorage.(*InMemBaseStorage).segments))
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+		m := newNestedMap(t, storage)
+
+		slabCount := storage.Count()
+
+		remover, err := m.DeepRemove(5, func(removed uint64, pending int) bool {
+			return false
+		})
+		require.NoError(t, err)
+		require.NotNil(t, remover)
+		require.Equal(t, uint64(5), remover.Removed())
+
+		require.NoError(t, storage.Commit())
+		require.Equal(t, slabCount-5, storage.Count())
+
+		// Resume with pending slabs in a new remover.
+		resumed := NewDeepRemover(storage, remover.Pending())
+
+		done, err := resumed.Step(0)
+		require.NoError(t, err)
+		require.True(t, done)
+		require.Equal(t, uint64(slabCount-5), resumed.Removed())
+
+		require.NoError(t, storage.Commit())
+		require.Equal(t, 0, len(storage.baseStorage.(*InMemBaseStorage).segments))
+	})
+
+	t.Run("remove all", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		roots := []StorageID{
+			newNestedMap(t, storage).StorageID(),
+			newNestedMap(t, storage).StorageID(),
+		}
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		roots = append(roots, array.StorageID())
+
+		require.NoError(t, storage.Commit())
+		slabCount := storage.Count()
+
+		// Roots must be owned by address.
+		otherAddress := Address{8, 7, 6, 5, 4, 3, 2, 1}
+		_, err = RemoveAll(storage, otherAddress, roots, 10, nil)
+		var storageIDError *StorageIDError
+		require.ErrorAs(t, err, &storageIDError)
+
+		// Stop after first batch and resume.
+		remover, err := RemoveAll(storage, address, roots, 10, func(removed uint64, pending int) bool {
+			return false
+		})
+		require.NoError(t, err)
+		require.NotNil(t, remover)
+		require.Equal(t, uint64(10), remover.Removed())
+
+		// First root is removed first.
+		_, found, err := storage.Retrieve(roots[0])
+		require.NoError(t, err)
+		require.False(t, found)
+
+		var lastRemoved uint64
+		remover, err = RemoveAll(storage, address, remover.Pending(), 10, func(removed uint64, pending int) bool {
+			require.True(t, removed-lastRemoved <= 10)
+			lastRemoved = removed
+			return true
+		})
+		require.NoError(t, err)
+		require.Nil(t, remover)
+		require.Equal(t, uint64(slabCount-10), lastRemoved)
+
+		require.NoError(t, storage.Commit())
+		require.Equal(t, 0, len(storage.baseStorage.(*InMemBaseStorage).segments))
+	})
+
+	t.Run("array", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		// Deeply nested arrays.
+		parent := array
+		for i := 0; i < 100; i++ {
+			child, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, parent.Append(child))
+			parent = child
+		}
+
+		require.NoError(t, storage.Commit())
+
+		remover, err := array.DeepRemove(0, nil)
+		require.NoError(t, err)
+		require.Nil(t, remover)
+
+		require.NoError(t, storage.Commit())
+		require.Equal(t, 0, len(storage.baseStorage.(*InMemBaseStorage).segments))
+	})
+}
@@ -0,0 +1,202 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// SlabChangeType is type of slab change reported by DiffStorages.
+type SlabChangeType uint8
+
+const (
+	SlabAdded SlabChangeType = iota
+	SlabRemoved
+	SlabChanged
+)
+
+func (t SlabChangeType) String() string {
+	switch t {
+	case SlabAdded:
+		return "added"
+	case SlabRemoved:
+		return "removed"
+	case SlabChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("SlabChangeType(%d)", uint8(t))
+	}
+}
+
+// SlabChange is a slab added, removed, or changed between two storages.
+// OldSize and NewSize are encoded sizes of slab, which are zero for
+// added and removed slabs respectively.
+type SlabChange struct {
+	ID      StorageID
+	Type    SlabChangeType
+	OldSize int
+	NewSize int
+}
+
+// ByteDelta returns change of encoded slab size.
+func (c SlabChange) ByteDelta() int {
+	return c.NewSize - c.OldSize
+}
+
+// StorageDiff is result of DiffStorages.
+type StorageDiff struct {
+	// Changes are changed slabs sorted by storage ID.
+	Changes []SlabChange
+	// Unchanged is number of slabs with the same encoding in both storages.
+	Unchanged int
+}
+
+// ByteDelta returns change of total encoded size of slabs.
+func (d StorageDiff) ByteDelta() int {
+	delta := 0
+	for _, c := range d.Changes {
+		delta += c.ByteDelta()
+	}
+	return delta
+}
+
+// DiffStorages reports slabs added, removed, or changed from old to new
+// storage, among slabs reachable from roots, e.g. to decide what an
+// incremental backup must copy or to verify an upgrade.  Slabs are
+// compared by their encoding with encMode.  Roots missing in a storage
+// have no reachable slabs there, so slabs of a new root are added and
+// slabs of a removed root are removed.
+func DiffStorages(oldStorage SlabStorage, newStorage SlabStorage, roots []StorageID, encMode cbor.EncMode) (StorageDiff, error) {
+	return diffSlabs(oldStorage.Retrieve, newStorage.Retrieve, roots, encMode)
+}
+
+// DiffDeltas reports slabs added, removed, or changed by uncommitted
+// deltas, among slabs reachable from roots.  Committed slabs are read
+// from base storage, because cached slabs are modified in place.
+func (s *PersistentSlabStorage) DiffDeltas(roots []StorageID) (StorageDiff, error) {
+	retrieveCommitted := func(id StorageID) (Slab, bool, error) {
+		data, found, err := s.baseStorage.Retrieve(id)
+		if err != nil {
+			return nil, found, NewStorageError(err)
+		}
+		if !found {
+			return nil, false, nil
+		}
+		slab, err := DecodeSlab(id, data, s.cborDecMode, s.DecodeStorable, s.DecodeTypeInfo)
+		if err != nil {
+			return nil, found, NewStorageError(err)
+		}
+		return slab, true, nil
+	}
+
+	return diffSlabs(retrieveCommitted, s.Retrieve, roots, s.cborEncMode)
+}
+
+type retrieveFunc func(StorageID) (Slab, bool, error)
+
+func diffSlabs(retrieveOld retrieveFunc, retrieveNew retrieveFunc, roots []StorageID, encMode cbor.EncMode) (StorageDiff, error) {
+
+	oldSlabs, err := encodeReachableSlabs(retrieveOld, roots, encMode)
+	if err != nil {
+		return StorageDiff{}, err
+	}
+
+	newSlabs, err := encodeReachableSlabs(retrieveNew, roots, encMode)
+	if err != nil {
+		return StorageDiff{}, err
+	}
+
+	var diff StorageDiff
+
+	for id, newData := range newSlabs {
+		oldData, ok := oldSlabs[id]
+		switch {
+		case !ok:
+			diff.Changes = append(diff.Changes, SlabChange{ID: id, Type: SlabAdded, NewSize: len(newData)})
+		case string(oldData) != string(newData):
+			diff.Changes = append(diff.Changes, SlabChange{ID: id, Type: SlabChanged, OldSize: len(oldData), NewSize: len(newData)})
+		default:
+			diff.Unchanged++
+		}
+	}
+
+	for id, oldData := range oldSlabs {
+		if _, ok := newSlabs[id]; !ok {
+			diff.Changes = append(diff.Changes, SlabChange{ID: id, Type: SlabRemoved, OldSize: len(oldData)})
+		}
+	}
+
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].ID.Compare(diff.Changes[j].ID) < 0
+	})
+
+	return diff, nil
+}
+
+// encodeReachableSlabs returns encoded slabs reachable from roots.
+// Missing roots are skipped.
+func encodeReachableSlabs(retrieve retrieveFunc, roots []StorageID, encMode cbor.EncMode) (map[StorageID][]byte, error) {
+	slabs := make(map[StorageID][]byte)
+
+	for _, root := range roots {
+		_, found, err := retrieve(root)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		pending := []StorageID{root}
+
+		for len(pending) > 0 {
+			id := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+
+			if _, ok := slabs[id]; ok {
+				continue
+			}
+
+			slab, found, err := retrieve(id)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, NewSlabNotFoundErrorf(id, "slab not found during diff")
+			}
+
+			data, err := Encode(slab, encMode)
+			if err != nil {
+				return nil, err
+			}
+			slabs[id] = data
+
+			pending = appendChildSlabIDs(pending, slab.ChildStorables())
+
+			if id, ok := insertionOrderSlabID(slab); ok {
+				pending = append(pending, id)
+			}
+		}
+	}
+
+	return slabs, nil
+}
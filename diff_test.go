@@ -0,0 +1,136 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStorages(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 400; i++ {
+		require.NoError(t, array.Append(Uint64Value(i)))
+	}
+
+	require.NoError(t, storage.Commit())
+
+	root := array.StorageID()
+
+	t.Run("no change", func(t *testing.T) {
+		diff, err := storage.DiffDeltas([]StorageID{root})
+		require.NoError(t, err)
+		require.Empty(t, diff.Changes)
+		require.True(t, diff.Unchanged > 1)
+		require.Equal(t, 0, diff.ByteDelta())
+	})
+
+	t.Run("deltas", func(t *testing.T) {
+		defer storage.DropDeltas()
+		defer storage.DropCache()
+
+		before, err := storage.DiffDeltas([]StorageID{root})
+		require.NoError(t, err)
+
+		// Set last element, which changes last data slab and its parent.
+		_, err = array.Set(array.Count()-1, Uint64Value(1<<40))
+		require.NoError(t, err)
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, child.Append(Uint64Value(0)))
+
+		diff, err := storage.DiffDeltas([]StorageID{root, child.StorageID()})
+		require.NoError(t, err)
+
+		var changed, added int
+		for _, c := range diff.Changes {
+			switch c.Type {
+			case SlabChanged:
+				changed++
+			case SlabAdded:
+				added++
+				require.Equal(t, child.StorageID(), c.ID)
+				require.Equal(t, 0, c.OldSize)
+			}
+		}
+		require.True(t, changed > 0)
+		require.Equal(t, 1, added)
+		require.Equal(t, before.Unchanged, diff.Unchanged+changed)
+		require.Equal(t, len(diff.Changes), changed+added)
+		require.True(t, diff.ByteDelta() > 0)
+	})
+
+	t.Run("storages", func(t *testing.T) {
+		oldStorage := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		// Copy base storage, then remove array from copy.
+		baseStorage := NewInMemBaseStorage()
+		for id, data := range storage.baseStorage.(*InMemBaseStorage).segments {
+			require.NoError(t, baseStorage.Store(id, data))
+		}
+		newStorage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+		array, err := NewArrayWithRootID(newStorage, root)
+		require.NoError(t, err)
+
+		for array.Count() > 100 {
+			_, err = array.Remove(array.Count() - 1)
+			require.NoError(t, err)
+		}
+		require.NoError(t, newStorage.Commit())
+
+		diff, err := DiffStorages(oldStorage, newStorage, []StorageID{root}, storage.cborEncMode)
+		require.NoError(t, err)
+
+		var removed int
+		for i, c := range diff.Changes {
+			if i > 0 {
+				require.True(t, diff.Changes[i-1].ID.Compare(c.ID) < 0)
+			}
+			if c.Type == SlabRemoved {
+				removed++
+				require.Equal(t, 0, c.NewSize)
+				require.True(t, c.OldSize > 0)
+			}
+		}
+		require.True(t, removed > 0)
+		require.True(t, diff.ByteDelta() < 0)
+
+		// Removed root has only removed slabs.
+		diff, err = DiffStorages(oldStorage, newTestPersistentStorage(t), []StorageID{root}, storage.cborEncMode)
+		require.NoError(t, err)
+		require.Equal(t, 0, diff.Unchanged)
+		for _, c := range diff.Changes {
+			require.Equal(t, SlabRemoved, c.Type)
+		}
+	})
+}
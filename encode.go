@@ -93,8 +93,23 @@ func DecodeSlab(
 			return nil, NewDecodingErrorf("data has invalid flag 0x%x", flag)
 		}
 
+	case slabRegistry:
+
+		switch registryType := getSlabRegistryType(flag); registryType {
+		case slabRegistryTypeInfo:
+			return newTypeInfoRegistrySlabFromData(id, data, decMode, decodeTypeInfo)
+		case slabRegistryRoot:
+			return newRootRegistrySlabFromData(id, data, decMode)
+		default:
+			return nil, NewDecodingErrorf("data has invalid flag 0x%x", flag)
+		}
+
 	case slabStorable:
-		cborDec := decMode.NewByteStreamDecoder(data[versionAndFlagSize:])
+		storableData, err := decompressStorable(data[versionAndFlagSize:], decMode)
+		if err != nil {
+			return nil, NewDecodingError(err)
+		}
+		cborDec := decMode.NewByteStreamDecoder(storableData)
 		storable, err := decodeStorable(cborDec, id)
 		if err != nil {
 			return nil, NewDecodingError(err)
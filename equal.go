@@ -0,0 +1,135 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"reflect"
+)
+
+// EqualValues returns true if a and b are semantically equal.  Arrays
+// are equal if they have equal type info (compared with cmp) and equal
+// elements in the same order.  Maps are equal if they have equal type
+// info and equal key-value pairs, regardless of iteration order.  Nested
+// arrays and maps are compared recursively.  Other values are compared
+// with Equal if they are Equatable, and with reflect.DeepEqual otherwise.
+// Keys of maps are looked up using comparator and hip.
+//
+// Storage IDs and addresses aren't compared, so a collection is equal
+// to its copy in another account.  Error is returned only if elements
+// can't be read from storage.
+func EqualValues(a Value, b Value, cmp TypeInfoComparator, comparator ValueComparator, hip HashInputProvider) (bool, error) {
+	switch a := a.(type) {
+	case *Array:
+		array, ok := b.(*Array)
+		if !ok {
+			return false, nil
+		}
+		return equalArrays(a, array, cmp, comparator, hip)
+
+	case *OrderedMap:
+		m, ok := b.(*OrderedMap)
+		if !ok {
+			return false, nil
+		}
+		return equalMaps(a, m, cmp, comparator, hip)
+
+	case Equatable:
+		other, ok := b.(Storable)
+		if !ok {
+			return false, nil
+		}
+		return a.Equal(other), nil
+
+	default:
+		return reflect.DeepEqual(a, b), nil
+	}
+}
+
+func equalArrays(a *Array, b *Array, cmp TypeInfoComparator, comparator ValueComparator, hip HashInputProvider) (bool, error) {
+	if a.Count() != b.Count() || !cmp(a.Type(), b.Type()) {
+		return false, nil
+	}
+
+	iterator1, err := a.Iterator()
+	if err != nil {
+		return false, err
+	}
+
+	iterator2, err := b.Iterator()
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		value1, err := iterator1.Next()
+		if err != nil {
+			return false, err
+		}
+
+		value2, err := iterator2.Next()
+		if err != nil {
+			return false, err
+		}
+
+		if value1 == nil || value2 == nil {
+			return value1 == nil && value2 == nil, nil
+		}
+
+		equal, err := EqualValues(value1, value2, cmp, comparator, hip)
+		if err != nil || !equal {
+			return false, err
+		}
+	}
+}
+
+func equalMaps(a *OrderedMap, b *OrderedMap, cmp TypeInfoComparator, comparator ValueComparator, hip HashInputProvider) (bool, error) {
+	if a.Count() != b.Count() || !cmp(a.Type(), b.Type()) {
+		return false, nil
+	}
+
+	// Maps with different seeds iterate the same elements in different
+	// order, so keys of a are looked up in b.  Maps have the same number
+	// of unique keys, so b has no other keys if all keys of a are found.
+	equal := true
+	err := a.Iterate(func(key Value, value Value) (bool, error) {
+		storable, err := b.Get(comparator, hip, key)
+		if err != nil {
+			var keyNotFoundError *KeyNotFoundError
+			if errors.As(err, &keyNotFoundError) {
+				equal = false
+				return false, nil
+			}
+			return false, err
+		}
+
+		other, err := storable.StoredValue(b.Storage)
+		if err != nil {
+			return false, err
+		}
+
+		equal, err = EqualValues(value, other, cmp, comparator, hip)
+		return equal && err == nil, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return equal, nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEqualValues(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+
+	newMap := func(address Address, typeInfo TypeInfo) *OrderedMap {
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 10; i++ {
+			child, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+
+			for j := uint64(0); j < 200; j++ {
+				require.NoError(t, child.Append(Uint64Value(i*1000+j)))
+			}
+
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), child)
+			require.NoError(t, err)
+		}
+
+		return m
+	}
+
+	m1 := newMap(Address{1, 2, 3, 4, 5, 6, 7, 8}, typeInfo)
+
+	t.Run("equal", func(t *testing.T) {
+		m2 := newMap(Address{8, 7, 6, 5, 4, 3, 2, 1}, typeInfo)
+
+		equal, err := EqualValues(m1, m2, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.True(t, equal)
+
+		equal, err = EqualValues(Uint64Value(1), Uint64Value(1), typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.True(t, equal)
+	})
+
+	t.Run("different nested element", func(t *testing.T) {
+		m2 := newMap(Address{8, 7, 6, 5, 4, 3, 2, 1}, typeInfo)
+
+		storable, err := m2.Get(compare, hashInputProvider, Uint64Value(5))
+		require.NoError(t, err)
+
+		child, err := storable.StoredValue(storage)
+		require.NoError(t, err)
+
+		_, err = child.(*Array).Set(150, Uint64Value(0))
+		require.NoError(t, err)
+
+		equal, err := EqualValues(m1, m2, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.False(t, equal)
+	})
+
+	t.Run("different type info", func(t *testing.T) {
+		m2 := newMap(Address{8, 7, 6, 5, 4, 3, 2, 1}, testTypeInfo{43})
+
+		equal, err := EqualValues(m1, m2, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.False(t, equal)
+	})
+
+	t.Run("different count", func(t *testing.T) {
+		m2 := newMap(Address{8, 7, 6, 5, 4, 3, 2, 1}, typeInfo)
+
+		_, _, err := m2.Remove(compare, hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+
+		equal, err := EqualValues(m1, m2, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.False(t, equal)
+	})
+
+	t.Run("different key", func(t *testing.T) {
+		m2 := newMap(Address{8, 7, 6, 5, 4, 3, 2, 1}, typeInfo)
+
+		_, value, err := m2.Remove(compare, hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+
+		_, err = m2.Set(compare, hashInputProvider, Uint64Value(100), storableValue{value})
+		require.NoError(t, err)
+
+		equal, err := EqualValues(m1, m2, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.False(t, equal)
+	})
+
+	t.Run("different kind", func(t *testing.T) {
+		array, err := NewArray(storage, Address{1, 2, 3, 4, 5, 6, 7, 8}, typeInfo)
+		require.NoError(t, err)
+
+		equal, err := EqualValues(m1, array, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.False(t, equal)
+
+		equal, err = EqualValues(Uint64Value(1), array, typeInfoComparator, compare, hashInputProvider)
+		require.NoError(t, err)
+		require.False(t, equal)
+	})
+}
+
+// equatableValue is Uint64Value with scratch state ignored by Equal.
+type equatableValue struct {
+	Uint64Value
+	scratch []byte
+}
+
+func (v equatableValue) Equal(other Storable) bool {
+	o, ok := other.(equatableValue)
+	return ok && v.Uint64Value == o.Uint64Value
+}
+
+func TestEquatable(t *testing.T) {
+	a := equatableValue{Uint64Value: 1, scratch: []byte{1}}
+	b := equatableValue{Uint64Value: 1}
+
+	never := func(Storable, Storable) bool { return false }
+	require.True(t, storableEqual(a, b, never))
+	require.False(t, storableEqual(Uint64Value(1), Uint64Value(1), never))
+
+	equal, err := EqualValues(a, b, typeInfoComparator, compare, hashInputProvider)
+	require.NoError(t, err)
+	require.True(t, equal)
+
+	equal, err = EqualValues(a, equatableValue{Uint64Value: 2}, typeInfoComparator, compare, hashInputProvider)
+	require.NoError(t, err)
+	require.False(t, equal)
+}
@@ -19,10 +19,15 @@
 package atree
 
 import (
+	"errors"
 	"fmt"
 	"runtime/debug"
+	"strings"
 )
 
+// FatalError wraps errors indicating that storage or collection state
+// is corrupted or inconsistent, such as missing slabs or decoding failures.
+// Collections and storage shouldn't be used after FatalError.
 type FatalError struct {
 	err error
 }
@@ -37,6 +42,40 @@ func (e *FatalError) Error() string {
 
 func (e *FatalError) Unwrap() error { return e.err }
 
+// UserError wraps errors caused by invalid input, such as out-of-bounds
+// index or missing key.  State isn't modified by operation returning
+// UserError, so collections and storage can be used after UserError.
+type UserError struct {
+	err error
+}
+
+func NewUserError(err error) error {
+	return &UserError{err: err}
+}
+
+func (e *UserError) Error() string {
+	return e.err.Error()
+}
+
+func (e *UserError) Unwrap() error { return e.err }
+
+// IsFatalError returns true if err is or wraps FatalError.
+func IsFatalError(err error) bool {
+	var fatalError *FatalError
+	return errors.As(err, &fatalError)
+}
+
+// IsUserError returns true if err is or wraps UserError and isn't fatal.
+// Errors that are neither user errors nor fatal errors are external
+// errors, such as errors returned by callbacks and base storage.
+func IsUserError(err error) bool {
+	if IsFatalError(err) {
+		return false
+	}
+	var userError *UserError
+	return errors.As(err, &userError)
+}
+
 // SliceOutOfBoundsError is returned when index for array slice is out of bounds.
 type SliceOutOfBoundsError struct {
 	startIndex uint64
@@ -75,6 +114,7 @@ type IndexOutOfBoundsError struct {
 	index uint64
 	min   uint64
 	max   uint64
+	id    StorageID
 }
 
 // NewIndexOutOfBoundsError constructs a IndexOutOfBoundsError
@@ -83,9 +123,38 @@ func NewIndexOutOfBoundsError(index, min, max uint64) *IndexOutOfBoundsError {
 }
 
 func (e *IndexOutOfBoundsError) Error() string {
+	if e.id != StorageIDUndefined {
+		return fmt.Sprintf("index %d is outside required range (%d-%d) of array %s", e.index, e.min, e.max, e.id)
+	}
 	return fmt.Sprintf("index %d is outside required range (%d-%d)", e.index, e.min, e.max)
 }
 
+// Index returns the offending index.
+func (e *IndexOutOfBoundsError) Index() uint64 { return e.index }
+
+// Min returns the minimum valid index.
+func (e *IndexOutOfBoundsError) Min() uint64 { return e.min }
+
+// Max returns the bound of valid indexes, which is the element count of the array.
+func (e *IndexOutOfBoundsError) Max() uint64 { return e.max }
+
+// StorageID returns storage ID of the array, or StorageIDUndefined if unknown.
+func (e *IndexOutOfBoundsError) StorageID() StorageID { return e.id }
+
+// withIndexOutOfBoundsContext sets index, range, and array ID of
+// IndexOutOfBoundsError in err, replacing index relative to slab
+// with index of the array.  Errors of other arrays are unchanged.
+func withIndexOutOfBoundsContext(err error, id StorageID, index uint64, count uint64) error {
+	var e *IndexOutOfBoundsError
+	if errors.As(err, &e) && e.id == StorageIDUndefined {
+		e.index = index
+		e.min = 0
+		e.max = count
+		e.id = id
+	}
+	return err
+}
+
 // MaxArraySizeError is returned when an insert or delete operation is attempted on an array which has reached maximum size
 type MaxArraySizeError struct {
 	maxLen uint64
@@ -139,7 +208,7 @@ type DuplicateKeyError struct {
 }
 
 func NewDuplicateKeyError(key interface{}) error {
-	return &DuplicateKeyError{key: key}
+	return NewUserError(&DuplicateKeyError{key: key})
 }
 
 func (e *DuplicateKeyError) Error() string {
@@ -148,7 +217,9 @@ func (e *DuplicateKeyError) Error() string {
 
 // KeyNotFoundError is returned when the key not found in the dictionary
 type KeyNotFoundError struct {
-	key interface{}
+	key   interface{}
+	count uint64
+	id    StorageID
 }
 
 // NewKeyNotFoundError constructs a KeyNotFoundError
@@ -157,9 +228,228 @@ func NewKeyNotFoundError(key interface{}) *KeyNotFoundError {
 }
 
 func (e *KeyNotFoundError) Error() string {
+	if e.id != StorageIDUndefined {
+		return fmt.Sprintf("key (%s) not found in map %s with %d elements", e.key, e.id, e.count)
+	}
 	return fmt.Sprintf("key (%s) not found", e.key)
 }
 
+// Key returns the key that wasn't found.
+func (e *KeyNotFoundError) Key() interface{} { return e.key }
+
+// Count returns element count of the map.
+func (e *KeyNotFoundError) Count() uint64 { return e.count }
+
+// StorageID returns storage ID of the map, or StorageIDUndefined if unknown.
+func (e *KeyNotFoundError) StorageID() StorageID { return e.id }
+
+// withKeyNotFoundContext sets element count and map ID of KeyNotFoundError
+// in err.  Errors of other maps are unchanged.
+func withKeyNotFoundContext(err error, id StorageID, count uint64) error {
+	var e *KeyNotFoundError
+	if errors.As(err, &e) && e.id == StorageIDUndefined {
+		e.count = count
+		e.id = id
+	}
+	return err
+}
+
+// ReadOnlyError is returned when a mutating operation is attempted on read-only storage or collection.
+type ReadOnlyError struct {
+	id StorageID
+}
+
+// NewReadOnlyError constructs a ReadOnlyError
+func NewReadOnlyError(id StorageID) error {
+	return NewUserError(&ReadOnlyError{id: id})
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("slab (%s) is read-only", e.id)
+}
+
+// SnapshotReleasedError is returned when a released storage snapshot is used.
+type SnapshotReleasedError struct {
+	version uint64
+}
+
+// NewSnapshotReleasedError constructs a SnapshotReleasedError
+func NewSnapshotReleasedError(version uint64) error {
+	return NewUserError(&SnapshotReleasedError{version: version})
+}
+
+func (e *SnapshotReleasedError) Error() string {
+	return fmt.Sprintf("storage snapshot (version %d) is released", e.version)
+}
+
+// SnapshotNotSupportedError is returned when snapshot is requested
+// from storage that can't take snapshots.
+type SnapshotNotSupportedError struct {
+	storageType string
+}
+
+// NewSnapshotNotSupportedError constructs a SnapshotNotSupportedError
+func NewSnapshotNotSupportedError(storage SlabStorage) error {
+	return NewUserError(&SnapshotNotSupportedError{storageType: fmt.Sprintf("%T", storage)})
+}
+
+func (e *SnapshotNotSupportedError) Error() string {
+	return fmt.Sprintf("storage %s doesn't support snapshots", e.storageType)
+}
+
+// VersionNotFoundError is returned when requested storage version
+// doesn't exist or is pruned.
+type VersionNotFoundError struct {
+	version uint64
+}
+
+// NewVersionNotFoundError constructs a VersionNotFoundError
+func NewVersionNotFoundError(version uint64) error {
+	return NewUserError(&VersionNotFoundError{version: version})
+}
+
+func (e *VersionNotFoundError) Error() string {
+	return fmt.Sprintf("storage version %d not found", e.version)
+}
+
+// PatchConflictError is returned when precondition of patch operation
+// doesn't hold for collection being patched.
+type PatchConflictError struct {
+	opIndex int
+	reason  string
+}
+
+// NewPatchConflictError constructs a PatchConflictError
+func NewPatchConflictError(opIndex int, reason string) error {
+	return NewUserError(&PatchConflictError{opIndex: opIndex, reason: reason})
+}
+
+func (e *PatchConflictError) Error() string {
+	return fmt.Sprintf("patch operation %d conflicts: %s", e.opIndex, e.reason)
+}
+
+// OpIndex returns index of conflicting operation in patch.
+func (e *PatchConflictError) OpIndex() int {
+	return e.opIndex
+}
+
+// MergeConflictError is returned when map merge can't resolve
+// different values of the same key.
+type MergeConflictError struct {
+	key    Value
+	reason string
+}
+
+// NewMergeConflictError constructs a MergeConflictError
+func NewMergeConflictError(key Value, reason string) error {
+	return NewUserError(&MergeConflictError{key: key, reason: reason})
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("failed to merge key %s: %s", e.key, e.reason)
+}
+
+// InvalidMoveError is returned when nested collection can't be
+// detached from its parent or attached to a new parent.
+type InvalidMoveError struct {
+	id     StorageID
+	reason string
+}
+
+// NewInvalidMoveError constructs an InvalidMoveError
+func NewInvalidMoveError(id StorageID, reason string) error {
+	return NewUserError(&InvalidMoveError{id: id, reason: reason})
+}
+
+func (e *InvalidMoveError) Error() string {
+	return fmt.Sprintf("failed to move collection (%s): %s", e.id, e.reason)
+}
+
+// MaxNestingDepthError is returned when inserting element would nest
+// collections deeper than maximum nesting depth of storage.
+type MaxNestingDepthError struct {
+	id       StorageID
+	maxDepth int
+}
+
+// NewMaxNestingDepthError constructs a MaxNestingDepthError
+func NewMaxNestingDepthError(id StorageID, maxDepth int) error {
+	return NewUserError(&MaxNestingDepthError{id: id, maxDepth: maxDepth})
+}
+
+func (e *MaxNestingDepthError) Error() string {
+	return fmt.Sprintf("element of collection (%s) exceeds maximum nesting depth %d", e.id, e.maxDepth)
+}
+
+// CollectionLimitError is returned when mutation is rejected because
+// collection reached its element count or byte size limit.
+type CollectionLimitError struct {
+	id    StorageID
+	limit string
+	max   uint64
+}
+
+// NewCollectionLimitError constructs a CollectionLimitError
+func NewCollectionLimitError(id StorageID, limit string, max uint64) error {
+	return NewUserError(&CollectionLimitError{id: id, limit: limit, max: max})
+}
+
+func (e *CollectionLimitError) Error() string {
+	return fmt.Sprintf("collection (%s) reached maximum %s %d", e.id, e.limit, e.max)
+}
+
+// MaxUserMetadataSizeError is returned when user metadata exceeds
+// MaxUserMetadataSize.
+type MaxUserMetadataSizeError struct {
+	size int
+}
+
+// NewMaxUserMetadataSizeError constructs a MaxUserMetadataSizeError
+func NewMaxUserMetadataSizeError(size int) error {
+	return NewUserError(&MaxUserMetadataSizeError{size: size})
+}
+
+func (e *MaxUserMetadataSizeError) Error() string {
+	return fmt.Sprintf("user metadata size %d exceeds maximum %d", e.size, MaxUserMetadataSize)
+}
+
+// StaleCursorError is returned when budgeted iteration cursor was
+// returned before collection was mutated.
+type StaleCursorError struct {
+	id             StorageID
+	cursorSequence uint64
+	sequence       uint64
+}
+
+// NewStaleCursorError constructs a StaleCursorError
+func NewStaleCursorError(id StorageID, cursorSequence uint64, sequence uint64) error {
+	return NewUserError(&StaleCursorError{id: id, cursorSequence: cursorSequence, sequence: sequence})
+}
+
+func (e *StaleCursorError) Error() string {
+	return fmt.Sprintf(
+		"cursor of collection (%s) is at mutation sequence %d, collection is at mutation sequence %d",
+		e.id,
+		e.cursorSequence,
+		e.sequence,
+	)
+}
+
+// MaxProvenanceCreatorSizeError is returned when provenance creator tag
+// exceeds MaxProvenanceCreatorSize.
+type MaxProvenanceCreatorSizeError struct {
+	size int
+}
+
+// NewMaxProvenanceCreatorSizeError constructs a MaxProvenanceCreatorSizeError
+func NewMaxProvenanceCreatorSizeError(size int) error {
+	return NewUserError(&MaxProvenanceCreatorSizeError{size: size})
+}
+
+func (e *MaxProvenanceCreatorSizeError) Error() string {
+	return fmt.Sprintf("provenance creator size %d exceeds maximum %d", e.size, MaxProvenanceCreatorSize)
+}
+
 // HashSeedUninitializedError is a fatal error returned when hash seed is uninitialized.
 type HashSeedUninitializedError struct {
 }
@@ -206,6 +496,225 @@ func (e *StorageIDError) Error() string {
 	return fmt.Sprintf("storage id error: %s", e.msg)
 }
 
+// DigesterTypeError is returned when map digester type is unsupported or
+// doesn't match digester type recorded in map extra data.
+type DigesterTypeError struct {
+	msg string
+}
+
+// NewDigesterTypeErrorf constructs a DigesterTypeError
+func NewDigesterTypeErrorf(msg string, args ...interface{}) *DigesterTypeError {
+	return &DigesterTypeError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *DigesterTypeError) Error() string {
+	return fmt.Sprintf("digester type error: %s", e.msg)
+}
+
+// DigesterKeyError is returned when map digester key is invalid or unavailable.
+type DigesterKeyError struct {
+	msg string
+}
+
+// NewDigesterKeyErrorf constructs a DigesterKeyError
+func NewDigesterKeyErrorf(msg string, args ...interface{}) *DigesterKeyError {
+	return &DigesterKeyError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *DigesterKeyError) Error() string {
+	return fmt.Sprintf("digester key error: %s", e.msg)
+}
+
+// TypeInfoRegistryError is returned when type info can't be registered
+// or registered type info reference can't be resolved.
+type TypeInfoRegistryError struct {
+	msg string
+}
+
+// NewTypeInfoRegistryErrorf constructs a TypeInfoRegistryError
+func NewTypeInfoRegistryErrorf(msg string, args ...interface{}) *TypeInfoRegistryError {
+	return &TypeInfoRegistryError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *TypeInfoRegistryError) Error() string {
+	return fmt.Sprintf("type info registry error: %s", e.msg)
+}
+
+// IncompatibleTypeInfoError is returned when collection type info
+// can't be changed to new type info.
+type IncompatibleTypeInfoError struct {
+	oldTypeInfo TypeInfo
+	newTypeInfo TypeInfo
+}
+
+// NewIncompatibleTypeInfoError constructs an IncompatibleTypeInfoError
+func NewIncompatibleTypeInfoError(oldTypeInfo TypeInfo, newTypeInfo TypeInfo) error {
+	return NewUserError(&IncompatibleTypeInfoError{oldTypeInfo: oldTypeInfo, newTypeInfo: newTypeInfo})
+}
+
+func (e *IncompatibleTypeInfoError) Error() string {
+	return fmt.Sprintf("type info %v is incompatible with %v", e.newTypeInfo, e.oldTypeInfo)
+}
+
+// InvalidElementError is returned when ElementValidator rejects an element.
+type InvalidElementError struct {
+	err error
+}
+
+// NewInvalidElementError constructs an InvalidElementError
+func NewInvalidElementError(err error) error {
+	return NewUserError(&InvalidElementError{err: err})
+}
+
+func (e *InvalidElementError) Error() string {
+	return fmt.Sprintf("invalid element: %s", e.err.Error())
+}
+
+// Unwrap returns the wrapped err
+func (e *InvalidElementError) Unwrap() error { return e.err }
+
+// JSONError is returned when JSON data can't be converted to collection.
+type JSONError struct {
+	msg string
+}
+
+// NewJSONErrorf constructs a JSONError
+func NewJSONErrorf(msg string, args ...interface{}) *JSONError {
+	return &JSONError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("json error: %s", e.msg)
+}
+
+// MigrationError is returned when in-place migration can't proceed.
+type MigrationError struct {
+	msg string
+}
+
+// NewMigrationErrorf constructs a MigrationError
+func NewMigrationErrorf(msg string, args ...interface{}) *MigrationError {
+	return &MigrationError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration error: %s", e.msg)
+}
+
+// BackupError is returned when backup stream can't be written or restored.
+type BackupError struct {
+	msg string
+}
+
+// NewBackupErrorf constructs a BackupError
+func NewBackupErrorf(msg string, args ...interface{}) *BackupError {
+	return &BackupError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *BackupError) Error() string {
+	return fmt.Sprintf("backup error: %s", e.msg)
+}
+
+// TransactionError is returned when storage transaction can't be
+// started, ended, or rolled back.
+type TransactionError struct {
+	msg string
+}
+
+// NewTransactionErrorf constructs a TransactionError
+func NewTransactionErrorf(msg string, args ...interface{}) *TransactionError {
+	return &TransactionError{msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *TransactionError) Error() string {
+	return fmt.Sprintf("transaction error: %s", e.msg)
+}
+
+// MeterError is returned when Meter vetoes an operation step.  Like
+// errors returned by other callbacks, it is neither UserError nor
+// FatalError: steps vetoed after mutation started, such as slab split,
+// can leave the operation partially applied.
+type MeterError struct {
+	Step MeterStep
+	err  error
+}
+
+// NewMeterError constructs a MeterError
+func NewMeterError(step MeterStep, err error) *MeterError {
+	return &MeterError{Step: step, err: err}
+}
+
+func (e *MeterError) Error() string {
+	return fmt.Sprintf("meter error: %s step vetoed: %s", e.Step, e.err.Error())
+}
+
+// Unwrap returns the wrapped err
+func (e *MeterError) Unwrap() error { return e.err }
+
+// SlabPathElement is a metadata slab on path from root slab to
+// the slab being processed, and index of child slab on the path.
+type SlabPathElement struct {
+	ID         StorageID
+	ChildIndex int
+}
+
+// SlabPathError wraps fatal error with the location where it occurred:
+// collection root ID, ID of slab being processed, and path of metadata
+// slabs from root to that slab.  Path element i is at level i.
+type SlabPathError struct {
+	RootID StorageID
+	SlabID StorageID
+	Path   []SlabPathElement
+	err    error
+}
+
+func (e *SlabPathError) Error() string {
+	var sb strings.Builder
+	for _, p := range e.Path {
+		fmt.Fprintf(&sb, "%s[%d]/", p.ID, p.ChildIndex)
+	}
+	sb.WriteString(e.SlabID.String())
+	return fmt.Sprintf("collection %s slab %s (path %s): %s", e.RootID, e.SlabID, sb.String(), e.err.Error())
+}
+
+// Unwrap returns the wrapped err
+func (e *SlabPathError) Unwrap() error { return e.err }
+
+// wrapSlabPathError adds child slab of metadata slab parentID to path of
+// fatal err.  Non-fatal errors are returned unchanged.
+func wrapSlabPathError(err error, parentID StorageID, childIndex int, childID StorageID) error {
+	if !IsFatalError(err) {
+		return err
+	}
+	pathElement := SlabPathElement{ID: parentID, ChildIndex: childIndex}
+	if e, ok := err.(*SlabPathError); ok {
+		e.Path = append([]SlabPathElement{pathElement}, e.Path...)
+		return e
+	}
+	return &SlabPathError{
+		SlabID: childID,
+		Path:   []SlabPathElement{pathElement},
+		err:    err,
+	}
+}
+
+// wrapRootSlabPathError sets collection root ID of fatal err.
+// Non-fatal errors are returned unchanged.
+func wrapRootSlabPathError(err error, rootID StorageID) error {
+	if !IsFatalError(err) {
+		return err
+	}
+	if e, ok := err.(*SlabPathError); ok {
+		e.RootID = rootID
+		return e
+	}
+	return &SlabPathError{
+		RootID: rootID,
+		SlabID: rootID,
+		err:    err,
+	}
+}
+
 // StorageError is always a fatal error returned when storage fails
 type StorageError struct {
 	err error
@@ -0,0 +1,245 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorTaxonomy(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("user error", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		_, err = array.Get(0)
+		require.True(t, IsUserError(err))
+		require.False(t, IsFatalError(err))
+
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		_, err = m.Get(compare, hashInputProvider, Uint64Value(0))
+		require.True(t, IsUserError(err))
+		require.False(t, IsFatalError(err))
+
+		var keyNotFoundError *KeyNotFoundError
+		require.ErrorAs(t, err, &keyNotFoundError)
+
+		_, err = array.RangeIterator(0, 1)
+		require.True(t, IsUserError(err))
+
+		var sliceOutOfBoundsError *SliceOutOfBoundsError
+		require.ErrorAs(t, err, &sliceOutOfBoundsError)
+
+		err = storage.CommitTransaction()
+		require.True(t, IsUserError(err))
+
+		var transactionError *TransactionError
+		require.ErrorAs(t, err, &transactionError)
+
+		// Constructors return concrete types, which are classified
+		// where they are returned.
+		var _ *KeyNotFoundError = NewKeyNotFoundError(Uint64Value(0))
+		var _ *IndexOutOfBoundsError = NewIndexOutOfBoundsError(0, 0, 0)
+	})
+
+	t.Run("fatal error", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		_, err := NewArrayWithRootID(storage, NewStorageID(address, StorageIndex{1}))
+		require.True(t, IsFatalError(err))
+		require.False(t, IsUserError(err))
+
+		var slabNotFoundError *SlabNotFoundError
+		require.ErrorAs(t, err, &slabNotFoundError)
+
+		// Fatal error wrapping user error is fatal.
+		err = NewFatalError(NewDuplicateKeyError(Uint64Value(0)))
+		require.True(t, IsFatalError(err))
+		require.False(t, IsUserError(err))
+	})
+
+	t.Run("external error", func(t *testing.T) {
+		err := errors.New("external")
+		require.False(t, IsFatalError(err))
+		require.False(t, IsUserError(err))
+	})
+}
+
+func TestSlabPathError(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 4096
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Find path to data slab containing last element.
+	var path []SlabPathElement
+	var slab ArraySlab = array.root
+	for !slab.IsData() {
+		meta := slab.(*ArrayMetaDataSlab)
+		childIndex := len(meta.childrenHeaders) - 1
+		path = append(path, SlabPathElement{ID: meta.header.id, ChildIndex: childIndex})
+		slab, err = getArraySlab(storage, meta.childrenHeaders[childIndex].id)
+		require.NoError(t, err)
+	}
+	require.True(t, len(path) > 1)
+
+	dataSlabID := slab.ID()
+
+	// Remove data slab from base storage and reopen array.
+	baseStorage := storage.baseStorage.(*InMemBaseStorage)
+	delete(baseStorage.segments, dataSlabID)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	array2, err := NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+
+	_, err = array2.Get(arraySize - 1)
+	require.True(t, IsFatalError(err))
+
+	var slabPathError *SlabPathError
+	require.ErrorAs(t, err, &slabPathError)
+	require.Equal(t, array.StorageID(), slabPathError.RootID)
+	require.Equal(t, dataSlabID, slabPathError.SlabID)
+	require.Equal(t, path, slabPathError.Path)
+
+	var slabNotFoundError *SlabNotFoundError
+	require.ErrorAs(t, err, &slabNotFoundError)
+
+	// User errors aren't wrapped.
+	_, err = array2.Get(arraySize)
+	require.False(t, errors.As(err, &slabPathError))
+}
+
+func TestOutOfBoundsAndKeyNotFoundErrors(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const size = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("array", func(t *testing.T) {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < size; i++ {
+			err := array.Append(Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		var e *IndexOutOfBoundsError
+
+		_, err = array.Get(size + 5)
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, uint64(size+5), e.Index())
+		require.Equal(t, uint64(0), e.Min())
+		require.Equal(t, uint64(size), e.Max())
+		require.Equal(t, array.StorageID(), e.StorageID())
+
+		_, err = array.Set(size, Uint64Value(0))
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, uint64(size), e.Index())
+		require.Equal(t, array.StorageID(), e.StorageID())
+
+		err = array.Insert(size+1, Uint64Value(0))
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, uint64(size+1), e.Index())
+
+		_, err = array.Remove(size)
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, uint64(size), e.Index())
+		require.Equal(t, uint64(size), e.Max())
+	})
+
+	t.Run("basic array", func(t *testing.T) {
+		array, err := NewBasicArray(storage, address)
+		require.NoError(t, err)
+
+		err = array.Append(Uint64Value(0))
+		require.NoError(t, err)
+
+		var e *IndexOutOfBoundsError
+
+		_, err = array.Get(1)
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, uint64(1), e.Index())
+		require.Equal(t, uint64(1), e.Max())
+		require.Equal(t, array.StorageID(), e.StorageID())
+
+		_, err = array.Remove(3)
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, uint64(3), e.Index())
+	})
+
+	t.Run("map", func(t *testing.T) {
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < size; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		var e *KeyNotFoundError
+
+		_, err = m.Get(compare, hashInputProvider, Uint64Value(size))
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, Uint64Value(size), e.Key())
+		require.Equal(t, uint64(size), e.Count())
+		require.Equal(t, m.StorageID(), e.StorageID())
+
+		_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(size))
+		require.ErrorAs(t, err, &e)
+		require.Equal(t, Uint64Value(size), e.Key())
+		require.Equal(t, m.StorageID(), e.StorageID())
+	})
+}
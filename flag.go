@@ -25,6 +25,7 @@ const (
 	slabArray
 	slabMap
 	slabStorable
+	slabRegistry
 )
 
 type slabArrayType int
@@ -37,6 +38,14 @@ const (
 	slabBasicArray
 )
 
+type slabRegistryType int
+
+const (
+	slabRegistryUndefined slabRegistryType = iota
+	slabRegistryTypeInfo
+	slabRegistryRoot
+)
+
 type slabMapType int
 
 const (
@@ -65,6 +74,10 @@ const (
 	// maskLargeMapEntry  byte = 0b000_01010 // not used for now
 	maskCollisionGroup byte = 0b000_01011
 
+	// Registry flags: 3 low bits (4th bit is 1, 5th bit is 0)
+	maskTypeInfoRegistry byte = 0b000_10000
+	maskRootRegistry     byte = 0b000_10001
+
 	// Storable flags: 3 low bits (4th bit is 1, 5th bit is 1)
 	maskStorable byte = 0b000_11111
 )
@@ -103,6 +116,9 @@ func getSlabType(f byte) slabType {
 	case 1:
 		// 4th bit is 0 and 5th bit is 1.
 		return slabMap
+	case 2:
+		// 4th bit is 1 and 5th bit is 0.
+		return slabRegistry
 	case 3:
 		// 4th and 5th bit are 1.
 		return slabStorable
@@ -152,3 +168,20 @@ func getSlabMapType(f byte) slabMapType {
 		return slabMapUndefined
 	}
 }
+
+func getSlabRegistryType(f byte) slabRegistryType {
+	if getSlabType(f) != slabRegistry {
+		return slabRegistryUndefined
+	}
+
+	// Extract 3 low bits for slab registry type.
+	dataType := (f & byte(0b000_00111))
+	switch dataType {
+	case 0:
+		return slabRegistryTypeInfo
+	case 1:
+		return slabRegistryRoot
+	default:
+		return slabRegistryUndefined
+	}
+}
@@ -78,10 +78,26 @@ func TestFlagGetSlabType(t *testing.T) {
 		arrayFlag := byte(i) & 0b111_00111
 		mapFlag := arrayFlag | 0b000_01000
 		storableFlag := mapFlag | 0b000_11111
+		registryFlag := arrayFlag | 0b000_10000
 
 		require.Equal(t, slabArray, getSlabType(arrayFlag))
 		require.Equal(t, slabMap, getSlabType(mapFlag))
 		require.Equal(t, slabStorable, getSlabType(storableFlag))
+		require.Equal(t, slabRegistry, getSlabType(registryFlag))
+	}
+}
+
+func TestFlagGetSlabRegistryType(t *testing.T) {
+	for i := 0; i <= 255; i++ {
+		typeInfoRegistryFlag := byte(i)&0b111_00000 | 0b000_10000
+		rootRegistryFlag := typeInfoRegistryFlag | 0b000_00001
+		undefinedFlag := typeInfoRegistryFlag | 0b000_00010
+		mapFlag := byte(i)&0b111_00000 | 0b000_01000
+
+		require.Equal(t, slabRegistryTypeInfo, getSlabRegistryType(typeInfoRegistryFlag))
+		require.Equal(t, slabRegistryRoot, getSlabRegistryType(rootRegistryFlag))
+		require.Equal(t, slabRegistryUndefined, getSlabRegistryType(undefinedFlag))
+		require.Equal(t, slabRegistryUndefined, getSlabRegistryType(mapFlag))
 	}
 }
 
@@ -0,0 +1,175 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// FrozenArray is a read-only view of Array.  Mutating methods
+// return ReadOnlyError.  Changes made through the underlying Array
+// are visible in the view.
+//
+// Child collections read through the view aren't frozen.
+type FrozenArray struct {
+	array *Array
+}
+
+// Freeze returns a read-only view of the array.
+func (a *Array) Freeze() *FrozenArray {
+	return &FrozenArray{array: a}
+}
+
+func (a *FrozenArray) Get(index uint64) (Storable, error) {
+	return a.array.Get(index)
+}
+
+func (a *FrozenArray) Set(_ uint64, _ Value) (Storable, error) {
+	return nil, NewReadOnlyError(a.StorageID())
+}
+
+func (a *FrozenArray) Append(_ Value) error {
+	return NewReadOnlyError(a.StorageID())
+}
+
+func (a *FrozenArray) Insert(_ uint64, _ Value) error {
+	return NewReadOnlyError(a.StorageID())
+}
+
+func (a *FrozenArray) Remove(_ uint64) (Storable, error) {
+	return nil, NewReadOnlyError(a.StorageID())
+}
+
+func (a *FrozenArray) PopIterate(_ ArrayPopIterationFunc) error {
+	return NewReadOnlyError(a.StorageID())
+}
+
+func (a *FrozenArray) SetType(_ TypeInfo, _ TypeInfoCompatibilityChecker) error {
+	return NewReadOnlyError(a.StorageID())
+}
+
+func (a *FrozenArray) Iterator() (*ArrayIterator, error) {
+	return a.array.Iterator()
+}
+
+func (a *FrozenArray) RangeIterator(startIndex uint64, endIndex uint64) (*ArrayIterator, error) {
+	return a.array.RangeIterator(startIndex, endIndex)
+}
+
+func (a *FrozenArray) Iterate(fn ArrayIterationFunc) error {
+	return a.array.Iterate(fn)
+}
+
+func (a *FrozenArray) IterateRange(startIndex uint64, endIndex uint64, fn ArrayIterationFunc) error {
+	return a.array.IterateRange(startIndex, endIndex, fn)
+}
+
+func (a *FrozenArray) Count() uint64 {
+	return a.array.Count()
+}
+
+func (a *FrozenArray) StorageID() StorageID {
+	return a.array.StorageID()
+}
+
+func (a *FrozenArray) Address() Address {
+	return a.array.Address()
+}
+
+func (a *FrozenArray) Type() TypeInfo {
+	return a.array.Type()
+}
+
+func (a *FrozenArray) String() string {
+	return a.array.String()
+}
+
+// FrozenMap is a read-only view of OrderedMap.  Mutating methods
+// return ReadOnlyError.  Changes made through the underlying OrderedMap
+// are visible in the view.
+//
+// Child collections read through the view aren't frozen.
+type FrozenMap struct {
+	m *OrderedMap
+}
+
+// Freeze returns a read-only view of the map.
+func (m *OrderedMap) Freeze() *FrozenMap {
+	return &FrozenMap{m: m}
+}
+
+func (m *FrozenMap) Has(comparator ValueComparator, hip HashInputProvider, key Value) (bool, error) {
+	return m.m.Has(comparator, hip, key)
+}
+
+func (m *FrozenMap) Get(comparator ValueComparator, hip HashInputProvider, key Value) (Storable, error) {
+	return m.m.Get(comparator, hip, key)
+}
+
+func (m *FrozenMap) Set(_ ValueComparator, _ HashInputProvider, _ Value, _ Value) (Storable, error) {
+	return nil, NewReadOnlyError(m.StorageID())
+}
+
+func (m *FrozenMap) Remove(_ ValueComparator, _ HashInputProvider, _ Value) (Storable, Storable, error) {
+	return nil, nil, NewReadOnlyError(m.StorageID())
+}
+
+func (m *FrozenMap) PopIterate(_ MapPopIterationFunc) error {
+	return NewReadOnlyError(m.StorageID())
+}
+
+func (m *FrozenMap) SetType(_ TypeInfo, _ TypeInfoCompatibilityChecker) error {
+	return NewReadOnlyError(m.StorageID())
+}
+
+func (m *FrozenMap) Iterator() (*MapIterator, error) {
+	return m.m.Iterator()
+}
+
+func (m *FrozenMap) Iterate(fn MapEntryIterationFunc) error {
+	return m.m.Iterate(fn)
+}
+
+func (m *FrozenMap) IterateKeys(fn MapElementIterationFunc) error {
+	return m.m.IterateKeys(fn)
+}
+
+func (m *FrozenMap) IterateValues(fn MapElementIterationFunc) error {
+	return m.m.IterateValues(fn)
+}
+
+func (m *FrozenMap) Count() uint64 {
+	return m.m.Count()
+}
+
+func (m *FrozenMap) StorageID() StorageID {
+	return m.m.StorageID()
+}
+
+func (m *FrozenMap) Address() Address {
+	return m.m.Address()
+}
+
+func (m *FrozenMap) Type() TypeInfo {
+	return m.m.Type()
+}
+
+func (m *FrozenMap) Seed() uint64 {
+	return m.m.Seed()
+}
+
+func (m *FrozenMap) String() string {
+	return m.m.String()
+}
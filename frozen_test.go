@@ -0,0 +1,125 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrozenArray(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	frozen := array.Freeze()
+	require.Equal(t, array.StorageID(), frozen.StorageID())
+	require.Equal(t, uint64(1), frozen.Count())
+
+	v, err := frozen.Get(0)
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(0), v)
+
+	var readOnlyError *ReadOnlyError
+
+	_, err = frozen.Set(0, Uint64Value(1))
+	require.ErrorAs(t, err, &readOnlyError)
+
+	err = frozen.Append(Uint64Value(1))
+	require.ErrorAs(t, err, &readOnlyError)
+
+	err = frozen.Insert(0, Uint64Value(1))
+	require.ErrorAs(t, err, &readOnlyError)
+
+	_, err = frozen.Remove(0)
+	require.ErrorAs(t, err, &readOnlyError)
+
+	err = frozen.PopIterate(func(Storable) {})
+	require.ErrorAs(t, err, &readOnlyError)
+
+	require.Equal(t, uint64(1), array.Count())
+
+	// Changes made through array are visible in frozen view.
+	err = array.Append(Uint64Value(1))
+	require.NoError(t, err)
+
+	var values []Value
+	err = frozen.Iterate(func(v Value) (bool, error) {
+		values = append(values, v)
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Value{Uint64Value(0), Uint64Value(1)}, values)
+}
+
+func TestFrozenMap(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(1))
+	require.NoError(t, err)
+
+	frozen := m.Freeze()
+	require.Equal(t, m.StorageID(), frozen.StorageID())
+	require.Equal(t, uint64(1), frozen.Count())
+
+	v, err := frozen.Get(compare, hashInputProvider, Uint64Value(0))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(1), v)
+
+	has, err := frozen.Has(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	var readOnlyError *ReadOnlyError
+
+	_, err = frozen.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(2))
+	require.ErrorAs(t, err, &readOnlyError)
+
+	_, _, err = frozen.Remove(compare, hashInputProvider, Uint64Value(0))
+	require.ErrorAs(t, err, &readOnlyError)
+
+	err = frozen.PopIterate(func(Storable, Storable) {})
+	require.ErrorAs(t, err, &readOnlyError)
+
+	require.Equal(t, uint64(1), m.Count())
+
+	count := 0
+	err = frozen.Iterate(func(k Value, v Value) (bool, error) {
+		require.Equal(t, Uint64Value(0), k)
+		require.Equal(t, Uint64Value(1), v)
+		count++
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
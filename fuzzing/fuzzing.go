@@ -0,0 +1,611 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fuzzing is a differential fuzzing harness for atree
+// collections.  It runs sequences of operations against Array or
+// OrderedMap and against a simple reference model (Go slice or map),
+// compares results after every operation, and validates collections
+// with atree validators.
+//
+// Fuzz inputs are decoded with DecodeOps, so any byte sequence is a
+// valid input.  FuzzArray and FuzzMap are go-fuzz entry points, which
+// also work with libFuzzer through go-fuzz-build -libfuzzer:
+//
+//	go-fuzz-build -func FuzzMap github.com/onflow/atree/fuzzing
+//
+// Crashing inputs can be minimized with Minimize before they are added
+// to corpus or to regression tests.
+package fuzzing
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/values"
+)
+
+// OpKind is kind of operation.
+type OpKind byte
+
+const (
+	// OpAppend appends value to array, or sets key in map.
+	OpAppend OpKind = iota
+	// OpInsert inserts value at index of array, or sets key in map.
+	OpInsert
+	// OpSet replaces element at index of array, or sets key in map.
+	OpSet
+	// OpRemove removes element at index of array, or key of map.
+	OpRemove
+	// OpGet compares element at index of array, or value of key in map.
+	OpGet
+	// OpIterate compares all elements in iteration order.
+	OpIterate
+
+	opKindCount
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpAppend:
+		return "append"
+	case OpInsert:
+		return "insert"
+	case OpSet:
+		return "set"
+	case OpRemove:
+		return "remove"
+	case OpGet:
+		return "get"
+	case OpIterate:
+		return "iterate"
+	default:
+		return fmt.Sprintf("OpKind(%d)", byte(k))
+	}
+}
+
+// Op is operation run by harness.  Index selects array element modulo
+// array count, or map key modulo KeySpace.  Value is converted to
+// element value with NewValue.
+type Op struct {
+	Kind  OpKind
+	Index uint16
+	Value uint16
+}
+
+func (op Op) String() string {
+	return fmt.Sprintf("%s(%d, %d)", op.Kind, op.Index, op.Value)
+}
+
+// opSize is encoded size of Op: kind (1 byte), index (2 bytes), value (2 bytes).
+const opSize = 5
+
+// DecodeOps decodes fuzz input to operations.  Every input is valid:
+// kind is taken modulo number of kinds and trailing bytes are ignored.
+func DecodeOps(data []byte) []Op {
+	ops := make([]Op, 0, len(data)/opSize)
+	for ; len(data) >= opSize; data = data[opSize:] {
+		ops = append(ops, Op{
+			Kind:  OpKind(data[0] % byte(opKindCount)),
+			Index: uint16(data[1])<<8 | uint16(data[2]),
+			Value: uint16(data[3])<<8 | uint16(data[4]),
+		})
+	}
+	return ops
+}
+
+// EncodeOps encodes operations to fuzz input, for seeding corpus and
+// saving minimized inputs.
+func EncodeOps(ops []Op) []byte {
+	data := make([]byte, 0, len(ops)*opSize)
+	for _, op := range ops {
+		data = append(data,
+			byte(op.Kind),
+			byte(op.Index>>8), byte(op.Index),
+			byte(op.Value>>8), byte(op.Value),
+		)
+	}
+	return data
+}
+
+// KeySpace is number of distinct map keys, small enough for operations
+// to often hit existing keys.
+const KeySpace = 512
+
+// NewValue returns element value for v.  Every 16th value is a string
+// of up to 2 KB, which is stored in a separate slab if it is large.
+func NewValue(v uint16) atree.Value {
+	if v%16 == 0 {
+		return values.NewStringValue(strings.Repeat("v", int(v%2048)))
+	}
+	return values.Uint64Value(v)
+}
+
+// MismatchError is returned when collection and reference model
+// disagree, or collection fails validation.
+type MismatchError struct {
+	// OpIndex is index of failed operation.
+	OpIndex int
+	Op      Op
+	Msg     string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("op %d %s: %s", e.OpIndex, e.Op, e.Msg)
+}
+
+// Options configure harness runs.
+type Options struct {
+	// ValidateInterval is number of operations between validations of
+	// collection.  Zero ValidateInterval validates only after the last
+	// operation.
+	ValidateInterval int
+}
+
+var address = atree.Address{0, 0, 0, 0, 0, 0, 0, 1}
+
+// typeInfo is type info of collections, CBOR encoded uint 42.
+var typeInfo = inspect.RawTypeInfo{0x18, 0x2a}
+
+func typeInfoComparator(a atree.TypeInfo, b atree.TypeInfo) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func storableComparator(a atree.Storable, b atree.Storable) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// harness holds state shared by array and map runs.
+type harness struct {
+	options Options
+	storage *atree.BasicSlabStorage
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+}
+
+func newHarness(options Options) (*harness, error) {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		return nil, err
+	}
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &harness{
+		options: options,
+		storage: atree.NewBasicSlabStorage(encMode, decMode, values.DecodeStorable, inspect.DecodeRawTypeInfo),
+		encMode: encMode,
+		decMode: decMode,
+	}, nil
+}
+
+// shouldValidate returns true if collection is validated after op i of n.
+func (h *harness) shouldValidate(i int, n int) bool {
+	if i == n-1 {
+		return true
+	}
+	interval := h.options.ValidateInterval
+	return interval > 0 && (i+1)%interval == 0
+}
+
+// removeStorable removes slab of storable replaced or removed from
+// collection, if storable is stored in a separate slab.
+func (h *harness) removeStorable(storable atree.Storable) error {
+	if id, ok := storable.(atree.StorageIDStorable); ok {
+		return h.storage.Remove(atree.StorageID(id))
+	}
+	return nil
+}
+
+func (h *harness) storedValue(storable atree.Storable) (atree.Value, error) {
+	return storable.StoredValue(h.storage)
+}
+
+// RunArray runs ops against a new Array and a slice, returning
+// MismatchError at first disagreement or failed validation.
+func RunArray(ops []Op, options Options) error {
+	h, err := newHarness(options)
+	if err != nil {
+		return err
+	}
+
+	array, err := atree.NewArray(h.storage, address, typeInfo)
+	if err != nil {
+		return err
+	}
+
+	var model []atree.Value
+
+	for i, op := range ops {
+		mismatch := func(format string, args ...interface{}) error {
+			return &MismatchError{OpIndex: i, Op: op, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		count := uint64(len(model))
+		value := NewValue(op.Value)
+
+		switch op.Kind {
+		case OpAppend:
+			err = array.Append(value)
+			if err != nil {
+				return mismatch("append failed: %s", err)
+			}
+			model = append(model, value)
+
+		case OpInsert:
+			index := uint64(op.Index) % (count + 1)
+			err = array.Insert(index, value)
+			if err != nil {
+				return mismatch("insert failed: %s", err)
+			}
+			model = append(model, nil)
+			copy(model[index+1:], model[index:])
+			model[index] = value
+
+		case OpSet, OpRemove, OpGet:
+			if count == 0 {
+				continue
+			}
+			index := uint64(op.Index) % count
+
+			var existing atree.Storable
+			switch op.Kind {
+			case OpSet:
+				existing, err = array.Set(index, value)
+			case OpRemove:
+				existing, err = array.Remove(index)
+			default:
+				var storable atree.Storable
+				storable, err = array.Get(index)
+				if err == nil {
+					v, err := h.storedValue(storable)
+					if err != nil {
+						return mismatch("element value: %s", err)
+					}
+					if !reflect.DeepEqual(model[index], v) {
+						return mismatch("got %s, want %s", v, model[index])
+					}
+				}
+			}
+			if err != nil {
+				return mismatch("%s failed: %s", op.Kind, err)
+			}
+
+			if existing != nil {
+				v, err := h.storedValue(existing)
+				if err != nil {
+					return mismatch("existing value: %s", err)
+				}
+				if !reflect.DeepEqual(model[index], v) {
+					return mismatch("existing value is %s, want %s", v, model[index])
+				}
+				err = h.removeStorable(existing)
+				if err != nil {
+					return err
+				}
+			}
+
+			switch op.Kind {
+			case OpSet:
+				model[index] = value
+			case OpRemove:
+				model = append(model[:index], model[index+1:]...)
+			}
+
+		case OpIterate:
+			var index int
+			err = array.Iterate(func(v atree.Value) (bool, error) {
+				if index >= len(model) || !reflect.DeepEqual(model[index], v) {
+					return false, fmt.Errorf("element %d is %s", index, v)
+				}
+				index++
+				return true, nil
+			})
+			if err != nil {
+				return mismatch("iterate failed: %s", err)
+			}
+			if index != len(model) {
+				return mismatch("iterated %d elements, want %d", index, len(model))
+			}
+		}
+
+		if array.Count() != uint64(len(model)) {
+			return mismatch("count is %d, want %d", array.Count(), len(model))
+		}
+
+		if h.shouldValidate(i, len(ops)) {
+			err = h.validateArray(array)
+			if err != nil {
+				return mismatch("validation failed: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (h *harness) validateArray(array *atree.Array) error {
+	err := atree.ValidArray(array, typeInfo, typeInfoComparator, values.HashInputProvider)
+	if err != nil {
+		return err
+	}
+
+	err = atree.ValidArraySerialization(
+		array,
+		h.decMode,
+		h.encMode,
+		values.DecodeStorable,
+		inspect.DecodeRawTypeInfo,
+		storableComparator,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = atree.CheckStorageHealth(h.storage, 1)
+	return err
+}
+
+// RunMap runs ops against a new OrderedMap and a Go map, returning
+// MismatchError at first disagreement or failed validation.
+func RunMap(ops []Op, options Options) error {
+	h, err := newHarness(options)
+	if err != nil {
+		return err
+	}
+
+	m, err := atree.NewMap(h.storage, address, atree.NewDefaultDigesterBuilder(), typeInfo)
+	if err != nil {
+		return err
+	}
+
+	model := make(map[values.Uint64Value]atree.Value)
+
+	for i, op := range ops {
+		mismatch := func(format string, args ...interface{}) error {
+			return &MismatchError{OpIndex: i, Op: op, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		key := values.Uint64Value(op.Index % KeySpace)
+		want, exists := model[key]
+
+		switch op.Kind {
+		case OpAppend, OpInsert, OpSet:
+			value := NewValue(op.Value)
+
+			existing, err := m.Set(values.Compare, values.HashInputProvider, key, value)
+			if err != nil {
+				return mismatch("set failed: %s", err)
+			}
+
+			if exists != (existing != nil) {
+				return mismatch("set returned existing value %v, want existing %t", existing, exists)
+			}
+			if existing != nil {
+				v, err := h.storedValue(existing)
+				if err != nil {
+					return mismatch("existing value: %s", err)
+				}
+				if !reflect.DeepEqual(want, v) {
+					return mismatch("existing value is %s, want %s", v, want)
+				}
+				err = h.removeStorable(existing)
+				if err != nil {
+					return err
+				}
+			}
+
+			model[key] = value
+
+		case OpRemove:
+			existingKey, existingValue, err := m.Remove(values.Compare, values.HashInputProvider, key)
+			if !exists {
+				var keyNotFoundError *atree.KeyNotFoundError
+				if !errors.As(err, &keyNotFoundError) {
+					return mismatch("remove of missing key returned %v, want KeyNotFoundError", err)
+				}
+				break
+			}
+			if err != nil {
+				return mismatch("remove failed: %s", err)
+			}
+
+			v, err := h.storedValue(existingValue)
+			if err != nil {
+				return mismatch("removed value: %s", err)
+			}
+			if !reflect.DeepEqual(want, v) {
+				return mismatch("removed value is %s, want %s", v, want)
+			}
+			err = h.removeStorable(existingKey)
+			if err != nil {
+				return err
+			}
+			err = h.removeStorable(existingValue)
+			if err != nil {
+				return err
+			}
+
+			delete(model, key)
+
+		case OpGet:
+			storable, err := m.Get(values.Compare, values.HashInputProvider, key)
+			if !exists {
+				var keyNotFoundError *atree.KeyNotFoundError
+				if !errors.As(err, &keyNotFoundError) {
+					return mismatch("get of missing key returned %v, want KeyNotFoundError", err)
+				}
+				break
+			}
+			if err != nil {
+				return mismatch("get failed: %s", err)
+			}
+			v, err := h.storedValue(storable)
+			if err != nil {
+				return mismatch("value: %s", err)
+			}
+			if !reflect.DeepEqual(want, v) {
+				return mismatch("got %s, want %s", v, want)
+			}
+
+		case OpIterate:
+			seen := make(map[values.Uint64Value]struct{}, len(model))
+			err = m.Iterate(func(k atree.Value, v atree.Value) (bool, error) {
+				key, ok := k.(values.Uint64Value)
+				if !ok {
+					return false, fmt.Errorf("key %s has type %T", k, k)
+				}
+				if _, ok := seen[key]; ok {
+					return false, fmt.Errorf("key %d is iterated twice", key)
+				}
+				seen[key] = struct{}{}
+				if want, ok := model[key]; !ok || !reflect.DeepEqual(want, v) {
+					return false, fmt.Errorf("key %d has value %s, want %s", key, v, want)
+				}
+				return true, nil
+			})
+			if err != nil {
+				return mismatch("iterate failed: %s", err)
+			}
+			if len(seen) != len(model) {
+				return mismatch("iterated %d elements, want %d", len(seen), len(model))
+			}
+		}
+
+		if m.Count() != uint64(len(model)) {
+			return mismatch("count is %d, want %d", m.Count(), len(model))
+		}
+
+		if h.shouldValidate(i, len(ops)) {
+			err = h.validateMap(m)
+			if err != nil {
+				return mismatch("validation failed: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (h *harness) validateMap(m *atree.OrderedMap) error {
+	err := atree.ValidMap(m, typeInfo, typeInfoComparator, values.HashInputProvider)
+	if err != nil {
+		return err
+	}
+
+	err = atree.ValidMapSerialization(
+		m,
+		h.decMode,
+		h.encMode,
+		values.DecodeStorable,
+		inspect.DecodeRawTypeInfo,
+		storableComparator,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = atree.CheckStorageHealth(h.storage, 1)
+	return err
+}
+
+// Minimize returns a subsequence of ops for which fails still returns
+// true, by repeatedly removing chunks of operations.  fails must return
+// true for ops.  It is used to shrink crashing fuzz inputs, e.g.
+//
+//	minimized := Minimize(ops, func(ops []Op) bool {
+//		return RunMap(ops, Options{}) != nil
+//	})
+func Minimize(ops []Op, fails func(ops []Op) bool) []Op {
+	chunks := 2
+
+	for len(ops) > 1 {
+		chunkSize := (len(ops) + chunks - 1) / chunks
+
+		reduced := false
+		for start := 0; start < len(ops); start += chunkSize {
+			end := start + chunkSize
+			if end > len(ops) {
+				end = len(ops)
+			}
+
+			candidate := make([]Op, 0, len(ops)-(end-start))
+			candidate = append(candidate, ops[:start]...)
+			candidate = append(candidate, ops[end:]...)
+
+			if fails(candidate) {
+				ops = candidate
+				reduced = true
+				break
+			}
+		}
+
+		if reduced {
+			if chunks > 2 {
+				chunks--
+			}
+			continue
+		}
+
+		if chunks >= len(ops) {
+			break
+		}
+		chunks *= 2
+		if chunks > len(ops) {
+			chunks = len(ops)
+		}
+	}
+
+	return ops
+}
+
+// FuzzArray is go-fuzz entry point running RunArray with ops decoded
+// from data.  It panics when harness finds a mismatch, so fuzzer
+// records input as crash.
+func FuzzArray(data []byte) int {
+	return fuzz(data, RunArray)
+}
+
+// FuzzMap is go-fuzz entry point running RunMap with ops decoded from
+// data.  It panics when harness finds a mismatch, so fuzzer records
+// input as crash.
+func FuzzMap(data []byte) int {
+	return fuzz(data, RunMap)
+}
+
+func fuzz(data []byte, run func([]Op, Options) error) int {
+	ops := DecodeOps(data)
+	if len(ops) == 0 {
+		return 0
+	}
+
+	err := run(ops, Options{ValidateInterval: 64})
+	if err != nil {
+		panic(err)
+	}
+
+	// Inputs with operations are given priority in corpus.
+	return 1
+}
@@ -0,0 +1,99 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fuzzing
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func randomOps(r *rand.Rand, n int) []Op {
+	data := make([]byte, n*opSize)
+	r.Read(data)
+	return DecodeOps(data)
+}
+
+func TestDecodeOps(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		ops := []Op{
+			{Kind: OpAppend, Index: 1, Value: 2},
+			{Kind: OpIterate, Index: 0xffff, Value: 0x1234},
+		}
+		require.Equal(t, ops, DecodeOps(EncodeOps(ops)))
+	})
+
+	t.Run("any input", func(t *testing.T) {
+		ops := DecodeOps([]byte{0xff, 1, 2, 3, 4, 5})
+		require.Equal(t, []Op{{Kind: OpKind(0xff % byte(opKindCount)), Index: 0x0102, Value: 0x0304}}, ops)
+
+		require.Empty(t, DecodeOps(nil))
+	})
+}
+
+func TestRun(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 5; i++ {
+		ops := randomOps(r, 2000)
+
+		err := RunArray(ops, Options{ValidateInterval: 500})
+		require.NoError(t, err)
+
+		err = RunMap(ops, Options{ValidateInterval: 500})
+		require.NoError(t, err)
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	require.Equal(t, 0, FuzzArray([]byte{1, 2}))
+	require.Equal(t, 0, FuzzMap(nil))
+
+	data := EncodeOps(randomOps(rand.New(rand.NewSource(42)), 100))
+	require.Equal(t, 1, FuzzArray(data))
+	require.Equal(t, 1, FuzzMap(data))
+}
+
+func TestMinimize(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+
+	ops := randomOps(r, 500)
+	ops[100] = Op{Kind: OpSet, Index: 7, Value: 1}
+	ops[400] = Op{Kind: OpRemove, Index: 7}
+
+	// fails reproduces a failure requiring set of key 7 followed by its removal.
+	fails := func(ops []Op) bool {
+		set := false
+		for _, op := range ops {
+			switch op {
+			case Op{Kind: OpSet, Index: 7, Value: 1}:
+				set = true
+			case Op{Kind: OpRemove, Index: 7}:
+				if set {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	minimized := Minimize(ops, fails)
+	require.Equal(t, []Op{{Kind: OpSet, Index: 7, Value: 1}, {Kind: OpRemove, Index: 7}}, minimized)
+}
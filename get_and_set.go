@@ -0,0 +1,227 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// GetAndSet sets element at index to value and returns the replaced
+// element as Value.  If replaced element was stored in its own
+// StorableSlab, the slab is removed from storage after its value is
+// decoded.  Replaced nested collections are returned intact and caller
+// is responsible for removing them (e.g. with DeepRemove).  If journal
+// is enabled, replaced element is kept for Undo and nothing is removed.
+func (a *Array) GetAndSet(index uint64, value Value) (Value, error) {
+	existingStorable, err := a.Set(index, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.journal != nil {
+		return existingStorable.StoredValue(a.Storage)
+	}
+
+	return releaseReplacedStorable(a.Storage, existingStorable)
+}
+
+// GetAndSet sets key to value and returns the replaced value as Value,
+// or nil if key was inserted.  Replaced value is released the same way
+// as by Array.GetAndSet.
+func (m *OrderedMap) GetAndSet(comparator ValueComparator, hip HashInputProvider, key Value, value Value) (Value, error) {
+	existingStorable, err := m.Set(comparator, hip, key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingStorable == nil {
+		return nil, nil
+	}
+
+	if m.journal != nil {
+		return existingStorable.StoredValue(m.Storage)
+	}
+
+	return releaseReplacedStorable(m.Storage, existingStorable)
+}
+
+// releaseReplacedStorable decodes storable replaced in a collection and
+// removes the StorableSlab it referenced, if any.
+func releaseReplacedStorable(storage SlabStorage, storable Storable) (Value, error) {
+	value, err := storable.StoredValue(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := storable.(StorageIDStorable)
+	if !ok {
+		return value, nil
+	}
+
+	switch value.(type) {
+	case *Array, *OrderedMap:
+		return value, nil
+	}
+
+	err = storage.Remove(StorageID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// MapValueProvider returns value stored by GetOrSet for absent key.
+type MapValueProvider func() (Value, error)
+
+// GetOrSet returns value of key if key exists.  Otherwise it sets key to
+// value returned by valueProvider and returns it.  Key is hashed once,
+// and slabs found by lookup are reused by insertion, so GetOrSet
+// descends map once.  valueProvider must not modify the map.  Returned
+// bool is true if key existed.
+func (m *OrderedMap) GetOrSet(comparator ValueComparator, hip HashInputProvider, key Value, valueProvider MapValueProvider) (Value, bool, error) {
+	keyDigest, err := m.digest(hip, key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer putDigester(keyDigest)
+
+	level := 0
+
+	hkey, err := keyDigest.Digest(level)
+	if err != nil {
+		return nil, false, err
+	}
+
+	atomic.AddUint64(&m.stats.Gets, 1)
+
+	storage := m.beginOperation()
+	path, err := findMapSlabPath(storage, m.root, hkey)
+	var existingValue MapValue
+	if err == nil {
+		existingValue, err = path.data.Get(storage, keyDigest, level, hkey, comparator, key)
+	}
+	m.endOperation(storage, OperationGet)
+
+	if err == nil {
+		value, err := existingValue.StoredValue(m.Storage)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	}
+
+	var keyNotFoundError *KeyNotFoundError
+	if !errors.As(err, &keyNotFoundError) {
+		return nil, false, wrapRootSlabPathError(err, m.StorageID())
+	}
+
+	value, err := valueProvider()
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = m.validateElement(key, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	storedValue, change, err := m.checkLimitsReplacing(nil, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	_, err = m.set(comparator, hip, keyDigest, hkey, key, storedValue, change, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, false, nil
+}
+
+// mapSlabPath is path of slabs from map root to data slab where key is
+// found or inserted.
+type mapSlabPath struct {
+	metas        []*MapMetaDataSlab
+	childIndexes []int
+	data         *MapDataSlab
+}
+
+// findMapSlabPath returns path of slabs from root to data slab where key
+// with first level digest hkey is found or inserted by Set.
+func findMapSlabPath(storage SlabStorage, root MapSlab, hkey Digest) (*mapSlabPath, error) {
+	path := &mapSlabPath{}
+
+	slab := root
+	for {
+		switch s := slab.(type) {
+		case *MapDataSlab:
+			path.data = s
+			return path, nil
+
+		case *MapMetaDataSlab:
+			ans := 0
+			i, j := 0, len(s.childrenHeaders)
+			for i < j {
+				h := int(uint(i+j) >> 1) // avoid overflow when computing h
+				if s.childrenHeaders[h].firstKey > hkey {
+					j = h
+				} else {
+					ans = h
+					i = h + 1
+				}
+			}
+
+			childID := s.childrenHeaders[ans].id
+
+			child, err := getMapSlab(storage, childID)
+			if err != nil {
+				return nil, wrapSlabPathError(err, s.header.id, ans, childID)
+			}
+
+			path.metas = append(path.metas, s)
+			path.childIndexes = append(path.childIndexes, ans)
+			slab = child
+
+		default:
+			return nil, NewUnreachableError()
+		}
+	}
+}
+
+// set sets key to value in data slab of path, and updates metadata slabs
+// of path from bottom up the same way as MapMetaDataSlab.Set.
+func (p *mapSlabPath) set(storage SlabStorage, b DigesterBuilder, digester Digester, level int, hkey Digest, comparator ValueComparator, hip HashInputProvider, key Value, value Value) (MapValue, error) {
+	existingValue, err := p.data.Set(storage, b, digester, level, hkey, comparator, hip, key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var child MapSlab = p.data
+	for i := len(p.metas) - 1; i >= 0; i-- {
+		err = p.metas[i].updateChild(storage, child, p.childIndexes[i])
+		if err != nil {
+			return nil, err
+		}
+		child = p.metas[i]
+	}
+
+	return existingValue, nil
+}
@@ -0,0 +1,258 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayGetAndSet(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("inlined", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		const arraySize = 1024
+		values := make([]Value, arraySize)
+		for i := uint64(0); i < arraySize; i++ {
+			values[i] = Uint64Value(i)
+			err = array.Append(values[i])
+			require.NoError(t, err)
+		}
+
+		for i := uint64(0); i < arraySize; i++ {
+			old, err := array.GetAndSet(i, Uint64Value(i*10))
+			require.NoError(t, err)
+			require.Equal(t, Uint64Value(i), old)
+			values[i] = Uint64Value(i * 10)
+		}
+
+		verifyArray(t, storage, typeInfo, address, array, values, false)
+	})
+
+	t.Run("storable slab", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		large := NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))
+		err = array.Append(large)
+		require.NoError(t, err)
+
+		storable, err := array.Get(0)
+		require.NoError(t, err)
+		id, ok := storable.(StorageIDStorable)
+		require.True(t, ok)
+
+		old, err := array.GetAndSet(0, Uint64Value(1))
+		require.NoError(t, err)
+		require.Equal(t, large, old)
+
+		_, found, err := storage.Retrieve(StorageID(id))
+		require.NoError(t, err)
+		require.False(t, found)
+
+		verifyArray(t, storage, typeInfo, address, array, []Value{Uint64Value(1)}, false)
+	})
+
+	t.Run("nested array", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		nested, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		err = nested.Append(Uint64Value(1))
+		require.NoError(t, err)
+
+		err = array.Append(nested)
+		require.NoError(t, err)
+
+		old, err := array.GetAndSet(0, Uint64Value(2))
+		require.NoError(t, err)
+
+		oldArray, ok := old.(*Array)
+		require.True(t, ok)
+		require.Equal(t, nested.StorageID(), oldArray.StorageID())
+		require.Equal(t, uint64(1), oldArray.Count())
+
+		_, found, err := storage.Retrieve(nested.StorageID())
+		require.NoError(t, err)
+		require.True(t, found)
+	})
+
+	t.Run("journal", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		large := NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))
+		err = array.Append(large)
+		require.NoError(t, err)
+
+		array.EnableJournal()
+
+		// Replaced storable slab is kept for Undo.
+		old, err := array.GetAndSet(0, Uint64Value(1))
+		require.NoError(t, err)
+		require.Equal(t, large, old)
+
+		count, err := array.Undo(1)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		verifyArray(t, storage, typeInfo, address, array, []Value{large}, false)
+	})
+
+	t.Run("index out of bounds", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		old, err := array.GetAndSet(0, Uint64Value(0))
+		require.Error(t, err)
+		require.Nil(t, old)
+
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+	})
+}
+
+func TestMapGetAndSet(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	const mapSize = 256
+	for i := uint64(0); i < mapSize; i++ {
+		old, err := m.GetAndSet(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+		require.NoError(t, err)
+		require.Nil(t, old)
+	}
+
+	for i := uint64(0); i < mapSize; i++ {
+		old, err := m.GetAndSet(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(i), old)
+	}
+
+	large := NewStringValue(strings.Repeat("a", int(MaxInlineMapKeyOrValueSize)))
+	_, err = m.GetAndSet(compare, hashInputProvider, Uint64Value(0), large)
+	require.NoError(t, err)
+
+	storable, err := m.Get(compare, hashInputProvider, Uint64Value(0))
+	require.NoError(t, err)
+	id, ok := storable.(StorageIDStorable)
+	require.True(t, ok)
+
+	old, err := m.GetAndSet(compare, hashInputProvider, Uint64Value(0), Uint64Value(0))
+	require.NoError(t, err)
+	require.Equal(t, large, old)
+
+	_, found, err := storage.Retrieve(StorageID(id))
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.Equal(t, uint64(mapSize), m.Count())
+
+	// Replaced storable slab is kept for Undo while journal is enabled.
+	_, err = m.GetAndSet(compare, hashInputProvider, Uint64Value(0), large)
+	require.NoError(t, err)
+
+	m.EnableJournal()
+
+	old, err = m.GetAndSet(compare, hashInputProvider, Uint64Value(0), Uint64Value(0))
+	require.NoError(t, err)
+	require.Equal(t, large, old)
+
+	count, err := m.Undo(compare, hashInputProvider, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	storable, err = m.Get(compare, hashInputProvider, Uint64Value(0))
+	require.NoError(t, err)
+	v, err := storable.StoredValue(storage)
+	require.NoError(t, err)
+	require.Equal(t, large, v)
+
+	_, err = CheckStorageHealth(storage, 1)
+	require.NoError(t, err)
+}
+
+func TestMapGetOrSet(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	const mapSize = 4096
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k, v := Uint64Value(i), Uint64Value(i*10)
+
+		value, existed, err := m.GetOrSet(compare, hashInputProvider, k, func() (Value, error) {
+			return v, nil
+		})
+		require.NoError(t, err)
+		require.False(t, existed)
+		require.Equal(t, v, value)
+
+		keyValues[k] = v
+	}
+
+	for i := uint64(0); i < mapSize; i++ {
+		value, existed, err := m.GetOrSet(compare, hashInputProvider, Uint64Value(i), func() (Value, error) {
+			require.Fail(t, "value provider shouldn't be called for existing key")
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.True(t, existed)
+		require.Equal(t, Uint64Value(i*10), value)
+	}
+
+	testErr := errors.New("test")
+	_, _, err = m.GetOrSet(compare, hashInputProvider, Uint64Value(mapSize), func() (Value, error) {
+		return nil, testErr
+	})
+	require.Equal(t, testErr, err)
+
+	verifyMap(t, storage, typeInfo, address, m, keyValues, nil, false)
+}
@@ -5,6 +5,9 @@ go 1.15
 require (
 	github.com/fxamacker/cbor/v2 v2.3.1-0.20211029162100-5d5d7c3edd41
 	github.com/fxamacker/circlehash v0.1.0
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/prometheus/client_golang v1.9.0
 	github.com/stretchr/testify v1.7.0
 	github.com/zeebo/blake3 v0.2.0
+	github.com/zeebo/xxh3 v1.0.2
 )
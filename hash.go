@@ -22,6 +22,7 @@ import (
 
 	"github.com/fxamacker/circlehash"
 	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
 )
 
 type HashInputProvider func(value Value, buffer []byte) ([]byte, error)
@@ -33,6 +34,65 @@ type DigesterBuilder interface {
 	Digest(HashInputProvider, Value) (Digester, error)
 }
 
+// DigesterType identifies the digest algorithm of a map.
+// Digester type of a map is recorded in map extra data,
+// so that decoded maps use the same algorithm.
+type DigesterType uint64
+
+const (
+	// DigesterTypeDefault is CircleHash64 at level 0 and BLAKE3 at levels 1-3.
+	DigesterTypeDefault DigesterType = iota
+	// DigesterTypeBlake3Keyed is keyed BLAKE3 at levels 0-3.
+	DigesterTypeBlake3Keyed
+	// DigesterTypeXXH3 is seeded 128-bit XXH3 at levels 0-1.
+	// It is not collision resistant against chosen keys.
+	DigesterTypeXXH3
+	// DigesterTypeBlake3SecretKey is BLAKE3 at levels 0-3, keyed with
+	// caller-supplied secret key identified by key ID in map extra data.
+	DigesterTypeBlake3SecretKey
+)
+
+// minDigesterSecretKeySize is minimum size of caller-supplied digester secret keys.
+const minDigesterSecretKeySize = 16
+
+// DigesterKeyProvider provides caller-managed secret keys of
+// maps created with NewSecretKeyDigesterBuilder.
+type DigesterKeyProvider interface {
+	DigesterKey(keyID uint64) ([]byte, error)
+}
+
+// TypedDigesterBuilder is a DigesterBuilder of a known digester type.
+// Maps created with a TypedDigesterBuilder record digester type in extra data.
+// Maps created with other DigesterBuilder implementations record default digester type.
+type TypedDigesterBuilder interface {
+	DigesterBuilder
+	DigesterType() DigesterType
+}
+
+// NewDigesterBuilder returns DigesterBuilder of given digester type.
+func NewDigesterBuilder(digesterType DigesterType) (DigesterBuilder, error) {
+	switch digesterType {
+	case DigesterTypeDefault:
+		return NewDefaultDigesterBuilder(), nil
+	case DigesterTypeBlake3Keyed:
+		return NewBlake3DigesterBuilder(), nil
+	case DigesterTypeXXH3:
+		return NewXXH3DigesterBuilderForTrustedKeys(), nil
+	case DigesterTypeBlake3SecretKey:
+		return nil, NewUserError(NewDigesterKeyErrorf("digester type %d requires secret key", digesterType))
+	default:
+		return nil, NewUserError(NewDigesterTypeErrorf("unsupported digester type %d", digesterType))
+	}
+}
+
+// digesterTypeOf returns digester type of b, or DigesterTypeDefault if b isn't a TypedDigesterBuilder.
+func digesterTypeOf(b DigesterBuilder) DigesterType {
+	if tb, ok := b.(TypedDigesterBuilder); ok {
+		return tb.DigesterType()
+	}
+	return DigesterTypeDefault
+}
+
 type Digester interface {
 	// DigestPrefix returns digests before specified level.
 	// If level is 0, DigestPrefix returns nil.
@@ -52,7 +112,7 @@ type basicDigesterBuilder struct {
 	k1 uint64
 }
 
-var _ DigesterBuilder = &basicDigesterBuilder{}
+var _ TypedDigesterBuilder = &basicDigesterBuilder{}
 
 type basicDigester struct {
 	circleHash64 uint64
@@ -92,6 +152,10 @@ func newBasicDigesterBuilder() *basicDigesterBuilder {
 	return &basicDigesterBuilder{}
 }
 
+func (bdb *basicDigesterBuilder) DigesterType() DigesterType {
+	return DigesterTypeDefault
+}
+
 func (bdb *basicDigesterBuilder) SetSeed(k0 uint64, k1 uint64) {
 	bdb.k0 = k0
 	bdb.k1 = k1
@@ -166,3 +230,241 @@ func (bd *basicDigester) Digest(level int) (Digest, error) {
 func (bd *basicDigester) Levels() int {
 	return 4
 }
+
+// blake3DigesterKeyContext is BLAKE3 key derivation context for map seeds.
+const blake3DigesterKeyContext = "atree 2022-01-01 00:00:00 map digester key v1"
+
+type blake3DigesterBuilder struct {
+	seeded bool
+	hasher *blake3.Hasher
+	// secret is caller-supplied secret key, or nil if key is derived from seed only.
+	secret []byte
+	keyID  uint64
+}
+
+var _ TypedDigesterBuilder = &blake3DigesterBuilder{}
+
+type blake3Digester struct {
+	hash [4]uint64
+}
+
+var _ Digester = &blake3Digester{}
+
+// NewBlake3DigesterBuilder returns DigesterBuilder using BLAKE3 in keyed mode
+// for all digest levels.  BLAKE3 key is derived from map seed.
+//
+// Compared to default digester, it is slower for maps without collisions,
+// but it is a cryptographic keyed hash at every level.
+func NewBlake3DigesterBuilder() DigesterBuilder {
+	return &blake3DigesterBuilder{}
+}
+
+// NewSecretKeyDigesterBuilder returns DigesterBuilder using BLAKE3 in keyed mode
+// for all digest levels.  BLAKE3 key is derived from both map seed and
+// caller-managed secret key, so maps using different secret keys have
+// independent digests even if their seeds are the same.
+//
+// keyID is recorded in map extra data.  Storage must implement
+// DigesterKeyProvider to decode maps created with this builder,
+// see WithDigesterKeyProvider.
+func NewSecretKeyDigesterBuilder(keyID uint64, secret []byte) (DigesterBuilder, error) {
+	if len(secret) < minDigesterSecretKeySize {
+		return nil, NewUserError(NewDigesterKeyErrorf(
+			"secret key %d has %d bytes, want at least %d bytes",
+			keyID,
+			len(secret),
+			minDigesterSecretKeySize,
+		))
+	}
+
+	secretCopy := make([]byte, len(secret))
+	copy(secretCopy, secret)
+
+	return &blake3DigesterBuilder{secret: secretCopy, keyID: keyID}, nil
+}
+
+// newDigesterBuilderFromExtraData returns DigesterBuilder of digester type
+// recorded in map extra data.  Secret keys are provided by storage.
+func newDigesterBuilderFromExtraData(storage SlabStorage, extraData *MapExtraData) (DigesterBuilder, error) {
+	if extraData.DigesterType != DigesterTypeBlake3SecretKey {
+		return NewDigesterBuilder(extraData.DigesterType)
+	}
+
+	provider, ok := unwrapSlabStorage(storage).(DigesterKeyProvider)
+	if !ok {
+		return nil, NewUserError(NewDigesterKeyErrorf("storage doesn't provide digester key %d", extraData.DigesterKeyID))
+	}
+
+	secret, err := provider.DigesterKey(extraData.DigesterKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSecretKeyDigesterBuilder(extraData.DigesterKeyID, secret)
+}
+
+// digesterKeyIDOf returns secret key ID of b, or 0 if b doesn't use secret key.
+func digesterKeyIDOf(b DigesterBuilder) uint64 {
+	if bb, ok := b.(*blake3DigesterBuilder); ok {
+		return bb.keyID
+	}
+	return 0
+}
+
+func (b *blake3DigesterBuilder) DigesterType() DigesterType {
+	if b.secret != nil {
+		return DigesterTypeBlake3SecretKey
+	}
+	return DigesterTypeBlake3Keyed
+}
+
+func (b *blake3DigesterBuilder) SetSeed(k0 uint64, k1 uint64) {
+	seed := make([]byte, 16, 16+len(b.secret))
+	binary.LittleEndian.PutUint64(seed[:], k0)
+	binary.LittleEndian.PutUint64(seed[8:], k1)
+	seed = append(seed, b.secret...)
+
+	var key [32]byte
+	blake3.DeriveKey(blake3DigesterKeyContext, seed, key[:])
+
+	hasher, err := blake3.NewKeyed(key[:])
+	if err != nil {
+		// Key is always 32 bytes
+		panic(NewUnreachableError())
+	}
+
+	b.hasher = hasher
+	b.seeded = k0 != 0
+}
+
+func (b *blake3DigesterBuilder) Digest(hip HashInputProvider, value Value) (Digester, error) {
+	if !b.seeded {
+		return nil, NewHashSeedUninitializedError()
+	}
+
+	var scratch [32]byte
+
+	msg, err := hip(value, scratch[:])
+	if err != nil {
+		return nil, err
+	}
+
+	h := b.hasher.Clone()
+	_, _ = h.Write(msg)
+	sum := h.Sum(scratch[:0])
+
+	return &blake3Digester{
+		hash: [4]uint64{
+			binary.BigEndian.Uint64(sum[:]),
+			binary.BigEndian.Uint64(sum[8:]),
+			binary.BigEndian.Uint64(sum[16:]),
+			binary.BigEndian.Uint64(sum[24:]),
+		},
+	}, nil
+}
+
+func (d *blake3Digester) Reset() {
+	d.hash = emptyBlake3Hash
+}
+
+func (d *blake3Digester) DigestPrefix(level int) ([]Digest, error) {
+	if level > d.Levels() {
+		// level must be [0, d.Levels()] (inclusive) for prefix
+		return nil, NewHashLevelErrorf("cannot get digest < level %d: level must be [0, %d]", level, d.Levels())
+	}
+	var prefix []Digest
+	for i := 0; i < level; i++ {
+		prefix = append(prefix, Digest(d.hash[i]))
+	}
+	return prefix, nil
+}
+
+func (d *blake3Digester) Digest(level int) (Digest, error) {
+	if level >= d.Levels() {
+		// level must be [0, d.Levels()) (not inclusive) for digest
+		return 0, NewHashLevelErrorf("cannot get digest at level %d: level must be [0, %d)", level, d.Levels())
+	}
+	return Digest(d.hash[level]), nil
+}
+
+func (d *blake3Digester) Levels() int {
+	return 4
+}
+
+type xxh3DigesterBuilder struct {
+	seed uint64
+}
+
+var _ TypedDigesterBuilder = &xxh3DigesterBuilder{}
+
+type xxh3Digester struct {
+	hash [2]uint64
+}
+
+var _ Digester = &xxh3Digester{}
+
+// NewXXH3DigesterBuilderForTrustedKeys returns DigesterBuilder using
+// seeded 128-bit XXH3 for two digest levels.
+//
+// XXH3 is not a cryptographic hash.  Anyone who can choose map keys
+// can find keys with colliding digests, degrading map operations to
+// linear scans of collision groups.  Only use it for maps whose keys
+// are not controlled by untrusted parties.
+func NewXXH3DigesterBuilderForTrustedKeys() DigesterBuilder {
+	return &xxh3DigesterBuilder{}
+}
+
+func (b *xxh3DigesterBuilder) DigesterType() DigesterType {
+	return DigesterTypeXXH3
+}
+
+func (b *xxh3DigesterBuilder) SetSeed(k0 uint64, k1 uint64) {
+	// Zero seed means builder isn't seeded, so fall back to k0 if k0 ^ k1 is zero.
+	b.seed = k0
+	if mixed := k0 ^ k1; mixed != 0 {
+		b.seed = mixed
+	}
+}
+
+func (b *xxh3DigesterBuilder) Digest(hip HashInputProvider, value Value) (Digester, error) {
+	if b.seed == 0 {
+		return nil, NewHashSeedUninitializedError()
+	}
+
+	var scratch [32]byte
+
+	msg, err := hip(value, scratch[:])
+	if err != nil {
+		return nil, err
+	}
+
+	h := xxh3.Hash128Seed(msg, b.seed)
+
+	return &xxh3Digester{hash: [2]uint64{h.Hi, h.Lo}}, nil
+}
+
+func (d *xxh3Digester) Reset() {}
+
+func (d *xxh3Digester) DigestPrefix(level int) ([]Digest, error) {
+	if level > d.Levels() {
+		// level must be [0, d.Levels()] (inclusive) for prefix
+		return nil, NewHashLevelErrorf("cannot get digest < level %d: level must be [0, %d]", level, d.Levels())
+	}
+	var prefix []Digest
+	for i := 0; i < level; i++ {
+		prefix = append(prefix, Digest(d.hash[i]))
+	}
+	return prefix, nil
+}
+
+func (d *xxh3Digester) Digest(level int) (Digest, error) {
+	if level >= d.Levels() {
+		// level must be [0, d.Levels()) (not inclusive) for digest
+		return 0, NewHashLevelErrorf("cannot get digest at level %d: level must be [0, %d)", level, d.Levels())
+	}
+	return Digest(d.hash[level]), nil
+}
+
+func (d *xxh3Digester) Levels() int {
+	return 2
+}
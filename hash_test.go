@@ -0,0 +1,207 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapXXH3Digester(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 2048
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	m, err := NewMap(storage, address, NewXXH3DigesterBuilderForTrustedKeys(), typeInfo)
+	require.NoError(t, err)
+	require.Equal(t, DigesterTypeXXH3, m.root.ExtraData().DigesterType)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := Uint64Value(i)
+		v := Uint64Value(i * 2)
+		keyValues[k] = v
+
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	verifyMap(t, storage, typeInfo, address, m, keyValues, nil, false)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	m2, err := NewMapWithRootID(storage2, m.StorageID(), nil)
+	require.NoError(t, err)
+	require.Equal(t, DigesterTypeXXH3, m2.root.ExtraData().DigesterType)
+
+	verifyMap(t, storage2, typeInfo, address, m2, keyValues, nil, false)
+}
+
+type testDigesterKeys map[uint64][]byte
+
+func (keys testDigesterKeys) DigesterKey(keyID uint64) ([]byte, error) {
+	key, ok := keys[keyID]
+	if !ok {
+		return nil, NewDigesterKeyErrorf("key %d not found", keyID)
+	}
+	return key, nil
+}
+
+func TestMapSecretKeyDigester(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 2048
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	keys := testDigesterKeys{
+		1: []byte("0123456789abcdef0123456789abcdef"),
+		2: []byte("fedcba9876543210fedcba9876543210"),
+	}
+
+	storage := newTestPersistentStorage(t)
+
+	_, err := NewSecretKeyDigesterBuilder(1, []byte("short"))
+	var keyError *DigesterKeyError
+	require.ErrorAs(t, err, &keyError)
+
+	builder, err := NewSecretKeyDigesterBuilder(2, keys[2])
+	require.NoError(t, err)
+
+	m, err := NewMap(storage, address, builder, typeInfo)
+	require.NoError(t, err)
+	require.Equal(t, DigesterTypeBlake3SecretKey, m.root.ExtraData().DigesterType)
+	require.Equal(t, uint64(2), m.root.ExtraData().DigesterKeyID)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := Uint64Value(i)
+		v := Uint64Value(i * 2)
+		keyValues[k] = v
+
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	verifyMap(t, storage, typeInfo, address, m, keyValues, nil, false)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	t.Run("key provider", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage, WithDigesterKeyProvider(keys))
+
+		m2, err := NewMapWithRootID(storage2, m.StorageID(), nil)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), m2.root.ExtraData().DigesterKeyID)
+
+		verifyMap(t, storage2, typeInfo, address, m2, keyValues, nil, false)
+	})
+
+	t.Run("no key provider", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		_, err := NewMapWithRootID(storage2, m.StorageID(), nil)
+		var keyError *DigesterKeyError
+		require.ErrorAs(t, err, &keyError)
+	})
+
+	t.Run("key mismatch", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		builder, err := NewSecretKeyDigesterBuilder(1, keys[1])
+		require.NoError(t, err)
+
+		_, err = NewMapWithRootID(storage2, m.StorageID(), builder)
+		var keyError *DigesterKeyError
+		require.ErrorAs(t, err, &keyError)
+	})
+
+	t.Run("different keys", func(t *testing.T) {
+		builder1, err := NewSecretKeyDigesterBuilder(1, keys[1])
+		require.NoError(t, err)
+		builder1.SetSeed(1, 2)
+
+		builder2, err := NewSecretKeyDigesterBuilder(2, keys[2])
+		require.NoError(t, err)
+		builder2.SetSeed(1, 2)
+
+		digester1, err := builder1.Digest(hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+
+		digester2, err := builder2.Digest(hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+
+		digest1, err := digester1.Digest(0)
+		require.NoError(t, err)
+
+		digest2, err := digester2.Digest(0)
+		require.NoError(t, err)
+
+		require.NotEqual(t, digest1, digest2)
+	})
+}
+
+func benchmarkDigest(b *testing.B, builder DigesterBuilder) {
+	builder.SetSeed(1, 2)
+
+	value := NewStringValue("a typical map key")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		digester, err := builder.Digest(hashInputProvider, value)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = digester.Digest(0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		digester.Reset()
+	}
+}
+
+func BenchmarkDigest(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		benchmarkDigest(b, NewDefaultDigesterBuilder())
+	})
+	b.Run("blake3", func(b *testing.B) {
+		benchmarkDigest(b, NewBlake3DigesterBuilder())
+	})
+	b.Run("xxh3", func(b *testing.B) {
+		benchmarkDigest(b, NewXXH3DigesterBuilderForTrustedKeys())
+	})
+}
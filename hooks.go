@@ -0,0 +1,115 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// Hooks are callbacks notified of structural changes of slabs and element
+// mutations of collections.  They allow embedders to trace structural churn
+// and attribute it to application operations.  Nil callbacks are ignored.
+//
+// Hooks are called synchronously and must not modify storage.
+type Hooks struct {
+	// OnSlabCreated is called when storage ID is generated for a new slab.
+	OnSlabCreated func(id StorageID)
+	// OnSlabRemoved is called when slab is removed from storage.
+	OnSlabRemoved func(id StorageID)
+	// OnSlabSplit is called when slab original is split into left and right slabs.
+	// Root slab keeps its ID by becoming parent of left and right slabs.
+	OnSlabSplit func(original StorageID, left StorageID, right StorageID)
+	// OnSlabMerge is called when right slab is merged into left slab.
+	// Right slab is removed after merge.
+	OnSlabMerge func(left StorageID, right StorageID)
+	// OnElementSet is called when existing element of collection is replaced.
+	OnElementSet func(rootID StorageID)
+	// OnElementInserted is called when element is inserted into collection.
+	OnElementInserted func(rootID StorageID)
+	// OnElementRemoved is called when element is removed from collection.
+	OnElementRemoved func(rootID StorageID)
+}
+
+// WithHooks sets hooks notified of changes made through storage.
+func WithHooks(hooks Hooks) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.hooks = &hooks
+		return st
+	}
+}
+
+// hooksStorage is implemented by storage with hooks.
+type hooksStorage interface {
+	storageHooks() *Hooks
+}
+
+func (s *PersistentSlabStorage) storageHooks() *Hooks {
+	return s.hooks
+}
+
+func hooksOf(storage SlabStorage) *Hooks {
+	s, ok := unwrapSlabStorage(storage).(hooksStorage)
+	if !ok {
+		return nil
+	}
+	return s.storageHooks()
+}
+
+func notifySlabCreated(hooks *Hooks, id StorageID) {
+	if hooks != nil && hooks.OnSlabCreated != nil {
+		hooks.OnSlabCreated(id)
+	}
+}
+
+func notifySlabRemoved(hooks *Hooks, id StorageID) {
+	if hooks != nil && hooks.OnSlabRemoved != nil {
+		hooks.OnSlabRemoved(id)
+	}
+}
+
+func notifySlabSplit(storage SlabStorage, original StorageID, left StorageID, right StorageID) {
+	hooks := hooksOf(storage)
+	if hooks != nil && hooks.OnSlabSplit != nil {
+		hooks.OnSlabSplit(original, left, right)
+	}
+}
+
+func notifySlabMerge(storage SlabStorage, left StorageID, right StorageID) {
+	hooks := hooksOf(storage)
+	if hooks != nil && hooks.OnSlabMerge != nil {
+		hooks.OnSlabMerge(left, right)
+	}
+}
+
+func notifyElementSet(storage SlabStorage, rootID StorageID) {
+	hooks := hooksOf(storage)
+	if hooks != nil && hooks.OnElementSet != nil {
+		hooks.OnElementSet(rootID)
+	}
+}
+
+func notifyElementInserted(storage SlabStorage, rootID StorageID) {
+	hooks := hooksOf(storage)
+	if hooks != nil && hooks.OnElementInserted != nil {
+		hooks.OnElementInserted(rootID)
+	}
+}
+
+func notifyElementRemoved(storage SlabStorage, rootID StorageID) {
+	hooks := hooksOf(storage)
+	if hooks != nil && hooks.OnElementRemoved != nil {
+		hooks.OnElementRemoved(rootID)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testHooksRecorder struct {
+	created  map[StorageID]int
+	removed  map[StorageID]int
+	splits   int
+	merges   int
+	sets     int
+	inserts  int
+	removals int
+}
+
+func newTestHooksRecorder() *testHooksRecorder {
+	return &testHooksRecorder{
+		created: make(map[StorageID]int),
+		removed: make(map[StorageID]int),
+	}
+}
+
+func (r *testHooksRecorder) hooks(t *testing.T, rootID *StorageID) Hooks {
+	return Hooks{
+		OnSlabCreated: func(id StorageID) { r.created[id]++ },
+		OnSlabRemoved: func(id StorageID) { r.removed[id]++ },
+		OnSlabSplit: func(original, left, right StorageID) {
+			require.NotEqual(t, left, right)
+			require.Equal(t, 1, r.created[right])
+			r.splits++
+		},
+		OnSlabMerge: func(left, right StorageID) {
+			require.NotEqual(t, left, right)
+			r.merges++
+		},
+		OnElementSet:      func(id StorageID) { require.Equal(t, *rootID, id); r.sets++ },
+		OnElementInserted: func(id StorageID) { require.Equal(t, *rootID, id); r.inserts++ },
+		OnElementRemoved:  func(id StorageID) { require.Equal(t, *rootID, id); r.removals++ },
+	}
+}
+
+func TestArrayHooks(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var rootID StorageID
+	recorder := newTestHooksRecorder()
+
+	storage := newTestPersistentStorage(t, WithHooks(recorder.hooks(t, &rootID)))
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	rootID = array.StorageID()
+	require.Equal(t, 1, recorder.created[rootID])
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	for i := uint64(0); i < arraySize; i += 2 {
+		_, err := array.Set(i, Uint64Value(i*2))
+		require.NoError(t, err)
+	}
+
+	stats, err := GetArrayStats(array)
+	require.NoError(t, err)
+
+	require.Equal(t, arraySize, recorder.inserts)
+	require.Equal(t, arraySize/2, recorder.sets)
+	require.True(t, recorder.splits > 0)
+	// Root is created first, every split creates right slab,
+	// and every root split also creates left slab.
+	require.Equal(t, len(recorder.created), recorder.splits+int(stats.Levels))
+
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array.Remove(0)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, arraySize, recorder.removals)
+	require.True(t, recorder.merges > 0)
+
+	// All slabs except root are removed.
+	require.Equal(t, len(recorder.created)-1, len(recorder.removed))
+	require.NotContains(t, recorder.removed, rootID)
+}
+
+func TestMapHooks(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var rootID StorageID
+	recorder := newTestHooksRecorder()
+
+	storage := newTestPersistentStorage(t, WithHooks(recorder.hooks(t, &rootID)))
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	rootID = m.StorageID()
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	for i := uint64(0); i < mapSize; i += 2 {
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*2))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, mapSize, recorder.inserts)
+	require.Equal(t, mapSize/2, recorder.sets)
+	require.True(t, recorder.splits > 0)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, _, err := m.Remove(compare, hashInputProvider, Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, mapSize, recorder.removals)
+	require.True(t, recorder.merges > 0)
+	require.Equal(t, len(recorder.created)-1, len(recorder.removed))
+}
@@ -0,0 +1,210 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "github.com/fxamacker/cbor/v2"
+
+// NewInsertionOrderedMap returns a new map that also keeps its keys in
+// insertion order, so that IterateInInsertionOrder visits elements in
+// the same order regardless of digester seed.  Keys are kept in a
+// separate array with the same type info as map, which is removed by
+// DeepRemove together with map.
+//
+// Keeping insertion order makes Remove proportional to map size, because
+// removed key is searched in the array.  Keys shouldn't be collections.
+// Insertion order isn't kept by copies made with NewMapFromBatchData.
+func NewInsertionOrderedMap(storage SlabStorage, address Address, digestBuilder DigesterBuilder, typeInfo TypeInfo) (*OrderedMap, error) {
+	m, err := NewMap(storage, address, digestBuilder, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := NewArray(storage, address, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	m.root.ExtraData().InsertionOrder = keys.StorageID()
+	m.insertionOrder = keys
+
+	err = m.Storage.Store(m.root.ID(), m.root)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// InsertionOrdered returns true if map keeps its keys in insertion order.
+func (m *OrderedMap) InsertionOrdered() bool {
+	return m.root.ExtraData().InsertionOrder != StorageIDUndefined
+}
+
+// insertionOrderKeys returns array of keys in insertion order, or nil
+// if map doesn't keep insertion order.
+func (m *OrderedMap) insertionOrderKeys() (*Array, error) {
+	id := m.root.ExtraData().InsertionOrder
+	if id == StorageIDUndefined {
+		return nil, nil
+	}
+
+	if m.insertionOrder == nil || m.insertionOrder.StorageID() != id {
+		keys, err := NewArrayWithRootID(m.Storage, id)
+		if err != nil {
+			return nil, err
+		}
+		m.insertionOrder = keys
+	}
+
+	return m.insertionOrder, nil
+}
+
+// appendInsertionOrder appends inserted key to array of keys in
+// insertion order, if map keeps insertion order.
+func (m *OrderedMap) appendInsertionOrder(key Value) error {
+	keys, err := m.insertionOrderKeys()
+	if err != nil || keys == nil {
+		return err
+	}
+	return keys.Append(key)
+}
+
+// removeInsertionOrder removes key from array of keys in insertion
+// order, if map keeps insertion order.
+func (m *OrderedMap) removeInsertionOrder(comparator ValueComparator, key Value) error {
+	keys, err := m.insertionOrderKeys()
+	if err != nil || keys == nil {
+		return err
+	}
+
+	index := uint64(0)
+	found := false
+	err = keys.IterateStorables(func(storable Storable) (bool, error) {
+		equal, err := comparator(m.Storage, key, storable)
+		if err != nil {
+			return false, err
+		}
+		if equal {
+			found = true
+			return false, nil
+		}
+		index++
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return NewSlabDataErrorf("key %s isn't in insertion order of map %s", key, m.StorageID())
+	}
+
+	storable, err := keys.Remove(index)
+	if err != nil {
+		return err
+	}
+
+	// Large key is stored in a separate slab owned by keys array.
+	return removeReplacedStorable(m.Storage, storable)
+}
+
+// clearInsertionOrder removes all keys from array of keys in insertion
+// order, if map keeps insertion order.
+func (m *OrderedMap) clearInsertionOrder() error {
+	keys, err := m.insertionOrderKeys()
+	if err != nil || keys == nil {
+		return err
+	}
+
+	var removed []Storable
+	err = keys.PopIterate(func(storable Storable) {
+		removed = append(removed, storable)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, storable := range removed {
+		err = removeReplacedStorable(m.Storage, storable)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IterateInInsertionOrder iterates map elements in the order their keys
+// were inserted.  Maps not created by NewInsertionOrderedMap are iterated
+// in digest order, as by Iterate.
+func (m *OrderedMap) IterateInInsertionOrder(comparator ValueComparator, hip HashInputProvider, fn MapEntryIterationFunc) error {
+	keys, err := m.insertionOrderKeys()
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return m.Iterate(fn)
+	}
+
+	return keys.Iterate(func(key Value) (bool, error) {
+		storable, err := m.Get(comparator, hip, key)
+		if err != nil {
+			return false, err
+		}
+
+		value, err := storable.StoredValue(m.Storage)
+		if err != nil {
+			return false, err
+		}
+
+		return fn(key, value)
+	})
+}
+
+// insertionOrderSlabID returns root ID of array of keys in insertion
+// order if slab is root of such map.
+func insertionOrderSlabID(slab Slab) (StorageID, bool) {
+	mapSlab, ok := slab.(MapSlab)
+	if !ok {
+		return StorageIDUndefined, false
+	}
+
+	extraData := mapSlab.ExtraData()
+	if extraData == nil || extraData.InsertionOrder == StorageIDUndefined {
+		return StorageIDUndefined, false
+	}
+
+	return extraData.InsertionOrder, true
+}
+
+func encodeStorageIDField(enc *Encoder, id StorageID) error {
+	var b [storageIDSize]byte
+	_, err := id.ToRawBytes(b[:])
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeBytes(b[:])
+}
+
+func decodeStorageIDField(dec *cbor.StreamDecoder) (StorageID, error) {
+	b, err := dec.DecodeBytes()
+	if err != nil {
+		return StorageIDUndefined, err
+	}
+	return NewStorageIDFromRawBytes(b)
+}
@@ -0,0 +1,148 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertionOrderedMap(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 500
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	iterateInInsertionOrder := func(t *testing.T, m *OrderedMap) []Value {
+		var keys []Value
+		err := m.IterateInInsertionOrder(compare, hashInputProvider, func(k Value, v Value) (bool, error) {
+			require.Equal(t, Uint64Value(k.(Uint64Value)*10), v)
+			keys = append(keys, k)
+			return true, nil
+		})
+		require.NoError(t, err)
+		return keys
+	}
+
+	t.Run("insert and remove", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewInsertionOrderedMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+		require.True(t, m.InsertionOrdered())
+
+		r := newRand(t)
+
+		var expected []Value
+		for _, i := range r.Perm(mapSize) {
+			k := Uint64Value(i)
+			existingStorable, err := m.Set(compare, hashInputProvider, k, k*10)
+			require.NoError(t, err)
+			require.Nil(t, existingStorable)
+			expected = append(expected, k)
+		}
+
+		// Overwriting existing key doesn't change its position.
+		existingStorable, err := m.Set(compare, hashInputProvider, expected[0], expected[0].(Uint64Value)*10)
+		require.NoError(t, err)
+		require.NotNil(t, existingStorable)
+
+		// Remove every third key.
+		var remaining []Value
+		for i, k := range expected {
+			if i%3 != 0 {
+				remaining = append(remaining, k)
+				continue
+			}
+			_, _, err := m.Remove(compare, hashInputProvider, k)
+			require.NoError(t, err)
+		}
+		expected = remaining
+
+		require.Equal(t, expected, iterateInInsertionOrder(t, m))
+
+		// Insertion order is persisted with map.
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		m2, err := NewMapWithRootID(storage2, m.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+		require.True(t, m2.InsertionOrdered())
+		require.Equal(t, expected, iterateInInsertionOrder(t, m2))
+
+		// Digest order is unaffected.
+		var digestOrder []Value
+		err = m2.IterateKeys(func(k Value) (bool, error) {
+			digestOrder = append(digestOrder, k)
+			return true, nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, digestOrder)
+		require.NotEqual(t, expected, digestOrder)
+	})
+
+	t.Run("pop iterate and deep remove", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewInsertionOrderedMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < mapSize; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+			require.NoError(t, err)
+		}
+
+		err = m.PopIterate(func(Storable, Storable) {})
+		require.NoError(t, err)
+		require.Equal(t, 0, len(iterateInInsertionOrder(t, m)))
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(10))
+		require.NoError(t, err)
+		require.Equal(t, []Value{Uint64Value(1)}, iterateInInsertionOrder(t, m))
+
+		_, err = m.DeepRemove(0, nil)
+		require.NoError(t, err)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+		require.Equal(t, 0, storage.Count())
+	})
+
+	t.Run("not insertion ordered", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+		require.False(t, m.InsertionOrdered())
+
+		for i := uint64(0); i < 10; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 10, len(iterateInInsertionOrder(t, m)))
+	})
+}
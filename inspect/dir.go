@@ -0,0 +1,202 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/onflow/atree"
+)
+
+const storageIDSize = len(atree.Address{}) + len(atree.StorageIndex{})
+
+// DirBaseStorage is a BaseStorage that stores each slab in its own file
+// in a directory.  Files are named by hex encoded raw storage ID.
+type DirBaseStorage struct {
+	dir              string
+	storageIndex     map[atree.Address]atree.StorageIndex
+	bytesRetrieved   int
+	bytesStored      int
+	segmentsReturned map[atree.StorageID]struct{}
+	segmentsUpdated  map[atree.StorageID]struct{}
+	segmentsTouched  map[atree.StorageID]struct{}
+}
+
+var _ atree.BaseStorage = &DirBaseStorage{}
+var _ BaseStorageEnumerator = &DirBaseStorage{}
+
+// NewDirBaseStorage returns DirBaseStorage storing slabs in dir.
+// dir is created if it doesn't exist.
+func NewDirBaseStorage(dir string) (*DirBaseStorage, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DirBaseStorage{
+		dir:              dir,
+		storageIndex:     make(map[atree.Address]atree.StorageIndex),
+		segmentsReturned: make(map[atree.StorageID]struct{}),
+		segmentsUpdated:  make(map[atree.StorageID]struct{}),
+		segmentsTouched:  make(map[atree.StorageID]struct{}),
+	}
+
+	// Continue storage index after existing slabs.
+	ids, err := s.StorageIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		current := s.storageIndex[id.Address]
+		if bytes.Compare(current[:], id.Index[:]) < 0 {
+			s.storageIndex[id.Address] = id.Index
+		}
+	}
+
+	return s, nil
+}
+
+func (s *DirBaseStorage) path(id atree.StorageID) string {
+	var b [storageIDSize]byte
+	_, _ = id.ToRawBytes(b[:])
+	return filepath.Join(s.dir, hex.EncodeToString(b[:]))
+}
+
+func (s *DirBaseStorage) Retrieve(id atree.StorageID) ([]byte, bool, error) {
+	s.segmentsTouched[id] = struct{}{}
+
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.bytesRetrieved += len(data)
+	s.segmentsReturned[id] = struct{}{}
+	return data, true, nil
+}
+
+func (s *DirBaseStorage) Store(id atree.StorageID, data []byte) error {
+	s.bytesStored += len(data)
+	s.segmentsUpdated[id] = struct{}{}
+	s.segmentsTouched[id] = struct{}{}
+	return ioutil.WriteFile(s.path(id), data, 0o644)
+}
+
+func (s *DirBaseStorage) Remove(id atree.StorageID) error {
+	s.segmentsUpdated[id] = struct{}{}
+	s.segmentsTouched[id] = struct{}{}
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *DirBaseStorage) GenerateStorageID(address atree.Address) (atree.StorageID, error) {
+	index := s.storageIndex[address].Next()
+	s.storageIndex[address] = index
+	return atree.NewStorageID(address, index), nil
+}
+
+// StorageIDs returns sorted IDs of stored slabs.
+func (s *DirBaseStorage) StorageIDs() ([]atree.StorageID, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []atree.StorageID
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		b, err := hex.DecodeString(entry.Name())
+		if err != nil || len(b) != storageIDSize {
+			// Skip files not created by DirBaseStorage
+			continue
+		}
+		id, err := atree.NewStorageIDFromRawBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+
+	return ids, nil
+}
+
+func (s *DirBaseStorage) SegmentCounts() int {
+	ids, err := s.StorageIDs()
+	if err != nil {
+		return 0
+	}
+	return len(ids)
+}
+
+func (s *DirBaseStorage) Size() int {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return 0
+	}
+	size := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			size += int(entry.Size())
+		}
+	}
+	return size
+}
+
+func (s *DirBaseStorage) BytesRetrieved() int {
+	return s.bytesRetrieved
+}
+
+func (s *DirBaseStorage) BytesStored() int {
+	return s.bytesStored
+}
+
+func (s *DirBaseStorage) SegmentsReturned() int {
+	return len(s.segmentsReturned)
+}
+
+func (s *DirBaseStorage) SegmentsUpdated() int {
+	return len(s.segmentsUpdated)
+}
+
+func (s *DirBaseStorage) SegmentsTouched() int {
+	return len(s.segmentsTouched)
+}
+
+func (s *DirBaseStorage) ResetReporter() {
+	s.bytesStored = 0
+	s.bytesRetrieved = 0
+	s.segmentsReturned = make(map[atree.StorageID]struct{})
+	s.segmentsUpdated = make(map[atree.StorageID]struct{})
+	s.segmentsTouched = make(map[atree.StorageID]struct{})
+}
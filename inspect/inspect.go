@@ -0,0 +1,377 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package inspect provides inspection of slab stores for debugging,
+// such as listing root slabs, printing slab trees, dumping elements,
+// checking storage health and collecting stats.  It is used by
+// cmd/atree-inspect and can be imported by tools with custom storables.
+package inspect
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+)
+
+// RawTypeInfo is type info kept as encoded CBOR.  It allows collections
+// to be inspected without knowing how to decode their type info.
+type RawTypeInfo []byte
+
+var _ atree.TypeInfo = RawTypeInfo{}
+
+func (t RawTypeInfo) Encode(enc *cbor.StreamEncoder) error {
+	return enc.EncodeRawBytes(t)
+}
+
+func (t RawTypeInfo) String() string {
+	return hex.EncodeToString(t)
+}
+
+// DecodeRawTypeInfo decodes any type info as RawTypeInfo.
+func DecodeRawTypeInfo(dec *cbor.StreamDecoder) (atree.TypeInfo, error) {
+	data, err := dec.DecodeRawBytes()
+	if err != nil {
+		return nil, err
+	}
+	return RawTypeInfo(append([]byte(nil), data...)), nil
+}
+
+// ParseStorageID parses storage ID in the format of StorageID.String,
+// for example "0x102030405060708.1".  It is atree.ParseStorageID.
+func ParseStorageID(s string) (atree.StorageID, error) {
+	return atree.ParseStorageID(s)
+}
+
+// Inspector inspects slabs stored in base storage.  Inspector doesn't
+// modify base storage, except for removing slabs in Vacuum.
+type Inspector struct {
+	base    atree.BaseStorage
+	storage *atree.PersistentSlabStorage
+}
+
+// NewInspector returns Inspector of base storage.  If decodeTypeInfo
+// is nil, DecodeRawTypeInfo is used.
+func NewInspector(
+	base atree.BaseStorage,
+	decodeStorable atree.StorableDecoder,
+	decodeTypeInfo atree.TypeInfoDecoder,
+) (*Inspector, error) {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		return nil, err
+	}
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		return nil, err
+	}
+
+	if decodeTypeInfo == nil {
+		decodeTypeInfo = DecodeRawTypeInfo
+	}
+
+	return &Inspector{
+		base:    base,
+		storage: atree.NewPersistentSlabStorage(base, encMode, decMode, decodeStorable, decodeTypeInfo),
+	}, nil
+}
+
+// Storage returns slab storage used by inspector.
+func (i *Inspector) Storage() *atree.PersistentSlabStorage {
+	return i.storage
+}
+
+func (i *Inspector) storageIDs() ([]atree.StorageID, error) {
+	enumerator, ok := i.base.(BaseStorageEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("base storage %T can't list slabs", i.base)
+	}
+	return enumerator.StorageIDs()
+}
+
+// Roots returns sorted IDs of root slabs in base storage.
+func (i *Inspector) Roots() ([]atree.StorageID, error) {
+	ids, err := i.storageIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []atree.StorageID
+	for _, id := range ids {
+		data, found, err := i.base.Retrieve(id)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		isRoot, err := atree.IsRootOfAnObject(data)
+		if err != nil {
+			return nil, fmt.Errorf("slab %s: %w", id, err)
+		}
+		if isRoot {
+			roots = append(roots, id)
+		}
+	}
+
+	return roots, nil
+}
+
+// CheckHealth loads all slabs in base storage and checks storage health
+// with atree.CheckStorageHealth.  It returns number of root slabs.
+func (i *Inspector) CheckHealth() (int, error) {
+	ids, err := i.storageIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	// Load all slabs so that slab iterator visits unreachable slabs as well.
+	for _, id := range ids {
+		_, _, err := i.storage.Retrieve(id)
+		if err != nil {
+			return 0, fmt.Errorf("slab %s: %w", id, err)
+		}
+	}
+
+	roots, err := atree.CheckStorageHealth(i.storage, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(roots), nil
+}
+
+// Vacuum removes slabs in base storage that aren't reachable from
+// roots, see atree.Vacuum, and commits removal to base storage.
+// If dryRun is true, unreachable slabs are reported to fn but aren't
+// removed.
+func (i *Inspector) Vacuum(roots []atree.StorageID, dryRun bool, fn atree.VacuumFunc) (atree.VacuumResult, error) {
+	ids, err := i.storageIDs()
+	if err != nil {
+		return atree.VacuumResult{}, err
+	}
+
+	result, err := atree.Vacuum(i.storage, roots, ids, dryRun, fn)
+	if err != nil {
+		i.storage.DropDeltas()
+		return result, err
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	return result, i.storage.Commit()
+}
+
+// collection is array or map opened from root slab.
+type collection struct {
+	array      *atree.Array
+	m          *atree.OrderedMap
+	basicArray *atree.BasicArray
+}
+
+func (i *Inspector) open(id atree.StorageID) (collection, error) {
+	slab, found, err := i.storage.Retrieve(id)
+	if err != nil {
+		return collection{}, err
+	}
+	if !found {
+		return collection{}, fmt.Errorf("slab %s not found", id)
+	}
+
+	switch slab.(type) {
+	case *atree.ArrayDataSlab, *atree.ArrayMetaDataSlab:
+		array, err := atree.NewArrayWithRootID(i.storage, id)
+		return collection{array: array}, err
+
+	case *atree.MapDataSlab, *atree.MapMetaDataSlab:
+		m, err := atree.NewMapWithRootID(i.storage, id, nil)
+		return collection{m: m}, err
+
+	case *atree.BasicArrayDataSlab:
+		basicArray, err := atree.NewBasicArrayWithRootID(i.storage, id)
+		return collection{basicArray: basicArray}, err
+
+	default:
+		return collection{}, fmt.Errorf("slab %s is %T, not root of array or map", id, slab)
+	}
+}
+
+// PrintTree writes slabs of collection rooted at id, one slab per line.
+func (i *Inspector) PrintTree(w io.Writer, id atree.StorageID) error {
+	c, err := i.open(id)
+	if err != nil {
+		return err
+	}
+
+	var dumps []string
+	switch {
+	case c.array != nil:
+		dumps, err = atree.DumpArraySlabs(c.array)
+	case c.m != nil:
+		dumps, err = atree.DumpMapSlabs(c.m)
+	default:
+		dumps = []string{fmt.Sprintf("basic array %s", c.basicArray)}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, dump := range dumps {
+		_, err := fmt.Fprintln(w, dump)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DumpElements writes elements of collection rooted at id,
+// one element (array) or key value pair (map) per line.
+func (i *Inspector) DumpElements(w io.Writer, id atree.StorageID) error {
+	c, err := i.open(id)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.array != nil:
+		index := 0
+		return c.array.Iterate(func(v atree.Value) (bool, error) {
+			_, err := fmt.Fprintf(w, "%d: %s\n", index, v)
+			index++
+			return err == nil, err
+		})
+
+	case c.m != nil:
+		return c.m.Iterate(func(k atree.Value, v atree.Value) (bool, error) {
+			_, err := fmt.Fprintf(w, "%s: %s\n", k, v)
+			return err == nil, err
+		})
+
+	default:
+		for index := uint64(0); index < c.basicArray.Count(); index++ {
+			v, err := c.basicArray.Get(index)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%d: %s\n", index, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// PrintStats writes stats of collection rooted at id.
+func (i *Inspector) PrintStats(w io.Writer, id atree.StorageID) error {
+	c, err := i.open(id)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.array != nil:
+		stats, err := atree.GetArrayStats(c.array)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "array %s type %v\n%+v\nslabs: %d\n", id, c.array.Type(), stats, stats.SlabCount())
+		return err
+
+	case c.m != nil:
+		stats, err := atree.GetMapStats(c.m)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "map %s type %v\n%+v\nslabs: %d\n", id, c.m.Type(), stats, stats.SlabCount())
+		return err
+
+	default:
+		_, err = fmt.Fprintf(w, "basic array %s\nelements: %d\n", id, c.basicArray.Count())
+		return err
+	}
+}
+
+// PrintStorageStats writes stats of base storage.
+func (i *Inspector) PrintStorageStats(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "segments: %d\nsize: %d\n", i.base.SegmentCounts(), i.base.Size())
+	return err
+}
+
+// PrintReport loads all slabs in base storage and writes the topN
+// largest slabs, collections with most slab tree levels, and map
+// collision groups with most elements.
+func (i *Inspector) PrintReport(w io.Writer, topN int) error {
+	ids, err := i.storageIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, _, err := i.storage.Retrieve(id)
+		if err != nil {
+			return fmt.Errorf("slab %s: %w", id, err)
+		}
+	}
+
+	report, err := atree.NewStorageReport(i.storage, topN)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "slabs: %d\nlargest slabs:\n", report.SlabCount)
+	if err != nil {
+		return err
+	}
+	for _, e := range report.LargestSlabs {
+		_, err = fmt.Fprintf(w, "  %s size %d\n", e.ID, e.Size)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "deepest collections:")
+	if err != nil {
+		return err
+	}
+	for _, e := range report.DeepestCollections {
+		_, err = fmt.Fprintf(w, "  %s levels %d\n", e.ID, e.Levels)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "widest collision groups:")
+	if err != nil {
+		return err
+	}
+	for _, e := range report.WidestCollisionGroups {
+		_, err = fmt.Fprintf(w, "  %s level %d count %d external %t\n", e.ID, e.Level, e.Count, e.External)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/values"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspector(t *testing.T) {
+
+	atree.SetThreshold(256)
+	defer atree.SetThreshold(1024)
+
+	const arraySize = 256
+	const mapSize = 128
+
+	dir := t.TempDir()
+
+	base, err := NewDirBaseStorage(dir)
+	require.NoError(t, err)
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	storage := atree.NewPersistentSlabStorage(base, encMode, decMode, values.DecodeStorable, DecodeRawTypeInfo)
+
+	// CBOR encoded uint 42
+	typeInfo := RawTypeInfo{0x18, 0x2a}
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := atree.NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(values.Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	m, err := atree.NewMap(storage, address, atree.NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Set(values.Compare, values.HashInputProvider, values.Uint64Value(i), values.NewStringValue(strings.Repeat("a", int(i))))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Open base storage registered as "dir".
+	base2, err := OpenBaseStorage("dir", dir)
+	require.NoError(t, err)
+
+	inspector, err := NewInspector(base2, values.DecodeStorable, nil)
+	require.NoError(t, err)
+
+	roots, err := inspector.Roots()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []atree.StorageID{array.StorageID(), m.StorageID()}, roots)
+
+	count, err := inspector.CheckHealth()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	var buf bytes.Buffer
+	err = inspector.DumpElements(&buf, array.StorageID())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, arraySize, len(lines))
+	require.Equal(t, "0: 0", lines[0])
+	require.Equal(t, "255: 255", lines[arraySize-1])
+
+	buf.Reset()
+	err = inspector.DumpElements(&buf, m.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, mapSize, strings.Count(buf.String(), "\n"))
+
+	stats, err := atree.GetArrayStats(array)
+	require.NoError(t, err)
+
+	buf.Reset()
+	err = inspector.PrintTree(&buf, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, int(stats.SlabCount()), strings.Count(buf.String(), "\n"))
+
+	buf.Reset()
+	err = inspector.PrintStats(&buf, m.StorageID())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(buf.String(), "map "+m.StorageID().String()))
+
+	buf.Reset()
+	err = inspector.PrintReport(&buf, 1)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(buf.String(), "slabs: "))
+	require.Equal(t, 1, strings.Count(buf.String(), " levels "))
+
+	// Non-root slab can't be opened as collection.
+	ids, err := base.StorageIDs()
+	require.NoError(t, err)
+	require.True(t, len(ids) > len(roots))
+
+	for _, id := range ids {
+		if id != array.StorageID() && id != m.StorageID() {
+			err = inspector.PrintTree(&buf, id)
+			require.Error(t, err)
+			break
+		}
+	}
+
+	// Storage IDs are parsed from their string representation.
+	id, err := ParseStorageID(array.StorageID().String())
+	require.NoError(t, err)
+	require.Equal(t, array.StorageID(), id)
+
+	_, err = ParseStorageID("0x1")
+	require.Error(t, err)
+
+	// Vacuum with map as the only root removes array slabs.
+	var unreachable []atree.StorageID
+	result, err := inspector.Vacuum([]atree.StorageID{m.StorageID()}, true, func(id atree.StorageID) error {
+		unreachable = append(unreachable, id)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int(stats.SlabCount()), result.Unreachable)
+	require.Contains(t, unreachable, array.StorageID())
+
+	ids, err = base.StorageIDs()
+	require.NoError(t, err)
+	require.Equal(t, result.Reachable+result.Unreachable, len(ids))
+
+	_, err = inspector.Vacuum([]atree.StorageID{m.StorageID()}, false, nil)
+	require.NoError(t, err)
+
+	roots, err = inspector.Roots()
+	require.NoError(t, err)
+	require.Equal(t, []atree.StorageID{m.StorageID()}, roots)
+
+	ids, err = base.StorageIDs()
+	require.NoError(t, err)
+	require.Equal(t, result.Reachable, len(ids))
+}
+
+func TestDirBaseStorageCompliance(t *testing.T) {
+	base, err := NewDirBaseStorage(t.TempDir())
+	require.NoError(t, err)
+
+	err = atree.TestBaseStorageCompliance(base)
+	require.NoError(t, err)
+}
@@ -0,0 +1,85 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/onflow/atree"
+)
+
+// BaseStorageEnumerator is implemented by base storages that can list
+// stored slabs.  Listing roots and health checks require it.
+type BaseStorageEnumerator interface {
+	StorageIDs() ([]atree.StorageID, error)
+}
+
+// BaseStorageOpener opens base storage described by dsn.
+type BaseStorageOpener func(dsn string) (atree.BaseStorage, error)
+
+var (
+	openersMu sync.Mutex
+	openers   = make(map[string]BaseStorageOpener)
+)
+
+// RegisterBaseStorage registers base storage opener under name,
+// so that the storage can be opened by OpenBaseStorage and atree-inspect.
+// It panics if name is already registered.
+func RegisterBaseStorage(name string, opener BaseStorageOpener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if _, ok := openers[name]; ok {
+		panic(fmt.Sprintf("base storage %q is already registered", name))
+	}
+	openers[name] = opener
+}
+
+// OpenBaseStorage opens base storage registered under name.
+func OpenBaseStorage(name string, dsn string) (atree.BaseStorage, error) {
+	openersMu.Lock()
+	opener, ok := openers[name]
+	openersMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown base storage %q", name)
+	}
+	return opener(dsn)
+}
+
+// BaseStorageNames returns sorted names of registered base storages.
+func BaseStorageNames() []string {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	names := make([]string, 0, len(openers))
+	for name := range openers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterBaseStorage("dir", func(dsn string) (atree.BaseStorage, error) {
+		return NewDirBaseStorage(dsn)
+	})
+}
@@ -0,0 +1,75 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "sync"
+
+// Iterators used internally by Iterate functions are pooled, so that
+// iteration-heavy workloads such as migrations and validations don't
+// allocate an iterator per call.
+
+var arrayIteratorPool = sync.Pool{
+	New: func() interface{} {
+		return &ArrayIterator{}
+	},
+}
+
+var mapIteratorPool = sync.Pool{
+	New: func() interface{} {
+		return &MapIterator{}
+	},
+}
+
+// pooledArrayIterator returns pooled iterator of array a.  Iterator must
+// be released with releaseArrayIterator when iteration is done.
+func pooledArrayIterator(a *Array) (*ArrayIterator, error) {
+	iterator := arrayIteratorPool.Get().(*ArrayIterator)
+	err := iterator.Reset(a)
+	if err != nil {
+		releaseArrayIterator(iterator)
+		return nil, err
+	}
+	return iterator, nil
+}
+
+// releaseArrayIterator clears iterator, so it doesn't retain slabs,
+// and returns it to pool.
+func releaseArrayIterator(iterator *ArrayIterator) {
+	*iterator = ArrayIterator{}
+	arrayIteratorPool.Put(iterator)
+}
+
+// pooledMapIterator returns pooled iterator of map m.  Iterator must be
+// released with releaseMapIterator when iteration is done.
+func pooledMapIterator(m *OrderedMap) (*MapIterator, error) {
+	iterator := mapIteratorPool.Get().(*MapIterator)
+	err := iterator.Reset(m)
+	if err != nil {
+		releaseMapIterator(iterator)
+		return nil, err
+	}
+	return iterator, nil
+}
+
+// releaseMapIterator clears iterator, so it doesn't retain slabs,
+// and returns it to pool.
+func releaseMapIterator(iterator *MapIterator) {
+	*iterator = MapIterator{}
+	mapIteratorPool.Put(iterator)
+}
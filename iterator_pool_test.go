@@ -0,0 +1,140 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIteratorReset(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const size = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < size; i++ {
+		require.NoError(t, array.Append(Uint64Value(i)))
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	t.Run("array", func(t *testing.T) {
+		iterator, err := array.Iterator()
+		require.NoError(t, err)
+
+		// Partially consumed iterator restarts after Reset.
+		for i := 0; i < 10; i++ {
+			_, err := iterator.Next()
+			require.NoError(t, err)
+		}
+
+		_, err = array.Remove(0)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, array.Insert(0, Uint64Value(0)))
+		}()
+
+		require.NoError(t, iterator.Reset(array))
+
+		count := 0
+		for {
+			v, err := iterator.Next()
+			require.NoError(t, err)
+			if v == nil {
+				break
+			}
+			count++
+			require.Equal(t, Uint64Value(count), v)
+		}
+		require.Equal(t, size-1, count)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		iterator, err := m.Iterator()
+		require.NoError(t, err)
+
+		var keys []Value
+		for {
+			k, _, err := iterator.Next()
+			require.NoError(t, err)
+			if k == nil {
+				break
+			}
+			keys = append(keys, k)
+		}
+		require.Equal(t, size, len(keys))
+
+		require.NoError(t, iterator.Reset(m))
+
+		for _, want := range keys {
+			k, v, err := iterator.Next()
+			require.NoError(t, err)
+			require.Equal(t, want, k)
+			require.Equal(t, want, v)
+		}
+		k, _, err := iterator.Next()
+		require.NoError(t, err)
+		require.Nil(t, k)
+	})
+
+	t.Run("nested iteration", func(t *testing.T) {
+		// Pooled iterators of nested Iterate calls are distinct.
+		outer := 0
+		err := array.Iterate(func(v Value) (bool, error) {
+			outer++
+			inner := 0
+			err := m.IterateKeys(func(Value) (bool, error) {
+				inner++
+				return inner < 10, nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, 10, inner)
+			return outer < 10, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 10, outer)
+	})
+
+	t.Run("allocations", func(t *testing.T) {
+		stats, err := GetMapStats(m)
+		require.NoError(t, err)
+		require.True(t, stats.DataSlabCount > 10)
+
+		allocs := testing.AllocsPerRun(10, func() {
+			err := m.IterateStorables(func(MapKey, MapValue) (bool, error) {
+				return true, nil
+			})
+			require.NoError(t, err)
+		})
+		require.Less(t, allocs, float64(stats.DataSlabCount))
+	})
+}
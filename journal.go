@@ -0,0 +1,275 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// operationJournal records applied mutations of collection as change events
+// so they can be undone and redone.
+type operationJournal struct {
+	undo []ChangeEvent
+	redo []ChangeEvent
+	// replaying is true while journal applies undo or redo, so that
+	// mutations made by journal itself aren't recorded.
+	replaying bool
+}
+
+func (j *operationJournal) record(storage SlabStorage, event ChangeEvent) error {
+	if j.replaying {
+		return nil
+	}
+	j.undo = append(j.undo, event)
+	return j.discardRedo(storage)
+}
+
+func (j *operationJournal) reset(storage SlabStorage) error {
+	j.undo = nil
+	return j.discardRedo(storage)
+}
+
+// discardRedo discards redo history and releases elements stored by
+// undone operations.  Nothing else references them once they can't be
+// redone.  Elements replaced and removed by undo history were returned
+// to caller by Set and Remove, so they are left to caller.
+func (j *operationJournal) discardRedo(storage SlabStorage) error {
+	for _, event := range j.redo {
+		if event.Op == ChangeRemove {
+			continue
+		}
+		_, err := releaseReplacedStorable(storage, event.New)
+		if err != nil {
+			return err
+		}
+	}
+	j.redo = j.redo[:0]
+	return nil
+}
+
+// replay applies up to n events popped from *from with apply, and pushes
+// applied events to *to.  It returns number of applied events.
+func (j *operationJournal) replay(
+	n int,
+	from *[]ChangeEvent,
+	to *[]ChangeEvent,
+	apply func(event ChangeEvent) error,
+) (int, error) {
+	j.replaying = true
+	defer func() {
+		j.replaying = false
+	}()
+
+	count := 0
+	for count < n && len(*from) > 0 {
+		event := (*from)[len(*from)-1]
+
+		err := apply(event)
+		if err != nil {
+			return count, err
+		}
+
+		*from = (*from)[:len(*from)-1]
+		*to = append(*to, event)
+		count++
+	}
+	return count, nil
+}
+
+// EnableJournal starts recording Set, Insert, and Remove of this Array
+// instance for Undo and Redo.  Journal isn't persisted, it only applies
+// to this Array instance.
+//
+// Journal keeps replaced and removed elements, so storables referenced by
+// them (such as child collections) must not be removed from storage while
+// they can be restored by Undo or Redo.  Undo and Redo store original
+// storables of elements instead of copies.
+func (a *Array) EnableJournal() {
+	if a.journal == nil {
+		a.journal = &operationJournal{}
+	}
+}
+
+// DisableJournal stops recording and discards recorded operations.
+// Elements stored by undone operations are released.
+func (a *Array) DisableJournal() error {
+	if a.journal == nil {
+		return nil
+	}
+	err := a.journal.reset(a.Storage)
+	if err != nil {
+		return err
+	}
+	a.journal = nil
+	return nil
+}
+
+// Undo reverts up to n most recent recorded operations, most recent first.
+// It returns number of reverted operations, which is less than n if
+// journal has fewer operations to undo.
+func (a *Array) Undo(n int) (int, error) {
+	if a.journal == nil {
+		return 0, nil
+	}
+	return a.journal.replay(n, &a.journal.undo, &a.journal.redo, func(event ChangeEvent) error {
+		// Unlinked element is kept by redo history.
+		_, err := a.applyInverse(event)
+		return err
+	})
+}
+
+// Redo reapplies up to n most recently undone operations.
+// Redo history is discarded when a new operation is recorded.
+func (a *Array) Redo(n int) (int, error) {
+	if a.journal == nil {
+		return 0, nil
+	}
+	return a.journal.replay(n, &a.journal.redo, &a.journal.undo, a.apply)
+}
+
+func (a *Array) apply(event ChangeEvent) error {
+	switch event.Op {
+	case ChangeSet:
+		_, err := a.Set(event.Index, storableValue{event.New})
+		return err
+
+	case ChangeInsert:
+		return a.Insert(event.Index, storableValue{event.New})
+
+	case ChangeRemove:
+		_, err := a.Remove(event.Index)
+		return err
+
+	default:
+		return NewUnreachableError()
+	}
+}
+
+// applyInverse reverts event and returns storable of element unlinked
+// from array by reverting it.
+func (a *Array) applyInverse(event ChangeEvent) (Storable, error) {
+	switch event.Op {
+	case ChangeSet:
+		return a.Set(event.Index, storableValue{event.Old})
+
+	case ChangeRemove:
+		return nil, a.Insert(event.Index, storableValue{event.Old})
+
+	case ChangeInsert:
+		return a.Remove(event.Index)
+
+	default:
+		return nil, NewUnreachableError()
+	}
+}
+
+// EnableJournal starts recording Set and Remove of this OrderedMap
+// instance for Undo and Redo.  Journal isn't persisted, it only applies
+// to this OrderedMap instance.
+//
+// Journal keeps replaced and removed elements, so storables referenced by
+// them (such as child collections) must not be removed from storage while
+// they can be restored by Undo or Redo.  Undo and Redo store original
+// storables of values instead of copies.  Keys are stored again, and key
+// storables removed by Undo and Redo are released.
+func (m *OrderedMap) EnableJournal() {
+	if m.journal == nil {
+		m.journal = &operationJournal{}
+	}
+}
+
+// DisableJournal stops recording and discards recorded operations.
+// Values stored by undone operations are released.
+func (m *OrderedMap) DisableJournal() error {
+	if m.journal == nil {
+		return nil
+	}
+	err := m.journal.reset(m.Storage)
+	if err != nil {
+		return err
+	}
+	m.journal = nil
+	return nil
+}
+
+// Undo reverts up to n most recent recorded operations, most recent first.
+// It returns number of reverted operations, which is less than n if
+// journal has fewer operations to undo.
+func (m *OrderedMap) Undo(comparator ValueComparator, hip HashInputProvider, n int) (int, error) {
+	if m.journal == nil {
+		return 0, nil
+	}
+	return m.journal.replay(n, &m.journal.undo, &m.journal.redo, func(event ChangeEvent) error {
+		// Unlinked value is kept by redo history.
+		_, err := m.applyInverse(comparator, hip, event)
+		return err
+	})
+}
+
+// Redo reapplies up to n most recently undone operations.
+// Redo history is discarded when a new operation is recorded.
+func (m *OrderedMap) Redo(comparator ValueComparator, hip HashInputProvider, n int) (int, error) {
+	if m.journal == nil {
+		return 0, nil
+	}
+	return m.journal.replay(n, &m.journal.redo, &m.journal.undo, func(event ChangeEvent) error {
+		switch event.Op {
+		case ChangeSet, ChangeInsert:
+			_, err := m.Set(comparator, hip, event.Key, storableValue{event.New})
+			return err
+
+		case ChangeRemove:
+			_, err := m.removeReleasingKey(comparator, hip, event.Key)
+			return err
+
+		default:
+			return NewUnreachableError()
+		}
+	})
+}
+
+// applyInverse reverts event and returns storable of value unlinked from
+// map by reverting it.
+func (m *OrderedMap) applyInverse(comparator ValueComparator, hip HashInputProvider, event ChangeEvent) (Storable, error) {
+	switch event.Op {
+	case ChangeSet:
+		return m.Set(comparator, hip, event.Key, storableValue{event.Old})
+
+	case ChangeRemove:
+		_, err := m.Set(comparator, hip, event.Key, storableValue{event.Old})
+		return nil, err
+
+	case ChangeInsert:
+		return m.removeReleasingKey(comparator, hip, event.Key)
+
+	default:
+		return nil, NewUnreachableError()
+	}
+}
+
+// removeReleasingKey removes key, releases removed key storable, and
+// returns removed value storable.  Key is stored again if removal is
+// reverted, while value storable is kept by caller to be restored.
+func (m *OrderedMap) removeReleasingKey(comparator ValueComparator, hip HashInputProvider, key Value) (Storable, error) {
+	keyStorable, valueStorable, err := m.Remove(comparator, hip, key)
+	if err != nil {
+		return nil, err
+	}
+	_, err = releaseReplacedStorable(m.Storage, keyStorable)
+	if err != nil {
+		return nil, err
+	}
+	return valueStorable, nil
+}
@@ -0,0 +1,365 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func arrayElements(t *testing.T, array *Array) []Value {
+	var values []Value
+	err := array.Iterate(func(v Value) (bool, error) {
+		values = append(values, v)
+		return true, nil
+	})
+	require.NoError(t, err)
+	return values
+}
+
+func TestArrayJournal(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	// Operations before EnableJournal aren't recorded.
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	count, err := array.Undo(1)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	array.EnableJournal()
+
+	const arraySize = 256
+	for i := uint64(1); i < arraySize; i++ {
+		err = array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+	require.False(t, array.root.IsData())
+
+	_, err = array.Set(0, Uint64Value(100))
+	require.NoError(t, err)
+
+	_, err = array.Remove(1)
+	require.NoError(t, err)
+
+	err = array.Insert(1, Uint64Value(200))
+	require.NoError(t, err)
+
+	after := arrayElements(t, array)
+
+	count, err = array.Undo(3)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	expected := make([]Value, arraySize)
+	for i := 0; i < arraySize; i++ {
+		expected[i] = Uint64Value(i)
+	}
+	require.Equal(t, expected, arrayElements(t, array))
+
+	count, err = array.Redo(10)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	require.Equal(t, after, arrayElements(t, array))
+
+	// Undo more operations than recorded.
+	count, err = array.Undo(arraySize * 2)
+	require.NoError(t, err)
+	require.Equal(t, arraySize+2, count)
+	require.Equal(t, []Value{Uint64Value(0)}, arrayElements(t, array))
+	require.True(t, array.root.IsData())
+
+	// New operation discards redo history.
+	err = array.Append(Uint64Value(1))
+	require.NoError(t, err)
+
+	count, err = array.Redo(1)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	// PopIterate discards journal.
+	err = array.PopIterate(func(Storable) {})
+	require.NoError(t, err)
+
+	count, err = array.Undo(1)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	err = array.DisableJournal()
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	count, err = array.Undo(1)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	_, err = CheckStorageHealth(storage, 1)
+	require.NoError(t, err)
+}
+
+func TestMapJournal(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	m.EnableJournal()
+
+	var events []ChangeEvent
+	m.SetChangeSink(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(10))
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(2), Uint64Value(20))
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(30))
+	require.NoError(t, err)
+
+	_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(2))
+	require.NoError(t, err)
+
+	count, err := m.Undo(compare, hashInputProvider, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	require.Equal(t, uint64(2), m.Count())
+
+	v, err := m.Get(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(10), v)
+
+	v, err = m.Get(compare, hashInputProvider, Uint64Value(2))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(20), v)
+
+	count, err = m.Undo(compare, hashInputProvider, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, uint64(0), m.Count())
+
+	count, err = m.Redo(compare, hashInputProvider, 4)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+	require.Equal(t, uint64(1), m.Count())
+
+	v, err = m.Get(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(30), v)
+
+	// Change sink receives mutations applied by journal.
+	require.Equal(t, 12, len(events))
+
+	err = m.DisableJournal()
+	require.NoError(t, err)
+
+	_, err = CheckStorageHealth(storage, 1)
+	require.NoError(t, err)
+}
+
+func TestJournalReleasesStorables(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Large strings are stored in separate slabs.
+	largeString := func(s string) Value {
+		return NewStringValue(strings.Repeat(s, int(MaxInlineArrayElementSize)))
+	}
+
+	t.Run("array", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for _, s := range []string{"a", "b", "c"} {
+			require.NoError(t, array.Append(largeString(s)))
+		}
+
+		array.EnableJournal()
+
+		// Replaced and removed elements are owned by caller.
+		var replaced []Storable
+
+		existing, err := array.Set(0, largeString("x"))
+		require.NoError(t, err)
+		replaced = append(replaced, existing)
+
+		existing, err = array.Remove(1)
+		require.NoError(t, err)
+		replaced = append(replaced, existing)
+
+		err = array.Insert(0, largeString("y"))
+		require.NoError(t, err)
+
+		// Undo and Redo restore original storables.
+		for i := 0; i < 3; i++ {
+			count, err := array.Undo(3)
+			require.NoError(t, err)
+			require.Equal(t, 3, count)
+
+			count, err = array.Redo(3)
+			require.NoError(t, err)
+			require.Equal(t, 3, count)
+		}
+
+		expected := []Value{largeString("y"), largeString("x"), largeString("c")}
+		require.Equal(t, expected, arrayElements(t, array))
+
+		// Elements stored by undone operation are released when
+		// redo history is discarded.
+		count, err := array.Undo(1)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		err = array.Append(largeString("z"))
+		require.NoError(t, err)
+
+		err = array.DisableJournal()
+		require.NoError(t, err)
+
+		for _, storable := range replaced {
+			_, err = releaseReplacedStorable(storage, storable)
+			require.NoError(t, err)
+		}
+
+		expected = []Value{largeString("x"), largeString("c"), largeString("z")}
+		require.Equal(t, expected, arrayElements(t, array))
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for _, s := range []string{"a", "b"} {
+			_, err = m.Set(compare, hashInputProvider, largeString(s), largeString(s))
+			require.NoError(t, err)
+		}
+
+		m.EnableJournal()
+
+		// Replaced and removed elements are owned by caller.
+		var replaced []Storable
+
+		existing, err := m.Set(compare, hashInputProvider, largeString("a"), largeString("x"))
+		require.NoError(t, err)
+		replaced = append(replaced, existing)
+
+		keyStorable, valueStorable, err := m.Remove(compare, hashInputProvider, largeString("b"))
+		require.NoError(t, err)
+		replaced = append(replaced, keyStorable, valueStorable)
+
+		_, err = m.Set(compare, hashInputProvider, largeString("c"), largeString("c"))
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			count, err := m.Undo(compare, hashInputProvider, 3)
+			require.NoError(t, err)
+			require.Equal(t, 3, count)
+
+			count, err = m.Redo(compare, hashInputProvider, 3)
+			require.NoError(t, err)
+			require.Equal(t, 3, count)
+		}
+
+		count, err := m.Undo(compare, hashInputProvider, 1)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		err = m.DisableJournal()
+		require.NoError(t, err)
+
+		for _, storable := range replaced {
+			_, err = releaseReplacedStorable(storage, storable)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, uint64(1), m.Count())
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+	})
+}
+
+func TestJournalErrorKeepsRootBalanced(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	array.EnableJournal()
+
+	require.NoError(t, array.Append(NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))))
+
+	storable, err := array.root.Get(storage, 0)
+	require.NoError(t, err)
+	id, ok := storable.(StorageIDStorable)
+	require.True(t, ok)
+
+	count, err := array.Undo(1)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// Redo history can't be discarded once slab of undone element is
+	// removed, so journal fails to record following mutations.
+	require.NoError(t, storage.Remove(StorageID(id)))
+
+	for i := uint64(0); i < 200; i++ {
+		err = array.Append(Uint64Value(i))
+		require.Error(t, err)
+
+		// Root is rebalanced before mutation is recorded.
+		require.False(t, array.root.IsFull())
+	}
+	require.False(t, array.root.IsData())
+	require.Equal(t, uint64(200), array.Count())
+}
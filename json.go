@@ -0,0 +1,278 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// JSONValueEncoder converts element value to JSON.
+type JSONValueEncoder func(value Value) ([]byte, error)
+
+// JSONValueDecoder converts JSON to element value.
+type JSONValueDecoder func(data json.RawMessage) (Value, error)
+
+// DefaultJSONValueEncoder encodes values with encoding/json.
+func DefaultJSONValueEncoder(value Value) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+var _ json.Marshaler = &Array{}
+var _ json.Marshaler = &OrderedMap{}
+
+// MarshalJSON encodes array as JSON array of elements
+// using DefaultJSONValueEncoder.
+func (a *Array) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := a.WriteJSON(&buf, DefaultJSONValueEncoder)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteJSON streams array to w as JSON array of elements.
+// Elements are converted by encode, except for nested arrays and maps
+// which are streamed recursively with the same encode function.
+func (a *Array) WriteJSON(w io.Writer, encode JSONValueEncoder) error {
+	_, err := w.Write([]byte{'['})
+	if err != nil {
+		return err
+	}
+
+	first := true
+	err = a.Iterate(func(element Value) (bool, error) {
+		if !first {
+			_, err := w.Write([]byte{','})
+			if err != nil {
+				return false, err
+			}
+		}
+		first = false
+
+		return true, writeJSONValue(w, element, encode)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte{']'})
+	return err
+}
+
+// MarshalJSON encodes map as JSON array of [key, value] pairs in
+// iteration order using DefaultJSONValueEncoder.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := m.WriteJSON(&buf, DefaultJSONValueEncoder)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteJSON streams map to w as JSON array of [key, value] pairs
+// in iteration order.  Keys and values are converted by encode, except
+// for nested arrays and maps which are streamed recursively with the
+// same encode function.
+func (m *OrderedMap) WriteJSON(w io.Writer, encode JSONValueEncoder) error {
+	_, err := w.Write([]byte{'['})
+	if err != nil {
+		return err
+	}
+
+	first := true
+	err = m.Iterate(func(key Value, value Value) (bool, error) {
+		prefix := []byte{',', '['}
+		if first {
+			prefix = prefix[1:]
+		}
+		first = false
+
+		_, err := w.Write(prefix)
+		if err != nil {
+			return false, err
+		}
+
+		err = writeJSONValue(w, key, encode)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = w.Write([]byte{','})
+		if err != nil {
+			return false, err
+		}
+
+		err = writeJSONValue(w, value, encode)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = w.Write([]byte{']'})
+		return true, err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte{']'})
+	return err
+}
+
+func writeJSONValue(w io.Writer, value Value, encode JSONValueEncoder) error {
+	switch v := value.(type) {
+	case *Array:
+		return v.WriteJSON(w, encode)
+	case *OrderedMap:
+		return v.WriteJSON(w, encode)
+	}
+
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// NewArrayFromJSON returns a new array with elements read from JSON array in r.
+// Elements are converted by decode and bulk-loaded with NewArrayFromBatchData.
+// decode must not return nil Value.
+func NewArrayFromJSON(
+	storage SlabStorage,
+	address Address,
+	typeInfo TypeInfo,
+	r io.Reader,
+	decode JSONValueDecoder,
+) (
+	*Array,
+	error,
+) {
+	dec := json.NewDecoder(r)
+
+	err := readJSONDelim(dec, '[')
+	if err != nil {
+		return nil, err
+	}
+
+	array, err := NewArrayFromBatchData(storage, address, typeInfo, func() (Value, error) {
+		if !dec.More() {
+			return nil, nil
+		}
+
+		var data json.RawMessage
+		err := dec.Decode(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		return decode(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readJSONDelim(dec, ']')
+	if err != nil {
+		return nil, err
+	}
+
+	return array, nil
+}
+
+// NewMapFromJSON returns a new map with elements read from JSON array
+// of [key, value] pairs in r.  Keys and values are converted by decode.
+// Elements are inserted with Set because JSON doesn't preserve map seed.
+func NewMapFromJSON(
+	storage SlabStorage,
+	address Address,
+	digesterBuilder DigesterBuilder,
+	typeInfo TypeInfo,
+	comparator ValueComparator,
+	hip HashInputProvider,
+	r io.Reader,
+	decode JSONValueDecoder,
+) (
+	*OrderedMap,
+	error,
+) {
+	dec := json.NewDecoder(r)
+
+	err := readJSONDelim(dec, '[')
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	for dec.More() {
+		var pair []json.RawMessage
+		err := dec.Decode(&pair)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(pair) != 2 {
+			return nil, NewUserError(NewJSONErrorf("map element has %d items, want 2", len(pair)))
+		}
+
+		key, err := decode(pair[0])
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decode(pair[1])
+		if err != nil {
+			return nil, err
+		}
+
+		existingStorable, err := m.Set(comparator, hip, key, value)
+		if err != nil {
+			return nil, err
+		}
+		if existingStorable != nil {
+			return nil, NewUserError(NewJSONErrorf("map has duplicate key %s", pair[0]))
+		}
+	}
+
+	err = readJSONDelim(dec, ']')
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func readJSONDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return NewUserError(NewJSONErrorf("got %v, want %s", token, want))
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testJSONValueEncoder(value Value) ([]byte, error) {
+	switch v := value.(type) {
+	case Uint64Value:
+		return json.Marshal(uint64(v))
+	case StringValue:
+		return json.Marshal(v.str)
+	default:
+		return nil, fmt.Errorf("unexpected value %T", value)
+	}
+}
+
+func testJSONValueDecoder(data json.RawMessage) (Value, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return NewStringValue(s), nil
+	}
+
+	var n uint64
+	err := json.Unmarshal(data, &n)
+	if err != nil {
+		return nil, err
+	}
+	return Uint64Value(n), nil
+}
+
+func TestArrayJSON(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, arraySize)
+	expected := make([]interface{}, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		var v Value = Uint64Value(i)
+		expected[i] = float64(i)
+		if i%2 == 0 {
+			v = NewStringValue(fmt.Sprintf("s%d", i))
+			expected[i] = fmt.Sprintf("s%d", i)
+		}
+		values[i] = v
+
+		err := array.Append(v)
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	err = array.WriteJSON(&buf, testJSONValueEncoder)
+	require.NoError(t, err)
+
+	var decoded []interface{}
+	err = json.Unmarshal(buf.Bytes(), &decoded)
+	require.NoError(t, err)
+	require.Equal(t, expected, decoded)
+
+	storage2 := newTestPersistentStorage(t)
+
+	array2, err := NewArrayFromJSON(storage2, address, typeInfo, &buf, testJSONValueDecoder)
+	require.NoError(t, err)
+
+	verifyArray(t, storage2, typeInfo, address, array2, values, false)
+
+	t.Run("nested", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		parent, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = child.Append(Uint64Value(1))
+		require.NoError(t, err)
+
+		err = parent.Append(child)
+		require.NoError(t, err)
+
+		err = parent.Append(Uint64Value(2))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = parent.WriteJSON(&buf, testJSONValueEncoder)
+		require.NoError(t, err)
+		require.Equal(t, "[[1],2]", buf.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewArrayFromJSON(storage, address, typeInfo, bytes.NewReader([]byte(`{}`)), testJSONValueDecoder)
+		var jsonError *JSONError
+		require.ErrorAs(t, err, &jsonError)
+	})
+}
+
+func TestMapJSON(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := NewStringValue(fmt.Sprintf("k%d", i))
+		v := Uint64Value(i)
+		keyValues[k] = v
+
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	data, err := json.Marshal(&jsonTestMap{m})
+	require.NoError(t, err)
+
+	var pairs [][2]interface{}
+	err = json.Unmarshal(data, &pairs)
+	require.NoError(t, err)
+	require.Equal(t, mapSize, len(pairs))
+
+	storage2 := newTestPersistentStorage(t)
+
+	m2, err := NewMapFromJSON(
+		storage2,
+		address,
+		NewDefaultDigesterBuilder(),
+		typeInfo,
+		compare,
+		hashInputProvider,
+		bytes.NewReader(data),
+		testJSONValueDecoder,
+	)
+	require.NoError(t, err)
+
+	verifyMap(t, storage2, typeInfo, address, m2, keyValues, nil, false)
+
+	t.Run("duplicate key", func(t *testing.T) {
+		_, err := NewMapFromJSON(
+			storage,
+			address,
+			NewDefaultDigesterBuilder(),
+			typeInfo,
+			compare,
+			hashInputProvider,
+			bytes.NewReader([]byte(`[["a",1],["a",2]]`)),
+			testJSONValueDecoder,
+		)
+		var jsonError *JSONError
+		require.ErrorAs(t, err, &jsonError)
+	})
+}
+
+// jsonTestMap marshals map with testJSONValueEncoder.
+type jsonTestMap struct {
+	m *OrderedMap
+}
+
+func (m *jsonTestMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := m.m.WriteJSON(&buf, testJSONValueEncoder)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,536 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CollectionLimits caps growth of a collection.  Zero fields disable
+// the corresponding limit.
+type CollectionLimits struct {
+	// MaxCount is maximum number of elements.
+	MaxCount uint64
+	// MaxByteSize is maximum deep byte size of elements, including slabs
+	// of nested collections and external elements.  Map keys aren't
+	// counted.
+	MaxByteSize uint64
+}
+
+// LimitsRecord is collection limits recorded in root extra data by
+// SetLimits, with deep byte size of elements tracked for MaxByteSize.
+type LimitsRecord struct {
+	CollectionLimits
+	// ByteSize is deep byte size of elements, or 0 if MaxByteSize isn't set.
+	ByteSize uint64
+}
+
+const limitsRecordLength = 3
+
+func decodeLimitsRecord(dec *cbor.StreamDecoder) (*LimitsRecord, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != limitsRecordLength {
+		return nil, NewDecodingErrorf("limits record has invalid length %d, want %d", length, limitsRecordLength)
+	}
+
+	maxCount, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	maxByteSize, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	byteSize, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LimitsRecord{
+		CollectionLimits: CollectionLimits{MaxCount: maxCount, MaxByteSize: maxByteSize},
+		ByteSize:         byteSize,
+	}, nil
+}
+
+func (r *LimitsRecord) encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(limitsRecordLength)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeUint64(r.MaxCount)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeUint64(r.MaxByteSize)
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint64(r.ByteSize)
+}
+
+// newLimitsRecord returns record of limits of collection with rootID,
+// or nil if limits are zero.  Byte size of elements is measured unless
+// it is already tracked by old record.
+func newLimitsRecord(storage SlabStorage, rootID StorageID, old *LimitsRecord, limits CollectionLimits) (*LimitsRecord, error) {
+	if limits == (CollectionLimits{}) {
+		return nil, nil
+	}
+
+	record := &LimitsRecord{CollectionLimits: limits}
+	if limits.MaxByteSize == 0 {
+		return record, nil
+	}
+
+	if old != nil && old.MaxByteSize != 0 {
+		record.ByteSize = old.ByteSize
+		return record, nil
+	}
+
+	err := forEachElementStorable(storage, rootID, func(_ Storable, value Storable) error {
+		size, err := deepStorableSize(storage, value)
+		if err != nil {
+			return err
+		}
+		record.ByteSize += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// byteSizeChange is change of deep byte size of elements made by mutation.
+type byteSizeChange struct {
+	removed uint64
+	added   uint64
+}
+
+// apply returns byte size after change.
+func (c byteSizeChange) apply(size uint64) uint64 {
+	if c.removed > size {
+		size = 0
+	} else {
+		size -= c.removed
+	}
+	return size + c.added
+}
+
+// measureStoredValue converts value stored in collection at address to
+// storable, and returns value of the storable and deep byte size of the
+// storable.  The storable is released if it exceeds remaining budget of
+// record, in which case CollectionLimitError is returned.
+func measureStoredValue(
+	storage SlabStorage,
+	id StorageID,
+	address Address,
+	maxInlineSize uint64,
+	record *LimitsRecord,
+	value Value,
+	change byteSizeChange,
+) (Value, byteSizeChange, error) {
+	storable, err := value.Storable(storage, address, maxInlineSize)
+	if err != nil {
+		return nil, change, err
+	}
+
+	change.added, err = deepStorableSize(storage, storable)
+	if err != nil {
+		return nil, change, err
+	}
+
+	if change.apply(record.ByteSize) > record.MaxByteSize {
+		// Storable of storableValue is owned by caller.
+		if _, ok := value.(storableValue); !ok {
+			_, err = releaseReplacedStorable(storage, storable)
+			if err != nil {
+				return nil, change, err
+			}
+		}
+		return nil, change, NewCollectionLimitError(id, "byte size", record.MaxByteSize)
+	}
+
+	return storableValue{storable}, change, nil
+}
+
+// SetLimits sets limits enforced on Insert, Append, and Set of array.
+// Limits are recorded in root extra data, so they apply to every Array
+// instance of the array and are persisted with it.  Zero limits remove
+// recorded limits.
+//
+// Deep byte size of elements is computed when MaxByteSize is first set,
+// and then updated by sizes of elements stored and removed.  Element is
+// measured before it is stored, and mutation is rejected if it would
+// make byte size greater than MaxByteSize.  Removals are always allowed.
+// Nested collections are measured when they are stored, replaced, or
+// removed, so mutations of nested collections through their own
+// instances aren't counted.
+func (a *Array) SetLimits(limits CollectionLimits) error {
+	extraData := a.root.ExtraData()
+
+	record, err := newLimitsRecord(a.Storage, a.StorageID(), extraData.Limits, limits)
+	if err != nil {
+		return err
+	}
+
+	extraData.Limits = record
+	return a.Storage.Store(a.root.ID(), a.root)
+}
+
+// Limits returns limits recorded by SetLimits.
+func (a *Array) Limits() CollectionLimits {
+	record := a.root.ExtraData().Limits
+	if record == nil {
+		return CollectionLimits{}
+	}
+	return record.CollectionLimits
+}
+
+// TrackedByteSize returns deep byte size of elements tracked for
+// MaxByteSize limit, or 0 if MaxByteSize isn't set.
+func (a *Array) TrackedByteSize() uint64 {
+	record := a.root.ExtraData().Limits
+	if record == nil {
+		return 0
+	}
+	return record.ByteSize
+}
+
+// checkLimits returns CollectionLimitError if value can't be stored at
+// index, inserting new element if insert is true.  If MaxByteSize is
+// set, value is converted to storable and measured before it is stored,
+// and returned value reuses the storable.
+func (a *Array) checkLimits(index uint64, insert bool, value Value) (Value, byteSizeChange, error) {
+	var change byteSizeChange
+
+	record := a.root.ExtraData().Limits
+	if record == nil {
+		return value, change, nil
+	}
+
+	if insert && record.MaxCount != 0 && a.Count() >= record.MaxCount {
+		return nil, change, NewCollectionLimitError(a.StorageID(), "element count", record.MaxCount)
+	}
+
+	if record.MaxByteSize == 0 {
+		return value, change, nil
+	}
+
+	if insert {
+		if index > a.Count() {
+			// Insert reports index out of bounds.
+			return value, change, nil
+		}
+	} else {
+		old, err := a.root.Get(a.Storage, index)
+		if err != nil {
+			err = withIndexOutOfBoundsContext(err, a.StorageID(), index, a.Count())
+			return nil, change, wrapRootSlabPathError(err, a.StorageID())
+		}
+		change.removed, err = deepStorableSize(a.Storage, old)
+		if err != nil {
+			return nil, change, err
+		}
+	}
+
+	return measureStoredValue(a.Storage, a.StorageID(), a.Address(), MaxInlineArrayElementSize, record, value, change)
+}
+
+// trackByteSize applies change of byte size made by mutation to
+// recorded limits in root extra data, and returns true if root needs to
+// be stored.  Root is stored by caller after it is rebalanced, so
+// recorded byte size is updated in the same step as the mutation.
+func (a *Array) trackByteSize(change byteSizeChange) bool {
+	record := a.root.ExtraData().Limits
+	if record == nil || record.MaxByteSize == 0 || change == (byteSizeChange{}) {
+		return false
+	}
+	record.ByteSize = change.apply(record.ByteSize)
+	return true
+}
+
+// removedByteSize returns change of byte size made by removing elements
+// in [startIndex, endIndex).  Elements are measured before they are
+// removed, so a failed measurement doesn't leave removal half applied.
+func (a *Array) removedByteSize(startIndex uint64, endIndex uint64) (byteSizeChange, error) {
+	var change byteSizeChange
+
+	record := a.root.ExtraData().Limits
+	if record == nil || record.MaxByteSize == 0 || startIndex >= endIndex || endIndex > a.Count() {
+		// Removal reports invalid range.
+		return change, nil
+	}
+
+	dataSlab, index, err := getArrayDataSlabWithIndex(a.Storage, a.root, startIndex)
+	if err != nil {
+		return change, wrapRootSlabPathError(err, a.StorageID())
+	}
+
+	for remaining := endIndex - startIndex; remaining > 0; remaining-- {
+		for index >= uint64(len(dataSlab.elements)) {
+			slab, err := getArraySlab(a.Storage, dataSlab.next)
+			if err != nil {
+				return change, err
+			}
+			dataSlab = slab.(*ArrayDataSlab)
+			index = 0
+		}
+
+		size, err := deepStorableSize(a.Storage, dataSlab.elements[index])
+		if err != nil {
+			return change, err
+		}
+		change.removed += size
+		index++
+	}
+
+	return change, nil
+}
+
+// SetLimits sets limits enforced on Set of map.  Limits are recorded in
+// root extra data, so they apply to every OrderedMap instance of the
+// map and are persisted with it.  Zero limits remove recorded limits.
+//
+// Deep byte size of values is computed when MaxByteSize is first set,
+// and then updated by sizes of values stored and removed.  Value is
+// measured before it is stored, and mutation is rejected if it would
+// make byte size greater than MaxByteSize.  Removals are always allowed.
+// Nested collections are measured when they are stored, replaced, or
+// removed, so mutations of nested collections through their own
+// instances aren't counted.
+func (m *OrderedMap) SetLimits(limits CollectionLimits) error {
+	extraData := m.root.ExtraData()
+
+	record, err := newLimitsRecord(m.Storage, m.StorageID(), extraData.Limits, limits)
+	if err != nil {
+		return err
+	}
+
+	extraData.Limits = record
+	return m.Storage.Store(m.root.ID(), m.root)
+}
+
+// Limits returns limits recorded by SetLimits.
+func (m *OrderedMap) Limits() CollectionLimits {
+	record := m.root.ExtraData().Limits
+	if record == nil {
+		return CollectionLimits{}
+	}
+	return record.CollectionLimits
+}
+
+// TrackedByteSize returns deep byte size of values tracked for
+// MaxByteSize limit, or 0 if MaxByteSize isn't set.
+func (m *OrderedMap) TrackedByteSize() uint64 {
+	record := m.root.ExtraData().Limits
+	if record == nil {
+		return 0
+	}
+	return record.ByteSize
+}
+
+// checkLimits returns CollectionLimitError if value of key can't be
+// stored.  If MaxByteSize is set, value is converted to storable and
+// measured before it is stored, and returned value reuses the storable.
+func (m *OrderedMap) checkLimits(comparator ValueComparator, keyDigest Digester, hkey Digest, key Value, value Value) (Value, byteSizeChange, error) {
+	var change byteSizeChange
+
+	record := m.root.ExtraData().Limits
+	if record == nil {
+		return value, change, nil
+	}
+
+	old, err := m.root.Get(m.Storage, keyDigest, 0, hkey, comparator, key)
+	if err != nil {
+		var keyNotFoundError *KeyNotFoundError
+		if !errors.As(err, &keyNotFoundError) {
+			return nil, change, wrapRootSlabPathError(err, m.StorageID())
+		}
+		old = nil
+	}
+
+	return m.checkLimitsReplacing(old, value)
+}
+
+// checkLimitsReplacing checks limits of storing value in place of old
+// value storable, or under new key if old is nil.
+func (m *OrderedMap) checkLimitsReplacing(old Storable, value Value) (Value, byteSizeChange, error) {
+	var change byteSizeChange
+
+	record := m.root.ExtraData().Limits
+	if record == nil {
+		return value, change, nil
+	}
+
+	// Only new keys are limited by MaxCount.
+	if old == nil && record.MaxCount != 0 && m.Count() >= record.MaxCount {
+		return nil, change, NewCollectionLimitError(m.StorageID(), "element count", record.MaxCount)
+	}
+
+	if record.MaxByteSize == 0 {
+		return value, change, nil
+	}
+
+	if old != nil {
+		var err error
+		change.removed, err = deepStorableSize(m.Storage, old)
+		if err != nil {
+			return nil, change, err
+		}
+	}
+
+	return measureStoredValue(m.Storage, m.StorageID(), m.Address(), MaxInlineMapKeyOrValueSize, record, value, change)
+}
+
+// trackByteSize applies change of byte size made by mutation to
+// recorded limits in root extra data, and returns true if root needs to
+// be stored.  Root is stored by caller after it is rebalanced, so
+// recorded byte size is updated in the same step as the mutation.
+func (m *OrderedMap) trackByteSize(change byteSizeChange) bool {
+	record := m.root.ExtraData().Limits
+	if record == nil || record.MaxByteSize == 0 || change == (byteSizeChange{}) {
+		return false
+	}
+	record.ByteSize = change.apply(record.ByteSize)
+	return true
+}
+
+// removedByteSize returns change of byte size made by removing value of
+// key.  Value is measured before it is removed, so a failed measurement
+// doesn't leave removal half applied.
+func (m *OrderedMap) removedByteSize(comparator ValueComparator, keyDigest Digester, hkey Digest, key Value) (byteSizeChange, error) {
+	var change byteSizeChange
+
+	record := m.root.ExtraData().Limits
+	if record == nil || record.MaxByteSize == 0 {
+		return change, nil
+	}
+
+	old, err := m.root.Get(m.Storage, keyDigest, 0, hkey, comparator, key)
+	if err != nil {
+		var keyNotFoundError *KeyNotFoundError
+		if errors.As(err, &keyNotFoundError) {
+			// Removal reports key not found.
+			return change, nil
+		}
+		return change, wrapRootSlabPathError(err, m.StorageID())
+	}
+
+	change.removed, err = deepStorableSize(m.Storage, old)
+	return change, err
+}
+
+// deepStorableSize returns byte size of storable and of slabs
+// reachable from it.
+func deepStorableSize(storage SlabStorage, storable Storable) (uint64, error) {
+	size := uint64(storable.ByteSize())
+
+	pending := appendChildSlabIDs(nil, []Storable{storable})
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		slab, found, err := storage.Retrieve(id)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, NewSlabNotFoundErrorf(id, "slab not found during size computation")
+		}
+
+		size += uint64(slab.ByteSize())
+		pending = appendChildSlabIDs(pending, slab.ChildStorables())
+	}
+
+	return size, nil
+}
+
+// forEachElementStorable calls fn with key and value storables of
+// elements of collection with root slab id.  Key is nil for arrays.
+func forEachElementStorable(storage SlabStorage, id StorageID, fn func(key Storable, value Storable) error) error {
+	slab, found, err := storage.Retrieve(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return NewSlabNotFoundErrorf(id, "slab not found during element traversal")
+	}
+
+	switch slab := slab.(type) {
+	case *ArrayDataSlab:
+		for _, e := range slab.elements {
+			err := fn(nil, e)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *MapDataSlab:
+		return forEachMapElementStorable(storage, slab.elements, fn)
+
+	case *ArrayMetaDataSlab, *MapMetaDataSlab:
+		for _, child := range slab.ChildStorables() {
+			err := forEachElementStorable(storage, StorageID(child.(StorageIDStorable)), fn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return NewSlabDataErrorf("slab %s isn't a collection slab", id)
+}
+
+func forEachMapElementStorable(storage SlabStorage, elems elements, fn func(key Storable, value Storable) error) error {
+	var list []element
+	switch elems := elems.(type) {
+	case *hkeyElements:
+		list = elems.elems
+	case *singleElements:
+		for _, e := range elems.elems {
+			list = append(list, e)
+		}
+	}
+
+	for _, e := range list {
+		var err error
+		switch e := e.(type) {
+		case *singleElement:
+			err = fn(e.key, e.value)
+
+		case *inlineCollisionGroup:
+			err = forEachMapElementStorable(storage, e.elements, fn)
+
+		case *externalCollisionGroup:
+			err = forEachElementStorable(storage, e.id, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayLimits(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var limitError *CollectionLimitError
+
+	t.Run("count", func(t *testing.T) {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		require.NoError(t, array.SetLimits(CollectionLimits{MaxCount: 3}))
+
+		for i := uint64(0); i < 3; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+		}
+
+		err = array.Append(Uint64Value(3))
+		require.ErrorAs(t, err, &limitError)
+		require.True(t, IsUserError(err))
+
+		err = array.Insert(0, Uint64Value(3))
+		require.ErrorAs(t, err, &limitError)
+
+		// Set doesn't change count.
+		_, err = array.Set(0, Uint64Value(10))
+		require.NoError(t, err)
+
+		_, err = array.Remove(0)
+		require.NoError(t, err)
+
+		require.NoError(t, array.Append(Uint64Value(3)))
+		require.Equal(t, uint64(3), array.Count())
+	})
+
+	t.Run("byte size", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		for i := uint64(0); i < 10; i++ {
+			require.NoError(t, child.Append(Uint64Value(i)))
+		}
+
+		require.NoError(t, array.Append(Uint64Value(0)))
+		require.NoError(t, array.Append(child))
+
+		childSize := uint64(StorageIDStorable{}.ByteSize()) + uint64(child.root.ByteSize())
+		expectedSize := uint64(Uint64Value(0).ByteSize()) + childSize
+
+		// Existing elements, including nested array, are counted by SetLimits.
+		require.NoError(t, array.SetLimits(CollectionLimits{MaxByteSize: 2048}))
+		require.Equal(t, expectedSize, array.TrackedByteSize())
+
+		// Large string stored in external slab would exceed limit, so it
+		// is rejected before it is stored and its slab is released.
+		large := NewStringValue(strings.Repeat("a", 2048))
+		err = array.Append(large)
+		require.ErrorAs(t, err, &limitError)
+		require.True(t, IsUserError(err))
+		require.Equal(t, expectedSize, array.TrackedByteSize())
+		require.Equal(t, uint64(2), array.Count())
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+
+		medium := NewStringValue(strings.Repeat("a", 1024))
+		require.NoError(t, array.Append(medium))
+		mediumSize := array.TrackedByteSize() - expectedSize
+		require.True(t, mediumSize > 1024)
+
+		err = array.Append(medium)
+		require.ErrorAs(t, err, &limitError)
+
+		_, err = array.Set(0, medium)
+		require.ErrorAs(t, err, &limitError)
+
+		// Set is checked against byte size without replaced element.
+		_, err = array.Set(0, Uint64Value(1))
+		require.NoError(t, err)
+		require.Equal(t, expectedSize+mediumSize, array.TrackedByteSize())
+		require.True(t, array.TrackedByteSize() <= 2048)
+
+		// Removals are allowed and reduce tracked size.
+		_, err = array.Remove(2)
+		require.NoError(t, err)
+		require.Equal(t, expectedSize, array.TrackedByteSize())
+
+		_, err = array.Remove(1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(Uint64Value(0).ByteSize()), array.TrackedByteSize())
+
+		require.NoError(t, array.Append(Uint64Value(0)))
+	})
+
+	t.Run("remove range", func(t *testing.T) {
+		SetThreshold(256)
+		defer SetThreshold(1024)
+
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, array.SetLimits(CollectionLimits{MaxByteSize: 1 << 20}))
+
+		for i := uint64(0); i < 200; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+		}
+		require.False(t, array.root.IsData())
+
+		size := array.TrackedByteSize()
+
+		// Removed elements span multiple data slabs.
+		removed, err := array.RemoveRange(10, 150)
+		require.NoError(t, err)
+
+		removedSize := uint64(0)
+		for _, storable := range removed {
+			removedSize += uint64(storable.ByteSize())
+		}
+		require.Equal(t, size-removedSize, array.TrackedByteSize())
+		require.Equal(t, uint64(60), array.Count())
+	})
+
+	t.Run("failed removal", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		require.NoError(t, array.Append(Uint64Value(0)))
+		require.NoError(t, array.Append(child))
+		require.NoError(t, array.SetLimits(CollectionLimits{MaxByteSize: 2048}))
+		size := array.TrackedByteSize()
+
+		// Nested array can't be measured, so removal fails before
+		// element is removed.
+		require.NoError(t, storage.Remove(child.StorageID()))
+
+		_, err = array.Remove(1)
+		require.Error(t, err)
+
+		_, err = array.RemoveRange(0, 2)
+		require.Error(t, err)
+
+		require.Equal(t, uint64(2), array.Count())
+		require.Equal(t, size, array.TrackedByteSize())
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		require.NoError(t, array.Append(NewStringValue(strings.Repeat("a", 1024))))
+
+		limits := CollectionLimits{MaxCount: 3, MaxByteSize: 2048}
+		require.NoError(t, array.SetLimits(limits))
+		size := array.TrackedByteSize()
+
+		require.NoError(t, storage.Commit())
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		array2, err := NewArrayWithRootID(storage2, array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, limits, array2.Limits())
+		require.Equal(t, size, array2.TrackedByteSize())
+
+		err = array2.Append(NewStringValue(strings.Repeat("a", 1024)))
+		require.ErrorAs(t, err, &limitError)
+
+		// Changing limits keeps tracked byte size.
+		require.NoError(t, array2.SetLimits(CollectionLimits{MaxByteSize: 4096}))
+		require.Equal(t, size, array2.TrackedByteSize())
+
+		require.NoError(t, array2.SetLimits(CollectionLimits{}))
+		require.Equal(t, CollectionLimits{}, array2.Limits())
+		require.Equal(t, uint64(0), array2.TrackedByteSize())
+	})
+}
+
+func TestMapLimits(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var limitError *CollectionLimitError
+
+	t.Run("count", func(t *testing.T) {
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		require.NoError(t, m.SetLimits(CollectionLimits{MaxCount: 2}))
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(0))
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(1))
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(2), Uint64Value(2))
+		require.ErrorAs(t, err, &limitError)
+
+		// Existing key can be updated.
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(10))
+		require.NoError(t, err)
+
+		require.Equal(t, uint64(2), m.Count())
+	})
+
+	t.Run("byte size", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 10; i++ {
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, m.SetLimits(CollectionLimits{MaxByteSize: 1024}))
+
+		size := m.TrackedByteSize()
+		require.Equal(t, uint64(10*Uint64Value(0).ByteSize()), size)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), NewStringValue(strings.Repeat("a", 1024)))
+		require.ErrorAs(t, err, &limitError)
+		require.Equal(t, size, m.TrackedByteSize())
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+
+		medium := NewStringValue(strings.Repeat("a", 512))
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), medium)
+		require.NoError(t, err)
+		require.True(t, m.TrackedByteSize() > 512)
+		require.True(t, m.TrackedByteSize() <= 1024)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(100), medium)
+		require.ErrorAs(t, err, &limitError)
+
+		_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+		require.Equal(t, size-uint64(Uint64Value(0).ByteSize()), m.TrackedByteSize())
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(100), medium)
+		require.NoError(t, err)
+	})
+
+	t.Run("failed removal", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), child)
+		require.NoError(t, err)
+		require.NoError(t, m.SetLimits(CollectionLimits{MaxByteSize: 1024}))
+		size := m.TrackedByteSize()
+
+		// Nested array can't be measured, so removal fails before
+		// element is removed.
+		require.NoError(t, storage.Remove(child.StorageID()))
+
+		_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(0))
+		require.Error(t, err)
+
+		require.Equal(t, uint64(1), m.Count())
+		require.Equal(t, size, m.TrackedByteSize())
+
+		// Removing absent key reports key not found.
+		var keyNotFoundError *KeyNotFoundError
+		_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(1))
+		require.ErrorAs(t, err, &keyNotFoundError)
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		limits := CollectionLimits{MaxCount: 1}
+		require.NoError(t, m.SetLimits(limits))
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(0))
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Commit())
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		m2, err := NewMapWithRootID(storage2, m.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+		require.Equal(t, limits, m2.Limits())
+
+		_, err = m2.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(1))
+		require.ErrorAs(t, err, &limitError)
+	})
+}
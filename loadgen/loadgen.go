@@ -0,0 +1,508 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loadgen generates reproducible load on atree collections and
+// reports throughput and slab churn.  It is used by the repo's
+// benchmarks and can be used by embedders to measure performance of
+// their base storage:
+//
+//	report, err := loadgen.RunMap(base, loadgen.Config{
+//		Seed:       1,
+//		Ops:        100_000,
+//		Mix:        loadgen.OpMix{Insert: 2, Set: 1, Remove: 1, Get: 4},
+//		KeySize:    loadgen.UniformSize(8, 32),
+//		ValueSize:  loadgen.FixedSize(16),
+//		TargetSize: 10_000,
+//	})
+//
+// The same seed and config generate the same operations.
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/values"
+)
+
+// Op is collection operation generated by load generator.
+type Op int
+
+const (
+	// OpInsert inserts element at random index of array, or new key in map.
+	OpInsert Op = iota
+	// OpSet replaces random existing element.
+	OpSet
+	// OpRemove removes random existing element.
+	OpRemove
+	// OpGet reads random existing element.
+	OpGet
+	// OpIterate iterates up to IterateLength elements.
+	OpIterate
+
+	opCount
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpSet:
+		return "set"
+	case OpRemove:
+		return "remove"
+	case OpGet:
+		return "get"
+	case OpIterate:
+		return "iterate"
+	default:
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+}
+
+// IterateLength is maximum number of elements iterated by OpIterate.
+const IterateLength = 100
+
+// OpMix is relative weight of each operation.  Zero mix only inserts.
+type OpMix struct {
+	Insert  int
+	Set     int
+	Remove  int
+	Get     int
+	Iterate int
+}
+
+func (m OpMix) weights() [opCount]int {
+	return [opCount]int{m.Insert, m.Set, m.Remove, m.Get, m.Iterate}
+}
+
+// SizeDistribution returns byte size of generated key or value.
+type SizeDistribution func(r *rand.Rand) int
+
+// FixedSize returns distribution of size n.
+func FixedSize(n int) SizeDistribution {
+	return func(_ *rand.Rand) int {
+		return n
+	}
+}
+
+// UniformSize returns uniform distribution of sizes in [min, max].
+func UniformSize(min int, max int) SizeDistribution {
+	return func(r *rand.Rand) int {
+		return min + r.Intn(max-min+1)
+	}
+}
+
+// ExponentialSize returns exponential distribution of sizes with given
+// mean, capped at max.  It models mostly small values with a long tail
+// of large values.
+func ExponentialSize(mean int, max int) SizeDistribution {
+	return func(r *rand.Rand) int {
+		n := int(r.ExpFloat64() * float64(mean))
+		if n > max {
+			return max
+		}
+		return n
+	}
+}
+
+// Config configures generated load.
+type Config struct {
+	// Seed seeds random operations, keys and values.
+	Seed int64
+	// Ops is number of measured operations.
+	Ops int
+	// Mix is relative weight of operations.
+	Mix OpMix
+	// KeySize is byte size of string map keys.  Nil KeySize generates
+	// uint64 keys.  It is ignored by arrays.
+	KeySize SizeDistribution
+	// ValueSize is byte size of string values.  Nil ValueSize generates
+	// uint64 values.
+	ValueSize SizeDistribution
+	// TargetSize is number of elements inserted before measured
+	// operations.  Insert is replaced by Remove when collection has
+	// twice TargetSize elements, so collection size stays around target.
+	// Zero TargetSize doesn't limit collection size.
+	TargetSize int
+	// CommitInterval is number of operations between storage commits.
+	// Zero CommitInterval commits only at the end.
+	CommitInterval int
+}
+
+// Report is result of a load run.
+type Report struct {
+	// OpCounts is number of executed operations by type.
+	OpCounts map[Op]int
+	// Duration is time of measured operations, including commits.
+	Duration time.Duration
+	// Count is collection element count after the run.
+	Count uint64
+	// SlabsCreated, SlabsRemoved, Splits and Merges count slab churn
+	// caused by measured operations.
+	SlabsCreated uint64
+	SlabsRemoved uint64
+	Splits       uint64
+	Merges       uint64
+	// SegmentsUpdated and BytesStored are reported by base storage
+	// for commits of measured operations.
+	SegmentsUpdated int
+	BytesStored     int
+}
+
+// Throughput returns measured operations per second.
+func (r Report) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	var ops int
+	for _, n := range r.OpCounts {
+		ops += n
+	}
+	return float64(ops) / r.Duration.Seconds()
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"ops %v in %s (%.0f ops/s), count %d, slabs created %d removed %d, splits %d, merges %d, segments updated %d, bytes stored %d",
+		r.OpCounts,
+		r.Duration,
+		r.Throughput(),
+		r.Count,
+		r.SlabsCreated,
+		r.SlabsRemoved,
+		r.Splits,
+		r.Merges,
+		r.SegmentsUpdated,
+		r.BytesStored,
+	)
+}
+
+// address owns generated collections.
+var address = atree.Address{0, 0, 0, 0, 0, 0, 0, 1}
+
+// typeInfo is type info of generated collections, CBOR encoded uint 42.
+var typeInfo = inspect.RawTypeInfo{0x18, 0x2a}
+
+// generator holds state shared by array and map runs.
+type generator struct {
+	config  Config
+	rand    *rand.Rand
+	storage *atree.PersistentSlabStorage
+	base    atree.BaseStorage
+	report  Report
+	// measuring is true after collection is filled to target size.
+	measuring bool
+}
+
+func newGenerator(base atree.BaseStorage, config Config) (*generator, error) {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	if err != nil {
+		return nil, err
+	}
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed)),
+		base:   base,
+		report: Report{OpCounts: make(map[Op]int)},
+	}
+
+	hooks := atree.Hooks{
+		OnSlabCreated: func(atree.StorageID) {
+			if g.measuring {
+				g.report.SlabsCreated++
+			}
+		},
+		OnSlabRemoved: func(atree.StorageID) {
+			if g.measuring {
+				g.report.SlabsRemoved++
+			}
+		},
+		OnSlabSplit: func(atree.StorageID, atree.StorageID, atree.StorageID) {
+			if g.measuring {
+				g.report.Splits++
+			}
+		},
+		OnSlabMerge: func(atree.StorageID, atree.StorageID) {
+			if g.measuring {
+				g.report.Merges++
+			}
+		},
+	}
+
+	g.storage = atree.NewPersistentSlabStorage(
+		base,
+		encMode,
+		decMode,
+		values.DecodeStorable,
+		inspect.DecodeRawTypeInfo,
+		atree.WithHooks(hooks),
+	)
+
+	return g, nil
+}
+
+// nextOp returns random operation of mix for collection of given count.
+func (g *generator) nextOp(count int) Op {
+	weights := g.config.Mix.weights()
+
+	var total int
+	for _, w := range weights {
+		total += w
+	}
+
+	op := OpInsert
+	if total > 0 {
+		n := g.rand.Intn(total)
+		for i, w := range weights {
+			if n < w {
+				op = Op(i)
+				break
+			}
+			n -= w
+		}
+	}
+
+	switch {
+	case count == 0 && op != OpIterate:
+		return OpInsert
+	case op == OpInsert && g.config.TargetSize > 0 && count >= 2*g.config.TargetSize:
+		return OpRemove
+	default:
+		return op
+	}
+}
+
+func (g *generator) randomString(size SizeDistribution) values.StringValue {
+	n := size(g.rand)
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = 'a' + byte(g.rand.Intn(26))
+	}
+	return values.NewStringValue(string(b))
+}
+
+func (g *generator) newValue() atree.Value {
+	if g.config.ValueSize == nil {
+		return values.Uint64Value(g.rand.Uint64())
+	}
+	return g.randomString(g.config.ValueSize)
+}
+
+func (g *generator) newKey() atree.Value {
+	if g.config.KeySize == nil {
+		return values.Uint64Value(g.rand.Uint64())
+	}
+	return g.randomString(g.config.KeySize)
+}
+
+// run fills collection to target size, then runs measured operations
+// with exec, committing storage every CommitInterval operations.
+func (g *generator) run(count func() int, exec func(op Op) error) (Report, error) {
+
+	for count() < g.config.TargetSize {
+		err := exec(OpInsert)
+		if err != nil {
+			return Report{}, err
+		}
+	}
+
+	err := g.storage.Commit()
+	if err != nil {
+		return Report{}, err
+	}
+
+	g.base.ResetReporter()
+	g.measuring = true
+
+	start := time.Now()
+
+	for i := 0; i < g.config.Ops; i++ {
+		op := g.nextOp(count())
+
+		err := exec(op)
+		if err != nil {
+			return Report{}, fmt.Errorf("%s: %w", op, err)
+		}
+		g.report.OpCounts[op]++
+
+		if g.config.CommitInterval > 0 && (i+1)%g.config.CommitInterval == 0 {
+			err = g.storage.Commit()
+			if err != nil {
+				return Report{}, err
+			}
+		}
+	}
+
+	err = g.storage.Commit()
+	if err != nil {
+		return Report{}, err
+	}
+
+	g.report.Duration = time.Since(start)
+	g.report.Count = uint64(count())
+	g.report.SegmentsUpdated = g.base.SegmentsUpdated()
+	g.report.BytesStored = g.base.BytesStored()
+
+	return g.report, nil
+}
+
+// RunArray runs load on a new array in base storage.
+func RunArray(base atree.BaseStorage, config Config) (Report, error) {
+	g, err := newGenerator(base, config)
+	if err != nil {
+		return Report{}, err
+	}
+
+	array, err := atree.NewArray(g.storage, address, typeInfo)
+	if err != nil {
+		return Report{}, err
+	}
+
+	count := func() int {
+		return int(array.Count())
+	}
+
+	return g.run(count, func(op Op) error {
+		n := array.Count()
+
+		switch op {
+		case OpInsert:
+			return array.Insert(uint64(g.rand.Int63n(int64(n)+1)), g.newValue())
+
+		case OpSet:
+			existing, err := array.Set(uint64(g.rand.Int63n(int64(n))), g.newValue())
+			if err != nil {
+				return err
+			}
+			return removeStorable(g.storage, existing)
+
+		case OpRemove:
+			existing, err := array.Remove(uint64(g.rand.Int63n(int64(n))))
+			if err != nil {
+				return err
+			}
+			return removeStorable(g.storage, existing)
+
+		case OpGet:
+			_, err := array.Get(uint64(g.rand.Int63n(int64(n))))
+			return err
+
+		default:
+			if n == 0 {
+				return nil
+			}
+			start := uint64(g.rand.Int63n(int64(n)))
+			end := start + IterateLength
+			if end > n {
+				end = n
+			}
+			return array.IterateRange(start, end, func(atree.Value) (bool, error) {
+				return true, nil
+			})
+		}
+	})
+}
+
+// RunMap runs load on a new map in base storage.
+func RunMap(base atree.BaseStorage, config Config) (Report, error) {
+	g, err := newGenerator(base, config)
+	if err != nil {
+		return Report{}, err
+	}
+
+	m, err := atree.NewMap(g.storage, address, atree.NewDefaultDigesterBuilder(), typeInfo)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// keys are existing map keys, for picking random existing key.
+	var keys []atree.Value
+
+	count := func() int {
+		return len(keys)
+	}
+
+	return g.run(count, func(op Op) error {
+		switch op {
+		case OpInsert:
+			key := g.newKey()
+			existing, err := m.Set(values.Compare, values.HashInputProvider, key, g.newValue())
+			if err != nil {
+				return err
+			}
+			if existing == nil {
+				keys = append(keys, key)
+				return nil
+			}
+			return removeStorable(g.storage, existing)
+
+		case OpSet:
+			key := keys[g.rand.Intn(len(keys))]
+			existing, err := m.Set(values.Compare, values.HashInputProvider, key, g.newValue())
+			if err != nil {
+				return err
+			}
+			return removeStorable(g.storage, existing)
+
+		case OpRemove:
+			i := g.rand.Intn(len(keys))
+			existingKey, existingValue, err := m.Remove(values.Compare, values.HashInputProvider, keys[i])
+			if err != nil {
+				return err
+			}
+			keys[i] = keys[len(keys)-1]
+			keys = keys[:len(keys)-1]
+			err = removeStorable(g.storage, existingKey)
+			if err != nil {
+				return err
+			}
+			return removeStorable(g.storage, existingValue)
+
+		case OpGet:
+			_, err := m.Get(values.Compare, values.HashInputProvider, keys[g.rand.Intn(len(keys))])
+			return err
+
+		default:
+			n := 0
+			return m.Iterate(func(atree.Value, atree.Value) (bool, error) {
+				n++
+				return n < IterateLength, nil
+			})
+		}
+	})
+}
+
+// removeStorable removes slab of storable replaced or removed from
+// collection, if storable is stored in a separate slab.
+func removeStorable(storage atree.SlabStorage, storable atree.Storable) error {
+	if id, ok := storable.(atree.StorageIDStorable); ok {
+		return storage.Remove(atree.StorageID(id))
+	}
+	return nil
+}
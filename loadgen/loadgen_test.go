@@ -0,0 +1,124 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadgen
+
+import (
+	"testing"
+
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/values"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBaseStorage(tb testing.TB) atree.BaseStorage {
+	base, err := inspect.NewDirBaseStorage(tb.TempDir())
+	require.NoError(tb, err)
+	return base
+}
+
+func checkHealth(t *testing.T, base atree.BaseStorage) {
+	inspector, err := inspect.NewInspector(base, values.DecodeStorable, nil)
+	require.NoError(t, err)
+
+	count, err := inspector.CheckHealth()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestRun(t *testing.T) {
+
+	config := Config{
+		Seed:           42,
+		Ops:            2000,
+		Mix:            OpMix{Insert: 3, Set: 2, Remove: 2, Get: 2, Iterate: 1},
+		KeySize:        UniformSize(4, 32),
+		ValueSize:      ExponentialSize(32, 2048),
+		TargetSize:     200,
+		CommitInterval: 100,
+	}
+
+	for name, run := range map[string]func(atree.BaseStorage, Config) (Report, error){
+		"array": RunArray,
+		"map":   RunMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			base := newTestBaseStorage(t)
+
+			report, err := run(base, config)
+			require.NoError(t, err)
+
+			var ops int
+			for op, n := range report.OpCounts {
+				require.True(t, op < opCount)
+				ops += n
+			}
+			require.Equal(t, config.Ops, ops)
+			require.True(t, report.OpCounts[OpRemove] > 0)
+			require.True(t, report.Count <= uint64(2*config.TargetSize))
+			require.True(t, report.SlabsCreated > 0)
+			require.True(t, report.SegmentsUpdated > 0)
+			require.True(t, report.Throughput() > 0)
+
+			checkHealth(t, base)
+
+			// Same seed and config generate the same load.
+			again, err := run(newTestBaseStorage(t), config)
+			require.NoError(t, err)
+			require.Equal(t, report.OpCounts, again.OpCounts)
+			require.Equal(t, report.Count, again.Count)
+			require.Equal(t, report.SlabsCreated, again.SlabsCreated)
+			require.Equal(t, report.BytesStored, again.BytesStored)
+		})
+	}
+}
+
+func TestRunInsertOnly(t *testing.T) {
+	report, err := RunMap(newTestBaseStorage(t), Config{Seed: 1, Ops: 500})
+	require.NoError(t, err)
+	require.Equal(t, map[Op]int{OpInsert: 500}, report.OpCounts)
+	require.Equal(t, uint64(500), report.Count)
+}
+
+func BenchmarkRunArray(b *testing.B) {
+	benchmarkRun(b, RunArray)
+}
+
+func BenchmarkRunMap(b *testing.B) {
+	benchmarkRun(b, RunMap)
+}
+
+func benchmarkRun(b *testing.B, run func(atree.BaseStorage, Config) (Report, error)) {
+	config := Config{
+		Seed:       1,
+		Ops:        b.N,
+		Mix:        OpMix{Insert: 2, Set: 1, Remove: 1, Get: 4},
+		ValueSize:  FixedSize(16),
+		TargetSize: 10_000,
+	}
+
+	b.ResetTimer()
+
+	report, err := run(newTestBaseStorage(b), config)
+	require.NoError(b, err)
+
+	// Elapsed time includes filling collection to target size.
+	b.ReportMetric(float64(report.Duration.Nanoseconds())/float64(b.N), "measured-ns/op")
+	b.ReportMetric(float64(report.SlabsCreated+report.SlabsRemoved)/float64(b.N), "slabchurn/op")
+}
@@ -0,0 +1,120 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "time"
+
+// Logger receives diagnostic events of storage and collections.
+// Fields are alternating keys (strings) and values.
+//
+// Events logged at Warn level indicate unexpected conditions that
+// don't fail the operation, such as slow retrieves and oversized elements.
+// Validation failures are logged at Debug level since they are also
+// returned as errors.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+}
+
+// DefaultSlowRetrieveThreshold is the duration of base storage retrieve
+// logged as slow retrieve, unless changed with WithSlowRetrieveThreshold.
+const DefaultSlowRetrieveThreshold = 100 * time.Millisecond
+
+// WithLogger sets logger of storage and of collections using the storage.
+func WithLogger(logger Logger) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.logger = logger
+		if st.slowRetrieveThreshold == 0 {
+			st.slowRetrieveThreshold = DefaultSlowRetrieveThreshold
+		}
+		return st
+	}
+}
+
+// WithSlowRetrieveThreshold sets minimum duration of base storage retrieve
+// logged as slow retrieve.
+func WithSlowRetrieveThreshold(threshold time.Duration) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.slowRetrieveThreshold = threshold
+		return st
+	}
+}
+
+// loggerStorage is implemented by storage with logger.
+type loggerStorage interface {
+	storageLogger() Logger
+}
+
+func (s *PersistentSlabStorage) storageLogger() Logger {
+	return s.logger
+}
+
+func loggerOf(storage SlabStorage) Logger {
+	s, ok := unwrapSlabStorage(storage).(loggerStorage)
+	if !ok {
+		return nil
+	}
+	return s.storageLogger()
+}
+
+// SetLogger sets logger of this Array instance, overriding storage logger.
+// Logger isn't persisted, it only applies to this Array instance.
+func (a *Array) SetLogger(logger Logger) {
+	a.logger = logger
+}
+
+func (a *Array) getLogger() Logger {
+	if a.logger != nil {
+		return a.logger
+	}
+	return loggerOf(a.Storage)
+}
+
+// SetLogger sets logger of this OrderedMap instance, overriding storage logger.
+// Logger isn't persisted, it only applies to this OrderedMap instance.
+func (m *OrderedMap) SetLogger(logger Logger) {
+	m.logger = logger
+}
+
+func (m *OrderedMap) getLogger() Logger {
+	if m.logger != nil {
+		return m.logger
+	}
+	return loggerOf(m.Storage)
+}
+
+func logInvalidElement(logger Logger, id StorageID, err error) {
+	if logger != nil {
+		logger.Debug("invalid element", "id", id, "error", err)
+	}
+}
+
+// logOversizedElement logs storable exceeding max inline element size.
+// Values are expected to store large elements in separate slabs, so
+// oversized inline elements indicate incorrect Value.Storable implementation.
+func logOversizedElement(storage SlabStorage, address Address, storable Storable, maxInlineSize uint64) {
+	logger := loggerOf(storage)
+	if logger == nil {
+		return
+	}
+	size := storable.ByteSize()
+	if uint64(size) > maxInlineSize {
+		logger.Warn("oversized element", "address", address, "size", size, "max", maxInlineSize)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testLogEntry struct {
+	level  string
+	msg    string
+	fields []interface{}
+}
+
+type testLogger struct {
+	entries []testLogEntry
+}
+
+var _ Logger = &testLogger{}
+
+func (l *testLogger) Debug(msg string, fields ...interface{}) {
+	l.entries = append(l.entries, testLogEntry{level: "debug", msg: msg, fields: fields})
+}
+
+func (l *testLogger) Warn(msg string, fields ...interface{}) {
+	l.entries = append(l.entries, testLogEntry{level: "warn", msg: msg, fields: fields})
+}
+
+func (l *testLogger) count(msg string) int {
+	n := 0
+	for _, e := range l.entries {
+		if e.msg == msg {
+			n++
+		}
+	}
+	return n
+}
+
+// inlineStringValue is StringValue always stored inline regardless of size.
+type inlineStringValue struct {
+	StringValue
+}
+
+func (v inlineStringValue) Storable(_ SlabStorage, _ Address, _ uint64) (Storable, error) {
+	return v.StringValue, nil
+}
+
+func TestLogger(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("slow retrieve", func(t *testing.T) {
+		logger := &testLogger{}
+
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = array.Append(Uint64Value(0))
+		require.NoError(t, err)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		storage2 := newTestPersistentStorageWithBaseStorage(
+			t,
+			storage.baseStorage,
+			WithLogger(logger),
+			WithSlowRetrieveThreshold(time.Nanosecond),
+		)
+
+		_, err = NewArrayWithRootID(storage2, array.StorageID())
+		require.NoError(t, err)
+
+		require.Equal(t, 1, logger.count("slow slab retrieve"))
+		require.Equal(t, "warn", logger.entries[0].level)
+		require.Equal(t, []interface{}{"id", array.StorageID()}, logger.entries[0].fields[:2])
+	})
+
+	t.Run("oversized element", func(t *testing.T) {
+		logger := &testLogger{}
+
+		storage := newTestPersistentStorage(t, WithLogger(logger))
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = array.Append(NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize))))
+		require.NoError(t, err)
+		require.Equal(t, 0, logger.count("oversized element"))
+
+		err = array.Append(inlineStringValue{NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))})
+		require.NoError(t, err)
+		require.Equal(t, 1, logger.count("oversized element"))
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), inlineStringValue{NewStringValue(strings.Repeat("a", int(MaxInlineMapKeyOrValueSize)))})
+		require.NoError(t, err)
+		require.Equal(t, 2, logger.count("oversized element"))
+	})
+
+	t.Run("invalid element", func(t *testing.T) {
+		storageLogger := &testLogger{}
+		arrayLogger := &testLogger{}
+
+		storage := newTestPersistentStorage(t, WithLogger(storageLogger))
+
+		validationErr := errors.New("invalid")
+		validator := func(TypeInfo, Value) error { return validationErr }
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+		m.SetElementValidators(validator, nil)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(0))
+		var invalidElementError *InvalidElementError
+		require.ErrorAs(t, err, &invalidElementError)
+		require.Equal(t, 1, storageLogger.count("invalid element"))
+
+		// Collection logger overrides storage logger.
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		array.SetElementValidator(validator)
+		array.SetLogger(arrayLogger)
+
+		err = array.Append(Uint64Value(0))
+		require.ErrorAs(t, err, &invalidElementError)
+		require.Equal(t, 1, storageLogger.count("invalid element"))
+		require.Equal(t, 1, arrayLogger.count("invalid element"))
+		require.Equal(t, "debug", arrayLogger.entries[0].level)
+	})
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync/atomic"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/fxamacker/circlehash"
@@ -213,9 +214,32 @@ type MapSlabHeader struct {
 }
 
 type MapExtraData struct {
-	TypeInfo TypeInfo
-	Count    uint64
-	Seed     uint64
+	TypeInfo     TypeInfo
+	Count        uint64
+	Seed         uint64
+	DigesterType DigesterType
+	// DigesterKeyID identifies secret key of DigesterTypeBlake3SecretKey digester.
+	DigesterKeyID uint64
+	// Migration is progress of in-place migration, or nil if map isn't being migrated.
+	Migration *MigrationProgress
+	// ExtraRefs is number of parent references to map beyond the first.
+	ExtraRefs uint64
+	// UserMetadata is application metadata, or nil if it isn't set.
+	UserMetadata *UserMetadata
+	// InsertionOrder is root ID of array of keys in insertion order, or
+	// StorageIDUndefined if map isn't created by NewInsertionOrderedMap.
+	InsertionOrder StorageID
+	// MutationSequence is number of map mutations plus one, or 0 if
+	// mutation sequence isn't enabled.
+	MutationSequence uint64
+	// Provenance is creation metadata, or nil if map was created
+	// without provenance.
+	Provenance *Provenance
+	// Nesting is nesting information, or nil if map isn't mutated
+	// with nesting depth limit.
+	Nesting *Nesting
+	// Limits is limits set by SetLimits, or nil if map has no limits.
+	Limits *LimitsRecord
 }
 
 // MapDataSlab is leaf node, implementing MapSlab.
@@ -278,12 +302,35 @@ type OrderedMap struct {
 	Storage         SlabStorage
 	root            MapSlab
 	digesterBuilder DigesterBuilder
+	keyValidator    ElementValidator
+	valueValidator  ElementValidator
+	logger          Logger
+	changeSink      ChangeSink
+	journal         *operationJournal
+	stats           OperationStats
+	statsStorage    atomic.Value
+	// insertionOrder is loaded array of keys in insertion order.
+	insertionOrder *Array
 }
 
 var _ Value = &OrderedMap{}
 
 const mapExtraDataLength = 3
 
+// Keys of optional map extra data fields.
+const (
+	mapExtraDataFieldDigesterType     = 1
+	mapExtraDataFieldDigesterKeyID    = 2
+	mapExtraDataFieldMigration        = 3
+	mapExtraDataFieldExtraRefs        = 4
+	mapExtraDataFieldUserMetadata     = 5
+	mapExtraDataFieldInsertionOrder   = 6
+	mapExtraDataFieldMutationSequence = 7
+	mapExtraDataFieldProvenance       = 8
+	mapExtraDataFieldNesting          = 9
+	mapExtraDataFieldLimits           = 10
+)
+
 func newMapExtraDataFromData(
 	data []byte,
 	decMode cbor.DecMode,
@@ -295,13 +342,13 @@ func newMapExtraDataFromData(
 ) {
 	// Check data length
 	if len(data) < versionAndFlagSize {
-		return nil, data, errors.New("data is too short for map extra data")
+		return nil, data, NewDecodingErrorf("data is too short for map extra data")
 	}
 
 	// Check flag
 	flag := data[1]
 	if !isRoot(flag) {
-		return nil, data, fmt.Errorf("data has invalid flag 0x%x, want root flag", flag)
+		return nil, data, NewDecodingErrorf("data has invalid flag 0x%x, want root flag", flag)
 	}
 
 	// Decode extra data
@@ -313,11 +360,12 @@ func newMapExtraDataFromData(
 		return nil, data, err
 	}
 
-	if length != mapExtraDataLength {
-		return nil, data, fmt.Errorf(
-			"data has invalid length %d, want %d",
+	if length != mapExtraDataLength && length != mapExtraDataLength+1 {
+		return nil, data, NewDecodingErrorf(
+			"data has invalid length %d, want %d or %d",
 			length,
 			mapExtraDataLength,
+			mapExtraDataLength+1,
 		)
 	}
 
@@ -336,15 +384,274 @@ func newMapExtraDataFromData(
 		return nil, data, err
 	}
 
+	extraData := &MapExtraData{
+		TypeInfo: typeInfo,
+		Count:    count,
+		Seed:     seed,
+	}
+
+	if length > mapExtraDataLength {
+		err = extraData.decodeOptionalFields(dec)
+		if err != nil {
+			return nil, data, err
+		}
+	}
+
 	// Reslice for remaining data
 	n := dec.NumBytesDecoded()
 	data = data[versionAndFlagSize+n:]
 
-	return &MapExtraData{
-		TypeInfo: typeInfo,
-		Count:    count,
-		Seed:     seed,
-	}, data, nil
+	return extraData, data, nil
+}
+
+// decodeOptionalFields decodes optional fields encoded by encodeOptionalFields.
+func (m *MapExtraData) decodeOptionalFields(dec *cbor.StreamDecoder) error {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return err
+	}
+
+	if length%2 != 0 {
+		return NewDecodingErrorf("optional fields have invalid length %d, want even length", length)
+	}
+
+	for i := uint64(0); i < length/2; i++ {
+		key, err := dec.DecodeUint64()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case mapExtraDataFieldDigesterType:
+			digesterType, err := dec.DecodeUint64()
+			if err != nil {
+				return err
+			}
+			m.DigesterType = DigesterType(digesterType)
+
+		case mapExtraDataFieldDigesterKeyID:
+			m.DigesterKeyID, err = dec.DecodeUint64()
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldMigration:
+			m.Migration, err = decodeMigrationProgress(dec)
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldExtraRefs:
+			m.ExtraRefs, err = dec.DecodeUint64()
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldUserMetadata:
+			m.UserMetadata, err = decodeUserMetadata(dec)
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldInsertionOrder:
+			m.InsertionOrder, err = decodeStorageIDField(dec)
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldMutationSequence:
+			m.MutationSequence, err = dec.DecodeUint64()
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldProvenance:
+			m.Provenance, err = decodeProvenance(dec)
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldNesting:
+			m.Nesting, err = decodeNesting(dec)
+			if err != nil {
+				return err
+			}
+
+		case mapExtraDataFieldLimits:
+			m.Limits, err = decodeLimitsRecord(dec)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return NewDecodingErrorf("optional field has unknown key %d", key)
+		}
+	}
+
+	return nil
+}
+
+// hasDigesterKeyID returns true if digester uses secret key.
+// Key ID is encoded even if it is zero, because zero is a valid key ID.
+func (m *MapExtraData) hasDigesterKeyID() bool {
+	return m.DigesterType == DigesterTypeBlake3SecretKey
+}
+
+// optionalFieldCount returns number of optional fields with non-default values.
+func (m *MapExtraData) optionalFieldCount() uint64 {
+	var count uint64
+	if m.DigesterType != DigesterTypeDefault {
+		count++
+	}
+	if m.hasDigesterKeyID() {
+		count++
+	}
+	if m.Migration != nil {
+		count++
+	}
+	if m.ExtraRefs != 0 {
+		count++
+	}
+	if m.UserMetadata != nil {
+		count++
+	}
+	if m.InsertionOrder != StorageIDUndefined {
+		count++
+	}
+	if m.MutationSequence != 0 {
+		count++
+	}
+	if m.Provenance != nil {
+		count++
+	}
+	if m.Nesting != nil {
+		count++
+	}
+	if m.Limits != nil {
+		count++
+	}
+	return count
+}
+
+// encodeOptionalFields encodes optional fields with non-default values
+// as CBOR array of alternating field keys and values, ordered by field keys.
+func (m *MapExtraData) encodeOptionalFields(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(m.optionalFieldCount() * 2)
+	if err != nil {
+		return err
+	}
+
+	if m.DigesterType != DigesterTypeDefault {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldDigesterType)
+		if err != nil {
+			return err
+		}
+		err = enc.CBOR.EncodeUint64(uint64(m.DigesterType))
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.hasDigesterKeyID() {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldDigesterKeyID)
+		if err != nil {
+			return err
+		}
+		err = enc.CBOR.EncodeUint64(m.DigesterKeyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Migration != nil {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldMigration)
+		if err != nil {
+			return err
+		}
+		err = m.Migration.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.ExtraRefs != 0 {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldExtraRefs)
+		if err != nil {
+			return err
+		}
+		err = enc.CBOR.EncodeUint64(m.ExtraRefs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.UserMetadata != nil {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldUserMetadata)
+		if err != nil {
+			return err
+		}
+		err = m.UserMetadata.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.InsertionOrder != StorageIDUndefined {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldInsertionOrder)
+		if err != nil {
+			return err
+		}
+		err = encodeStorageIDField(enc, m.InsertionOrder)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.MutationSequence != 0 {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldMutationSequence)
+		if err != nil {
+			return err
+		}
+		err = enc.CBOR.EncodeUint64(m.MutationSequence)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Provenance != nil {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldProvenance)
+		if err != nil {
+			return err
+		}
+		err = m.Provenance.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Nesting != nil {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldNesting)
+		if err != nil {
+			return err
+		}
+		err = m.Nesting.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Limits != nil {
+		err = enc.CBOR.EncodeUint64(mapExtraDataFieldLimits)
+		if err != nil {
+			return err
+		}
+		err = m.Limits.encode(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Encode encodes extra data to the given encoder.
@@ -357,7 +664,11 @@ func newMapExtraDataFromData(
 //
 // Content (for now):
 //
-//   CBOR encoded array of extra data
+//   CBOR encoded array of extra data:
+//   [type info, count, seed] or [type info, count, seed, optional fields]
+//
+// Optional fields are only encoded if any of them has non-default value.
+// They are encoded as CBOR array of alternating field keys and values.
 //
 // Extra data flag is the same as the slab flag it prepends.
 //
@@ -375,8 +686,15 @@ func (m *MapExtraData) Encode(enc *Encoder, version byte, flag byte) error {
 		return err
 	}
 
+	hasOptionalFields := m.optionalFieldCount() > 0
+
+	length := uint64(mapExtraDataLength)
+	if hasOptionalFields {
+		length++
+	}
+
 	// Encode extra data
-	err = enc.CBOR.EncodeArrayHead(mapExtraDataLength)
+	err = enc.CBOR.EncodeArrayHead(length)
 	if err != nil {
 		return err
 	}
@@ -396,6 +714,13 @@ func (m *MapExtraData) Encode(enc *Encoder, version byte, flag byte) error {
 		return err
 	}
 
+	if hasOptionalFields {
+		err = m.encodeOptionalFields(enc)
+		if err != nil {
+			return err
+		}
+	}
+
 	return enc.CBOR.Flush()
 }
 
@@ -420,11 +745,11 @@ func newElementFromData(cborDec *cbor.StreamDecoder, decodeStorable StorableDeco
 		case CBORTagExternalCollisionGroup:
 			return newExternalCollisionGroupFromData(cborDec, decodeStorable)
 		default:
-			return nil, fmt.Errorf("failed to decode element: unrecognized tag number %d", tagNum)
+			return nil, NewDecodingErrorf("failed to decode element: unrecognized tag number %d", tagNum)
 		}
 
 	default:
-		return nil, fmt.Errorf("failed to decode element: unrecognized CBOR type %s", nt)
+		return nil, NewDecodingErrorf("failed to decode element: unrecognized CBOR type %s", nt)
 	}
 }
 
@@ -440,6 +765,9 @@ func newSingleElement(storage SlabStorage, address Address, key Value, value Val
 		return nil, err
 	}
 
+	logOversizedElement(storage, address, ks, MaxInlineMapKeyOrValueSize)
+	logOversizedElement(storage, address, vs, MaxInlineMapKeyOrValueSize)
+
 	var keyPointer bool
 	if _, ok := ks.(StorageIDStorable); ok {
 		keyPointer = true
@@ -466,7 +794,7 @@ func newSingleElementFromData(cborDec *cbor.StreamDecoder, decodeStorable Storab
 	}
 
 	if elemCount != 2 {
-		return nil, fmt.Errorf("failed to decode single element: expect array of 2 elements, got %d elements", elemCount)
+		return nil, NewDecodingErrorf("failed to decode single element: expect array of 2 elements, got %d elements", elemCount)
 	}
 
 	key, err := decodeStorable(cborDec, StorageIDUndefined)
@@ -533,7 +861,7 @@ func (e *singleElement) Get(storage SlabStorage, _ Digester, _ int, _ Digest, co
 	if equal {
 		return e.value, nil
 	}
-	return nil, NewKeyNotFoundError(key)
+	return nil, NewUserError(NewKeyNotFoundError(key))
 }
 
 // Set updates value if key matches, otherwise returns inlineCollisionGroup with existing and new elements.
@@ -556,6 +884,8 @@ func (e *singleElement) Set(storage SlabStorage, address Address, b DigesterBuil
 			return nil, nil, err
 		}
 
+		logOversizedElement(storage, address, valueStorable, MaxInlineMapKeyOrValueSize)
+
 		valuePointer := false
 		if _, ok := valueStorable.(StorageIDStorable); ok {
 			valuePointer = true
@@ -620,7 +950,7 @@ func (e *singleElement) Remove(storage SlabStorage, digester Digester, level int
 		return e.key, e.value, nil, nil
 	}
 
-	return nil, nil, nil, NewKeyNotFoundError(key)
+	return nil, nil, nil, NewUserError(NewKeyNotFoundError(key))
 }
 
 func (e *singleElement) HasPointer() bool {
@@ -694,11 +1024,22 @@ func (e *inlineCollisionGroup) Set(storage SlabStorage, address Address, b Diges
 	}
 	hkey, _ := digester.Digest(level)
 
+	count := e.elements.Count()
+
 	existingValue, err := e.elements.Set(storage, address, b, digester, level, hkey, comparator, hip, key, value)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if e.elements.Count() > count {
+		reportCollisionGroup(storage, CollisionGroupEvent{
+			Address:  address,
+			Level:    level,
+			Count:    e.elements.Count(),
+			External: level == 1 && e.Size() > uint32(maxInlineMapElementSize),
+		})
+	}
+
 	if level == 1 {
 		// Export oversized inline collision group to separete slab (external collision group)
 		// for first level collision.
@@ -800,7 +1141,7 @@ func newExternalCollisionGroupFromData(cborDec *cbor.StreamDecoder, decodeStorab
 
 	idStorable, ok := storable.(StorageIDStorable)
 	if !ok {
-		return nil, fmt.Errorf("failed to decode external collision group: expect storage id, got %T", storable)
+		return nil, NewDecodingErrorf("failed to decode external collision group: expect storage id, got %T", storable)
 	}
 
 	return &externalCollisionGroup{
@@ -861,10 +1202,26 @@ func (e *externalCollisionGroup) Set(storage SlabStorage, address Address, b Dig
 	}
 	hkey, _ := digester.Digest(level)
 
+	var count uint32
+	dataSlab, isDataSlab := slab.(*MapDataSlab)
+	if isDataSlab {
+		count = dataSlab.elements.Count()
+	}
+
 	existingValue, err := slab.Set(storage, b, digester, level, hkey, comparator, hip, key, value)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	if isDataSlab && dataSlab.elements.Count() > count {
+		reportCollisionGroup(storage, CollisionGroupEvent{
+			Address:  address,
+			Level:    level,
+			Count:    dataSlab.elements.Count(),
+			External: true,
+		})
+	}
+
 	return e, existingValue, nil
 }
 
@@ -968,7 +1325,7 @@ func newElementsFromData(cborDec *cbor.StreamDecoder, decodeStorable StorableDec
 	}
 
 	if arrayCount != 3 {
-		return nil, fmt.Errorf("decoding elements failed: expect array of 3 elements, got %d elements", arrayCount)
+		return nil, NewDecodingErrorf("decoding elements failed: expect array of 3 elements, got %d elements", arrayCount)
 	}
 
 	level, err := cborDec.DecodeUint64()
@@ -982,7 +1339,7 @@ func newElementsFromData(cborDec *cbor.StreamDecoder, decodeStorable StorableDec
 	}
 
 	if len(digestBytes)%digestSize != 0 {
-		return nil, fmt.Errorf("decoding digests failed: number of bytes is not multiple of %d", digestSize)
+		return nil, NewDecodingErrorf("decoding digests failed: number of bytes is not multiple of %d", digestSize)
 	}
 
 	digestCount := len(digestBytes) / digestSize
@@ -997,7 +1354,7 @@ func newElementsFromData(cborDec *cbor.StreamDecoder, decodeStorable StorableDec
 	}
 
 	if digestCount != 0 && uint64(digestCount) != elemCount {
-		return nil, fmt.Errorf("decoding elements failed: number of hkeys %d isn't the same as number of elements %d", digestCount, elemCount)
+		return nil, NewDecodingErrorf("decoding elements failed: number of hkeys %d isn't the same as number of elements %d", digestCount, elemCount)
 	}
 
 	if digestCount == 0 && elemCount > 0 {
@@ -1078,7 +1435,7 @@ func newHkeyElementsWithElement(level int, hkey Digest, elem element) *hkeyEleme
 func (e *hkeyElements) Encode(enc *Encoder) error {
 
 	if e.level > maxDigestLevel {
-		return fmt.Errorf("hash level %d exceeds max digest level %d", e.level, maxDigestLevel)
+		return NewHashLevelErrorf("hash level %d exceeds max digest level %d", e.level, maxDigestLevel)
 	}
 
 	// Encode CBOR array head of 3 elements (level, hkeys, elements)
@@ -1158,7 +1515,7 @@ func (e *hkeyElements) Get(storage SlabStorage, digester Digester, level int, hk
 
 	// No matching hkey
 	if equalIndex == -1 {
-		return nil, NewKeyNotFoundError(key)
+		return nil, NewUserError(NewKeyNotFoundError(key))
 	}
 
 	elem := e.elems[equalIndex]
@@ -1293,7 +1650,7 @@ func (e *hkeyElements) Remove(storage SlabStorage, digester Digester, level int,
 	}
 
 	if len(e.hkeys) == 0 || hkey < e.hkeys[0] || hkey > e.hkeys[len(e.hkeys)-1] {
-		return nil, nil, NewKeyNotFoundError(key)
+		return nil, nil, NewUserError(NewKeyNotFoundError(key))
 	}
 
 	// binary search by hkey
@@ -1315,7 +1672,7 @@ func (e *hkeyElements) Remove(storage SlabStorage, digester Digester, level int,
 
 	// No matching hkey
 	if equalIndex == -1 {
-		return nil, nil, NewKeyNotFoundError(key)
+		return nil, nil, NewUserError(NewKeyNotFoundError(key))
 	}
 
 	elem := e.elems[equalIndex]
@@ -1354,7 +1711,7 @@ func (e *hkeyElements) Remove(storage SlabStorage, digester Digester, level int,
 
 func (e *hkeyElements) Element(i int) (element, error) {
 	if i >= len(e.elems) {
-		return nil, NewIndexOutOfBoundsError(uint64(i), 0, uint64(len(e.elems)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(uint64(i), 0, uint64(len(e.elems))))
 	}
 	return e.elems[i], nil
 }
@@ -1666,7 +2023,7 @@ func newSingleElementsWithElement(level int, elem *singleElement) *singleElement
 func (e *singleElements) Encode(enc *Encoder) error {
 
 	if e.level > maxDigestLevel {
-		return fmt.Errorf("digest level %d exceeds max digest level %d", e.level, maxDigestLevel)
+		return NewHashLevelErrorf("digest level %d exceeds max digest level %d", e.level, maxDigestLevel)
 	}
 
 	// Encode CBOR array header for 3 elements (level, hkeys, elements)
@@ -1721,7 +2078,7 @@ func (e *singleElements) Get(storage SlabStorage, digester Digester, level int,
 		}
 	}
 
-	return nil, NewKeyNotFoundError(key)
+	return nil, NewUserError(NewKeyNotFoundError(key))
 }
 
 func (e *singleElements) Set(storage SlabStorage, address Address, b DigesterBuilder, digester Digester, level int, _ Digest, comparator ValueComparator, hip HashInputProvider, key Value, value Value) (MapValue, error) {
@@ -1749,6 +2106,8 @@ func (e *singleElements) Set(storage SlabStorage, address Address, b DigesterBui
 				return nil, err
 			}
 
+			logOversizedElement(storage, address, vs, MaxInlineMapKeyOrValueSize)
+
 			elem.value = vs
 			elem.size = singleElementPrefixSize + elem.key.ByteSize() + elem.value.ByteSize()
 
@@ -1798,12 +2157,12 @@ func (e *singleElements) Remove(storage SlabStorage, digester Digester, level in
 		}
 	}
 
-	return nil, nil, NewKeyNotFoundError(key)
+	return nil, nil, NewUserError(NewKeyNotFoundError(key))
 }
 
 func (e *singleElements) Element(i int) (element, error) {
 	if i >= len(e.elems) {
-		return nil, NewIndexOutOfBoundsError(uint64(i), 0, uint64(len(e.elems)))
+		return nil, NewUserError(NewIndexOutOfBoundsError(uint64(i), 0, uint64(len(e.elems))))
 	}
 	return e.elems[i], nil
 }
@@ -2111,10 +2470,13 @@ func elementStorables(e element, childStorables []Storable) []Storable {
 
 func (m *MapDataSlab) StoredValue(storage SlabStorage) (Value, error) {
 	if m.extraData == nil {
-		return nil, NewNotValueError(m.ID())
+		return nil, NewUserError(NewNotValueError(m.ID()))
 	}
 
-	digestBuilder := NewDefaultDigesterBuilder()
+	digestBuilder, err := newDigesterBuilderFromExtraData(storage, m.extraData)
+	if err != nil {
+		return nil, err
+	}
 
 	digestBuilder.SetSeed(m.extraData.Seed, typicalRandomConstant)
 
@@ -2546,10 +2908,13 @@ func (m *MapMetaDataSlab) Encode(enc *Encoder) error {
 
 func (m *MapMetaDataSlab) StoredValue(storage SlabStorage) (Value, error) {
 	if m.extraData == nil {
-		return nil, NewNotValueError(m.ID())
+		return nil, NewUserError(NewNotValueError(m.ID()))
 	}
 
-	digestBuilder := NewDefaultDigesterBuilder()
+	digestBuilder, err := newDigesterBuilderFromExtraData(storage, m.extraData)
+	if err != nil {
+		return nil, err
+	}
 
 	digestBuilder.SetSeed(m.extraData.Seed, typicalRandomConstant)
 
@@ -2585,7 +2950,7 @@ func (m *MapMetaDataSlab) Get(storage SlabStorage, digester Digester, level int,
 	}
 
 	if ans == -1 {
-		return nil, NewKeyNotFoundError(key)
+		return nil, NewUserError(NewKeyNotFoundError(key))
 	}
 
 	childHeaderIndex := ans
@@ -2594,10 +2959,15 @@ func (m *MapMetaDataSlab) Get(storage SlabStorage, digester Digester, level int,
 
 	child, err := getMapSlab(storage, childID)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
+	}
+
+	value, err := child.Get(storage, digester, level, hkey, comparator, key)
+	if err != nil {
+		return nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 	}
 
-	return child.Get(storage, digester, level, hkey, comparator, key)
+	return value, nil
 }
 
 func (m *MapMetaDataSlab) Set(storage SlabStorage, b DigesterBuilder, digester Digester, level int, hkey Digest, comparator ValueComparator, hip HashInputProvider, key Value, value Value) (MapValue, error) {
@@ -2620,13 +2990,26 @@ func (m *MapMetaDataSlab) Set(storage SlabStorage, b DigesterBuilder, digester D
 
 	child, err := getMapSlab(storage, childID)
 	if err != nil {
-		return nil, err
+		return nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 	}
 
 	existingValue, err := child.Set(storage, b, digester, level, hkey, comparator, hip, key, value)
+	if err != nil {
+		return nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
+	}
+
+	err = m.updateChild(storage, child, childHeaderIndex)
 	if err != nil {
 		return nil, err
 	}
+	return existingValue, nil
+}
+
+// updateChild updates header of child modified by Set, splits or
+// rebalances child if needed, and stores m.
+func (m *MapMetaDataSlab) updateChild(storage SlabStorage, child MapSlab, childHeaderIndex int) error {
+
+	childID := child.ID()
 
 	m.childrenHeaders[childHeaderIndex] = child.Header()
 
@@ -2638,24 +3021,20 @@ func (m *MapMetaDataSlab) Set(storage SlabStorage, b DigesterBuilder, digester D
 	if child.IsFull() {
 		err := m.SplitChildSlab(storage, child, childHeaderIndex)
 		if err != nil {
-			return nil, err
+			return wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 		}
-		return existingValue, nil
+		return nil
 	}
 
 	if underflowSize, underflow := child.IsUnderflow(); underflow {
 		err := m.MergeOrRebalanceChildSlab(storage, child, childHeaderIndex, underflowSize)
 		if err != nil {
-			return nil, err
+			return wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 		}
-		return existingValue, nil
+		return nil
 	}
 
-	err = storage.Store(m.header.id, m)
-	if err != nil {
-		return nil, err
-	}
-	return existingValue, nil
+	return storage.Store(m.header.id, m)
 }
 
 func (m *MapMetaDataSlab) Remove(storage SlabStorage, digester Digester, level int, hkey Digest, comparator ValueComparator, key Value) (MapKey, MapValue, error) {
@@ -2673,7 +3052,7 @@ func (m *MapMetaDataSlab) Remove(storage SlabStorage, digester Digester, level i
 	}
 
 	if ans == -1 {
-		return nil, nil, NewKeyNotFoundError(key)
+		return nil, nil, NewUserError(NewKeyNotFoundError(key))
 	}
 
 	childHeaderIndex := ans
@@ -2682,12 +3061,12 @@ func (m *MapMetaDataSlab) Remove(storage SlabStorage, digester Digester, level i
 
 	child, err := getMapSlab(storage, childID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 	}
 
 	k, v, err := child.Remove(storage, digester, level, hkey, comparator, key)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 	}
 
 	m.childrenHeaders[childHeaderIndex] = child.Header()
@@ -2700,7 +3079,7 @@ func (m *MapMetaDataSlab) Remove(storage SlabStorage, digester Digester, level i
 	if child.IsFull() {
 		err := m.SplitChildSlab(storage, child, childHeaderIndex)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 		}
 		return k, v, nil
 	}
@@ -2708,7 +3087,7 @@ func (m *MapMetaDataSlab) Remove(storage SlabStorage, digester Digester, level i
 	if underflowSize, underflow := child.IsUnderflow(); underflow {
 		err := m.MergeOrRebalanceChildSlab(storage, child, childHeaderIndex, underflowSize)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, wrapSlabPathError(err, m.header.id, childHeaderIndex, childID)
 		}
 		return k, v, nil
 	}
@@ -2721,11 +3100,23 @@ func (m *MapMetaDataSlab) Remove(storage SlabStorage, digester Digester, level i
 }
 
 func (m *MapMetaDataSlab) SplitChildSlab(storage SlabStorage, child MapSlab, childHeaderIndex int) error {
+	originalID := child.ID()
+
+	splitSize := uint64(child.ByteSize())
+	err := meterBefore(storage, MeterStepSplit, splitSize)
+	if err != nil {
+		return err
+	}
+
 	leftSlab, rightSlab, err := child.Split(storage)
 	if err != nil {
 		return err
 	}
 
+	meterAfter(storage, MeterStepSplit, splitSize)
+
+	notifySlabSplit(storage, originalID, leftSlab.ID(), rightSlab.ID())
+
 	left := leftSlab.(MapSlab)
 	right := rightSlab.(MapSlab)
 
@@ -2918,11 +3309,21 @@ func (m *MapMetaDataSlab) MergeOrRebalanceChildSlab(
 	if leftSib == nil {
 
 		// Merge with right
-		err := child.Merge(rightSib)
+		mergeSize := uint64(child.ByteSize()) + uint64(rightSib.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
+		if err != nil {
+			return err
+		}
+
+		err = child.Merge(rightSib)
 		if err != nil {
 			return err
 		}
 
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, child.ID(), rightSib.ID())
+
 		m.childrenHeaders[childHeaderIndex] = child.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -2953,11 +3354,21 @@ func (m *MapMetaDataSlab) MergeOrRebalanceChildSlab(
 	if rightSib == nil {
 
 		// Merge with left
-		err := leftSib.Merge(child)
+		mergeSize := uint64(leftSib.ByteSize()) + uint64(child.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
+		if err != nil {
+			return err
+		}
+
+		err = leftSib.Merge(child)
 		if err != nil {
 			return err
 		}
 
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, leftSib.ID(), child.ID())
+
 		m.childrenHeaders[childHeaderIndex-1] = leftSib.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -2982,12 +3393,22 @@ func (m *MapMetaDataSlab) MergeOrRebalanceChildSlab(
 
 	// Merge with smaller sib
 	if leftSib.ByteSize() < rightSib.ByteSize() {
-		err := leftSib.Merge(child)
+		mergeSize := uint64(leftSib.ByteSize()) + uint64(child.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
 		if err != nil {
 			return err
 		}
 
-		m.childrenHeaders[childHeaderIndex-1] = leftSib.Header()
+		err = leftSib.Merge(child)
+		if err != nil {
+			return err
+		}
+
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, leftSib.ID(), child.ID())
+
+		m.childrenHeaders[childHeaderIndex-1] = leftSib.Header()
 
 		// Update MetaDataSlab's childrenHeaders
 		copy(m.childrenHeaders[childHeaderIndex:], m.childrenHeaders[childHeaderIndex+1:])
@@ -3010,11 +3431,21 @@ func (m *MapMetaDataSlab) MergeOrRebalanceChildSlab(
 	} else {
 		// leftSib.ByteSize() > rightSib.ByteSize
 
-		err := child.Merge(rightSib)
+		mergeSize := uint64(child.ByteSize()) + uint64(rightSib.ByteSize())
+		err := meterBefore(storage, MeterStepMerge, mergeSize)
 		if err != nil {
 			return err
 		}
 
+		err = child.Merge(rightSib)
+		if err != nil {
+			return err
+		}
+
+		meterAfter(storage, MeterStepMerge, mergeSize)
+
+		notifySlabMerge(storage, child.ID(), rightSib.ID())
+
 		m.childrenHeaders[childHeaderIndex] = child.Header()
 
 		// Update MetaDataSlab's childrenHeaders
@@ -3263,8 +3694,19 @@ func NewMap(storage SlabStorage, address Address, digestBuilder DigesterBuilder,
 
 	digestBuilder.SetSeed(k0, k1)
 
-	// Create extra data with type info and seed
-	extraData := &MapExtraData{TypeInfo: typeInfo, Seed: k0}
+	provenance, err := newProvenance(storage, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create extra data with type info, seed, and digester type
+	extraData := &MapExtraData{
+		TypeInfo:      typeInfo,
+		Seed:          k0,
+		DigesterType:  digesterTypeOf(digestBuilder),
+		DigesterKeyID: digesterKeyIDOf(digestBuilder),
+		Provenance:    provenance,
+	}
 
 	root := &MapDataSlab{
 		header: MapSlabHeader{
@@ -3287,6 +3729,9 @@ func NewMap(storage SlabStorage, address Address, digestBuilder DigesterBuilder,
 	}, nil
 }
 
+// NewMapWithRootID returns map with given root id.
+// If digestBuilder is nil, DigesterBuilder of digester type recorded in map extra data is used.
+// DigesterTypeError is returned if digestBuilder is a TypedDigesterBuilder of a different digester type.
 func NewMapWithRootID(storage SlabStorage, rootID StorageID, digestBuilder DigesterBuilder) (*OrderedMap, error) {
 	if rootID == StorageIDUndefined {
 		return nil, NewStorageIDErrorf("cannot create OrderedMap from undefined storage id")
@@ -3299,7 +3744,31 @@ func NewMapWithRootID(storage SlabStorage, rootID StorageID, digestBuilder Diges
 
 	extraData := root.ExtraData()
 	if extraData == nil {
-		return nil, NewNotValueError(rootID)
+		return nil, NewUserError(NewNotValueError(rootID))
+	}
+
+	if digestBuilder == nil {
+		digestBuilder, err = newDigesterBuilderFromExtraData(storage, extraData)
+		if err != nil {
+			return nil, err
+		}
+	} else if tb, ok := digestBuilder.(TypedDigesterBuilder); ok {
+		if tb.DigesterType() != extraData.DigesterType {
+			return nil, NewUserError(NewDigesterTypeErrorf(
+				"map %s has digester type %d, got digester builder of type %d",
+				rootID,
+				extraData.DigesterType,
+				tb.DigesterType(),
+			))
+		}
+		if digesterKeyIDOf(digestBuilder) != extraData.DigesterKeyID {
+			return nil, NewUserError(NewDigesterKeyErrorf(
+				"map %s has digester key %d, got digester builder with key %d",
+				rootID,
+				extraData.DigesterKeyID,
+				digesterKeyIDOf(digestBuilder),
+			))
+		}
 	}
 
 	digestBuilder.SetSeed(extraData.Seed, typicalRandomConstant)
@@ -3311,6 +3780,23 @@ func NewMapWithRootID(storage SlabStorage, rootID StorageID, digestBuilder Diges
 	}, nil
 }
 
+// digest returns digester of key, metering digest computation.
+func (m *OrderedMap) digest(hip HashInputProvider, key Value) (Digester, error) {
+	err := meterBefore(m.Storage, MeterStepDigest, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDigest, err := m.digesterBuilder.Digest(hip, key)
+	if err != nil {
+		return nil, err
+	}
+
+	meterAfter(m.Storage, MeterStepDigest, 0)
+
+	return keyDigest, nil
+}
+
 func (m *OrderedMap) Has(comparator ValueComparator, hip HashInputProvider, key Value) (bool, error) {
 	_, err := m.Get(comparator, hip, key)
 	if err != nil {
@@ -3325,7 +3811,7 @@ func (m *OrderedMap) Has(comparator ValueComparator, hip HashInputProvider, key
 
 func (m *OrderedMap) Get(comparator ValueComparator, hip HashInputProvider, key Value) (Storable, error) {
 
-	keyDigest, err := m.digesterBuilder.Digest(hip, key)
+	keyDigest, err := m.digest(hip, key)
 	if err != nil {
 		return nil, err
 	}
@@ -3338,12 +3824,62 @@ func (m *OrderedMap) Get(comparator ValueComparator, hip HashInputProvider, key
 		return nil, err
 	}
 
-	return m.root.Get(m.Storage, keyDigest, level, hkey, comparator, key)
+	atomic.AddUint64(&m.stats.Gets, 1)
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationGet)
+
+	value, err := m.root.Get(storage, keyDigest, level, hkey, comparator, key)
+	if err != nil {
+		err = withKeyNotFoundContext(err, m.StorageID(), m.Count())
+		return nil, wrapRootSlabPathError(err, m.StorageID())
+	}
+
+	return value, nil
+}
+
+// SetElementValidators sets validators of keys and values passed to Set.
+// Validators aren't persisted, they only apply to this OrderedMap instance.
+// If a validator is nil, keys or values aren't validated.
+func (m *OrderedMap) SetElementValidators(keyValidator ElementValidator, valueValidator ElementValidator) {
+	m.keyValidator = keyValidator
+	m.valueValidator = valueValidator
+}
+
+func (m *OrderedMap) validateElement(key Value, value Value) error {
+	if _, ok := value.(storableValue); ok {
+		// Element is validated before its storable is created.
+		return nil
+	}
+	err := checkNestingDepth(m.Storage, m.StorageID(), value)
+	if err != nil {
+		return err
+	}
+	if m.keyValidator != nil {
+		err := m.keyValidator(m.Type(), key)
+		if err != nil {
+			logInvalidElement(m.getLogger(), m.StorageID(), err)
+			return NewInvalidElementError(err)
+		}
+	}
+	if m.valueValidator != nil {
+		err := m.valueValidator(m.Type(), value)
+		if err != nil {
+			logInvalidElement(m.getLogger(), m.StorageID(), err)
+			return NewInvalidElementError(err)
+		}
+	}
+	return nil
 }
 
 func (m *OrderedMap) Set(comparator ValueComparator, hip HashInputProvider, key Value, value Value) (Storable, error) {
 
-	keyDigest, err := m.digesterBuilder.Digest(hip, key)
+	err := m.validateElement(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDigest, err := m.digest(hip, key)
 	if err != nil {
 		return nil, err
 	}
@@ -3356,40 +3892,99 @@ func (m *OrderedMap) Set(comparator ValueComparator, hip HashInputProvider, key
 		return nil, err
 	}
 
-	existingValue, err := m.root.Set(m.Storage, m.digesterBuilder, keyDigest, level, hkey, comparator, hip, key, value)
+	value, change, err := m.checkLimits(comparator, keyDigest, hkey, key, value)
 	if err != nil {
 		return nil, err
 	}
 
+	return m.set(comparator, hip, keyDigest, hkey, key, value, change, nil)
+}
+
+// set sets key to value using digester and first level digest of key,
+// after key and value are validated and checked against limits.  If path
+// isn't nil, key is set in slabs of path instead of descending from root.
+func (m *OrderedMap) set(
+	comparator ValueComparator,
+	hip HashInputProvider,
+	keyDigest Digester,
+	hkey Digest,
+	key Value,
+	value Value,
+	change byteSizeChange,
+	path *mapSlabPath,
+) (Storable, error) {
+
+	level := 0
+
+	storage := m.beginOperation()
+	kind := OperationSet
+	defer func() {
+		m.endOperation(storage, kind)
+	}()
+
+	var existingValue MapValue
+	var err error
+	if path != nil {
+		existingValue, err = path.set(storage, m.digesterBuilder, keyDigest, level, hkey, comparator, hip, key, value)
+	} else {
+		existingValue, err = m.root.Set(storage, m.digesterBuilder, keyDigest, level, hkey, comparator, hip, key, value)
+	}
+	if err != nil {
+		return nil, wrapRootSlabPathError(err, m.StorageID())
+	}
+
 	if existingValue == nil {
+		kind = OperationInsert
+		atomic.AddUint64(&m.stats.Inserts, 1)
 		m.root.ExtraData().incrementCount()
+		notifyElementInserted(m.Storage, m.StorageID())
+	} else {
+		atomic.AddUint64(&m.stats.Sets, 1)
+		notifyElementSet(m.Storage, m.StorageID())
 	}
 
-	if !m.root.IsData() {
-		// Set root to its child slab if root has one child slab.
-		root := m.root.(*MapMetaDataSlab)
-		if len(root.childrenHeaders) == 1 {
-			err := m.promoteChildAsNewRoot(root.childrenHeaders[0].id)
-			if err != nil {
-				return nil, err
-			}
-			return existingValue, nil
-		}
+	storeRoot := m.incrementMutationSequence()
+	storeRoot = m.trackByteSize(change) || storeRoot
+
+	err = m.rebalanceRoot(storage, storeRoot)
+	if err != nil {
+		return nil, err
 	}
 
-	if m.root.IsFull() {
-		err := m.splitRoot()
+	// Nesting is linked after root is rebalanced, since it stores roots
+	// of nested collection and ancestors.
+	err = unlinkNestedStorable(storage, m.StorageID(), existingValue)
+	if err != nil {
+		return nil, err
+	}
+
+	err = linkNestedValue(storage, m.StorageID(), value)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingValue == nil {
+		err = m.appendInsertionOrder(key)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	op := ChangeSet
+	if existingValue == nil {
+		op = ChangeInsert
+	}
+	err = m.emitChange(op, keyDigest, hkey, comparator, key, existingValue)
+	if err != nil {
+		return nil, err
+	}
+
 	return existingValue, nil
 }
 
 func (m *OrderedMap) Remove(comparator ValueComparator, hip HashInputProvider, key Value) (Storable, Storable, error) {
 
-	keyDigest, err := m.digesterBuilder.Digest(hip, key)
+	keyDigest, err := m.digest(hip, key)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -3402,37 +3997,83 @@ func (m *OrderedMap) Remove(comparator ValueComparator, hip HashInputProvider, k
 		return nil, nil, err
 	}
 
-	k, v, err := m.root.Remove(m.Storage, keyDigest, level, hkey, comparator, key)
+	atomic.AddUint64(&m.stats.Removes, 1)
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationRemove)
+
+	change, err := m.removedByteSize(comparator, keyDigest, hkey, key)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	k, v, err := m.root.Remove(storage, keyDigest, level, hkey, comparator, key)
+	if err != nil {
+		err = withKeyNotFoundContext(err, m.StorageID(), m.Count())
+		return nil, nil, wrapRootSlabPathError(err, m.StorageID())
+	}
+
 	m.root.ExtraData().decrementCount()
+	notifyElementRemoved(m.Storage, m.StorageID())
+
+	storeRoot := m.incrementMutationSequence()
+	storeRoot = m.trackByteSize(change) || storeRoot
+
+	err = m.rebalanceRoot(storage, storeRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Nesting is unlinked after root is rebalanced, since it stores root
+	// of nested collection.
+	err = unlinkNestedStorable(storage, m.StorageID(), v)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	err = m.removeInsertionOrder(comparator, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = m.emitChange(ChangeRemove, keyDigest, hkey, comparator, key, v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return k, v, nil
+}
+
+// rebalanceRoot sets root to its child slab if root has one child slab,
+// or splits root if it is full.  Otherwise root is stored if storeRoot
+// is true, so root extra data updated by mutation is stored in the same
+// step as root is rebalanced.
+func (m *OrderedMap) rebalanceRoot(storage SlabStorage, storeRoot bool) error {
 	if !m.root.IsData() {
-		// Set root to its child slab if root has one child slab.
 		root := m.root.(*MapMetaDataSlab)
 		if len(root.childrenHeaders) == 1 {
-			err := m.promoteChildAsNewRoot(root.childrenHeaders[0].id)
-			if err != nil {
-				return nil, nil, err
-			}
-			return k, v, nil
+			return m.promoteChildAsNewRoot(root.childrenHeaders[0].id)
 		}
 	}
 
 	if m.root.IsFull() {
-		err := m.splitRoot()
-		if err != nil {
-			return nil, nil, err
-		}
+		return m.splitRoot()
 	}
 
-	return k, v, nil
+	if storeRoot {
+		return storage.Store(m.root.ID(), m.root)
+	}
+	return nil
 }
 
 func (m *OrderedMap) splitRoot() error {
 
+	splitSize := uint64(m.root.ByteSize())
+	err := meterBefore(m.Storage, MeterStepSplit, splitSize)
+	if err != nil {
+		return err
+	}
+
 	if m.root.IsData() {
 		// Adjust root data slab size before splitting
 		dataSlab := m.root.(*MapDataSlab)
@@ -3446,7 +4087,7 @@ func (m *OrderedMap) splitRoot() error {
 	rootID := m.root.ID()
 
 	// Assign a new storage id to old root before splitting it.
-	sID, err := m.Storage.GenerateStorageID(m.Address())
+	sID, err := m.trackedStorage().GenerateStorageID(m.Address())
 	if err != nil {
 		return err
 	}
@@ -3455,11 +4096,15 @@ func (m *OrderedMap) splitRoot() error {
 	oldRoot.SetID(sID)
 
 	// Split old root
-	leftSlab, rightSlab, err := oldRoot.Split(m.Storage)
+	leftSlab, rightSlab, err := oldRoot.Split(m.trackedStorage())
 	if err != nil {
 		return err
 	}
 
+	meterAfter(m.Storage, MeterStepSplit, splitSize)
+
+	notifySlabSplit(m.Storage, rootID, leftSlab.ID(), rightSlab.ID())
+
 	left := leftSlab.(MapSlab)
 	right := rightSlab.(MapSlab)
 
@@ -3476,20 +4121,20 @@ func (m *OrderedMap) splitRoot() error {
 
 	m.root = newRoot
 
-	err = m.Storage.Store(left.ID(), left)
+	err = m.trackedStorage().Store(left.ID(), left)
 	if err != nil {
 		return err
 	}
-	err = m.Storage.Store(right.ID(), right)
+	err = m.trackedStorage().Store(right.ID(), right)
 	if err != nil {
 		return err
 	}
-	return m.Storage.Store(m.root.ID(), m.root)
+	return m.trackedStorage().Store(m.root.ID(), m.root)
 }
 
 func (m *OrderedMap) promoteChildAsNewRoot(childID StorageID) error {
 
-	child, err := getMapSlab(m.Storage, childID)
+	child, err := getMapSlab(m.trackedStorage(), childID)
 	if err != nil {
 		return err
 	}
@@ -3510,12 +4155,12 @@ func (m *OrderedMap) promoteChildAsNewRoot(childID StorageID) error {
 
 	m.root.SetExtraData(extraData)
 
-	err = m.Storage.Store(rootID, m.root)
+	err = m.trackedStorage().Store(rootID, m.root)
 	if err != nil {
 		return err
 	}
 
-	return m.Storage.Remove(childID)
+	return m.trackedStorage().Remove(childID)
 }
 
 func (m *OrderedMap) StorageID() StorageID {
@@ -3545,14 +4190,42 @@ func (m *OrderedMap) Type() TypeInfo {
 	return nil
 }
 
+// SetType changes map type info to typeInfo by rewriting root slab extra data.
+// Map elements aren't modified.  IncompatibleTypeInfoError is returned
+// if isCompatible returns false for current and new type info.  Nil
+// isCompatible treats every type info as compatible.
+func (m *OrderedMap) SetType(typeInfo TypeInfo, isCompatible TypeInfoCompatibilityChecker) error {
+	extraData := m.root.ExtraData()
+	if extraData == nil {
+		return NewUserError(NewNotValueError(m.StorageID()))
+	}
+
+	if isCompatible != nil && !isCompatible(extraData.TypeInfo, typeInfo) {
+		return NewIncompatibleTypeInfoError(extraData.TypeInfo, typeInfo)
+	}
+
+	extraData.TypeInfo = typeInfo
+
+	return m.Storage.Store(m.root.ID(), m.root)
+}
+
+// String returns elements of map, truncated to DefaultStringMaxElements
+// elements and DefaultStringMaxBytes bytes.
 func (m *OrderedMap) String() string {
+	return m.StringWithOptions(DefaultStringMaxElements, DefaultStringMaxBytes)
+}
+
+// StringWithOptions returns elements of map, truncated to maxElements
+// elements and maxBytes bytes of elements.  0 maximum means no limit.
+// Omitted elements are noted at the end.
+func (m *OrderedMap) StringWithOptions(maxElements int, maxBytes int) string {
 	iterator, err := m.Iterator()
 	if err != nil {
 		return err.Error()
 	}
 
-	var elemsStr []string
-	for {
+	b := newElementsStringBuilder(maxElements, maxBytes)
+	for !b.full() {
 		k, v, err := iterator.Next()
 		if err != nil {
 			return err.Error()
@@ -3560,10 +4233,12 @@ func (m *OrderedMap) String() string {
 		if k == nil {
 			break
 		}
-		elemsStr = append(elemsStr, fmt.Sprintf("%s:%s", k, v))
+		if !b.add(fmt.Sprintf("%s:%s", k, v)) {
+			break
+		}
 	}
 
-	return fmt.Sprintf("[%s]", strings.Join(elemsStr, " "))
+	return b.String(m.Count())
 }
 
 func getMapSlab(storage SlabStorage, id StorageID) (MapSlab, error) {
@@ -3662,9 +4337,40 @@ type MapIterator struct {
 	storage      SlabStorage
 	id           StorageID
 	elemIterator *MapElementIterator
+	// slabIterator is element iterator of current data slab,
+	// reused by elemIterator to avoid allocation per slab.
+	slabIterator MapElementIterator
+	// tracked records slabs retrieved by iterator, if not nil.
+	tracked *statsSlabStorage
 }
 
 func (i *MapIterator) Next() (key Value, value Value, err error) {
+	ks, vs, err := i.NextStorables()
+	if err != nil {
+		return nil, nil, err
+	}
+	if ks == nil {
+		return nil, nil, nil
+	}
+
+	key, err = ks.StoredValue(i.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err = vs.StoredValue(i.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, value, nil
+}
+
+// NextStorables returns key and value storables of next element without
+// decoding them to Value, or nil if there are no more elements.  Keys and
+// values stored in separate slabs, such as nested collections, are
+// returned as StorageIDStorable.
+func (i *MapIterator) NextStorables() (key MapKey, value MapValue, err error) {
 	if i.elemIterator == nil {
 		if i.id == StorageIDUndefined {
 			return nil, nil, nil
@@ -3676,28 +4382,17 @@ func (i *MapIterator) Next() (key Value, value Value, err error) {
 		}
 	}
 
-	var ks, vs Storable
-	ks, vs, err = i.elemIterator.Next()
+	key, value, err = i.elemIterator.Next()
 	if err != nil {
 		return nil, nil, err
 	}
-	if ks != nil {
-		key, err = ks.StoredValue(i.storage)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		value, err = vs.StoredValue(i.storage)
-		if err != nil {
-			return nil, nil, err
-		}
-
+	if key != nil {
 		return key, value, nil
 	}
 
 	i.elemIterator = nil
 
-	return i.Next()
+	return i.NextStorables()
 }
 
 func (i *MapIterator) NextKey() (key Value, err error) {
@@ -3771,6 +4466,12 @@ func (i *MapIterator) advance() error {
 		return NewSlabNotFoundErrorf(i.id, "slab not found during map iteration")
 	}
 
+	elementStorage := i.storage
+	if i.tracked != nil {
+		i.tracked.recordRetrieve(i.id)
+		elementStorage = i.tracked
+	}
+
 	dataSlab, ok := slab.(*MapDataSlab)
 	if !ok {
 		return NewSlabDataErrorf("slab %s isn't MapDataSlab", i.id)
@@ -3778,38 +4479,61 @@ func (i *MapIterator) advance() error {
 
 	i.id = dataSlab.next
 
-	i.elemIterator = &MapElementIterator{
-		storage:  i.storage,
+	i.slabIterator = MapElementIterator{
+		storage:  elementStorage,
 		elements: dataSlab.elements,
 	}
+	i.elemIterator = &i.slabIterator
 
 	return nil
 }
 
 func (m *OrderedMap) Iterator() (*MapIterator, error) {
-	slab, err := firstMapDataSlab(m.Storage, m.root)
+	iterator := &MapIterator{}
+	err := iterator.Reset(m)
 	if err != nil {
 		return nil, err
 	}
+	return iterator, nil
+}
+
+// Reset sets iterator to iterate map m from the first element, so
+// that iterator can be reused instead of creating a new one.
+func (i *MapIterator) Reset(m *OrderedMap) error {
+	atomic.AddUint64(&m.stats.Iterations, 1)
+
+	tracked := m.trackedStorage()
+
+	slab, err := firstMapDataSlab(tracked, m.root)
+	if err != nil {
+		return err
+	}
 
 	dataSlab := slab.(*MapDataSlab)
 
-	return &MapIterator{
+	*i = MapIterator{
 		storage: m.Storage,
 		id:      dataSlab.next,
-		elemIterator: &MapElementIterator{
-			storage:  m.Storage,
+		slabIterator: MapElementIterator{
+			storage:  tracked,
 			elements: dataSlab.elements,
 		},
-	}, nil
+		tracked: tracked,
+	}
+	i.elemIterator = &i.slabIterator
+	return nil
 }
 
 func (m *OrderedMap) Iterate(fn MapEntryIterationFunc) error {
 
-	iterator, err := m.Iterator()
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	iterator, err := pooledMapIterator(m)
 	if err != nil {
 		return err
 	}
+	defer releaseMapIterator(iterator)
 
 	var key, value Value
 	for {
@@ -3830,12 +4554,65 @@ func (m *OrderedMap) Iterate(fn MapEntryIterationFunc) error {
 	}
 }
 
+// MapStorableIterationFunc is called with key and value storables of map element.
+type MapStorableIterationFunc func(key MapKey, value MapValue) (resume bool, err error)
+
+// IterateStorables iterates map elements in iteration order without
+// decoding them, passing key and value storables of each element to fn.
+func (m *OrderedMap) IterateStorables(fn MapStorableIterationFunc) error {
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	iterator, err := pooledMapIterator(m)
+	if err != nil {
+		return err
+	}
+	defer releaseMapIterator(iterator)
+
+	for {
+		key, value, err := iterator.NextStorables()
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return nil
+		}
+		resume, err := fn(key, value)
+		if err != nil {
+			return err
+		}
+		if !resume {
+			return nil
+		}
+	}
+}
+
+// MapIndexedEntryIterationFunc is called with ordinal position, key,
+// and value of map entry.
+type MapIndexedEntryIterationFunc func(index uint64, key Value, value Value) (resume bool, err error)
+
+// IterateWithIndex iterates map entries in iteration order, passing
+// ordinal position of each entry to fn.
+func (m *OrderedMap) IterateWithIndex(fn MapIndexedEntryIterationFunc) error {
+	var index uint64
+	return m.Iterate(func(key Value, value Value) (bool, error) {
+		resume, err := fn(index, key, value)
+		index++
+		return resume, err
+	})
+}
+
 func (m *OrderedMap) IterateKeys(fn MapElementIterationFunc) error {
 
-	iterator, err := m.Iterator()
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	iterator, err := pooledMapIterator(m)
 	if err != nil {
 		return err
 	}
+	defer releaseMapIterator(iterator)
 
 	var key Value
 	for {
@@ -3858,10 +4635,14 @@ func (m *OrderedMap) IterateKeys(fn MapElementIterationFunc) error {
 
 func (m *OrderedMap) IterateValues(fn MapElementIterationFunc) error {
 
-	iterator, err := m.Iterator()
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	iterator, err := pooledMapIterator(m)
 	if err != nil {
 		return err
 	}
+	defer releaseMapIterator(iterator)
 
 	var value Value
 	for {
@@ -3882,6 +4663,48 @@ func (m *OrderedMap) IterateValues(fn MapElementIterationFunc) error {
 	}
 }
 
+// MapKeyIterator iterates map keys in iteration order without decoding
+// values.
+type MapKeyIterator struct {
+	iterator MapIterator
+}
+
+// KeyIterator returns iterator of map keys.
+func (m *OrderedMap) KeyIterator() (*MapKeyIterator, error) {
+	i := &MapKeyIterator{}
+	err := i.iterator.Reset(m)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Next returns next key, or nil if there are no more keys.
+func (i *MapKeyIterator) Next() (Value, error) {
+	return i.iterator.NextKey()
+}
+
+// MapValueIterator iterates map values in iteration order without
+// decoding keys.
+type MapValueIterator struct {
+	iterator MapIterator
+}
+
+// ValueIterator returns iterator of map values.
+func (m *OrderedMap) ValueIterator() (*MapValueIterator, error) {
+	i := &MapValueIterator{}
+	err := i.iterator.Reset(m)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Next returns next value, or nil if there are no more values.
+func (i *MapValueIterator) Next() (Value, error) {
+	return i.iterator.NextValue()
+}
+
 type MapPopIterationFunc func(Storable, Storable)
 
 // PopIterate iterates and removes elements backward.
@@ -3893,11 +4716,30 @@ func (m *OrderedMap) PopIterate(fn MapPopIterationFunc) error {
 		return err
 	}
 
+	err = m.clearInsertionOrder()
+	if err != nil {
+		return err
+	}
+
+	// Removed elements can't be restored, so recorded operations are discarded.
+	if m.journal != nil {
+		err = m.journal.reset(m.Storage)
+		if err != nil {
+			return err
+		}
+	}
+
 	rootID := m.root.ID()
 
 	// Set map count to 0 in extraData
 	extraData := m.root.ExtraData()
 	extraData.Count = 0
+	if extraData.MutationSequence != 0 {
+		extraData.MutationSequence++
+	}
+	if extraData.Limits != nil {
+		extraData.Limits.ByteSize = 0
+	}
 
 	// Set root to empty data slab
 	m.root = &MapDataSlab{
@@ -3924,6 +4766,10 @@ type MapElementProvider func() (Value, Value, error)
 // And callback function must return elements in the same order as the original map.
 // New map uses and stores the same seed as the original map.
 // This function should only be used for copying a map.
+//
+// A key provided more than once is handled by DuplicateKeyPolicy set with
+// WithDuplicateKeyPolicy or WithDuplicateKeyMerge.  Duplicate keys need to be
+// provided next to each other or to keys with the same digest.
 func NewMapFromBatchData(
 	storage SlabStorage,
 	address Address,
@@ -3933,6 +4779,7 @@ func NewMapFromBatchData(
 	hip HashInputProvider,
 	seed uint64,
 	fn MapElementProvider,
+	options ...BatchOption,
 ) (
 	*OrderedMap,
 	error,
@@ -3940,10 +4787,20 @@ func NewMapFromBatchData(
 
 	const defaultElementCountInSlab = 32
 
+	opts := newBatchOptions(options)
+
+	// Number of leading data slabs stored and committed
+	committed := 0
+
 	if seed == 0 {
 		return nil, NewHashSeedUninitializedError()
 	}
 
+	userMetadata, err := newUserMetadata(opts.userMetadata)
+	if err != nil {
+		return nil, err
+	}
+
 	// Seed digester
 	digesterBuilder.SetSeed(seed, typicalRandomConstant)
 
@@ -3998,11 +4855,23 @@ func NewMapFromBatchData(
 			prevElem := elements.elems[lastElementIndex]
 			prevElemSize := prevElem.Size()
 
+			if opts.duplicateKeyPolicy != DuplicateKeyPolicyError {
+				value, err = opts.resolveDuplicateKey(storage, prevElem, digester, hkey, comparator, key, value)
+				if err != nil {
+					return nil, err
+				}
+				if value == nil {
+					// Keep existing value of duplicate key
+					putDigester(digester)
+					continue
+				}
+			}
+
 			elem, existingValue, err := prevElem.Set(storage, address, digesterBuilder, digester, 0, hkey, comparator, hip, key, value)
 			if err != nil {
 				return nil, err
 			}
-			if existingValue != nil {
+			if existingValue != nil && opts.duplicateKeyPolicy == DuplicateKeyPolicyError {
 				return nil, NewFatalError(NewDuplicateKeyError(key))
 			}
 
@@ -4011,6 +4880,15 @@ func NewMapFromBatchData(
 
 			putDigester(digester)
 
+			if existingValue != nil {
+				// Value of duplicate key is replaced
+				err = removeReplacedStorable(storage, existingValue)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
 			count++
 
 			continue
@@ -4061,6 +4939,17 @@ func NewMapFromBatchData(
 				hkeys: make([]Digest, 0, defaultElementCountInSlab),
 				elems: make([]element, 0, defaultElementCountInSlab),
 			}
+
+			commit, err := opts.dataSlabBuilt(count, uint64(len(slabs)))
+			if err != nil {
+				return nil, err
+			}
+			if commit {
+				committed, err = opts.commitMapDataSlabs(storage, slabs, committed)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		elements.hkeys = append(elements.hkeys, hkey)
@@ -4085,6 +4974,8 @@ func NewMapFromBatchData(
 	// Append last data slab to slabs
 	slabs = append(slabs, dataSlab)
 
+	opts.done(count, uint64(len(slabs)))
+
 	for len(slabs) > 1 {
 
 		lastSlab := slabs[len(slabs)-1]
@@ -4124,8 +5015,8 @@ func NewMapFromBatchData(
 			break
 		}
 
-		// Store all slabs
-		for _, slab := range slabs {
+		// Store all slabs, except committed data slabs
+		for _, slab := range slabs[committed:] {
 			err = storage.Store(slab.ID(), slab)
 			if err != nil {
 				return nil, err
@@ -4138,6 +5029,8 @@ func NewMapFromBatchData(
 			return nil, err
 		}
 
+		committed = 0
+
 	}
 
 	// found root slab
@@ -4148,7 +5041,20 @@ func NewMapFromBatchData(
 		dataSlab.header.size = dataSlab.header.size - mapDataSlabPrefixSize + mapRootDataSlabPrefixSize
 	}
 
-	extraData := &MapExtraData{TypeInfo: typeInfo, Count: count, Seed: seed}
+	provenance, err := newProvenance(storage, address)
+	if err != nil {
+		return nil, err
+	}
+
+	extraData := &MapExtraData{
+		TypeInfo:      typeInfo,
+		Count:         count,
+		Seed:          seed,
+		DigesterType:  digesterTypeOf(digesterBuilder),
+		DigesterKeyID: digesterKeyIDOf(digesterBuilder),
+		Provenance:    provenance,
+		UserMetadata:  userMetadata,
+	}
 
 	// Set extra data in root
 	root.SetExtraData(extraData)
@@ -4159,6 +5065,11 @@ func NewMapFromBatchData(
 		return nil, err
 	}
 
+	err = initNesting(storage, root.ID())
+	if err != nil {
+		return nil, err
+	}
+
 	return &OrderedMap{
 		Storage:         storage,
 		root:            root,
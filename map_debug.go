@@ -22,6 +22,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 	"sort"
 	"strings"
@@ -36,6 +38,21 @@ type MapStats struct {
 	DataSlabCount          uint64
 	CollisionDataSlabCount uint64
 	StorableSlabCount      uint64
+	// LevelStats is indexed by tree level, with root slab at level 0.
+	LevelStats []MapLevelStats
+}
+
+// MapLevelStats contains stats about map slabs at one tree level.
+// Elements and external collision groups are counted at the level
+// of the data slab containing them.  ByteSize is the total size of
+// metadata and data slabs at the level, excluding collision and
+// storable slabs.
+type MapLevelStats struct {
+	MetaDataSlabCount           uint64
+	DataSlabCount               uint64
+	ElementCount                uint64
+	ByteSize                    uint64
+	ExternalCollisionGroupCount uint64
 }
 
 func (s *MapStats) SlabCount() uint64 {
@@ -50,6 +67,8 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 	collisionDataSlabCount := uint64(0)
 	storableDataSlabCount := uint64(0)
 
+	var levelStats []MapLevelStats
+
 	nextLevelIDs := []StorageID{m.StorageID()}
 
 	for len(nextLevelIDs) > 0 {
@@ -58,6 +77,8 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 
 		nextLevelIDs = []StorageID(nil)
 
+		var stats MapLevelStats
+
 		for _, id := range ids {
 
 			slab, err := getMapSlab(m.Storage, id)
@@ -65,8 +86,11 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 				return MapStats{}, err
 			}
 
+			stats.ByteSize += uint64(slab.ByteSize())
+
 			if slab.IsData() {
 				dataSlabCount++
+				stats.DataSlabCount++
 
 				leaf := slab.(*MapDataSlab)
 				elementGroups := []elements{leaf.elements}
@@ -88,6 +112,7 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 							if group, ok := elem.(elementGroup); ok {
 								if !group.Inline() {
 									collisionDataSlabCount++
+									stats.ExternalCollisionGroupCount++
 								}
 
 								nested, err := group.Elements(m.Storage)
@@ -97,6 +122,8 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 								nestedElementGroups = append(nestedElementGroups, nested)
 
 							} else {
+								stats.ElementCount++
+
 								e := elem.(*singleElement)
 								if _, ok := e.key.(StorageIDStorable); ok {
 									storableDataSlabCount++
@@ -111,6 +138,7 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 				}
 			} else {
 				metaDataSlabCount++
+				stats.MetaDataSlabCount++
 
 				for _, storable := range slab.ChildStorables() {
 					id, ok := storable.(StorageIDStorable)
@@ -122,6 +150,8 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 			}
 		}
 
+		levelStats = append(levelStats, stats)
+
 		level++
 	}
 
@@ -132,19 +162,34 @@ func GetMapStats(m *OrderedMap) (MapStats, error) {
 		DataSlabCount:          dataSlabCount,
 		CollisionDataSlabCount: collisionDataSlabCount,
 		StorableSlabCount:      storableDataSlabCount,
+		LevelStats:             levelStats,
 	}, nil
 }
 
+// PrintMap prints map slab data to stdout.
 func PrintMap(m *OrderedMap) {
-	dumps, err := DumpMapSlabs(m)
+	err := FprintMap(os.Stdout, m, DefaultPrintOptions)
 	if err != nil {
 		fmt.Println(err)
-		return
 	}
-	fmt.Println(strings.Join(dumps, "\n"))
+}
+
+// FprintMap writes map slab data to w, one slab per line,
+// formatted with opts.
+func FprintMap(w io.Writer, m *OrderedMap, opts PrintOptions) error {
+	dumps, err := dumpMapSlabs(m, opts)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, strings.Join(dumps, "\n"))
+	return err
 }
 
 func DumpMapSlabs(m *OrderedMap) ([]string, error) {
+	return dumpMapSlabs(m, DefaultPrintOptions)
+}
+
+func dumpMapSlabs(m *OrderedMap, opts PrintOptions) ([]string, error) {
 	var dumps []string
 
 	nextLevelIDs := []StorageID{m.StorageID()}
@@ -168,7 +213,7 @@ func DumpMapSlabs(m *OrderedMap) ([]string, error) {
 
 			if slab.IsData() {
 				dataSlab := slab.(*MapDataSlab)
-				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, dataSlab))
+				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, opts.formatMapSlab(dataSlab)))
 
 				for i := 0; i < int(dataSlab.elements.Count()); i++ {
 					elem, err := dataSlab.elements.Element(i)
@@ -192,7 +237,7 @@ func DumpMapSlabs(m *OrderedMap) ([]string, error) {
 
 			} else {
 				meta := slab.(*MapMetaDataSlab)
-				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, meta))
+				dumps = append(dumps, fmt.Sprintf("level %d, %s", level+1, opts.formatMapSlab(meta)))
 
 				for _, storable := range slab.ChildStorables() {
 					id, ok := storable.(StorageIDStorable)
@@ -212,7 +257,7 @@ func DumpMapSlabs(m *OrderedMap) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		dumps = append(dumps, fmt.Sprintf("collision: %s", slab.String()))
+		dumps = append(dumps, fmt.Sprintf("collision: %s", opts.formatMapSlab(slab)))
 	}
 
 	// overflowIDs include collisionSlabIDs
@@ -1220,7 +1265,7 @@ func mapSingleElementEqual(
 		return fmt.Errorf("singleElement valuePointer %t is wrong, want %t", actual.valuePointer, expected.valuePointer)
 	}
 
-	if !compare(expected.key, actual.key) {
+	if !storableEqual(expected.key, actual.key, compare) {
 		return fmt.Errorf("singleElement key %v is wrong, want %v", actual.key, expected.key)
 	}
 
@@ -1245,7 +1290,7 @@ func mapSingleElementEqual(
 		}
 	}
 
-	if !compare(expected.value, actual.value) {
+	if !storableEqual(expected.value, actual.value, compare) {
 		return fmt.Errorf("singleElement value %v is wrong, want %v", actual.value, expected.value)
 	}
 
@@ -0,0 +1,255 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "errors"
+
+// MergeResolver returns value stored for key present in both merged maps
+// with different values.  Resolver must be deterministic and symmetric
+// (resolving (a, b) and (b, a) returns the same value) for merges of
+// divergent copies to converge regardless of merge direction.
+type MergeResolver func(key Value, local Value, remote Value) (Value, error)
+
+// LastWriterWins is MergeResolver of TimestampedValue values.
+// Value with greater timestamp wins, and replica breaks timestamp ties.
+// Different values with the same timestamp and replica are reported
+// as MergeConflictError.
+func LastWriterWins(key Value, local Value, remote Value) (Value, error) {
+	l, ok := local.(TimestampedValue)
+	if !ok {
+		return nil, NewMergeConflictError(key, "local value isn't timestamped")
+	}
+
+	r, ok := remote.(TimestampedValue)
+	if !ok {
+		return nil, NewMergeConflictError(key, "remote value isn't timestamped")
+	}
+
+	switch {
+	case l.Timestamp != r.Timestamp:
+		if l.Timestamp > r.Timestamp {
+			return local, nil
+		}
+		return remote, nil
+
+	case l.Replica != r.Replica:
+		if l.Replica > r.Replica {
+			return local, nil
+		}
+		return remote, nil
+
+	default:
+		return nil, NewMergeConflictError(key, "different values have the same timestamp and replica")
+	}
+}
+
+// Merge merges elements of other map into m.  Keys only present in other
+// are inserted into m.  Keys present in both maps with values that aren't
+// equal according to comparator are resolved by resolver.  Keys only
+// present in m are kept, so removals need to be represented as values
+// (tombstones) to be merged.
+//
+// Merged values are deep copied into m, so m and other don't share nested
+// collections.  Replaced values of m are removed with their nested
+// collections, unless journal of m is enabled and keeps them for Undo.
+//
+// Merge is atomic.  Elements are resolved and validated before m is
+// modified, so resolver errors leave m unchanged, and elements already
+// stored are reverted if storing an element fails.
+func (m *OrderedMap) Merge(
+	comparator ValueComparator,
+	hip HashInputProvider,
+	other *OrderedMap,
+	resolver MergeResolver,
+) error {
+
+	updates, err := m.mergeUpdates(comparator, hip, other, resolver)
+	if err != nil {
+		return err
+	}
+
+	// Copy merged values before m is modified.
+	for i := range updates {
+		u := &updates[i]
+
+		u.storable, err = m.copyMergedValue(comparator, hip, u.value)
+		if err != nil {
+			return m.releaseMergeStorables(updates[:i], err)
+		}
+	}
+
+	for i := range updates {
+		u := &updates[i]
+
+		u.replaced, err = m.Set(comparator, hip, u.key, storableValue{u.storable})
+		if err != nil {
+			return m.revertMerge(comparator, hip, updates, i, err)
+		}
+	}
+
+	for _, u := range updates {
+		err = m.releaseMerged(u.replaced)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeUpdate is element stored in map by Merge.
+type mergeUpdate struct {
+	key   Value
+	value Value
+	// storable is storable of value copied to map.
+	storable Storable
+	// replaced is storable of value replaced by merge, or nil
+	// if key is inserted.
+	replaced Storable
+}
+
+// mergeUpdates returns elements of other to store in m.
+func (m *OrderedMap) mergeUpdates(
+	comparator ValueComparator,
+	hip HashInputProvider,
+	other *OrderedMap,
+	resolver MergeResolver,
+) ([]mergeUpdate, error) {
+
+	iterator, err := other.Iterator()
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []mergeUpdate
+	for {
+		key, remote, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return updates, nil
+		}
+
+		localStorable, err := m.Get(comparator, hip, key)
+		if err != nil {
+			var keyNotFoundError *KeyNotFoundError
+			if !errors.As(err, &keyNotFoundError) {
+				return nil, err
+			}
+
+			err = m.validateElement(key, remote)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, mergeUpdate{key: key, value: remote})
+			continue
+		}
+
+		equal, err := comparator(m.Storage, remote, localStorable)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			continue
+		}
+
+		local, err := localStorable.StoredValue(m.Storage)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved, err := resolver(key, local, remote)
+		if err != nil {
+			return nil, err
+		}
+
+		equal, err = comparator(m.Storage, resolved, localStorable)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			continue
+		}
+
+		err = m.validateElement(key, resolved)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, mergeUpdate{key: key, value: resolved})
+	}
+}
+
+// copyMergedValue deep copies value to m and returns its storable.
+func (m *OrderedMap) copyMergedValue(comparator ValueComparator, hip HashInputProvider, value Value) (Storable, error) {
+	copied, err := DeepCopyValue(value, m.Storage, m.Address(), comparator, hip)
+	if err != nil {
+		return nil, err
+	}
+	return copied.Storable(m.Storage, m.Address(), MaxInlineMapKeyOrValueSize)
+}
+
+// revertMerge reverts first n updates stored by Merge in reverse order,
+// releases copied values, and returns err.
+func (m *OrderedMap) revertMerge(comparator ValueComparator, hip HashInputProvider, updates []mergeUpdate, n int, err error) error {
+	for i := n - 1; i >= 0; i-- {
+		u := updates[i]
+
+		var unlinked Storable
+		var revertErr error
+		if u.replaced == nil {
+			unlinked, revertErr = m.removeReleasingKey(comparator, hip, u.key)
+		} else {
+			unlinked, revertErr = m.Set(comparator, hip, u.key, storableValue{u.replaced})
+		}
+		if revertErr != nil {
+			return revertErr
+		}
+
+		revertErr = m.releaseMerged(unlinked)
+		if revertErr != nil {
+			return revertErr
+		}
+	}
+	return m.releaseMergeStorables(updates[n:], err)
+}
+
+// releaseMergeStorables releases copied values of updates that aren't
+// stored in m, and returns err.
+func (m *OrderedMap) releaseMergeStorables(updates []mergeUpdate, err error) error {
+	for _, u := range updates {
+		if u.storable == nil {
+			continue
+		}
+		_, releaseErr := releaseRemovedStorable(m.Storage, u.storable)
+		if releaseErr != nil {
+			return releaseErr
+		}
+	}
+	return err
+}
+
+// releaseMerged releases storable unlinked from m by Merge unless journal
+// keeps it.
+func (m *OrderedMap) releaseMerged(storable Storable) error {
+	if m.journal != nil || storable == nil {
+		return nil
+	}
+	_, err := releaseRemovedStorable(m.Storage, storable)
+	return err
+}
@@ -0,0 +1,285 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampedStorableEncodeDecode(t *testing.T) {
+	storage := newTestPersistentStorage(t)
+
+	storable := TimestampedStorable{Timestamp: 1000, Replica: 2, Storable: Uint64Value(42)}
+
+	data, err := Encode(storable, storage.cborEncMode)
+	require.NoError(t, err)
+	require.Equal(t,
+		[]byte{
+			0xd8, CBORTagTimestampedValue,
+			0x83,
+			0x19, 0x03, 0xe8,
+			0x02,
+			0xd8, cborTagUInt64Value, 0x18, 0x2a,
+		},
+		data,
+	)
+	require.Equal(t, uint32(len(data)), storable.ByteSize())
+
+	decoded, err := decodeStorable(cbor.NewByteStreamDecoder(data), StorageIDUndefined)
+	require.NoError(t, err)
+	require.Equal(t, storable, decoded)
+
+	value, err := decoded.StoredValue(storage)
+	require.NoError(t, err)
+	require.Equal(t, TimestampedValue{Timestamp: 1000, Replica: 2, Value: Uint64Value(42)}, value)
+}
+
+func TestMapMerge(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	comparator := NewTimestampedValueComparator(compare)
+
+	ts := func(timestamp uint64, replica uint64, v uint64) TimestampedValue {
+		return TimestampedValue{Timestamp: timestamp, Replica: replica, Value: Uint64Value(v)}
+	}
+
+	mapElements := func(m *OrderedMap) map[Value]Value {
+		elements := make(map[Value]Value)
+		err := m.Iterate(func(k Value, v Value) (bool, error) {
+			elements[k] = v
+			return true, nil
+		})
+		require.NoError(t, err)
+		return elements
+	}
+
+	// newReplicas returns two divergent copies of a map.
+	newReplicas := func(storage SlabStorage) (*OrderedMap, *OrderedMap) {
+		a, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		b, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 10; i++ {
+			_, err = a.Set(comparator, hashInputProvider, Uint64Value(i), ts(1, 0, i))
+			require.NoError(t, err)
+			_, err = b.Set(comparator, hashInputProvider, Uint64Value(i), ts(1, 0, i))
+			require.NoError(t, err)
+		}
+
+		// Replica 1 edits key 1 later than replica 2.
+		_, err = a.Set(comparator, hashInputProvider, Uint64Value(1), ts(3, 1, 100))
+		require.NoError(t, err)
+		_, err = b.Set(comparator, hashInputProvider, Uint64Value(1), ts(2, 2, 200))
+		require.NoError(t, err)
+
+		// Concurrent edits of key 2 are ordered by replica.
+		_, err = a.Set(comparator, hashInputProvider, Uint64Value(2), ts(2, 1, 101))
+		require.NoError(t, err)
+		_, err = b.Set(comparator, hashInputProvider, Uint64Value(2), ts(2, 2, 201))
+		require.NoError(t, err)
+
+		// Keys added by one replica.
+		_, err = a.Set(comparator, hashInputProvider, Uint64Value(20), ts(2, 1, 20))
+		require.NoError(t, err)
+		_, err = b.Set(comparator, hashInputProvider, Uint64Value(30), ts(2, 2, 30))
+		require.NoError(t, err)
+
+		return a, b
+	}
+
+	expected := make(map[Value]Value)
+	for i := uint64(0); i < 10; i++ {
+		expected[Uint64Value(i)] = ts(1, 0, i)
+	}
+	expected[Uint64Value(1)] = ts(3, 1, 100)
+	expected[Uint64Value(2)] = ts(2, 2, 201)
+	expected[Uint64Value(20)] = ts(2, 1, 20)
+	expected[Uint64Value(30)] = ts(2, 2, 30)
+
+	t.Run("last writer wins", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		a, b := newReplicas(storage)
+
+		// Merge in both directions.
+		a2, b2 := newReplicas(storage)
+
+		err := a.Merge(comparator, hashInputProvider, b, LastWriterWins)
+		require.NoError(t, err)
+		require.Equal(t, expected, mapElements(a))
+
+		err = b2.Merge(comparator, hashInputProvider, a2, LastWriterWins)
+		require.NoError(t, err)
+		require.Equal(t, expected, mapElements(b2))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		a, b := newReplicas(storage)
+
+		_, err := b.Set(comparator, hashInputProvider, Uint64Value(1), ts(3, 1, 300))
+		require.NoError(t, err)
+
+		before := mapElements(a)
+
+		err = a.Merge(comparator, hashInputProvider, b, LastWriterWins)
+		var mergeConflictError *MergeConflictError
+		require.ErrorAs(t, err, &mergeConflictError)
+		require.True(t, IsUserError(err))
+
+		// Conflict leaves map unchanged.
+		require.Equal(t, before, mapElements(a))
+	})
+
+	t.Run("resolver", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		a, b := newReplicas(storage)
+
+		// Resolver keeping the greater value regardless of timestamp.
+		resolver := func(key Value, local Value, remote Value) (Value, error) {
+			if local.(TimestampedValue).Value.(Uint64Value) > remote.(TimestampedValue).Value.(Uint64Value) {
+				return local, nil
+			}
+			return remote, nil
+		}
+
+		err := a.Merge(comparator, hashInputProvider, b, resolver)
+		require.NoError(t, err)
+
+		v, err := a.Get(comparator, hashInputProvider, Uint64Value(1))
+		require.NoError(t, err)
+		require.Equal(t, TimestampedStorable{Timestamp: 2, Replica: 2, Storable: Uint64Value(200)}, v)
+		require.Equal(t, uint64(12), a.Count())
+	})
+}
+
+func TestMapMergeOwnership(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Large strings are stored in separate slabs.
+	largeString := func(s string) Value {
+		return NewStringValue(strings.Repeat(s, int(MaxInlineMapKeyOrValueSize)))
+	}
+
+	remoteWins := func(key Value, local Value, remote Value) (Value, error) {
+		return remote, nil
+	}
+
+	// Nested arrays aren't equal to other values.
+	comparator := func(storage SlabStorage, value Value, storable Storable) (bool, error) {
+		if _, ok := value.(*Array); ok {
+			return false, nil
+		}
+		return compare(storage, value, storable)
+	}
+
+	newMaps := func(storage SlabStorage) (*OrderedMap, *OrderedMap) {
+		local, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		remote, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 5; i++ {
+			_, err = local.Set(compare, hashInputProvider, Uint64Value(i), largeString("a"))
+			require.NoError(t, err)
+
+			nested, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, nested.Append(largeString("b")))
+
+			_, err = remote.Set(compare, hashInputProvider, Uint64Value(i*2), nested)
+			require.NoError(t, err)
+		}
+		return local, remote
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		local, remote := newMaps(storage)
+
+		err := local.Merge(comparator, hashInputProvider, remote, remoteWins)
+		require.NoError(t, err)
+		require.Equal(t, uint64(7), local.Count())
+
+		// Replaced values are released, and nested collections of remote
+		// are copied instead of shared.
+		_, err = CheckStorageHealth(storage, 2)
+		require.NoError(t, err)
+
+		_, removed, err := local.RemoveAndRelease(compare, hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+		require.IsType(t, &Array{}, removed)
+
+		v, err := remote.Get(compare, hashInputProvider, Uint64Value(0))
+		require.NoError(t, err)
+
+		nested, err := v.StoredValue(storage)
+		require.NoError(t, err)
+		require.Equal(t, []Value{largeString("b")}, arrayElements(t, nested.(*Array)))
+
+		_, err = CheckStorageHealth(storage, 2)
+		require.NoError(t, err)
+	})
+
+	t.Run("revert", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		local, remote := newMaps(storage)
+
+		localElements := make(map[Value]Value)
+		err := local.Iterate(func(k Value, v Value) (bool, error) {
+			localElements[k] = v
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		// Element count limit rejects the second inserted key.
+		err = local.SetLimits(CollectionLimits{MaxCount: 6})
+		require.NoError(t, err)
+
+		err = local.Merge(comparator, hashInputProvider, remote, remoteWins)
+		var collectionLimitError *CollectionLimitError
+		require.ErrorAs(t, err, &collectionLimitError)
+
+		elements := make(map[Value]Value)
+		err = local.Iterate(func(k Value, v Value) (bool, error) {
+			elements[k] = v
+			return true, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, localElements, elements)
+
+		_, err = CheckStorageHealth(storage, 2)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,154 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// IterateRange iterates map entries with first level digest in
+// [startDigest, endDigest) in iteration order, passing key and value of
+// each entry to fn.  Maps created with DigesterBuilder whose first level
+// digest preserves key order can use it for key range scans.  Data slab
+// containing startDigest is found using first keys in metadata slabs, so
+// slabs before the range aren't retrieved.
+func (m *OrderedMap) IterateRange(startDigest Digest, endDigest Digest, fn MapEntryIterationFunc) error {
+	if startDigest >= endDigest {
+		return nil
+	}
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	atomic.AddUint64(&m.stats.Iterations, 1)
+
+	slab := m.root
+	for !slab.IsData() {
+		meta := slab.(*MapMetaDataSlab)
+
+		// Find last child slab with first key not greater than startDigest.
+		childHeaderIndex := sort.Search(len(meta.childrenHeaders), func(i int) bool {
+			return meta.childrenHeaders[i].firstKey > startDigest
+		}) - 1
+		if childHeaderIndex < 0 {
+			childHeaderIndex = 0
+		}
+
+		childID := meta.childrenHeaders[childHeaderIndex].id
+
+		child, err := getMapSlab(storage, childID)
+		if err != nil {
+			return wrapSlabPathError(err, meta.header.id, childHeaderIndex, childID)
+		}
+
+		slab = child
+	}
+
+	for {
+		dataSlab, ok := slab.(*MapDataSlab)
+		if !ok {
+			return NewSlabDataErrorf("slab %s isn't MapDataSlab", slab.ID())
+		}
+
+		elems, ok := dataSlab.elements.(*hkeyElements)
+		if !ok {
+			return NewSlabDataErrorf("MapDataSlab %s doesn't have hkeyElements", dataSlab.ID())
+		}
+
+		i := sort.Search(len(elems.hkeys), func(i int) bool {
+			return elems.hkeys[i] >= startDigest
+		})
+
+		for ; i < len(elems.hkeys); i++ {
+			if elems.hkeys[i] >= endDigest {
+				return nil
+			}
+
+			resume, err := m.iterateRangeElement(storage, elems.elems[i], fn)
+			if err != nil || !resume {
+				return err
+			}
+		}
+
+		if dataSlab.next == StorageIDUndefined {
+			return nil
+		}
+
+		next, err := getMapSlab(storage, dataSlab.next)
+		if err != nil {
+			return err
+		}
+
+		slab = next
+	}
+}
+
+// iterateRangeElement passes entries of element, including entries of
+// collision group, to fn.
+func (m *OrderedMap) iterateRangeElement(storage SlabStorage, e element, fn MapEntryIterationFunc) (resume bool, err error) {
+	switch elm := e.(type) {
+	case *singleElement:
+		return m.iterateRangeEntry(elm.key, elm.value, fn)
+
+	case elementGroup:
+		group, err := elm.Elements(storage)
+		if err != nil {
+			return false, err
+		}
+
+		iterator := MapElementIterator{
+			storage:  storage,
+			elements: group,
+		}
+
+		for {
+			key, value, err := iterator.Next()
+			if err != nil {
+				return false, err
+			}
+			if key == nil {
+				return true, nil
+			}
+
+			resume, err := m.iterateRangeEntry(key, value, fn)
+			if err != nil || !resume {
+				return resume, err
+			}
+		}
+
+	default:
+		return false, NewSlabDataError(fmt.Errorf("unexpected element type %T during map iteration", e))
+	}
+}
+
+func (m *OrderedMap) iterateRangeEntry(ks MapKey, vs MapValue, fn MapEntryIterationFunc) (resume bool, err error) {
+	key, err := ks.StoredValue(m.Storage)
+	if err != nil {
+		return false, err
+	}
+
+	value, err := vs.StoredValue(m.Storage)
+	if err != nil {
+		return false, err
+	}
+
+	return fn(key, value)
+}
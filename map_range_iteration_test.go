@@ -0,0 +1,97 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapIterateRange(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	const mapSize = 1024
+
+	// Digests preserve key order, and every group of keys shares first
+	// level digest to create inline or external collision groups.
+	newMap := func(t *testing.T, groupSize uint64) *OrderedMap {
+		storage := newTestPersistentStorage(t)
+
+		digesterBuilder := &mockDigesterBuilder{}
+		for i := uint64(0); i < mapSize; i++ {
+			digesterBuilder.On("Digest", Uint64Value(i)).Return(mockDigester{[]Digest{Digest(i / groupSize), Digest(i)}})
+		}
+
+		m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < mapSize; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*2))
+			require.NoError(t, err)
+		}
+		require.False(t, m.root.IsData())
+
+		return m
+	}
+
+	for _, groupSize := range []uint64{1, 2, 64} {
+		m := newMap(t, groupSize)
+
+		for _, r := range [][2]Digest{{0, 1}, {0, 10}, {5, 17}, {10, 20}, {7, 1000000}, {20, 20}, {30, 20}} {
+			startDigest, endDigest := r[0], r[1]
+
+			i := uint64(startDigest) * groupSize
+			end := uint64(endDigest) * groupSize
+			if end > mapSize {
+				end = mapSize
+			}
+
+			err := m.IterateRange(startDigest, endDigest, func(k Value, v Value) (bool, error) {
+				require.Equal(t, Uint64Value(i), k)
+				require.Equal(t, Uint64Value(i*2), v)
+				i++
+				return true, nil
+			})
+			require.NoError(t, err)
+
+			if startDigest < endDigest {
+				require.Equal(t, end, i)
+			}
+		}
+	}
+
+	t.Run("stop", func(t *testing.T) {
+		m := newMap(t, 2)
+
+		count := 0
+		err := m.IterateRange(100, 200, func(k Value, v Value) (bool, error) {
+			require.Equal(t, Uint64Value(200+count), k)
+			count++
+			return count < 5, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 5, count)
+	})
+}
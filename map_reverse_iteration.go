@@ -0,0 +1,109 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// IterateReverse iterates map entries in reverse iteration order, from
+// the highest digest down, passing key and value of each entry to fn.
+// Slabs are retrieved as they are reached, so stopping early doesn't
+// load the rest of the map.
+func (m *OrderedMap) IterateReverse(fn MapEntryIterationFunc) error {
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	atomic.AddUint64(&m.stats.Iterations, 1)
+
+	_, err := m.iterateSlabReverse(storage, m.root, fn)
+	return err
+}
+
+func (m *OrderedMap) iterateSlabReverse(storage SlabStorage, slab MapSlab, fn MapEntryIterationFunc) (resume bool, err error) {
+
+	if meta, ok := slab.(*MapMetaDataSlab); ok {
+		for i := len(meta.childrenHeaders) - 1; i >= 0; i-- {
+			child, err := getMapSlab(storage, meta.childrenHeaders[i].id)
+			if err != nil {
+				return false, err
+			}
+			resume, err := m.iterateSlabReverse(storage, child, fn)
+			if err != nil || !resume {
+				return resume, err
+			}
+		}
+		return true, nil
+	}
+
+	dataSlab, ok := slab.(*MapDataSlab)
+	if !ok {
+		return false, NewSlabDataErrorf("slab %s isn't MapDataSlab", slab.ID())
+	}
+
+	return m.iterateElementsReverse(storage, dataSlab.elements, fn)
+}
+
+// iterateElementsReverse iterates elements in reverse order, including
+// elements of collision groups.
+func (m *OrderedMap) iterateElementsReverse(storage SlabStorage, elems elements, fn MapEntryIterationFunc) (resume bool, err error) {
+
+	for i := int(elems.Count()) - 1; i >= 0; i-- {
+		e, err := elems.Element(i)
+		if err != nil {
+			return false, err
+		}
+
+		switch elm := e.(type) {
+		case *singleElement:
+			key, err := elm.key.StoredValue(m.Storage)
+			if err != nil {
+				return false, err
+			}
+
+			value, err := elm.value.StoredValue(m.Storage)
+			if err != nil {
+				return false, err
+			}
+
+			resume, err := fn(key, value)
+			if err != nil || !resume {
+				return resume, err
+			}
+
+		case elementGroup:
+			group, err := elm.Elements(storage)
+			if err != nil {
+				return false, err
+			}
+
+			resume, err := m.iterateElementsReverse(storage, group, fn)
+			if err != nil || !resume {
+				return resume, err
+			}
+
+		default:
+			return false, NewSlabDataError(fmt.Errorf("unexpected element type %T during map iteration", e))
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapIterateReverse(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("empty", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		err = m.IterateReverse(func(Value, Value) (bool, error) {
+			require.Fail(t, "empty map shouldn't have entries")
+			return true, nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("with collisions", func(t *testing.T) {
+		const mapSize = 1024
+
+		storage := newTestPersistentStorage(t)
+
+		// Few first level digests create inline and external collision groups.
+		digesterBuilder := &mockDigesterBuilder{}
+		for i := uint64(0); i < mapSize; i++ {
+			digesterBuilder.On("Digest", Uint64Value(i)).Return(mockDigester{[]Digest{Digest(i % 64), Digest(i)}})
+		}
+
+		m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < mapSize; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*2))
+			require.NoError(t, err)
+		}
+		require.False(t, m.root.IsData())
+
+		var keys []Value
+		err = m.IterateKeys(func(k Value) (bool, error) {
+			keys = append(keys, k)
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		i := len(keys)
+		err = m.IterateReverse(func(k Value, v Value) (bool, error) {
+			i--
+			require.Equal(t, keys[i], k)
+			require.Equal(t, Uint64Value(uint64(k.(Uint64Value))*2), v)
+			return true, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, i)
+
+		// Iteration stops when fn returns false.
+		var visited []Value
+		err = m.IterateReverse(func(k Value, _ Value) (bool, error) {
+			visited = append(visited, k)
+			return len(visited) < 10, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 10, len(visited))
+		require.Equal(t, keys[len(keys)-1], visited[0])
+	})
+}
@@ -19,6 +19,7 @@
 package atree
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -188,6 +189,7 @@ func verifyMap(
 		stats, err := GetMapStats(m)
 		require.NoError(t, err)
 		require.Equal(t, stats.SlabCount(), uint64(storage.Count()))
+		verifyMapLevelStats(t, m, stats)
 
 		if len(keyValues) == 0 {
 			// Verify slab count for empty map
@@ -1057,6 +1059,31 @@ func TestMapIterate(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, uint64(mapSize), i)
 
+		// Iterate key value storables
+		i = uint64(0)
+		err = m.IterateStorables(func(ks MapKey, vs MapValue) (resume bool, err error) {
+			valueEqual(t, typeInfoComparator, sortedKeys[i], ks.(Value))
+			valueEqual(t, typeInfoComparator, keyValues[sortedKeys[i]], vs.(Value))
+			i++
+			return true, nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, uint64(mapSize), i)
+
+		// Iterate key value pairs with index
+		i = uint64(0)
+		err = m.IterateWithIndex(func(index uint64, k Value, v Value) (resume bool, err error) {
+			require.Equal(t, i, index)
+			valueEqual(t, typeInfoComparator, sortedKeys[index], k)
+			valueEqual(t, typeInfoComparator, keyValues[k], v)
+			i++
+			return true, nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, uint64(mapSize), i)
+
 		// Iterate keys
 		i = uint64(0)
 		err = m.IterateKeys(func(k Value) (resume bool, err error) {
@@ -1080,6 +1107,30 @@ func TestMapIterate(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, uint64(mapSize), i)
 
+		// Iterate keys and values with iterators
+		keyIterator, err := m.KeyIterator()
+		require.NoError(t, err)
+
+		valueIterator, err := m.ValueIterator()
+		require.NoError(t, err)
+
+		for i = uint64(0); ; i++ {
+			k, err := keyIterator.Next()
+			require.NoError(t, err)
+
+			v, err := valueIterator.Next()
+			require.NoError(t, err)
+
+			if k == nil {
+				require.Nil(t, v)
+				break
+			}
+
+			valueEqual(t, typeInfoComparator, sortedKeys[i], k)
+			valueEqual(t, typeInfoComparator, keyValues[k], v)
+		}
+		require.Equal(t, uint64(mapSize), i)
+
 		verifyMap(t, storage, typeInfo, address, m, keyValues, sortedKeys, false)
 	})
 
@@ -1239,6 +1290,7 @@ func testMapDeterministicHashCollision(t *testing.T, r *rand.Rand, maxDigestLeve
 	stats, err := GetMapStats(m)
 	require.NoError(t, err)
 	require.Equal(t, uint64(mockDigestCount), stats.CollisionDataSlabCount)
+	verifyMapLevelStats(t, m, stats)
 
 	// Remove all elements
 	for k, v := range keyValues {
@@ -1267,6 +1319,34 @@ func testMapDeterministicHashCollision(t *testing.T, r *rand.Rand, maxDigestLeve
 	verifyEmptyMap(t, storage, typeInfo, address, m)
 }
 
+func verifyMapLevelStats(t *testing.T, m *OrderedMap, stats MapStats) {
+	require.Equal(t, stats.Levels, uint64(len(stats.LevelStats)))
+
+	var total MapLevelStats
+	for i, levelStats := range stats.LevelStats {
+		if i < len(stats.LevelStats)-1 {
+			// Only the last level contains data slabs.
+			require.Equal(t, uint64(0), levelStats.DataSlabCount)
+			require.True(t, levelStats.MetaDataSlabCount > 0)
+		} else {
+			require.Equal(t, uint64(0), levelStats.MetaDataSlabCount)
+		}
+
+		total.MetaDataSlabCount += levelStats.MetaDataSlabCount
+		total.DataSlabCount += levelStats.DataSlabCount
+		total.ElementCount += levelStats.ElementCount
+		total.ExternalCollisionGroupCount += levelStats.ExternalCollisionGroupCount
+	}
+
+	require.Equal(t, stats.MetaDataSlabCount, total.MetaDataSlabCount)
+	require.Equal(t, stats.DataSlabCount, total.DataSlabCount)
+	require.Equal(t, stats.CollisionDataSlabCount, total.ExternalCollisionGroupCount)
+	require.Equal(t, m.Count(), total.ElementCount)
+
+	// Root level byte size is root slab size.
+	require.Equal(t, uint64(m.root.ByteSize()), stats.LevelStats[0].ByteSize)
+}
+
 func testMapRandomHashCollision(t *testing.T, r *rand.Rand, maxDigestLevel int) {
 
 	const (
@@ -1335,6 +1415,53 @@ func testMapRandomHashCollision(t *testing.T, r *rand.Rand, maxDigestLevel int)
 	verifyEmptyMap(t, storage, typeInfo, address, m)
 }
 
+func TestMapKeyIterator(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	const mapSize = 16
+	for i := uint64(0); i < mapSize; i++ {
+		v := NewStringValue(strings.Repeat("a", int(MaxInlineMapKeyOrValueSize)))
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(i), v)
+		require.NoError(t, err)
+	}
+
+	// Remove external value slabs, so decoding values fails.
+	err = m.IterateStorables(func(_ MapKey, vs MapValue) (bool, error) {
+		id, ok := vs.(StorageIDStorable)
+		require.True(t, ok)
+		return true, storage.Remove(StorageID(id))
+	})
+	require.NoError(t, err)
+
+	keyIterator, err := m.KeyIterator()
+	require.NoError(t, err)
+
+	count := 0
+	for {
+		k, err := keyIterator.Next()
+		require.NoError(t, err)
+		if k == nil {
+			break
+		}
+		count++
+	}
+	require.Equal(t, mapSize, count)
+
+	valueIterator, err := m.ValueIterator()
+	require.NoError(t, err)
+
+	_, err = valueIterator.Next()
+	require.Error(t, err)
+
+	var slabNotFoundError *SlabNotFoundError
+	require.ErrorAs(t, err, &slabNotFoundError)
+}
+
 func TestMapHashCollision(t *testing.T) {
 
 	SetThreshold(512)
@@ -2781,6 +2908,129 @@ func TestMapStoredValue(t *testing.T) {
 	}
 }
 
+func TestMapDigesterType(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 2048
+
+	r := newRand(t)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	keyValues := make(map[Value]Value, mapSize)
+	i := 0
+	for len(keyValues) < mapSize {
+		k := NewStringValue(randStr(r, 16))
+		keyValues[k] = Uint64Value(i)
+		i++
+	}
+
+	m, err := NewMap(storage, address, NewBlake3DigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+	require.Equal(t, DigesterTypeBlake3Keyed, m.root.ExtraData().DigesterType)
+
+	for k, v := range keyValues {
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	verifyMap(t, storage, typeInfo, address, m, keyValues, nil, false)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	t.Run("auto-select", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		m2, err := NewMapWithRootID(storage2, m.StorageID(), nil)
+		require.NoError(t, err)
+		require.Equal(t, DigesterTypeBlake3Keyed, m2.root.ExtraData().DigesterType)
+
+		verifyMap(t, storage2, typeInfo, address, m2, keyValues, nil, false)
+	})
+
+	t.Run("stored value", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		slab, found, err := storage2.Retrieve(m.StorageID())
+		require.NoError(t, err)
+		require.True(t, found)
+
+		value, err := slab.StoredValue(storage2)
+		require.NoError(t, err)
+
+		m2, ok := value.(*OrderedMap)
+		require.True(t, ok)
+
+		verifyMap(t, storage2, typeInfo, address, m2, keyValues, nil, false)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		m2, err := NewMapWithRootID(storage2, m.StorageID(), NewDefaultDigesterBuilder())
+		require.Nil(t, m2)
+
+		var digesterTypeError *DigesterTypeError
+		require.ErrorAs(t, err, &digesterTypeError)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		builder, err := NewDigesterBuilder(DigesterType(42))
+		require.Nil(t, builder)
+
+		var digesterTypeError *DigesterTypeError
+		require.ErrorAs(t, err, &digesterTypeError)
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		extraData := &MapExtraData{
+			TypeInfo:     typeInfo,
+			Count:        1,
+			Seed:         2,
+			DigesterType: DigesterTypeBlake3Keyed,
+		}
+
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf, storage.cborEncMode)
+
+		err := extraData.Encode(enc, 0, 0x88)
+		require.NoError(t, err)
+
+		expected := []byte{
+			// version
+			0x00,
+			// flag: root + map data
+			0x88,
+			// extra data (CBOR encoded array of 4 elements)
+			0x84,
+			// type info
+			0x18, 0x2a,
+			// count: 1
+			0x01,
+			// seed: 2
+			0x02,
+			// optional fields (CBOR encoded array of 2 elements)
+			0x82,
+			// key: digester type
+			0x01,
+			// value: blake3 keyed
+			0x01,
+		}
+		require.Equal(t, expected, buf.Bytes())
+
+		decoded, rest, err := newMapExtraDataFromData(buf.Bytes(), storage.cborDecMode, decodeTypeInfo)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(rest))
+		require.Equal(t, extraData, decoded)
+	})
+}
+
 func TestMapPopIterate(t *testing.T) {
 
 	t.Run("empty", func(t *testing.T) {
@@ -3706,6 +3956,32 @@ func TestMapString(t *testing.T) {
 		want := `[0:0 1:1 2:2 3:3 4:4 5:5 6:6 7:7 8:8 9:9 10:10 11:11 12:12 13:13 14:14 15:15 16:16 17:17 18:18 19:19 20:20 21:21 22:22 23:23 24:24 25:25 26:26 27:27 28:28 29:29]`
 		require.Equal(t, want, m.String())
 	})
+
+	t.Run("truncated", func(t *testing.T) {
+		const mapSize = 30
+
+		digesterBuilder := &mockDigesterBuilder{}
+		typeInfo := testTypeInfo{42}
+		storage := newTestPersistentStorage(t)
+		address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+		m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < mapSize; i++ {
+			k := Uint64Value(i)
+			v := Uint64Value(i)
+			digesterBuilder.On("Digest", k).Return(mockDigester{d: []Digest{Digest(i)}})
+
+			existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+			require.NoError(t, err)
+			require.Nil(t, existingStorable)
+		}
+
+		require.Equal(t, `[0:0 1:1 ...(28 more)]`, m.StringWithOptions(2, 0))
+		require.Equal(t, `[0:0 1:1 2:2 ...(27 more)]`, m.StringWithOptions(0, 11))
+		require.Equal(t, m.StringWithOptions(0, 0), m.String())
+	})
 }
 
 func TestMapSlabDump(t *testing.T) {
@@ -3863,3 +4139,107 @@ func TestMapSlabDump(t *testing.T) {
 		require.Equal(t, want, dumps)
 	})
 }
+
+func TestMapSetType(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+
+	typeInfo := testTypeInfo{42}
+	newTypeInfo := testTypeInfo{43}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := Uint64Value(i)
+		v := Uint64Value(i * 2)
+		keyValues[k] = v
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	require.False(t, m.root.IsData())
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	incompatible := func(_ TypeInfo, _ TypeInfo) bool { return false }
+	compatible := func(_ TypeInfo, _ TypeInfo) bool { return true }
+
+	err = m.SetType(newTypeInfo, incompatible)
+	var incompatibleError *IncompatibleTypeInfoError
+	require.ErrorAs(t, err, &incompatibleError)
+	require.Equal(t, typeInfo, m.Type())
+
+	// Nil checker treats type infos as compatible.
+	err = m.SetType(typeInfo, nil)
+	require.NoError(t, err)
+	require.Equal(t, typeInfo, m.Type())
+
+	err = m.SetType(newTypeInfo, compatible)
+	require.NoError(t, err)
+	require.Equal(t, newTypeInfo, m.Type())
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	m2, err := NewMapWithRootID(storage2, m.StorageID(), nil)
+	require.NoError(t, err)
+
+	verifyMap(t, storage2, newTypeInfo, address, m2, keyValues, nil, false)
+}
+
+func TestMapElementValidators(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	errNotString := errors.New("key isn't StringValue")
+	errNotUint64 := errors.New("value isn't Uint64Value")
+
+	m.SetElementValidators(
+		func(ti TypeInfo, v Value) error {
+			require.Equal(t, typeInfo, ti)
+			if _, ok := v.(StringValue); !ok {
+				return errNotString
+			}
+			return nil
+		},
+		func(ti TypeInfo, v Value) error {
+			require.Equal(t, typeInfo, ti)
+			if _, ok := v.(Uint64Value); !ok {
+				return errNotUint64
+			}
+			return nil
+		},
+	)
+
+	existingStorable, err := m.Set(compare, hashInputProvider, NewStringValue("a"), Uint64Value(1))
+	require.NoError(t, err)
+	require.Nil(t, existingStorable)
+
+	var invalidElementError *InvalidElementError
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(1))
+	require.ErrorAs(t, err, &invalidElementError)
+	require.ErrorIs(t, err, errNotString)
+
+	_, err = m.Set(compare, hashInputProvider, NewStringValue("a"), NewStringValue("b"))
+	require.ErrorAs(t, err, &invalidElementError)
+	require.ErrorIs(t, err, errNotUint64)
+
+	verifyMap(t, storage, typeInfo, address, m, map[Value]Value{NewStringValue("a"): Uint64Value(1)}, nil, false)
+}
@@ -0,0 +1,111 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// MeterStep is an expensive step of collection operations reported to Meter.
+type MeterStep uint8
+
+const (
+	// MeterStepSlabDecode is decoding of slab retrieved from base storage.
+	// Size is encoded slab size.
+	MeterStepSlabDecode MeterStep = iota
+	// MeterStepDigest is digest computation of map key.  Size is 0.
+	MeterStepDigest
+	// MeterStepSplit is split of slab.  Size is slab size before split.
+	MeterStepSplit
+	// MeterStepMerge is merge of two slabs.  Size is total size of merged slabs.
+	MeterStepMerge
+	// MeterStepDecompress is decompression of storable retrieved from
+	// base storage.  Size is decompressed storable size.
+	MeterStepDecompress
+)
+
+func (s MeterStep) String() string {
+	switch s {
+	case MeterStepSlabDecode:
+		return "SlabDecode"
+	case MeterStepDigest:
+		return "Digest"
+	case MeterStepSplit:
+		return "Split"
+	case MeterStepMerge:
+		return "Merge"
+	case MeterStepDecompress:
+		return "Decompress"
+	default:
+		return "Unknown"
+	}
+}
+
+// Meter is called before and after expensive steps of storage and
+// collection operations, allowing embedders to charge for computation
+// and to enforce limits.
+//
+// If MeterBefore returns an error, the step isn't performed and the
+// operation returns MeterError wrapping the error.  The operation may
+// have already modified collection and storage, so uncommitted changes
+// must be discarded (e.g. with DropDeltas and DropCache) after MeterError.
+type Meter interface {
+	MeterBefore(step MeterStep, size uint64) error
+	MeterAfter(step MeterStep, size uint64)
+}
+
+// WithMeter sets meter of storage and of collections using the storage.
+func WithMeter(meter Meter) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.meter = meter
+		return st
+	}
+}
+
+// meterStorage is implemented by storage with meter.
+type meterStorage interface {
+	storageMeter() Meter
+}
+
+func (s *PersistentSlabStorage) storageMeter() Meter {
+	return s.meter
+}
+
+func meterOf(storage SlabStorage) Meter {
+	s, ok := unwrapSlabStorage(storage).(meterStorage)
+	if !ok {
+		return nil
+	}
+	return s.storageMeter()
+}
+
+func meterBefore(storage SlabStorage, step MeterStep, size uint64) error {
+	meter := meterOf(storage)
+	if meter == nil {
+		return nil
+	}
+	err := meter.MeterBefore(step, size)
+	if err != nil {
+		return NewMeterError(step, err)
+	}
+	return nil
+}
+
+func meterAfter(storage SlabStorage, step MeterStep, size uint64) {
+	meter := meterOf(storage)
+	if meter != nil {
+		meter.MeterAfter(step, size)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errTestMeterLimit = errors.New("limit exceeded")
+
+type testMeter struct {
+	before map[MeterStep]int
+	after  map[MeterStep]int
+	// limit is max number of steps allowed, 0 means unlimited.
+	limit int
+	steps int
+}
+
+var _ Meter = &testMeter{}
+
+func newTestMeter(limit int) *testMeter {
+	return &testMeter{
+		before: make(map[MeterStep]int),
+		after:  make(map[MeterStep]int),
+		limit:  limit,
+	}
+}
+
+func (m *testMeter) MeterBefore(step MeterStep, _ uint64) error {
+	if m.limit > 0 && m.steps >= m.limit {
+		return errTestMeterLimit
+	}
+	m.steps++
+	m.before[step]++
+	return nil
+}
+
+func (m *testMeter) MeterAfter(step MeterStep, _ uint64) {
+	m.after[step]++
+}
+
+func TestMeter(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 512
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("steps", func(t *testing.T) {
+		meter := newTestMeter(0)
+		base := NewInMemBaseStorage()
+		storage := newTestPersistentStorageWithBaseStorage(t, base, WithMeter(meter))
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < mapSize; i++ {
+			_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		for i := uint64(0); i < mapSize; i++ {
+			_, _, err := m.Remove(compare, hashInputProvider, Uint64Value(i))
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 2*mapSize, meter.before[MeterStepDigest])
+		require.True(t, meter.before[MeterStepSplit] > 0)
+		require.True(t, meter.before[MeterStepMerge] > 0)
+		require.Equal(t, meter.before, meter.after)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		// Slabs are decoded when retrieved from base storage.
+		meter2 := newTestMeter(0)
+		storage2 := newTestPersistentStorageWithBaseStorage(t, base, WithMeter(meter2))
+
+		_, err = NewMapWithRootID(storage2, m.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+		require.Equal(t, 1, meter2.before[MeterStepSlabDecode])
+		require.Equal(t, 1, meter2.after[MeterStepSlabDecode])
+	})
+
+	t.Run("veto", func(t *testing.T) {
+		meter := newTestMeter(mapSize)
+		storage := newTestPersistentStorage(t, WithMeter(meter))
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); ; i++ {
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+			if err != nil {
+				break
+			}
+		}
+
+		var meterError *MeterError
+		require.ErrorAs(t, err, &meterError)
+		require.ErrorIs(t, err, errTestMeterLimit)
+		require.Equal(t, mapSize, meter.steps)
+	})
+}
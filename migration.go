@@ -0,0 +1,277 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"github.com/fxamacker/cbor/v2"
+)
+
+// MigrationProgress is progress of in-place migration of a collection.
+// It is persisted in collection extra data, so that migration can be
+// resumed after restart.
+type MigrationProgress struct {
+	// ID identifies migration.  It is provided by caller.
+	ID uint64
+	// Position is number of elements migrated, in array index
+	// order or map iteration order.
+	Position uint64
+}
+
+const migrationProgressLength = 2
+
+func decodeMigrationProgress(dec *cbor.StreamDecoder) (*MigrationProgress, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != migrationProgressLength {
+		return nil, NewDecodingErrorf("migration progress has invalid length %d, want %d", length, migrationProgressLength)
+	}
+
+	id, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	position, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MigrationProgress{ID: id, Position: position}, nil
+}
+
+func (p *MigrationProgress) encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(migrationProgressLength)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeUint64(p.ID)
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint64(p.Position)
+}
+
+// startMigration returns progress of migration id, starting it if no
+// migration is in progress.
+func startMigration(current *MigrationProgress, id uint64, batchSize uint64, rootID StorageID) (MigrationProgress, error) {
+	if batchSize == 0 {
+		return MigrationProgress{}, NewUserError(NewMigrationErrorf("batch size must be greater than 0"))
+	}
+	if current == nil {
+		return MigrationProgress{ID: id}, nil
+	}
+	if current.ID != id {
+		return MigrationProgress{}, NewUserError(NewMigrationErrorf(
+			"collection %s is being migrated by migration %d, not %d",
+			rootID,
+			current.ID,
+			id,
+		))
+	}
+	return *current, nil
+}
+
+// ArrayMigrationFunc returns migrated value of array element at index,
+// or nil if element doesn't need to be changed.  If element storable
+// references external slabs which aren't referenced by migrated value,
+// ArrayMigrationFunc should remove them.
+type ArrayMigrationFunc func(index uint64, element Storable) (Value, error)
+
+// MapMigrationFunc returns migrated value of map element with key,
+// or nil if value doesn't need to be changed.  If value storable
+// references external slabs which aren't referenced by migrated value,
+// MapMigrationFunc should remove them.
+type MapMigrationFunc func(key Value, value Storable) (Value, error)
+
+// MigrationProgress returns progress of in-place migration,
+// or nil if array isn't being migrated.
+func (a *Array) MigrationProgress() *MigrationProgress {
+	extraData := a.root.ExtraData()
+	if extraData == nil || extraData.Migration == nil {
+		return nil
+	}
+	progress := *extraData.Migration
+	return &progress
+}
+
+// Migrate migrates up to batchSize array elements in place with fn,
+// continuing from persisted progress of migration id.  It returns true
+// when all elements are migrated.
+//
+// Progress is stored in array extra data with migrated elements, so
+// committing storage after each batch allows long migrations to be
+// resumed after restart by calling Migrate with the same id.  Migrate
+// returns MigrationError if another migration is in progress.
+//
+// Elements must not be inserted or removed until migration is done.
+func (a *Array) Migrate(id uint64, batchSize uint64, fn ArrayMigrationFunc) (done bool, err error) {
+	extraData := a.root.ExtraData()
+	if extraData == nil {
+		return false, NewUserError(NewNotValueError(a.StorageID()))
+	}
+
+	progress, err := startMigration(extraData.Migration, id, batchSize, a.StorageID())
+	if err != nil {
+		return false, err
+	}
+
+	end := progress.Position + batchSize
+	if end > a.Count() {
+		end = a.Count()
+	}
+
+	for i := progress.Position; i < end; i++ {
+		storable, err := a.Get(i)
+		if err != nil {
+			return false, err
+		}
+
+		value, err := fn(i, storable)
+		if err != nil {
+			return false, err
+		}
+		if value == nil {
+			continue
+		}
+
+		_, err = a.Set(i, value)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	progress.Position = end
+	done = end == a.Count()
+
+	// Root can be changed by Set, but extra data is kept by new root.
+	extraData = a.root.ExtraData()
+	if done {
+		extraData.Migration = nil
+	} else {
+		extraData.Migration = &progress
+	}
+
+	err = a.Storage.Store(a.root.ID(), a.root)
+	if err != nil {
+		return false, err
+	}
+
+	return done, nil
+}
+
+// MigrationProgress returns progress of in-place migration,
+// or nil if map isn't being migrated.
+func (m *OrderedMap) MigrationProgress() *MigrationProgress {
+	extraData := m.root.ExtraData()
+	if extraData == nil || extraData.Migration == nil {
+		return nil
+	}
+	progress := *extraData.Migration
+	return &progress
+}
+
+// Migrate migrates values of up to batchSize map elements in place with fn,
+// continuing from persisted progress of migration id.  It returns true
+// when all elements are migrated.  Elements are migrated in map iteration
+// order, and resuming skips migrated elements by iterating them.
+//
+// Progress is stored in map extra data with migrated elements, so
+// committing storage after each batch allows long migrations to be
+// resumed after restart by calling Migrate with the same id.  Migrate
+// returns MigrationError if another migration is in progress.
+//
+// Elements must not be inserted or removed until migration is done.
+func (m *OrderedMap) Migrate(
+	comparator ValueComparator,
+	hip HashInputProvider,
+	id uint64,
+	batchSize uint64,
+	fn MapMigrationFunc,
+) (done bool, err error) {
+	extraData := m.root.ExtraData()
+	if extraData == nil {
+		return false, NewUserError(NewNotValueError(m.StorageID()))
+	}
+
+	progress, err := startMigration(extraData.Migration, id, batchSize, m.StorageID())
+	if err != nil {
+		return false, err
+	}
+
+	iterator, err := m.Iterator()
+	if err != nil {
+		return false, err
+	}
+
+	// Keys are collected before map is modified,
+	// because modifying map invalidates iterator.
+	var keys []Value
+	for i := uint64(0); i < progress.Position+batchSize; i++ {
+		key, err := iterator.NextKey()
+		if err != nil {
+			return false, err
+		}
+		if key == nil {
+			break
+		}
+		if i >= progress.Position {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		storable, err := m.Get(comparator, hip, key)
+		if err != nil {
+			return false, err
+		}
+
+		value, err := fn(key, storable)
+		if err != nil {
+			return false, err
+		}
+		if value == nil {
+			continue
+		}
+
+		_, err = m.Set(comparator, hip, key, value)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	progress.Position += uint64(len(keys))
+	done = progress.Position >= m.Count()
+
+	// Root can be changed by Set, but extra data is kept by new root.
+	extraData = m.root.ExtraData()
+	if done {
+		extraData.Migration = nil
+	} else {
+		extraData.Migration = &progress
+	}
+
+	err = m.Storage.Store(m.root.ID(), m.root)
+	if err != nil {
+		return false, err
+	}
+
+	return done, nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayMigrate(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+	const batchSize = 100
+	const migrationID = 7
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+		values[i] = Uint64Value(i * 2)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	rootID := array.StorageID()
+
+	migrate := func(_ uint64, element Storable) (Value, error) {
+		v := element.(Uint64Value)
+		if v%2 == 1 && uint64(v) < arraySize/2 {
+			// Odd elements in the first half are unchanged
+			// to test migration of unchanged elements.
+			return nil, nil
+		}
+		return v * 2, nil
+	}
+	for i := uint64(1); i < arraySize/2; i += 2 {
+		values[i] = Uint64Value(i)
+	}
+
+	batches := 0
+	for {
+		// Reload array from committed data to simulate restart.
+		storage = newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		array, err = NewArrayWithRootID(storage, rootID)
+		require.NoError(t, err)
+
+		if batches > 0 {
+			progress := array.MigrationProgress()
+			require.NotNil(t, progress)
+			require.Equal(t, uint64(migrationID), progress.ID)
+			require.Equal(t, uint64(batches*batchSize), progress.Position)
+
+			// Another migration can't start until this one is done.
+			_, err = array.Migrate(migrationID+1, batchSize, migrate)
+			var migrationError *MigrationError
+			require.ErrorAs(t, err, &migrationError)
+		}
+
+		done, err := array.Migrate(migrationID, batchSize, migrate)
+		require.NoError(t, err)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		batches++
+
+		if done {
+			break
+		}
+	}
+
+	require.Equal(t, (arraySize+batchSize-1)/batchSize, batches)
+	require.Nil(t, array.MigrationProgress())
+
+	verifyArray(t, storage, typeInfo, address, array, values, false)
+}
+
+func TestMapMigrate(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 1024
+	const batchSize = 300
+	const migrationID = 7
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := Uint64Value(i)
+		existingStorable, err := m.Set(compare, hashInputProvider, k, Uint64Value(i))
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+		keyValues[k] = NewStringValue(k.String())
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	rootID := m.StorageID()
+
+	migrate := func(key Value, value Storable) (Value, error) {
+		require.Equal(t, key, value)
+		return NewStringValue(value.(Uint64Value).String()), nil
+	}
+
+	batches := 0
+	for {
+		// Reload map from committed data to simulate restart.
+		storage = newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		m, err = NewMapWithRootID(storage, rootID, NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+
+		if batches > 0 {
+			progress := m.MigrationProgress()
+			require.NotNil(t, progress)
+			require.Equal(t, uint64(batches*batchSize), progress.Position)
+		}
+
+		done, err := m.Migrate(compare, hashInputProvider, migrationID, batchSize, migrate)
+		require.NoError(t, err)
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		batches++
+
+		if done {
+			break
+		}
+	}
+
+	require.Equal(t, (mapSize+batchSize-1)/batchSize, batches)
+	require.Nil(t, m.MigrationProgress())
+
+	verifyMap(t, storage, typeInfo, address, m, keyValues, nil, false)
+
+	_, err = m.Migrate(compare, hashInputProvider, migrationID, 0, migrate)
+	var migrationError *MigrationError
+	require.ErrorAs(t, err, &migrationError)
+}
@@ -0,0 +1,226 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// DetachedCollection is a nested Array or OrderedMap removed from its
+// parent without removing its slabs.  It can be attached once to a new
+// parent at the same address, which stores a reference to the same root
+// slab, so no slabs are copied.
+//
+// Detaching removes the old reference before the collection can be
+// attached again, so a collection is never referenced by two parents.
+type DetachedCollection struct {
+	value    Value
+	id       StorageID
+	attached bool
+}
+
+// Value returns detached Array or OrderedMap.
+func (d *DetachedCollection) Value() Value {
+	return d.value
+}
+
+// StorageID returns storage ID of root slab of detached collection.
+func (d *DetachedCollection) StorageID() StorageID {
+	return d.id
+}
+
+// Attached returns true if collection is attached to a new parent.
+func (d *DetachedCollection) Attached() bool {
+	return d.attached
+}
+
+// detachedCollection returns collection referenced by storable, or
+// InvalidMoveError if storable doesn't reference a collection.
+func detachedCollection(storage SlabStorage, parentID StorageID, storable Storable) (*DetachedCollection, error) {
+	id, ok := storable.(StorageIDStorable)
+	if !ok {
+		return nil, NewInvalidMoveError(parentID, "element isn't a nested collection")
+	}
+
+	value, err := id.StoredValue(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	switch value.(type) {
+	case *Array, *OrderedMap:
+		return &DetachedCollection{value: value, id: StorageID(id)}, nil
+	}
+
+	return nil, NewInvalidMoveError(StorageID(id), "element isn't a nested collection")
+}
+
+// checkAttach returns InvalidMoveError if d can't be attached to parent.
+// Collections nested in d are traversed, since attaching d to one of
+// them would make d and its descendants unreachable from any root.
+func (d *DetachedCollection) checkAttach(storage SlabStorage, parentID StorageID) error {
+	if d.attached {
+		return NewInvalidMoveError(d.id, "collection is already attached")
+	}
+	if d.id.Address != parentID.Address {
+		return NewInvalidMoveError(d.id, "collection and parent have different addresses")
+	}
+	if d.id == parentID {
+		return NewInvalidMoveError(d.id, "collection can't be attached to itself")
+	}
+
+	contains, err := containsCollection(storage, d.id, parentID)
+	if err != nil {
+		return err
+	}
+	if contains {
+		return NewInvalidMoveError(d.id, "collection can't be attached to collection nested in it")
+	}
+	return nil
+}
+
+// containsCollection returns true if collection with rootID is nested,
+// at any depth, in collection with ancestorID.
+func containsCollection(storage SlabStorage, ancestorID StorageID, rootID StorageID) (bool, error) {
+	visited := map[StorageID]struct{}{ancestorID: {}}
+	pending := []StorageID{ancestorID}
+
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		slab, _, err := rootNesting(storage, id)
+		if err != nil {
+			return false, err
+		}
+		if slab == nil {
+			continue
+		}
+
+		found := false
+		err = iterateRootStorables(storage, slab, func(storable Storable) (bool, error) {
+			childID := nestedStorableRootID(storable)
+			if childID == StorageIDUndefined {
+				return true, nil
+			}
+			if childID == rootID {
+				found = true
+				return false, nil
+			}
+			if _, ok := visited[childID]; !ok {
+				visited[childID] = struct{}{}
+				pending = append(pending, childID)
+			}
+			return true, nil
+		})
+		if err != nil || found {
+			return found, err
+		}
+	}
+
+	return false, nil
+}
+
+// Detach removes nested collection at index and returns it without
+// removing its slabs.
+func (a *Array) Detach(index uint64) (*DetachedCollection, error) {
+	storable, err := a.Get(index)
+	if err != nil {
+		return nil, err
+	}
+
+	detached, err := detachedCollection(a.Storage, a.StorageID(), storable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = a.Remove(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return detached, nil
+}
+
+// InsertDetached inserts detached collection at index.
+func (a *Array) InsertDetached(index uint64, d *DetachedCollection) error {
+	err := d.checkAttach(a.Storage, a.StorageID())
+	if err != nil {
+		return err
+	}
+
+	err = a.Insert(index, d.value)
+	if err != nil {
+		return err
+	}
+
+	d.attached = true
+	return nil
+}
+
+// SetDetached replaces element at index with detached collection and
+// returns replaced element.
+func (a *Array) SetDetached(index uint64, d *DetachedCollection) (Storable, error) {
+	err := d.checkAttach(a.Storage, a.StorageID())
+	if err != nil {
+		return nil, err
+	}
+
+	existingStorable, err := a.Set(index, d.value)
+	if err != nil {
+		return nil, err
+	}
+
+	d.attached = true
+	return existingStorable, nil
+}
+
+// Detach removes nested collection with key and returns it without
+// removing its slabs.  Removed key storable is returned as well.
+func (m *OrderedMap) Detach(comparator ValueComparator, hip HashInputProvider, key Value) (Storable, *DetachedCollection, error) {
+	storable, err := m.Get(comparator, hip, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detached, err := detachedCollection(m.Storage, m.StorageID(), storable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyStorable, _, err := m.Remove(comparator, hip, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyStorable, detached, nil
+}
+
+// SetDetached sets detached collection as value of key and returns
+// replaced value, if any.
+func (m *OrderedMap) SetDetached(comparator ValueComparator, hip HashInputProvider, key Value, d *DetachedCollection) (Storable, error) {
+	err := d.checkAttach(m.Storage, m.StorageID())
+	if err != nil {
+		return nil, err
+	}
+
+	existingStorable, err := m.Set(comparator, hip, key, d.value)
+	if err != nil {
+		return nil, err
+	}
+
+	d.attached = true
+	return existingStorable, nil
+}
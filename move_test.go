@@ -0,0 +1,155 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveNestedCollection(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	child, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, child.Append(Uint64Value(42)))
+
+	require.NoError(t, array.Append(Uint64Value(0)))
+	require.NoError(t, array.Append(child))
+
+	var invalidMoveError *InvalidMoveError
+
+	// Detaching non-collection element fails without removing it.
+	_, err = array.Detach(0)
+	require.ErrorAs(t, err, &invalidMoveError)
+	require.True(t, IsUserError(err))
+	require.Equal(t, uint64(2), array.Count())
+
+	// Move child from array to map.
+	err = storage.Commit()
+	require.NoError(t, err)
+	slabCount := storage.Count()
+
+	detached, err := array.Detach(1)
+	require.NoError(t, err)
+	require.Equal(t, child.StorageID(), detached.StorageID())
+	require.Equal(t, uint64(1), array.Count())
+
+	_, err = m.SetDetached(compare, hashInputProvider, Uint64Value(1), detached)
+	require.NoError(t, err)
+	require.True(t, detached.Attached())
+
+	err = storage.Commit()
+	require.NoError(t, err)
+	require.Equal(t, slabCount, storage.Count())
+
+	v, err := m.Get(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, StorageIDStorable(child.StorageID()), v)
+
+	// Detached collection can only be attached once.
+	err = array.InsertDetached(0, detached)
+	require.ErrorAs(t, err, &invalidMoveError)
+	require.Equal(t, uint64(1), array.Count())
+
+	// Move child back from map to array.
+	_, detached, err = m.Detach(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), m.Count())
+
+	// Collection can't be attached to itself.
+	err = detached.Value().(*Array).InsertDetached(0, detached)
+	require.ErrorAs(t, err, &invalidMoveError)
+
+	_, err = array.SetDetached(0, detached)
+	require.NoError(t, err)
+
+	v, err = array.Get(0)
+	require.NoError(t, err)
+	require.Equal(t, StorageIDStorable(child.StorageID()), v)
+
+	// Collection can't be moved to parent at different address.
+	detached, err = array.Detach(0)
+	require.NoError(t, err)
+
+	other, err := NewArray(storage, Address{8, 7, 6, 5, 4, 3, 2, 1}, typeInfo)
+	require.NoError(t, err)
+
+	err = other.InsertDetached(0, detached)
+	require.ErrorAs(t, err, &invalidMoveError)
+	require.Equal(t, uint64(0), other.Count())
+}
+
+func TestMoveNestedCollectionIntoDescendant(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	root, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	// root -> child -> m -> grandchild
+	child, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, root.Append(child))
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, child.Append(Uint64Value(0)))
+	require.NoError(t, child.Append(m))
+
+	grandchild, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(0), grandchild)
+	require.NoError(t, err)
+
+	detached, err := root.Detach(0)
+	require.NoError(t, err)
+
+	var invalidMoveError *InvalidMoveError
+
+	// Attaching collection under its descendants would create a cycle.
+	err = grandchild.InsertDetached(0, detached)
+	require.ErrorAs(t, err, &invalidMoveError)
+	require.True(t, IsUserError(err))
+	require.Equal(t, uint64(0), grandchild.Count())
+
+	_, err = m.SetDetached(compare, hashInputProvider, Uint64Value(1), detached)
+	require.ErrorAs(t, err, &invalidMoveError)
+	require.Equal(t, uint64(1), m.Count())
+
+	_, err = child.SetDetached(0, detached)
+	require.ErrorAs(t, err, &invalidMoveError)
+	require.False(t, detached.Attached())
+
+	// Collection can be attached back to its former parent.
+	require.NoError(t, root.InsertDetached(0, detached))
+	require.True(t, detached.Attached())
+}
@@ -0,0 +1,91 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// EnableMutationSequence starts counting array mutations in root slab.
+// Cursors returned by IterateWithBudget record mutation sequence, so
+// they can detect mutations made between calls.
+func (a *Array) EnableMutationSequence() error {
+	extraData := a.root.ExtraData()
+	if extraData == nil {
+		return NewUserError(NewNotValueError(a.StorageID()))
+	}
+	if extraData.MutationSequence != 0 {
+		return nil
+	}
+	extraData.MutationSequence = 1
+	return a.Storage.Store(a.root.ID(), a.root)
+}
+
+// MutationSequence returns array mutation sequence, or 0 if it isn't enabled.
+func (a *Array) MutationSequence() uint64 {
+	extraData := a.root.ExtraData()
+	if extraData == nil {
+		return 0
+	}
+	return extraData.MutationSequence
+}
+
+// incrementMutationSequence increments mutation sequence in root extra
+// data, and returns true if root needs to be stored.  Root is stored by
+// caller after it is rebalanced.
+func (a *Array) incrementMutationSequence() bool {
+	extraData := a.root.ExtraData()
+	if extraData == nil || extraData.MutationSequence == 0 {
+		return false
+	}
+	extraData.MutationSequence++
+	return true
+}
+
+// EnableMutationSequence starts counting map mutations in root slab.
+// Cursors returned by IterateWithBudget record mutation sequence, so
+// they can detect mutations made between calls.
+func (m *OrderedMap) EnableMutationSequence() error {
+	extraData := m.root.ExtraData()
+	if extraData == nil {
+		return NewUserError(NewNotValueError(m.StorageID()))
+	}
+	if extraData.MutationSequence != 0 {
+		return nil
+	}
+	extraData.MutationSequence = 1
+	return m.Storage.Store(m.root.ID(), m.root)
+}
+
+// MutationSequence returns map mutation sequence, or 0 if it isn't enabled.
+func (m *OrderedMap) MutationSequence() uint64 {
+	extraData := m.root.ExtraData()
+	if extraData == nil {
+		return 0
+	}
+	return extraData.MutationSequence
+}
+
+// incrementMutationSequence increments mutation sequence in root extra
+// data, and returns true if root needs to be stored.  Root is stored by
+// caller after it is rebalanced.
+func (m *OrderedMap) incrementMutationSequence() bool {
+	extraData := m.root.ExtraData()
+	if extraData == nil || extraData.MutationSequence == 0 {
+		return false
+	}
+	extraData.MutationSequence++
+	return true
+}
@@ -0,0 +1,555 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "github.com/fxamacker/cbor/v2"
+
+// WithMaxNestingDepth limits nesting depth of collections using storage.
+// Nesting depth of a collection is 1 plus the greatest nesting depth of
+// its elements, and 0 for other values.  Insert, Set, and Append of
+// element fail with MaxNestingDepthError if the outermost collection
+// containing mutated collection would have nesting depth greater than
+// maxDepth.  Zero maxDepth disables the limit.
+//
+// Storage with the limit records Nesting in root of collections it
+// mutates, so the limit is checked by walking parents of mutated
+// collection instead of traversing inserted element.  Collections
+// stored without the limit are measured once when they are first
+// mutated or inserted with the limit.  Measuring only reads their
+// elements, so Nesting is recorded in measured collection alone, and
+// parents of collections stored without the limit are unknown until
+// they are stored in a collection again.  Collections shared by
+// multiple parents (see AddReference) are tracked through the parent
+// they were most recently stored in.
+func WithMaxNestingDepth(maxDepth int) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.maxNestingDepth = maxDepth
+		return st
+	}
+}
+
+// Nesting is nesting information recorded in collection root by
+// storage configured by WithMaxNestingDepth.
+type Nesting struct {
+	// Height is nesting depth of collection.  It isn't lowered when
+	// elements are removed, so it can be greater than actual depth
+	// until depth of collection is verified by failing limit check.
+	Height uint64
+	// Parent is root ID of collection containing the collection, or
+	// StorageIDUndefined if the collection isn't nested.
+	Parent StorageID
+}
+
+const nestingLength = 2
+
+func decodeNesting(dec *cbor.StreamDecoder) (*Nesting, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != nestingLength {
+		return nil, NewDecodingErrorf("nesting has invalid length %d, want %d", length, nestingLength)
+	}
+
+	height, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := decodeStorageIDField(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Nesting{Height: height, Parent: parent}, nil
+}
+
+func (n *Nesting) encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(nestingLength)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeUint64(n.Height)
+	if err != nil {
+		return err
+	}
+	return encodeStorageIDField(enc, n.Parent)
+}
+
+// nestingDepthStorage is implemented by storage with nesting depth limit.
+type nestingDepthStorage interface {
+	storageMaxNestingDepth() int
+}
+
+func (s *PersistentSlabStorage) storageMaxNestingDepth() int {
+	return s.maxNestingDepth
+}
+
+func maxNestingDepthOf(storage SlabStorage) int {
+	s, ok := unwrapSlabStorage(storage).(nestingDepthStorage)
+	if !ok {
+		return 0
+	}
+	return s.storageMaxNestingDepth()
+}
+
+// checkNestingDepth returns MaxNestingDepthError if storing value in
+// collection with parentID exceeds nesting depth limit of storage.
+func checkNestingDepth(storage SlabStorage, parentID StorageID, value Value) error {
+	maxDepth := maxNestingDepthOf(storage)
+	if maxDepth == 0 {
+		return nil
+	}
+
+	childID := nestedValueRootID(value)
+	if childID == StorageIDUndefined {
+		return nil
+	}
+
+	_, child, err := loadNesting(storage, childID)
+	if err != nil {
+		return err
+	}
+	if child == nil {
+		return nil
+	}
+
+	level, err := nestingLevel(storage, parentID, maxDepth)
+	if err != nil {
+		return err
+	}
+	if uint64(level)+1+child.Height <= uint64(maxDepth) {
+		return nil
+	}
+
+	// Recorded heights and parents can overestimate depth after elements
+	// are removed, so depth is verified before returning error.
+	level, err = verifiedNestingLevel(storage, parentID, maxDepth)
+	if err != nil {
+		return err
+	}
+	if level >= maxDepth {
+		return NewMaxNestingDepthError(parentID, maxDepth)
+	}
+
+	limit := maxDepth - level - 1
+	depth, err := nestingDepth(value, limit)
+	if err != nil {
+		return err
+	}
+	if depth <= limit && uint64(depth) < child.Height {
+		err = lowerNestingHeight(storage, childID, uint64(depth))
+		if err != nil {
+			return err
+		}
+	}
+	if depth > limit {
+		return NewMaxNestingDepthError(parentID, maxDepth)
+	}
+	return nil
+}
+
+// initNesting records nesting information of collection created from
+// batch data, and returns MaxNestingDepthError if collection exceeds
+// nesting depth limit of storage.
+func initNesting(storage SlabStorage, rootID StorageID) error {
+	maxDepth := maxNestingDepthOf(storage)
+	if maxDepth == 0 {
+		return nil
+	}
+
+	slab, nesting, err := loadNesting(storage, rootID)
+	if err != nil {
+		return err
+	}
+	if nesting.Height <= uint64(maxDepth) {
+		return nil
+	}
+
+	value, err := slab.StoredValue(storage)
+	if err != nil {
+		return err
+	}
+	depth, err := nestingDepth(value, maxDepth)
+	if err != nil {
+		return err
+	}
+	if depth > maxDepth {
+		return NewMaxNestingDepthError(rootID, maxDepth)
+	}
+	return lowerNestingHeight(storage, rootID, uint64(depth))
+}
+
+// lowerNestingHeight records height of collection with rootID measured
+// by traversing its elements if it is lower than recorded height.
+// Heights of its ancestors aren't lowered.
+func lowerNestingHeight(storage SlabStorage, rootID StorageID, height uint64) error {
+	slab, nesting, err := rootNesting(storage, rootID)
+	if err != nil || nesting == nil || nesting.Height <= height {
+		return err
+	}
+	nesting.Height = height
+	return storage.Store(slab.ID(), slab)
+}
+
+// linkNestedValue links collection in value stored in collection with
+// parentID to its parent, and raises recorded heights of parent and
+// its ancestors.
+func linkNestedValue(storage SlabStorage, parentID StorageID, value Value) error {
+	maxDepth := maxNestingDepthOf(storage)
+	if maxDepth == 0 {
+		return nil
+	}
+
+	childID := nestedValueRootID(value)
+	if childID == StorageIDUndefined {
+		return nil
+	}
+
+	height, err := linkNesting(storage, childID, parentID)
+	if err != nil {
+		return err
+	}
+	if height == 0 {
+		return nil
+	}
+
+	// Parent chain is bounded by maxDepth in case it is stale.
+	height++
+	for i := 0; i <= maxDepth && parentID != StorageIDUndefined; i++ {
+		slab, nesting, err := loadNesting(storage, parentID)
+		if err != nil {
+			return err
+		}
+		if nesting == nil || nesting.Height >= height {
+			return nil
+		}
+		nesting.Height = height
+		err = storage.Store(slab.ID(), slab)
+		if err != nil {
+			return err
+		}
+		parentID = nesting.Parent
+		height++
+	}
+	return nil
+}
+
+// unlinkNestedStorable unlinks collection referenced by storable removed
+// from collection with parentID from its parent.
+func unlinkNestedStorable(storage SlabStorage, parentID StorageID, storable Storable) error {
+	if maxNestingDepthOf(storage) == 0 || storable == nil {
+		return nil
+	}
+
+	childID := nestedStorableRootID(storable)
+	if childID == StorageIDUndefined {
+		return nil
+	}
+
+	slab, nesting, err := rootNesting(storage, childID)
+	if err != nil {
+		return err
+	}
+	if nesting == nil || nesting.Parent != parentID || isSharedSlab(slab) {
+		return nil
+	}
+	nesting.Parent = StorageIDUndefined
+	return storage.Store(slab.ID(), slab)
+}
+
+// nestingLevel returns number of collections containing collection with
+// rootID, up to maxDepth, following recorded parents.
+func nestingLevel(storage SlabStorage, rootID StorageID, maxDepth int) (int, error) {
+	level := 0
+	for level < maxDepth {
+		_, nesting, err := rootNesting(storage, rootID)
+		if err != nil {
+			return 0, err
+		}
+		if nesting == nil || nesting.Parent == StorageIDUndefined {
+			break
+		}
+		rootID = nesting.Parent
+		level++
+	}
+	return level, nil
+}
+
+// verifiedNestingLevel is like nestingLevel, but it checks that every
+// recorded parent contains its child and unlinks stale parents.
+func verifiedNestingLevel(storage SlabStorage, rootID StorageID, maxDepth int) (int, error) {
+	level := 0
+	for level < maxDepth {
+		slab, nesting, err := rootNesting(storage, rootID)
+		if err != nil {
+			return 0, err
+		}
+		if nesting == nil || nesting.Parent == StorageIDUndefined {
+			break
+		}
+
+		contains, err := containsNested(storage, nesting.Parent, rootID)
+		if err != nil {
+			return 0, err
+		}
+		if !contains {
+			nesting.Parent = StorageIDUndefined
+			return level, storage.Store(slab.ID(), slab)
+		}
+
+		rootID = nesting.Parent
+		level++
+	}
+	return level, nil
+}
+
+// containsNested returns true if collection with parentID has element
+// referencing collection with childID.
+func containsNested(storage SlabStorage, parentID StorageID, childID StorageID) (bool, error) {
+	slab, _, err := rootNesting(storage, parentID)
+	if err != nil || slab == nil {
+		return false, err
+	}
+
+	found := false
+	err = iterateRootStorables(storage, slab, func(storable Storable) (bool, error) {
+		found = nestedStorableRootID(storable) == childID
+		return !found, nil
+	})
+	return found, err
+}
+
+// linkNesting links collection with rootID to parent and returns its
+// height, or 0 if rootID isn't root of array or map.
+func linkNesting(storage SlabStorage, rootID StorageID, parent StorageID) (uint64, error) {
+	slab, nesting, err := loadNesting(storage, rootID)
+	if err != nil || nesting == nil {
+		return 0, err
+	}
+	if nesting.Parent != parent {
+		nesting.Parent = parent
+		err = storage.Store(slab.ID(), slab)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return nesting.Height, nil
+}
+
+// loadNesting is like rootNesting, but it measures and records nesting
+// information of collection stored without it.  Only the root of
+// measured collection is stored; nested collections are only read.
+func loadNesting(storage SlabStorage, rootID StorageID) (Slab, *Nesting, error) {
+	slab, nesting, err := rootNesting(storage, rootID)
+	if err != nil || slab == nil || nesting != nil {
+		return slab, nesting, err
+	}
+
+	height, err := measureNestingHeight(storage, slab)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nesting = &Nesting{Height: height}
+	switch slab := slab.(type) {
+	case ArraySlab:
+		slab.ExtraData().Nesting = nesting
+	case MapSlab:
+		slab.ExtraData().Nesting = nesting
+	}
+	return slab, nesting, storage.Store(slab.ID(), slab)
+}
+
+// measureNestingHeight returns height of collection with root slab,
+// using recorded heights of nested collections where they exist and
+// measuring the rest without storing anything.
+func measureNestingHeight(storage SlabStorage, slab Slab) (uint64, error) {
+	height := uint64(1)
+	err := iterateRootStorables(storage, slab, func(storable Storable) (bool, error) {
+		childID := nestedStorableRootID(storable)
+		if childID == StorageIDUndefined {
+			return true, nil
+		}
+		child, nesting, err := rootNesting(storage, childID)
+		if err != nil || child == nil {
+			return err == nil, err
+		}
+		childHeight := uint64(0)
+		if nesting != nil {
+			childHeight = nesting.Height
+		} else {
+			childHeight, err = measureNestingHeight(storage, child)
+			if err != nil {
+				return false, err
+			}
+		}
+		if childHeight+1 > height {
+			height = childHeight + 1
+		}
+		return true, nil
+	})
+	return height, err
+}
+
+// rootNesting returns root slab with rootID and its nesting information.
+// It returns nil slab if rootID isn't root of array or map.
+func rootNesting(storage SlabStorage, rootID StorageID) (Slab, *Nesting, error) {
+	slab, found, err := storage.Retrieve(rootID)
+	if err != nil || !found {
+		return nil, nil, err
+	}
+
+	switch slab := slab.(type) {
+	case ArraySlab:
+		if extraData := slab.ExtraData(); extraData != nil {
+			return slab, extraData.Nesting, nil
+		}
+	case MapSlab:
+		if extraData := slab.ExtraData(); extraData != nil {
+			return slab, extraData.Nesting, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// isSharedSlab returns true if collection with root slab has references
+// registered with AddReference.
+func isSharedSlab(slab Slab) bool {
+	switch slab := slab.(type) {
+	case ArraySlab:
+		return slab.ExtraData().ExtraRefs > 0
+	case MapSlab:
+		return slab.ExtraData().ExtraRefs > 0
+	}
+	return false
+}
+
+// iterateRootStorables passes element storables of collection with root
+// slab to fn.  Both keys and values of map elements are passed.
+func iterateRootStorables(storage SlabStorage, slab Slab, fn func(Storable) (bool, error)) error {
+	switch slab := slab.(type) {
+	case ArraySlab:
+		array := &Array{Storage: storage, root: slab}
+		return array.IterateStorables(func(element Storable) (bool, error) {
+			return fn(element)
+		})
+
+	case MapSlab:
+		m := &OrderedMap{Storage: storage, root: slab}
+		return m.IterateStorables(func(key MapKey, value MapValue) (bool, error) {
+			resume, err := fn(key)
+			if !resume || err != nil {
+				return false, err
+			}
+			return fn(value)
+		})
+	}
+	return nil
+}
+
+// nestedValueRootID returns root ID of collection in value, or
+// StorageIDUndefined if value isn't a collection.
+func nestedValueRootID(value Value) StorageID {
+	for {
+		switch v := value.(type) {
+		case SomeValue:
+			value = v.Value
+		case TimestampedValue:
+			value = v.Value
+		case storableValue:
+			return nestedStorableRootID(v.storable)
+		case *Array:
+			return v.StorageID()
+		case *OrderedMap:
+			return v.StorageID()
+		default:
+			return StorageIDUndefined
+		}
+	}
+}
+
+// nestedStorableRootID returns ID of slab referenced by storable, or
+// StorageIDUndefined if storable doesn't reference a slab.
+func nestedStorableRootID(storable Storable) StorageID {
+	for {
+		switch s := storable.(type) {
+		case SomeStorable:
+			storable = s.Storable
+		case TimestampedStorable:
+			storable = s.Storable
+		case StorageIDStorable:
+			return StorageID(s)
+		default:
+			return StorageIDUndefined
+		}
+	}
+}
+
+// nestingDepth returns nesting depth of value, or maxDepth+1 if it is
+// greater than maxDepth.  Only nested collections are traversed, and
+// traversal stops as soon as maxDepth is exceeded.
+func nestingDepth(value Value, maxDepth int) (int, error) {
+	switch v := value.(type) {
+	case SomeValue:
+		return nestingDepth(v.Value, maxDepth)
+
+	case TimestampedValue:
+		return nestingDepth(v.Value, maxDepth)
+
+	case *Array:
+		if maxDepth == 0 {
+			return 1, nil
+		}
+
+		depth := 1
+		err := v.Iterate(func(element Value) (bool, error) {
+			elementDepth, err := nestingDepth(element, maxDepth-1)
+			if elementDepth+1 > depth {
+				depth = elementDepth + 1
+			}
+			return depth <= maxDepth && err == nil, err
+		})
+		return depth, err
+
+	case *OrderedMap:
+		if maxDepth == 0 {
+			return 1, nil
+		}
+
+		depth := 1
+		err := v.Iterate(func(key Value, value Value) (bool, error) {
+			keyDepth, err := nestingDepth(key, maxDepth-1)
+			if err != nil {
+				return false, err
+			}
+			valueDepth, err := nestingDepth(value, maxDepth-1)
+			if keyDepth+1 > depth {
+				depth = keyDepth + 1
+			}
+			if valueDepth+1 > depth {
+				depth = valueDepth + 1
+			}
+			return depth <= maxDepth && err == nil, err
+		})
+		return depth, err
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,294 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxNestingDepth(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	const maxDepth = 3
+
+	storage := newTestPersistentStorage(t, WithMaxNestingDepth(maxDepth))
+
+	// newNested returns array with nesting depth.
+	newNested := func(depth int) *Array {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, array.Append(Uint64Value(0)))
+
+		for i := 1; i < depth; i++ {
+			parent, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, parent.Append(Uint64Value(0)))
+			require.NoError(t, parent.Append(array))
+			array = parent
+		}
+		return array
+	}
+
+	var maxNestingDepthError *MaxNestingDepthError
+
+	t.Run("array", func(t *testing.T) {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		require.NoError(t, array.Append(newNested(maxDepth-1)))
+		require.NoError(t, array.Insert(0, SomeValue{Value: newNested(maxDepth - 1)}))
+
+		err = array.Append(newNested(maxDepth))
+		require.ErrorAs(t, err, &maxNestingDepthError)
+		require.True(t, IsUserError(err))
+
+		_, err = array.Set(0, SomeValue{Value: newNested(maxDepth)})
+		require.ErrorAs(t, err, &maxNestingDepthError)
+
+		require.Equal(t, uint64(2), array.Count())
+	})
+
+	t.Run("map", func(t *testing.T) {
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), newNested(maxDepth-1))
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(1), newNested(maxDepth))
+		require.ErrorAs(t, err, &maxNestingDepthError)
+
+		require.Equal(t, uint64(1), m.Count())
+
+		// Map containing deeply nested array exceeds limit in parent.
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = array.Append(m)
+		require.ErrorAs(t, err, &maxNestingDepthError)
+	})
+
+	// newChain returns arrays nested top-down, each array appended
+	// to previous one after previous one is stored in its parent.
+	newChain := func(storage *PersistentSlabStorage, depth int) []*Array {
+		root, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		chain := []*Array{root}
+		for i := 1; i < depth; i++ {
+			child, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, chain[i-1].Append(child))
+			chain = append(chain, child)
+		}
+		return chain
+	}
+
+	t.Run("top-down", func(t *testing.T) {
+		chain := newChain(storage, maxDepth)
+		leaf := chain[maxDepth-1]
+
+		require.NoError(t, leaf.Append(Uint64Value(0)))
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = leaf.Append(child)
+		require.ErrorAs(t, err, &maxNestingDepthError)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, chain[maxDepth-2].Append(m))
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(0), child)
+		require.ErrorAs(t, err, &maxNestingDepthError)
+
+		require.Equal(t, uint64(1), leaf.Count())
+		require.Equal(t, uint64(0), m.Count())
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		storage := newTestPersistentStorage(t, WithMaxNestingDepth(maxDepth))
+
+		chain := newChain(storage, maxDepth)
+		require.NoError(t, storage.Commit())
+
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage, WithMaxNestingDepth(maxDepth))
+
+		leaf, err := NewArrayWithRootID(storage2, chain[maxDepth-1].StorageID())
+		require.NoError(t, err)
+
+		child, err := NewArray(storage2, address, typeInfo)
+		require.NoError(t, err)
+
+		err = leaf.Append(child)
+		require.ErrorAs(t, err, &maxNestingDepthError)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		chain := newChain(storage, maxDepth)
+		leaf := chain[maxDepth-1]
+
+		// Removed array is no longer nested in root.
+		_, err := chain[0].Remove(0)
+		require.NoError(t, err)
+
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, leaf.Append(child))
+
+		// Height of array recorded before removal of its nested
+		// array doesn't prevent storing it.
+		_, err = leaf.Remove(0)
+		require.NoError(t, err)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, array.Append(chain[1]))
+
+		// Verified height of array is recorded.
+		_, nesting, err := rootNesting(storage, chain[1].StorageID())
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), nesting.Height)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		legacyStorage := newTestPersistentStorage(t)
+
+		parent, err := NewArray(legacyStorage, address, typeInfo)
+		require.NoError(t, err)
+
+		var children []StorageID
+		for i := 0; i < 3; i++ {
+			child, err := NewArray(legacyStorage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, child.Append(Uint64Value(i)))
+			require.NoError(t, parent.Append(child))
+			children = append(children, child.StorageID())
+		}
+		require.NoError(t, legacyStorage.Commit())
+
+		storage := newTestPersistentStorageWithBaseStorage(t, legacyStorage.baseStorage, WithMaxNestingDepth(maxDepth))
+
+		parent, err = NewArrayWithRootID(storage, parent.StorageID())
+		require.NoError(t, err)
+		nested, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, parent.Append(nested))
+
+		// Parent is measured without rewriting its nested arrays.
+		_, nesting, err := rootNesting(storage, parent.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, &Nesting{Height: 2}, nesting)
+
+		for _, id := range children {
+			_, nesting, err := rootNesting(storage, id)
+			require.NoError(t, err)
+			require.Nil(t, nesting)
+		}
+
+		// Array nested in parent is linked to it.
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, nested.Append(child))
+
+		grandchild, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		err = child.Append(grandchild)
+		require.ErrorAs(t, err, &maxNestingDepthError)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		values := []Value{Uint64Value(0), newNested(maxDepth)}
+		_, err := NewArrayFromBatchData(storage, address, typeInfo, func() (Value, error) {
+			if len(values) == 0 {
+				return nil, nil
+			}
+			value := values[0]
+			values = values[1:]
+			return value, nil
+		})
+		require.ErrorAs(t, err, &maxNestingDepthError)
+
+		nested := newNested(maxDepth - 1)
+		values = []Value{nested}
+		array, err := NewArrayFromBatchData(storage, address, typeInfo, func() (Value, error) {
+			if len(values) == 0 {
+				return nil, nil
+			}
+			value := values[0]
+			values = values[1:]
+			return value, nil
+		})
+		require.NoError(t, err)
+
+		// Array nested in batch array is linked to it.
+		parent, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.NoError(t, parent.Append(Uint64Value(0)))
+
+		err = parent.Append(array)
+		require.ErrorAs(t, err, &maxNestingDepthError)
+	})
+
+	t.Run("split", func(t *testing.T) {
+		SetThreshold(256)
+		defer SetThreshold(1024)
+
+		storage := newTestPersistentStorage(t, WithMaxNestingDepth(maxDepth))
+
+		parent, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		var child *Array
+		for parent.root.IsData() {
+			child, err = NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, parent.Append(child))
+		}
+
+		// Nesting is recorded in root after root is split.
+		_, nesting, err := rootNesting(storage, parent.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), nesting.Height)
+
+		_, nesting, err = rootNesting(storage, child.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, parent.StorageID(), nesting.Parent)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			parent, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			require.NoError(t, parent.Append(array))
+			array = parent
+		}
+	})
+}
@@ -0,0 +1,180 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// OperationKind is kind of accounted collection operation.
+type OperationKind uint8
+
+const (
+	OperationGet OperationKind = iota
+	OperationSet
+	OperationInsert
+	OperationRemove
+	OperationIterate
+)
+
+func (k OperationKind) String() string {
+	switch k {
+	case OperationGet:
+		return "Get"
+	case OperationSet:
+		return "Set"
+	case OperationInsert:
+		return "Insert"
+	case OperationRemove:
+		return "Remove"
+	case OperationIterate:
+		return "Iterate"
+	default:
+		return "Unknown"
+	}
+}
+
+// OperationCost is slab accounting of a single public collection operation.
+type OperationCost struct {
+	Kind OperationKind
+	// RootID is root storage ID of collection.
+	RootID StorageID
+	// SlabsRead is the number of distinct slabs retrieved.
+	SlabsRead uint64
+	// SlabsWritten is the number of distinct slabs modified
+	// (including created slabs) and not deleted by the operation.
+	SlabsWritten uint64
+	// SlabsCreated is the number of storage IDs generated for new slabs.
+	SlabsCreated uint64
+	// SlabsDeleted is the number of slabs removed.
+	SlabsDeleted uint64
+	// BytesEncoded is the total encoded size of written slabs.
+	BytesEncoded uint64
+}
+
+// OperationCostReporter is called with cost of each accounted operation
+// after the operation returns.  Operations called while an accounted
+// operation of the same collection instance is in progress (e.g. from
+// iteration callback) are included in the outer operation.
+type OperationCostReporter func(OperationCost)
+
+// WithOperationAccounting enables per-operation accounting of
+// collections using the storage.  Get, Set, Insert, Remove, and
+// Iterate operations report their cost to reporter.
+func WithOperationAccounting(reporter OperationCostReporter) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.operationCostReporter = reporter
+		return st
+	}
+}
+
+// operationAccountingStorage is implemented by storage with operation accounting.
+type operationAccountingStorage interface {
+	storageOperationCostReporter() OperationCostReporter
+}
+
+func (s *PersistentSlabStorage) storageOperationCostReporter() OperationCostReporter {
+	return s.operationCostReporter
+}
+
+func operationCostReporterOf(storage SlabStorage) OperationCostReporter {
+	s, ok := unwrapSlabStorage(storage).(operationAccountingStorage)
+	if !ok {
+		return nil
+	}
+	return s.storageOperationCostReporter()
+}
+
+type operationCostTracker struct {
+	reporter OperationCostReporter
+	read     map[StorageID]struct{}
+	// written contains slabs stored by the operation, nil for removed slabs.
+	written map[StorageID]Slab
+	created uint64
+	deleted uint64
+}
+
+func (t *operationCostTracker) cost(kind OperationKind, rootID StorageID) OperationCost {
+	cost := OperationCost{
+		Kind:         kind,
+		RootID:       rootID,
+		SlabsRead:    uint64(len(t.read)),
+		SlabsCreated: t.created,
+		SlabsDeleted: t.deleted,
+	}
+	for _, slab := range t.written {
+		if slab == nil {
+			continue
+		}
+		cost.SlabsWritten++
+		cost.BytesEncoded += uint64(slab.ByteSize())
+	}
+	return cost
+}
+
+// beginOperation starts accounting of operation if it isn't nested
+// in another operation and storage has operation accounting enabled.
+//
+// Accounting state is only modified if storage has operation accounting
+// enabled, so operations on storage without it (e.g. StorageSnapshot
+// read by concurrent readers) don't modify shared state.  Storage with
+// operation accounting must not be used concurrently.
+func (s *statsSlabStorage) beginOperation() {
+	if s.reporter == nil {
+		return
+	}
+	if s.depth == 0 {
+		s.cost = &operationCostTracker{
+			reporter: s.reporter,
+			read:     make(map[StorageID]struct{}),
+			written:  make(map[StorageID]Slab),
+		}
+	}
+	s.depth++
+}
+
+// endOperation reports cost of accounted operation started by beginOperation.
+func (s *statsSlabStorage) endOperation(kind OperationKind, rootID StorageID) {
+	if s.reporter == nil {
+		return
+	}
+	s.depth--
+	if s.depth > 0 {
+		return
+	}
+	tracker := s.cost
+	s.cost = nil
+	tracker.reporter(tracker.cost(kind, rootID))
+}
+
+func (a *Array) beginOperation() *statsSlabStorage {
+	storage := a.trackedStorage()
+	storage.beginOperation()
+	return storage
+}
+
+func (a *Array) endOperation(storage *statsSlabStorage, kind OperationKind) {
+	storage.endOperation(kind, a.StorageID())
+}
+
+func (m *OrderedMap) beginOperation() *statsSlabStorage {
+	storage := m.trackedStorage()
+	storage.beginOperation()
+	return storage
+}
+
+func (m *OrderedMap) endOperation(storage *statsSlabStorage, kind OperationKind) {
+	storage.endOperation(kind, m.StorageID())
+}
@@ -0,0 +1,216 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCostRecorder struct {
+	costs []OperationCost
+}
+
+func (r *testCostRecorder) report(cost OperationCost) {
+	r.costs = append(r.costs, cost)
+}
+
+func (r *testCostRecorder) last() OperationCost {
+	return r.costs[len(r.costs)-1]
+}
+
+func (r *testCostRecorder) netCreated() int {
+	n := 0
+	for _, cost := range r.costs {
+		n += int(cost.SlabsCreated) - int(cost.SlabsDeleted)
+	}
+	return n
+}
+
+func TestArrayOperationCost(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 128
+
+	recorder := &testCostRecorder{}
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t, WithOperationAccounting(recorder.report))
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(recorder.costs))
+	require.Equal(t, OperationCost{
+		Kind:         OperationInsert,
+		RootID:       array.StorageID(),
+		SlabsWritten: 1,
+		BytesEncoded: uint64(array.root.ByteSize()),
+	}, recorder.last())
+
+	for i := uint64(1); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, arraySize, len(recorder.costs))
+
+	stats, err := GetArrayStats(array)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.MetaDataSlabCount)
+
+	// Root slab was created by NewArray before accounting.
+	require.Equal(t, int(stats.SlabCount())-1, recorder.netCreated())
+
+	_, err = array.Get(arraySize - 1)
+	require.NoError(t, err)
+
+	cost := recorder.last()
+	require.Equal(t, OperationGet, cost.Kind)
+	require.Equal(t, uint64(1), cost.SlabsRead)
+	require.Equal(t, uint64(0), cost.SlabsWritten)
+	require.Equal(t, uint64(0), cost.BytesEncoded)
+
+	// Nested operations are included in iteration.
+	count := len(recorder.costs)
+	err = array.Iterate(func(Value) (bool, error) {
+		_, err := array.Get(0)
+		return true, err
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, count+1, len(recorder.costs))
+	cost = recorder.last()
+	require.Equal(t, OperationIterate, cost.Kind)
+	require.Equal(t, stats.DataSlabCount, cost.SlabsRead)
+
+	for array.Count() > 0 {
+		_, err := array.Remove(0)
+		require.NoError(t, err)
+		require.Equal(t, OperationRemove, recorder.last().Kind)
+	}
+
+	require.Equal(t, 0, recorder.netCreated())
+}
+
+func TestMapOperationCost(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 64
+
+	recorder := &testCostRecorder{}
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t, WithOperationAccounting(recorder.report))
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+		require.NoError(t, err)
+		require.Equal(t, OperationInsert, recorder.last().Kind)
+	}
+
+	stats, err := GetMapStats(m)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.MetaDataSlabCount)
+	require.Equal(t, int(stats.SlabCount())-1, recorder.netCreated())
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(1))
+	require.NoError(t, err)
+
+	cost := recorder.last()
+	require.Equal(t, OperationSet, cost.Kind)
+	require.Equal(t, m.StorageID(), cost.RootID)
+	// Data slab and its parent (root) are written.
+	require.Equal(t, uint64(2), cost.SlabsWritten)
+	require.True(t, cost.BytesEncoded > 0)
+
+	err = m.Iterate(func(Value, Value) (bool, error) {
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, OperationIterate, recorder.last().Kind)
+	require.Equal(t, stats.DataSlabCount, recorder.last().SlabsRead)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, _, err := m.Remove(compare, hashInputProvider, Uint64Value(i))
+		require.NoError(t, err)
+		require.Equal(t, OperationRemove, recorder.last().Kind)
+	}
+
+	require.Equal(t, 0, recorder.netCreated())
+}
+
+func TestOperationStorageOptionalInterfaces(t *testing.T) {
+
+	keys := testDigesterKeys{1: []byte("key")}
+	provenance := Provenance{CreatedAt: 1}
+
+	storage := newTestPersistentStorage(t,
+		WithOperationAccounting(func(OperationCost) {}),
+		WithDigesterKeyProvider(keys),
+		WithMaxNestingDepth(4),
+		WithProvenance(func(Address) (Provenance, error) {
+			return provenance, nil
+		}),
+	)
+
+	array, err := NewArray(storage, Address{1, 2, 3, 4, 5, 6, 7, 8}, testTypeInfo{42})
+	require.NoError(t, err)
+
+	tracked := array.trackedStorage()
+	require.Equal(t, SlabStorage(storage), unwrapSlabStorage(tracked))
+
+	_, ok := unwrapSlabStorage(tracked).(DigesterKeyProvider)
+	require.True(t, ok)
+	require.NotNil(t, storageEncModeOf(tracked))
+	require.NotNil(t, provenanceProviderOf(tracked))
+	require.Equal(t, 4, maxNestingDepthOf(tracked))
+}
+
+func TestOperationAccountingDisabled(t *testing.T) {
+
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, Address{1, 2, 3, 4, 5, 6, 7, 8}, testTypeInfo{42})
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	_, err = array.Get(0)
+	require.NoError(t, err)
+
+	// Without a reporter, operations leave accounting state untouched.
+	tracked := array.trackedStorage()
+	require.Equal(t, 0, tracked.depth)
+	require.Nil(t, tracked.cost)
+}
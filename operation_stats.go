@@ -0,0 +1,185 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "sync/atomic"
+
+// OperationStats contains counts of operations performed on
+// an Array or OrderedMap instance.  Counts are kept in memory
+// for the collection instance and aren't persisted.  Counts are
+// updated atomically, so read operations can be counted while
+// the collection is read concurrently (e.g. from StorageSnapshot).
+type OperationStats struct {
+	Gets       uint64
+	Sets       uint64
+	Inserts    uint64
+	Removes    uint64
+	Iterations uint64
+	// SlabsTouched is the number of slabs retrieved, stored,
+	// or removed by counted operations.
+	SlabsTouched uint64
+}
+
+// statsSlabStorage is SlabStorage counting slab accesses in stats,
+// and accounting operation cost during accounted operations.
+// Optional storage features used by collection operations are
+// looked up on wrapped storage with unwrapSlabStorage.
+type statsSlabStorage struct {
+	SlabStorage
+	stats *OperationStats
+	// reporter is operation cost reporter of wrapped storage.
+	// Operations aren't accounted if it is nil.
+	reporter OperationCostReporter
+	// cost is non-nil during accounted operation.
+	cost *operationCostTracker
+	// depth is nesting depth of accounted operations.
+	depth int
+}
+
+var _ SlabStorage = &statsSlabStorage{}
+var _ slabStorageWrapper = &statsSlabStorage{}
+
+// slabStorageWrapper is implemented by SlabStorage wrappers used
+// internally by collection operations.
+type slabStorageWrapper interface {
+	unwrap() SlabStorage
+}
+
+func (s *statsSlabStorage) unwrap() SlabStorage {
+	return s.SlabStorage
+}
+
+// unwrapSlabStorage returns storage with internal wrappers removed.
+// Optional storage interfaces (hooks, digester keys, provenance, etc.)
+// must be looked up on unwrapped storage, because wrappers don't
+// implement them.
+func unwrapSlabStorage(storage SlabStorage) SlabStorage {
+	for {
+		w, ok := storage.(slabStorageWrapper)
+		if !ok {
+			return storage
+		}
+		storage = w.unwrap()
+	}
+}
+
+func (s *statsSlabStorage) Retrieve(id StorageID) (Slab, bool, error) {
+	s.recordRetrieve(id)
+	return s.SlabStorage.Retrieve(id)
+}
+
+func (s *statsSlabStorage) Store(id StorageID, slab Slab) error {
+	atomic.AddUint64(&s.stats.SlabsTouched, 1)
+	if s.cost != nil {
+		s.cost.written[id] = slab
+	}
+	return s.SlabStorage.Store(id, slab)
+}
+
+func (s *statsSlabStorage) Remove(id StorageID) error {
+	atomic.AddUint64(&s.stats.SlabsTouched, 1)
+	if s.cost != nil {
+		s.cost.written[id] = nil
+		s.cost.deleted++
+	}
+	return s.SlabStorage.Remove(id)
+}
+
+func (s *statsSlabStorage) GenerateStorageID(address Address) (StorageID, error) {
+	if s.cost != nil {
+		s.cost.created++
+	}
+	return s.SlabStorage.GenerateStorageID(address)
+}
+
+// recordRetrieve records slab retrieved by collection, including
+// slabs retrieved directly from wrapped storage by iterators.
+func (s *statsSlabStorage) recordRetrieve(id StorageID) {
+	atomic.AddUint64(&s.stats.SlabsTouched, 1)
+	if s.cost != nil {
+		s.cost.read[id] = struct{}{}
+	}
+}
+
+// load returns copy of stats loaded atomically.
+func (s *OperationStats) load() OperationStats {
+	return OperationStats{
+		Gets:         atomic.LoadUint64(&s.Gets),
+		Sets:         atomic.LoadUint64(&s.Sets),
+		Inserts:      atomic.LoadUint64(&s.Inserts),
+		Removes:      atomic.LoadUint64(&s.Removes),
+		Iterations:   atomic.LoadUint64(&s.Iterations),
+		SlabsTouched: atomic.LoadUint64(&s.SlabsTouched),
+	}
+}
+
+// reset sets stats to zero atomically.
+func (s *OperationStats) reset() {
+	atomic.StoreUint64(&s.Gets, 0)
+	atomic.StoreUint64(&s.Sets, 0)
+	atomic.StoreUint64(&s.Inserts, 0)
+	atomic.StoreUint64(&s.Removes, 0)
+	atomic.StoreUint64(&s.Iterations, 0)
+	atomic.StoreUint64(&s.SlabsTouched, 0)
+}
+
+// statsStorage returns storage counting slab accesses in stats.
+// Returned storage is cached in cached as long as storage doesn't change.
+// cached is an atomic.Value so concurrent readers of a collection can
+// share it.
+func statsStorage(cached *atomic.Value, storage SlabStorage, stats *OperationStats) *statsSlabStorage {
+	s, ok := cached.Load().(*statsSlabStorage)
+	if !ok || s.SlabStorage != storage {
+		s = &statsSlabStorage{
+			SlabStorage: storage,
+			stats:       stats,
+			reporter:    operationCostReporterOf(storage),
+		}
+		cached.Store(s)
+	}
+	return s
+}
+
+// Stats returns operation counts of this Array instance.
+func (a *Array) Stats() OperationStats {
+	return a.stats.load()
+}
+
+// ResetStats resets operation counts of this Array instance.
+func (a *Array) ResetStats() {
+	a.stats.reset()
+}
+
+func (a *Array) trackedStorage() *statsSlabStorage {
+	return statsStorage(&a.statsStorage, a.Storage, &a.stats)
+}
+
+// Stats returns operation counts of this OrderedMap instance.
+func (m *OrderedMap) Stats() OperationStats {
+	return m.stats.load()
+}
+
+// ResetStats resets operation counts of this OrderedMap instance.
+func (m *OrderedMap) ResetStats() {
+	m.stats.reset()
+}
+
+func (m *OrderedMap) trackedStorage() *statsSlabStorage {
+	return statsStorage(&m.statsStorage, m.Storage, &m.stats)
+}
@@ -0,0 +1,134 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayOperationStats(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	require.Equal(t, OperationStats{}, array.Stats())
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array.Get(i)
+		require.NoError(t, err)
+	}
+
+	_, err = array.Set(0, Uint64Value(0))
+	require.NoError(t, err)
+
+	_, err = array.Remove(0)
+	require.NoError(t, err)
+
+	err = array.Iterate(func(Value) (bool, error) {
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	stats := array.Stats()
+	require.Equal(t, uint64(arraySize), stats.Gets)
+	require.Equal(t, uint64(1), stats.Sets)
+	require.Equal(t, uint64(arraySize), stats.Inserts)
+	require.Equal(t, uint64(1), stats.Removes)
+	require.Equal(t, uint64(1), stats.Iterations)
+	require.True(t, stats.SlabsTouched > 0)
+
+	array.ResetStats()
+	require.Equal(t, OperationStats{}, array.Stats())
+
+	// Iteration touches every data slab.
+	err = array.Iterate(func(Value) (bool, error) {
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	arrayStats, err := GetArrayStats(array)
+	require.NoError(t, err)
+
+	stats = array.Stats()
+	require.Equal(t, uint64(1), stats.Iterations)
+	require.True(t, stats.SlabsTouched >= arrayStats.DataSlabCount)
+}
+
+func TestMapOperationStats(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 512
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(0), Uint64Value(1))
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Get(compare, hashInputProvider, Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(0))
+	require.NoError(t, err)
+
+	err = m.IterateKeys(func(Value) (bool, error) {
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	stats := m.Stats()
+	require.Equal(t, uint64(mapSize), stats.Gets)
+	require.Equal(t, uint64(1), stats.Sets)
+	require.Equal(t, uint64(mapSize), stats.Inserts)
+	require.Equal(t, uint64(1), stats.Removes)
+	require.Equal(t, uint64(1), stats.Iterations)
+	require.True(t, stats.SlabsTouched > 0)
+
+	m.ResetStats()
+	require.Equal(t, OperationStats{}, m.Stats())
+}
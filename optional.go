@@ -0,0 +1,164 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const CBORTagSomeValue = 252
+
+// SomeValue is an optional value containing Value.
+// Absence of value can be modeled with a nil-like value of the embedder.
+type SomeValue struct {
+	Value Value
+}
+
+var _ Value = SomeValue{}
+
+func (v SomeValue) Storable(storage SlabStorage, address Address, maxInlineSize uint64) (Storable, error) {
+
+	// tag number (2 bytes)
+	const someStorableOverhead = 2
+
+	if maxInlineSize < someStorableOverhead {
+		maxInlineSize = someStorableOverhead
+	}
+
+	valueStorable, err := v.Value.Storable(
+		storage,
+		address,
+		maxInlineSize-someStorableOverhead,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return SomeStorable{
+		Storable: valueStorable,
+	}, nil
+}
+
+func (v SomeValue) String() string {
+	return fmt.Sprintf("%s", v.Value)
+}
+
+// SomeStorable is the storable of SomeValue.
+type SomeStorable struct {
+	Storable Storable
+}
+
+var _ Storable = SomeStorable{}
+
+func (v SomeStorable) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + v.Storable.ByteSize()
+}
+
+// Encode encodes SomeStorable as
+// cbor.Tag{
+//		Number:  CBORTagSomeValue,
+//		Content: Storable(v),
+// }
+func (v SomeStorable) Encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagSomeValue,
+	})
+	if err != nil {
+		return err
+	}
+	return v.Storable.Encode(enc)
+}
+
+func (v SomeStorable) ChildStorables() []Storable {
+	return []Storable{v.Storable}
+}
+
+func (v SomeStorable) StoredValue(storage SlabStorage) (Value, error) {
+	wv, err := v.Storable.StoredValue(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return SomeValue{wv}, nil
+}
+
+func (v SomeStorable) String() string {
+	return fmt.Sprintf("%s", v.Storable)
+}
+
+// DecodeSomeStorable decodes SomeStorable after CBORTagSomeValue is decoded.
+// Wrapped storable is decoded by decodeStorable.
+func DecodeSomeStorable(dec *cbor.StreamDecoder, id StorageID, decodeStorable StorableDecoder) (Storable, error) {
+	storable, err := decodeStorable(dec, id)
+	if err != nil {
+		return nil, err
+	}
+	return SomeStorable{Storable: storable}, nil
+}
+
+// NewSomeHashInputProvider returns HashInputProvider that provides hash input
+// of SomeValue as tag number followed by hash input of wrapped value.
+// Hash input of other values is provided by hip.
+func NewSomeHashInputProvider(hip HashInputProvider) HashInputProvider {
+	var someHIP HashInputProvider
+	someHIP = func(value Value, scratch []byte) ([]byte, error) {
+		v, ok := value.(SomeValue)
+		if !ok {
+			return hip(value, scratch)
+		}
+
+		b, err := someHIP(v.Value, scratch)
+		if err != nil {
+			return nil, err
+		}
+
+		hi := make([]byte, len(b)+2)
+		hi[0] = 0xd8
+		hi[1] = CBORTagSomeValue
+		copy(hi[2:], b)
+
+		return hi, nil
+	}
+	return someHIP
+}
+
+// NewSomeValueComparator returns ValueComparator that compares SomeValue
+// with SomeStorable by comparing wrapped value and wrapped storable.
+// Other values are compared by comparator.
+func NewSomeValueComparator(comparator ValueComparator) ValueComparator {
+	var someComparator ValueComparator
+	someComparator = func(storage SlabStorage, value Value, storable Storable) (bool, error) {
+		v, ok := value.(SomeValue)
+		if !ok {
+			return comparator(storage, value, storable)
+		}
+
+		other, ok := storable.(SomeStorable)
+		if !ok {
+			return false, nil
+		}
+
+		return someComparator(storage, v.Value, other.Storable)
+	}
+	return someComparator
+}
@@ -0,0 +1,71 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSomeStorableEncodeDecode(t *testing.T) {
+	storage := newTestPersistentStorage(t)
+
+	storable := SomeStorable{Storable: SomeStorable{Storable: Uint64Value(42)}}
+
+	data, err := Encode(storable, storage.cborEncMode)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xd8, CBORTagSomeValue, 0xd8, CBORTagSomeValue, 0xd8, cborTagUInt64Value, 0x18, 0x2a}, data)
+	require.Equal(t, uint32(len(data)), storable.ByteSize())
+
+	decoded, err := decodeStorable(cbor.NewByteStreamDecoder(data), StorageIDUndefined)
+	require.NoError(t, err)
+	require.Equal(t, storable, decoded)
+
+	value, err := decoded.StoredValue(storage)
+	require.NoError(t, err)
+	require.Equal(t, SomeValue{Value: SomeValue{Value: Uint64Value(42)}}, value)
+}
+
+func TestSomeValueHashInputAndComparator(t *testing.T) {
+	storage := newTestPersistentStorage(t)
+
+	v := Uint64Value(42)
+	some := SomeValue{Value: SomeValue{Value: v}}
+
+	hashInput, err := hashInputProvider(v, nil)
+	require.NoError(t, err)
+
+	someHashInput, err := hashInputProvider(some, nil)
+	require.NoError(t, err)
+	require.Equal(t, append([]byte{0xd8, CBORTagSomeValue, 0xd8, CBORTagSomeValue}, hashInput...), someHashInput)
+
+	equal, err := compare(storage, some, SomeStorable{Storable: SomeStorable{Storable: v}})
+	require.NoError(t, err)
+	require.True(t, equal)
+
+	equal, err = compare(storage, some, SomeStorable{Storable: v})
+	require.NoError(t, err)
+	require.False(t, equal)
+
+	equal, err = compare(storage, some, v)
+	require.NoError(t, err)
+	require.False(t, equal)
+}
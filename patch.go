@@ -0,0 +1,268 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "fmt"
+
+// PatchOp is a single edit of Patch.  Op uses the same operations as
+// ChangeEvent, so changes reported by change sink can be converted to
+// patch with NewPatchFromChanges.
+type PatchOp struct {
+	Op ChangeOperation
+	// Index is element index of Array edit.
+	Index uint64
+	// Key is element key of OrderedMap edit.
+	Key Value
+	// Expected is element expected to be replaced or removed by ChangeSet
+	// and ChangeRemove.  Nil Expected skips the check.
+	Expected Value
+	// Value is element stored by ChangeSet and ChangeInsert.
+	Value Value
+}
+
+// Patch is an edit script applied in order by Array.ApplyPatch and
+// OrderedMap.ApplyPatch.
+type Patch []PatchOp
+
+// NewPatchFromChanges returns patch replaying change events.  Storables
+// of events are converted to values with storage they were reported from.
+func NewPatchFromChanges(storage SlabStorage, events []ChangeEvent) (Patch, error) {
+	patch := make(Patch, len(events))
+	for i, event := range events {
+		op := PatchOp{
+			Op:    event.Op,
+			Index: event.Index,
+			Key:   event.Key,
+		}
+		if event.Old != nil {
+			v, err := event.Old.StoredValue(storage)
+			if err != nil {
+				return nil, err
+			}
+			op.Expected = v
+		}
+		if event.New != nil {
+			v, err := event.New.StoredValue(storage)
+			if err != nil {
+				return nil, err
+			}
+			op.Value = v
+		}
+		patch[i] = op
+	}
+	return patch, nil
+}
+
+// ApplyPatch applies patch to array.  Each ChangeSet and ChangeRemove
+// operation with Expected element fails with PatchConflictError if
+// current element isn't equal to Expected according to comparator.
+//
+// Patch is applied transactionally: if any operation fails, operations
+// already applied are reverted before error is returned.  Change sink and
+// journal observe reverting mutations as well.
+//
+// Replaced and removed elements are released once patch is applied, and
+// elements stored by patch are released if patch is reverted.  If journal
+// is enabled, they are kept for Undo and Redo instead.
+func (a *Array) ApplyPatch(comparator ValueComparator, patch Patch) error {
+	applied := make([]ChangeEvent, 0, len(patch))
+
+	err := a.applyPatch(comparator, patch, &applied)
+	if err == nil {
+		for _, event := range applied {
+			releaseErr := releasePatchStorable(a.Storage, a.journal, event.Old)
+			if releaseErr != nil {
+				return releaseErr
+			}
+		}
+		return nil
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		// Reverted element is restored from its original storable.
+		unlinked, rollbackErr := a.applyInverse(applied[i])
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		rollbackErr = releasePatchStorable(a.Storage, a.journal, unlinked)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+	}
+	return err
+}
+
+func (a *Array) applyPatch(comparator ValueComparator, patch Patch, applied *[]ChangeEvent) error {
+	for i, op := range patch {
+		event := ChangeEvent{Op: op.Op, RootID: a.StorageID(), Index: op.Index}
+
+		switch op.Op {
+		case ChangeSet, ChangeRemove:
+			if op.Expected != nil {
+				existing, err := a.Get(op.Index)
+				if err != nil {
+					return err
+				}
+				err = checkPatchExpected(a.Storage, comparator, i, op.Expected, existing)
+				if err != nil {
+					return err
+				}
+			}
+
+			var err error
+			if op.Op == ChangeSet {
+				event.Old, err = a.Set(op.Index, op.Value)
+			} else {
+				event.Old, err = a.Remove(op.Index)
+			}
+			if err != nil {
+				return err
+			}
+
+		case ChangeInsert:
+			err := a.Insert(op.Index, op.Value)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return NewPatchConflictError(i, fmt.Sprintf("unknown operation %d", op.Op))
+		}
+
+		*applied = append(*applied, event)
+	}
+	return nil
+}
+
+// ApplyPatch applies patch to map.  Each ChangeSet and ChangeRemove
+// operation with Expected element fails with PatchConflictError if
+// current element isn't equal to Expected according to comparator.
+// ChangeInsert fails with PatchConflictError if key already exists.
+//
+// Patch is applied transactionally: if any operation fails, operations
+// already applied are reverted before error is returned.  Change sink and
+// journal observe reverting mutations as well.
+//
+// Replaced and removed values are released once patch is applied, and
+// values stored by patch are released if patch is reverted.  If journal
+// is enabled, they are kept for Undo and Redo instead.  Removed keys are
+// always released.
+func (m *OrderedMap) ApplyPatch(comparator ValueComparator, hip HashInputProvider, patch Patch) error {
+	applied := make([]ChangeEvent, 0, len(patch))
+
+	err := m.applyPatch(comparator, hip, patch, &applied)
+	if err == nil {
+		for _, event := range applied {
+			releaseErr := releasePatchStorable(m.Storage, m.journal, event.Old)
+			if releaseErr != nil {
+				return releaseErr
+			}
+		}
+		return nil
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		// Reverted value is restored from its original storable.
+		unlinked, rollbackErr := m.applyInverse(comparator, hip, applied[i])
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		rollbackErr = releasePatchStorable(m.Storage, m.journal, unlinked)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+	}
+	return err
+}
+
+func (m *OrderedMap) applyPatch(comparator ValueComparator, hip HashInputProvider, patch Patch, applied *[]ChangeEvent) error {
+	for i, op := range patch {
+		event := ChangeEvent{Op: op.Op, RootID: m.StorageID(), Key: op.Key}
+
+		switch op.Op {
+		case ChangeSet, ChangeRemove:
+			if op.Expected != nil {
+				existing, err := m.Get(comparator, hip, op.Key)
+				if err != nil {
+					return err
+				}
+				err = checkPatchExpected(m.Storage, comparator, i, op.Expected, existing)
+				if err != nil {
+					return err
+				}
+			}
+
+			var err error
+			if op.Op == ChangeSet {
+				event.Old, err = m.Set(comparator, hip, op.Key, op.Value)
+				if err == nil && event.Old == nil {
+					// Key didn't exist, so it's reverted by removal.
+					event.Op = ChangeInsert
+				}
+			} else {
+				// Key is stored again if removal is reverted.
+				event.Old, err = m.removeReleasingKey(comparator, hip, op.Key)
+			}
+			if err != nil {
+				return err
+			}
+
+		case ChangeInsert:
+			has, err := m.Has(comparator, hip, op.Key)
+			if err != nil {
+				return err
+			}
+			if has {
+				return NewPatchConflictError(i, fmt.Sprintf("key %s already exists", op.Key))
+			}
+
+			_, err = m.Set(comparator, hip, op.Key, op.Value)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return NewPatchConflictError(i, fmt.Sprintf("unknown operation %d", op.Op))
+		}
+
+		*applied = append(*applied, event)
+	}
+	return nil
+}
+
+// releasePatchStorable releases storable unlinked by patch unless journal
+// keeps it.
+func releasePatchStorable(storage SlabStorage, journal *operationJournal, storable Storable) error {
+	if journal != nil || storable == nil {
+		return nil
+	}
+	_, err := releaseReplacedStorable(storage, storable)
+	return err
+}
+
+func checkPatchExpected(storage SlabStorage, comparator ValueComparator, opIndex int, expected Value, existing Storable) error {
+	equal, err := comparator(storage, expected, existing)
+	if err != nil {
+		return err
+	}
+	if !equal {
+		return NewPatchConflictError(opIndex, fmt.Sprintf("element %s isn't expected %s", existing, expected))
+	}
+	return nil
+}
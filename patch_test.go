@@ -0,0 +1,292 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayApplyPatch(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("changes", func(t *testing.T) {
+		source, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		target, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 10; i++ {
+			require.NoError(t, source.Append(Uint64Value(i)))
+			require.NoError(t, target.Append(Uint64Value(i)))
+		}
+
+		var events []ChangeEvent
+		source.SetChangeSink(func(event ChangeEvent) {
+			events = append(events, event)
+		})
+
+		_, err = source.Set(3, Uint64Value(30))
+		require.NoError(t, err)
+
+		_, err = source.Remove(0)
+		require.NoError(t, err)
+
+		err = source.Insert(5, Uint64Value(50))
+		require.NoError(t, err)
+
+		err = source.Append(Uint64Value(100))
+		require.NoError(t, err)
+
+		patch, err := NewPatchFromChanges(storage, events)
+		require.NoError(t, err)
+		require.Equal(t, 4, len(patch))
+
+		err = target.ApplyPatch(compare, patch)
+		require.NoError(t, err)
+
+		require.Equal(t, arrayElements(t, source), arrayElements(t, target))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 10; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+		}
+
+		expected := arrayElements(t, array)
+
+		patch := Patch{
+			{Op: ChangeSet, Index: 0, Expected: Uint64Value(0), Value: Uint64Value(100)},
+			{Op: ChangeInsert, Index: 5, Value: Uint64Value(200)},
+			{Op: ChangeRemove, Index: 1},
+			// Element at index 3 is 4 after removal above.
+			{Op: ChangeRemove, Index: 3, Expected: Uint64Value(3)},
+		}
+
+		err = array.ApplyPatch(compare, patch)
+		var conflictError *PatchConflictError
+		require.ErrorAs(t, err, &conflictError)
+		require.Equal(t, 3, conflictError.OpIndex())
+		require.True(t, IsUserError(err))
+
+		// Applied operations are reverted.
+		require.Equal(t, expected, arrayElements(t, array))
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		require.NoError(t, array.Append(Uint64Value(0)))
+
+		patch := Patch{
+			{Op: ChangeInsert, Index: 0, Value: Uint64Value(1)},
+			{Op: ChangeSet, Index: 2, Value: Uint64Value(2)},
+		}
+
+		err = array.ApplyPatch(compare, patch)
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+
+		require.Equal(t, []Value{Uint64Value(0)}, arrayElements(t, array))
+	})
+}
+
+func TestMapApplyPatch(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	newMap := func() *OrderedMap {
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for i := uint64(0); i < 10; i++ {
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+			require.NoError(t, err)
+		}
+		return m
+	}
+
+	mapElements := func(m *OrderedMap) map[Value]Value {
+		elements := make(map[Value]Value)
+		err := m.Iterate(func(k Value, v Value) (bool, error) {
+			elements[k] = v
+			return true, nil
+		})
+		require.NoError(t, err)
+		return elements
+	}
+
+	t.Run("changes", func(t *testing.T) {
+		source := newMap()
+		target := newMap()
+
+		var events []ChangeEvent
+		source.SetChangeSink(func(event ChangeEvent) {
+			events = append(events, event)
+		})
+
+		_, err := source.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(100))
+		require.NoError(t, err)
+
+		_, err = source.Set(compare, hashInputProvider, Uint64Value(20), Uint64Value(200))
+		require.NoError(t, err)
+
+		_, _, err = source.Remove(compare, hashInputProvider, Uint64Value(2))
+		require.NoError(t, err)
+
+		patch, err := NewPatchFromChanges(storage, events)
+		require.NoError(t, err)
+
+		err = target.ApplyPatch(compare, hashInputProvider, patch)
+		require.NoError(t, err)
+
+		require.Equal(t, mapElements(source), mapElements(target))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		m := newMap()
+
+		expected := mapElements(m)
+
+		patch := Patch{
+			{Op: ChangeSet, Key: Uint64Value(1), Expected: Uint64Value(10), Value: Uint64Value(100)},
+			{Op: ChangeInsert, Key: Uint64Value(20), Value: Uint64Value(200)},
+			{Op: ChangeRemove, Key: Uint64Value(2)},
+			{Op: ChangeInsert, Key: Uint64Value(3), Value: Uint64Value(300)},
+		}
+
+		err := m.ApplyPatch(compare, hashInputProvider, patch)
+		var conflictError *PatchConflictError
+		require.ErrorAs(t, err, &conflictError)
+		require.Equal(t, 3, conflictError.OpIndex())
+
+		// Applied operations are reverted.
+		require.Equal(t, expected, mapElements(m))
+	})
+}
+
+func TestApplyPatchReleasesStorables(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Large strings are stored in separate slabs.
+	largeString := func(s string) Value {
+		return NewStringValue(strings.Repeat(s, int(MaxInlineArrayElementSize)))
+	}
+
+	t.Run("array", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for _, s := range []string{"a", "b", "c"} {
+			require.NoError(t, array.Append(largeString(s)))
+		}
+
+		patch := Patch{
+			{Op: ChangeSet, Index: 0, Value: largeString("x")},
+			{Op: ChangeRemove, Index: 1},
+		}
+
+		err = array.ApplyPatch(compare, patch)
+		require.NoError(t, err)
+
+		expected := []Value{largeString("x"), largeString("c")}
+		require.Equal(t, expected, arrayElements(t, array))
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+
+		patch = Patch{
+			{Op: ChangeSet, Index: 0, Value: largeString("y")},
+			{Op: ChangeInsert, Index: 0, Value: largeString("z")},
+			{Op: ChangeRemove, Index: 2},
+			{Op: ChangeRemove, Index: 5},
+		}
+
+		err = array.ApplyPatch(compare, patch)
+		var indexOutOfBoundsError *IndexOutOfBoundsError
+		require.ErrorAs(t, err, &indexOutOfBoundsError)
+
+		require.Equal(t, expected, arrayElements(t, array))
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		for _, s := range []string{"a", "b", "c"} {
+			_, err = m.Set(compare, hashInputProvider, largeString(s), largeString(s))
+			require.NoError(t, err)
+		}
+
+		patch := Patch{
+			{Op: ChangeSet, Key: largeString("a"), Value: largeString("x")},
+			{Op: ChangeRemove, Key: largeString("b")},
+		}
+
+		err = m.ApplyPatch(compare, hashInputProvider, patch)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), m.Count())
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+
+		patch = Patch{
+			{Op: ChangeSet, Key: largeString("a"), Value: largeString("y")},
+			{Op: ChangeSet, Key: largeString("d"), Value: largeString("d")},
+			{Op: ChangeRemove, Key: largeString("c")},
+			{Op: ChangeInsert, Key: largeString("a"), Value: largeString("z")},
+		}
+
+		err = m.ApplyPatch(compare, hashInputProvider, patch)
+		var conflictError *PatchConflictError
+		require.ErrorAs(t, err, &conflictError)
+
+		require.Equal(t, uint64(2), m.Count())
+
+		v, err := m.Get(compare, hashInputProvider, largeString("a"))
+		require.NoError(t, err)
+		e, err := v.StoredValue(storage)
+		require.NoError(t, err)
+		require.Equal(t, largeString("x"), e)
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,102 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// PreloadSlabs retrieves slabs with ids from base storage and decodes
+// them into read cache, so later reads don't wait for base storage.
+// Slabs already in cache or deltas are skipped, and missing slabs are
+// ignored.  It returns number of slabs loaded from base storage.
+func (s *PersistentSlabStorage) PreloadSlabs(ids []StorageID) (int, error) {
+	loaded := 0
+	for _, id := range ids {
+		_, found, err := s.preload(id)
+		if err != nil {
+			return loaded, err
+		}
+		if found {
+			loaded++
+		}
+	}
+	return loaded, nil
+}
+
+// PreloadCollection loads upper levels of slab tree of collection with
+// root into read cache, level by level, typically after process start
+// to warm cache for hot collections.  depth is number of levels loaded,
+// with root slab at level 1.  Child slabs, external element slabs,
+// nested collections, and insertion order arrays are at next level.
+// Negative depth loads all slabs reachable from root.  It returns
+// number of slabs loaded from base storage.
+func (s *PersistentSlabStorage) PreloadCollection(root StorageID, depth int) (int, error) {
+	loaded := 0
+	visited := make(map[StorageID]struct{})
+
+	level := []StorageID{root}
+
+	for d := 1; len(level) > 0 && (depth < 0 || d <= depth); d++ {
+		var next []StorageID
+
+		for _, id := range level {
+			if _, ok := visited[id]; ok {
+				continue
+			}
+			visited[id] = struct{}{}
+
+			slab, found, err := s.preload(id)
+			if err != nil {
+				return loaded, err
+			}
+			if slab == nil {
+				return loaded, NewSlabNotFoundErrorf(id, "slab not found during preload")
+			}
+			if found {
+				loaded++
+			}
+
+			next = appendChildSlabIDs(next, slab.ChildStorables())
+
+			if id, ok := insertionOrderSlabID(slab); ok {
+				next = append(next, id)
+			}
+		}
+
+		level = next
+	}
+
+	return loaded, nil
+}
+
+// preload returns slab with id, and true if slab is loaded from base
+// storage.
+func (s *PersistentSlabStorage) preload(id StorageID) (Slab, bool, error) {
+	if slab, ok := s.deltas[id]; ok {
+		return slab, false, nil
+	}
+
+	if slab, ok := s.cache[id]; ok {
+		return slab, false, nil
+	}
+
+	slab, found, err := s.RetrieveIgnoringDeltas(id)
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	return slab, true, nil
+}
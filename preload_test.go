@@ -0,0 +1,118 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreload(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 20; i++ {
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		for j := uint64(0); j < 200; j++ {
+			require.NoError(t, child.Append(Uint64Value(j)))
+		}
+
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(i), child)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, storage.Commit())
+
+	root := m.StorageID()
+	slabCount := baseStorage.SegmentCounts()
+
+	t.Run("collection", func(t *testing.T) {
+		storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+		rootSlab, found, err := storage.Retrieve(root)
+		require.NoError(t, err)
+		require.True(t, found)
+		storage.DropCache()
+
+		loaded, err := storage.PreloadCollection(root, 1)
+		require.NoError(t, err)
+		require.Equal(t, 1, loaded)
+
+		// Slabs in cache aren't loaded again.
+		loaded, err = storage.PreloadCollection(root, 2)
+		require.NoError(t, err)
+		require.Equal(t, len(appendChildSlabIDs(nil, rootSlab.ChildStorables())), loaded)
+
+		loaded, err = storage.PreloadCollection(root, -1)
+		require.NoError(t, err)
+		require.True(t, loaded > 0)
+
+		// All slabs are cached after preloading whole collection.
+		baseStorage.ResetReporter()
+
+		m, err := NewMapWithRootID(storage, root, NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+
+		err = m.Iterate(func(_ Value, value Value) (bool, error) {
+			err := value.(*Array).Iterate(func(Value) (bool, error) { return true, nil })
+			return err == nil, err
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, baseStorage.SegmentsReturned())
+	})
+
+	t.Run("collection not found", func(t *testing.T) {
+		storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+		_, err := storage.PreloadCollection(StorageID{Address: address, Index: StorageIndex{0xff}}, -1)
+		var slabNotFoundError *SlabNotFoundError
+		require.ErrorAs(t, err, &slabNotFoundError)
+	})
+
+	t.Run("slabs", func(t *testing.T) {
+		storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+		var ids []StorageID
+		for id := range baseStorage.segments {
+			ids = append(ids, id)
+		}
+		ids = append(ids, StorageID{Address: address, Index: StorageIndex{0xff}})
+
+		loaded, err := storage.PreloadSlabs(ids)
+		require.NoError(t, err)
+		require.Equal(t, slabCount, loaded)
+
+		loaded, err = storage.PreloadSlabs(ids)
+		require.NoError(t, err)
+		require.Equal(t, 0, loaded)
+	})
+}
@@ -0,0 +1,260 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PrintOptions configures output of FprintArray and FprintMap.
+type PrintOptions struct {
+	// MaxElements is maximum number of elements, or child slab headers,
+	// printed for each slab and collision group.  0 means no limit.
+	MaxElements int
+	// ShowSlabIDs prints IDs of slabs and child slabs.
+	ShowSlabIDs bool
+	// ShowSizes prints byte sizes of slabs and child slabs.
+	ShowSizes bool
+	// ShowHashes prints hashed keys of map elements and slabs.
+	ShowHashes bool
+}
+
+// DefaultPrintOptions prints all slab details and elements.
+// It is used by PrintArray, PrintMap, DumpArraySlabs, and DumpMapSlabs.
+var DefaultPrintOptions = PrintOptions{
+	ShowSlabIDs: true,
+	ShowSizes:   true,
+	ShowHashes:  true,
+}
+
+// printLimit returns number of items to print out of count items.
+func (opts PrintOptions) printLimit(count int) int {
+	if opts.MaxElements > 0 && count > opts.MaxElements {
+		return opts.MaxElements
+	}
+	return count
+}
+
+// joinItems joins printed items out of count items, noting omitted items.
+func (opts PrintOptions) joinItems(items []string, count int) string {
+	if len(items) < count {
+		items = append(items, fmt.Sprintf("...(%d more)", count-len(items)))
+	}
+	return strings.Join(items, " ")
+}
+
+// slabFields returns fields describing slab or child slab header,
+// omitting id and size if they aren't enabled by options.
+func (opts PrintOptions) slabFields(id StorageID, size uint32, fields ...string) []string {
+	var s []string
+	if opts.ShowSlabIDs {
+		s = append(s, "id:"+id.String())
+	}
+	if opts.ShowSizes {
+		s = append(s, fmt.Sprintf("size:%d", size))
+	}
+	return append(s, fields...)
+}
+
+// slabHeader returns name followed by fields of slab.
+func (opts PrintOptions) slabHeader(name string, id StorageID, size uint32, fields ...string) string {
+	return strings.Join(append([]string{name}, opts.slabFields(id, size, fields...)...), " ")
+}
+
+// childHeader returns fields of child slab header in braces.
+func (opts PrintOptions) childHeader(id StorageID, size uint32, fields ...string) string {
+	return "{" + strings.Join(opts.slabFields(id, size, fields...), " ") + "}"
+}
+
+func (opts PrintOptions) formatArraySlab(slab ArraySlab) string {
+	switch slab := slab.(type) {
+	case *ArrayDataSlab:
+		count := len(slab.elements)
+		elems := make([]string, opts.printLimit(count))
+		for i := range elems {
+			elems[i] = fmt.Sprint(slab.elements[i])
+		}
+
+		return fmt.Sprintf("%s elements: [%s]",
+			opts.slabHeader("ArrayDataSlab", slab.header.id, slab.header.size, fmt.Sprintf("count:%d", slab.header.count)),
+			opts.joinItems(elems, count),
+		)
+
+	case *ArrayMetaDataSlab:
+		count := len(slab.childrenHeaders)
+		children := make([]string, opts.printLimit(count))
+		for i := range children {
+			h := slab.childrenHeaders[i]
+			children[i] = opts.childHeader(h.id, h.size, fmt.Sprintf("count:%d", h.count))
+		}
+
+		return fmt.Sprintf("%s children: [%s]",
+			opts.slabHeader("ArrayMetaDataSlab", slab.header.id, slab.header.size, fmt.Sprintf("count:%d", slab.header.count)),
+			opts.joinItems(children, count),
+		)
+
+	default:
+		return fmt.Sprint(slab)
+	}
+}
+
+// hashField returns field of hashed key named name, or no field if
+// hashes aren't enabled by options.
+func (opts PrintOptions) hashField(name string, hkey Digest) []string {
+	if !opts.ShowHashes {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s:%d", name, hkey)}
+}
+
+func (opts PrintOptions) formatMapSlab(slab MapSlab) string {
+	switch slab := slab.(type) {
+	case *MapDataSlab:
+		return fmt.Sprintf("%s elements: [%s]",
+			opts.slabHeader("MapDataSlab", slab.header.id, slab.header.size, opts.hashField("firstkey", slab.header.firstKey)...),
+			opts.formatMapElements(slab.elements),
+		)
+
+	case *MapMetaDataSlab:
+		count := len(slab.childrenHeaders)
+		children := make([]string, opts.printLimit(count))
+		for i := range children {
+			h := slab.childrenHeaders[i]
+			children[i] = opts.childHeader(h.id, h.size, opts.hashField("firstKey", h.firstKey)...)
+		}
+
+		return fmt.Sprintf("%s children: [%s]",
+			opts.slabHeader("MapMetaDataSlab", slab.header.id, slab.header.size, opts.hashField("firstKey", slab.header.firstKey)...),
+			opts.joinItems(children, count),
+		)
+
+	default:
+		return fmt.Sprint(slab)
+	}
+}
+
+func (opts PrintOptions) formatMapElements(elems elements) string {
+	count := int(elems.Count())
+	items := make([]string, opts.printLimit(count))
+
+	switch elems := elems.(type) {
+	case *hkeyElements:
+		for i := range items {
+			s := opts.formatMapElement(elems.elems[i])
+			if opts.ShowHashes {
+				s = fmt.Sprintf("%d:%s", elems.hkeys[i], s)
+			}
+			items[i] = s
+		}
+
+	case *singleElements:
+		for i := range items {
+			s := elems.elems[i].String()
+			if opts.ShowHashes {
+				// Elements in single elements group don't have hashed keys.
+				s = ":" + s
+			}
+			items[i] = s
+		}
+
+	default:
+		return elems.String()
+	}
+
+	return opts.joinItems(items, count)
+}
+
+func (opts PrintOptions) formatMapElement(elem element) string {
+	switch elem := elem.(type) {
+	case *inlineCollisionGroup:
+		return "inline[" + opts.formatMapElements(elem.elements) + "]"
+
+	case *externalCollisionGroup:
+		if !opts.ShowSlabIDs {
+			return "external"
+		}
+		return elem.String()
+
+	default:
+		return elem.String()
+	}
+}
+
+const (
+	// DefaultStringMaxElements is maximum number of elements printed by
+	// String of Array and OrderedMap.
+	DefaultStringMaxElements = 1000
+
+	// DefaultStringMaxBytes is maximum byte length of elements printed by
+	// String of Array and OrderedMap.
+	DefaultStringMaxBytes = 64 * 1024
+)
+
+// elementsStringBuilder builds string of collection elements, such as
+// "[0 1 2]", stopping at maximum number of elements or bytes.
+// 0 maximum means no limit.
+type elementsStringBuilder struct {
+	buf         strings.Builder
+	maxElements int
+	maxBytes    int
+	count       int
+}
+
+func newElementsStringBuilder(maxElements int, maxBytes int) *elementsStringBuilder {
+	b := &elementsStringBuilder{
+		maxElements: maxElements,
+		maxBytes:    maxBytes,
+	}
+	b.buf.WriteByte('[')
+	return b
+}
+
+// full returns true if no more elements can be added.
+func (b *elementsStringBuilder) full() bool {
+	return b.maxElements > 0 && b.count >= b.maxElements
+}
+
+// add adds element s and returns true, or returns false if s would
+// exceed maximum number of bytes.
+func (b *elementsStringBuilder) add(s string) bool {
+	if b.count > 0 {
+		s = " " + s
+	}
+	// Opening bracket isn't counted.
+	if b.maxBytes > 0 && b.buf.Len()-1+len(s) > b.maxBytes {
+		return false
+	}
+	b.buf.WriteString(s)
+	b.count++
+	return true
+}
+
+// String returns elements string of collection with total elements,
+// noting omitted elements.
+func (b *elementsStringBuilder) String(total uint64) string {
+	if uint64(b.count) < total {
+		if b.count > 0 {
+			b.buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&b.buf, "...(%d more)", total-uint64(b.count))
+	}
+	b.buf.WriteByte(']')
+	return b.buf.String()
+}
@@ -0,0 +1,126 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFprintArray(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 120; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		dumps, err := DumpArraySlabs(array)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		err = FprintArray(&buf, array, DefaultPrintOptions)
+		require.NoError(t, err)
+		require.Equal(t, dumps[0]+"\n"+dumps[1]+"\n"+dumps[2]+"\n", buf.String())
+	})
+
+	t.Run("options", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := FprintArray(&buf, array, PrintOptions{MaxElements: 3})
+		require.NoError(t, err)
+
+		want := "level 1, ArrayMetaDataSlab count:120 children: [{count:54} {count:66}]\n" +
+			"level 2, ArrayDataSlab count:54 elements: [0 1 2 ...(51 more)]\n" +
+			"level 2, ArrayDataSlab count:66 elements: [54 55 56 ...(63 more)]\n"
+		require.Equal(t, want, buf.String())
+	})
+}
+
+func TestFprintMap(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	digesterBuilder := &mockDigesterBuilder{}
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+	require.NoError(t, err)
+
+	digests := [][]Digest{
+		{0, 0},
+		{1, 0},
+		{1, 1},
+		{2, 0},
+		{3, 0},
+	}
+	for i, d := range digests {
+		k := Uint64Value(i)
+		digesterBuilder.On("Digest", k).Return(mockDigester{d: d})
+
+		existingStorable, err := m.Set(compare, hashInputProvider, k, k)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		dumps, err := DumpMapSlabs(m)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(dumps))
+
+		var buf bytes.Buffer
+		err = FprintMap(&buf, m, DefaultPrintOptions)
+		require.NoError(t, err)
+		require.Equal(t, dumps[0]+"\n", buf.String())
+	})
+
+	t.Run("hashes", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := FprintMap(&buf, m, PrintOptions{ShowHashes: true, MaxElements: 2})
+		require.NoError(t, err)
+		require.Equal(t,
+			"level 1, MapDataSlab firstkey:0 elements: [0:0:0 1:inline[0:1:1 1:2:2] ...(2 more)]\n",
+			buf.String(),
+		)
+	})
+
+	t.Run("no hashes", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := FprintMap(&buf, m, PrintOptions{ShowSlabIDs: true})
+		require.NoError(t, err)
+		require.Equal(t,
+			"level 1, MapDataSlab id:0x102030405060708.1 elements: [0:0 inline[1:1 2:2] 3:3 4:4]\n",
+			buf.String(),
+		)
+	})
+}
@@ -0,0 +1,210 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prommetrics exposes atree storage and collection metrics as
+// Prometheus collectors.
+//
+// Metrics are collected by instrumenting base storage and slab storage,
+// and by storage hooks:
+//
+//	metrics := prommetrics.NewMetrics("atree")
+//	prometheus.MustRegister(metrics)
+//
+//	base := metrics.InstrumentBaseStorage(ledgerBaseStorage)
+//	storage := metrics.InstrumentStorage(atree.NewPersistentSlabStorage(
+//		base, encMode, decMode, decodeStorable, decodeTypeInfo,
+//		atree.WithHooks(metrics.Hooks()),
+//	))
+//
+// Cache hit rate is 1 - base_retrieves_total / retrieves_total.
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/onflow/atree"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are Prometheus metrics of atree storage.
+type Metrics struct {
+	retrieves         prometheus.Counter
+	baseRetrieves     prometheus.Counter
+	baseStores        prometheus.Counter
+	baseRemoves       prometheus.Counter
+	bytesRetrieved    prometheus.Counter
+	bytesStored       prometheus.Counter
+	slabsCreated      prometheus.Counter
+	slabsRemoved      prometheus.Counter
+	splits            prometheus.Counter
+	merges            prometheus.Counter
+	elementsSet       prometheus.Counter
+	elementsInserted  prometheus.Counter
+	elementsRemoved   prometheus.Counter
+	commitDuration    prometheus.Histogram
+	baseRetrieveDelay prometheus.Histogram
+}
+
+var _ prometheus.Collector = &Metrics{}
+
+// NewMetrics returns metrics with names prefixed by namespace.
+func NewMetrics(namespace string) *Metrics {
+	counter := func(name string, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		})
+	}
+
+	return &Metrics{
+		retrieves:        counter("retrieves_total", "Number of slab retrieves from slab storage."),
+		baseRetrieves:    counter("base_retrieves_total", "Number of slab retrieves from base storage (cache misses)."),
+		baseStores:       counter("base_stores_total", "Number of slabs written to base storage."),
+		baseRemoves:      counter("base_removes_total", "Number of slabs removed from base storage."),
+		bytesRetrieved:   counter("base_retrieved_bytes_total", "Number of bytes retrieved from base storage."),
+		bytesStored:      counter("base_stored_bytes_total", "Number of bytes written to base storage."),
+		slabsCreated:     counter("slabs_created_total", "Number of slabs created."),
+		slabsRemoved:     counter("slabs_removed_total", "Number of slabs removed."),
+		splits:           counter("slab_splits_total", "Number of slab splits."),
+		merges:           counter("slab_merges_total", "Number of slab merges."),
+		elementsSet:      counter("elements_set_total", "Number of collection elements replaced."),
+		elementsInserted: counter("elements_inserted_total", "Number of collection elements inserted."),
+		elementsRemoved:  counter("elements_removed_total", "Number of collection elements removed."),
+		commitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "commit_duration_seconds",
+			Help:      "Duration of storage commits.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		baseRetrieveDelay: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "base_retrieve_duration_seconds",
+			Help:      "Duration of slab retrieves from base storage.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.retrieves,
+		m.baseRetrieves,
+		m.baseStores,
+		m.baseRemoves,
+		m.bytesRetrieved,
+		m.bytesStored,
+		m.slabsCreated,
+		m.slabsRemoved,
+		m.splits,
+		m.merges,
+		m.elementsSet,
+		m.elementsInserted,
+		m.elementsRemoved,
+		m.commitDuration,
+		m.baseRetrieveDelay,
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Hooks returns storage hooks counting structural changes and
+// element mutations.  Pass them to storage with atree.WithHooks.
+func (m *Metrics) Hooks() atree.Hooks {
+	return atree.Hooks{
+		OnSlabCreated:     func(atree.StorageID) { m.slabsCreated.Inc() },
+		OnSlabRemoved:     func(atree.StorageID) { m.slabsRemoved.Inc() },
+		OnSlabSplit:       func(_, _, _ atree.StorageID) { m.splits.Inc() },
+		OnSlabMerge:       func(_, _ atree.StorageID) { m.merges.Inc() },
+		OnElementSet:      func(atree.StorageID) { m.elementsSet.Inc() },
+		OnElementInserted: func(atree.StorageID) { m.elementsInserted.Inc() },
+		OnElementRemoved:  func(atree.StorageID) { m.elementsRemoved.Inc() },
+	}
+}
+
+// InstrumentBaseStorage returns base storage counting reads and writes of base.
+func (m *Metrics) InstrumentBaseStorage(base atree.BaseStorage) atree.BaseStorage {
+	return &baseStorage{BaseStorage: base, metrics: m}
+}
+
+type baseStorage struct {
+	atree.BaseStorage
+	metrics *Metrics
+}
+
+func (s *baseStorage) Retrieve(id atree.StorageID) ([]byte, bool, error) {
+	start := time.Now()
+	data, found, err := s.BaseStorage.Retrieve(id)
+	s.metrics.baseRetrieveDelay.Observe(time.Since(start).Seconds())
+	s.metrics.baseRetrieves.Inc()
+	s.metrics.bytesRetrieved.Add(float64(len(data)))
+	return data, found, err
+}
+
+func (s *baseStorage) Store(id atree.StorageID, data []byte) error {
+	s.metrics.baseStores.Inc()
+	s.metrics.bytesStored.Add(float64(len(data)))
+	return s.BaseStorage.Store(id, data)
+}
+
+func (s *baseStorage) Remove(id atree.StorageID) error {
+	s.metrics.baseRemoves.Inc()
+	return s.BaseStorage.Remove(id)
+}
+
+// Storage is PersistentSlabStorage counting retrieves and measuring
+// commit latency.  Collections must be created with Storage (not with
+// the wrapped storage) for retrieves to be counted.
+type Storage struct {
+	*atree.PersistentSlabStorage
+	metrics *Metrics
+}
+
+// InstrumentStorage returns storage instrumented with metrics.
+func (m *Metrics) InstrumentStorage(storage *atree.PersistentSlabStorage) *Storage {
+	return &Storage{PersistentSlabStorage: storage, metrics: m}
+}
+
+func (s *Storage) Retrieve(id atree.StorageID) (atree.Slab, bool, error) {
+	s.metrics.retrieves.Inc()
+	return s.PersistentSlabStorage.Retrieve(id)
+}
+
+func (s *Storage) Commit() error {
+	start := time.Now()
+	err := s.PersistentSlabStorage.Commit()
+	s.metrics.commitDuration.Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (s *Storage) FastCommit(numWorkers int) error {
+	start := time.Now()
+	err := s.PersistentSlabStorage.FastCommit(numWorkers)
+	s.metrics.commitDuration.Observe(time.Since(start).Seconds())
+	return err
+}
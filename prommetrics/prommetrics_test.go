@@ -0,0 +1,122 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prommetrics
+
+import (
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/values"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+
+	atree.SetThreshold(256)
+	defer atree.SetThreshold(1024)
+
+	const arraySize = 1024
+
+	metrics := NewMetrics("atree")
+
+	registry := prometheus.NewRegistry()
+	err := registry.Register(metrics)
+	require.NoError(t, err)
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	dirBase, err := inspect.NewDirBaseStorage(t.TempDir())
+	require.NoError(t, err)
+
+	base := metrics.InstrumentBaseStorage(dirBase)
+
+	storage := metrics.InstrumentStorage(atree.NewPersistentSlabStorage(
+		base,
+		encMode,
+		decMode,
+		values.DecodeStorable,
+		inspect.DecodeRawTypeInfo,
+		atree.WithHooks(metrics.Hooks()),
+	))
+
+	// CBOR encoded uint 42
+	typeInfo := inspect.RawTypeInfo{0x18, 0x2a}
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := atree.NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(values.Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	_, err = array.Set(0, values.Uint64Value(0))
+	require.NoError(t, err)
+
+	_, err = array.Remove(0)
+	require.NoError(t, err)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	slabCount := float64(storage.Count())
+
+	require.Equal(t, float64(arraySize), testutil.ToFloat64(metrics.elementsInserted))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.elementsSet))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.elementsRemoved))
+	require.True(t, testutil.ToFloat64(metrics.splits) > 0)
+	require.Equal(t, slabCount, testutil.ToFloat64(metrics.slabsCreated)-testutil.ToFloat64(metrics.slabsRemoved))
+	require.Equal(t, slabCount, testutil.ToFloat64(metrics.baseStores))
+	require.True(t, testutil.ToFloat64(metrics.bytesStored) > 0)
+	require.True(t, testutil.ToFloat64(metrics.retrieves) > 0)
+
+	// Reopen array from base storage to read slabs through instrumented base storage.
+	storage2 := metrics.InstrumentStorage(atree.NewPersistentSlabStorage(
+		base,
+		encMode,
+		decMode,
+		values.DecodeStorable,
+		inspect.DecodeRawTypeInfo,
+	))
+
+	array2, err := atree.NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+
+	for i := uint64(0); i < array2.Count(); i++ {
+		v, err := array2.Get(i)
+		require.NoError(t, err)
+		require.Equal(t, values.Uint64Value(i+1), v)
+	}
+
+	require.Equal(t, slabCount, testutil.ToFloat64(metrics.baseRetrieves))
+	require.True(t, testutil.ToFloat64(metrics.bytesRetrieved) > 0)
+
+	count, err := testutil.GatherAndCount(registry, "atree_commit_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
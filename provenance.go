@@ -0,0 +1,166 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "github.com/fxamacker/cbor/v2"
+
+// SlabFormatVersion is version of slab encoding written by this package.
+const SlabFormatVersion = 0
+
+// MaxProvenanceCreatorSize is maximum byte size of provenance creator tag.
+const MaxProvenanceCreatorSize = 64
+
+// Provenance is creation metadata written into collection root when
+// collection is created with storage configured by WithProvenance.
+// It is set once and isn't changed by later mutations, so tooling
+// inspecting a ledger dump can attribute collections to their creators.
+type Provenance struct {
+	// CreatedAt is application-defined creation sequence, such as block height.
+	CreatedAt uint64
+	// Creator is application-defined creator tag, such as transaction ID.
+	Creator []byte
+	// FormatVersion is slab format version at creation time.
+	FormatVersion uint64
+}
+
+// ProvenanceProvider returns provenance of collection created at address.
+// FormatVersion of returned provenance is ignored and set to SlabFormatVersion.
+type ProvenanceProvider func(address Address) (Provenance, error)
+
+// WithProvenance records provenance returned by provider in root of
+// every array and map created with storage.
+func WithProvenance(provider ProvenanceProvider) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.provenanceProvider = provider
+		return st
+	}
+}
+
+// provenanceStorage is implemented by storage with provenance provider.
+type provenanceStorage interface {
+	storageProvenanceProvider() ProvenanceProvider
+}
+
+func (s *PersistentSlabStorage) storageProvenanceProvider() ProvenanceProvider {
+	return s.provenanceProvider
+}
+
+func provenanceProviderOf(storage SlabStorage) ProvenanceProvider {
+	s, ok := unwrapSlabStorage(storage).(provenanceStorage)
+	if !ok {
+		return nil
+	}
+	return s.storageProvenanceProvider()
+}
+
+// newProvenance returns provenance of new collection at address, or nil
+// if storage has no provenance provider.
+func newProvenance(storage SlabStorage, address Address) (*Provenance, error) {
+	provider := provenanceProviderOf(storage)
+	if provider == nil {
+		return nil, nil
+	}
+
+	provenance, err := provider(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(provenance.Creator) > MaxProvenanceCreatorSize {
+		return nil, NewMaxProvenanceCreatorSizeError(len(provenance.Creator))
+	}
+
+	return &Provenance{
+		CreatedAt:     provenance.CreatedAt,
+		Creator:       append([]byte(nil), provenance.Creator...),
+		FormatVersion: SlabFormatVersion,
+	}, nil
+}
+
+const provenanceLength = 3
+
+func decodeProvenance(dec *cbor.StreamDecoder) (*Provenance, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != provenanceLength {
+		return nil, NewDecodingErrorf("provenance has invalid length %d, want %d", length, provenanceLength)
+	}
+
+	createdAt, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	creator, err := dec.DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	formatVersion, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provenance{
+		CreatedAt:     createdAt,
+		Creator:       creator,
+		FormatVersion: formatVersion,
+	}, nil
+}
+
+func (p *Provenance) encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(provenanceLength)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeUint64(p.CreatedAt)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeBytes(p.Creator)
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint64(p.FormatVersion)
+}
+
+// copyProvenance returns copy of provenance, or nil if provenance is nil.
+func copyProvenance(provenance *Provenance) *Provenance {
+	if provenance == nil {
+		return nil
+	}
+	return &Provenance{
+		CreatedAt:     provenance.CreatedAt,
+		Creator:       append([]byte(nil), provenance.Creator...),
+		FormatVersion: provenance.FormatVersion,
+	}
+}
+
+// Provenance returns copy of array provenance, or nil if array was
+// created without provenance.
+func (a *Array) Provenance() *Provenance {
+	return copyProvenance(a.root.ExtraData().Provenance)
+}
+
+// Provenance returns copy of map provenance, or nil if map was
+// created without provenance.
+func (m *OrderedMap) Provenance() *Provenance {
+	return copyProvenance(m.root.ExtraData().Provenance)
+}
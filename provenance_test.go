@@ -0,0 +1,128 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("without provider", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		require.Nil(t, array.Provenance())
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+		require.Nil(t, m.Provenance())
+		require.Equal(t, uint64(0), m.root.ExtraData().optionalFieldCount())
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		createdAt := uint64(100)
+		storage := newTestPersistentStorage(t, WithProvenance(func(a Address) (Provenance, error) {
+			require.Equal(t, address, a)
+			createdAt++
+			return Provenance{CreatedAt: createdAt, Creator: []byte("tx1"), FormatVersion: 7}, nil
+		}))
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		batchArray, err := NewArrayFromBatchData(storage, address, typeInfo, func() (Value, error) {
+			return nil, nil
+		})
+		require.NoError(t, err)
+
+		wantArray := &Provenance{CreatedAt: 101, Creator: []byte("tx1"), FormatVersion: SlabFormatVersion}
+		wantMap := &Provenance{CreatedAt: 102, Creator: []byte("tx1"), FormatVersion: SlabFormatVersion}
+		wantBatchArray := &Provenance{CreatedAt: 103, Creator: []byte("tx1"), FormatVersion: SlabFormatVersion}
+		require.Equal(t, wantArray, array.Provenance())
+		require.Equal(t, wantMap, m.Provenance())
+		require.Equal(t, wantBatchArray, batchArray.Provenance())
+
+		// Returned provenance is a copy.
+		array.Provenance().Creator[0] = 'x'
+		require.Equal(t, wantArray, array.Provenance())
+
+		// Provenance is kept when root slab is split.
+		for i := uint64(0); i < 256; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+			require.NoError(t, err)
+		}
+		require.False(t, array.root.IsData())
+		require.False(t, m.root.IsData())
+
+		require.NoError(t, storage.Commit())
+
+		reloadedStorage := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		reloadedArray, err := NewArrayWithRootID(reloadedStorage, array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, wantArray, reloadedArray.Provenance())
+
+		reloadedMap, err := NewMapWithRootID(reloadedStorage, m.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+		require.Equal(t, wantMap, reloadedMap.Provenance())
+
+		reloadedBatchArray, err := NewArrayWithRootID(reloadedStorage, batchArray.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, wantBatchArray, reloadedBatchArray.Provenance())
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		providerErr := errors.New("provider error")
+		storage := newTestPersistentStorage(t, WithProvenance(func(Address) (Provenance, error) {
+			return Provenance{}, providerErr
+		}))
+
+		_, err := NewArray(storage, address, typeInfo)
+		require.ErrorIs(t, err, providerErr)
+
+		_, err = NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.ErrorIs(t, err, providerErr)
+	})
+
+	t.Run("oversized creator", func(t *testing.T) {
+		storage := newTestPersistentStorage(t, WithProvenance(func(Address) (Provenance, error) {
+			return Provenance{Creator: make([]byte, MaxProvenanceCreatorSize+1)}, nil
+		}))
+
+		_, err := NewArray(storage, address, typeInfo)
+		var sizeError *MaxProvenanceCreatorSizeError
+		require.ErrorAs(t, err, &sizeError)
+		require.True(t, IsUserError(err))
+	})
+}
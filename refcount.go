@@ -0,0 +1,99 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// Nested collections can be shared by multiple parents (or stored in
+// multiple elements of the same parent) if every reference beyond the
+// first is registered with AddReference.  Reference count is persisted
+// in root slab extra data, so DeepRemove of any parent only removes
+// shared collection when its last reference is dropped.
+
+// RefCount returns number of registered references to array.
+func (a *Array) RefCount() uint64 {
+	return 1 + a.root.ExtraData().ExtraRefs
+}
+
+// AddReference registers additional reference to array.  It must be
+// called before array is stored in another parent.
+func (a *Array) AddReference() error {
+	a.root.ExtraData().ExtraRefs++
+	return a.Storage.Store(a.root.ID(), a.root)
+}
+
+// ReleaseReference drops a reference to array after it is removed from
+// a parent.  It returns true if the dropped reference was the last one,
+// in which case caller is responsible for removing array slabs.
+func (a *Array) ReleaseReference() (last bool, err error) {
+	extraData := a.root.ExtraData()
+	if extraData.ExtraRefs == 0 {
+		return true, nil
+	}
+	extraData.ExtraRefs--
+	return false, a.Storage.Store(a.root.ID(), a.root)
+}
+
+// RefCount returns number of registered references to map.
+func (m *OrderedMap) RefCount() uint64 {
+	return 1 + m.root.ExtraData().ExtraRefs
+}
+
+// AddReference registers additional reference to map.  It must be
+// called before map is stored in another parent.
+func (m *OrderedMap) AddReference() error {
+	m.root.ExtraData().ExtraRefs++
+	return m.Storage.Store(m.root.ID(), m.root)
+}
+
+// ReleaseReference drops a reference to map after it is removed from
+// a parent.  It returns true if the dropped reference was the last one,
+// in which case caller is responsible for removing map slabs.
+func (m *OrderedMap) ReleaseReference() (last bool, err error) {
+	extraData := m.root.ExtraData()
+	if extraData.ExtraRefs == 0 {
+		return true, nil
+	}
+	extraData.ExtraRefs--
+	return false, m.Storage.Store(m.root.ID(), m.root)
+}
+
+// releaseSharedSlab drops a reference to collection with root slab if
+// the collection has other references.  It returns true if slab is
+// shared and must not be removed.
+func releaseSharedSlab(storage SlabStorage, slab Slab) (bool, error) {
+	switch slab := slab.(type) {
+	case ArraySlab:
+		extraData := slab.ExtraData()
+		if extraData == nil || extraData.ExtraRefs == 0 {
+			return false, nil
+		}
+		extraData.ExtraRefs--
+
+	case MapSlab:
+		extraData := slab.ExtraData()
+		if extraData == nil || extraData.ExtraRefs == 0 {
+			return false, nil
+		}
+		extraData.ExtraRefs--
+
+	default:
+		return false, nil
+	}
+
+	return true, storage.Store(slab.ID(), slab)
+}
@@ -0,0 +1,120 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedCollectionRefCount(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	parent1, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	parent2, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	shared, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, shared.Append(Uint64Value(42)))
+	require.Equal(t, uint64(1), shared.RefCount())
+
+	sharedMap, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	require.NoError(t, parent1.Append(shared))
+	require.NoError(t, shared.AddReference())
+	_, err = parent2.Set(compare, hashInputProvider, Uint64Value(0), shared)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), shared.RefCount())
+
+	require.NoError(t, parent1.Append(sharedMap))
+	require.NoError(t, sharedMap.AddReference())
+	_, err = parent2.Set(compare, hashInputProvider, Uint64Value(1), sharedMap)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Commit())
+
+	// Reference count is persisted in root slab extra data.
+	reloadedStorage := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	reloaded, err := NewArrayWithRootID(reloadedStorage, shared.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), reloaded.RefCount())
+
+	reloadedMap, err := NewMapWithRootID(reloadedStorage, sharedMap.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), reloadedMap.RefCount())
+
+	// Removing first parent drops references to shared collections.
+	remover, err := parent1.DeepRemove(0, nil)
+	require.NoError(t, err)
+	require.Nil(t, remover)
+
+	require.Equal(t, uint64(1), shared.RefCount())
+	require.Equal(t, uint64(1), sharedMap.RefCount())
+
+	v, err := shared.Get(0)
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(42), v)
+
+	// Removing last parent removes shared collections.
+	remover, err = parent2.DeepRemove(0, nil)
+	require.NoError(t, err)
+	require.Nil(t, remover)
+
+	require.NoError(t, storage.Commit())
+	require.Equal(t, 0, len(storage.baseStorage.(*InMemBaseStorage).segments))
+}
+
+func TestReleaseReference(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	require.NoError(t, array.AddReference())
+	require.NoError(t, array.AddReference())
+	require.Equal(t, uint64(3), array.RefCount())
+
+	last, err := array.ReleaseReference()
+	require.NoError(t, err)
+	require.False(t, last)
+
+	last, err = array.ReleaseReference()
+	require.NoError(t, err)
+	require.False(t, last)
+
+	last, err = array.ReleaseReference()
+	require.NoError(t, err)
+	require.True(t, last)
+	require.Equal(t, uint64(1), array.RefCount())
+
+	// Unshared extra data is encoded without optional fields.
+	require.Equal(t, uint64(0), array.root.ExtraData().optionalFieldCount())
+}
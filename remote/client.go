@@ -0,0 +1,257 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/onflow/atree"
+)
+
+// Client is a BaseStorage backed by a remote Server.
+//
+// Store and Remove are buffered by Client and sent to the server
+// atomically by Commit.  Retrieve returns buffered data before
+// calling the server.  Typical usage is to call Commit after
+// PersistentSlabStorage.Commit or FastCommit.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// pending contains buffered stores and removes (nil data).
+	pending          map[atree.StorageID][]byte
+	bytesRetrieved   int
+	bytesStored      int
+	segmentsReturned map[atree.StorageID]struct{}
+	segmentsUpdated  map[atree.StorageID]struct{}
+	segmentsTouched  map[atree.StorageID]struct{}
+}
+
+var _ atree.BaseStorage = &Client{}
+
+// NewClient returns Client of server at baseURL.  If httpClient is nil,
+// http.DefaultClient is used.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:          strings.TrimSuffix(baseURL, "/"),
+		httpClient:       httpClient,
+		pending:          make(map[atree.StorageID][]byte),
+		segmentsReturned: make(map[atree.StorageID]struct{}),
+		segmentsUpdated:  make(map[atree.StorageID]struct{}),
+		segmentsTouched:  make(map[atree.StorageID]struct{}),
+	}
+}
+
+func (c *Client) Retrieve(id atree.StorageID) ([]byte, bool, error) {
+	c.segmentsTouched[id] = struct{}{}
+
+	if data, ok := c.pending[id]; ok {
+		if data == nil {
+			return nil, false, nil
+		}
+		c.recordRetrieved(id, data)
+		return data, true, nil
+	}
+
+	resp, err := c.do(http.MethodGet, slabsPath+encodeStorageID(id), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return nil, false, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.recordRetrieved(id, data)
+	return data, true, nil
+}
+
+func (c *Client) Store(id atree.StorageID, data []byte) error {
+	c.pending[id] = data
+	c.bytesStored += len(data)
+	c.segmentsUpdated[id] = struct{}{}
+	c.segmentsTouched[id] = struct{}{}
+	return nil
+}
+
+func (c *Client) Remove(id atree.StorageID) error {
+	c.pending[id] = nil
+	c.segmentsUpdated[id] = struct{}{}
+	c.segmentsTouched[id] = struct{}{}
+	return nil
+}
+
+// GenerateStorageID returns storage ID generated by the server.
+func (c *Client) GenerateStorageID(address atree.Address) (atree.StorageID, error) {
+	resp, err := c.do(http.MethodPost, idsPath+encodeAddress(address), nil)
+	if err != nil {
+		return atree.StorageIDUndefined, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return atree.StorageIDUndefined, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return atree.StorageIDUndefined, err
+	}
+
+	return decodeStorageID(string(b))
+}
+
+// Commit sends buffered stores and removes to the server.
+// Buffered changes are kept if the server fails to apply them.
+func (c *Client) Commit() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+
+	batch := make([]batchEntry, 0, len(c.pending))
+	for id, data := range c.pending {
+		batch = append(batch, batchEntry{ID: encodeStorageID(id), Data: data})
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(http.MethodPost, commitPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusNoContent); err != nil {
+		return err
+	}
+
+	c.pending = make(map[atree.StorageID][]byte)
+	return nil
+}
+
+// PendingCount returns number of buffered stores and removes.
+func (c *Client) PendingCount() int {
+	return len(c.pending)
+}
+
+// SegmentCounts returns number of segments committed to the server.
+// It returns 0 if the server can't be reached.
+func (c *Client) SegmentCounts() int {
+	s, err := c.stats()
+	if err != nil {
+		return 0
+	}
+	return s.SegmentCounts
+}
+
+// Size returns total size of segments committed to the server.
+// It returns 0 if the server can't be reached.
+func (c *Client) Size() int {
+	s, err := c.stats()
+	if err != nil {
+		return 0
+	}
+	return s.Size
+}
+
+func (c *Client) stats() (stats, error) {
+	var s stats
+
+	resp, err := c.do(http.MethodGet, statsPath, nil)
+	if err != nil {
+		return s, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return s, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&s)
+	return s, err
+}
+
+func (c *Client) BytesRetrieved() int {
+	return c.bytesRetrieved
+}
+
+func (c *Client) BytesStored() int {
+	return c.bytesStored
+}
+
+func (c *Client) SegmentsReturned() int {
+	return len(c.segmentsReturned)
+}
+
+func (c *Client) SegmentsUpdated() int {
+	return len(c.segmentsUpdated)
+}
+
+func (c *Client) SegmentsTouched() int {
+	return len(c.segmentsTouched)
+}
+
+func (c *Client) ResetReporter() {
+	c.bytesStored = 0
+	c.bytesRetrieved = 0
+	c.segmentsReturned = make(map[atree.StorageID]struct{})
+	c.segmentsUpdated = make(map[atree.StorageID]struct{})
+	c.segmentsTouched = make(map[atree.StorageID]struct{})
+}
+
+func (c *Client) recordRetrieved(id atree.StorageID, data []byte) {
+	c.bytesRetrieved += len(data)
+	c.segmentsReturned[id] = struct{}{}
+}
+
+func (c *Client) do(method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+func checkStatus(resp *http.Response, want int) error {
+	if resp.StatusCode == want {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("remote storage: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,98 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package remote provides a plain HTTP protocol for atree.BaseStorage,
+// so that collections can be stored by a remote storage service.
+//
+// Server exposes a BaseStorage over HTTP, and Client implements
+// BaseStorage by calling Server.  Protocol:
+//
+//	GET    /slabs/{id}        retrieve slab data (404 if not found)
+//	PUT    /slabs/{id}        store slab data in request body
+//	DELETE /slabs/{id}        remove slab
+//	POST   /ids/{address}     generate storage id, returned as raw bytes
+//	POST   /commit            apply batch of stores and removes atomically
+//	GET    /stats             segment count and size as JSON
+//
+// Storage IDs and addresses in paths are hex encoded raw bytes.
+package remote
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/onflow/atree"
+)
+
+const (
+	slabsPath  = "/slabs/"
+	idsPath    = "/ids/"
+	commitPath = "/commit"
+	statsPath  = "/stats"
+)
+
+// storageIDSize is size of raw storage ID.
+const storageIDSize = len(atree.Address{}) + len(atree.StorageIndex{})
+
+// batchEntry is a store (Data isn't nil) or remove (Data is nil) in commit batch.
+type batchEntry struct {
+	ID   string `json:"id"`
+	Data []byte `json:"data"`
+}
+
+type stats struct {
+	SegmentCounts int `json:"segmentCounts"`
+	Size          int `json:"size"`
+}
+
+func encodeStorageID(id atree.StorageID) string {
+	var b [storageIDSize]byte
+	_, _ = id.ToRawBytes(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func decodeStorageID(s string) (atree.StorageID, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return atree.StorageIDUndefined, err
+	}
+	if len(b) != storageIDSize {
+		return atree.StorageIDUndefined, fmt.Errorf("storage id has %d bytes, want %d", len(b), storageIDSize)
+	}
+	return atree.NewStorageIDFromRawBytes(b)
+}
+
+func decodeAddress(s string) (atree.Address, error) {
+	var address atree.Address
+
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return address, err
+	}
+	if len(b) != len(address) {
+		return address, fmt.Errorf("address has %d bytes, want %d", len(b), len(address))
+	}
+
+	copy(address[:], b)
+	return address, nil
+}
+
+func encodeAddress(address atree.Address) string {
+	return hex.EncodeToString(address[:])
+}
@@ -0,0 +1,277 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/values"
+	"github.com/stretchr/testify/require"
+)
+
+type testTypeInfo struct {
+	value uint64
+}
+
+var _ atree.TypeInfo = testTypeInfo{}
+
+func (i testTypeInfo) Encode(enc *cbor.StreamEncoder) error {
+	return enc.EncodeUint64(i.value)
+}
+
+func decodeTypeInfo(dec *cbor.StreamDecoder) (atree.TypeInfo, error) {
+	value, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+	return testTypeInfo{value: value}, nil
+}
+
+// memBaseStorage is a minimal in-memory BaseStorage served by test server.
+// It embeds Client only to reuse its usage reporter methods.
+type memBaseStorage struct {
+	*Client
+	segments     map[atree.StorageID][]byte
+	storageIndex map[atree.Address]atree.StorageIndex
+	// failID is storage ID that fails to be stored.
+	failID atree.StorageID
+}
+
+func newMemBaseStorage() *memBaseStorage {
+	return &memBaseStorage{
+		Client:       NewClient("", nil),
+		segments:     make(map[atree.StorageID][]byte),
+		storageIndex: make(map[atree.Address]atree.StorageIndex),
+	}
+}
+
+func (s *memBaseStorage) Retrieve(id atree.StorageID) ([]byte, bool, error) {
+	data, ok := s.segments[id]
+	return data, ok, nil
+}
+
+func (s *memBaseStorage) Store(id atree.StorageID, data []byte) error {
+	if id == s.failID {
+		return errors.New("store failed")
+	}
+	s.segments[id] = data
+	return nil
+}
+
+func (s *memBaseStorage) Remove(id atree.StorageID) error {
+	delete(s.segments, id)
+	return nil
+}
+
+func (s *memBaseStorage) GenerateStorageID(address atree.Address) (atree.StorageID, error) {
+	index := s.storageIndex[address].Next()
+	s.storageIndex[address] = index
+	return atree.NewStorageID(address, index), nil
+}
+
+func (s *memBaseStorage) SegmentCounts() int {
+	return len(s.segments)
+}
+
+func (s *memBaseStorage) Size() int {
+	size := 0
+	for _, data := range s.segments {
+		size += len(data)
+	}
+	return size
+}
+
+func newTestStorage(t *testing.T, baseURL string) (*atree.PersistentSlabStorage, *Client) {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	client := NewClient(baseURL, nil)
+
+	storage := atree.NewPersistentSlabStorage(client, encMode, decMode, values.DecodeStorable, decodeTypeInfo)
+	return storage, client
+}
+
+func TestRemoteStorage(t *testing.T) {
+
+	atree.SetThreshold(256)
+	defer atree.SetThreshold(1024)
+
+	const arraySize = 1024
+
+	base := newMemBaseStorage()
+	server := httptest.NewServer(NewServer(base))
+	defer server.Close()
+
+	typeInfo := testTypeInfo{42}
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage, client := newTestStorage(t, server.URL)
+
+	array, err := atree.NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(values.Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Changes are buffered by client until client commit.
+	require.True(t, client.PendingCount() > 1)
+	require.Equal(t, 0, len(base.segments))
+	require.Equal(t, 0, client.SegmentCounts())
+
+	err = client.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 0, client.PendingCount())
+	require.Equal(t, len(base.segments), client.SegmentCounts())
+	require.True(t, client.Size() > 0)
+	require.Equal(t, base.Size(), client.Size())
+
+	// Load array with new storage using the same server.
+	storage2, client2 := newTestStorage(t, server.URL)
+
+	array2, err := atree.NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(arraySize), array2.Count())
+
+	for i := uint64(0); i < arraySize; i++ {
+		s, err := array2.Get(i)
+		require.NoError(t, err)
+		require.Equal(t, values.Uint64Value(i), s)
+	}
+
+	require.True(t, client2.BytesRetrieved() > 0)
+	require.Equal(t, client.SegmentCounts(), client2.SegmentsReturned())
+
+	// Remove all elements and commit removed slabs.
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array2.Remove(0)
+		require.NoError(t, err)
+	}
+
+	err = storage2.Commit()
+	require.NoError(t, err)
+
+	err = client2.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(base.segments))
+
+	// Storage IDs are generated by the server.
+	id, err := client2.GenerateStorageID(address)
+	require.NoError(t, err)
+	require.Equal(t, address, id.Address)
+	require.Equal(t, base.storageIndex[address], id.Index)
+}
+
+func TestRemoteStorageNotFound(t *testing.T) {
+	server := httptest.NewServer(NewServer(newMemBaseStorage()))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+
+	id := atree.NewStorageID(atree.Address{1}, atree.StorageIndex{1})
+
+	data, found, err := client.Retrieve(id)
+	require.NoError(t, err)
+	require.False(t, found)
+	require.Nil(t, data)
+
+	// Buffered stores and removes are visible before commit.
+	err = client.Store(id, []byte{1, 2, 3})
+	require.NoError(t, err)
+
+	data, found, err = client.Retrieve(id)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, []byte{1, 2, 3}, data)
+
+	err = client.Remove(id)
+	require.NoError(t, err)
+
+	_, found, err = client.Retrieve(id)
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestClientCompliance(t *testing.T) {
+	server := httptest.NewServer(NewServer(newMemBaseStorage()))
+	defer server.Close()
+
+	err := atree.TestBaseStorageCompliance(NewClient(server.URL, nil))
+	require.NoError(t, err)
+}
+
+func TestServerCommitFailure(t *testing.T) {
+	base := newMemBaseStorage()
+	server := httptest.NewServer(NewServer(base))
+	defer server.Close()
+
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+	id1 := atree.NewStorageID(address, atree.StorageIndex{0, 0, 0, 0, 0, 0, 0, 1})
+	id2 := atree.NewStorageID(address, atree.StorageIndex{0, 0, 0, 0, 0, 0, 0, 2})
+	id3 := atree.NewStorageID(address, atree.StorageIndex{0, 0, 0, 0, 0, 0, 0, 3})
+
+	base.segments[id1] = []byte{1}
+	base.segments[id2] = []byte{2}
+
+	client := NewClient(server.URL, nil)
+
+	// Batch failing on the last entry is reverted.
+	require.NoError(t, client.Store(id1, []byte{10}))
+	require.NoError(t, client.Remove(id2))
+	require.NoError(t, client.Store(id3, []byte{30}))
+
+	base.failID = id3
+
+	err := client.Commit()
+	require.Error(t, err)
+	require.Equal(t, map[atree.StorageID][]byte{
+		id1: {1},
+		id2: {2},
+	}, base.segments)
+
+	t.Run("max request size", func(t *testing.T) {
+		base := newMemBaseStorage()
+		s := NewServer(base)
+		s.MaxRequestSize = 16
+
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		client := NewClient(server.URL, nil)
+
+		require.NoError(t, client.Store(id1, make([]byte, 32)))
+
+		err := client.Commit()
+		require.Error(t, err)
+		require.Equal(t, 0, len(base.segments))
+	})
+}
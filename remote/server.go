@@ -0,0 +1,259 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/onflow/atree"
+)
+
+// DefaultMaxRequestSize is default limit of request body size accepted by Server.
+const DefaultMaxRequestSize = 64 * 1024 * 1024
+
+// Server serves a BaseStorage over HTTP.  Storage operations are
+// serialized, so the BaseStorage doesn't need to be safe for
+// concurrent use.  Request bodies are read and decoded before
+// storage is locked, so slow clients don't block other requests.
+type Server struct {
+	// MaxRequestSize is limit of request body size in bytes.
+	// Larger requests are rejected with 413 Request Entity Too Large.
+	MaxRequestSize int64
+
+	mu      sync.Mutex
+	storage atree.BaseStorage
+}
+
+var _ http.Handler = &Server{}
+
+// NewServer returns Server serving storage.
+func NewServer(storage atree.BaseStorage) *Server {
+	return &Server{
+		MaxRequestSize: DefaultMaxRequestSize,
+		storage:        storage,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, slabsPath):
+		s.serveSlab(w, r)
+	case strings.HasPrefix(r.URL.Path, idsPath) && r.Method == http.MethodPost:
+		s.serveGenerateStorageID(w, r)
+	case r.URL.Path == commitPath && r.Method == http.MethodPost:
+		s.serveCommit(w, r)
+	case r.URL.Path == statsPath && r.Method == http.MethodGet:
+		s.serveStats(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// readBody reads request body limited to MaxRequestSize.
+// It writes error response and returns false if body can't be read.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, s.MaxRequestSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if int64(len(data)) > s.MaxRequestSize {
+		http.Error(w, fmt.Sprintf("request body exceeds %d bytes", s.MaxRequestSize), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *Server) serveSlab(w http.ResponseWriter, r *http.Request) {
+	id, err := decodeStorageID(strings.TrimPrefix(r.URL.Path, slabsPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		data, found, err := s.storage.Retrieve(id)
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+
+	case http.MethodPut:
+		data, ok := s.readBody(w, r)
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		err = s.storage.Store(id, data)
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		s.mu.Lock()
+		err = s.storage.Remove(id)
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) serveGenerateStorageID(w http.ResponseWriter, r *http.Request) {
+	address, err := decodeAddress(strings.TrimPrefix(r.URL.Path, idsPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	id, err := s.storage.GenerateStorageID(address)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = w.Write([]byte(encodeStorageID(id)))
+}
+
+// commitEntry is decoded batchEntry.
+type commitEntry struct {
+	id   atree.StorageID
+	data []byte
+}
+
+func (s *Server) serveCommit(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var batch []batchEntry
+	err := json.Unmarshal(body, &batch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Decode and validate the whole batch before applying it
+	entries := make([]commitEntry, len(batch))
+	for i, entry := range batch {
+		id, err := decodeStorageID(entry.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries[i] = commitEntry{id: id, data: entry.Data}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.applyBatch(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyBatch applies entries to storage.  If storage fails to apply
+// an entry, entries applied so far are reverted to previous data.
+func (s *Server) applyBatch(entries []commitEntry) error {
+	previous := make([]commitEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		data, found, err := s.storage.Retrieve(entry.id)
+		if err != nil {
+			return s.revertBatch(previous, err)
+		}
+		if !found {
+			data = nil
+		}
+
+		if entry.data == nil {
+			err = s.storage.Remove(entry.id)
+		} else {
+			err = s.storage.Store(entry.id, entry.data)
+		}
+		if err != nil {
+			return s.revertBatch(previous, err)
+		}
+
+		previous = append(previous, commitEntry{id: entry.id, data: data})
+	}
+
+	return nil
+}
+
+// revertBatch restores previous data of applied entries in reverse order
+// and returns err.
+func (s *Server) revertBatch(previous []commitEntry, err error) error {
+	for i := len(previous) - 1; i >= 0; i-- {
+		entry := previous[i]
+
+		var revertErr error
+		if entry.data == nil {
+			revertErr = s.storage.Remove(entry.id)
+		} else {
+			revertErr = s.storage.Store(entry.id, entry.data)
+		}
+		if revertErr != nil {
+			return fmt.Errorf("%w (failed to revert batch: %s)", err, revertErr)
+		}
+	}
+	return err
+}
+
+func (s *Server) serveStats(w http.ResponseWriter) {
+	s.mu.Lock()
+	st := stats{
+		SegmentCounts: s.storage.SegmentCounts(),
+		Size:          s.storage.Size(),
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
@@ -0,0 +1,91 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// RemoveAndRelease removes element at index and returns it as Value.
+// Unlike Remove, it releases slabs owned by removed element: external
+// element slabs are removed after element is decoded, and nested
+// collections are removed with everything reachable from them (shared
+// collections only drop a reference).  Returned nested collections
+// can't be used after removal.  If journal is enabled, removed element
+// is kept for Undo and nothing is released.
+func (a *Array) RemoveAndRelease(index uint64) (Value, error) {
+	storable, err := a.Remove(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.journal != nil {
+		return storable.StoredValue(a.Storage)
+	}
+
+	return releaseRemovedStorable(a.Storage, storable)
+}
+
+// RemoveAndRelease removes key from map and returns removed key and
+// value as Values, releasing slabs they own the same way as
+// Array.RemoveAndRelease.  If journal is enabled, removed value is kept
+// for Undo and only key is released, since Undo stores key again.
+func (m *OrderedMap) RemoveAndRelease(comparator ValueComparator, hip HashInputProvider, key Value) (Value, Value, error) {
+	keyStorable, valueStorable, err := m.Remove(comparator, hip, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	removedKey, err := releaseRemovedStorable(m.Storage, keyStorable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.journal != nil {
+		removedValue, err := valueStorable.StoredValue(m.Storage)
+		if err != nil {
+			return nil, nil, err
+		}
+		return removedKey, removedValue, nil
+	}
+
+	removedValue, err := releaseRemovedStorable(m.Storage, valueStorable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return removedKey, removedValue, nil
+}
+
+// releaseRemovedStorable decodes storable removed from a collection and
+// removes slabs reachable from it.
+func releaseRemovedStorable(storage SlabStorage, storable Storable) (Value, error) {
+	value, err := storable.StoredValue(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := appendChildSlabIDs(nil, []Storable{storable})
+	if len(ids) == 0 {
+		return value, nil
+	}
+
+	_, err = NewDeepRemover(storage, ids).Step(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
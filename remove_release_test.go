@@ -0,0 +1,214 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayRemoveAndRelease(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	large := NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))
+
+	const arraySize = 64
+	for i := uint64(0); i < arraySize; i++ {
+		switch i % 3 {
+		case 0:
+			err = array.Append(Uint64Value(i))
+		case 1:
+			err = array.Append(large)
+		case 2:
+			nested, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			err = nested.Append(large)
+			require.NoError(t, err)
+			err = array.Append(nested)
+		}
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+	require.True(t, len(baseStorage.segments) > 1)
+
+	for i := uint64(0); i < arraySize; i++ {
+		v, err := array.RemoveAndRelease(0)
+		require.NoError(t, err)
+
+		switch i % 3 {
+		case 0:
+			require.Equal(t, Uint64Value(i), v)
+		case 1:
+			require.Equal(t, large, v)
+		case 2:
+			_, ok := v.(*Array)
+			require.True(t, ok)
+		}
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Only empty root slab is left.
+	require.Equal(t, 1, len(baseStorage.segments))
+	verifyArray(t, storage, typeInfo, address, array, nil, false)
+}
+
+func TestMapRemoveAndRelease(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	largeKey := NewStringValue(strings.Repeat("k", int(MaxInlineMapKeyOrValueSize)))
+	largeValue := NewStringValue(strings.Repeat("v", int(MaxInlineMapKeyOrValueSize)))
+
+	_, err = m.Set(compare, hashInputProvider, largeKey, largeValue)
+	require.NoError(t, err)
+
+	nested, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	err = nested.Append(largeValue)
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), nested)
+	require.NoError(t, err)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+	require.True(t, len(baseStorage.segments) > 1)
+
+	k, v, err := m.RemoveAndRelease(compare, hashInputProvider, largeKey)
+	require.NoError(t, err)
+	require.Equal(t, largeKey, k)
+	require.Equal(t, largeValue, v)
+
+	k, v, err = m.RemoveAndRelease(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(1), k)
+	_, ok := v.(*Array)
+	require.True(t, ok)
+
+	_, _, err = m.RemoveAndRelease(compare, hashInputProvider, Uint64Value(1))
+	require.Error(t, err)
+
+	var keyNotFoundError *KeyNotFoundError
+	require.ErrorAs(t, err, &keyNotFoundError)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(baseStorage.segments))
+	require.Equal(t, uint64(0), m.Count())
+}
+
+func TestRemoveAndReleaseWithJournal(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	large := NewStringValue(strings.Repeat("a", int(MaxInlineArrayElementSize)))
+
+	t.Run("array", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		nested, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		err = nested.Append(large)
+		require.NoError(t, err)
+
+		err = array.Append(large)
+		require.NoError(t, err)
+		err = array.Append(nested)
+		require.NoError(t, err)
+
+		array.EnableJournal()
+
+		for i := 0; i < 2; i++ {
+			_, err := array.RemoveAndRelease(0)
+			require.NoError(t, err)
+		}
+		require.Equal(t, uint64(0), array.Count())
+
+		// Removed elements are kept for Undo.
+		count, err := array.Undo(2)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		values := arrayElements(t, array)
+		require.Equal(t, 2, len(values))
+		require.Equal(t, large, values[0])
+
+		restored, ok := values[1].(*Array)
+		require.True(t, ok)
+		require.Equal(t, nested.StorageID(), restored.StorageID())
+		require.Equal(t, []Value{large}, arrayElements(t, restored))
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		_, err = m.Set(compare, hashInputProvider, large, large)
+		require.NoError(t, err)
+
+		m.EnableJournal()
+
+		k, v, err := m.RemoveAndRelease(compare, hashInputProvider, large)
+		require.NoError(t, err)
+		require.Equal(t, large, k)
+		require.Equal(t, large, v)
+
+		// Removed value is kept for Undo, and key is stored again.
+		count, err := m.Undo(compare, hashInputProvider, 1)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		storable, err := m.Get(compare, hashInputProvider, large)
+		require.NoError(t, err)
+		v, err = storable.StoredValue(storage)
+		require.NoError(t, err)
+		require.Equal(t, large, v)
+
+		_, err = CheckStorageHealth(storage, 1)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,310 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// rootRegistryIndex is storage index of root registry slab of each
+// address.  It is the last storage index, so it isn't reached by
+// generated storage indexes.
+var rootRegistryIndex = StorageIndex{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// RootRegistryID returns storage ID of root registry slab of address.
+func RootRegistryID(address Address) StorageID {
+	return NewStorageID(address, rootRegistryIndex)
+}
+
+// WithRootRegistry records root slabs of arrays and maps in root registry
+// slab of their address, so that they can be listed with Roots instead of
+// being tracked by application.  Root is recorded when collection root
+// slab is stored, and is dropped when collection root slab is removed.
+//
+// Root registry slab is a root slab itself, so it must be kept by
+// Vacuum, with ID returned by RootRegistryID.
+func WithRootRegistry() StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.rootRegistry = true
+		return st
+	}
+}
+
+// Roots returns sorted IDs of root slabs of arrays and maps owned by
+// address, as recorded by root registry.
+func (s *PersistentSlabStorage) Roots(address Address) ([]StorageID, error) {
+	slab, err := s.rootRegistrySlab(address, false)
+	if err != nil || slab == nil {
+		return nil, err
+	}
+
+	roots := make([]StorageID, len(slab.indexes))
+	for i, index := range slab.indexes {
+		var storageIndex StorageIndex
+		putUintBigEndian(storageIndex[:], index)
+		roots[i] = NewStorageID(address, storageIndex)
+	}
+	return roots, nil
+}
+
+// registerRoot records id in root registry if slab is collection root.
+func (s *PersistentSlabStorage) registerRoot(id StorageID, slab Slab) error {
+	if !isCollectionRoot(slab) {
+		return nil
+	}
+
+	registry, err := s.rootRegistrySlab(id.Address, true)
+	if err != nil {
+		return err
+	}
+
+	if !registry.insert(id.IndexAsUint64()) {
+		return nil
+	}
+
+	s.deltas[registry.id] = registry
+	return nil
+}
+
+// unregisterRoot drops id from root registry if it is recorded.
+func (s *PersistentSlabStorage) unregisterRoot(id StorageID) error {
+	if id.Index == rootRegistryIndex {
+		return nil
+	}
+
+	registry, err := s.rootRegistrySlab(id.Address, false)
+	if err != nil || registry == nil {
+		return err
+	}
+
+	if !registry.remove(id.IndexAsUint64()) {
+		return nil
+	}
+
+	s.deltas[registry.id] = registry
+	return nil
+}
+
+// rootRegistrySlab returns root registry slab of address.  If registry
+// slab doesn't exist, a new slab is returned if create is true, and nil
+// otherwise.  New slab isn't stored.
+func (s *PersistentSlabStorage) rootRegistrySlab(address Address, create bool) (*RootRegistrySlab, error) {
+	id := RootRegistryID(address)
+
+	slab, found, err := s.Retrieve(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		if !create {
+			return nil, nil
+		}
+		return &RootRegistrySlab{id: id}, nil
+	}
+
+	registry, ok := slab.(*RootRegistrySlab)
+	if !ok {
+		return nil, NewSlabDataErrorf("slab %s isn't RootRegistrySlab", id)
+	}
+	return registry, nil
+}
+
+func isCollectionRoot(slab Slab) bool {
+	switch slab := slab.(type) {
+	case ArraySlab:
+		return slab.ExtraData() != nil
+	case MapSlab:
+		return slab.ExtraData() != nil
+	default:
+		return false
+	}
+}
+
+// version (1 byte) + flag (1 byte) + CBOR array head (9 bytes)
+const rootRegistrySlabPrefixSize = versionAndFlagSize + 9
+
+// RootRegistrySlab records root slabs of collections owned by an address.
+type RootRegistrySlab struct {
+	id StorageID
+	// indexes are sorted storage indexes of root slabs.
+	indexes []uint64
+}
+
+var _ Slab = &RootRegistrySlab{}
+
+func newRootRegistrySlabFromData(
+	id StorageID,
+	data []byte,
+	decMode cbor.DecMode,
+) (
+	*RootRegistrySlab,
+	error,
+) {
+	// Check data length
+	if len(data) < versionAndFlagSize {
+		return nil, NewDecodingErrorf("data is too short for root registry slab")
+	}
+
+	// Check flag
+	flag := data[1]
+	if getSlabRegistryType(flag) != slabRegistryRoot {
+		return nil, NewDecodingErrorf("data has invalid flag 0x%x, want 0x%x", flag, maskRootRegistry)
+	}
+
+	dec := decMode.NewByteStreamDecoder(data[versionAndFlagSize:])
+
+	count, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, NewDecodingError(err)
+	}
+
+	// Each index is encoded in at least 1 byte.
+	if count > uint64(len(data)) {
+		return nil, NewDecodingErrorf("root registry has %d roots, data has %d bytes", count, len(data))
+	}
+
+	indexes := make([]uint64, count)
+	for i := range indexes {
+		indexes[i], err = dec.DecodeUint64()
+		if err != nil {
+			return nil, NewDecodingError(err)
+		}
+		if i > 0 && indexes[i] <= indexes[i-1] {
+			return nil, NewDecodingErrorf("root registry indexes aren't sorted")
+		}
+	}
+
+	return &RootRegistrySlab{
+		id:      id,
+		indexes: indexes,
+	}, nil
+}
+
+// Encode encodes RootRegistrySlab to the given encoder.
+//
+// Header (2 bytes):
+//
+//	+-----------------------+-----------------------+
+//	| slab version (1 byte) | slab flag (1 byte)    |
+//	+-----------------------+-----------------------+
+//
+// Content:
+//
+//	CBOR encoded array of sorted storage indexes of root slabs
+func (s *RootRegistrySlab) Encode(enc *Encoder) error {
+	// Encode version
+	enc.Scratch[0] = 0
+
+	// Encode flag
+	flag := maskRootRegistry
+	flag = setNoSizeLimit(flag)
+	flag = setRoot(flag)
+
+	enc.Scratch[1] = flag
+
+	_, err := enc.Write(enc.Scratch[:versionAndFlagSize])
+	if err != nil {
+		return NewEncodingError(err)
+	}
+
+	err = enc.CBOR.EncodeArrayHead(uint64(len(s.indexes)))
+	if err != nil {
+		return NewEncodingError(err)
+	}
+
+	for _, index := range s.indexes {
+		err = enc.CBOR.EncodeUint64(index)
+		if err != nil {
+			return NewEncodingError(err)
+		}
+	}
+
+	err = enc.CBOR.Flush()
+	if err != nil {
+		return NewEncodingError(err)
+	}
+
+	return nil
+}
+
+// insert adds index and returns true if it isn't recorded yet.
+func (s *RootRegistrySlab) insert(index uint64) bool {
+	i := sort.Search(len(s.indexes), func(i int) bool { return s.indexes[i] >= index })
+	if i < len(s.indexes) && s.indexes[i] == index {
+		return false
+	}
+	s.indexes = append(s.indexes, 0)
+	copy(s.indexes[i+1:], s.indexes[i:])
+	s.indexes[i] = index
+	return true
+}
+
+// remove drops index and returns true if it was recorded.
+func (s *RootRegistrySlab) remove(index uint64) bool {
+	i := sort.Search(len(s.indexes), func(i int) bool { return s.indexes[i] >= index })
+	if i == len(s.indexes) || s.indexes[i] != index {
+		return false
+	}
+	s.indexes = append(s.indexes[:i], s.indexes[i+1:]...)
+	return true
+}
+
+func (s *RootRegistrySlab) ByteSize() uint32 {
+	size := uint32(rootRegistrySlabPrefixSize)
+	for _, index := range s.indexes {
+		size += GetUintCBORSize(index)
+	}
+	return size
+}
+
+func (s *RootRegistrySlab) ID() StorageID {
+	return s.id
+}
+
+func (s *RootRegistrySlab) ChildStorables() []Storable {
+	return nil
+}
+
+func (s *RootRegistrySlab) StoredValue(_ SlabStorage) (Value, error) {
+	return nil, NewUserError(NewNotValueError(s.id))
+}
+
+func (*RootRegistrySlab) Split(_ SlabStorage) (Slab, Slab, error) {
+	return nil, nil, NewNotApplicableError("RootRegistrySlab", "Slab", "Split")
+}
+
+func (*RootRegistrySlab) Merge(_ Slab) error {
+	return NewNotApplicableError("RootRegistrySlab", "Slab", "Merge")
+}
+
+func (*RootRegistrySlab) LendToRight(_ Slab) error {
+	return NewNotApplicableError("RootRegistrySlab", "Slab", "LendToRight")
+}
+
+func (*RootRegistrySlab) BorrowFromRight(_ Slab) error {
+	return NewNotApplicableError("RootRegistrySlab", "Slab", "BorrowFromRight")
+}
+
+func (s *RootRegistrySlab) String() string {
+	return fmt.Sprintf("RootRegistrySlab id:%s count:%d", s.id, len(s.indexes))
+}
@@ -0,0 +1,122 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootRegistry(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	otherAddress := Address{8, 7, 6, 5, 4, 3, 2, 1}
+
+	t.Run("disabled", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		_, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		roots, err := storage.Roots(address)
+		require.NoError(t, err)
+		require.Nil(t, roots)
+	})
+
+	t.Run("create and remove", func(t *testing.T) {
+		storage := newTestPersistentStorage(t, WithRootRegistry())
+
+		array, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+
+		m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+		require.NoError(t, err)
+
+		// Nested collections have their own roots.
+		var children []StorageID
+		for i := uint64(0); i < 10; i++ {
+			child, err := NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			for j := uint64(0); j < 100; j++ {
+				require.NoError(t, child.Append(Uint64Value(j)))
+			}
+			_, err = m.Set(compare, hashInputProvider, Uint64Value(i), child)
+			require.NoError(t, err)
+			children = append(children, child.StorageID())
+		}
+
+		// Root slab splits don't record non-root slabs.
+		for i := uint64(0); i < 1000; i++ {
+			require.NoError(t, array.Append(Uint64Value(i)))
+		}
+		require.False(t, array.root.IsData())
+
+		other, err := NewArray(storage, otherAddress, typeInfo)
+		require.NoError(t, err)
+
+		want := append([]StorageID{array.StorageID(), m.StorageID()}, children...)
+
+		roots, err := storage.Roots(address)
+		require.NoError(t, err)
+		require.Equal(t, want, roots)
+
+		roots, err = storage.Roots(otherAddress)
+		require.NoError(t, err)
+		require.Equal(t, []StorageID{other.StorageID()}, roots)
+
+		require.NoError(t, storage.Commit())
+
+		// Registry is persisted.
+		reloadedStorage := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage, WithRootRegistry())
+
+		roots, err = reloadedStorage.Roots(address)
+		require.NoError(t, err)
+		require.Equal(t, want, roots)
+
+		// Registry slab is a root slab without children.
+		healthRoots, err := CheckStorageHealth(storage, -1)
+		require.NoError(t, err)
+		require.Contains(t, healthRoots, RootRegistryID(address))
+
+		// Removing collection drops its roots.
+		reloadedMap, err := NewMapWithRootID(reloadedStorage, m.StorageID(), NewDefaultDigesterBuilder())
+		require.NoError(t, err)
+
+		remover, err := reloadedMap.DeepRemove(0, nil)
+		require.NoError(t, err)
+		require.Nil(t, remover)
+
+		roots, err = reloadedStorage.Roots(address)
+		require.NoError(t, err)
+		require.Equal(t, []StorageID{array.StorageID()}, roots)
+
+		require.NoError(t, reloadedStorage.Commit())
+
+		reloadedStorage = newTestPersistentStorageWithBaseStorage(t, storage.baseStorage, WithRootRegistry())
+
+		roots, err = reloadedStorage.Roots(address)
+		require.NoError(t, err)
+		require.Equal(t, []StorageID{array.StorageID()}, roots)
+	})
+}
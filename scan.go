@@ -0,0 +1,238 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "sync/atomic"
+
+// SlabPredicate reports whether slab with id may contain matching
+// elements.  Scan skips slabs for which it returns false, including
+// their child slabs, without retrieving them.  It can be used with
+// per-slab summaries maintained by caller.
+type SlabPredicate func(id StorageID) (bool, error)
+
+// ArrayScanPredicates are predicates of Array.Scan.  Nil predicates
+// match everything.
+type ArrayScanPredicates struct {
+	// Slab is evaluated before slab is retrieved.
+	Slab SlabPredicate
+	// Storable is evaluated before element is decoded.
+	Storable StorablePredicate
+	// Value is evaluated with decoded element.
+	Value func(element Value) (bool, error)
+}
+
+// Scan iterates array elements matching predicates in order,
+// passing index and value of each matching element to fn.
+func (a *Array) Scan(predicates ArrayScanPredicates, fn ArrayIndexedIterationFunc) error {
+
+	storage := a.beginOperation()
+	defer a.endOperation(storage, OperationIterate)
+
+	atomic.AddUint64(&a.stats.Iterations, 1)
+
+	match, err := matchSlab(predicates.Slab, a.root.ID())
+	if err != nil || !match {
+		return err
+	}
+
+	_, err = a.scanSlab(storage, a.root, 0, predicates, fn)
+	return err
+}
+
+func (a *Array) scanSlab(
+	storage SlabStorage,
+	slab ArraySlab,
+	startIndex uint64,
+	predicates ArrayScanPredicates,
+	fn ArrayIndexedIterationFunc,
+) (resume bool, err error) {
+
+	if meta, ok := slab.(*ArrayMetaDataSlab); ok {
+		index := startIndex
+		for _, h := range meta.childrenHeaders {
+			match, err := matchSlab(predicates.Slab, h.id)
+			if err != nil {
+				return false, err
+			}
+			if match {
+				child, err := getArraySlab(storage, h.id)
+				if err != nil {
+					return false, err
+				}
+				resume, err := a.scanSlab(storage, child, index, predicates, fn)
+				if err != nil || !resume {
+					return resume, err
+				}
+			}
+			index += uint64(h.count)
+		}
+		return true, nil
+	}
+
+	for i, storable := range slab.(*ArrayDataSlab).elements {
+		if predicates.Storable != nil {
+			match, err := predicates.Storable(storable)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				continue
+			}
+		}
+
+		value, err := storable.StoredValue(a.Storage)
+		if err != nil {
+			return false, err
+		}
+
+		if predicates.Value != nil {
+			match, err := predicates.Value(value)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				continue
+			}
+		}
+
+		resume, err := fn(startIndex+uint64(i), value)
+		if err != nil || !resume {
+			return resume, err
+		}
+	}
+	return true, nil
+}
+
+// MapStorablePredicate reports whether map element storables match.
+type MapStorablePredicate func(key MapKey, value MapValue) (bool, error)
+
+// MapScanPredicates are predicates of OrderedMap.Scan.  Nil predicates
+// match everything.
+type MapScanPredicates struct {
+	// Slab is evaluated before slab is retrieved.
+	Slab SlabPredicate
+	// Storable is evaluated before element is decoded.
+	Storable MapStorablePredicate
+	// Value is evaluated with decoded element.
+	Value func(key Value, value Value) (bool, error)
+}
+
+// Scan iterates map elements matching predicates in iteration order,
+// passing key and value of each matching element to fn.
+func (m *OrderedMap) Scan(predicates MapScanPredicates, fn MapEntryIterationFunc) error {
+
+	storage := m.beginOperation()
+	defer m.endOperation(storage, OperationIterate)
+
+	atomic.AddUint64(&m.stats.Iterations, 1)
+
+	match, err := matchSlab(predicates.Slab, m.root.ID())
+	if err != nil || !match {
+		return err
+	}
+
+	_, err = m.scanSlab(storage, m.root, predicates, fn)
+	return err
+}
+
+func (m *OrderedMap) scanSlab(
+	storage SlabStorage,
+	slab MapSlab,
+	predicates MapScanPredicates,
+	fn MapEntryIterationFunc,
+) (resume bool, err error) {
+
+	if meta, ok := slab.(*MapMetaDataSlab); ok {
+		for _, h := range meta.childrenHeaders {
+			match, err := matchSlab(predicates.Slab, h.id)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				continue
+			}
+			child, err := getMapSlab(storage, h.id)
+			if err != nil {
+				return false, err
+			}
+			resume, err := m.scanSlab(storage, child, predicates, fn)
+			if err != nil || !resume {
+				return resume, err
+			}
+		}
+		return true, nil
+	}
+
+	iterator := &MapElementIterator{
+		storage:  storage,
+		elements: slab.(*MapDataSlab).elements,
+	}
+
+	for {
+		ks, vs, err := iterator.Next()
+		if err != nil {
+			return false, err
+		}
+		if ks == nil {
+			return true, nil
+		}
+
+		if predicates.Storable != nil {
+			match, err := predicates.Storable(ks, vs)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				continue
+			}
+		}
+
+		key, err := ks.StoredValue(m.Storage)
+		if err != nil {
+			return false, err
+		}
+
+		value, err := vs.StoredValue(m.Storage)
+		if err != nil {
+			return false, err
+		}
+
+		if predicates.Value != nil {
+			match, err := predicates.Value(key, value)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				continue
+			}
+		}
+
+		resume, err := fn(key, value)
+		if err != nil || !resume {
+			return resume, err
+		}
+	}
+}
+
+func matchSlab(predicate SlabPredicate, id StorageID) (bool, error) {
+	if predicate == nil {
+		return true, nil
+	}
+	return predicate(id)
+}
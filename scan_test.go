@@ -0,0 +1,179 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayScan(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 4096
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	t.Run("predicates", func(t *testing.T) {
+		predicates := ArrayScanPredicates{
+			Storable: func(s Storable) (bool, error) {
+				return uint64(s.(Uint64Value))%2 == 0, nil
+			},
+			Value: func(v Value) (bool, error) {
+				return uint64(v.(Uint64Value))%3 == 0, nil
+			},
+		}
+
+		var indexes []uint64
+		err := array.Scan(predicates, func(index uint64, v Value) (bool, error) {
+			require.Equal(t, Uint64Value(index), v)
+			indexes = append(indexes, index)
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, (arraySize+5)/6, len(indexes))
+		for _, index := range indexes {
+			require.Equal(t, uint64(0), index%6)
+		}
+	})
+
+	t.Run("skip slabs", func(t *testing.T) {
+		// Skip every other data slab.
+		dataSlabs := 0
+		skipped := make(map[StorageID]bool)
+		predicates := ArrayScanPredicates{
+			Slab: func(id StorageID) (bool, error) {
+				slab, found, err := storage.Retrieve(id)
+				require.NoError(t, err)
+				require.True(t, found)
+				if _, ok := slab.(*ArrayDataSlab); !ok {
+					return true, nil
+				}
+				dataSlabs++
+				if dataSlabs%2 == 0 {
+					skipped[id] = true
+					return false, nil
+				}
+				return true, nil
+			},
+		}
+
+		count := uint64(0)
+		err := array.Scan(predicates, func(index uint64, v Value) (bool, error) {
+			require.Equal(t, Uint64Value(index), v)
+			count++
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		require.True(t, len(skipped) > 0)
+
+		skippedCount := uint64(0)
+		for id := range skipped {
+			slab, _, err := storage.Retrieve(id)
+			require.NoError(t, err)
+			skippedCount += uint64(len(slab.(*ArrayDataSlab).elements))
+		}
+		require.Equal(t, uint64(arraySize), count+skippedCount)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		count := 0
+		err := array.Scan(ArrayScanPredicates{}, func(uint64, Value) (bool, error) {
+			count++
+			return count < 10, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 10, count)
+	})
+}
+
+func TestMapScan(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 2048
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+	storage := newTestPersistentStorage(t)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < mapSize; i++ {
+		_, err := m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i*10))
+		require.NoError(t, err)
+	}
+
+	t.Run("predicates", func(t *testing.T) {
+		predicates := MapScanPredicates{
+			Storable: func(k MapKey, _ MapValue) (bool, error) {
+				return uint64(k.(Uint64Value))%2 == 0, nil
+			},
+			Value: func(_ Value, v Value) (bool, error) {
+				return uint64(v.(Uint64Value))%3 == 0, nil
+			},
+		}
+
+		keys := make(map[uint64]bool)
+		err := m.Scan(predicates, func(k Value, v Value) (bool, error) {
+			require.Equal(t, k.(Uint64Value)*10, v)
+			keys[uint64(k.(Uint64Value))] = true
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, (mapSize+5)/6, len(keys))
+		for k := range keys {
+			require.Equal(t, uint64(0), k%6)
+		}
+	})
+
+	t.Run("skip slabs", func(t *testing.T) {
+		count := 0
+		err := m.Scan(
+			MapScanPredicates{
+				Slab: func(id StorageID) (bool, error) {
+					return id == m.StorageID(), nil
+				},
+			},
+			func(Value, Value) (bool, error) {
+				count++
+				return true, nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, 0, count)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "sync"
+
+// slabCache caches decoded slabs by storage ID.
+// nil slab is cached for slabs known not to exist.
+type slabCache interface {
+	Get(id StorageID) (Slab, bool)
+	Set(id StorageID, slab Slab)
+	Range(f func(id StorageID, slab Slab) bool)
+	// Clear removes all cached slabs.
+	Clear()
+}
+
+// syncSlabCache is a slabCache safe for concurrent use.
+// Lookups of cached slabs are lock-free, which suits
+// caches of clean slabs that are written once and read many
+// times by concurrent readers.
+//
+// It caches slabs of StorageSnapshot, which is the storage read by
+// concurrent readers.  PersistentSlabStorage isn't safe for concurrent
+// use, so its read cache is a plain map.
+type syncSlabCache struct {
+	m sync.Map
+}
+
+var _ slabCache = &syncSlabCache{}
+
+func newSyncSlabCache() *syncSlabCache {
+	return &syncSlabCache{}
+}
+
+func (c *syncSlabCache) Get(id StorageID) (Slab, bool) {
+	v, ok := c.m.Load(id)
+	if !ok {
+		return nil, false
+	}
+	if v == nil {
+		return nil, true
+	}
+	return v.(Slab), true
+}
+
+func (c *syncSlabCache) Set(id StorageID, slab Slab) {
+	if slab == nil {
+		// Store untyped nil so Get doesn't need to handle typed nil.
+		c.m.Store(id, nil)
+		return
+	}
+	c.m.Store(id, slab)
+}
+
+func (c *syncSlabCache) Range(f func(id StorageID, slab Slab) bool) {
+	c.m.Range(func(k, v interface{}) bool {
+		var slab Slab
+		if v != nil {
+			slab = v.(Slab)
+		}
+		return f(k.(StorageID), slab)
+	})
+}
+
+func (c *syncSlabCache) Clear() {
+	c.m.Range(func(k, _ interface{}) bool {
+		c.m.Delete(k)
+		return true
+	})
+}
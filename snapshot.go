@@ -0,0 +1,273 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// StorageSnapshot is a read-only view of PersistentSlabStorage
+// as of the time the snapshot was taken.
+//
+// Slabs that were dirty when the snapshot was taken are copied (encoded)
+// into the snapshot.  Clean slabs are read lazily from base storage, and
+// are copied into the snapshot before Commit overwrites or removes them.
+// This keeps the snapshot consistent while the primary storage continues
+// to be mutated and committed.
+//
+// Collections can be opened on a snapshot with NewArrayWithRootID and
+// NewMapWithRootID.  Slabs decoded by a snapshot are never shared with
+// the primary storage, so mutations of primary collections don't affect
+// snapshot collections.  Mutating a snapshot collection returns ReadOnlyError.
+//
+// Snapshot collections are safe for concurrent reads if base storage
+// Retrieve and storage DecodeStorable/DecodeTypeInfo are safe for
+// concurrent use.  Decoded slabs are cached in a lock-free cache so
+// concurrent readers don't contend on a mutex for every slab access.
+//
+// Snapshot covers the whole storage instead of a single collection, so
+// one snapshot can be used to read any number of collections as of the
+// same version.  Its cost doesn't depend on collections read from it:
+// slabs dirty when it is taken are encoded once, and committed slabs are
+// copied only when Commit is about to overwrite or remove them.
+//
+// Release must be called when the snapshot is no longer needed.
+// Release can be called while snapshot collections are read by other
+// goroutines.  Reads that don't complete before Release return
+// SnapshotReleasedError.
+type StorageSnapshot struct {
+	storage *PersistentSlabStorage
+	version uint64
+	// preserved contains encoded slabs ([]byte) as of snapshot version.
+	// nil data means slab doesn't exist in this snapshot.
+	preserved sync.Map
+	cache     slabCache
+	// released is set to 1 by Release.  It is accessed atomically.
+	released uint32
+}
+
+var _ SlabStorage = &StorageSnapshot{}
+
+// Snapshot returns a read-only snapshot of the storage, including uncommitted changes.
+func (s *PersistentSlabStorage) Snapshot() (*StorageSnapshot, error) {
+
+	snapshot := &StorageSnapshot{
+		storage: s,
+		cache:   newSyncSlabCache(),
+	}
+
+	for id, slab := range s.deltas {
+		if slab == nil {
+			snapshot.preserved.Store(id, []byte(nil))
+			continue
+		}
+
+		data, err := Encode(slab, s.cborEncMode)
+		if err != nil {
+			return nil, NewStorageError(err)
+		}
+
+		snapshot.preserved.Store(id, data)
+	}
+
+	s.snapshotsLock.Lock()
+	defer s.snapshotsLock.Unlock()
+
+	s.snapshotVersion++
+	snapshot.version = s.snapshotVersion
+
+	if s.snapshots == nil {
+		s.snapshots = make(map[*StorageSnapshot]struct{})
+	}
+	s.snapshots[snapshot] = struct{}{}
+
+	return snapshot, nil
+}
+
+// preserveForSnapshots copies committed data of given slabs to
+// live snapshots that haven't preserved them yet.  It must be
+// called before base storage is modified.
+func (s *PersistentSlabStorage) preserveForSnapshots(ids []StorageID) error {
+	s.snapshotsLock.Lock()
+	defer s.snapshotsLock.Unlock()
+
+	if len(s.snapshots) == 0 {
+		return nil
+	}
+
+	for _, id := range ids {
+
+		var data []byte
+		var retrieved bool
+
+		for snapshot := range s.snapshots {
+			if _, ok := snapshot.preserved.Load(id); ok {
+				continue
+			}
+
+			if !retrieved {
+				var err error
+				data, _, err = s.baseStorage.Retrieve(id)
+				if err != nil {
+					return NewStorageError(err)
+				}
+				retrieved = true
+			}
+
+			snapshot.preserved.LoadOrStore(id, data)
+		}
+	}
+
+	return nil
+}
+
+// Version returns snapshot version.  Snapshot versions increase
+// monotonically for snapshots taken from the same storage.
+func (s *StorageSnapshot) Version() uint64 {
+	return s.version
+}
+
+// Release releases resources held by the snapshot.
+// Released snapshot can't be used to retrieve slabs.  Release can be
+// called from any goroutine, including while storage is committed.
+func (s *StorageSnapshot) Release() {
+	if !atomic.CompareAndSwapUint32(&s.released, 0, 1) {
+		return
+	}
+
+	s.storage.snapshotsLock.Lock()
+	delete(s.storage.snapshots, s)
+	s.storage.snapshotsLock.Unlock()
+
+	s.preserved.Range(func(id, _ interface{}) bool {
+		s.preserved.Delete(id)
+		return true
+	})
+	s.cache.Clear()
+}
+
+func (s *StorageSnapshot) isReleased() bool {
+	return atomic.LoadUint32(&s.released) == 1
+}
+
+func (s *StorageSnapshot) Retrieve(id StorageID) (Slab, bool, error) {
+	if s.isReleased() {
+		return nil, false, NewSnapshotReleasedError(s.version)
+	}
+
+	if slab, ok := s.cache.Get(id); ok {
+		return slab, slab != nil, nil
+	}
+
+	data, err := s.retrieveData(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Release clears preserved slabs after it marks snapshot as released,
+	// so data read before snapshot is marked released is as of snapshot
+	// version.  Data read after that can be from base storage modified
+	// since snapshot was taken.
+	if s.isReleased() {
+		return nil, false, NewSnapshotReleasedError(s.version)
+	}
+
+	if data == nil {
+		s.cache.Set(id, nil)
+		return nil, false, nil
+	}
+
+	slab, err := DecodeSlab(id, data, s.storage.cborDecMode, s.storage.DecodeStorable, s.storage.DecodeTypeInfo)
+	if err != nil {
+		return nil, true, NewStorageError(err)
+	}
+
+	s.cache.Set(id, slab)
+
+	return slab, true, nil
+}
+
+// retrieveData returns encoded slab as of snapshot version.
+func (s *StorageSnapshot) retrieveData(id StorageID) ([]byte, error) {
+	if data, ok := s.preserved.Load(id); ok {
+		return data.([]byte), nil
+	}
+
+	data, _, err := s.storage.baseStorage.Retrieve(id)
+	if err != nil {
+		return nil, NewStorageError(err)
+	}
+
+	// Commit preserves committed data before modifying base storage,
+	// so check again in case base storage was modified after the first check.
+	if preserved, ok := s.preserved.Load(id); ok {
+		return preserved.([]byte), nil
+	}
+
+	return data, nil
+}
+
+func (s *StorageSnapshot) Store(id StorageID, _ Slab) error {
+	return NewReadOnlyError(id)
+}
+
+func (s *StorageSnapshot) Remove(id StorageID) error {
+	return NewReadOnlyError(id)
+}
+
+func (s *StorageSnapshot) GenerateStorageID(address Address) (StorageID, error) {
+	return StorageIDUndefined, NewReadOnlyError(NewStorageID(address, StorageIndexUndefined))
+}
+
+// DigesterKey returns secret digester key provided by snapshot storage.
+func (s *StorageSnapshot) DigesterKey(keyID uint64) ([]byte, error) {
+	return s.storage.DigesterKey(keyID)
+}
+
+// Count returns number of committed slabs in base storage.
+func (s *StorageSnapshot) Count() int {
+	return s.storage.baseStorage.SegmentCounts()
+}
+
+// SlabIterator iterates slabs retrieved by the snapshot so far.
+func (s *StorageSnapshot) SlabIterator() (SlabIterator, error) {
+	if s.isReleased() {
+		return nil, NewSnapshotReleasedError(s.version)
+	}
+
+	var slabs []Slab
+	s.cache.Range(func(_ StorageID, slab Slab) bool {
+		if slab != nil {
+			slabs = append(slabs, slab)
+		}
+		return true
+	})
+
+	var i int
+
+	return func() (StorageID, Slab) {
+		if i >= len(slabs) {
+			return StorageIDUndefined, nil
+		}
+		slab := slabs[i]
+		i++
+		return slab.ID(), slab
+	}, nil
+}
@@ -0,0 +1,442 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageSnapshotArray(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, arraySize)
+	for i := uint64(0); i < arraySize; i++ {
+		v := Uint64Value(i)
+		values[i] = v
+		err := array.Append(v)
+		require.NoError(t, err)
+	}
+
+	// Commit half of the changes so snapshot has both clean and dirty slabs.
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i += 2 {
+		v := Uint64Value(i * 10)
+		values[i] = v
+		_, err := array.Set(i, v)
+		require.NoError(t, err)
+	}
+
+	snapshot, err := storage.Snapshot()
+	require.NoError(t, err)
+	defer snapshot.Release()
+
+	require.Equal(t, uint64(1), snapshot.Version())
+
+	// Mutate and commit primary storage after snapshot is taken.
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array.Remove(0)
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(0), array.Count())
+
+	snapshotArray, err := NewArrayWithRootID(snapshot, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(arraySize), snapshotArray.Count())
+
+	i := 0
+	err = snapshotArray.Iterate(func(v Value) (bool, error) {
+		require.Equal(t, values[i], v)
+		i++
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, arraySize, i)
+
+	err = ValidArray(snapshotArray, typeInfo, typeInfoComparator, hashInputProvider)
+	require.NoError(t, err)
+
+	// Snapshot is read-only.
+	err = snapshotArray.Append(Uint64Value(0))
+	var readOnlyError *ReadOnlyError
+	require.ErrorAs(t, err, &readOnlyError)
+
+	// Snapshot can't be used after release.
+	snapshot.Release()
+
+	_, _, err = snapshot.Retrieve(array.StorageID())
+	var releasedError *SnapshotReleasedError
+	require.ErrorAs(t, err, &releasedError)
+}
+
+func TestStorageSnapshotMap(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const mapSize = 512
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	keyValues := make(map[Value]Value, mapSize)
+	for i := uint64(0); i < mapSize; i++ {
+		k := Uint64Value(i)
+		v := Uint64Value(i * 2)
+		keyValues[k] = v
+		existingStorable, err := m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	snapshot1, err := storage.Snapshot()
+	require.NoError(t, err)
+	defer snapshot1.Release()
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	for k := range keyValues {
+		_, _, err := m.Remove(compare, hashInputProvider, k)
+		require.NoError(t, err)
+	}
+
+	snapshot2, err := storage.Snapshot()
+	require.NoError(t, err)
+	defer snapshot2.Release()
+
+	require.True(t, snapshot2.Version() > snapshot1.Version())
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	m1, err := NewMapWithRootID(snapshot1, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, uint64(mapSize), m1.Count())
+
+	for k, v := range keyValues {
+		s, err := m1.Get(compare, hashInputProvider, k)
+		require.NoError(t, err)
+		require.Equal(t, v, s)
+	}
+
+	m2, err := NewMapWithRootID(snapshot2, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), m2.Count())
+}
+
+// lockedBaseStorage is a BaseStorage safe for concurrent use.
+type lockedBaseStorage struct {
+	mu sync.Mutex
+	*InMemBaseStorage
+}
+
+func (s *lockedBaseStorage) Retrieve(id StorageID) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.InMemBaseStorage.Retrieve(id)
+}
+
+func (s *lockedBaseStorage) Store(id StorageID, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.InMemBaseStorage.Store(id, data)
+}
+
+func (s *lockedBaseStorage) Remove(id StorageID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.InMemBaseStorage.Remove(id)
+}
+
+func TestStorageSnapshotConcurrentReads(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+	const readers = 8
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorageWithBaseStorage(t, &lockedBaseStorage{InMemBaseStorage: NewInMemBaseStorage()})
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	snapshot, err := storage.Snapshot()
+	require.NoError(t, err)
+	defer snapshot.Release()
+
+	snapshotArray, err := NewArrayWithRootID(snapshot, array.StorageID())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint64(0); i < arraySize; i++ {
+				s, err := snapshotArray.Get(i)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if s != Uint64Value(i) {
+					errs <- NewSlabDataErrorf("element %d is %s, want %d", i, s, i)
+					return
+				}
+			}
+		}()
+	}
+
+	// Mutate and commit primary storage while snapshot is read concurrently.
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array.Set(i, Uint64Value(arraySize+i))
+		require.NoError(t, err)
+	}
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestStorageSnapshotReleaseDuringReads(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 1024
+	const readers = 8
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorageWithBaseStorage(t, &lockedBaseStorage{InMemBaseStorage: NewInMemBaseStorage()})
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	snapshot, err := storage.Snapshot()
+	require.NoError(t, err)
+
+	snapshotArray, err := NewArrayWithRootID(snapshot, array.StorageID())
+	require.NoError(t, err)
+
+	// Modify committed slabs so reads after Release would see new data.
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array.Set(i, Uint64Value(arraySize+i))
+		require.NoError(t, err)
+	}
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint64(0); ; i = (i + 1) % arraySize {
+				s, err := snapshotArray.Get(i)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if s != Uint64Value(i) {
+					errs <- NewSlabDataErrorf("element %d is %s, want %d", i, s, i)
+					return
+				}
+			}
+		}()
+	}
+
+	snapshot.Release()
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		var releasedError *SnapshotReleasedError
+		require.ErrorAs(t, err, &releasedError)
+	}
+}
+
+// lockedSlabCache is a slabCache guarded by a read-write mutex.
+// It is the baseline syncSlabCache is benchmarked against.
+type lockedSlabCache struct {
+	mu sync.RWMutex
+	m  map[StorageID]Slab
+}
+
+var _ slabCache = &lockedSlabCache{}
+
+func newLockedSlabCache() *lockedSlabCache {
+	return &lockedSlabCache{m: make(map[StorageID]Slab)}
+}
+
+func (c *lockedSlabCache) Get(id StorageID) (Slab, bool) {
+	c.mu.RLock()
+	slab, ok := c.m[id]
+	c.mu.RUnlock()
+	return slab, ok
+}
+
+func (c *lockedSlabCache) Set(id StorageID, slab Slab) {
+	c.mu.Lock()
+	c.m[id] = slab
+	c.mu.Unlock()
+}
+
+func (c *lockedSlabCache) Range(f func(id StorageID, slab Slab) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for id, slab := range c.m {
+		if !f(id, slab) {
+			return
+		}
+	}
+}
+
+func (c *lockedSlabCache) Clear() {
+	c.mu.Lock()
+	c.m = make(map[StorageID]Slab)
+	c.mu.Unlock()
+}
+
+func benchmarkSlabCacheGet(b *testing.B, cache slabCache) {
+	const slabCount = 1024
+
+	ids := make([]StorageID, slabCount)
+	for i := range ids {
+		var index StorageIndex
+		index[7] = byte(i)
+		index[6] = byte(i >> 8)
+		ids[i] = NewStorageID(Address{1}, index)
+		cache.Set(ids[i], &ArrayDataSlab{header: ArraySlabHeader{id: ids[i]}})
+	}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, ok := cache.Get(ids[i%slabCount])
+			if !ok {
+				b.Fatal("slab not found")
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkSlabCacheGet(b *testing.B) {
+	b.Run("sync", func(b *testing.B) {
+		benchmarkSlabCacheGet(b, newSyncSlabCache())
+	})
+	b.Run("locked", func(b *testing.B) {
+		benchmarkSlabCacheGet(b, newLockedSlabCache())
+	})
+}
+
+func TestStorageSnapshotReleaseDuringCommit(t *testing.T) {
+
+	const snapshots = 16
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorageWithBaseStorage(t, &lockedBaseStorage{InMemBaseStorage: NewInMemBaseStorage()})
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, array.Append(Uint64Value(0)))
+	require.NoError(t, storage.Commit())
+
+	taken := make([]*StorageSnapshot, snapshots)
+	for i := range taken {
+		taken[i], err = storage.Snapshot()
+		require.NoError(t, err)
+	}
+
+	// Snapshots are released by other goroutines while storage is
+	// committed.
+	var wg sync.WaitGroup
+	for _, snapshot := range taken {
+		wg.Add(1)
+		go func(snapshot *StorageSnapshot) {
+			defer wg.Done()
+			snapshot.Release()
+		}(snapshot)
+	}
+
+	for i := uint64(0); i < snapshots; i++ {
+		_, err := array.Set(0, Uint64Value(i))
+		require.NoError(t, err)
+		require.NoError(t, storage.Commit())
+	}
+
+	wg.Wait()
+	require.Equal(t, 0, len(storage.snapshots))
+}
@@ -0,0 +1,240 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// testDriver is a minimal in-memory database/sql driver executing the
+// statements used by Storage, so tests don't depend on a SQLite driver.
+type testDriver struct {
+	mu        sync.Mutex
+	databases map[string]*testDatabase
+}
+
+type testDatabase struct {
+	mu     sync.Mutex
+	tables map[string]map[string][]byte
+	// failExec makes statements writing slabs fail.
+	failExec bool
+}
+
+var testSQLDriver = &testDriver{databases: make(map[string]*testDatabase)}
+
+func init() {
+	sql.Register("atree-sqlite-test", testSQLDriver)
+}
+
+// openTestDB opens database name, which is shared by all connections
+// opened with the same name.
+func openTestDB(name string) (*sql.DB, *testDatabase, error) {
+	db, err := sql.Open("atree-sqlite-test", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, testSQLDriver.database(name), nil
+}
+
+func (d *testDriver) database(name string) *testDatabase {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	db, ok := d.databases[name]
+	if !ok {
+		db = &testDatabase{
+			tables: map[string]map[string][]byte{
+				"slabs":           {},
+				"storage_indexes": {},
+			},
+		}
+		d.databases[name] = db
+	}
+	return db
+}
+
+func (d *testDriver) Open(name string) (driver.Conn, error) {
+	return &testConn{db: d.database(name)}, nil
+}
+
+type testConn struct {
+	db *testDatabase
+	// tx contains tables modified by transaction, if any.
+	tx map[string]map[string][]byte
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{conn: c, query: query}, nil
+}
+
+func (c *testConn) Close() error {
+	return nil
+}
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.tx = make(map[string]map[string][]byte, len(c.db.tables))
+	for name, table := range c.db.tables {
+		c.tx[name] = make(map[string][]byte, len(table))
+		for k, v := range table {
+			c.tx[name][k] = v
+		}
+	}
+	return c, nil
+}
+
+func (c *testConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.tables = c.tx
+	c.tx = nil
+	return nil
+}
+
+func (c *testConn) Rollback() error {
+	c.tx = nil
+	return nil
+}
+
+func (c *testConn) table(name string) map[string][]byte {
+	if c.tx != nil {
+		return c.tx[name]
+	}
+	return c.db.tables[name]
+}
+
+type testStmt struct {
+	conn  *testConn
+	query string
+}
+
+func (s *testStmt) Close() error {
+	return nil
+}
+
+func (s *testStmt) NumInput() int {
+	return -1
+}
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.db.mu.Lock()
+	defer s.conn.db.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+
+	case strings.HasPrefix(s.query, "INSERT OR REPLACE INTO slabs"):
+		if s.conn.db.failExec {
+			return nil, errors.New("exec failed")
+		}
+		s.conn.table("slabs")[string(args[0].([]byte))] = args[1].([]byte)
+
+	case strings.HasPrefix(s.query, "DELETE FROM slabs"):
+		if s.conn.db.failExec {
+			return nil, errors.New("exec failed")
+		}
+		delete(s.conn.table("slabs"), string(args[0].([]byte)))
+
+	case strings.HasPrefix(s.query, "INSERT OR REPLACE INTO storage_indexes"):
+		s.conn.table("storage_indexes")[string(args[0].([]byte))] = args[1].([]byte)
+
+	default:
+		return nil, fmt.Errorf("unsupported statement %q", s.query)
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.db.mu.Lock()
+	defer s.conn.db.mu.Unlock()
+
+	rows := &testRows{}
+
+	switch {
+	case strings.HasPrefix(s.query, "SELECT data FROM slabs"):
+		rows.columns = []string{"data"}
+		if data, ok := s.conn.table("slabs")[string(args[0].([]byte))]; ok {
+			rows.values = append(rows.values, []driver.Value{data})
+		}
+
+	case strings.HasPrefix(s.query, "SELECT id, data FROM slabs"):
+		rows.columns = []string{"id", "data"}
+		for _, arg := range args {
+			id := arg.([]byte)
+			if data, ok := s.conn.table("slabs")[string(id)]; ok {
+				rows.values = append(rows.values, []driver.Value{id, data})
+			}
+		}
+
+	case strings.HasPrefix(s.query, "SELECT storage_index FROM storage_indexes"):
+		rows.columns = []string{"storage_index"}
+		if index, ok := s.conn.table("storage_indexes")[string(args[0].([]byte))]; ok {
+			rows.values = append(rows.values, []driver.Value{index})
+		}
+
+	case strings.HasPrefix(s.query, "SELECT COUNT(*) FROM slabs"):
+		rows.columns = []string{"count"}
+		rows.values = append(rows.values, []driver.Value{int64(len(s.conn.table("slabs")))})
+
+	case strings.HasPrefix(s.query, "SELECT COALESCE(SUM(LENGTH(data)), 0) FROM slabs"):
+		size := 0
+		for _, data := range s.conn.table("slabs") {
+			size += len(data)
+		}
+		rows.columns = []string{"size"}
+		rows.values = append(rows.values, []driver.Value{int64(size)})
+
+	default:
+		return nil, fmt.Errorf("unsupported query %q", s.query)
+	}
+
+	return rows, nil
+}
+
+type testRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *testRows) Columns() []string {
+	return r.columns
+}
+
+func (r *testRows) Close() error {
+	return nil
+}
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,401 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sqlite provides atree.BaseStorage backed by a SQLite database,
+// so collections can be stored in a single file by desktop applications
+// and tools without a key-value store.
+//
+// Storage uses database/sql and doesn't import a SQLite driver.
+// Applications register a driver (e.g. github.com/mattn/go-sqlite3 or
+// modernc.org/sqlite) and pass opened database to New.  Schema:
+//
+//	slabs(id BLOB PRIMARY KEY, data BLOB NOT NULL)
+//	storage_indexes(address BLOB PRIMARY KEY, storage_index BLOB NOT NULL)
+//
+// Storage IDs, addresses, and storage indexes are stored as raw bytes.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/onflow/atree"
+)
+
+// storageIDSize is size of raw storage ID.
+const storageIDSize = len(atree.Address{}) + len(atree.StorageIndex{})
+
+// DefaultStorageIndexBlockSize is number of storage indexes reserved by
+// one database transaction of GenerateStorageID.
+const DefaultStorageIndexBlockSize = 256
+
+// maxQueryParams is max number of storage IDs queried by one statement
+// of RetrieveMany, below default SQLite limit of host parameters.
+const maxQueryParams = 500
+
+const schema = `
+CREATE TABLE IF NOT EXISTS slabs (
+	id BLOB PRIMARY KEY,
+	data BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS storage_indexes (
+	address BLOB PRIMARY KEY,
+	storage_index BLOB NOT NULL
+);`
+
+// Storage is a BaseStorage where each slab is a row of slabs table.
+//
+// Slabs are loaded lazily, one query per Retrieve, or in batches with
+// RetrieveMany.  Store and Remove are buffered by Storage and written
+// in one SQL transaction by Commit.  Retrieve returns buffered data
+// before querying the database.  Typical usage is to call Commit after
+// PersistentSlabStorage.Commit or FastCommit.
+type Storage struct {
+	db *sql.DB
+	// pending contains buffered stores and removes (nil data).
+	pending map[atree.StorageID][]byte
+	// indexBlocks contains storage indexes reserved for each address.
+	indexBlocks    map[atree.Address]*storageIndexBlock
+	indexBlockSize uint64
+
+	bytesRetrieved   int
+	bytesStored      int
+	segmentsReturned map[atree.StorageID]struct{}
+	segmentsUpdated  map[atree.StorageID]struct{}
+	segmentsTouched  map[atree.StorageID]struct{}
+}
+
+var _ atree.BaseStorage = &Storage{}
+
+// storageIndexBlock is range of storage indexes reserved in database and
+// not yet returned by GenerateStorageID.
+type storageIndexBlock struct {
+	last      atree.StorageIndex
+	remaining uint64
+}
+
+// New returns Storage using db, creating tables if they don't exist.
+// Storage indexes are reserved in blocks of DefaultStorageIndexBlockSize.
+func New(db *sql.DB) (*Storage, error) {
+	return NewWithStorageIndexBlockSize(db, DefaultStorageIndexBlockSize)
+}
+
+// NewWithStorageIndexBlockSize returns Storage using db, reserving
+// blockSize storage indexes of an address at a time.  Indexes reserved
+// but not used when Storage is discarded are skipped, so smaller blocks
+// leave smaller gaps at cost of more database transactions.
+func NewWithStorageIndexBlockSize(db *sql.DB, blockSize uint64) (*Storage, error) {
+	if blockSize == 0 {
+		return nil, fmt.Errorf("sqlite storage: storage index block size must be positive")
+	}
+
+	for _, stmt := range strings.Split(schema, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		_, err := db.Exec(stmt)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite storage: failed to create schema: %w", err)
+		}
+	}
+
+	return &Storage{
+		db:               db,
+		pending:          make(map[atree.StorageID][]byte),
+		indexBlocks:      make(map[atree.Address]*storageIndexBlock),
+		indexBlockSize:   blockSize,
+		segmentsReturned: make(map[atree.StorageID]struct{}),
+		segmentsUpdated:  make(map[atree.StorageID]struct{}),
+		segmentsTouched:  make(map[atree.StorageID]struct{}),
+	}, nil
+}
+
+func (s *Storage) Retrieve(id atree.StorageID) ([]byte, bool, error) {
+	s.segmentsTouched[id] = struct{}{}
+
+	if data, ok := s.pending[id]; ok {
+		if data == nil {
+			return nil, false, nil
+		}
+		s.recordRetrieved(id, data)
+		return data, true, nil
+	}
+
+	var data []byte
+	err := s.db.QueryRow("SELECT data FROM slabs WHERE id = ?", encodeStorageID(id)).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.recordRetrieved(id, data)
+	return data, true, nil
+}
+
+// RetrieveMany returns data of slabs with ids, querying slabs that
+// aren't buffered in batches.  Missing slabs aren't in returned map.
+func (s *Storage) RetrieveMany(ids []atree.StorageID) (map[atree.StorageID][]byte, error) {
+	result := make(map[atree.StorageID][]byte, len(ids))
+
+	query := make([]atree.StorageID, 0, len(ids))
+	for _, id := range ids {
+		s.segmentsTouched[id] = struct{}{}
+
+		if data, ok := s.pending[id]; ok {
+			if data != nil {
+				s.recordRetrieved(id, data)
+				result[id] = data
+			}
+			continue
+		}
+		query = append(query, id)
+	}
+
+	for len(query) > 0 {
+		n := len(query)
+		if n > maxQueryParams {
+			n = maxQueryParams
+		}
+
+		err := s.retrieveBatch(query[:n], result)
+		if err != nil {
+			return nil, err
+		}
+
+		query = query[n:]
+	}
+
+	return result, nil
+}
+
+func (s *Storage) retrieveBatch(ids []atree.StorageID, result map[atree.StorageID][]byte) error {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = encodeStorageID(id)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	rows, err := s.db.Query("SELECT id, data FROM slabs WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rawID, data []byte
+		err = rows.Scan(&rawID, &data)
+		if err != nil {
+			return err
+		}
+
+		id, err := atree.NewStorageIDFromRawBytes(rawID)
+		if err != nil {
+			return err
+		}
+
+		s.recordRetrieved(id, data)
+		result[id] = data
+	}
+
+	return rows.Err()
+}
+
+func (s *Storage) Store(id atree.StorageID, data []byte) error {
+	s.pending[id] = data
+	s.bytesStored += len(data)
+	s.segmentsUpdated[id] = struct{}{}
+	s.segmentsTouched[id] = struct{}{}
+	return nil
+}
+
+func (s *Storage) Remove(id atree.StorageID) error {
+	s.pending[id] = nil
+	s.segmentsUpdated[id] = struct{}{}
+	s.segmentsTouched[id] = struct{}{}
+	return nil
+}
+
+// GenerateStorageID returns next storage ID of address.  Storage indexes
+// are reserved in blocks, and storage index in the database is advanced
+// past each block immediately, so generated IDs are unique even if
+// buffered changes aren't committed.
+func (s *Storage) GenerateStorageID(address atree.Address) (atree.StorageID, error) {
+	block, ok := s.indexBlocks[address]
+	if !ok || block.remaining == 0 {
+		var err error
+		block, err = s.reserveStorageIndexes(address)
+		if err != nil {
+			return atree.StorageIDUndefined, err
+		}
+		s.indexBlocks[address] = block
+	}
+
+	block.last = block.last.Next()
+	block.remaining--
+
+	return atree.NewStorageID(address, block.last), nil
+}
+
+// reserveStorageIndexes advances storage index of address in the database
+// by block size, and returns reserved block.
+func (s *Storage) reserveStorageIndexes(address atree.Address) (*storageIndexBlock, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var last atree.StorageIndex
+
+	var data []byte
+	err = tx.QueryRow("SELECT storage_index FROM storage_indexes WHERE address = ?", address[:]).Scan(&data)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, err
+	case len(data) != len(last):
+		return nil, fmt.Errorf("sqlite storage: storage index of address %s has %d bytes, want %d", address, len(data), len(last))
+	default:
+		copy(last[:], data)
+	}
+
+	end := last
+	for i := uint64(0); i < s.indexBlockSize; i++ {
+		end = end.Next()
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO storage_indexes (address, storage_index) VALUES (?, ?)", address[:], end[:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &storageIndexBlock{last: last, remaining: s.indexBlockSize}, nil
+}
+
+// Commit writes buffered stores and removes in one SQL transaction.
+// Buffered changes are kept if the transaction fails.
+func (s *Storage) Commit() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for id, data := range s.pending {
+		if data == nil {
+			_, err = tx.Exec("DELETE FROM slabs WHERE id = ?", encodeStorageID(id))
+		} else {
+			_, err = tx.Exec("INSERT OR REPLACE INTO slabs (id, data) VALUES (?, ?)", encodeStorageID(id), data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	s.pending = make(map[atree.StorageID][]byte)
+	return nil
+}
+
+// PendingCount returns number of buffered stores and removes.
+func (s *Storage) PendingCount() int {
+	return len(s.pending)
+}
+
+// SegmentCounts returns number of committed segments.
+// It returns 0 if the database can't be queried.
+func (s *Storage) SegmentCounts() int {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM slabs").Scan(&count)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// Size returns total size of committed segments.
+// It returns 0 if the database can't be queried.
+func (s *Storage) Size() int {
+	var size int
+	err := s.db.QueryRow("SELECT COALESCE(SUM(LENGTH(data)), 0) FROM slabs").Scan(&size)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+func (s *Storage) BytesRetrieved() int {
+	return s.bytesRetrieved
+}
+
+func (s *Storage) BytesStored() int {
+	return s.bytesStored
+}
+
+func (s *Storage) SegmentsReturned() int {
+	return len(s.segmentsReturned)
+}
+
+func (s *Storage) SegmentsUpdated() int {
+	return len(s.segmentsUpdated)
+}
+
+func (s *Storage) SegmentsTouched() int {
+	return len(s.segmentsTouched)
+}
+
+func (s *Storage) ResetReporter() {
+	s.bytesStored = 0
+	s.bytesRetrieved = 0
+	s.segmentsReturned = make(map[atree.StorageID]struct{})
+	s.segmentsUpdated = make(map[atree.StorageID]struct{})
+	s.segmentsTouched = make(map[atree.StorageID]struct{})
+}
+
+func (s *Storage) recordRetrieved(id atree.StorageID, data []byte) {
+	s.bytesRetrieved += len(data)
+	s.segmentsReturned[id] = struct{}{}
+}
+
+func encodeStorageID(id atree.StorageID) []byte {
+	b := make([]byte, storageIDSize)
+	_, _ = id.ToRawBytes(b)
+	return b
+}
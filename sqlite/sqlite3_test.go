@@ -0,0 +1,136 @@
+//go:build sqlite3
+// +build sqlite3
+
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/values"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests in this file use SQLite driver and need cgo:
+//
+//	go test -tags sqlite3 ./sqlite
+
+func openSQLite3(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestSQLite3Storage(t *testing.T) {
+
+	atree.SetThreshold(256)
+	defer atree.SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "atree.db")
+
+	base, err := New(openSQLite3(t, path))
+	require.NoError(t, err)
+
+	storage := atree.NewPersistentSlabStorage(base, encMode, decMode, values.DecodeStorable, decodeTypeInfo)
+
+	array, err := atree.NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(values.Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	err = base.Commit()
+	require.NoError(t, err)
+
+	count := base.SegmentCounts()
+	require.True(t, count > 1)
+	require.True(t, base.Size() > 0)
+
+	// Reopen database and load array.
+	base2, err := New(openSQLite3(t, path))
+	require.NoError(t, err)
+
+	storage2 := atree.NewPersistentSlabStorage(base2, encMode, decMode, values.DecodeStorable, decodeTypeInfo)
+
+	array2, err := atree.NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(arraySize), array2.Count())
+
+	for i := uint64(0); i < arraySize; i++ {
+		s, err := array2.Get(i)
+		require.NoError(t, err)
+		require.Equal(t, values.Uint64Value(i), s)
+	}
+	require.Equal(t, count, base2.SegmentsReturned())
+
+	// Slabs are loaded in batches.
+	var ids []atree.StorageID
+	for id := range base2.segmentsReturned {
+		ids = append(ids, id)
+	}
+	result, err := base2.RetrieveMany(ids)
+	require.NoError(t, err)
+	require.Equal(t, count, len(result))
+
+	// Storage indexes reserved by first storage aren't reused.
+	id, err := storage2.GenerateStorageID(address)
+	require.NoError(t, err)
+	for _, existing := range ids {
+		require.NotEqual(t, existing, id)
+	}
+
+	// Removed slabs are deleted by commit.
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array2.Remove(0)
+		require.NoError(t, err)
+	}
+
+	err = storage2.Commit()
+	require.NoError(t, err)
+
+	err = base2.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, base2.SegmentCounts())
+}
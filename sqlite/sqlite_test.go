@@ -0,0 +1,248 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/values"
+	"github.com/stretchr/testify/require"
+)
+
+type testTypeInfo struct {
+	value uint64
+}
+
+var _ atree.TypeInfo = testTypeInfo{}
+
+func (i testTypeInfo) Encode(enc *cbor.StreamEncoder) error {
+	return enc.EncodeUint64(i.value)
+}
+
+func decodeTypeInfo(dec *cbor.StreamDecoder) (atree.TypeInfo, error) {
+	value, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+	return testTypeInfo{value: value}, nil
+}
+
+func newTestStorage(t *testing.T, name string) (*atree.PersistentSlabStorage, *Storage, *testDatabase) {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	db, testDB, err := openTestDB(name)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	base, err := New(db)
+	require.NoError(t, err)
+
+	storage := atree.NewPersistentSlabStorage(base, encMode, decMode, values.DecodeStorable, decodeTypeInfo)
+	return storage, base, testDB
+}
+
+func TestStorage(t *testing.T) {
+
+	atree.SetThreshold(256)
+	defer atree.SetThreshold(1024)
+
+	const arraySize = 1024
+
+	typeInfo := testTypeInfo{42}
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage, base, testDB := newTestStorage(t, t.Name())
+
+	array, err := atree.NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i++ {
+		err := array.Append(values.Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Changes are buffered until storage commit.
+	require.True(t, base.PendingCount() > 1)
+	require.Equal(t, 0, base.SegmentCounts())
+
+	err = base.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 0, base.PendingCount())
+	require.Equal(t, len(testDB.tables["slabs"]), base.SegmentCounts())
+	require.True(t, base.Size() > 0)
+
+	// Load array with new storage using the same database.
+	storage2, base2, _ := newTestStorage(t, t.Name())
+
+	array2, err := atree.NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(arraySize), array2.Count())
+
+	for i := uint64(0); i < arraySize; i++ {
+		s, err := array2.Get(i)
+		require.NoError(t, err)
+		require.Equal(t, values.Uint64Value(i), s)
+	}
+
+	require.True(t, base2.BytesRetrieved() > 0)
+	require.Equal(t, base.SegmentCounts(), base2.SegmentsReturned())
+
+	// Remove all elements and commit removed slabs.
+	for i := uint64(0); i < arraySize; i++ {
+		_, err := array2.Remove(0)
+		require.NoError(t, err)
+	}
+
+	err = storage2.Commit()
+	require.NoError(t, err)
+
+	err = base2.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 1, base2.SegmentCounts())
+
+	// Storage indexes are persisted in the database, and indexes
+	// reserved by other storage aren't reused.
+	id, err := base.GenerateStorageID(address)
+	require.NoError(t, err)
+
+	id2, err := base2.GenerateStorageID(address)
+	require.NoError(t, err)
+	require.Equal(t, address, id2.Address)
+	require.True(t, bytes.Compare(id2.Index[:], id.Index[:]) > 0)
+}
+
+func TestStorageIndexBlocks(t *testing.T) {
+	address := atree.Address{1}
+
+	db, testDB, err := openTestDB(t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	_, err = NewWithStorageIndexBlockSize(db, 0)
+	require.Error(t, err)
+
+	base, err := NewWithStorageIndexBlockSize(db, 4)
+	require.NoError(t, err)
+
+	var index atree.StorageIndex
+	for i := 0; i < 10; i++ {
+		index = index.Next()
+
+		id, err := base.GenerateStorageID(address)
+		require.NoError(t, err)
+		require.Equal(t, atree.NewStorageID(address, index), id)
+	}
+
+	// Database has end of last reserved block.
+	reserved := index.Next().Next()
+	require.Equal(t, reserved[:], testDB.tables["storage_indexes"][string(address[:])])
+
+	// Storage using the same database starts after reserved block.
+	base2, err := NewWithStorageIndexBlockSize(db, 4)
+	require.NoError(t, err)
+
+	id, err := base2.GenerateStorageID(address)
+	require.NoError(t, err)
+	require.Equal(t, atree.NewStorageID(address, reserved.Next()), id)
+}
+
+func TestStorageRetrieveMany(t *testing.T) {
+	_, base, _ := newTestStorage(t, t.Name())
+
+	address := atree.Address{1}
+
+	const count = maxQueryParams + 100
+
+	ids := make([]atree.StorageID, count)
+	for i := range ids {
+		id, err := base.GenerateStorageID(address)
+		require.NoError(t, err)
+		ids[i] = id
+
+		err = base.Store(id, []byte{byte(i)})
+		require.NoError(t, err)
+	}
+
+	err := base.Commit()
+	require.NoError(t, err)
+
+	// Buffered changes are returned without querying database.
+	err = base.Remove(ids[0])
+	require.NoError(t, err)
+
+	err = base.Store(ids[1], []byte{42})
+	require.NoError(t, err)
+
+	missing := atree.NewStorageID(address, atree.StorageIndex{0xff})
+
+	result, err := base.RetrieveMany(append(ids, missing))
+	require.NoError(t, err)
+	require.Equal(t, count-1, len(result))
+
+	require.Equal(t, []byte{42}, result[ids[1]])
+	for i := 2; i < count; i++ {
+		require.Equal(t, []byte{byte(i)}, result[ids[i]])
+	}
+}
+
+func TestStorageCommitFailure(t *testing.T) {
+	_, base, testDB := newTestStorage(t, t.Name())
+
+	id, err := base.GenerateStorageID(atree.Address{1})
+	require.NoError(t, err)
+
+	err = base.Store(id, []byte{1})
+	require.NoError(t, err)
+
+	testDB.failExec = true
+
+	err = base.Commit()
+	require.Error(t, err)
+
+	// Buffered changes are kept, and nothing is written.
+	require.Equal(t, 1, base.PendingCount())
+	require.Equal(t, 0, base.SegmentCounts())
+
+	testDB.failExec = false
+
+	err = base.Commit()
+	require.NoError(t, err)
+	require.Equal(t, 0, base.PendingCount())
+
+	data, found, err := base.Retrieve(id)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, []byte{1}, data)
+}
@@ -37,6 +37,13 @@ type Storable interface {
 	ChildStorables() []Storable
 }
 
+// CBORTagReservedMin is smallest CBOR tag number reserved by atree.
+// Tags from CBORTagReservedMin to 255 are used by storables and slab
+// encodings of this package (such as CBORTagVersionedStorable and
+// CBORTagCompressedStorable), so StorableDecoder and storables of
+// applications must not use them.
+const CBORTagReservedMin = 248
+
 const (
 	CBORTagInlineCollisionGroup   = 253
 	CBORTagExternalCollisionGroup = 254
@@ -83,7 +90,7 @@ func (v StorageIDStorable) Encode(enc *Encoder) error {
 	}
 
 	copy(enc.Scratch[:], v.Address[:])
-	copy(enc.Scratch[8:], v.Index[:])
+	copy(enc.Scratch[AddressSize:], v.Index[:])
 
 	return enc.CBOR.EncodeBytes(enc.Scratch[:storageIDSize])
 }
@@ -129,7 +136,7 @@ func DecodeStorageIDStorable(dec *cbor.StreamDecoder) (Storable, error) {
 	copy(address[:], b)
 
 	var index StorageIndex
-	copy(index[:], b[8:])
+	copy(index[:], b[AddressSize:])
 
 	id := NewStorageID(address, index)
 	return StorageIDStorable(id), nil
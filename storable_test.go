@@ -33,7 +33,6 @@ const (
 	cborTagUInt16Value = 162
 	cborTagUInt32Value = 163
 	cborTagUInt64Value = 164
-	cborTagSomeValue   = 165
 )
 
 type HashableValue interface {
@@ -488,12 +487,17 @@ func decodeStorable(dec *cbor.StreamDecoder, id StorageID) (Storable, error) {
 			}
 			return Uint64Value(n), nil
 
-		case cborTagSomeValue:
-			storable, err := decodeStorable(dec, id)
-			if err != nil {
-				return nil, err
-			}
-			return SomeStorable{Storable: storable}, nil
+		case CBORTagSomeValue:
+			return DecodeSomeStorable(dec, id, decodeStorable)
+
+		case CBORTagTimestampedValue:
+			return DecodeTimestampedStorable(dec, id, decodeStorable)
+
+		case CBORTagVersionedStorable:
+			return DecodeVersionedStorable(dec, id, VersionedStorableDecoders{
+				1: decodeTestStorableV1,
+				2: decodeStorable,
+			})
 
 		default:
 			return nil, fmt.Errorf("invalid tag number %d", tagNumber)
@@ -512,7 +516,9 @@ func decodeTypeInfo(dec *cbor.StreamDecoder) (TypeInfo, error) {
 	return testTypeInfo{value: value}, nil
 }
 
-func compare(storage SlabStorage, value Value, storable Storable) (bool, error) {
+var compare = NewSomeValueComparator(compareValue)
+
+func compareValue(storage SlabStorage, value Value, storable Storable) (bool, error) {
 	switch v := value.(type) {
 
 	case Uint8Value:
@@ -560,109 +566,17 @@ func compare(storage SlabStorage, value Value, storable Storable) (bool, error)
 		}
 
 		return false, nil
-
-	case SomeValue:
-		other, ok := storable.(SomeStorable)
-		if !ok {
-			return false, nil
-		}
-
-		return compare(storage, v.Value, other.Storable)
 	}
 
 	return false, fmt.Errorf("value %T not supported for comparison", value)
 }
 
-func hashInputProvider(value Value, buffer []byte) ([]byte, error) {
+var hashInputProvider = NewSomeHashInputProvider(hashableValueHashInput)
+
+func hashableValueHashInput(value Value, buffer []byte) ([]byte, error) {
 	if hashable, ok := value.(HashableValue); ok {
 		return hashable.HashInput(buffer)
 	}
 
 	return nil, fmt.Errorf("value %T doesn't implement HashableValue interface", value)
 }
-
-type SomeValue struct {
-	Value Value
-}
-
-var _ Value = SomeValue{}
-var _ HashableValue = SomeValue{}
-
-func (v SomeValue) Storable(storage SlabStorage, address Address, maxSize uint64) (Storable, error) {
-
-	valueStorable, err := v.Value.Storable(
-		storage,
-		address,
-		maxSize-2,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return SomeStorable{
-		Storable: valueStorable,
-	}, nil
-}
-
-func (v SomeValue) HashInput(scratch []byte) ([]byte, error) {
-
-	wv, ok := v.Value.(HashableValue)
-	if !ok {
-		return nil, fmt.Errorf("failed to hash wrapped value: %s", v.Value)
-	}
-
-	b, err := wv.HashInput(scratch)
-	if err != nil {
-		return nil, err
-	}
-
-	hi := make([]byte, len(b)+2)
-	hi[0] = 0xd8
-	hi[1] = cborTagSomeValue
-	copy(hi[2:], b)
-
-	return hi, nil
-}
-
-func (v SomeValue) String() string {
-	return fmt.Sprintf("%s", v.Value)
-}
-
-type SomeStorable struct {
-	Storable Storable
-}
-
-var _ Storable = SomeStorable{}
-
-func (v SomeStorable) ByteSize() uint32 {
-	// tag number (2 bytes) + encoded content
-	return 2 + v.Storable.ByteSize()
-}
-
-func (v SomeStorable) Encode(enc *Encoder) error {
-	err := enc.CBOR.EncodeRawBytes([]byte{
-		// tag number
-		0xd8, cborTagSomeValue,
-	})
-	if err != nil {
-		return err
-	}
-	return v.Storable.Encode(enc)
-}
-
-func (v SomeStorable) ChildStorables() []Storable {
-	return []Storable{v.Storable}
-}
-
-func (v SomeStorable) StoredValue(storage SlabStorage) (Value, error) {
-	wv, err := v.Storable.StoredValue(storage)
-	if err != nil {
-		return nil, err
-	}
-
-	return SomeValue{wv}, nil
-}
-
-func (v SomeStorable) String() string {
-	return fmt.Sprintf("%s", v.Storable)
-}
@@ -20,20 +20,36 @@ package atree
 
 import (
 	"bytes"
-	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
 )
 
 const LedgerBaseStorageSlabPrefix = "$"
 
+// Address and StorageIndex widths are fixed at compile time.  Address is
+// an array type used as map key and embedded in StorageID, so its width
+// can't be chosen when storage is constructed.  Encoding of StorageID,
+// ParseStorageID, and StorageIndex.Next are derived from these sizes,
+// but changing them changes encoding of every slab, so data encoded with
+// one width can't be decoded with another.
+const (
+	// AddressSize is byte size of Address.
+	AddressSize = 8
+
+	// StorageIndexSize is byte size of StorageIndex.
+	StorageIndexSize = 8
+)
+
 type (
-	Address      [8]byte
-	StorageIndex [8]byte
+	Address      [AddressSize]byte
+	StorageIndex [StorageIndexSize]byte
 
 	StorageID struct {
 		Address Address
@@ -52,10 +68,10 @@ var (
 // by checking if the index value is valid before
 // calling this function.
 func (index StorageIndex) Next() StorageIndex {
-	i := binary.BigEndian.Uint64(index[:])
+	i := uintFromBigEndian(index[:])
 
 	var next StorageIndex
-	binary.BigEndian.PutUint64(next[:], i+1)
+	putUintBigEndian(next[:], i+1)
 
 	return next
 }
@@ -73,7 +89,7 @@ func NewStorageIDFromRawBytes(b []byte) (StorageID, error) {
 	copy(address[:], b)
 
 	var index StorageIndex
-	copy(index[:], b[8:])
+	copy(index[:], b[AddressSize:])
 
 	return StorageID{address, index}, nil
 }
@@ -83,24 +99,115 @@ func (id StorageID) ToRawBytes(b []byte) (int, error) {
 		return 0, NewStorageIDErrorf("incorrect storage id buffer length %d", len(b))
 	}
 	copy(b, id.Address[:])
-	copy(b[8:], id.Index[:])
+	copy(b[AddressSize:], id.Index[:])
 	return storageIDSize, nil
 }
 
 func (id StorageID) String() string {
-	return fmt.Sprintf(
-		"0x%x.%d",
-		binary.BigEndian.Uint64(id.Address[:]),
-		binary.BigEndian.Uint64(id.Index[:]),
-	)
+	// Leading zeros of address are trimmed, the same as formatting
+	// address as a number.
+	address := strings.TrimLeft(hex.EncodeToString(id.Address[:]), "0")
+	if address == "" {
+		address = "0"
+	}
+	return fmt.Sprintf("0x%s.%d", address, uintFromBigEndian(id.Index[:]))
+}
+
+// ParseStorageID parses storage ID in the format of StorageID.String,
+// such as "0x102030405060708.1".  The "0x" prefix of address is optional.
+func ParseStorageID(s string) (StorageID, error) {
+	parts := strings.SplitN(s, ".", 2)
+	if len(parts) != 2 {
+		return StorageIDUndefined, NewStorageIDErrorf("invalid storage id %q: want address.index", s)
+	}
+
+	address := strings.TrimPrefix(parts[0], "0x")
+	if len(address) == 0 || len(address) > 2*AddressSize {
+		return StorageIDUndefined, NewStorageIDErrorf("invalid storage id %q: address must have 1 to %d hex digits", s, 2*AddressSize)
+	}
+	address = strings.Repeat("0", 2*AddressSize-len(address)) + address
+
+	var id StorageID
+
+	_, err := hex.Decode(id.Address[:], []byte(address))
+	if err != nil {
+		return StorageIDUndefined, NewStorageIDErrorf("invalid storage id %q: %s", s, err)
+	}
+
+	index, err := strconv.ParseUint(parts[1], 10, 8*StorageIndexSize)
+	if err != nil {
+		return StorageIDUndefined, NewStorageIDErrorf("invalid storage id %q: %s", s, err)
+	}
+	putUintBigEndian(id.Index[:], index)
+
+	return id, nil
+}
+
+// uintFromBigEndian returns unsigned integer encoded in big-endian b.
+func uintFromBigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// putUintBigEndian encodes v in big-endian b, using all of b.
+func putUintBigEndian(b []byte, v uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+// MarshalText encodes storage ID in the format of StorageID.String.
+func (id StorageID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
 }
 
+// UnmarshalText decodes storage ID encoded by MarshalText.
+func (id *StorageID) UnmarshalText(text []byte) error {
+	parsed, err := ParseStorageID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// MarshalBinary encodes storage ID as raw bytes of address and index.
+func (id StorageID) MarshalBinary() ([]byte, error) {
+	b := make([]byte, storageIDSize)
+	_, err := id.ToRawBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes storage ID encoded by MarshalBinary.
+func (id *StorageID) UnmarshalBinary(data []byte) error {
+	if len(data) != storageIDSize {
+		return NewStorageIDErrorf("incorrect storage id data length %d", len(data))
+	}
+	parsed, err := NewStorageIDFromRawBytes(data)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// AddressAsUint64 returns address as big-endian integer.  Only low 64
+// bits are returned if AddressSize is greater than 8.
 func (id StorageID) AddressAsUint64() uint64 {
-	return binary.BigEndian.Uint64(id.Address[:])
+	return uintFromBigEndian(id.Address[:])
 }
 
+// IndexAsUint64 returns index as big-endian integer.  Only low 64 bits
+// are returned if StorageIndexSize is greater than 8.
 func (id StorageID) IndexAsUint64() uint64 {
-	return binary.BigEndian.Uint64(id.Index[:])
+	return uintFromBigEndian(id.Index[:])
 }
 
 func (id StorageID) Valid() error {
@@ -490,6 +597,43 @@ type PersistentSlabStorage struct {
 	DecodeTypeInfo   TypeInfoDecoder
 	cborEncMode      cbor.EncMode
 	cborDecMode      cbor.DecMode
+	snapshots        map[*StorageSnapshot]struct{}
+	snapshotVersion  uint64
+	digesterKeys     DigesterKeyProvider
+
+	// snapshotsLock guards snapshots, since snapshots can be released
+	// by readers while storage is committed.
+	snapshotsLock sync.Mutex
+
+	collisionMonitor           CollisionMonitor
+	collisionMonitorThresholds CollisionMonitorThresholds
+
+	hooks *Hooks
+
+	logger                Logger
+	slowRetrieveThreshold time.Duration
+
+	operationCostReporter OperationCostReporter
+
+	meter Meter
+
+	maxNestingDepth int
+
+	provenanceProvider ProvenanceProvider
+
+	rootRegistry bool
+
+	commitVersion       uint64
+	slabCommitVersions  map[StorageID]uint64
+	backupEpoch         uint64
+	backupPrunedVersion uint64
+
+	compressionThreshold uint32
+
+	transaction *storageTransaction
+
+	// createdIDs contains IDs of account slabs generated since last commit.
+	createdIDs map[StorageID]struct{}
 }
 
 var _ SlabStorage = &PersistentSlabStorage{}
@@ -618,6 +762,15 @@ var _ SlabStorage = &PersistentSlabStorage{}
 
 type StorageOption func(st *PersistentSlabStorage) *PersistentSlabStorage
 
+// WithDigesterKeyProvider returns StorageOption that sets provider of
+// secret keys used to decode maps created with NewSecretKeyDigesterBuilder.
+func WithDigesterKeyProvider(provider DigesterKeyProvider) StorageOption {
+	return func(st *PersistentSlabStorage) *PersistentSlabStorage {
+		st.digesterKeys = provider
+		return st
+	}
+}
+
 func NewPersistentSlabStorage(
 	base BaseStorage,
 	cborEncMode cbor.EncMode,
@@ -629,6 +782,7 @@ func NewPersistentSlabStorage(
 	storage := &PersistentSlabStorage{baseStorage: base,
 		cache:          make(map[StorageID]Slab),
 		deltas:         make(map[StorageID]Slab),
+		createdIDs:     make(map[StorageID]struct{}),
 		cborEncMode:    cborEncMode,
 		cborDecMode:    cborDecMode,
 		DecodeStorable: decodeStorable,
@@ -642,17 +796,30 @@ func NewPersistentSlabStorage(
 	return storage
 }
 
+// DigesterKey returns secret digester key with given key ID from
+// DigesterKeyProvider set by WithDigesterKeyProvider.
+func (s *PersistentSlabStorage) DigesterKey(keyID uint64) ([]byte, error) {
+	if s.digesterKeys == nil {
+		return nil, NewUserError(NewDigesterKeyErrorf("storage doesn't provide digester key %d", keyID))
+	}
+	return s.digesterKeys.DigesterKey(keyID)
+}
+
 func (s *PersistentSlabStorage) GenerateStorageID(address Address) (StorageID, error) {
 	if address == AddressUndefined {
 		var idx StorageIndex
 		s.tempStorageIndex++
-		binary.BigEndian.PutUint64(idx[:], s.tempStorageIndex)
-		return NewStorageID(address, idx), nil
+		putUintBigEndian(idx[:], s.tempStorageIndex)
+		id := NewStorageID(address, idx)
+		notifySlabCreated(s.hooks, id)
+		return id, nil
 	}
 	id, err := s.baseStorage.GenerateStorageID(address)
 	if err != nil {
 		return StorageID{}, NewStorageError(err)
 	}
+	s.createdIDs[id] = struct{}{}
+	notifySlabCreated(s.hooks, id)
 	return id, nil
 }
 
@@ -677,11 +844,20 @@ func (s *PersistentSlabStorage) sortedOwnedDeltaKeys() []StorageID {
 }
 
 func (s *PersistentSlabStorage) Commit() error {
+	if s.transaction != nil {
+		return NewUserError(NewTransactionErrorf("storage can't be committed while transaction is active"))
+	}
+
 	var err error
 
 	// this part ensures the keys are sorted so commit operation is deterministic
 	keysWithOwners := s.sortedOwnedDeltaKeys()
 
+	err = s.preserveForSnapshots(keysWithOwners)
+	if err != nil {
+		return err
+	}
+
 	for _, id := range keysWithOwners {
 		slab := s.deltas[id]
 
@@ -696,11 +872,12 @@ func (s *PersistentSlabStorage) Commit() error {
 			// 2. deleted slabs are not re-committed in next commit
 			s.cache[id] = nil
 			delete(s.deltas, id)
+			s.trackCommitted(id)
 			continue
 		}
 
 		// serialize
-		data, err := Encode(slab, s.cborEncMode)
+		data, err := s.encodeSlab(slab)
 		if err != nil {
 			return NewStorageError(err)
 		}
@@ -717,18 +894,29 @@ func (s *PersistentSlabStorage) Commit() error {
 		// iteration is on non-temp slabs and temp slabs
 		// are still in deltas.
 		delete(s.deltas, id)
+		s.trackCommitted(id)
 	}
 
+	s.trackCommitCompleted()
+
 	// Do NOT reset deltas because slabs with empty address are not saved.
 
 	return nil
 }
 
 func (s *PersistentSlabStorage) FastCommit(numWorkers int) error {
+	if s.transaction != nil {
+		return NewUserError(NewTransactionErrorf("storage can't be committed while transaction is active"))
+	}
 
 	// this part ensures the keys are sorted so commit operation is deterministic
 	keysWithOwners := s.sortedOwnedDeltaKeys()
 
+	err := s.preserveForSnapshots(keysWithOwners)
+	if err != nil {
+		return err
+	}
+
 	// construct job queue
 	jobs := make(chan StorageID, len(keysWithOwners))
 	for _, id := range keysWithOwners {
@@ -768,7 +956,7 @@ func (s *PersistentSlabStorage) FastCommit(numWorkers int) error {
 				continue
 			}
 			// serialize
-			data, err := Encode(slab, s.cborEncMode)
+			data, err := s.encodeSlab(slab)
 			results <- &encodedSlabs{
 				storageID: id,
 				data:      data,
@@ -828,6 +1016,7 @@ func (s *PersistentSlabStorage) FastCommit(numWorkers int) error {
 			// 2. deleted slabs are not re-committed in next commit
 			s.cache[id] = nil
 			delete(s.deltas, id)
+			s.trackCommitted(id)
 			continue
 		}
 
@@ -842,15 +1031,32 @@ func (s *PersistentSlabStorage) FastCommit(numWorkers int) error {
 		// iteration is on non-temp slabs and temp slabs
 		// are still in deltas.
 		delete(s.deltas, id)
+		s.trackCommitted(id)
 	}
 
+	s.trackCommitCompleted()
+
 	// Do NOT reset deltas because slabs with empty address are not saved.
 
 	return nil
 }
 
+// trackCommitted records that delta of id is written to base storage by
+// commit in progress.
+func (s *PersistentSlabStorage) trackCommitted(id StorageID) {
+	s.trackDeltaCommitted(id)
+	s.trackSlabCommitVersion(id)
+}
+
+// trackCommitCompleted records that all deltas are written to base storage.
+func (s *PersistentSlabStorage) trackCommitCompleted() {
+	s.pruneCreatedIDs()
+	s.commitVersion++
+}
+
 func (s *PersistentSlabStorage) DropDeltas() {
 	s.deltas = make(map[StorageID]Slab)
+	s.createdIDs = make(map[StorageID]struct{})
 }
 
 func (s *PersistentSlabStorage) DropCache() {
@@ -865,19 +1071,59 @@ func (s *PersistentSlabStorage) RetrieveIgnoringDeltas(id StorageID) (Slab, bool
 	}
 
 	// fetch from base storage last
+	var start time.Time
+	if s.logger != nil {
+		start = time.Now()
+	}
+
 	data, ok, err := s.baseStorage.Retrieve(id)
 	if err != nil {
 		return nil, ok, NewStorageError(err)
 	}
+
+	if s.logger != nil {
+		if d := time.Since(start); d >= s.slowRetrieveThreshold {
+			s.logger.Warn("slow slab retrieve", "id", id, "duration", d, "size", len(data))
+		}
+	}
+
 	if !ok {
 		return nil, ok, nil
 	}
 
+	var decompressedSize uint64
+	var compressed bool
+
+	if s.meter != nil {
+		err = s.meter.MeterBefore(MeterStepSlabDecode, uint64(len(data)))
+		if err != nil {
+			return nil, ok, NewMeterError(MeterStepSlabDecode, err)
+		}
+
+		decompressedSize, compressed = decompressedStorableSize(data, s.cborDecMode)
+		if compressed {
+			err = s.meter.MeterBefore(MeterStepDecompress, decompressedSize)
+			if err != nil {
+				return nil, ok, NewMeterError(MeterStepDecompress, err)
+			}
+		}
+	}
+
 	slab, err := DecodeSlab(id, data, s.cborDecMode, s.DecodeStorable, s.DecodeTypeInfo)
 	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn("slab decode failed", "id", id, "error", err)
+		}
 		return nil, ok, NewStorageError(err)
 	}
 
+	if s.meter != nil {
+		if compressed {
+			s.meter.MeterAfter(MeterStepDecompress, decompressedSize)
+		}
+		s.meter.MeterAfter(MeterStepSlabDecode, uint64(len(data)))
+	}
+
 	// save decoded slab to cache
 	s.cache[id] = slab
 
@@ -896,12 +1142,26 @@ func (s *PersistentSlabStorage) Retrieve(id StorageID) (Slab, bool, error) {
 func (s *PersistentSlabStorage) Store(id StorageID, slab Slab) error {
 	// add to deltas
 	s.deltas[id] = slab
+
+	if s.rootRegistry {
+		return s.registerRoot(id, slab)
+	}
 	return nil
 }
 
 func (s *PersistentSlabStorage) Remove(id StorageID) error {
-	// add to nil to deltas under that id
-	s.deltas[id] = nil
+	if s.removeCreated(id) {
+		// slab was never committed, so base storage isn't modified
+		delete(s.deltas, id)
+	} else {
+		// add to nil to deltas under that id
+		s.deltas[id] = nil
+	}
+	notifySlabRemoved(s.hooks, id)
+
+	if s.rootRegistry {
+		return s.unregisterRoot(id)
+	}
 	return nil
 }
 
@@ -0,0 +1,101 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// DeltaKind describes how uncommitted slab changes base storage.
+type DeltaKind int
+
+const (
+	// DeltaCreated is slab generated since last commit.
+	DeltaCreated DeltaKind = iota
+	// DeltaUpdated is slab stored in base storage and modified since last commit.
+	DeltaUpdated
+	// DeltaRemoved is slab stored in base storage and removed since last commit.
+	DeltaRemoved
+)
+
+func (k DeltaKind) String() string {
+	switch k {
+	case DeltaCreated:
+		return "created"
+	case DeltaUpdated:
+		return "updated"
+	case DeltaRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// DeltaIterationFunc is called for each uncommitted slab by IterateDeltas.
+// Slab is nil for removed slabs.  Iteration stops if it returns false.
+type DeltaIterationFunc func(id StorageID, slab Slab, kind DeltaKind) (resume bool)
+
+// IterateDeltas calls fn for each slab that next Commit writes to or
+// removes from base storage, in the same order as Commit.  Temporary
+// slabs are skipped because they aren't committed.  Slabs must not be
+// modified by fn.
+func (s *PersistentSlabStorage) IterateDeltas(fn DeltaIterationFunc) {
+	for _, id := range s.sortedOwnedDeltaKeys() {
+		slab := s.deltas[id]
+
+		_, created := s.createdIDs[id]
+
+		var kind DeltaKind
+		switch {
+		case slab == nil:
+			kind = DeltaRemoved
+		case created:
+			kind = DeltaCreated
+		default:
+			kind = DeltaUpdated
+		}
+
+		if !fn(id, slab, kind) {
+			return
+		}
+	}
+}
+
+// trackDeltaCommitted records that delta of id is written to base
+// storage, so id is no longer reported as created.
+func (s *PersistentSlabStorage) trackDeltaCommitted(id StorageID) {
+	delete(s.createdIDs, id)
+}
+
+// pruneCreatedIDs discards IDs generated and not stored before successful
+// commit, so that unused IDs aren't tracked indefinitely.
+func (s *PersistentSlabStorage) pruneCreatedIDs() {
+	for id := range s.createdIDs {
+		if _, ok := s.deltas[id]; !ok {
+			delete(s.createdIDs, id)
+		}
+	}
+}
+
+// removeCreated stops tracking id as created and returns true if id was
+// generated since last commit.  Slabs of such ids aren't stored in base
+// storage, so their removal doesn't need to be committed.
+func (s *PersistentSlabStorage) removeCreated(id StorageID) bool {
+	if _, ok := s.createdIDs[id]; !ok {
+		return false
+	}
+	delete(s.createdIDs, id)
+	return true
+}
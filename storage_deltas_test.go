@@ -0,0 +1,228 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistentStorageIterateDeltas(t *testing.T) {
+
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	collectDeltas := func(storage *PersistentSlabStorage) map[StorageID]DeltaKind {
+		deltas := make(map[StorageID]DeltaKind)
+		var prevID StorageID
+		storage.IterateDeltas(func(id StorageID, slab Slab, kind DeltaKind) bool {
+			// Deltas are iterated in commit order.
+			require.True(t, prevID.Compare(id) < 0)
+			prevID = id
+
+			require.Equal(t, kind == DeltaRemoved, slab == nil)
+			deltas[id] = kind
+			return true
+		})
+		return deltas
+	}
+
+	storage := newTestPersistentStorage(t)
+
+	require.Equal(t, 0, len(collectDeltas(storage)))
+
+	id1, err := storage.GenerateStorageID(address)
+	require.NoError(t, err)
+
+	id2, err := storage.GenerateStorageID(address)
+	require.NoError(t, err)
+
+	id3, err := storage.GenerateStorageID(address)
+	require.NoError(t, err)
+
+	tempID, err := storage.GenerateStorageID(AddressUndefined)
+	require.NoError(t, err)
+
+	for _, id := range []StorageID{id1, id2, id3, tempID} {
+		err = storage.Store(id, &ArrayDataSlab{header: ArraySlabHeader{id: id}})
+		require.NoError(t, err)
+	}
+
+	// Temporary slabs aren't reported.
+	require.Equal(t,
+		map[StorageID]DeltaKind{
+			id1: DeltaCreated,
+			id2: DeltaCreated,
+			id3: DeltaCreated,
+		},
+		collectDeltas(storage),
+	)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	require.Equal(t, 0, len(collectDeltas(storage)))
+
+	id4, err := storage.GenerateStorageID(address)
+	require.NoError(t, err)
+
+	id5, err := storage.GenerateStorageID(address)
+	require.NoError(t, err)
+
+	for _, id := range []StorageID{id1, id4, id5} {
+		err = storage.Store(id, &ArrayDataSlab{header: ArraySlabHeader{id: id}})
+		require.NoError(t, err)
+	}
+
+	err = storage.Remove(id2)
+	require.NoError(t, err)
+
+	// Slab generated and removed since last commit isn't reported.
+	err = storage.Remove(id5)
+	require.NoError(t, err)
+
+	require.Equal(t,
+		map[StorageID]DeltaKind{
+			id1: DeltaUpdated,
+			id2: DeltaRemoved,
+			id4: DeltaCreated,
+		},
+		collectDeltas(storage),
+	)
+
+	// Iteration stops when fn returns false.
+	count := 0
+	storage.IterateDeltas(func(StorageID, Slab, DeltaKind) bool {
+		count++
+		return false
+	})
+	require.Equal(t, 1, count)
+
+	err = storage.FastCommit(2)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, len(collectDeltas(storage)))
+}
+
+// failingBaseStorage fails to store slab with failID.
+type failingBaseStorage struct {
+	*InMemBaseStorage
+	failID StorageID
+}
+
+func (s *failingBaseStorage) Store(id StorageID, data []byte) error {
+	if id == s.failID {
+		return errors.New("store failed")
+	}
+	return s.InMemBaseStorage.Store(id, data)
+}
+
+func TestPersistentStorageCreatedIDs(t *testing.T) {
+
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	newSlab := func(id StorageID) Slab {
+		return &ArrayDataSlab{header: ArraySlabHeader{id: id}}
+	}
+
+	collectKinds := func(storage *PersistentSlabStorage) map[StorageID]DeltaKind {
+		kinds := make(map[StorageID]DeltaKind)
+		storage.IterateDeltas(func(id StorageID, _ Slab, kind DeltaKind) bool {
+			kinds[id] = kind
+			return true
+		})
+		return kinds
+	}
+
+	t.Run("failed commit", func(t *testing.T) {
+		baseStorage := &failingBaseStorage{InMemBaseStorage: NewInMemBaseStorage()}
+		storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+		id1, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+
+		id2, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Store(id1, newSlab(id1)))
+		require.NoError(t, storage.Store(id2, newSlab(id2)))
+
+		// Slab not written to base storage is still created.
+		baseStorage.failID = id2
+
+		err = storage.Commit()
+		require.Error(t, err)
+
+		require.Equal(t, map[StorageID]DeltaKind{id2: DeltaCreated}, collectKinds(storage))
+
+		baseStorage.failID = StorageIDUndefined
+
+		err = storage.Commit()
+		require.NoError(t, err)
+
+		require.Equal(t, 0, len(collectKinds(storage)))
+		require.Equal(t, 0, len(storage.createdIDs))
+	})
+
+	t.Run("unused ids", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		_, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+
+		id, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Store(id, newSlab(id)))
+		require.NoError(t, storage.Remove(id))
+
+		// Removed slab that was never committed isn't committed.
+		require.Equal(t, 0, len(collectKinds(storage)))
+		require.Equal(t, 1, len(storage.createdIDs))
+
+		// IDs that weren't stored are discarded by commit.
+		err = storage.Commit()
+		require.NoError(t, err)
+		require.Equal(t, 0, len(storage.createdIDs))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		storage := newTestPersistentStorage(t)
+
+		id1, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+		require.NoError(t, storage.Store(id1, newSlab(id1)))
+
+		err = storage.BeginTransaction()
+		require.NoError(t, err)
+
+		id2, err := storage.GenerateStorageID(address)
+		require.NoError(t, err)
+		require.NoError(t, storage.Store(id2, newSlab(id2)))
+
+		require.NoError(t, storage.Remove(id1))
+
+		err = storage.RollbackTransaction()
+		require.NoError(t, err)
+
+		require.Equal(t, map[StorageID]DeltaKind{id1: DeltaCreated}, collectKinds(storage))
+		require.Equal(t, 1, len(storage.createdIDs))
+	})
+}
@@ -0,0 +1,233 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "sort"
+
+// SlabSizeEntry is a slab and its encoded byte size.
+type SlabSizeEntry struct {
+	ID   StorageID
+	Size uint64
+}
+
+// CollectionLevelsEntry is a collection and number of levels in its
+// slab tree.  A collection stored in a single root data slab has 1 level.
+type CollectionLevelsEntry struct {
+	ID     StorageID
+	Levels int
+}
+
+// CollisionGroupEntry is a map collision group found in a map data slab.
+type CollisionGroupEntry struct {
+	// ID is ID of map data slab containing collision group.
+	ID StorageID
+	// Level is number of leading digests shared by all elements in the
+	// collision group, as in CollisionGroupEvent.
+	Level int
+	// Count is number of elements in the collision group at this level.
+	// Nested collision groups are counted as one element.
+	Count uint32
+	// External is true if the collision group is stored in a separate slab.
+	External bool
+}
+
+// StorageReport lists slabs and collections in storage that are most
+// likely to cause slow operations.  Each list is sorted in descending
+// order and has at most topN entries.
+type StorageReport struct {
+	SlabCount             int
+	LargestSlabs          []SlabSizeEntry
+	DeepestCollections    []CollectionLevelsEntry
+	WidestCollisionGroups []CollisionGroupEntry
+}
+
+// NewStorageReport scans slabs returned by slab iterator of storage and
+// reports the topN largest slabs, the topN collections with most slab
+// tree levels, and the topN map collision groups with most elements.
+//
+// Slab iterator of PersistentSlabStorage only visits loaded slabs and
+// their descendants, so slabs to be scanned need to be retrieved first.
+func NewStorageReport(storage SlabStorage, topN int) (*StorageReport, error) {
+	iterator, err := storage.SlabIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	encMode := storageEncModeOf(storage)
+
+	report := &StorageReport{}
+
+	for {
+		id, slab := iterator()
+		if id == StorageIDUndefined {
+			break
+		}
+
+		report.SlabCount++
+
+		size, err := encodedSlabSize(encMode, slab)
+		if err != nil {
+			return nil, err
+		}
+		report.LargestSlabs = append(report.LargestSlabs, SlabSizeEntry{ID: id, Size: size})
+
+		if isCollectionRootSlab(slab) {
+			levels, err := slabTreeLevels(storage, slab)
+			if err != nil {
+				return nil, err
+			}
+			report.DeepestCollections = append(report.DeepestCollections, CollectionLevelsEntry{ID: id, Levels: levels})
+		}
+
+		if dataSlab, ok := slab.(*MapDataSlab); ok && !dataSlab.collisionGroup {
+			report.WidestCollisionGroups, err = appendCollisionGroups(
+				report.WidestCollisionGroups,
+				storage,
+				id,
+				dataSlab.elements,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(report.LargestSlabs, func(i, j int) bool {
+		a, b := report.LargestSlabs[i], report.LargestSlabs[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.ID.Compare(b.ID) < 0
+	})
+
+	sort.Slice(report.DeepestCollections, func(i, j int) bool {
+		a, b := report.DeepestCollections[i], report.DeepestCollections[j]
+		if a.Levels != b.Levels {
+			return a.Levels > b.Levels
+		}
+		return a.ID.Compare(b.ID) < 0
+	})
+
+	sort.Slice(report.WidestCollisionGroups, func(i, j int) bool {
+		a, b := report.WidestCollisionGroups[i], report.WidestCollisionGroups[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Level != b.Level {
+			return a.Level > b.Level
+		}
+		return a.ID.Compare(b.ID) < 0
+	})
+
+	if len(report.LargestSlabs) > topN {
+		report.LargestSlabs = report.LargestSlabs[:topN]
+	}
+	if len(report.DeepestCollections) > topN {
+		report.DeepestCollections = report.DeepestCollections[:topN]
+	}
+	if len(report.WidestCollisionGroups) > topN {
+		report.WidestCollisionGroups = report.WidestCollisionGroups[:topN]
+	}
+
+	return report, nil
+}
+
+func isCollectionRootSlab(slab Slab) bool {
+	switch slab := slab.(type) {
+	case ArraySlab:
+		return slab.ExtraData() != nil
+	case MapSlab:
+		return slab.ExtraData() != nil
+	default:
+		return false
+	}
+}
+
+// slabTreeLevels returns number of levels in slab tree rooted at slab.
+// Slab trees are balanced, so the leftmost path is followed.
+func slabTreeLevels(storage SlabStorage, slab Slab) (int, error) {
+	levels := 1
+	for {
+		var childID StorageID
+		switch slab := slab.(type) {
+		case *ArrayMetaDataSlab:
+			childID = slab.childrenHeaders[0].id
+		case *MapMetaDataSlab:
+			childID = slab.childrenHeaders[0].id
+		default:
+			return levels, nil
+		}
+
+		child, found, err := storage.Retrieve(childID)
+		if err != nil {
+			return 0, err
+		}
+		if !found {
+			return 0, NewSlabNotFoundErrorf(childID, "slab not found during storage report")
+		}
+
+		slab = child
+		levels++
+	}
+}
+
+// appendCollisionGroups appends collision groups in elems, including
+// nested collision groups, to groups.
+func appendCollisionGroups(groups []CollisionGroupEntry, storage SlabStorage, id StorageID, elems elements) ([]CollisionGroupEntry, error) {
+	level := 0
+	elementGroups := []elements{elems}
+
+	for len(elementGroups) > 0 {
+		level++
+
+		var nestedElementGroups []elements
+
+		for _, elems := range elementGroups {
+			for i := 0; i < int(elems.Count()); i++ {
+				elem, err := elems.Element(i)
+				if err != nil {
+					return nil, err
+				}
+
+				group, ok := elem.(elementGroup)
+				if !ok {
+					continue
+				}
+
+				nested, err := group.Elements(storage)
+				if err != nil {
+					return nil, err
+				}
+
+				groups = append(groups, CollisionGroupEntry{
+					ID:       id,
+					Level:    level,
+					Count:    nested.Count(),
+					External: !group.Inline(),
+				})
+
+				nestedElementGroups = append(nestedElementGroups, nested)
+			}
+		}
+
+		elementGroups = nestedElementGroups
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageReport(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// Array with multi-level slab tree.
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	for i := uint64(0); i < 2000; i++ {
+		require.NoError(t, array.Append(Uint64Value(i)))
+	}
+
+	arrayStats, err := GetArrayStats(array)
+	require.NoError(t, err)
+	require.True(t, arrayStats.Levels > 1)
+
+	// Map with collision groups at level 1 and level 2.
+	digesterBuilder := &mockDigesterBuilder{}
+	m, err := NewMap(storage, address, digesterBuilder, typeInfo)
+	require.NoError(t, err)
+
+	digests := [][]Digest{
+		{1, 10},
+		{1, 20},
+		{1, 20},
+		{1, 30},
+		{2, 0},
+		{3, 0},
+		{3, 1},
+	}
+	for i, d := range digests {
+		k := Uint64Value(i)
+		digesterBuilder.On("Digest", k).Return(mockDigester{d})
+
+		_, err := m.Set(compare, hashInputProvider, k, k)
+		require.NoError(t, err)
+	}
+
+	// Large string stored in its own slab.
+	large := NewStringValue(strings.Repeat("a", 1024))
+	k := Uint64Value(len(digests))
+	digesterBuilder.On("Digest", k).Return(mockDigester{[]Digest{4, 0}})
+	_, err = m.Set(compare, hashInputProvider, k, large)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Commit())
+
+	report, err := NewStorageReport(storage, 2)
+	require.NoError(t, err)
+
+	require.Equal(t, storage.Count(), report.SlabCount)
+
+	require.Equal(t, 2, len(report.LargestSlabs))
+	require.True(t, report.LargestSlabs[0].Size > 1024)
+	require.True(t, report.LargestSlabs[0].Size >= report.LargestSlabs[1].Size)
+
+	require.Equal(t,
+		[]CollectionLevelsEntry{
+			{ID: array.StorageID(), Levels: int(arrayStats.Levels)},
+			{ID: m.StorageID(), Levels: 1},
+		},
+		report.DeepestCollections,
+	)
+
+	require.Equal(t,
+		[]CollisionGroupEntry{
+			{ID: m.StorageID(), Level: 1, Count: 3},
+			{ID: m.StorageID(), Level: 2, Count: 2},
+		},
+		report.WidestCollisionGroups,
+	)
+
+	// All collision groups are reported if topN is large enough.
+	report, err = NewStorageReport(storage, 10)
+	require.NoError(t, err)
+
+	require.Equal(t,
+		[]CollisionGroupEntry{
+			{ID: m.StorageID(), Level: 1, Count: 3},
+			{ID: m.StorageID(), Level: 2, Count: 2},
+			{ID: m.StorageID(), Level: 1, Count: 2},
+		},
+		report.WidestCollisionGroups,
+	)
+}
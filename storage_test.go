@@ -19,6 +19,7 @@
 package atree
 
 import (
+	"encoding/json"
 	"errors"
 	"math/rand"
 	"runtime"
@@ -207,6 +208,76 @@ func TestStorageIDCompare(t *testing.T) {
 	})
 }
 
+func TestStorageIDParse(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		ids := []StorageID{
+			StorageIDUndefined,
+			NewStorageID(Address{1, 2, 3, 4, 5, 6, 7, 8}, StorageIndex{0, 0, 0, 0, 0, 0, 0, 1}),
+			NewStorageID(Address{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, StorageIndex{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}),
+		}
+		for _, id := range ids {
+			parsed, err := ParseStorageID(id.String())
+			require.NoError(t, err)
+			require.Equal(t, id, parsed)
+		}
+	})
+
+	t.Run("without prefix", func(t *testing.T) {
+		id, err := ParseStorageID("102030405060708.1")
+		require.NoError(t, err)
+		require.Equal(t, NewStorageID(Address{1, 2, 3, 4, 5, 6, 7, 8}, StorageIndex{0, 0, 0, 0, 0, 0, 0, 1}), id)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{"", "0x1", "0xg.1", "0x1.a", "0x1.-1", "0x10000000000000000.1", ".1", "0x.1", "0x1.18446744073709551616"} {
+			_, err := ParseStorageID(s)
+			var storageIDError *StorageIDError
+			require.ErrorAs(t, err, &storageIDError, s)
+		}
+	})
+}
+
+func TestStorageIDMarshal(t *testing.T) {
+	id := NewStorageID(Address{1, 2, 3, 4, 5, 6, 7, 8}, StorageIndex{0, 0, 0, 0, 0, 0, 0, 9})
+
+	t.Run("text", func(t *testing.T) {
+		text, err := id.MarshalText()
+		require.NoError(t, err)
+		require.Equal(t, "0x102030405060708.9", string(text))
+
+		var decoded StorageID
+		err = decoded.UnmarshalText(text)
+		require.NoError(t, err)
+		require.Equal(t, id, decoded)
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		data, err := id.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0, 0, 0, 0, 9}, data)
+
+		var decoded StorageID
+		err = decoded.UnmarshalBinary(data)
+		require.NoError(t, err)
+		require.Equal(t, id, decoded)
+
+		err = decoded.UnmarshalBinary(data[1:])
+		var storageIDError *StorageIDError
+		require.ErrorAs(t, err, &storageIDError)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := json.Marshal(map[StorageID]StorageID{id: id})
+		require.NoError(t, err)
+		require.Equal(t, `{"0x102030405060708.9":"0x102030405060708.9"}`, string(data))
+
+		var decoded map[StorageID]StorageID
+		err = json.Unmarshal(data, &decoded)
+		require.NoError(t, err)
+		require.Equal(t, map[StorageID]StorageID{id: id}, decoded)
+	})
+}
+
 func TestLedgerBaseStorageStore(t *testing.T) {
 	ledger := newTestLedger()
 	baseStorage := NewLedgerBaseStorage(ledger)
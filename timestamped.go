@@ -0,0 +1,189 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const CBORTagTimestampedValue = 250
+
+// TimestampedValue is a value with last-writer-wins metadata, used as
+// map value merged with LastWriterWins resolver.  Timestamp orders writes
+// (e.g. Lamport clock or wall clock), and Replica breaks ties between
+// writes with the same timestamp made by different replicas.
+type TimestampedValue struct {
+	Timestamp uint64
+	Replica   uint64
+	Value     Value
+}
+
+var _ Value = TimestampedValue{}
+
+func (v TimestampedValue) Storable(storage SlabStorage, address Address, maxInlineSize uint64) (Storable, error) {
+
+	// tag number (2 bytes) + array head (1 byte) + timestamp + replica
+	overhead := 3 + uint64(GetUintCBORSize(v.Timestamp)) + uint64(GetUintCBORSize(v.Replica))
+
+	if maxInlineSize < overhead {
+		maxInlineSize = overhead
+	}
+
+	valueStorable, err := v.Value.Storable(
+		storage,
+		address,
+		maxInlineSize-overhead,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return TimestampedStorable{
+		Timestamp: v.Timestamp,
+		Replica:   v.Replica,
+		Storable:  valueStorable,
+	}, nil
+}
+
+func (v TimestampedValue) String() string {
+	return fmt.Sprintf("%s@%d.%d", v.Value, v.Timestamp, v.Replica)
+}
+
+// TimestampedStorable is the storable of TimestampedValue.
+type TimestampedStorable struct {
+	Timestamp uint64
+	Replica   uint64
+	Storable  Storable
+}
+
+var _ Storable = TimestampedStorable{}
+
+func (v TimestampedStorable) ByteSize() uint32 {
+	// tag number (2 bytes) + array head (1 byte) + timestamp + replica + encoded content
+	return 3 + GetUintCBORSize(v.Timestamp) + GetUintCBORSize(v.Replica) + v.Storable.ByteSize()
+}
+
+// Encode encodes TimestampedStorable as
+// cbor.Tag{
+//		Number:  CBORTagTimestampedValue,
+//		Content: []interface{}{timestamp, replica, Storable(v)},
+// }
+func (v TimestampedStorable) Encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagTimestampedValue,
+		// array head of 3 elements
+		0x83,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = enc.CBOR.EncodeUint64(v.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	err = enc.CBOR.EncodeUint64(v.Replica)
+	if err != nil {
+		return err
+	}
+
+	return v.Storable.Encode(enc)
+}
+
+func (v TimestampedStorable) ChildStorables() []Storable {
+	return []Storable{v.Storable}
+}
+
+func (v TimestampedStorable) StoredValue(storage SlabStorage) (Value, error) {
+	wv, err := v.Storable.StoredValue(storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return TimestampedValue{
+		Timestamp: v.Timestamp,
+		Replica:   v.Replica,
+		Value:     wv,
+	}, nil
+}
+
+func (v TimestampedStorable) String() string {
+	return fmt.Sprintf("%s@%d.%d", v.Storable, v.Timestamp, v.Replica)
+}
+
+// DecodeTimestampedStorable decodes TimestampedStorable after
+// CBORTagTimestampedValue is decoded.
+// Wrapped storable is decoded by decodeStorable.
+func DecodeTimestampedStorable(dec *cbor.StreamDecoder, id StorageID, decodeStorable StorableDecoder) (Storable, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != 3 {
+		return nil, NewDecodingErrorf("timestamped value has invalid array length %d, want 3", length)
+	}
+
+	timestamp, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	replica, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	storable, err := decodeStorable(dec, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return TimestampedStorable{
+		Timestamp: timestamp,
+		Replica:   replica,
+		Storable:  storable,
+	}, nil
+}
+
+// NewTimestampedValueComparator returns ValueComparator that compares
+// TimestampedValue with TimestampedStorable by comparing metadata and
+// wrapped value.  Other values are compared by comparator.
+func NewTimestampedValueComparator(comparator ValueComparator) ValueComparator {
+	return func(storage SlabStorage, value Value, storable Storable) (bool, error) {
+		v, ok := value.(TimestampedValue)
+		if !ok {
+			return comparator(storage, value, storable)
+		}
+
+		other, ok := storable.(TimestampedStorable)
+		if !ok {
+			return false, nil
+		}
+
+		if v.Timestamp != other.Timestamp || v.Replica != other.Replica {
+			return false, nil
+		}
+
+		return comparator(storage, v.Value, other.Storable)
+	}
+}
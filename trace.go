@@ -0,0 +1,257 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// TraceOp is kind of traced slab access.
+type TraceOp uint8
+
+const (
+	TraceRetrieve TraceOp = iota
+	TraceStore
+	TraceRemove
+)
+
+func (op TraceOp) String() string {
+	switch op {
+	case TraceRetrieve:
+		return "retrieve"
+	case TraceStore:
+		return "store"
+	case TraceRemove:
+		return "remove"
+	default:
+		return fmt.Sprintf("TraceOp(%d)", uint8(op))
+	}
+}
+
+// TraceEvent is slab access recorded by TracingBaseStorage.
+// Size is byte size of retrieved or stored slab, and zero for
+// removes and retrieves of missing slabs.
+type TraceEvent struct {
+	Op   TraceOp
+	ID   StorageID
+	Size int
+}
+
+// Trace is ordered sequence of slab accesses.
+type Trace []TraceEvent
+
+// TracingBaseStorage is BaseStorage recording slab accesses to wrapped
+// base storage.  Traces of realistic workloads can be replayed against
+// other base storages with ReplayTrace to benchmark them.
+type TracingBaseStorage struct {
+	BaseStorage
+	mu    sync.Mutex
+	trace Trace
+}
+
+var _ BaseStorage = &TracingBaseStorage{}
+
+// NewTracingBaseStorage returns TracingBaseStorage wrapping base.
+func NewTracingBaseStorage(base BaseStorage) *TracingBaseStorage {
+	return &TracingBaseStorage{BaseStorage: base}
+}
+
+func (s *TracingBaseStorage) Retrieve(id StorageID) ([]byte, bool, error) {
+	data, found, err := s.BaseStorage.Retrieve(id)
+	if err == nil {
+		s.record(TraceRetrieve, id, len(data))
+	}
+	return data, found, err
+}
+
+func (s *TracingBaseStorage) Store(id StorageID, data []byte) error {
+	err := s.BaseStorage.Store(id, data)
+	if err == nil {
+		s.record(TraceStore, id, len(data))
+	}
+	return err
+}
+
+func (s *TracingBaseStorage) Remove(id StorageID) error {
+	err := s.BaseStorage.Remove(id)
+	if err == nil {
+		s.record(TraceRemove, id, 0)
+	}
+	return err
+}
+
+func (s *TracingBaseStorage) record(op TraceOp, id StorageID, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trace = append(s.trace, TraceEvent{Op: op, ID: id, Size: size})
+}
+
+// Trace returns slab accesses recorded since storage was created or
+// trace was reset.
+func (s *TracingBaseStorage) Trace() Trace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(Trace(nil), s.trace...)
+}
+
+// ResetTrace discards recorded slab accesses.
+func (s *TracingBaseStorage) ResetTrace() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trace = nil
+}
+
+// WriteTo writes trace to w in binary format read by ReadTrace.  Each
+// event is encoded as op (1 byte), storage ID (16 bytes), and size
+// (uvarint).
+func (t Trace) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	var n int64
+	var buf [1 + storageIDSize + binary.MaxVarintLen64]byte
+	for _, e := range t {
+		buf[0] = byte(e.Op)
+		_, err := e.ID.ToRawBytes(buf[1:])
+		if err != nil {
+			return n, err
+		}
+		size := 1 + storageIDSize + binary.PutUvarint(buf[1+storageIDSize:], uint64(e.Size))
+
+		written, err := bw.Write(buf[:size])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, bw.Flush()
+}
+
+// ReadTrace reads trace written by Trace.WriteTo from r.
+func ReadTrace(r io.Reader) (Trace, error) {
+	br := bufio.NewReader(r)
+
+	var trace Trace
+	var buf [1 + storageIDSize]byte
+	for {
+		_, err := io.ReadFull(br, buf[:1])
+		if err == io.EOF {
+			return trace, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.ReadFull(br, buf[1:])
+		if err != nil {
+			return nil, NewDecodingErrorf("failed to read trace event %d: %s", len(trace), err)
+		}
+
+		op := TraceOp(buf[0])
+		if op > TraceRemove {
+			return nil, NewDecodingErrorf("trace event %d has invalid op %d", len(trace), buf[0])
+		}
+
+		id, err := NewStorageIDFromRawBytes(buf[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, NewDecodingErrorf("failed to read trace event %d: %s", len(trace), err)
+		}
+
+		trace = append(trace, TraceEvent{Op: op, ID: id, Size: int(size)})
+	}
+}
+
+// ReplayResult is result of ReplayTrace.
+type ReplayResult struct {
+	Retrieves int
+	Stores    int
+	Removes   int
+	// Missing is number of retrieved slabs not found in base storage.
+	Missing int
+	// BytesRetrieved is number of bytes retrieved from base storage.
+	BytesRetrieved int
+	// BytesStored is number of bytes stored to base storage.
+	BytesStored int
+	Duration    time.Duration
+}
+
+// ReplayTrace re-issues retrieves of trace against base, in trace order.
+// If writes is true, stores and removes are re-issued too, with stored
+// data of recorded size and zero bytes as content.  Stores overwrite
+// slabs in base, so writes should only be replayed against scratch
+// storage.
+func ReplayTrace(base BaseStorage, trace Trace, writes bool) (ReplayResult, error) {
+	var result ReplayResult
+	var data []byte
+
+	start := time.Now()
+
+	for _, e := range trace {
+		switch e.Op {
+		case TraceRetrieve:
+			retrieved, found, err := base.Retrieve(e.ID)
+			if err != nil {
+				return result, NewStorageError(err)
+			}
+			result.Retrieves++
+			result.BytesRetrieved += len(retrieved)
+			if !found {
+				result.Missing++
+			}
+
+		case TraceStore:
+			if !writes {
+				continue
+			}
+			if cap(data) < e.Size {
+				data = make([]byte, e.Size)
+			}
+			err := base.Store(e.ID, data[:e.Size])
+			if err != nil {
+				return result, NewStorageError(err)
+			}
+			result.Stores++
+			result.BytesStored += e.Size
+
+		case TraceRemove:
+			if !writes {
+				continue
+			}
+			err := base.Remove(e.ID)
+			if err != nil {
+				return result, NewStorageError(err)
+			}
+			result.Removes++
+		}
+	}
+
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
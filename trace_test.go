@@ -0,0 +1,124 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	base := NewTracingBaseStorage(NewInMemBaseStorage())
+	storage := newTestPersistentStorageWithBaseStorage(t, base)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 200; i++ {
+		require.NoError(t, array.Append(Uint64Value(i)))
+	}
+
+	require.NoError(t, storage.Commit())
+
+	stores := base.Trace()
+	require.True(t, len(stores) > 1)
+	for _, e := range stores {
+		require.Equal(t, TraceStore, e.Op)
+		require.Equal(t, address, e.ID.Address)
+		require.True(t, e.Size > 0)
+	}
+
+	base.ResetTrace()
+	require.Empty(t, base.Trace())
+
+	// Read array with empty cache to trace retrieves.
+	storage = newTestPersistentStorageWithBaseStorage(t, base)
+
+	array, err = NewArrayWithRootID(storage, array.StorageID())
+	require.NoError(t, err)
+
+	err = array.Iterate(func(Value) (bool, error) { return true, nil })
+	require.NoError(t, err)
+
+	trace := base.Trace()
+	require.Equal(t, len(stores), len(trace))
+	for _, e := range stores {
+		if e.ID == array.StorageID() {
+			require.Equal(t, TraceEvent{Op: TraceRetrieve, ID: e.ID, Size: e.Size}, trace[0])
+		}
+	}
+
+	t.Run("encode", func(t *testing.T) {
+		recorded := append(Trace(nil), stores...)
+		recorded = append(recorded, trace...)
+		recorded = append(recorded, TraceEvent{Op: TraceRemove, ID: array.StorageID()})
+
+		var buf bytes.Buffer
+		n, err := recorded.WriteTo(&buf)
+		require.NoError(t, err)
+		require.Equal(t, int64(buf.Len()), n)
+
+		decoded, err := ReadTrace(&buf)
+		require.NoError(t, err)
+		require.Equal(t, recorded, decoded)
+
+		_, err = ReadTrace(bytes.NewReader([]byte{byte(TraceRemove), 1, 2}))
+		require.Error(t, err)
+
+		_, err = ReadTrace(bytes.NewReader(append([]byte{0xff}, make([]byte, 17)...)))
+		require.Error(t, err)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		result, err := ReplayTrace(base, trace, false)
+		require.NoError(t, err)
+		require.Equal(t, len(trace), result.Retrieves)
+		require.Equal(t, 0, result.Missing)
+		require.Equal(t, 0, result.Stores)
+
+		bytesRetrieved := 0
+		for _, e := range trace {
+			bytesRetrieved += e.Size
+		}
+		require.Equal(t, bytesRetrieved, result.BytesRetrieved)
+
+		// Replay workload with writes against scratch storage.
+		scratch := NewInMemBaseStorage()
+
+		result, err = ReplayTrace(scratch, trace, true)
+		require.NoError(t, err)
+		require.Equal(t, len(trace), result.Missing)
+
+		workload := append(append(Trace(nil), stores...), trace...)
+		result, err = ReplayTrace(scratch, workload, true)
+		require.NoError(t, err)
+		require.Equal(t, len(stores), result.Stores)
+		require.Equal(t, 0, result.Missing)
+		require.Equal(t, bytesRetrieved, result.BytesRetrieved)
+	})
+}
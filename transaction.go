@@ -0,0 +1,128 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// storageTransaction records deltas of storage when transaction began.
+// Slabs are modified in place, so deltas are kept encoded.
+type storageTransaction struct {
+	// deltas contains encoded slabs, or nil for removed slabs.
+	deltas map[StorageID][]byte
+	// createdIDs contains IDs generated since last commit.
+	createdIDs map[StorageID]struct{}
+	// tempStorageIndex is last index generated for temporary slabs.
+	tempStorageIndex uint64
+}
+
+// BeginTransaction starts a transaction grouping mutations of
+// collections in storage, so they can be discarded together with
+// RollbackTransaction if a higher-level operation fails. Slabs
+// modified before transaction begins are encoded, so cost of
+// BeginTransaction grows with uncommitted changes. Transactions
+// can't be nested, and storage can't be committed while transaction
+// is active.
+func (s *PersistentSlabStorage) BeginTransaction() error {
+	if s.transaction != nil {
+		return NewUserError(NewTransactionErrorf("transaction is already active"))
+	}
+
+	deltas := make(map[StorageID][]byte, len(s.deltas))
+	for id, slab := range s.deltas {
+		if slab == nil {
+			deltas[id] = nil
+			continue
+		}
+
+		data, err := Encode(slab, s.cborEncMode)
+		if err != nil {
+			return NewEncodingError(err)
+		}
+		deltas[id] = data
+	}
+
+	createdIDs := make(map[StorageID]struct{}, len(s.createdIDs))
+	for id := range s.createdIDs {
+		createdIDs[id] = struct{}{}
+	}
+
+	s.transaction = &storageTransaction{
+		deltas:           deltas,
+		createdIDs:       createdIDs,
+		tempStorageIndex: s.tempStorageIndex,
+	}
+	return nil
+}
+
+// InTransaction returns true if transaction is active.
+func (s *PersistentSlabStorage) InTransaction() bool {
+	return s.transaction != nil
+}
+
+// CommitTransaction ends active transaction, keeping its mutations.
+// Mutations are written to base storage by next Commit or FastCommit.
+func (s *PersistentSlabStorage) CommitTransaction() error {
+	if s.transaction == nil {
+		return NewUserError(NewTransactionErrorf("no active transaction to commit"))
+	}
+
+	s.transaction = nil
+	return nil
+}
+
+// RollbackTransaction ends active transaction, discarding slabs stored
+// and removed since transaction began. Collections loaded before
+// rollback refer to discarded slabs, so they must be loaded again with
+// NewArrayWithRootID or NewMapWithRootID.
+//
+// Indexes of temporary slabs generated in transaction are reused after
+// rollback.  Indexes generated by base storage can't be returned to it,
+// so they are skipped: slabs created after rollback get new indexes.
+//
+// Recorded slabs are decoded before storage is modified, so if decoding
+// fails, storage and active transaction are left unchanged.
+func (s *PersistentSlabStorage) RollbackTransaction() error {
+	if s.transaction == nil {
+		return NewUserError(NewTransactionErrorf("no active transaction to roll back"))
+	}
+
+	deltas := make(map[StorageID]Slab, len(s.transaction.deltas))
+	for id, data := range s.transaction.deltas {
+		if data == nil {
+			deltas[id] = nil
+			continue
+		}
+
+		slab, err := DecodeSlab(id, data, s.cborDecMode, s.DecodeStorable, s.DecodeTypeInfo)
+		if err != nil {
+			return NewDecodingError(err)
+		}
+		deltas[id] = slab
+	}
+
+	// Cached slabs modified in transaction are reloaded from base storage.
+	for id := range s.deltas {
+		delete(s.cache, id)
+	}
+
+	// IDs generated in transaction are discarded with their slabs.
+	s.deltas = deltas
+	s.createdIDs = s.transaction.createdIDs
+	s.tempStorageIndex = s.transaction.tempStorageIndex
+	s.transaction = nil
+	return nil
+}
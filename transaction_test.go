@@ -0,0 +1,242 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageTransactionRollback(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	const arraySize = 512
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	values := make([]Value, 0, arraySize*2)
+	for i := uint64(0); i < arraySize; i++ {
+		v := Uint64Value(i)
+		err = array.Append(v)
+		require.NoError(t, err)
+		values = append(values, v)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Uncommitted mutations made before transaction are kept by rollback.
+	for i := uint64(0); i < arraySize; i++ {
+		v := Uint64Value(arraySize + i)
+		err = array.Append(v)
+		require.NoError(t, err)
+		values = append(values, v)
+	}
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	keyValues := make(map[Value]Value)
+	for i := uint64(0); i < arraySize; i++ {
+		k, v := Uint64Value(i), Uint64Value(i*2)
+		_, err = m.Set(compare, hashInputProvider, k, v)
+		require.NoError(t, err)
+		keyValues[k] = v
+	}
+
+	err = storage.BeginTransaction()
+	require.NoError(t, err)
+	require.True(t, storage.InTransaction())
+
+	for i := uint64(0); i < arraySize; i++ {
+		_, err = array.Set(i, Uint64Value(i*10))
+		require.NoError(t, err)
+	}
+	for i := uint64(0); i < arraySize; i++ {
+		_, err = array.Remove(array.Count() - 1)
+		require.NoError(t, err)
+	}
+
+	nested, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	err = array.Append(nested)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < arraySize; i += 2 {
+		_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(i))
+		require.NoError(t, err)
+	}
+
+	temp, err := NewArray(storage, AddressUndefined, typeInfo)
+	require.NoError(t, err)
+
+	err = storage.RollbackTransaction()
+	require.NoError(t, err)
+	require.False(t, storage.InTransaction())
+
+	// Temporary index generated in transaction is reused.
+	tempID, err := storage.GenerateStorageID(AddressUndefined)
+	require.NoError(t, err)
+	require.Equal(t, temp.StorageID(), tempID)
+
+	array, err = NewArrayWithRootID(storage, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(values)), array.Count())
+
+	i := 0
+	err = array.Iterate(func(v Value) (bool, error) {
+		valueEqual(t, typeInfoComparator, values[i], v)
+		i++
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, len(values), i)
+
+	m, err = NewMapWithRootID(storage, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(keyValues)), m.Count())
+
+	for k, v := range keyValues {
+		s, err := m.Get(compare, hashInputProvider, k)
+		require.NoError(t, err)
+
+		e, err := s.StoredValue(storage)
+		require.NoError(t, err)
+		valueEqual(t, typeInfoComparator, v, e)
+	}
+
+	// Nested array created in transaction is gone.
+	rootIDs, err := CheckStorageHealth(storage, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(rootIDs))
+
+	// Slabs kept by rollback are committed.
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	array2, err := NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(values)), array2.Count())
+
+	for i, v := range values {
+		s, err := array2.Get(uint64(i))
+		require.NoError(t, err)
+
+		e, err := s.StoredValue(storage2)
+		require.NoError(t, err)
+		valueEqual(t, typeInfoComparator, v, e)
+	}
+}
+
+func TestStorageTransactionCommit(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	err = storage.BeginTransaction()
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(1))
+	require.NoError(t, err)
+
+	// Storage can't be committed while transaction is active.
+	var transactionError *TransactionError
+
+	err = storage.Commit()
+	require.ErrorAs(t, err, &transactionError)
+
+	err = storage.FastCommit(2)
+	require.ErrorAs(t, err, &transactionError)
+
+	// Transactions can't be nested.
+	err = storage.BeginTransaction()
+	require.ErrorAs(t, err, &transactionError)
+
+	err = storage.CommitTransaction()
+	require.NoError(t, err)
+
+	err = storage.CommitTransaction()
+	require.ErrorAs(t, err, &transactionError)
+
+	err = storage.RollbackTransaction()
+	require.ErrorAs(t, err, &transactionError)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	verifyArray(t, storage, typeInfo, address, array, []Value{Uint64Value(1)}, false)
+}
+
+func TestStorageTransactionRollbackDecodeError(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(0))
+	require.NoError(t, err)
+
+	err = storage.BeginTransaction()
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(1))
+	require.NoError(t, err)
+
+	// Corrupt recorded slab, so that it can't be decoded.
+	storage.transaction.deltas[array.StorageID()] = []byte{0}
+
+	err = storage.RollbackTransaction()
+	require.Error(t, err)
+
+	var decodingError *DecodingError
+	require.ErrorAs(t, err, &decodingError)
+	require.True(t, IsFatalError(err))
+
+	// Storage and transaction are unchanged.
+	require.True(t, storage.InTransaction())
+	require.Equal(t, uint64(2), array.Count())
+
+	err = storage.CommitTransaction()
+	require.NoError(t, err)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	verifyArray(t, storage, typeInfo, address, array, []Value{Uint64Value(0), Uint64Value(1)}, false)
+}
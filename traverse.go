@@ -0,0 +1,84 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "fmt"
+
+// PathElement identifies element of collection in path from root value.
+type PathElement struct {
+	// Index is element index in parent Array.
+	Index uint64
+	// Key is element key in parent OrderedMap, or nil in parent Array.
+	Key Value
+}
+
+func (e PathElement) String() string {
+	if e.Key != nil {
+		return fmt.Sprintf("[%s]", e.Key)
+	}
+	return fmt.Sprintf("[%d]", e.Index)
+}
+
+// ValueVisitor is called by TraverseValue for each visited value with
+// path from root value.  Path is reused between calls, so it must be
+// copied to be retained.  If visited value is Array or OrderedMap,
+// returning false for descend skips its elements.
+type ValueVisitor func(path []PathElement, v Value) (descend bool, err error)
+
+// TraverseValue walks root value and, depth-first, elements of arrays and
+// maps reachable from root, including nested collections.  Map values are
+// visited in iteration order with their keys in path, keys themselves
+// aren't visited.  Elements are decoded lazily as collections are iterated,
+// so skipped collections aren't loaded.
+//
+// Traversal stops at first error returned by visitor or by iteration.
+func TraverseValue(root Value, visitor ValueVisitor) error {
+	return traverseValue(nil, root, visitor)
+}
+
+func traverseValue(path []PathElement, v Value, visitor ValueVisitor) error {
+	descend, err := visitor(path, v)
+	if err != nil || !descend {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *Array:
+		var index uint64
+		return v.Iterate(func(element Value) (bool, error) {
+			err := traverseValue(append(path, PathElement{Index: index}), element, visitor)
+			if err != nil {
+				return false, err
+			}
+			index++
+			return true, nil
+		})
+
+	case *OrderedMap:
+		return v.Iterate(func(key Value, value Value) (bool, error) {
+			err := traverseValue(append(path, PathElement{Key: key}), value, visitor)
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		})
+	}
+
+	return nil
+}
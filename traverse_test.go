@@ -0,0 +1,121 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraverseValue(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// root: [0, {1: [10, 11], 2: 20}, 3]
+	root, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	child, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	require.NoError(t, child.Append(Uint64Value(10)))
+	require.NoError(t, child.Append(Uint64Value(11)))
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), child)
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(2), Uint64Value(20))
+	require.NoError(t, err)
+
+	require.NoError(t, root.Append(Uint64Value(0)))
+	require.NoError(t, root.Append(m))
+	require.NoError(t, root.Append(Uint64Value(3)))
+
+	pathString := func(path []PathElement) string {
+		s := "$"
+		for _, e := range path {
+			s += e.String()
+		}
+		return s
+	}
+
+	t.Run("all", func(t *testing.T) {
+		visited := make(map[string]string)
+		err := TraverseValue(root, func(path []PathElement, v Value) (bool, error) {
+			switch v.(type) {
+			case *Array:
+				visited[pathString(path)] = "array"
+			case *OrderedMap:
+				visited[pathString(path)] = "map"
+			default:
+				visited[pathString(path)] = fmt.Sprint(v)
+			}
+			return true, nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t,
+			map[string]string{
+				"$":          "array",
+				"$[0]":       "0",
+				"$[1]":       "map",
+				"$[1][1]":    "array",
+				"$[1][1][0]": "10",
+				"$[1][1][1]": "11",
+				"$[1][2]":    "20",
+				"$[2]":       "3",
+			},
+			visited,
+		)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		var visited []string
+		err := TraverseValue(root, func(path []PathElement, v Value) (bool, error) {
+			visited = append(visited, pathString(path))
+			_, isMap := v.(*OrderedMap)
+			return !isMap, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"$", "$[0]", "$[1]", "$[2]"}, visited)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		testErr := errors.New("test")
+
+		count := 0
+		err := TraverseValue(root, func(path []PathElement, v Value) (bool, error) {
+			count++
+			if len(path) == 3 {
+				return false, testErr
+			}
+			return true, nil
+		})
+		require.ErrorIs(t, err, testErr)
+		require.Equal(t, 5, count)
+	})
+}
@@ -32,3 +32,7 @@ type TypeInfoDecoder func(
 	TypeInfo,
 	error,
 )
+
+// TypeInfoCompatibilityChecker returns true if collection of type info
+// oldTypeInfo can be changed to newTypeInfo without modifying its elements.
+type TypeInfoCompatibilityChecker func(oldTypeInfo TypeInfo, newTypeInfo TypeInfo) bool
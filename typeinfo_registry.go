@@ -0,0 +1,428 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// CBORTagTypeInfoRef is CBOR tag number of RegisteredTypeInfo references.
+	CBORTagTypeInfoRef = 251
+
+	// maxRegisteredTypeInfoCount is maximum number of type infos in TypeInfoRegistry.
+	maxRegisteredTypeInfoCount = math.MaxUint16 + 1
+
+	// maxTypeInfoRegistrySize is maximum byte size of TypeInfoRegistry slab.
+	// Registry is stored in a single slab without size limit, which is
+	// loaded and encoded as a whole, so its size is bounded.
+	maxTypeInfoRegistrySize = 64 * 1024
+)
+
+// RegisteredTypeInfo is TypeInfo registered in TypeInfoRegistry.
+// It is encoded as a small reference to registry entry instead of
+// encoded TypeInfo.
+type RegisteredTypeInfo struct {
+	ID       uint16
+	TypeInfo TypeInfo
+}
+
+var _ TypeInfo = RegisteredTypeInfo{}
+
+// Encode encodes RegisteredTypeInfo as
+//
+//   CBOR tag (number: CBORTagTypeInfoRef, content: registry ID)
+//
+func (t RegisteredTypeInfo) Encode(enc *cbor.StreamEncoder) error {
+	err := enc.EncodeRawBytes([]byte{
+		// tag number CBORTagTypeInfoRef
+		0xd8, CBORTagTypeInfoRef,
+	})
+	if err != nil {
+		return err
+	}
+
+	return enc.EncodeUint16(t.ID)
+}
+
+func (t RegisteredTypeInfo) String() string {
+	return fmt.Sprintf("RegisteredTypeInfo(%d, %v)", t.ID, t.TypeInfo)
+}
+
+// TypeInfoRegistry maps type infos to small IDs.  Registered type infos
+// are persisted in a dedicated root slab, so that extra data of collections
+// created with RegisteredTypeInfo only contains references to the registry.
+//
+// Storage must decode type infos with TypeInfoDecoder returned by the
+// registry to resolve references, e.g.
+//
+//   storage.DecodeTypeInfo = registry.TypeInfoDecoder(storage.DecodeTypeInfo)
+//
+type TypeInfoRegistry struct {
+	storage SlabStorage
+	slab    *TypeInfoRegistrySlab
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+	// ids maps encoded type info to registry ID.
+	ids map[string]uint16
+}
+
+// NewTypeInfoRegistry creates empty TypeInfoRegistry in a new slab at given address.
+func NewTypeInfoRegistry(
+	storage SlabStorage,
+	address Address,
+	encMode cbor.EncMode,
+	decMode cbor.DecMode,
+) (*TypeInfoRegistry, error) {
+
+	id, err := storage.GenerateStorageID(address)
+	if err != nil {
+		return nil, err
+	}
+
+	slab := &TypeInfoRegistrySlab{
+		id:   id,
+		size: typeInfoRegistrySlabPrefixSize,
+	}
+
+	err = storage.Store(id, slab)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypeInfoRegistry{
+		storage: storage,
+		slab:    slab,
+		encMode: encMode,
+		decMode: decMode,
+		ids:     make(map[string]uint16),
+	}, nil
+}
+
+// NewTypeInfoRegistryWithID returns TypeInfoRegistry stored in slab with given id.
+func NewTypeInfoRegistryWithID(
+	storage SlabStorage,
+	id StorageID,
+	encMode cbor.EncMode,
+	decMode cbor.DecMode,
+) (*TypeInfoRegistry, error) {
+
+	s, found, err := storage.Retrieve(id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NewSlabNotFoundErrorf(id, "type info registry slab not found")
+	}
+
+	slab, ok := s.(*TypeInfoRegistrySlab)
+	if !ok {
+		return nil, NewSlabDataErrorf("slab %s isn't TypeInfoRegistrySlab", id)
+	}
+
+	r := &TypeInfoRegistry{
+		storage: storage,
+		slab:    slab,
+		encMode: encMode,
+		decMode: decMode,
+		ids:     make(map[string]uint16, len(slab.typeInfos)),
+	}
+
+	for i, typeInfo := range slab.typeInfos {
+		key, err := r.encodeTypeInfo(typeInfo)
+		if err != nil {
+			return nil, err
+		}
+		r.ids[string(key)] = uint16(i)
+	}
+
+	return r, nil
+}
+
+// ID returns storage ID of registry slab.
+func (r *TypeInfoRegistry) ID() StorageID {
+	return r.slab.id
+}
+
+// Count returns number of registered type infos.
+func (r *TypeInfoRegistry) Count() int {
+	return len(r.slab.typeInfos)
+}
+
+// Register returns RegisteredTypeInfo of given type info, registering it
+// if it isn't registered yet.  Type infos with the same encoding share ID.
+// New type info can't be registered once registry reaches maximum number
+// of type infos or maximum byte size.
+func (r *TypeInfoRegistry) Register(typeInfo TypeInfo) (RegisteredTypeInfo, error) {
+	if registered, ok := typeInfo.(RegisteredTypeInfo); ok {
+		typeInfo = registered.TypeInfo
+	}
+
+	key, err := r.encodeTypeInfo(typeInfo)
+	if err != nil {
+		return RegisteredTypeInfo{}, err
+	}
+
+	if id, ok := r.ids[string(key)]; ok {
+		return RegisteredTypeInfo{ID: id, TypeInfo: r.slab.typeInfos[id]}, nil
+	}
+
+	if len(r.slab.typeInfos) >= maxRegisteredTypeInfoCount {
+		return RegisteredTypeInfo{}, NewUserError(NewTypeInfoRegistryErrorf(
+			"registry %s has %d type infos, can't register more",
+			r.slab.id,
+			len(r.slab.typeInfos),
+		))
+	}
+
+	if uint64(r.slab.size)+uint64(len(key)) > maxTypeInfoRegistrySize {
+		return RegisteredTypeInfo{}, NewUserError(NewTypeInfoRegistryErrorf(
+			"registry %s has %d bytes, can't register type info of %d bytes",
+			r.slab.id,
+			r.slab.size,
+			len(key),
+		))
+	}
+
+	id := uint16(len(r.slab.typeInfos))
+
+	r.slab.typeInfos = append(r.slab.typeInfos, typeInfo)
+	r.slab.size += uint32(len(key))
+	r.ids[string(key)] = id
+
+	// Store registry slab to mark it modified
+	err = r.storage.Store(r.slab.id, r.slab)
+	if err != nil {
+		return RegisteredTypeInfo{}, err
+	}
+
+	return RegisteredTypeInfo{ID: id, TypeInfo: typeInfo}, nil
+}
+
+// Lookup returns RegisteredTypeInfo with given registry ID.
+func (r *TypeInfoRegistry) Lookup(id uint16) (RegisteredTypeInfo, error) {
+	if int(id) >= len(r.slab.typeInfos) {
+		return RegisteredTypeInfo{}, NewUserError(NewTypeInfoRegistryErrorf(
+			"registry %s has no type info with id %d",
+			r.slab.id,
+			id,
+		))
+	}
+	return RegisteredTypeInfo{ID: id, TypeInfo: r.slab.typeInfos[id]}, nil
+}
+
+// TypeInfoDecoder returns TypeInfoDecoder that decodes RegisteredTypeInfo
+// references using the registry, and other type infos using decodeTypeInfo.
+func (r *TypeInfoRegistry) TypeInfoDecoder(decodeTypeInfo TypeInfoDecoder) TypeInfoDecoder {
+	return func(dec *cbor.StreamDecoder) (TypeInfo, error) {
+
+		// Type info is decoded from raw bytes because tag number can't be
+		// inspected without consuming it.
+		data, err := dec.DecodeRawBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) < 2 || data[0] != 0xd8 || data[1] != CBORTagTypeInfoRef {
+			return decodeTypeInfo(r.decMode.NewByteStreamDecoder(data))
+		}
+
+		id, err := r.decMode.NewByteStreamDecoder(data[2:]).DecodeUint64()
+		if err != nil {
+			return nil, err
+		}
+
+		if id > math.MaxUint16 {
+			return nil, NewDecodingError(NewTypeInfoRegistryErrorf("type info reference %d is out of range", id))
+		}
+
+		// Unresolved reference in stored data is fatal.
+		registered, err := r.Lookup(uint16(id))
+		if err != nil {
+			return nil, NewDecodingError(err)
+		}
+		return registered, nil
+	}
+}
+
+func (r *TypeInfoRegistry) encodeTypeInfo(typeInfo TypeInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := r.encMode.NewStreamEncoder(&buf)
+
+	err := typeInfo.Encode(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// version (1 byte) + flag (1 byte) + CBOR array head (9 bytes)
+const typeInfoRegistrySlabPrefixSize = versionAndFlagSize + 9
+
+// TypeInfoRegistrySlab is root slab of TypeInfoRegistry.
+type TypeInfoRegistrySlab struct {
+	id        StorageID
+	typeInfos []TypeInfo
+	size      uint32
+}
+
+var _ Slab = &TypeInfoRegistrySlab{}
+
+func newTypeInfoRegistrySlabFromData(
+	id StorageID,
+	data []byte,
+	decMode cbor.DecMode,
+	decodeTypeInfo TypeInfoDecoder,
+) (
+	*TypeInfoRegistrySlab,
+	error,
+) {
+	// Check data length
+	if len(data) < versionAndFlagSize {
+		return nil, NewDecodingErrorf("data is too short for type info registry slab")
+	}
+
+	// Check flag
+	flag := data[1]
+	if getSlabRegistryType(flag) != slabRegistryTypeInfo {
+		return nil, NewDecodingErrorf("data has invalid flag 0x%x, want 0x%x", flag, maskTypeInfoRegistry)
+	}
+
+	dec := decMode.NewByteStreamDecoder(data[versionAndFlagSize:])
+
+	count, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, NewDecodingError(err)
+	}
+
+	if count > maxRegisteredTypeInfoCount {
+		return nil, NewDecodingErrorf("type info registry has %d type infos, want <= %d", count, maxRegisteredTypeInfoCount)
+	}
+
+	typeInfos := make([]TypeInfo, count)
+	for i := 0; i < int(count); i++ {
+		typeInfos[i], err = decodeTypeInfo(dec)
+		if err != nil {
+			return nil, NewDecodingError(err)
+		}
+	}
+
+	contentSize := uint32(len(data[versionAndFlagSize:]))
+	headSize := GetUintCBORSize(count)
+
+	return &TypeInfoRegistrySlab{
+		id:        id,
+		typeInfos: typeInfos,
+		size:      typeInfoRegistrySlabPrefixSize + contentSize - headSize,
+	}, nil
+}
+
+// Encode encodes TypeInfoRegistrySlab to the given encoder.
+//
+// Header (2 bytes):
+//
+//     +-----------------------+-----------------------+
+//     | slab version (1 byte) | slab flag (1 byte)    |
+//     +-----------------------+-----------------------+
+//
+// Content:
+//
+//   CBOR encoded array of type infos, indexed by registry ID
+//
+func (s *TypeInfoRegistrySlab) Encode(enc *Encoder) error {
+	// Encode version
+	enc.Scratch[0] = 0
+
+	// Encode flag
+	flag := maskTypeInfoRegistry
+	flag = setNoSizeLimit(flag)
+	flag = setRoot(flag)
+
+	enc.Scratch[1] = flag
+
+	_, err := enc.Write(enc.Scratch[:versionAndFlagSize])
+	if err != nil {
+		return NewEncodingError(err)
+	}
+
+	err = enc.CBOR.EncodeArrayHead(uint64(len(s.typeInfos)))
+	if err != nil {
+		return NewEncodingError(err)
+	}
+
+	for _, typeInfo := range s.typeInfos {
+		err = typeInfo.Encode(enc.CBOR)
+		if err != nil {
+			return NewEncodingError(err)
+		}
+	}
+
+	err = enc.CBOR.Flush()
+	if err != nil {
+		return NewEncodingError(err)
+	}
+
+	return nil
+}
+
+func (s *TypeInfoRegistrySlab) ByteSize() uint32 {
+	return s.size
+}
+
+func (s *TypeInfoRegistrySlab) ID() StorageID {
+	return s.id
+}
+
+func (s *TypeInfoRegistrySlab) ChildStorables() []Storable {
+	return nil
+}
+
+func (s *TypeInfoRegistrySlab) StoredValue(_ SlabStorage) (Value, error) {
+	return nil, NewUserError(NewNotValueError(s.id))
+}
+
+func (*TypeInfoRegistrySlab) Split(_ SlabStorage) (Slab, Slab, error) {
+	return nil, nil, NewNotApplicableError("TypeInfoRegistrySlab", "Slab", "Split")
+}
+
+func (*TypeInfoRegistrySlab) Merge(_ Slab) error {
+	return NewNotApplicableError("TypeInfoRegistrySlab", "Slab", "Merge")
+}
+
+func (*TypeInfoRegistrySlab) LendToRight(_ Slab) error {
+	return NewNotApplicableError("TypeInfoRegistrySlab", "Slab", "LendToRight")
+}
+
+func (*TypeInfoRegistrySlab) BorrowFromRight(_ Slab) error {
+	return NewNotApplicableError("TypeInfoRegistrySlab", "Slab", "BorrowFromRight")
+}
+
+func (s *TypeInfoRegistrySlab) String() string {
+	return fmt.Sprintf("TypeInfoRegistrySlab id:%s count:%d", s.id, len(s.typeInfos))
+}
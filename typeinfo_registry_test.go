@@ -0,0 +1,176 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeInfoRegistry(t *testing.T) {
+
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	registry, err := NewTypeInfoRegistry(storage, address, storage.cborEncMode, storage.cborDecMode)
+	require.NoError(t, err)
+
+	storage.DecodeTypeInfo = registry.TypeInfoDecoder(storage.DecodeTypeInfo)
+
+	typeInfo1, err := registry.Register(testTypeInfo{1000})
+	require.NoError(t, err)
+	require.Equal(t, RegisteredTypeInfo{ID: 0, TypeInfo: testTypeInfo{1000}}, typeInfo1)
+
+	typeInfo2, err := registry.Register(testTypeInfo{2000})
+	require.NoError(t, err)
+	require.Equal(t, RegisteredTypeInfo{ID: 1, TypeInfo: testTypeInfo{2000}}, typeInfo2)
+
+	// Registering the same type info again returns existing ID.
+	registered, err := registry.Register(testTypeInfo{1000})
+	require.NoError(t, err)
+	require.Equal(t, typeInfo1, registered)
+
+	registered, err = registry.Register(typeInfo2)
+	require.NoError(t, err)
+	require.Equal(t, typeInfo2, registered)
+
+	require.Equal(t, 2, registry.Count())
+
+	array, err := NewArray(storage, address, typeInfo1)
+	require.NoError(t, err)
+
+	err = array.Append(Uint64Value(1))
+	require.NoError(t, err)
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo2)
+	require.NoError(t, err)
+
+	// Also collections with unregistered type info can be decoded.
+	unregisteredArray, err := NewArray(storage, address, testTypeInfo{42})
+	require.NoError(t, err)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	// Array extra data only contains type info reference.
+	stored, found, err := storage.baseStorage.Retrieve(array.StorageID())
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t,
+		[]byte{
+			// extra data version
+			0x00,
+			// extra data flag
+			0x80,
+			// array of extra data
+			0x81,
+			// type info reference
+			0xd8, CBORTagTypeInfoRef, 0x00,
+		},
+		stored[:6],
+	)
+
+	rootIDs, err := CheckStorageHealth(storage, -1)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(rootIDs))
+
+	t.Run("decode", func(t *testing.T) {
+		storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+		registry2, err := NewTypeInfoRegistryWithID(storage2, registry.ID(), storage2.cborEncMode, storage2.cborDecMode)
+		require.NoError(t, err)
+		require.Equal(t, 2, registry2.Count())
+
+		storage2.DecodeTypeInfo = registry2.TypeInfoDecoder(storage2.DecodeTypeInfo)
+
+		array2, err := NewArrayWithRootID(storage2, array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, typeInfo1, array2.Type())
+		require.Equal(t, uint64(1), array2.Count())
+
+		m2, err := NewMapWithRootID(storage2, m.StorageID(), nil)
+		require.NoError(t, err)
+		require.Equal(t, typeInfo2, m2.Type())
+
+		unregisteredArray2, err := NewArrayWithRootID(storage2, unregisteredArray.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, testTypeInfo{42}, unregisteredArray2.Type())
+
+		// Registry decoded from storage keeps existing IDs.
+		registered, err := registry2.Register(testTypeInfo{2000})
+		require.NoError(t, err)
+		require.Equal(t, typeInfo2, registered)
+
+		typeInfo3, err := registry2.Register(testTypeInfo{3000})
+		require.NoError(t, err)
+		require.Equal(t, uint16(2), typeInfo3.ID)
+	})
+
+	t.Run("unknown reference", func(t *testing.T) {
+		_, err := registry.Lookup(2)
+		var registryError *TypeInfoRegistryError
+		require.ErrorAs(t, err, &registryError)
+	})
+}
+
+func TestTypeInfoRegistrySizeLimit(t *testing.T) {
+
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	registry, err := NewTypeInfoRegistry(storage, address, storage.cborEncMode, storage.cborDecMode)
+	require.NoError(t, err)
+
+	// Type infos are encoded in 9 bytes.
+	const typeInfoSize = 9
+	count := (maxTypeInfoRegistrySize - typeInfoRegistrySlabPrefixSize) / typeInfoSize
+
+	for i := 0; i < count; i++ {
+		_, err := registry.Register(testTypeInfo{math.MaxUint32 + 1 + uint64(i)})
+		require.NoError(t, err)
+	}
+	require.True(t, registry.slab.ByteSize() <= maxTypeInfoRegistrySize)
+
+	_, err = registry.Register(testTypeInfo{math.MaxUint32 + 1 + uint64(count)})
+	require.Error(t, err)
+
+	var registryError *TypeInfoRegistryError
+	require.ErrorAs(t, err, &registryError)
+	require.True(t, IsUserError(err))
+	require.Equal(t, count, registry.Count())
+
+	// Registered type infos can still be looked up and registered.
+	registered, err := registry.Register(testTypeInfo{math.MaxUint32 + 1})
+	require.NoError(t, err)
+	require.Equal(t, uint16(0), registered.ID)
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	registry2, err := NewTypeInfoRegistryWithID(storage2, registry.ID(), storage2.cborEncMode, storage2.cborDecMode)
+	require.NoError(t, err)
+	require.Equal(t, count, registry2.Count())
+	require.Equal(t, registry.slab.ByteSize(), registry2.slab.ByteSize())
+}
@@ -0,0 +1,108 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/onflow/atree"
+)
+
+const storageIDSize = len(atree.Address{}) + len(atree.StorageIndex{})
+
+// FileCheckpoint is a Checkpoint appending upgraded roots to a file,
+// one hex encoded raw storage ID per line.
+type FileCheckpoint struct {
+	file     *os.File
+	upgraded map[atree.StorageID]struct{}
+}
+
+var _ Checkpoint = &FileCheckpoint{}
+
+// OpenFileCheckpoint opens checkpoint file at path, creating it
+// if it doesn't exist.  Roots recorded in existing file are loaded.
+func OpenFileCheckpoint(path string) (*FileCheckpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	upgraded := make(map[atree.StorageID]struct{})
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		b, err := hex.DecodeString(scanner.Text())
+		if err != nil || len(b) != storageIDSize {
+			_ = file.Close()
+			return nil, fmt.Errorf("checkpoint %s has invalid line %q", path, scanner.Text())
+		}
+
+		id, err := atree.NewStorageIDFromRawBytes(b)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+
+		upgraded[id] = struct{}{}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &FileCheckpoint{file: file, upgraded: upgraded}, nil
+}
+
+func (c *FileCheckpoint) IsUpgraded(root atree.StorageID) (bool, error) {
+	_, ok := c.upgraded[root]
+	return ok, nil
+}
+
+// MarkUpgraded records root and syncs checkpoint file.
+func (c *FileCheckpoint) MarkUpgraded(root atree.StorageID) error {
+	var b [storageIDSize]byte
+	_, err := root.ToRawBytes(b[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.file, hex.EncodeToString(b[:]))
+	if err != nil {
+		return err
+	}
+
+	c.upgraded[root] = struct{}{}
+
+	return c.file.Sync()
+}
+
+// Count returns number of upgraded roots.
+func (c *FileCheckpoint) Count() int {
+	return len(c.upgraded)
+}
+
+// Close closes checkpoint file.
+func (c *FileCheckpoint) Close() error {
+	return c.file.Close()
+}
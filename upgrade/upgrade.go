@@ -0,0 +1,259 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package upgrade re-encodes stored slabs offline, so that ledgers can be
+// migrated to a new slab encoding version.
+//
+// Upgrader walks slabs reachable from given roots, re-encodes them at
+// the target version, verifies that re-encoded slabs decode and encode
+// to the same data, and stores changed slabs.  Upgraded roots are recorded
+// in a Checkpoint, so that upgrade of a very large ledger can be resumed.
+//
+// Encoding version 0 is currently the only version, so upgrading to it
+// normalizes slab encoding.
+package upgrade
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+)
+
+// LatestEncodingVersion is the latest slab encoding version.
+const LatestEncodingVersion = 0
+
+// Checkpoint records upgraded roots.
+type Checkpoint interface {
+	IsUpgraded(root atree.StorageID) (bool, error)
+	MarkUpgraded(root atree.StorageID) error
+}
+
+// Stats is result of upgrade.
+type Stats struct {
+	Roots         int // number of roots upgraded
+	SkippedRoots  int // number of roots skipped because they were upgraded before
+	Slabs         int // number of slabs visited
+	ChangedSlabs  int // number of slabs stored with new encoding
+	ChangedBytes  int // number of bytes of slabs stored with new encoding
+	OriginalBytes int // number of bytes of visited slabs before upgrade
+}
+
+// Upgrader re-encodes slabs in base storage.
+type Upgrader struct {
+	base           atree.BaseStorage
+	encMode        cbor.EncMode
+	decMode        cbor.DecMode
+	decodeStorable atree.StorableDecoder
+	decodeTypeInfo atree.TypeInfoDecoder
+
+	// mu guards base storage, checkpoint and stats.
+	mu sync.Mutex
+}
+
+// NewUpgrader returns Upgrader re-encoding slabs of base at targetVersion.
+func NewUpgrader(
+	base atree.BaseStorage,
+	encMode cbor.EncMode,
+	decMode cbor.DecMode,
+	decodeStorable atree.StorableDecoder,
+	decodeTypeInfo atree.TypeInfoDecoder,
+	targetVersion byte,
+) (*Upgrader, error) {
+	if targetVersion > LatestEncodingVersion {
+		return nil, fmt.Errorf("unsupported encoding version %d, latest version is %d", targetVersion, LatestEncodingVersion)
+	}
+
+	return &Upgrader{
+		base:           base,
+		encMode:        encMode,
+		decMode:        decMode,
+		decodeStorable: decodeStorable,
+		decodeTypeInfo: decodeTypeInfo,
+	}, nil
+}
+
+// Upgrade upgrades slabs reachable from roots with numWorkers workers.
+// Roots are upgraded concurrently while base storage access is serialized.
+// If checkpoint isn't nil, roots recorded in checkpoint are skipped and
+// upgraded roots are recorded.  Each root is recorded after all its slabs
+// are stored, so an interrupted upgrade can be resumed with the same
+// checkpoint.
+func (u *Upgrader) Upgrade(roots []atree.StorageID, numWorkers int, checkpoint Checkpoint) (Stats, error) {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	var stats Stats
+
+	jobs := make(chan atree.StorageID, len(roots))
+	for _, root := range roots {
+		jobs <- root
+	}
+	close(jobs)
+
+	errs := make(chan error, numWorkers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for root := range jobs {
+				err := u.upgradeRoot(root, checkpoint, &stats)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	err := <-errs
+	return stats, err
+}
+
+func (u *Upgrader) upgradeRoot(root atree.StorageID, checkpoint Checkpoint, stats *Stats) error {
+	if checkpoint != nil {
+		u.mu.Lock()
+		upgraded, err := checkpoint.IsUpgraded(root)
+		if upgraded {
+			stats.SkippedRoots++
+		}
+		u.mu.Unlock()
+
+		if err != nil || upgraded {
+			return err
+		}
+	}
+
+	queue := []atree.StorageID{root}
+	visited := make(map[atree.StorageID]struct{})
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if _, ok := visited[id]; ok {
+			continue
+		}
+		visited[id] = struct{}{}
+
+		childIDs, err := u.upgradeSlab(id, stats)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade slab %s of root %s: %w", id, root, err)
+		}
+
+		queue = append(queue, childIDs...)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stats.Roots++
+
+	if checkpoint != nil {
+		return checkpoint.MarkUpgraded(root)
+	}
+	return nil
+}
+
+// upgradeSlab re-encodes slab and returns IDs of slabs it references.
+func (u *Upgrader) upgradeSlab(id atree.StorageID, stats *Stats) ([]atree.StorageID, error) {
+	u.mu.Lock()
+	data, found, err := u.base.Retrieve(id)
+	u.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("slab not found")
+	}
+
+	slab, err := atree.DecodeSlab(id, data, u.decMode, u.decodeStorable, u.decodeTypeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	newData, err := u.encode(slab)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify that re-encoded slab round-trips.
+	decoded, err := atree.DecodeSlab(id, newData, u.decMode, u.decodeStorable, u.decodeTypeInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode re-encoded slab: %w", err)
+	}
+
+	roundTripData, err := u.encode(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode decoded slab: %w", err)
+	}
+
+	if !bytes.Equal(newData, roundTripData) {
+		return nil, fmt.Errorf("re-encoded slab doesn't round-trip: %x != %x", roundTripData, newData)
+	}
+
+	changed := !bytes.Equal(data, newData)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stats.Slabs++
+	stats.OriginalBytes += len(data)
+
+	if changed {
+		err = u.base.Store(id, newData)
+		if err != nil {
+			return nil, err
+		}
+		stats.ChangedSlabs++
+		stats.ChangedBytes += len(newData)
+	}
+
+	return referencedIDs(slab.ChildStorables()), nil
+}
+
+// encode encodes slab at target version.  Since version 0 is the
+// only version, slab is encoded with the current encoder.
+func (u *Upgrader) encode(slab atree.Slab) ([]byte, error) {
+	return atree.Encode(slab, u.encMode)
+}
+
+// referencedIDs returns storage IDs referenced by storables and their child storables.
+func referencedIDs(storables []atree.Storable) []atree.StorageID {
+	var ids []atree.StorageID
+	for len(storables) > 0 {
+		var next []atree.Storable
+		for _, s := range storables {
+			if id, ok := s.(atree.StorageIDStorable); ok {
+				ids = append(ids, atree.StorageID(id))
+			}
+			next = append(next, s.ChildStorables()...)
+		}
+		storables = next
+	}
+	return ids
+}
@@ -0,0 +1,123 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/onflow/atree/inspect"
+	"github.com/onflow/atree/values"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgrader(t *testing.T) {
+
+	atree.SetThreshold(256)
+	defer atree.SetThreshold(1024)
+
+	const collectionCount = 8
+	const collectionSize = 256
+
+	base, err := inspect.NewDirBaseStorage(t.TempDir())
+	require.NoError(t, err)
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	storage := atree.NewPersistentSlabStorage(base, encMode, decMode, values.DecodeStorable, inspect.DecodeRawTypeInfo)
+
+	// CBOR encoded uint 42
+	typeInfo := inspect.RawTypeInfo{0x18, 0x2a}
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	var roots []atree.StorageID
+	for i := 0; i < collectionCount; i++ {
+		if i%2 == 0 {
+			array, err := atree.NewArray(storage, address, typeInfo)
+			require.NoError(t, err)
+			for j := uint64(0); j < collectionSize; j++ {
+				err := array.Append(values.Uint64Value(j))
+				require.NoError(t, err)
+			}
+			roots = append(roots, array.StorageID())
+		} else {
+			m, err := atree.NewMap(storage, address, atree.NewDefaultDigesterBuilder(), typeInfo)
+			require.NoError(t, err)
+			for j := uint64(0); j < collectionSize; j++ {
+				_, err := m.Set(values.Compare, values.HashInputProvider, values.Uint64Value(j), values.Uint64Value(j))
+				require.NoError(t, err)
+			}
+			roots = append(roots, m.StorageID())
+		}
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	_, err = NewUpgrader(base, encMode, decMode, values.DecodeStorable, inspect.DecodeRawTypeInfo, LatestEncodingVersion+1)
+	require.Error(t, err)
+
+	upgrader, err := NewUpgrader(base, encMode, decMode, values.DecodeStorable, inspect.DecodeRawTypeInfo, LatestEncodingVersion)
+	require.NoError(t, err)
+
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint")
+
+	// Upgrade half of the roots, then resume with reopened checkpoint.
+	checkpoint, err := OpenFileCheckpoint(checkpointPath)
+	require.NoError(t, err)
+
+	stats, err := upgrader.Upgrade(roots[:collectionCount/2], 1, checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, collectionCount/2, stats.Roots)
+	require.NoError(t, checkpoint.Close())
+
+	checkpoint, err = OpenFileCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	defer checkpoint.Close()
+
+	require.Equal(t, collectionCount/2, checkpoint.Count())
+
+	stats, err = upgrader.Upgrade(roots, 4, checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, collectionCount/2, stats.Roots)
+	require.Equal(t, collectionCount/2, stats.SkippedRoots)
+	require.Equal(t, collectionCount, checkpoint.Count())
+
+	// Slabs are already encoded at latest version.
+	require.True(t, stats.Slabs > stats.Roots)
+	require.Equal(t, 0, stats.ChangedSlabs)
+
+	// All slabs are visited by upgrading all roots.
+	stats, err = upgrader.Upgrade(roots, 4, nil)
+	require.NoError(t, err)
+	require.Equal(t, base.SegmentCounts(), stats.Slabs)
+
+	// Upgrade fails on slabs that can't be decoded.
+	err = base.Store(roots[0], []byte{0, 0xff})
+	require.NoError(t, err)
+
+	_, err = upgrader.Upgrade(roots, 4, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,128 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import "github.com/fxamacker/cbor/v2"
+
+// MaxUserMetadataSize is maximum byte size of user metadata data.
+// Metadata is stored in root slab, so it is kept small to not
+// affect slab size.
+const MaxUserMetadataSize = 256
+
+// UserMetadata is opaque application metadata attached to collection
+// root, such as schema version or creation info.  Version identifies
+// format of Data and is defined by application.
+type UserMetadata struct {
+	Version uint64
+	Data    []byte
+}
+
+const userMetadataLength = 2
+
+func decodeUserMetadata(dec *cbor.StreamDecoder) (*UserMetadata, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != userMetadataLength {
+		return nil, NewDecodingErrorf("user metadata has invalid length %d, want %d", length, userMetadataLength)
+	}
+
+	version, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dec.DecodeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserMetadata{Version: version, Data: data}, nil
+}
+
+func (m *UserMetadata) encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeArrayHead(userMetadataLength)
+	if err != nil {
+		return err
+	}
+	err = enc.CBOR.EncodeUint64(m.Version)
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeBytes(m.Data)
+}
+
+// copy returns copy of metadata, or nil if metadata is nil.
+func (m *UserMetadata) copy() *UserMetadata {
+	if m == nil {
+		return nil
+	}
+	return &UserMetadata{
+		Version: m.Version,
+		Data:    append([]byte(nil), m.Data...),
+	}
+}
+
+// newUserMetadata validates metadata set by caller and returns its copy,
+// or nil if metadata is nil.  Size limit isn't checked when metadata is
+// read, so decoded metadata is returned as stored.
+func newUserMetadata(metadata *UserMetadata) (*UserMetadata, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	if len(metadata.Data) > MaxUserMetadataSize {
+		return nil, NewMaxUserMetadataSizeError(len(metadata.Data))
+	}
+	return metadata.copy(), nil
+}
+
+// UserMetadata returns copy of metadata attached to array, or nil if
+// metadata isn't set.
+func (a *Array) UserMetadata() *UserMetadata {
+	return a.root.ExtraData().UserMetadata.copy()
+}
+
+// SetUserMetadata attaches metadata to array, replacing existing metadata.
+// Nil metadata removes existing metadata.
+func (a *Array) SetUserMetadata(metadata *UserMetadata) error {
+	metadata, err := newUserMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	a.root.ExtraData().UserMetadata = metadata
+	return a.Storage.Store(a.root.ID(), a.root)
+}
+
+// UserMetadata returns copy of metadata attached to map, or nil if
+// metadata isn't set.
+func (m *OrderedMap) UserMetadata() *UserMetadata {
+	return m.root.ExtraData().UserMetadata.copy()
+}
+
+// SetUserMetadata attaches metadata to map, replacing existing metadata.
+// Nil metadata removes existing metadata.
+func (m *OrderedMap) SetUserMetadata(metadata *UserMetadata) error {
+	metadata, err := newUserMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	m.root.ExtraData().UserMetadata = metadata
+	return m.Storage.Store(m.root.ID(), m.root)
+}
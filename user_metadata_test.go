@@ -0,0 +1,102 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserMetadata(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	metadata := &UserMetadata{Version: 2, Data: []byte("created by test")}
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	require.Nil(t, array.UserMetadata())
+
+	require.NoError(t, array.SetUserMetadata(metadata))
+	require.Equal(t, metadata, array.UserMetadata())
+
+	// Returned metadata is a copy.
+	array.UserMetadata().Data[0] = 'x'
+	require.Equal(t, metadata, array.UserMetadata())
+
+	m, err := NewMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+	require.NoError(t, m.SetUserMetadata(metadata))
+
+	// Metadata is kept when root slab is split.
+	for i := uint64(0); i < 256; i++ {
+		require.NoError(t, array.Append(Uint64Value(i)))
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(i), Uint64Value(i))
+		require.NoError(t, err)
+	}
+	require.False(t, array.root.IsData())
+	require.False(t, m.root.IsData())
+
+	require.NoError(t, storage.Commit())
+
+	// Metadata round-trips through encoding.
+	reloadedStorage := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	reloadedArray, err := NewArrayWithRootID(reloadedStorage, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, metadata, reloadedArray.UserMetadata())
+
+	reloadedMap, err := NewMapWithRootID(reloadedStorage, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, metadata, reloadedMap.UserMetadata())
+
+	// Metadata is copied by DeepCopyValue.
+	copied, err := DeepCopyValue(reloadedMap, reloadedStorage, address, compare, hashInputProvider)
+	require.NoError(t, err)
+	require.Equal(t, metadata, copied.(*OrderedMap).UserMetadata())
+
+	// Oversized metadata is rejected.
+	err = array.SetUserMetadata(&UserMetadata{Data: make([]byte, MaxUserMetadataSize+1)})
+	var sizeError *MaxUserMetadataSizeError
+	require.ErrorAs(t, err, &sizeError)
+	require.True(t, IsUserError(err))
+	require.Equal(t, metadata, array.UserMetadata())
+
+	// Stored metadata is returned regardless of size limit.
+	oversized := &UserMetadata{Version: 3, Data: make([]byte, MaxUserMetadataSize+1)}
+	m.root.ExtraData().UserMetadata = oversized
+	require.NoError(t, storage.Store(m.root.ID(), m.root))
+	require.NoError(t, storage.Commit())
+
+	reloadedStorage = newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+	reloadedMap, err = NewMapWithRootID(reloadedStorage, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, oversized, reloadedMap.UserMetadata())
+
+	// Nil metadata removes metadata.
+	require.NoError(t, array.SetUserMetadata(nil))
+	require.Nil(t, array.UserMetadata())
+	require.Equal(t, uint64(0), array.root.ExtraData().optionalFieldCount())
+}
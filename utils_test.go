@@ -109,22 +109,8 @@ func typeInfoComparator(a, b TypeInfo) bool {
 	return ok && x.value == y.value
 }
 
-func newTestPersistentStorage(t testing.TB) *PersistentSlabStorage {
-	baseStorage := NewInMemBaseStorage()
-
-	encMode, err := cbor.EncOptions{}.EncMode()
-	require.NoError(t, err)
-
-	decMode, err := cbor.DecOptions{}.DecMode()
-	require.NoError(t, err)
-
-	return NewPersistentSlabStorage(
-		baseStorage,
-		encMode,
-		decMode,
-		decodeStorable,
-		decodeTypeInfo,
-	)
+func newTestPersistentStorage(t testing.TB, opts ...StorageOption) *PersistentSlabStorage {
+	return newTestPersistentStorageWithBaseStorage(t, NewInMemBaseStorage(), opts...)
 }
 
 func newTestPersistentStorageWithData(t testing.TB, data map[StorageID][]byte) *PersistentSlabStorage {
@@ -133,7 +119,7 @@ func newTestPersistentStorageWithData(t testing.TB, data map[StorageID][]byte) *
 	return newTestPersistentStorageWithBaseStorage(t, baseStorage)
 }
 
-func newTestPersistentStorageWithBaseStorage(t testing.TB, baseStorage BaseStorage) *PersistentSlabStorage {
+func newTestPersistentStorageWithBaseStorage(t testing.TB, baseStorage BaseStorage, opts ...StorageOption) *PersistentSlabStorage {
 
 	encMode, err := cbor.EncOptions{}.EncMode()
 	require.NoError(t, err)
@@ -147,6 +133,7 @@ func newTestPersistentStorageWithBaseStorage(t testing.TB, baseStorage BaseStora
 		decMode,
 		decodeStorable,
 		decodeTypeInfo,
+		opts...,
 	)
 }
 
@@ -0,0 +1,114 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// VacuumFunc is called by Vacuum with each slab that isn't reachable
+// from roots, before the slab is removed.
+type VacuumFunc func(id StorageID) error
+
+// VacuumResult is result of Vacuum.
+type VacuumResult struct {
+	// Reachable is number of slabs reachable from roots.
+	Reachable int
+	// Unreachable is number of listed slabs not reachable from roots,
+	// which are removed unless Vacuum is a dry run.
+	Unreachable int
+}
+
+// Vacuum removes slabs that aren't reachable from roots, such as slabs
+// leaked by interrupted removals.  ids lists all slabs in storage, e.g.
+// slabs enumerated from base storage.  Roots are authoritative, so they
+// must include every root slab to keep, such as TypeInfoRegistry slab.
+//
+// Reachable slabs are found by walking slabs from roots, following
+// child slabs, external element slabs, nested collections, and
+// insertion order arrays.  Only IDs of reachable slabs are kept, then
+// listed slabs are checked one by one and fn is called with each
+// unreachable slab.  If dryRun is true, unreachable slabs are reported
+// but not removed.  Vacuum fails without removing any slab if a slab
+// reachable from roots is missing.
+func Vacuum(storage SlabStorage, roots []StorageID, ids []StorageID, dryRun bool, fn VacuumFunc) (VacuumResult, error) {
+
+	reachable, err := reachableSlabIDs(storage, roots)
+	if err != nil {
+		return VacuumResult{}, err
+	}
+
+	result := VacuumResult{Reachable: len(reachable)}
+
+	for _, id := range ids {
+		if _, ok := reachable[id]; ok {
+			continue
+		}
+
+		result.Unreachable++
+
+		if fn != nil {
+			err = fn(id)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		if dryRun {
+			continue
+		}
+
+		err = storage.Remove(id)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// reachableSlabIDs returns IDs of roots and slabs reachable from them.
+func reachableSlabIDs(storage SlabStorage, roots []StorageID) (map[StorageID]struct{}, error) {
+	reachable := make(map[StorageID]struct{})
+
+	pending := append([]StorageID(nil), roots...)
+
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if _, ok := reachable[id]; ok {
+			continue
+		}
+
+		slab, found, err := storage.Retrieve(id)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, NewSlabNotFoundErrorf(id, "slab not found during vacuum")
+		}
+
+		reachable[id] = struct{}{}
+
+		pending = appendChildSlabIDs(pending, slab.ChildStorables())
+
+		if id, ok := insertionOrderSlabID(slab); ok {
+			pending = append(pending, id)
+		}
+	}
+
+	return reachable, nil
+}
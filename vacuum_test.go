@@ -0,0 +1,115 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVacuum(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	storage := newTestPersistentStorage(t)
+
+	// Map of arrays, with insertion order array referenced from extra data.
+	m, err := NewInsertionOrderedMap(storage, address, NewDefaultDigesterBuilder(), typeInfo)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 10; i++ {
+		child, err := NewArray(storage, address, typeInfo)
+		require.NoError(t, err)
+		for j := uint64(0); j < 100; j++ {
+			require.NoError(t, child.Append(Uint64Value(j)))
+		}
+		_, err = m.Set(compare, hashInputProvider, Uint64Value(i), child)
+		require.NoError(t, err)
+	}
+
+	// Leaked array isn't referenced from roots.
+	leaked, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+	for i := uint64(0); i < 200; i++ {
+		require.NoError(t, leaked.Append(Uint64Value(i)))
+	}
+	stats, err := GetArrayStats(leaked)
+	require.NoError(t, err)
+	leakedCount := int(stats.SlabCount())
+	require.True(t, leakedCount > 1)
+
+	require.NoError(t, storage.Commit())
+
+	slabCount := storage.Count()
+
+	storageIDs := func() []StorageID {
+		var ids []StorageID
+		for id := range storage.baseStorage.(*InMemBaseStorage).segments {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	roots := []StorageID{m.StorageID()}
+
+	// Dry run reports leaked slabs without removing them.
+	var reported []StorageID
+	result, err := Vacuum(storage, roots, storageIDs(), true, func(id StorageID) error {
+		reported = append(reported, id)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, VacuumResult{Reachable: slabCount - leakedCount, Unreachable: leakedCount}, result)
+	require.Equal(t, leakedCount, len(reported))
+	require.Contains(t, reported, leaked.StorageID())
+
+	require.NoError(t, storage.Commit())
+	require.Equal(t, slabCount, storage.Count())
+
+	// Missing root fails vacuum without removing slabs.
+	missing := NewStorageID(address, StorageIndex{0xff})
+	_, err = Vacuum(storage, []StorageID{m.StorageID(), missing}, storageIDs(), false, nil)
+	var notFoundError *SlabNotFoundError
+	require.ErrorAs(t, err, &notFoundError)
+
+	require.NoError(t, storage.Commit())
+	require.Equal(t, slabCount, storage.Count())
+
+	// Vacuum removes leaked slabs.
+	result, err = Vacuum(storage, roots, storageIDs(), false, nil)
+	require.NoError(t, err)
+	require.Equal(t, leakedCount, result.Unreachable)
+
+	require.NoError(t, storage.Commit())
+	require.Equal(t, slabCount-leakedCount, storage.Count())
+
+	reloadedStorage := newTestPersistentStorageWithBaseStorage(t, storage.baseStorage)
+
+	reloadedMap, err := NewMapWithRootID(reloadedStorage, m.StorageID(), NewDefaultDigesterBuilder())
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), reloadedMap.Count())
+
+	_, err = CheckStorageHealth(reloadedStorage, -1)
+	require.NoError(t, err)
+}
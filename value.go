@@ -25,3 +25,25 @@ type Value interface {
 type ValueComparator func(SlabStorage, Value, Storable) (bool, error)
 
 type StorableComparator func(Storable, Storable) bool
+
+// Equatable is optionally implemented by Storables that can compare
+// themselves with another Storable.  Validators and EqualValues use
+// Equal instead of StorableComparator or reflect.DeepEqual when it is
+// implemented, which is faster and correct for types such as *big.Int
+// wrappers where equal values can have different internal state.
+type Equatable interface {
+	Equal(other Storable) bool
+}
+
+// storableEqual returns true if a and b are equal, using Equal if a is
+// Equatable and compare otherwise.
+func storableEqual(a Storable, b Storable, compare StorableComparator) bool {
+	if e, ok := a.(Equatable); ok {
+		return e.Equal(b)
+	}
+	return compare(a, b)
+}
+
+// ElementValidator returns error if value isn't a valid element of
+// collection with given type info.
+type ElementValidator func(typeInfo TypeInfo, value Value) error
@@ -0,0 +1,120 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"math/big"
+
+	"github.com/onflow/atree"
+)
+
+const (
+	cborTagPositiveBigNum = 0xc2
+	cborTagNegativeBigNum = 0xc3
+)
+
+// BigIntValue is an arbitrary-precision integer value.
+// BigIntValue larger than max inline size is stored in a separate StorableSlab.
+type BigIntValue struct {
+	i *big.Int
+	// bigNum is big-endian unsigned bytes of i (or -1-i for negative i).
+	bigNum []byte
+	size   uint32
+}
+
+var _ atree.Value = BigIntValue{}
+var _ atree.Storable = BigIntValue{}
+var _ HashableValue = BigIntValue{}
+var _ atree.Equatable = BigIntValue{}
+
+// NewBigIntValue returns BigIntValue of i.  i must not be modified afterwards.
+func NewBigIntValue(i *big.Int) BigIntValue {
+	n := i
+	if i.Sign() < 0 {
+		n = new(big.Int).Abs(i)
+		n.Sub(n, big.NewInt(1))
+	}
+	bigNum := n.Bytes()
+
+	// tag number (1 byte) + byte string head + bignum bytes
+	size := 1 + atree.GetUintCBORSize(uint64(len(bigNum))) + uint32(len(bigNum))
+
+	return BigIntValue{i: i, bigNum: bigNum, size: size}
+}
+
+func (v BigIntValue) BigInt() *big.Int {
+	return v.i
+}
+
+// Equal returns true if other is BigIntValue with the same integer.
+// reflect.DeepEqual isn't used because equal big.Int can have different
+// internal slices.
+func (v BigIntValue) Equal(other atree.Storable) bool {
+	o, ok := other.(BigIntValue)
+	return ok && v.i.Cmp(o.i) == 0
+}
+
+func (v BigIntValue) ChildStorables() []atree.Storable { return nil }
+
+func (v BigIntValue) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v BigIntValue) Storable(storage atree.SlabStorage, address atree.Address, maxInlineSize uint64) (atree.Storable, error) {
+	return storeIfTooLarge(storage, address, maxInlineSize, v)
+}
+
+// Encode encodes BigIntValue as CBOR bignum (RFC 8949 section 3.4.3).
+// BigIntValue is always encoded as bignum, even if it fits in 64 bits,
+// so that encoding is canonical and independent of encoding options.
+func (v BigIntValue) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{v.tagNumber()})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeBytes(v.nonNilBigNum())
+}
+
+func (v BigIntValue) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], v.tagNumber())
+	buf = appendCBORHead(buf, cborTypeByteString, uint64(len(v.bigNum)))
+	return append(buf, v.bigNum...), nil
+}
+
+func (v BigIntValue) ByteSize() uint32 {
+	return v.size
+}
+
+func (v BigIntValue) String() string {
+	return v.i.String()
+}
+
+func (v BigIntValue) tagNumber() byte {
+	if v.i.Sign() < 0 {
+		return cborTagNegativeBigNum
+	}
+	return cborTagPositiveBigNum
+}
+
+func (v BigIntValue) nonNilBigNum() []byte {
+	if v.bigNum == nil {
+		return []byte{}
+	}
+	return v.bigNum
+}
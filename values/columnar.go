@@ -0,0 +1,269 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/onflow/atree"
+)
+
+// ColumnType is data type of exported array elements.
+// Column types correspond to Arrow data types of the same name.
+type ColumnType int
+
+const (
+	ColumnTypeNull ColumnType = iota
+	ColumnTypeBool
+	ColumnTypeUint8
+	ColumnTypeUint16
+	ColumnTypeUint32
+	ColumnTypeUint64
+	ColumnTypeInt8
+	ColumnTypeInt16
+	ColumnTypeInt32
+	ColumnTypeInt64
+	ColumnTypeFloat64
+	ColumnTypeBinary
+	ColumnTypeString
+)
+
+// DefaultColumnBatchSize is default number of elements in ColumnBatch.
+const DefaultColumnBatchSize = 64 * 1024
+
+// ColumnBatch contains array elements in Arrow columnar memory layout,
+// so that it can be wrapped as Arrow array data without conversion:
+//
+//   - Validity is validity bitmap (LSB numbering), or nil if there are no nulls.
+//   - Offsets is int32 offsets buffer of Binary and String types (Length+1 offsets).
+//   - Data is values buffer: bit-packed for Bool, little-endian fixed-width
+//     values for numeric types, and concatenated values for Binary and String.
+//
+// NilValue elements are exported as nulls.
+//
+// ColumnBatch only contains buffers of a single column.  It isn't
+// serialized in Arrow IPC format, and schema and record batch messages
+// need to be built by the caller, e.g. with the Arrow library.
+type ColumnBatch struct {
+	Type      ColumnType
+	Length    int
+	NullCount int
+	Validity  []byte
+	Offsets   []int32
+	Data      []byte
+}
+
+// ColumnBatchFunc receives exported batches.  Batch buffers are not
+// reused after fn returns.
+type ColumnBatchFunc func(batch *ColumnBatch) error
+
+// ExportColumns streams elements of array with homogeneous primitive values
+// to fn as batches of at most batchSize elements.  All batches have
+// columnType.  Elements must all be of columnType or NilValue, otherwise
+// error is returned.  Use InferColumnType to get column type from
+// array elements.
+// BigIntValue and nested values aren't supported.
+func ExportColumns(array *atree.Array, columnType ColumnType, batchSize int, fn ColumnBatchFunc) error {
+	if batchSize <= 0 {
+		batchSize = DefaultColumnBatchSize
+	}
+
+	batch := newColumnBatch(columnType, batchSize)
+
+	err := array.Iterate(func(element atree.Value) (bool, error) {
+		elementType, err := columnTypeOf(element)
+		if err != nil {
+			return false, err
+		}
+
+		if elementType != ColumnTypeNull && elementType != columnType {
+			return false, fmt.Errorf("array element %T doesn't match column type %d", element, columnType)
+		}
+
+		batch.append(element, elementType == ColumnTypeNull)
+
+		if batch.Length == batchSize {
+			err = fn(batch.finish())
+			if err != nil {
+				return false, err
+			}
+			batch = newColumnBatch(columnType, batchSize)
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if batch.Length > 0 {
+		return fn(batch.finish())
+	}
+
+	return nil
+}
+
+// InferColumnType returns column type of the first non-null element
+// of array, or ColumnTypeNull if all elements are NilValue.
+func InferColumnType(array *atree.Array) (ColumnType, error) {
+	columnType := ColumnTypeNull
+	err := array.Iterate(func(element atree.Value) (bool, error) {
+		var err error
+		columnType, err = columnTypeOf(element)
+		if err != nil {
+			return false, err
+		}
+		return columnType == ColumnTypeNull, nil
+	})
+	return columnType, err
+}
+
+func columnTypeOf(value atree.Value) (ColumnType, error) {
+	switch value.(type) {
+	case NilValue:
+		return ColumnTypeNull, nil
+	case BoolValue:
+		return ColumnTypeBool, nil
+	case Uint8Value:
+		return ColumnTypeUint8, nil
+	case Uint16Value:
+		return ColumnTypeUint16, nil
+	case Uint32Value:
+		return ColumnTypeUint32, nil
+	case Uint64Value:
+		return ColumnTypeUint64, nil
+	case Int8Value:
+		return ColumnTypeInt8, nil
+	case Int16Value:
+		return ColumnTypeInt16, nil
+	case Int32Value:
+		return ColumnTypeInt32, nil
+	case Int64Value:
+		return ColumnTypeInt64, nil
+	case Float64Value:
+		return ColumnTypeFloat64, nil
+	case BytesValue:
+		return ColumnTypeBinary, nil
+	case StringValue:
+		return ColumnTypeString, nil
+	default:
+		return ColumnTypeNull, fmt.Errorf("array element %T can't be exported to column", value)
+	}
+}
+
+func newColumnBatch(columnType ColumnType, capacity int) *ColumnBatch {
+	return &ColumnBatch{
+		Type:     columnType,
+		Validity: make([]byte, 0, (capacity+7)/8),
+		Offsets:  []int32{0},
+	}
+}
+
+func (b *ColumnBatch) append(value atree.Value, null bool) {
+	i := b.Length
+	b.Length++
+
+	if i%8 == 0 {
+		b.Validity = append(b.Validity, 0)
+	}
+	if null {
+		b.NullCount++
+	} else {
+		b.Validity[i/8] |= 1 << (i % 8)
+	}
+
+	var buf [8]byte
+
+	switch v := value.(type) {
+	case BoolValue:
+		if i%8 == 0 {
+			b.Data = append(b.Data, 0)
+		}
+		if v {
+			b.Data[i/8] |= 1 << (i % 8)
+		}
+	case Uint8Value:
+		b.Data = append(b.Data, byte(v))
+	case Uint16Value:
+		binary.LittleEndian.PutUint16(buf[:], uint16(v))
+		b.Data = append(b.Data, buf[:2]...)
+	case Uint32Value:
+		binary.LittleEndian.PutUint32(buf[:], uint32(v))
+		b.Data = append(b.Data, buf[:4]...)
+	case Uint64Value:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		b.Data = append(b.Data, buf[:]...)
+	case Int8Value:
+		b.Data = append(b.Data, byte(v))
+	case Int16Value:
+		binary.LittleEndian.PutUint16(buf[:], uint16(v))
+		b.Data = append(b.Data, buf[:2]...)
+	case Int32Value:
+		binary.LittleEndian.PutUint32(buf[:], uint32(v))
+		b.Data = append(b.Data, buf[:4]...)
+	case Int64Value:
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		b.Data = append(b.Data, buf[:]...)
+	case Float64Value:
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(float64(v)))
+		b.Data = append(b.Data, buf[:]...)
+	case BytesValue:
+		b.Data = append(b.Data, v.b...)
+	case StringValue:
+		b.Data = append(b.Data, v.str...)
+	case NilValue:
+		b.Data = append(b.Data, make([]byte, b.Type.byteWidth(i))...)
+	}
+
+	b.Offsets = append(b.Offsets, int32(len(b.Data)))
+}
+
+// byteWidth returns number of data bytes of a null element at index i.
+func (t ColumnType) byteWidth(i int) int {
+	switch t {
+	case ColumnTypeBool:
+		if i%8 == 0 {
+			return 1
+		}
+		return 0
+	case ColumnTypeUint8, ColumnTypeInt8:
+		return 1
+	case ColumnTypeUint16, ColumnTypeInt16:
+		return 2
+	case ColumnTypeUint32, ColumnTypeInt32:
+		return 4
+	case ColumnTypeUint64, ColumnTypeInt64, ColumnTypeFloat64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// finish drops buffers not used by batch type.
+func (b *ColumnBatch) finish() *ColumnBatch {
+	if b.NullCount == 0 {
+		b.Validity = nil
+	}
+	if b.Type != ColumnTypeBinary && b.Type != ColumnTypeString {
+		b.Offsets = nil
+	}
+	return b
+}
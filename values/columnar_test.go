@@ -0,0 +1,193 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/onflow/atree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportColumns(t *testing.T) {
+
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("uint64", func(t *testing.T) {
+		const arraySize = 1000
+		const batchSize = 300
+
+		storage := newTestStorage(t)
+
+		array, err := atree.NewArray(storage, address, testTypeInfo{42})
+		require.NoError(t, err)
+
+		for i := 0; i < arraySize; i++ {
+			var v atree.Value = Uint64Value(i)
+			if i%10 == 0 {
+				v = NilValue{}
+			}
+			err := array.Append(v)
+			require.NoError(t, err)
+		}
+
+		var batches []*ColumnBatch
+		err = ExportColumns(array, ColumnTypeUint64, batchSize, func(batch *ColumnBatch) error {
+			batches = append(batches, batch)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 4, len(batches))
+
+		i := 0
+		for _, batch := range batches {
+			require.Equal(t, ColumnTypeUint64, batch.Type)
+			require.Nil(t, batch.Offsets)
+			require.Equal(t, batch.Length*8, len(batch.Data))
+
+			for j := 0; j < batch.Length; j++ {
+				valid := batch.Validity[j/8]&(1<<(j%8)) != 0
+				require.Equal(t, i%10 != 0, valid)
+				if valid {
+					require.Equal(t, uint64(i), binary.LittleEndian.Uint64(batch.Data[j*8:]))
+				}
+				i++
+			}
+		}
+		require.Equal(t, arraySize, i)
+		require.Equal(t, 100, batches[3].Length)
+		require.Equal(t, 10, batches[3].NullCount)
+	})
+
+	t.Run("leading nulls", func(t *testing.T) {
+		storage := newTestStorage(t)
+
+		array, err := atree.NewArray(storage, address, testTypeInfo{42})
+		require.NoError(t, err)
+
+		for _, v := range []atree.Value{NilValue{}, NilValue{}, Float64Value(1.5), BoolValue(true)} {
+			err := array.Append(v)
+			require.NoError(t, err)
+		}
+
+		columnType, err := InferColumnType(array)
+		require.NoError(t, err)
+		require.Equal(t, ColumnTypeFloat64, columnType)
+
+		// Mixed types can't be exported.
+		err = ExportColumns(array, columnType, 0, func(batch *ColumnBatch) error { return nil })
+		require.Error(t, err)
+
+		_, err = array.Remove(3)
+		require.NoError(t, err)
+
+		// Batches of leading nulls have column type.
+		var batches []*ColumnBatch
+		err = ExportColumns(array, columnType, 2, func(b *ColumnBatch) error {
+			batches = append(batches, b)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(batches))
+
+		require.Equal(t, ColumnTypeFloat64, batches[0].Type)
+		require.Equal(t, 2, batches[0].NullCount)
+		require.Equal(t, 16, len(batches[0].Data))
+
+		batch := batches[1]
+		require.Equal(t, ColumnTypeFloat64, batch.Type)
+		require.Equal(t, 1, batch.Length)
+		require.Equal(t, 0, batch.NullCount)
+		require.Nil(t, batch.Validity)
+		require.Equal(t, 8, len(batch.Data))
+		require.Equal(t, 1.5, math.Float64frombits(binary.LittleEndian.Uint64(batch.Data)))
+	})
+
+	t.Run("all nulls", func(t *testing.T) {
+		storage := newTestStorage(t)
+
+		array, err := atree.NewArray(storage, address, testTypeInfo{42})
+		require.NoError(t, err)
+
+		err = array.Append(NilValue{})
+		require.NoError(t, err)
+
+		columnType, err := InferColumnType(array)
+		require.NoError(t, err)
+		require.Equal(t, ColumnTypeNull, columnType)
+
+		// Column type can be given by caller.
+		var batch *ColumnBatch
+		err = ExportColumns(array, ColumnTypeInt32, 0, func(b *ColumnBatch) error {
+			batch = b
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, ColumnTypeInt32, batch.Type)
+		require.Equal(t, 1, batch.NullCount)
+		require.Equal(t, 4, len(batch.Data))
+	})
+
+	t.Run("string", func(t *testing.T) {
+		storage := newTestStorage(t)
+
+		array, err := atree.NewArray(storage, address, testTypeInfo{42})
+		require.NoError(t, err)
+
+		for _, v := range []atree.Value{NewStringValue("ab"), NilValue{}, NewStringValue("cde")} {
+			err := array.Append(v)
+			require.NoError(t, err)
+		}
+
+		var batch *ColumnBatch
+		err = ExportColumns(array, ColumnTypeString, 0, func(b *ColumnBatch) error {
+			batch = b
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, ColumnTypeString, batch.Type)
+		require.Equal(t, []int32{0, 2, 2, 5}, batch.Offsets)
+		require.Equal(t, []byte("abcde"), batch.Data)
+		require.Equal(t, []byte{0b101}, batch.Validity)
+	})
+
+	t.Run("bool", func(t *testing.T) {
+		storage := newTestStorage(t)
+
+		array, err := atree.NewArray(storage, address, testTypeInfo{42})
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			err := array.Append(BoolValue(i%3 == 0))
+			require.NoError(t, err)
+		}
+
+		var batch *ColumnBatch
+		err = ExportColumns(array, ColumnTypeBool, 0, func(b *ColumnBatch) error {
+			batch = b
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, ColumnTypeBool, batch.Type)
+		require.Nil(t, batch.Validity)
+		require.Equal(t, []byte{0b0100_1001, 0b10}, batch.Data)
+	})
+}
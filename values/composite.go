@@ -0,0 +1,192 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"fmt"
+
+	"github.com/onflow/atree"
+)
+
+// CompositeLayout is the ordered list of field names of a composite type.
+//
+// Field names are part of the layout rather than of stored composites,
+// so composites of the same type don't repeat field names in storage.
+type CompositeLayout struct {
+	fields []string
+	index  map[string]int
+}
+
+// NewCompositeLayout returns layout with given field names in storage order.
+func NewCompositeLayout(fields ...string) (*CompositeLayout, error) {
+	index := make(map[string]int, len(fields))
+	for i, name := range fields {
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("duplicate composite field %q", name)
+		}
+		index[name] = i
+	}
+	return &CompositeLayout{
+		fields: append([]string(nil), fields...),
+		index:  index,
+	}, nil
+}
+
+// FieldNames returns field names in storage order.
+func (l *CompositeLayout) FieldNames() []string {
+	return append([]string(nil), l.fields...)
+}
+
+// FieldIndex returns storage position of field name.
+func (l *CompositeLayout) FieldIndex(name string) (int, bool) {
+	i, ok := l.index[name]
+	return i, ok
+}
+
+// CompositeValue is a struct-like value with named fields.
+//
+// CompositeValue is backed by an atree.Array holding field values in
+// layout order, so large composites are split into slabs like any other
+// array.  Field names are not stored: they are resolved with the
+// CompositeLayout of the composite type.  Field values are encoded inline
+// if they fit, so small composites are stored in a single slab.
+//
+// Fields that haven't been set hold NilValue.
+//
+// Composite values stored in collections are decoded as *atree.Array.
+// Use NewCompositeValueFromArray to access them as CompositeValue.
+type CompositeValue struct {
+	layout *CompositeLayout
+	a      *atree.Array
+}
+
+var _ atree.Value = &CompositeValue{}
+
+// NewCompositeValue creates a composite with all fields of layout set to NilValue.
+func NewCompositeValue(storage atree.SlabStorage, address atree.Address, typeInfo atree.TypeInfo, layout *CompositeLayout) (*CompositeValue, error) {
+	a, err := atree.NewArray(storage, address, typeInfo)
+	if err != nil {
+		return nil, err
+	}
+	for range layout.fields {
+		err := a.Append(NilValue{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &CompositeValue{layout: layout, a: a}, nil
+}
+
+// NewCompositeValueWithRootID loads composite with given layout from storage.
+func NewCompositeValueWithRootID(storage atree.SlabStorage, rootID atree.StorageID, layout *CompositeLayout) (*CompositeValue, error) {
+	a, err := atree.NewArrayWithRootID(storage, rootID)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompositeValueFromArray(a, layout)
+}
+
+// NewCompositeValueFromArray returns composite with given layout backed by a.
+// a must be created by NewCompositeValue with the same layout.
+func NewCompositeValueFromArray(a *atree.Array, layout *CompositeLayout) (*CompositeValue, error) {
+	if a.Count() != uint64(len(layout.fields)) {
+		return nil, fmt.Errorf("composite has %d fields, layout has %d", a.Count(), len(layout.fields))
+	}
+	return &CompositeValue{layout: layout, a: a}, nil
+}
+
+// Array returns underlying array of the composite.
+func (c *CompositeValue) Array() *atree.Array {
+	return c.a
+}
+
+// Layout returns layout of the composite.
+func (c *CompositeValue) Layout() *CompositeLayout {
+	return c.layout
+}
+
+func (c *CompositeValue) fieldIndex(name string) (uint64, error) {
+	i, ok := c.layout.FieldIndex(name)
+	if !ok {
+		return 0, fmt.Errorf("composite has no field %q", name)
+	}
+	return uint64(i), nil
+}
+
+// GetField returns value of field name.
+func (c *CompositeValue) GetField(name string) (atree.Value, error) {
+	i, err := c.fieldIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	storable, err := c.a.Get(i)
+	if err != nil {
+		return nil, err
+	}
+	return storable.StoredValue(c.a.Storage)
+}
+
+// HasField returns true if layout of the composite has field name.
+func (c *CompositeValue) HasField(name string) bool {
+	_, ok := c.layout.FieldIndex(name)
+	return ok
+}
+
+// SetField sets field name to value and returns previous storable of the field.
+func (c *CompositeValue) SetField(name string, value atree.Value) (atree.Storable, error) {
+	i, err := c.fieldIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.a.Set(i, value)
+}
+
+// FieldCount returns number of fields.
+func (c *CompositeValue) FieldCount() uint64 {
+	return uint64(len(c.layout.fields))
+}
+
+// IterateFields iterates fields in layout order.
+func (c *CompositeValue) IterateFields(fn func(name string, value atree.Value) (resume bool, err error)) error {
+	i := 0
+	return c.a.Iterate(func(v atree.Value) (bool, error) {
+		if i >= len(c.layout.fields) {
+			return false, fmt.Errorf("composite has more than %d fields of layout", len(c.layout.fields))
+		}
+		name := c.layout.fields[i]
+		i++
+		return fn(name, v)
+	})
+}
+
+func (c *CompositeValue) Storable(storage atree.SlabStorage, address atree.Address, maxInlineSize uint64) (atree.Storable, error) {
+	return c.a.Storable(storage, address, maxInlineSize)
+}
+
+func (c *CompositeValue) StorageID() atree.StorageID {
+	return c.a.StorageID()
+}
+
+func (c *CompositeValue) Type() atree.TypeInfo {
+	return c.a.Type()
+}
+
+func (c *CompositeValue) String() string {
+	return c.a.String()
+}
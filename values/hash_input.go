@@ -0,0 +1,164 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"fmt"
+
+	"github.com/onflow/atree"
+)
+
+const (
+	cborTypeArray = 0x80
+	cborTypeTag   = 0xc0
+)
+
+// Hash input helpers build atree.HashInputProvider from functions
+// extracting Go data from map keys.  Hash inputs are CBOR encoded, so
+// every input is self-delimiting and composite keys such as ("ab", "c")
+// and ("a", "bc") have different hash inputs.  Hand-rolled hash inputs
+// that concatenate raw fields don't have this property and silently
+// increase collisions.
+
+// AppendStringHashInput appends hash input of s to buf.
+func AppendStringHashInput(buf []byte, s string) []byte {
+	buf = appendCBORHead(buf, cborTypeTextString, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// AppendBytesHashInput appends hash input of b to buf.
+func AppendBytesHashInput(buf []byte, b []byte) []byte {
+	buf = appendCBORHead(buf, cborTypeByteString, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// AppendUintHashInput appends hash input of n to buf.
+func AppendUintHashInput(buf []byte, n uint64) []byte {
+	return appendCBORHead(buf, cborTypePositiveInt, n)
+}
+
+// AppendIntHashInput appends hash input of n to buf.
+func AppendIntHashInput(buf []byte, n int64) []byte {
+	if n < 0 {
+		return appendCBORHead(buf, cborTypeNegativeInt, uint64(-1-n))
+	}
+	return appendCBORHead(buf, cborTypePositiveInt, uint64(n))
+}
+
+// AppendTagHashInput appends CBOR tag head of tag to buf.  Hash input of
+// tagged content must be appended after it.
+func AppendTagHashInput(buf []byte, tag uint64) []byte {
+	return appendCBORHead(buf, cborTypeTag, tag)
+}
+
+// StringHashInputProvider returns HashInputProvider of keys converted
+// to string by fn.
+func StringHashInputProvider(fn func(atree.Value) (string, error)) atree.HashInputProvider {
+	return func(value atree.Value, scratch []byte) ([]byte, error) {
+		s, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		return AppendStringHashInput(scratch[:0], s), nil
+	}
+}
+
+// BytesHashInputProvider returns HashInputProvider of keys converted
+// to byte slice by fn.
+func BytesHashInputProvider(fn func(atree.Value) ([]byte, error)) atree.HashInputProvider {
+	return func(value atree.Value, scratch []byte) ([]byte, error) {
+		b, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		return AppendBytesHashInput(scratch[:0], b), nil
+	}
+}
+
+// UintHashInputProvider returns HashInputProvider of keys converted to
+// uint64 by fn.
+func UintHashInputProvider(fn func(atree.Value) (uint64, error)) atree.HashInputProvider {
+	return func(value atree.Value, scratch []byte) ([]byte, error) {
+		n, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		return AppendUintHashInput(scratch[:0], n), nil
+	}
+}
+
+// IntHashInputProvider returns HashInputProvider of keys converted to
+// int64 by fn.
+func IntHashInputProvider(fn func(atree.Value) (int64, error)) atree.HashInputProvider {
+	return func(value atree.Value, scratch []byte) ([]byte, error) {
+		n, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		return AppendIntHashInput(scratch[:0], n), nil
+	}
+}
+
+// TaggedHashInputProvider returns HashInputProvider prefixing hash input
+// of hip with CBOR tag head of tag.  Tagging gives keys of different
+// types with the same content, e.g. a user ID and an account number,
+// different hash inputs.
+func TaggedHashInputProvider(tag uint64, hip atree.HashInputProvider) atree.HashInputProvider {
+	return func(value atree.Value, scratch []byte) ([]byte, error) {
+		input, err := hip(value, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := AppendTagHashInput(scratch[:0], tag)
+		return append(buf, input...), nil
+	}
+}
+
+// CompositeHashInputProvider returns HashInputProvider of composite
+// keys.  fields returns fields of key, and hash input of field i is
+// provided by hips[i].  Hash input is CBOR array of field hash inputs.
+func CompositeHashInputProvider(
+	fields func(atree.Value) ([]atree.Value, error),
+	hips ...atree.HashInputProvider,
+) atree.HashInputProvider {
+	return func(value atree.Value, scratch []byte) ([]byte, error) {
+		values, err := fields(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(values) != len(hips) {
+			return nil, fmt.Errorf("composite key %v has %d fields, want %d", value, len(values), len(hips))
+		}
+
+		buf := appendCBORHead(scratch[:0], cborTypeArray, uint64(len(values)))
+
+		var fieldScratch []byte
+		for i, v := range values {
+			input, err := hips[i](v, fieldScratch)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, input...)
+			fieldScratch = input
+		}
+
+		return buf, nil
+	}
+}
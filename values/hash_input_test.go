@@ -0,0 +1,123 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/onflow/atree"
+	"github.com/stretchr/testify/require"
+)
+
+func stringOf(value atree.Value) (string, error) {
+	s, ok := value.(StringValue)
+	if !ok {
+		return "", fmt.Errorf("value %v isn't StringValue", value)
+	}
+	return s.String(), nil
+}
+
+func TestHashInputProviders(t *testing.T) {
+
+	t.Run("primitive", func(t *testing.T) {
+		// Hash inputs are CBOR encoding of data.
+		input, err := StringHashInputProvider(stringOf)(NewStringValue("abc"), nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x63, 'a', 'b', 'c'}, input)
+
+		bytesOf := func(value atree.Value) ([]byte, error) { return value.(BytesValue).Bytes(), nil }
+		input, err = BytesHashInputProvider(bytesOf)(NewBytesValue([]byte{1, 2}), nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x42, 1, 2}, input)
+
+		uintOf := func(value atree.Value) (uint64, error) { return uint64(value.(Uint64Value)), nil }
+		input, err = UintHashInputProvider(uintOf)(Uint64Value(500), nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x19, 0x01, 0xf4}, input)
+
+		intOf := func(value atree.Value) (int64, error) { return int64(value.(Int64Value)), nil }
+		input, err = IntHashInputProvider(intOf)(Int64Value(-500), nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x39, 0x01, 0xf3}, input)
+
+		input, err = IntHashInputProvider(intOf)(Int64Value(math.MinInt64), nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x3b, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, input)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := StringHashInputProvider(stringOf)(Uint64Value(1), nil)
+		require.Error(t, err)
+	})
+
+	t.Run("tagged", func(t *testing.T) {
+		hip := TaggedHashInputProvider(CBORTagUint64Value, StringHashInputProvider(stringOf))
+
+		scratch := make([]byte, 0, 32)
+		input, err := hip(NewStringValue("a"), scratch)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0xd8, CBORTagUint64Value, 0x61, 'a'}, input)
+	})
+
+	t.Run("composite", func(t *testing.T) {
+		// Composite key is a string of fields separated by "/".
+		fields := func(value atree.Value) ([]atree.Value, error) {
+			s, err := stringOf(value)
+			if err != nil {
+				return nil, err
+			}
+			var values []atree.Value
+			for _, field := range strings.Split(s, "/") {
+				values = append(values, NewStringValue(field))
+			}
+			return values, nil
+		}
+
+		hip := CompositeHashInputProvider(fields, StringHashInputProvider(stringOf), StringHashInputProvider(stringOf))
+
+		input1, err := hip(NewStringValue("ab/c"), nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x82, 0x62, 'a', 'b', 0x61, 'c'}, input1)
+
+		input2, err := hip(NewStringValue("a/bc"), nil)
+		require.NoError(t, err)
+		require.NotEqual(t, input1, input2)
+
+		_, err = hip(NewStringValue("a/b/c"), nil)
+		require.Error(t, err)
+
+		// Provider works with maps.
+		storage := newTestStorage(t)
+		m, err := atree.NewMap(storage, atree.Address{1, 2, 3, 4, 5, 6, 7, 8}, atree.NewDefaultDigesterBuilder(), testTypeInfo{42})
+		require.NoError(t, err)
+
+		_, err = m.Set(Compare, hip, NewStringValue("ab/c"), Uint64Value(1))
+		require.NoError(t, err)
+		_, err = m.Set(Compare, hip, NewStringValue("a/bc"), Uint64Value(2))
+		require.NoError(t, err)
+
+		storable, err := m.Get(Compare, hip, NewStringValue("a/bc"))
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(2), storable)
+		require.Equal(t, uint64(2), m.Count())
+	})
+}
@@ -0,0 +1,484 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+)
+
+const (
+	cborTypePositiveInt = 0x00
+	cborTypeNegativeInt = 0x20
+)
+
+type Uint8Value uint8
+
+var _ atree.Value = Uint8Value(0)
+var _ atree.Storable = Uint8Value(0)
+var _ HashableValue = Uint8Value(0)
+
+func (v Uint8Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Uint8Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Uint8Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Uint8Value as
+// cbor.Tag{
+//		Number:  CBORTagUint8Value,
+//		Content: uint8(v),
+// }
+func (v Uint8Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagUint8Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint8(uint8(v))
+}
+
+// HashInput returns CBOR encoding of Uint8Value.
+func (v Uint8Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagUint8Value)
+	return appendCBORHead(buf, cborTypePositiveInt, uint64(v)), nil
+}
+
+func (v Uint8Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + atree.GetUintCBORSize(uint64(v))
+}
+
+func (v Uint8Value) String() string {
+	return fmt.Sprintf("%d", uint8(v))
+}
+
+type Uint16Value uint16
+
+var _ atree.Value = Uint16Value(0)
+var _ atree.Storable = Uint16Value(0)
+var _ HashableValue = Uint16Value(0)
+
+func (v Uint16Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Uint16Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Uint16Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Uint16Value as
+// cbor.Tag{
+//		Number:  CBORTagUint16Value,
+//		Content: uint16(v),
+// }
+func (v Uint16Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagUint16Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint16(uint16(v))
+}
+
+// HashInput returns CBOR encoding of Uint16Value.
+func (v Uint16Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagUint16Value)
+	return appendCBORHead(buf, cborTypePositiveInt, uint64(v)), nil
+}
+
+func (v Uint16Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + atree.GetUintCBORSize(uint64(v))
+}
+
+func (v Uint16Value) String() string {
+	return fmt.Sprintf("%d", uint16(v))
+}
+
+type Uint32Value uint32
+
+var _ atree.Value = Uint32Value(0)
+var _ atree.Storable = Uint32Value(0)
+var _ HashableValue = Uint32Value(0)
+
+func (v Uint32Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Uint32Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Uint32Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Uint32Value as
+// cbor.Tag{
+//		Number:  CBORTagUint32Value,
+//		Content: uint32(v),
+// }
+func (v Uint32Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagUint32Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint32(uint32(v))
+}
+
+// HashInput returns CBOR encoding of Uint32Value.
+func (v Uint32Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagUint32Value)
+	return appendCBORHead(buf, cborTypePositiveInt, uint64(v)), nil
+}
+
+func (v Uint32Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + atree.GetUintCBORSize(uint64(v))
+}
+
+func (v Uint32Value) String() string {
+	return fmt.Sprintf("%d", uint32(v))
+}
+
+type Uint64Value uint64
+
+var _ atree.Value = Uint64Value(0)
+var _ atree.Storable = Uint64Value(0)
+var _ HashableValue = Uint64Value(0)
+
+func (v Uint64Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Uint64Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Uint64Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Uint64Value as
+// cbor.Tag{
+//		Number:  CBORTagUint64Value,
+//		Content: uint64(v),
+// }
+func (v Uint64Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagUint64Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeUint64(uint64(v))
+}
+
+// HashInput returns CBOR encoding of Uint64Value.
+func (v Uint64Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagUint64Value)
+	return appendCBORHead(buf, cborTypePositiveInt, uint64(v)), nil
+}
+
+func (v Uint64Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + atree.GetUintCBORSize(uint64(v))
+}
+
+func (v Uint64Value) String() string {
+	return fmt.Sprintf("%d", uint64(v))
+}
+
+type Int8Value int8
+
+var _ atree.Value = Int8Value(0)
+var _ atree.Storable = Int8Value(0)
+var _ HashableValue = Int8Value(0)
+
+func (v Int8Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Int8Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Int8Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Int8Value as
+// cbor.Tag{
+//		Number:  CBORTagInt8Value,
+//		Content: int8(v),
+// }
+func (v Int8Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagInt8Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeInt8(int8(v))
+}
+
+// HashInput returns CBOR encoding of Int8Value.
+func (v Int8Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagInt8Value)
+	return appendCBORInt(buf, int64(v)), nil
+}
+
+func (v Int8Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + getIntCBORSize(int64(v))
+}
+
+func (v Int8Value) String() string {
+	return fmt.Sprintf("%d", int8(v))
+}
+
+type Int16Value int16
+
+var _ atree.Value = Int16Value(0)
+var _ atree.Storable = Int16Value(0)
+var _ HashableValue = Int16Value(0)
+
+func (v Int16Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Int16Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Int16Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Int16Value as
+// cbor.Tag{
+//		Number:  CBORTagInt16Value,
+//		Content: int16(v),
+// }
+func (v Int16Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagInt16Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeInt16(int16(v))
+}
+
+// HashInput returns CBOR encoding of Int16Value.
+func (v Int16Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagInt16Value)
+	return appendCBORInt(buf, int64(v)), nil
+}
+
+func (v Int16Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + getIntCBORSize(int64(v))
+}
+
+func (v Int16Value) String() string {
+	return fmt.Sprintf("%d", int16(v))
+}
+
+type Int32Value int32
+
+var _ atree.Value = Int32Value(0)
+var _ atree.Storable = Int32Value(0)
+var _ HashableValue = Int32Value(0)
+
+func (v Int32Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Int32Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Int32Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Int32Value as
+// cbor.Tag{
+//		Number:  CBORTagInt32Value,
+//		Content: int32(v),
+// }
+func (v Int32Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagInt32Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeInt32(int32(v))
+}
+
+// HashInput returns CBOR encoding of Int32Value.
+func (v Int32Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagInt32Value)
+	return appendCBORInt(buf, int64(v)), nil
+}
+
+func (v Int32Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + getIntCBORSize(int64(v))
+}
+
+func (v Int32Value) String() string {
+	return fmt.Sprintf("%d", int32(v))
+}
+
+type Int64Value int64
+
+var _ atree.Value = Int64Value(0)
+var _ atree.Storable = Int64Value(0)
+var _ HashableValue = Int64Value(0)
+
+func (v Int64Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Int64Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Int64Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Int64Value as
+// cbor.Tag{
+//		Number:  CBORTagInt64Value,
+//		Content: int64(v),
+// }
+func (v Int64Value) Encode(enc *atree.Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagInt64Value,
+	})
+	if err != nil {
+		return err
+	}
+	return enc.CBOR.EncodeInt64(int64(v))
+}
+
+// HashInput returns CBOR encoding of Int64Value.
+func (v Int64Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], 0xd8, CBORTagInt64Value)
+	return appendCBORInt(buf, int64(v)), nil
+}
+
+func (v Int64Value) ByteSize() uint32 {
+	// tag number (2 bytes) + encoded content
+	return 2 + getIntCBORSize(int64(v))
+}
+
+func (v Int64Value) String() string {
+	return fmt.Sprintf("%d", int64(v))
+}
+
+// appendCBORInt appends CBOR encoded integer n to buf.
+func appendCBORInt(buf []byte, n int64) []byte {
+	if n < 0 {
+		return appendCBORHead(buf, cborTypeNegativeInt, uint64(-1-n))
+	}
+	return appendCBORHead(buf, cborTypePositiveInt, uint64(n))
+}
+
+// getIntCBORSize returns size of CBOR encoded integer n.
+func getIntCBORSize(n int64) uint32 {
+	if n < 0 {
+		return atree.GetUintCBORSize(uint64(-1 - n))
+	}
+	return atree.GetUintCBORSize(uint64(n))
+}
+
+func decodeUint(dec *cbor.StreamDecoder, tagNumber uint64) (atree.Storable, error) {
+	n, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tagNumber {
+	case CBORTagUint8Value:
+		if n > math.MaxUint8 {
+			return nil, fmt.Errorf("invalid data, got %d, expected max %d", n, math.MaxUint8)
+		}
+		return Uint8Value(n), nil
+
+	case CBORTagUint16Value:
+		if n > math.MaxUint16 {
+			return nil, fmt.Errorf("invalid data, got %d, expected max %d", n, math.MaxUint16)
+		}
+		return Uint16Value(n), nil
+
+	case CBORTagUint32Value:
+		if n > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid data, got %d, expected max %d", n, math.MaxUint32)
+		}
+		return Uint32Value(n), nil
+
+	default:
+		return Uint64Value(n), nil
+	}
+}
+
+func decodeInt(dec *cbor.StreamDecoder, tagNumber uint64) (atree.Storable, error) {
+	n, err := dec.DecodeInt64()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tagNumber {
+	case CBORTagInt8Value:
+		if n < math.MinInt8 || n > math.MaxInt8 {
+			return nil, fmt.Errorf("invalid data, got %d, expected range %d-%d", n, math.MinInt8, math.MaxInt8)
+		}
+		return Int8Value(n), nil
+
+	case CBORTagInt16Value:
+		if n < math.MinInt16 || n > math.MaxInt16 {
+			return nil, fmt.Errorf("invalid data, got %d, expected range %d-%d", n, math.MinInt16, math.MaxInt16)
+		}
+		return Int16Value(n), nil
+
+	case CBORTagInt32Value:
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid data, got %d, expected range %d-%d", n, math.MinInt32, math.MaxInt32)
+		}
+		return Int32Value(n), nil
+
+	default:
+		return Int64Value(n), nil
+	}
+}
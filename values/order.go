@@ -0,0 +1,236 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/onflow/atree"
+)
+
+// OrderFunc returns a negative number if value is less than stored value
+// of storable, zero if they are equal, and a positive number if value is
+// greater.  OrderFunc can be combined with ChainOrder and ReverseOrder,
+// and converted to atree.ValueComparator for maps with Comparator, and to
+// atree.StorableLessFunc for aggregators with LessFunc.
+type OrderFunc func(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error)
+
+// Comparator returns atree.ValueComparator reporting values as equal if
+// o orders them as equal.
+func (o OrderFunc) Comparator() atree.ValueComparator {
+	return func(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (bool, error) {
+		c, err := o(storage, value, storable)
+		if err != nil {
+			return false, err
+		}
+		return c == 0, nil
+	}
+}
+
+// LessFunc returns atree.StorableLessFunc reporting whether storable a
+// is ordered before b by o.  Storables stored in separate slabs are
+// loaded from storage.
+func (o OrderFunc) LessFunc(storage atree.SlabStorage) atree.StorableLessFunc {
+	return func(a, b atree.Storable) (bool, error) {
+		value, err := a.StoredValue(storage)
+		if err != nil {
+			return false, err
+		}
+		c, err := o(storage, value, b)
+		if err != nil {
+			return false, err
+		}
+		return c < 0, nil
+	}
+}
+
+// NumericOrder orders integer, BigIntValue, and Float64Value values by
+// numeric value, so values of different integer types can be compared.
+// NaN is ordered after all other numbers and equal to itself.
+func NumericOrder(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+	other, err := storable.StoredValue(storage)
+	if err != nil {
+		return 0, err
+	}
+
+	a, err := numericOf(value)
+	if err != nil {
+		return 0, err
+	}
+
+	b, err := numericOf(other)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return 1, nil
+	case b == nil:
+		return -1, nil
+	}
+
+	return a.Cmp(b), nil
+}
+
+// numericOf returns numeric value of value, or nil if value is NaN.
+func numericOf(value atree.Value) (*big.Float, error) {
+	var i big.Int
+
+	switch v := value.(type) {
+	case Int8Value:
+		i.SetInt64(int64(v))
+	case Int16Value:
+		i.SetInt64(int64(v))
+	case Int32Value:
+		i.SetInt64(int64(v))
+	case Int64Value:
+		i.SetInt64(int64(v))
+	case Uint8Value:
+		i.SetUint64(uint64(v))
+	case Uint16Value:
+		i.SetUint64(uint64(v))
+	case Uint32Value:
+		i.SetUint64(uint64(v))
+	case Uint64Value:
+		i.SetUint64(uint64(v))
+	case BigIntValue:
+		i.Set(v.i)
+	case Float64Value:
+		if math.IsNaN(float64(v)) {
+			return nil, nil
+		}
+		return big.NewFloat(float64(v)), nil
+	default:
+		return nil, fmt.Errorf("value %T isn't numeric", value)
+	}
+
+	return new(big.Float).SetInt(&i), nil
+}
+
+// StringOrder orders StringValue values lexicographically by bytes.
+func StringOrder(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+	other, err := storable.StoredValue(storage)
+	if err != nil {
+		return 0, err
+	}
+
+	a, ok := value.(StringValue)
+	if !ok {
+		return 0, fmt.Errorf("value %T isn't StringValue", value)
+	}
+
+	b, ok := other.(StringValue)
+	if !ok {
+		return 0, fmt.Errorf("value %T isn't StringValue", other)
+	}
+
+	return strings.Compare(a.str, b.str), nil
+}
+
+// BytesOrder orders BytesValue values lexicographically.
+func BytesOrder(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+	other, err := storable.StoredValue(storage)
+	if err != nil {
+		return 0, err
+	}
+
+	a, ok := value.(BytesValue)
+	if !ok {
+		return 0, fmt.Errorf("value %T isn't BytesValue", value)
+	}
+
+	b, ok := other.(BytesValue)
+	if !ok {
+		return 0, fmt.Errorf("value %T isn't BytesValue", other)
+	}
+
+	return bytes.Compare(a.b, b.b), nil
+}
+
+// ChainOrder returns OrderFunc using orders in turn until one of them
+// orders values as unequal.
+func ChainOrder(orders ...OrderFunc) OrderFunc {
+	return func(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+		for _, order := range orders {
+			c, err := order(storage, value, storable)
+			if err != nil || c != 0 {
+				return c, err
+			}
+		}
+		return 0, nil
+	}
+}
+
+// ReverseOrder returns OrderFunc ordering values in reverse of order.
+func ReverseOrder(order OrderFunc) OrderFunc {
+	return func(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+		c, err := order(storage, value, storable)
+		return -c, err
+	}
+}
+
+// CompositeOrder returns OrderFunc of composite values.  fields returns
+// fields of value, which must be Storables, and field i is ordered by
+// orders[i].  Values are ordered by their first unequal field.
+func CompositeOrder(
+	fields func(atree.Value) ([]atree.Value, error),
+	orders ...OrderFunc,
+) OrderFunc {
+	return func(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+		other, err := storable.StoredValue(storage)
+		if err != nil {
+			return 0, err
+		}
+
+		a, err := fields(value)
+		if err != nil {
+			return 0, err
+		}
+
+		b, err := fields(other)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(a) != len(orders) || len(b) != len(orders) {
+			return 0, fmt.Errorf("composite values have %d and %d fields, want %d", len(a), len(b), len(orders))
+		}
+
+		for i, order := range orders {
+			field, ok := b[i].(atree.Storable)
+			if !ok {
+				return 0, fmt.Errorf("field %d %T isn't Storable", i, b[i])
+			}
+
+			c, err := order(storage, a[i], field)
+			if err != nil || c != 0 {
+				return c, err
+			}
+		}
+
+		return 0, nil
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/onflow/atree"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrder(t *testing.T) {
+	storage := newTestStorage(t)
+
+	requireOrder := func(t *testing.T, order OrderFunc, a atree.Value, b atree.Storable, want int) {
+		c, err := order(storage, a, b)
+		require.NoError(t, err)
+		require.Equal(t, want, sign(c), "%s %s", a, b)
+	}
+
+	t.Run("numeric", func(t *testing.T) {
+		requireOrder(t, NumericOrder, Int8Value(-1), Uint64Value(math.MaxUint64), -1)
+		requireOrder(t, NumericOrder, Uint64Value(math.MaxUint64), Int64Value(math.MaxInt64), 1)
+		requireOrder(t, NumericOrder, Uint16Value(7), Int32Value(7), 0)
+		requireOrder(t, NumericOrder, NewBigIntValue(new(big.Int).Lsh(big.NewInt(1), 100)), Uint64Value(math.MaxUint64), 1)
+		requireOrder(t, NumericOrder, Float64Value(1.5), Uint8Value(1), 1)
+		requireOrder(t, NumericOrder, Float64Value(math.Inf(-1)), Int64Value(math.MinInt64), -1)
+		requireOrder(t, NumericOrder, Float64Value(math.NaN()), Float64Value(math.Inf(1)), 1)
+		requireOrder(t, NumericOrder, Float64Value(math.NaN()), Float64Value(math.NaN()), 0)
+
+		_, err := NumericOrder(storage, NewStringValue("1"), Uint8Value(1))
+		require.Error(t, err)
+	})
+
+	t.Run("string and bytes", func(t *testing.T) {
+		requireOrder(t, StringOrder, NewStringValue("ab"), NewStringValue("b"), -1)
+		requireOrder(t, StringOrder, NewStringValue("b"), NewStringValue("b"), 0)
+		requireOrder(t, BytesOrder, NewBytesValue([]byte{2}), NewBytesValue([]byte{1, 2}), 1)
+
+		_, err := StringOrder(storage, NewStringValue("a"), NewBytesValue([]byte("a")))
+		require.Error(t, err)
+	})
+
+	t.Run("combinators", func(t *testing.T) {
+		byLength := OrderFunc(func(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (int, error) {
+			other, err := storable.StoredValue(storage)
+			if err != nil {
+				return 0, err
+			}
+			return len(value.(StringValue).str) - len(other.(StringValue).str), nil
+		})
+
+		order := ChainOrder(byLength, ReverseOrder(StringOrder))
+		requireOrder(t, order, NewStringValue("b"), NewStringValue("aa"), -1)
+		requireOrder(t, order, NewStringValue("b"), NewStringValue("a"), -1)
+		requireOrder(t, order, NewStringValue("a"), NewStringValue("a"), 0)
+	})
+
+	t.Run("composite", func(t *testing.T) {
+		// Composite values are arrays of (string, uint64) pairs.
+		fields := func(value atree.Value) ([]atree.Value, error) {
+			array := value.(*atree.Array)
+			var fields []atree.Value
+			err := array.Iterate(func(v atree.Value) (bool, error) {
+				fields = append(fields, v)
+				return true, nil
+			})
+			return fields, err
+		}
+
+		newPair := func(s string, n uint64) *atree.Array {
+			array, err := atree.NewArray(storage, atree.Address{1, 2, 3, 4, 5, 6, 7, 8}, testTypeInfo{42})
+			require.NoError(t, err)
+			require.NoError(t, array.Append(NewStringValue(s)))
+			require.NoError(t, array.Append(Uint64Value(n)))
+			return array
+		}
+
+		storable := func(array *atree.Array) atree.Storable {
+			return atree.StorageIDStorable(array.StorageID())
+		}
+
+		order := CompositeOrder(fields, StringOrder, NumericOrder)
+		requireOrder(t, order, newPair("a", 2), storable(newPair("b", 1)), -1)
+		requireOrder(t, order, newPair("a", 2), storable(newPair("a", 1)), 1)
+		requireOrder(t, order, newPair("a", 1), storable(newPair("a", 1)), 0)
+	})
+
+	t.Run("comparator", func(t *testing.T) {
+		m, err := atree.NewMap(storage, atree.Address{1, 2, 3, 4, 5, 6, 7, 8}, atree.NewDefaultDigesterBuilder(), testTypeInfo{42})
+		require.NoError(t, err)
+
+		comparator := OrderFunc(StringOrder).Comparator()
+		_, err = m.Set(comparator, HashInputProvider, NewStringValue("a"), Uint64Value(1))
+		require.NoError(t, err)
+
+		storable, err := m.Get(comparator, HashInputProvider, NewStringValue("a"))
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(1), storable)
+	})
+
+	t.Run("less", func(t *testing.T) {
+		array, err := atree.NewArray(storage, atree.Address{1, 2, 3, 4, 5, 6, 7, 8}, testTypeInfo{42})
+		require.NoError(t, err)
+
+		for _, v := range []atree.Value{Int64Value(3), Uint8Value(200), Int8Value(-5), Float64Value(7.5)} {
+			require.NoError(t, array.Append(v))
+		}
+
+		less := OrderFunc(NumericOrder).LessFunc(storage)
+
+		min, err := array.Aggregate(atree.NewMinAggregator(less))
+		require.NoError(t, err)
+		require.Equal(t, Int8Value(-5), min)
+
+		max, err := array.Aggregate(atree.NewMaxAggregator(ReverseOrder(NumericOrder).LessFunc(storage)))
+		require.NoError(t, err)
+		require.Equal(t, Int8Value(-5), max)
+	})
+}
+
+func sign(c int) int {
+	switch {
+	case c < 0:
+		return -1
+	case c > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+)
+
+const (
+	cborTypeByteString = 0x40
+	cborTypeTextString = 0x60
+
+	cborFalse   = 0xf4
+	cborTrue    = 0xf5
+	cborNil     = 0xf6
+	cborFloat64 = 0xfb
+)
+
+type BoolValue bool
+
+var _ atree.Value = BoolValue(false)
+var _ atree.Storable = BoolValue(false)
+var _ HashableValue = BoolValue(false)
+
+func (v BoolValue) ChildStorables() []atree.Storable { return nil }
+
+func (v BoolValue) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v BoolValue) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+func (v BoolValue) Encode(enc *atree.Encoder) error {
+	return enc.CBOR.EncodeBool(bool(v))
+}
+
+func (v BoolValue) HashInput(scratch []byte) ([]byte, error) {
+	if v {
+		return append(scratch[:0], cborTrue), nil
+	}
+	return append(scratch[:0], cborFalse), nil
+}
+
+func (v BoolValue) ByteSize() uint32 {
+	return 1
+}
+
+func (v BoolValue) String() string {
+	return fmt.Sprintf("%t", bool(v))
+}
+
+type NilValue struct{}
+
+var _ atree.Value = NilValue{}
+var _ atree.Storable = NilValue{}
+var _ HashableValue = NilValue{}
+
+func (v NilValue) ChildStorables() []atree.Storable { return nil }
+
+func (v NilValue) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v NilValue) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+func (v NilValue) Encode(enc *atree.Encoder) error {
+	return enc.CBOR.EncodeNil()
+}
+
+func (v NilValue) HashInput(scratch []byte) ([]byte, error) {
+	return append(scratch[:0], cborNil), nil
+}
+
+func (v NilValue) ByteSize() uint32 {
+	return 1
+}
+
+func (v NilValue) String() string {
+	return "nil"
+}
+
+type Float64Value float64
+
+var _ atree.Value = Float64Value(0)
+var _ atree.Storable = Float64Value(0)
+var _ HashableValue = Float64Value(0)
+
+func (v Float64Value) ChildStorables() []atree.Storable { return nil }
+
+func (v Float64Value) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v Float64Value) Storable(_ atree.SlabStorage, _ atree.Address, _ uint64) (atree.Storable, error) {
+	return v, nil
+}
+
+// Encode encodes Float64Value as CBOR double-precision float.
+// It always uses 8-byte encoding so that ByteSize is constant.
+func (v Float64Value) Encode(enc *atree.Encoder) error {
+	enc.Scratch[0] = cborFloat64
+	binary.BigEndian.PutUint64(enc.Scratch[1:], v.bits())
+	return enc.CBOR.EncodeRawBytes(enc.Scratch[:9])
+}
+
+func (v Float64Value) HashInput(scratch []byte) ([]byte, error) {
+	buf := append(scratch[:0], cborFloat64, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(buf[1:], v.bits())
+	return buf, nil
+}
+
+func (v Float64Value) ByteSize() uint32 {
+	// type (1 byte) + float64 (8 bytes)
+	return 9
+}
+
+func (v Float64Value) String() string {
+	return fmt.Sprintf("%g", float64(v))
+}
+
+func (v Float64Value) bits() uint64 {
+	return math.Float64bits(float64(v))
+}
+
+func decodeFloat64(dec *cbor.StreamDecoder) (atree.Storable, error) {
+	b, err := dec.DecodeRawBytesZeroCopy()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 9 || b[0] != cborFloat64 {
+		return nil, fmt.Errorf("invalid float64 data %x", b)
+	}
+	return Float64Value(math.Float64frombits(binary.BigEndian.Uint64(b[1:]))), nil
+}
+
+// BytesValue is a byte string value.  BytesValue larger than max
+// inline size is stored in a separate StorableSlab.
+type BytesValue struct {
+	b    []byte
+	size uint32
+}
+
+var _ atree.Value = BytesValue{}
+var _ atree.Storable = BytesValue{}
+var _ HashableValue = BytesValue{}
+
+// NewBytesValue returns BytesValue containing b.  b must not be modified afterwards.
+func NewBytesValue(b []byte) BytesValue {
+	size := atree.GetUintCBORSize(uint64(len(b))) + uint32(len(b))
+	return BytesValue{b: b, size: size}
+}
+
+func (v BytesValue) Bytes() []byte {
+	return v.b
+}
+
+func (v BytesValue) ChildStorables() []atree.Storable { return nil }
+
+func (v BytesValue) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v BytesValue) Storable(storage atree.SlabStorage, address atree.Address, maxInlineSize uint64) (atree.Storable, error) {
+	return storeIfTooLarge(storage, address, maxInlineSize, v)
+}
+
+func (v BytesValue) Encode(enc *atree.Encoder) error {
+	if v.b == nil {
+		// Encode nil as empty byte string instead of CBOR nil.
+		return enc.CBOR.EncodeBytes([]byte{})
+	}
+	return enc.CBOR.EncodeBytes(v.b)
+}
+
+func (v BytesValue) HashInput(scratch []byte) ([]byte, error) {
+	buf := appendCBORHead(scratch[:0], cborTypeByteString, uint64(len(v.b)))
+	return append(buf, v.b...), nil
+}
+
+func (v BytesValue) ByteSize() uint32 {
+	return v.size
+}
+
+func (v BytesValue) String() string {
+	return fmt.Sprintf("%x", v.b)
+}
+
+// StringValue is a text string value.  StringValue larger than max
+// inline size is stored in a separate StorableSlab.
+type StringValue struct {
+	str  string
+	size uint32
+}
+
+var _ atree.Value = StringValue{}
+var _ atree.Storable = StringValue{}
+var _ HashableValue = StringValue{}
+
+func NewStringValue(s string) StringValue {
+	size := atree.GetUintCBORSize(uint64(len(s))) + uint32(len(s))
+	return StringValue{str: s, size: size}
+}
+
+func (v StringValue) ChildStorables() []atree.Storable { return nil }
+
+func (v StringValue) StoredValue(_ atree.SlabStorage) (atree.Value, error) {
+	return v, nil
+}
+
+func (v StringValue) Storable(storage atree.SlabStorage, address atree.Address, maxInlineSize uint64) (atree.Storable, error) {
+	return storeIfTooLarge(storage, address, maxInlineSize, v)
+}
+
+func (v StringValue) Encode(enc *atree.Encoder) error {
+	return enc.CBOR.EncodeString(v.str)
+}
+
+func (v StringValue) HashInput(scratch []byte) ([]byte, error) {
+	buf := appendCBORHead(scratch[:0], cborTypeTextString, uint64(len(v.str)))
+	return append(buf, v.str...), nil
+}
+
+func (v StringValue) ByteSize() uint32 {
+	return v.size
+}
+
+func (v StringValue) String() string {
+	return v.str
+}
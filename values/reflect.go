@@ -0,0 +1,510 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/onflow/atree"
+)
+
+// StructTag is struct tag key of field names used by Converter.
+// Fields tagged with `atree:"-"` are skipped.
+const StructTag = "atree"
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// Converter converts native Go values to atree values and back
+// using reflection:
+//
+//   - bool, integers, floats, string, and []byte are converted to
+//     primitive values (int and uint are converted to Int64Value and Uint64Value)
+//   - *big.Int and big.Int are converted to BigIntValue
+//   - nil pointers, interfaces, slices, and maps are converted to NilValue
+//   - slices and arrays are converted to *atree.Array
+//   - maps are converted to *atree.OrderedMap
+//   - structs are converted to *CompositeValue with a layout of exported
+//     fields in declaration order
+//
+// Collections are created in Storage at Address.
+type Converter struct {
+	Storage atree.SlabStorage
+	Address atree.Address
+	// TypeInfo returns type info of collections created for Go type t.
+	TypeInfo func(t reflect.Type) atree.TypeInfo
+}
+
+// ToValue converts v to atree value.
+func (c *Converter) ToValue(v interface{}) (atree.Value, error) {
+	if v == nil {
+		return NilValue{}, nil
+	}
+	return c.toValue(reflect.ValueOf(v))
+}
+
+func (c *Converter) toValue(rv reflect.Value) (atree.Value, error) {
+
+	switch rv.Type() {
+	case bigIntType:
+		i := rv.Interface().(big.Int)
+		return NewBigIntValue(&i), nil
+	case reflect.PtrTo(bigIntType):
+		if rv.IsNil() {
+			return NilValue{}, nil
+		}
+		return NewBigIntValue(rv.Interface().(*big.Int)), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return BoolValue(rv.Bool()), nil
+	case reflect.Int8:
+		return Int8Value(rv.Int()), nil
+	case reflect.Int16:
+		return Int16Value(rv.Int()), nil
+	case reflect.Int32:
+		return Int32Value(rv.Int()), nil
+	case reflect.Int, reflect.Int64:
+		return Int64Value(rv.Int()), nil
+	case reflect.Uint8:
+		return Uint8Value(rv.Uint()), nil
+	case reflect.Uint16:
+		return Uint16Value(rv.Uint()), nil
+	case reflect.Uint32:
+		return Uint32Value(rv.Uint()), nil
+	case reflect.Uint, reflect.Uint64:
+		return Uint64Value(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return Float64Value(rv.Float()), nil
+	case reflect.String:
+		return NewStringValue(rv.String()), nil
+
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return NilValue{}, nil
+		}
+		return c.toValue(rv.Elem())
+
+	case reflect.Slice:
+		if rv.IsNil() {
+			return NilValue{}, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return NewBytesValue(b), nil
+		}
+		return c.toArray(rv)
+
+	case reflect.Array:
+		return c.toArray(rv)
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return NilValue{}, nil
+		}
+		return c.toMap(rv)
+
+	case reflect.Struct:
+		return c.toComposite(rv)
+
+	default:
+		return nil, fmt.Errorf("can't convert %s to atree value", rv.Type())
+	}
+}
+
+func (c *Converter) toArray(rv reflect.Value) (atree.Value, error) {
+	i := 0
+	return atree.NewArrayFromBatchData(c.Storage, c.Address, c.TypeInfo(rv.Type()), func() (atree.Value, error) {
+		if i >= rv.Len() {
+			return nil, nil
+		}
+		element, err := c.toValue(rv.Index(i))
+		i++
+		return element, err
+	})
+}
+
+func (c *Converter) toMap(rv reflect.Value) (atree.Value, error) {
+	m, err := atree.NewMap(c.Storage, c.Address, atree.NewDefaultDigesterBuilder(), c.TypeInfo(rv.Type()))
+	if err != nil {
+		return nil, err
+	}
+
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := c.toValue(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := c.toValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = m.Set(Compare, HashInputProvider, key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (c *Converter) toComposite(rv reflect.Value) (atree.Value, error) {
+	layout, indexes, err := structLayout(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	composite, err := NewCompositeValue(c.Storage, c.Address, c.TypeInfo(rv.Type()), layout)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range layout.fields {
+		value, err := c.toValue(rv.Field(indexes[i]))
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = composite.SetField(name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return composite, nil
+}
+
+// structLayout returns composite layout of struct type t, and indexes
+// of struct fields in layout order.
+func structLayout(t reflect.Type) (*CompositeLayout, []int, error) {
+	var names []string
+	var indexes []int
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := structFieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		names = append(names, name)
+		indexes = append(indexes, i)
+	}
+
+	layout, err := NewCompositeLayout(names...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't convert %s to composite: %w", t, err)
+	}
+	return layout, indexes, nil
+}
+
+// structFieldName returns name of exported struct field, or false if field is skipped.
+func structFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		// unexported field
+		return "", false
+	}
+
+	tag := f.Tag.Get(StructTag)
+	if tag == "-" {
+		return "", false
+	}
+
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+
+	return f.Name, true
+}
+
+// FromValue converts atree value to Go value pointed to by target.
+// Composite fields without corresponding struct fields are ignored.
+func (c *Converter) FromValue(value atree.Value, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("target must be non-nil pointer, got %T", target)
+	}
+	return c.fromValue(value, rv.Elem())
+}
+
+func (c *Converter) fromValue(value atree.Value, rv reflect.Value) error {
+
+	if _, ok := value.(NilValue); ok {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	if rv.Type() == bigIntType {
+		v, ok := value.(BigIntValue)
+		if !ok {
+			return typeMismatchError(value, rv)
+		}
+		rv.Set(reflect.ValueOf(*v.BigInt()))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		v, ok := value.(BoolValue)
+		if !ok {
+			return typeMismatchError(value, rv)
+		}
+		rv.SetBool(bool(v))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := intOf(value)
+		if !ok || !i.IsInt64() || rv.OverflowInt(i.Int64()) {
+			return typeMismatchError(value, rv)
+		}
+		rv.SetInt(i.Int64())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := intOf(value)
+		if !ok || !i.IsUint64() || rv.OverflowUint(i.Uint64()) {
+			return typeMismatchError(value, rv)
+		}
+		rv.SetUint(i.Uint64())
+
+	case reflect.Float32, reflect.Float64:
+		v, ok := value.(Float64Value)
+		if !ok {
+			return typeMismatchError(value, rv)
+		}
+		rv.SetFloat(float64(v))
+
+	case reflect.String:
+		v, ok := value.(StringValue)
+		if !ok {
+			return typeMismatchError(value, rv)
+		}
+		rv.SetString(v.str)
+
+	case reflect.Ptr:
+		elem := reflect.New(rv.Type().Elem())
+		err := c.fromValue(value, elem.Elem())
+		if err != nil {
+			return err
+		}
+		rv.Set(elem)
+
+	case reflect.Interface:
+		v, err := c.naturalValue(value)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(v))
+
+	case reflect.Slice:
+		if v, ok := value.(BytesValue); ok && rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := reflect.MakeSlice(rv.Type(), len(v.b), len(v.b))
+			reflect.Copy(b, reflect.ValueOf(v.b))
+			rv.Set(b)
+			return nil
+		}
+
+		array, ok := value.(*atree.Array)
+		if !ok {
+			return typeMismatchError(value, rv)
+		}
+
+		rv.Set(reflect.MakeSlice(rv.Type(), int(array.Count()), int(array.Count())))
+		return c.fromArray(array, rv)
+
+	case reflect.Array:
+		array, ok := value.(*atree.Array)
+		if !ok || array.Count() != uint64(rv.Len()) {
+			return typeMismatchError(value, rv)
+		}
+		return c.fromArray(array, rv)
+
+	case reflect.Map:
+		m, ok := value.(*atree.OrderedMap)
+		if !ok {
+			return typeMismatchError(value, rv)
+		}
+
+		rv.Set(reflect.MakeMapWithSize(rv.Type(), int(m.Count())))
+
+		return m.Iterate(func(k atree.Value, v atree.Value) (bool, error) {
+			key := reflect.New(rv.Type().Key()).Elem()
+			err := c.fromValue(k, key)
+			if err != nil {
+				return false, err
+			}
+
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			err = c.fromValue(v, elem)
+			if err != nil {
+				return false, err
+			}
+
+			rv.SetMapIndex(key, elem)
+			return true, nil
+		})
+
+	case reflect.Struct:
+		var composite *CompositeValue
+		switch v := value.(type) {
+		case *CompositeValue:
+			composite = v
+		case *atree.Array:
+			layout, _, err := structLayout(rv.Type())
+			if err != nil {
+				return err
+			}
+			composite, err = NewCompositeValueFromArray(v, layout)
+			if err != nil {
+				return err
+			}
+		default:
+			return typeMismatchError(value, rv)
+		}
+		return c.fromComposite(composite, rv)
+
+	default:
+		return typeMismatchError(value, rv)
+	}
+
+	return nil
+}
+
+func (c *Converter) fromArray(array *atree.Array, rv reflect.Value) error {
+	i := 0
+	return array.Iterate(func(element atree.Value) (bool, error) {
+		err := c.fromValue(element, rv.Index(i))
+		i++
+		return err == nil, err
+	})
+}
+
+func (c *Converter) fromComposite(composite *CompositeValue, rv reflect.Value) error {
+	t := rv.Type()
+
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := structFieldName(t.Field(i)); ok {
+			fields[name] = i
+		}
+	}
+
+	return composite.IterateFields(func(name string, value atree.Value) (bool, error) {
+		i, ok := fields[name]
+		if !ok {
+			return true, nil
+		}
+		err := c.fromValue(value, rv.Field(i))
+		return err == nil, err
+	})
+}
+
+// naturalValue returns Go value of atree value for interface{} targets.
+// Arrays are converted to []interface{}, and maps and composites
+// to map[interface{}]interface{}.
+func (c *Converter) naturalValue(value atree.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case BoolValue:
+		return bool(v), nil
+	case Uint8Value:
+		return uint8(v), nil
+	case Uint16Value:
+		return uint16(v), nil
+	case Uint32Value:
+		return uint32(v), nil
+	case Uint64Value:
+		return uint64(v), nil
+	case Int8Value:
+		return int8(v), nil
+	case Int16Value:
+		return int16(v), nil
+	case Int32Value:
+		return int32(v), nil
+	case Int64Value:
+		return int64(v), nil
+	case Float64Value:
+		return float64(v), nil
+	case StringValue:
+		return v.str, nil
+	case BytesValue:
+		return v.b, nil
+	case BigIntValue:
+		return v.BigInt(), nil
+	case *CompositeValue:
+		fields := make(map[interface{}]interface{}, v.FieldCount())
+		err := v.IterateFields(func(name string, value atree.Value) (bool, error) {
+			field, err := c.naturalValue(value)
+			if err != nil {
+				return false, err
+			}
+			fields[name] = field
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return fields, nil
+	case *atree.Array, *atree.OrderedMap:
+		var target interface{}
+		if _, ok := v.(*atree.Array); ok {
+			target = &[]interface{}{}
+		} else {
+			target = &map[interface{}]interface{}{}
+		}
+		err := c.FromValue(v, target)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(target).Elem().Interface(), nil
+	default:
+		return nil, fmt.Errorf("can't convert %T to Go value", value)
+	}
+}
+
+// intOf returns integer of integer value.
+func intOf(value atree.Value) (*big.Int, bool) {
+	switch v := value.(type) {
+	case Uint8Value:
+		return new(big.Int).SetUint64(uint64(v)), true
+	case Uint16Value:
+		return new(big.Int).SetUint64(uint64(v)), true
+	case Uint32Value:
+		return new(big.Int).SetUint64(uint64(v)), true
+	case Uint64Value:
+		return new(big.Int).SetUint64(uint64(v)), true
+	case Int8Value:
+		return big.NewInt(int64(v)), true
+	case Int16Value:
+		return big.NewInt(int64(v)), true
+	case Int32Value:
+		return big.NewInt(int64(v)), true
+	case Int64Value:
+		return big.NewInt(int64(v)), true
+	case BigIntValue:
+		return v.BigInt(), true
+	default:
+		return nil, false
+	}
+}
+
+func typeMismatchError(value atree.Value, rv reflect.Value) error {
+	return fmt.Errorf("can't convert %T to %s", value, rv.Type())
+}
@@ -0,0 +1,154 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/stretchr/testify/require"
+)
+
+type testReflectItem struct {
+	Name     string
+	Quantity uint16 `atree:"qty"`
+}
+
+type testReflectOrder struct {
+	ID       uint64 `atree:"id"`
+	Customer *string
+	Items    []testReflectItem
+	Tags     map[string]int
+	Total    *big.Int
+	Payload  []byte
+	Ratio    float64
+	Paid     bool
+	Codes    [2]int8
+	Any      interface{}
+	Ignored  string `atree:"-"`
+	internal string
+}
+
+func TestConverter(t *testing.T) {
+
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	storage := atree.NewBasicSlabStorage(encMode, decMode, DecodeStorable, decodeTypeInfo)
+
+	var typeInfos []reflect.Type
+	converter := &Converter{
+		Storage: storage,
+		Address: address,
+		TypeInfo: func(t reflect.Type) atree.TypeInfo {
+			typeInfos = append(typeInfos, t)
+			return testTypeInfo{uint64(len(typeInfos))}
+		},
+	}
+
+	customer := "alice"
+	order := testReflectOrder{
+		ID:       7,
+		Customer: &customer,
+		Items: []testReflectItem{
+			{Name: "apple", Quantity: 3},
+			{Name: "pear", Quantity: 5},
+		},
+		Tags:     map[string]int{"a": 1, "b": -2},
+		Total:    big.NewInt(1234567890),
+		Payload:  []byte{1, 2, 3},
+		Ratio:    0.5,
+		Paid:     true,
+		Codes:    [2]int8{-1, 1},
+		Any:      "text",
+		Ignored:  "ignored",
+		internal: "internal",
+	}
+
+	value, err := converter.ToValue(order)
+	require.NoError(t, err)
+
+	composite, ok := value.(*CompositeValue)
+	require.True(t, ok)
+	require.Equal(t, uint64(10), composite.FieldCount())
+
+	id, err := composite.GetField("id")
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(7), id)
+
+	require.False(t, composite.HasField("Ignored"))
+
+	// Composite decoded from storage is converted back.
+	encoded, err := storage.Encode()
+	require.NoError(t, err)
+
+	storage2 := atree.NewBasicSlabStorage(encMode, decMode, DecodeStorable, decodeTypeInfo)
+	for id, data := range encoded {
+		slab, err := atree.DecodeSlab(id, data, decMode, DecodeStorable, decodeTypeInfo)
+		require.NoError(t, err)
+
+		err = storage2.Store(id, slab)
+		require.NoError(t, err)
+	}
+
+	stored, err := atree.NewArrayWithRootID(storage2, composite.StorageID())
+	require.NoError(t, err)
+
+	var decoded testReflectOrder
+	err = converter.FromValue(stored, &decoded)
+	require.NoError(t, err)
+
+	order.Ignored = ""
+	order.internal = ""
+	require.Equal(t, order, decoded)
+
+	t.Run("nil", func(t *testing.T) {
+		value, err := converter.ToValue(testReflectOrder{})
+		require.NoError(t, err)
+
+		decoded := testReflectOrder{Customer: &customer}
+		err = converter.FromValue(value, &decoded)
+		require.NoError(t, err)
+		require.Equal(t, testReflectOrder{}, decoded)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		var i int8
+		err := converter.FromValue(Uint64Value(1000), &i)
+		require.Error(t, err)
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		value, err := converter.ToValue([]interface{}{uint64(1), "a", []interface{}{true}})
+		require.NoError(t, err)
+
+		var decoded interface{}
+		err = converter.FromValue(value, &decoded)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{uint64(1), "a", []interface{}{true}}, decoded)
+	})
+}
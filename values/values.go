@@ -0,0 +1,237 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package values provides commonly used atree Value and Storable
+// implementations, so embedders don't need to reimplement them.
+//
+// Values are encoded as CBOR data.  Fixed-size integer values are encoded
+// as tagged CBOR integers so that their type survives round trips.
+// BigIntValue is encoded as CBOR bignum.
+// Bool, Nil, Float64, Bytes, and String values are encoded as
+// native CBOR data.
+//
+// DecodeStorable, Compare, and HashInputProvider can be passed to
+// atree storage and collection functions directly.
+package values
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+)
+
+const (
+	CBORTagUint8Value  = 161
+	CBORTagUint16Value = 162
+	CBORTagUint32Value = 163
+	CBORTagUint64Value = 164
+
+	CBORTagInt8Value  = 166
+	CBORTagInt16Value = 167
+	CBORTagInt32Value = 168
+	CBORTagInt64Value = 169
+)
+
+// HashableValue is a Value that provides input for map key digests.
+type HashableValue interface {
+	atree.Value
+	HashInput(scratch []byte) ([]byte, error)
+}
+
+// HashInputProvider returns hash input of atree.SomeValue and
+// values implementing HashableValue.
+var HashInputProvider = atree.NewSomeHashInputProvider(hashableValueHashInput)
+
+func hashableValueHashInput(value atree.Value, scratch []byte) ([]byte, error) {
+	hv, ok := value.(HashableValue)
+	if !ok {
+		return nil, fmt.Errorf("value %T doesn't implement HashableValue", value)
+	}
+	return hv.HashInput(scratch)
+}
+
+// Compare returns true if value and stored value of storable are equal.
+func Compare(storage atree.SlabStorage, value atree.Value, storable atree.Storable) (bool, error) {
+	if v, ok := value.(atree.SomeValue); ok {
+		other, ok := storable.(atree.SomeStorable)
+		if !ok {
+			return false, nil
+		}
+		return Compare(storage, v.Value, other.Storable)
+	}
+
+	if v, ok := value.(atree.TimestampedValue); ok {
+		other, ok := storable.(atree.TimestampedStorable)
+		if !ok || v.Timestamp != other.Timestamp || v.Replica != other.Replica {
+			return false, nil
+		}
+		return Compare(storage, v.Value, other.Storable)
+	}
+
+	other, err := storable.StoredValue(storage)
+	if err != nil {
+		return false, err
+	}
+
+	switch v := value.(type) {
+	case BigIntValue:
+		o, ok := other.(BigIntValue)
+		return ok && v.i.Cmp(o.i) == 0, nil
+
+	case BytesValue:
+		o, ok := other.(BytesValue)
+		return ok && string(v.b) == string(o.b), nil
+
+	case Float64Value:
+		o, ok := other.(Float64Value)
+		// Compare bits so NaN values can be map keys.
+		return ok && v.bits() == o.bits(), nil
+
+	case BoolValue, NilValue, StringValue,
+		Int8Value, Int16Value, Int32Value, Int64Value,
+		Uint8Value, Uint16Value, Uint32Value, Uint64Value:
+		return value == other, nil
+	}
+
+	return false, fmt.Errorf("value %T isn't supported", value)
+}
+
+// DecodeStorable decodes storables of this package, atree.SomeStorable, and atree.StorageIDStorable.
+func DecodeStorable(dec *cbor.StreamDecoder, id atree.StorageID) (atree.Storable, error) {
+	t, err := dec.NextType()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case cbor.BoolType:
+		b, err := dec.DecodeBool()
+		if err != nil {
+			return nil, err
+		}
+		return BoolValue(b), nil
+
+	case cbor.NilType:
+		err := dec.DecodeNil()
+		if err != nil {
+			return nil, err
+		}
+		return NilValue{}, nil
+
+	case cbor.OtherType:
+		return decodeFloat64(dec)
+
+	case cbor.ByteStringType:
+		b, err := dec.DecodeBytes()
+		if err != nil {
+			return nil, err
+		}
+		return NewBytesValue(b), nil
+
+	case cbor.TextStringType:
+		s, err := dec.DecodeString()
+		if err != nil {
+			return nil, err
+		}
+		return NewStringValue(s), nil
+
+	case cbor.BigNumType:
+		i, err := dec.DecodeBigInt()
+		if err != nil {
+			return nil, err
+		}
+		return NewBigIntValue(i), nil
+
+	case cbor.TagType:
+		tagNumber, err := dec.DecodeTagNumber()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tagNumber {
+		case atree.CBORTagStorageID:
+			return atree.DecodeStorageIDStorable(dec)
+
+		case atree.CBORTagSomeValue:
+			return atree.DecodeSomeStorable(dec, id, DecodeStorable)
+
+		case atree.CBORTagTimestampedValue:
+			return atree.DecodeTimestampedStorable(dec, id, DecodeStorable)
+
+		case CBORTagUint8Value, CBORTagUint16Value, CBORTagUint32Value, CBORTagUint64Value:
+			return decodeUint(dec, tagNumber)
+
+		case CBORTagInt8Value, CBORTagInt16Value, CBORTagInt32Value, CBORTagInt64Value:
+			return decodeInt(dec, tagNumber)
+
+		default:
+			return nil, fmt.Errorf("invalid tag number %d", tagNumber)
+		}
+	}
+
+	return nil, fmt.Errorf("invalid cbor type %s for storable", t)
+}
+
+// storeIfTooLarge returns StorageIDStorable of a new StorableSlab containing
+// storable if storable is larger than maxInlineSize.  Otherwise it returns storable.
+func storeIfTooLarge(
+	storage atree.SlabStorage,
+	address atree.Address,
+	maxInlineSize uint64,
+	storable atree.Storable,
+) (atree.Storable, error) {
+	if uint64(storable.ByteSize()) <= maxInlineSize {
+		return storable, nil
+	}
+
+	id, err := storage.GenerateStorageID(address)
+	if err != nil {
+		return nil, err
+	}
+
+	slab := &atree.StorableSlab{
+		StorageID: id,
+		Storable:  storable,
+	}
+
+	err = storage.Store(id, slab)
+	if err != nil {
+		return nil, err
+	}
+
+	return atree.StorageIDStorable(id), nil
+}
+
+// appendCBORHead appends CBOR head of given major type and argument to buf.
+func appendCBORHead(buf []byte, majorType byte, n uint64) []byte {
+	switch {
+	case n <= 23:
+		return append(buf, majorType|byte(n))
+	case n <= 0xff:
+		return append(buf, majorType|24, byte(n))
+	case n <= 0xffff:
+		return append(buf, majorType|25, byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		return append(buf, majorType|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	default:
+		return append(buf, majorType|27,
+			byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+			byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
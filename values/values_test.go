@@ -0,0 +1,300 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package values
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/onflow/atree"
+	"github.com/stretchr/testify/require"
+)
+
+type testTypeInfo struct {
+	value uint64
+}
+
+var _ atree.TypeInfo = testTypeInfo{}
+
+func (i testTypeInfo) Encode(enc *cbor.StreamEncoder) error {
+	return enc.EncodeUint64(i.value)
+}
+
+func decodeTypeInfo(dec *cbor.StreamDecoder) (atree.TypeInfo, error) {
+	value, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+	return testTypeInfo{value: value}, nil
+}
+
+func newTestStorage(t testing.TB) *atree.BasicSlabStorage {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	return atree.NewBasicSlabStorage(encMode, decMode, DecodeStorable, decodeTypeInfo)
+}
+
+func testValues() []atree.Storable {
+	return []atree.Storable{
+		BoolValue(true),
+		BoolValue(false),
+		NilValue{},
+		Int8Value(math.MinInt8),
+		Int8Value(math.MaxInt8),
+		Int16Value(math.MinInt16),
+		Int16Value(-24),
+		Int32Value(-25),
+		Int32Value(math.MaxInt32),
+		Int64Value(math.MinInt64),
+		Int64Value(0),
+		Int64Value(math.MaxInt64),
+		Uint8Value(23),
+		Uint8Value(math.MaxUint8),
+		Uint16Value(math.MaxUint16),
+		Uint32Value(math.MaxUint32),
+		Uint64Value(math.MaxUint64),
+		Float64Value(0),
+		Float64Value(-1.5),
+		Float64Value(math.Inf(1)),
+		NewBytesValue(nil),
+		NewBytesValue([]byte{1, 2, 3}),
+		NewStringValue(""),
+		NewStringValue("abc"),
+		NewStringValue(strings.Repeat("a", 300)),
+		atree.SomeStorable{Storable: Uint8Value(1)},
+		atree.SomeStorable{Storable: atree.SomeStorable{Storable: NewStringValue("a")}},
+		NewBigIntValue(big.NewInt(0)),
+		NewBigIntValue(big.NewInt(-1)),
+		NewBigIntValue(new(big.Int).Lsh(big.NewInt(1), 128)),
+		NewBigIntValue(new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 200))),
+	}
+}
+
+func TestValueEncodeDecode(t *testing.T) {
+	storage := newTestStorage(t)
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	for _, v := range testValues() {
+		data, err := atree.Encode(v, encMode)
+		require.NoError(t, err)
+		require.Equal(t, int(v.ByteSize()), len(data), "%T(%s)", v, v)
+
+		value, err := v.StoredValue(storage)
+		require.NoError(t, err)
+
+		// Hash input is CBOR encoding of value.
+		hashInput, err := HashInputProvider(value, nil)
+		require.NoError(t, err)
+		require.Equal(t, data, hashInput, "%T(%s)", v, v)
+
+		decoded, err := DecodeStorable(cbor.NewByteStreamDecoder(data), atree.StorageIDUndefined)
+		require.NoError(t, err)
+
+		equal, err := Compare(storage, value, decoded)
+		require.NoError(t, err)
+		require.True(t, equal, "%T(%s)", v, v)
+	}
+}
+
+func TestValueDecodeOutOfRange(t *testing.T) {
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	data, err := atree.Encode(Int16Value(math.MaxInt8+1), encMode)
+	require.NoError(t, err)
+
+	// Change tag number to Int8Value
+	data[1] = CBORTagInt8Value
+
+	_, err = DecodeStorable(cbor.NewByteStreamDecoder(data), atree.StorageIDUndefined)
+	require.Error(t, err)
+}
+
+func TestValueMap(t *testing.T) {
+	storage := newTestStorage(t)
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	m, err := atree.NewMap(storage, address, atree.NewDefaultDigesterBuilder(), testTypeInfo{42})
+	require.NoError(t, err)
+
+	values := testValues()
+
+	for i, v := range values {
+		k, err := v.StoredValue(storage)
+		require.NoError(t, err)
+
+		existingStorable, err := m.Set(Compare, HashInputProvider, k, Uint64Value(i))
+		require.NoError(t, err)
+		require.Nil(t, existingStorable)
+	}
+
+	require.Equal(t, uint64(len(values)), m.Count())
+
+	for i, v := range values {
+		k, err := v.StoredValue(storage)
+		require.NoError(t, err)
+
+		s, err := m.Get(Compare, HashInputProvider, k)
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(i), s)
+	}
+
+	_, err = atree.CheckStorageHealth(storage, 1)
+	require.NoError(t, err)
+}
+
+func TestValueLargeBytes(t *testing.T) {
+	storage := newTestStorage(t)
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	array, err := atree.NewArray(storage, address, testTypeInfo{42})
+	require.NoError(t, err)
+
+	v := NewBytesValue(make([]byte, 4096))
+
+	err = array.Append(v)
+	require.NoError(t, err)
+
+	s, err := array.Get(0)
+	require.NoError(t, err)
+	require.IsType(t, atree.StorageIDStorable{}, s)
+
+	stored, err := s.StoredValue(storage)
+	require.NoError(t, err)
+	require.Equal(t, v, stored)
+}
+
+func TestCompositeValue(t *testing.T) {
+	storage := newTestStorage(t)
+	address := atree.Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	layout, err := NewCompositeLayout("name", "version", "tags")
+	require.NoError(t, err)
+
+	parent, err := atree.NewArray(storage, address, testTypeInfo{1})
+	require.NoError(t, err)
+
+	composite, err := NewCompositeValue(storage, address, testTypeInfo{2}, layout)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), composite.FieldCount())
+
+	existing, err := composite.SetField("name", NewStringValue("atree"))
+	require.NoError(t, err)
+	require.Equal(t, NilValue{}, existing)
+
+	_, err = composite.SetField("version", Uint64Value(1))
+	require.NoError(t, err)
+
+	existing, err = composite.SetField("version", Uint64Value(2))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(1), existing)
+
+	_, err = composite.SetField("unknown", Uint64Value(1))
+	require.Error(t, err)
+
+	require.True(t, composite.HasField("tags"))
+	require.False(t, composite.HasField("unknown"))
+
+	err = parent.Append(composite)
+	require.NoError(t, err)
+
+	// Field names aren't stored with the composite.
+	stats, err := atree.GetArrayStats(composite.Array())
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stats.ElementCount)
+
+	// Load composite from parent.
+	s, err := parent.Get(0)
+	require.NoError(t, err)
+
+	v, err := s.StoredValue(storage)
+	require.NoError(t, err)
+
+	loaded, err := NewCompositeValueFromArray(v.(*atree.Array), layout)
+	require.NoError(t, err)
+	require.Equal(t, composite.StorageID(), loaded.StorageID())
+
+	name, err := loaded.GetField("name")
+	require.NoError(t, err)
+	require.Equal(t, NewStringValue("atree"), name)
+
+	var names []string
+	fields := map[string]atree.Value{}
+	err = loaded.IterateFields(func(name string, value atree.Value) (bool, error) {
+		names = append(names, name)
+		fields[name] = value
+		return true, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"name", "version", "tags"}, names)
+	require.Equal(t, map[string]atree.Value{
+		"name":    NewStringValue("atree"),
+		"version": Uint64Value(2),
+		"tags":    NilValue{},
+	}, fields)
+
+	// Layout must match stored composite.
+	otherLayout, err := NewCompositeLayout("name")
+	require.NoError(t, err)
+
+	_, err = NewCompositeValueFromArray(v.(*atree.Array), otherLayout)
+	require.Error(t, err)
+
+	_, err = NewCompositeLayout("name", "name")
+	require.Error(t, err)
+}
+
+func TestBigIntValueEqual(t *testing.T) {
+	a := NewBigIntValue(big.NewInt(1000))
+	b := NewBigIntValue(new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 200), big.NewInt(1000)))
+	b = NewBigIntValue(b.BigInt().Sub(b.BigInt(), new(big.Int).Lsh(big.NewInt(1), 200)))
+
+	require.True(t, a.Equal(b))
+	require.False(t, a.Equal(NewBigIntValue(big.NewInt(-1000))))
+	require.False(t, a.Equal(Uint64Value(1000)))
+
+	// Validators use Equal instead of comparator for Equatable elements.
+	storage := newTestStorage(t)
+
+	array, err := atree.NewArray(storage, atree.Address{1, 2, 3, 4, 5, 6, 7, 8}, testTypeInfo{42})
+	require.NoError(t, err)
+
+	for _, v := range []BigIntValue{a, b} {
+		require.NoError(t, array.Append(v))
+	}
+
+	encMode, err := cbor.EncOptions{}.EncMode()
+	require.NoError(t, err)
+
+	decMode, err := cbor.DecOptions{}.DecMode()
+	require.NoError(t, err)
+
+	never := func(atree.Storable, atree.Storable) bool { return false }
+	err = atree.ValidArraySerialization(array, decMode, encMode, DecodeStorable, decodeTypeInfo, never)
+	require.NoError(t, err)
+}
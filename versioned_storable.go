@@ -0,0 +1,128 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const CBORTagVersionedStorable = 248
+
+// VersionedStorable wraps application storable with version of its
+// encoding.  Applications evolving encoding of a value type wrap its
+// storable with current version in Value.Storable(), and register a
+// decoder for every version they have ever written with
+// DecodeVersionedStorable, so slabs written with old encodings can still
+// be decoded.  Decoders of old versions may return storable in the
+// current form to upgrade values on read.
+//
+// VersionedStorable is transparent: StoredValue returns value of
+// wrapped storable.
+type VersionedStorable struct {
+	Version  uint64
+	Storable Storable
+}
+
+var _ Storable = VersionedStorable{}
+
+// NewVersionedStorable returns storable wrapped with version.
+func NewVersionedStorable(version uint64, storable Storable) VersionedStorable {
+	return VersionedStorable{Version: version, Storable: storable}
+}
+
+func (v VersionedStorable) ByteSize() uint32 {
+	// tag number (2 bytes) + array head (1 byte) + version + encoded content
+	return 3 + GetUintCBORSize(v.Version) + v.Storable.ByteSize()
+}
+
+// Encode encodes VersionedStorable as
+// cbor.Tag{
+//		Number:  CBORTagVersionedStorable,
+//		Content: []interface{}{version, Storable(v)},
+// }
+func (v VersionedStorable) Encode(enc *Encoder) error {
+	err := enc.CBOR.EncodeRawBytes([]byte{
+		// tag number
+		0xd8, CBORTagVersionedStorable,
+		// array head of 2 elements
+		0x82,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = enc.CBOR.EncodeUint64(v.Version)
+	if err != nil {
+		return err
+	}
+
+	return v.Storable.Encode(enc)
+}
+
+func (v VersionedStorable) ChildStorables() []Storable {
+	return []Storable{v.Storable}
+}
+
+func (v VersionedStorable) StoredValue(storage SlabStorage) (Value, error) {
+	return v.Storable.StoredValue(storage)
+}
+
+func (v VersionedStorable) String() string {
+	return fmt.Sprintf("%s#v%d", v.Storable, v.Version)
+}
+
+// VersionedStorableDecoders maps encoding version to decoder of
+// storable written with that version.
+type VersionedStorableDecoders map[uint64]StorableDecoder
+
+// DecodeVersionedStorable decodes VersionedStorable after
+// CBORTagVersionedStorable is decoded.
+// Wrapped storable is decoded by decoder registered for its version.
+// Returned storable keeps the version it was decoded with.
+func DecodeVersionedStorable(dec *cbor.StreamDecoder, id StorageID, decoders VersionedStorableDecoders) (Storable, error) {
+	length, err := dec.DecodeArrayHead()
+	if err != nil {
+		return nil, err
+	}
+	if length != 2 {
+		return nil, NewDecodingErrorf("versioned storable has invalid array length %d, want 2", length)
+	}
+
+	version, err := dec.DecodeUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	decodeStorable, ok := decoders[version]
+	if !ok {
+		return nil, NewDecodingErrorf("versioned storable has unsupported version %d", version)
+	}
+
+	storable, err := decodeStorable(dec, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return VersionedStorable{
+		Version:  version,
+		Storable: storable,
+	}, nil
+}
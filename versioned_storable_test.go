@@ -0,0 +1,138 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeTestStorableV1 decodes version 1 encoding of Uint64Value as
+// decimal text string, upgrading it to current encoding on read.
+func decodeTestStorableV1(dec *cbor.StreamDecoder, _ StorageID) (Storable, error) {
+	s, err := dec.DecodeString()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return Uint64Value(n), nil
+}
+
+// testVersionedValue is Value stored with given encoding version.
+type testVersionedValue struct {
+	version  uint64
+	storable Storable
+}
+
+var _ Value = testVersionedValue{}
+
+func (v testVersionedValue) Storable(SlabStorage, Address, uint64) (Storable, error) {
+	return NewVersionedStorable(v.version, v.storable), nil
+}
+
+func TestVersionedStorableEncodeDecode(t *testing.T) {
+	storage := newTestPersistentStorage(t)
+
+	t.Run("current version", func(t *testing.T) {
+		storable := NewVersionedStorable(2, Uint64Value(42))
+
+		data, err := Encode(storable, storage.cborEncMode)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0xd8, CBORTagVersionedStorable, 0x82, 0x02, 0xd8, cborTagUInt64Value, 0x18, 0x2a}, data)
+		require.Equal(t, uint32(len(data)), storable.ByteSize())
+
+		decoded, err := decodeStorable(cbor.NewByteStreamDecoder(data), StorageIDUndefined)
+		require.NoError(t, err)
+		require.Equal(t, storable, decoded)
+
+		value, err := decoded.StoredValue(storage)
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(42), value)
+	})
+
+	t.Run("old version", func(t *testing.T) {
+		storable := NewVersionedStorable(1, NewStringValue("42"))
+
+		data, err := Encode(storable, storage.cborEncMode)
+		require.NoError(t, err)
+		require.Equal(t, uint32(len(data)), storable.ByteSize())
+
+		decoded, err := decodeStorable(cbor.NewByteStreamDecoder(data), StorageIDUndefined)
+		require.NoError(t, err)
+		require.Equal(t, NewVersionedStorable(1, Uint64Value(42)), decoded)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		storable := NewVersionedStorable(3, Uint64Value(42))
+
+		data, err := Encode(storable, storage.cborEncMode)
+		require.NoError(t, err)
+
+		_, err = decodeStorable(cbor.NewByteStreamDecoder(data), StorageIDUndefined)
+		require.Error(t, err)
+
+		var decodingError *DecodingError
+		require.ErrorAs(t, err, &decodingError)
+	})
+}
+
+func TestVersionedStorableInArray(t *testing.T) {
+	typeInfo := testTypeInfo{42}
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	baseStorage := NewInMemBaseStorage()
+	storage := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	array, err := NewArray(storage, address, typeInfo)
+	require.NoError(t, err)
+
+	const arraySize = 64
+	for i := uint64(0); i < arraySize; i++ {
+		v := testVersionedValue{version: 2, storable: Uint64Value(i)}
+		if i%2 == 0 {
+			v = testVersionedValue{version: 1, storable: NewStringValue(strconv.FormatUint(i, 10))}
+		}
+		err = array.Append(v)
+		require.NoError(t, err)
+	}
+
+	err = storage.Commit()
+	require.NoError(t, err)
+
+	storage2 := newTestPersistentStorageWithBaseStorage(t, baseStorage)
+
+	array2, err := NewArrayWithRootID(storage2, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, uint64(arraySize), array2.Count())
+
+	for i := uint64(0); i < arraySize; i++ {
+		s, err := array2.Get(i)
+		require.NoError(t, err)
+
+		v, err := s.StoredValue(storage2)
+		require.NoError(t, err)
+		require.Equal(t, Uint64Value(i), v)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+// VersionedStorage retains committed states of PersistentSlabStorage as
+// numbered versions.  Each Commit produces an immutable version that can
+// be reopened later to read collections as of that commit.
+//
+// Versions are storage snapshots taken right after commit, so they share
+// unchanged slabs with base storage.  Only slabs overwritten or removed by
+// later commits are copied into versions that still reference them.
+// Prune releases versions that are no longer needed.
+type VersionedStorage struct {
+	storage  *PersistentSlabStorage
+	versions map[uint64]*StorageSnapshot
+	latest   uint64
+}
+
+// NewVersionedStorage returns VersionedStorage committing to storage.
+// Changes committed directly to storage (bypassing VersionedStorage)
+// are visible in the next version, not as separate versions.
+func NewVersionedStorage(storage *PersistentSlabStorage) *VersionedStorage {
+	return &VersionedStorage{
+		storage:  storage,
+		versions: make(map[uint64]*StorageSnapshot),
+	}
+}
+
+// Storage returns underlying storage used to mutate collections.
+func (v *VersionedStorage) Storage() *PersistentSlabStorage {
+	return v.storage
+}
+
+// Commit commits storage and returns number of new version.
+// Version numbers start at 1 and increase by 1 with each commit.
+func (v *VersionedStorage) Commit() (uint64, error) {
+	err := v.storage.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	snapshot, err := v.storage.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	v.latest++
+	v.versions[v.latest] = snapshot
+
+	return v.latest, nil
+}
+
+// LatestVersion returns number of the most recent version,
+// or 0 if nothing is committed.
+func (v *VersionedStorage) LatestVersion() uint64 {
+	return v.latest
+}
+
+// Version returns read-only storage as of given version.
+func (v *VersionedStorage) Version(version uint64) (*StorageSnapshot, error) {
+	snapshot, ok := v.versions[version]
+	if !ok {
+		return nil, NewVersionNotFoundError(version)
+	}
+	return snapshot, nil
+}
+
+// ArrayAt returns read-only array with rootID as of given version.
+func (v *VersionedStorage) ArrayAt(version uint64, rootID StorageID) (*Array, error) {
+	snapshot, err := v.Version(version)
+	if err != nil {
+		return nil, err
+	}
+	return NewArrayWithRootID(snapshot, rootID)
+}
+
+// MapAt returns read-only map with rootID as of given version.
+func (v *VersionedStorage) MapAt(version uint64, rootID StorageID, digestBuilder DigesterBuilder) (*OrderedMap, error) {
+	snapshot, err := v.Version(version)
+	if err != nil {
+		return nil, err
+	}
+	return NewMapWithRootID(snapshot, rootID, digestBuilder)
+}
+
+// Prune releases versions older than given version.
+// Collections opened on released versions can no longer be read.
+func (v *VersionedStorage) Prune(version uint64) {
+	for n, snapshot := range v.versions {
+		if n < version {
+			snapshot.Release()
+			delete(v.versions, n)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * Atree - Scalable Arrays and Ordered Maps
+ *
+ * Copyright 2021-2022 Dapper Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package atree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionedStorageArray(t *testing.T) {
+
+	SetThreshold(256)
+	defer SetThreshold(1024)
+
+	const arraySize = 512
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	versioned := NewVersionedStorage(storage)
+	require.Equal(t, uint64(0), versioned.LatestVersion())
+
+	array, err := NewArray(versioned.Storage(), address, typeInfo)
+	require.NoError(t, err)
+
+	// history[i] contains elements as of version i+1.
+	var history [][]Value
+
+	var values []Value
+	for round := 0; round < 4; round++ {
+		for i := 0; i < arraySize/4; i++ {
+			v := Uint64Value(len(values))
+			values = append(values, v)
+			err := array.Append(v)
+			require.NoError(t, err)
+		}
+
+		// Overwrite elements in the first slabs to change shared slabs.
+		v := Uint64Value(round * 1000)
+		values[0] = v
+		_, err := array.Set(0, v)
+		require.NoError(t, err)
+
+		version, err := versioned.Commit()
+		require.NoError(t, err)
+		require.Equal(t, uint64(round+1), version)
+
+		history = append(history, append([]Value(nil), values...))
+	}
+	require.Equal(t, uint64(4), versioned.LatestVersion())
+
+	for i, expected := range history {
+		versionArray, err := versioned.ArrayAt(uint64(i+1), array.StorageID())
+		require.NoError(t, err)
+		require.Equal(t, expected, arrayElements(t, versionArray))
+
+		// Version is read-only.
+		err = versionArray.Append(Uint64Value(0))
+		var readOnlyError *ReadOnlyError
+		require.ErrorAs(t, err, &readOnlyError)
+	}
+
+	_, err = versioned.ArrayAt(5, array.StorageID())
+	var versionNotFoundError *VersionNotFoundError
+	require.ErrorAs(t, err, &versionNotFoundError)
+	require.True(t, IsUserError(err))
+
+	versioned.Prune(3)
+
+	_, err = versioned.Version(2)
+	require.ErrorAs(t, err, &versionNotFoundError)
+
+	versionArray, err := versioned.ArrayAt(3, array.StorageID())
+	require.NoError(t, err)
+	require.Equal(t, history[2], arrayElements(t, versionArray))
+}
+
+func TestVersionedStorageMap(t *testing.T) {
+
+	typeInfo := testTypeInfo{42}
+	storage := newTestPersistentStorage(t)
+	address := Address{1, 2, 3, 4, 5, 6, 7, 8}
+
+	versioned := NewVersionedStorage(storage)
+
+	digesterBuilder := NewDefaultDigesterBuilder()
+
+	m, err := NewMap(versioned.Storage(), address, digesterBuilder, typeInfo)
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(10))
+	require.NoError(t, err)
+
+	v1, err := versioned.Commit()
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(1), Uint64Value(20))
+	require.NoError(t, err)
+
+	_, err = m.Set(compare, hashInputProvider, Uint64Value(2), Uint64Value(30))
+	require.NoError(t, err)
+
+	v2, err := versioned.Commit()
+	require.NoError(t, err)
+
+	_, _, err = m.Remove(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+
+	v3, err := versioned.Commit()
+	require.NoError(t, err)
+
+	m1, err := versioned.MapAt(v1, m.StorageID(), digesterBuilder)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), m1.Count())
+
+	value, err := m1.Get(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(10), value)
+
+	m2, err := versioned.MapAt(v2, m.StorageID(), digesterBuilder)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), m2.Count())
+
+	value, err = m2.Get(compare, hashInputProvider, Uint64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, Uint64Value(20), value)
+
+	m3, err := versioned.MapAt(v3, m.StorageID(), digesterBuilder)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), m3.Count())
+
+	_, err = m3.Get(compare, hashInputProvider, Uint64Value(1))
+	var keyNotFoundError *KeyNotFoundError
+	require.ErrorAs(t, err, &keyNotFoundError)
+}